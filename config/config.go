@@ -7,10 +7,75 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+// AuditSinkConfig 审计日志转发目标配置
+type AuditSinkConfig struct {
+	Name    string            `json:"name"`    // 唯一名称，同时作为转发游标的键，改名后会从头转发
+	Type    string            `json:"type"`    // syslog、cef或webhook
+	Network string            `json:"network"` // syslog/cef传输协议：udp或tcp，默认udp
+	Address string            `json:"address"` // syslog/cef接收地址，如siem.example.com:514
+	URL     string            `json:"url"`     // webhook地址
+	Secret  string            `json:"secret"`  // webhook签名密钥，非空时在X-Weave-Signature头中附带HMAC-SHA256签名
+	Headers map[string]string `json:"headers"` // webhook附加请求头
+}
+
+// AnomalyRuleConfig 异常检测规则配置
+type AnomalyRuleConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Severity  string `json:"severity"`            // low、medium、high或critical
+	Window    int    `json:"window,omitempty"`    // 统计窗口（秒），只用于窗口类规则
+	Threshold int    `json:"threshold,omitempty"` // 窗口内触发告警的阈值，只用于窗口类规则
+}
+
+// LLMProviderConfig LLM提供方配置
+type LLMProviderConfig struct {
+	Name    string            `json:"name"`    // 唯一名称，在别名和路由规则中以name或name/model引用
+	Type    string            `json:"type"`    // ollama、openai、ark或fake
+	BaseURL string            `json:"baseUrl"` // 服务地址，openai为空时使用官方地址
+	APIKey  string            `json:"apiKey"`  // openai和ark的访问密钥
+	Model   string            `json:"model"`   // 只引用提供方名称时使用的模型
+	Timeout int               `json:"timeout"` // 单次调用超时（秒），0表示使用LLM.Timeout
+	Options map[string]string `json:"options"` // 类型相关的附加参数，如fake的response、error、delay
+}
+
+// LLMPrice 模型的令牌单价，按每百万令牌计
+type LLMPrice struct {
+	Input  float64 `json:"input"`  // 提示词令牌单价
+	Output float64 `json:"output"` // 生成令牌单价
+}
+
+// LLMCacheConfig 模型回答缓存配置
+// 相同租户、模型和上下文下规范化后相同的问题直接返回缓存的回答；
+// SimilarityThreshold大于0且有嵌入模型时，向量相似度达到阈值的问题也视为命中
+type LLMCacheConfig struct {
+	Enabled             bool
+	Store               string  // memory或redis
+	RedisAddr           string  // Store为redis时的地址
+	TTL                 int     // 缓存有效期（秒）
+	MaxEntries          int     // 内存存储的最大条目数，超出时淘汰最早的条目
+	SimilarityThreshold float64 // 相似问题的余弦相似度阈值，0表示只按问题原文匹配
+	EmbeddingModel      string  // LLM对话计算问题向量使用的模型引用，为空时对话只按原文匹配
+}
+
+// LLMConfig LLM提供方、模型别名与路由配置
+// 模型以别名、提供方名称或“提供方/模型”的形式引用；租户可以单独覆盖默认模型、备用模型和路由规则
+type LLMConfig struct {
+	Providers []LLMProviderConfig
+	Aliases   map[string]string   // 模型别名，如fast: ollama/qwen2.5
+	Routes    map[string]string   // 按任务选择模型，如chat: fast、rag: ark
+	Default   string              // 没有匹配的路由规则时使用的模型
+	Fallback  string              // 主模型出错或超时后改用的备用模型，为空表示不降级
+	Timeout   int                 // 单次调用默认超时（秒）
+	PoolSize  int                 // 每个提供方/模型的连接池容量
+	Prices    map[string]LLMPrice // 按“提供方/模型”或模型名称配置的令牌单价，用于用量报表计算费用
+	Currency  string              // 单价的货币单位
+	Cache     LLMCacheConfig      // 对话和知识库问答的回答缓存
+}
+
 // Config 应用程序配置结构
 var Config struct {
 	// 配置文件设置
@@ -21,7 +86,7 @@ var Config struct {
 
 	// 服务器配置
 	Server struct {
-		Port int
+		Port       int
 		InstanceID string // 实例标识，用于多实例部署
 	}
 
@@ -47,8 +112,12 @@ var Config struct {
 	// JWT配置
 	JWT struct {
 		Secret             string
-		AccessTokenExpiry  int // 访问令牌过期时间（分钟）
-		RefreshTokenExpiry int // 刷新令牌过期时间（小时）
+		AccessTokenExpiry  int    // 访问令牌过期时间（分钟）
+		RefreshTokenExpiry int    // 刷新令牌过期时间（小时）
+		Algorithm          string // 签名算法：HS256/RS256/EdDSA
+		KeyDir             string // 非对称签名密钥存储目录
+		RotationInterval   int    // 签名密钥轮换间隔（小时）
+		KeyRetention       int    // 轮换后旧密钥保留用于验证的时间（小时）
 	}
 
 	// CSRF配置
@@ -83,6 +152,84 @@ var Config struct {
 		EnableGoMetrics   bool
 		EnableHTTPMetrics bool
 	}
+
+	// 多租户配置
+	Tenant struct {
+		PlatformAdmins []string // 平台管理员用户名，可管理所有租户
+		StatusCacheTTL int      // 租户状态缓存时间（秒）
+	}
+
+	// 租户配额默认值，0表示不限制，可按租户单独覆盖
+	Quota struct {
+		Enabled                   bool
+		MaxUsers                  int64
+		MaxTeams                  int64
+		MaxTools                  int64
+		MaxNotes                  int64
+		MaxPluginExecutionsPerDay int64
+		MaxLLMTokensPerMonth      int64
+	}
+
+	// 团队配置
+	Team struct {
+		InvitationTTL             int // 团队邀请有效期（小时）
+		InvitationCleanupInterval int // 过期邀请清理间隔（秒），0表示不启动清理任务
+		MaxDepth                  int // 团队层级最大深度，根团队深度为1
+	}
+
+	// 审计日志配置
+	Audit struct {
+		CheckpointSecret   string // 签名检查点的HMAC密钥，为空时使用JWT.Secret
+		CheckpointInterval int    // 签名检查点生成间隔（秒），0表示不启动定期任务
+		QueueSize          int    // 审计日志内存队列容量，队列满时落盘到SpoolDir
+		BatchSize          int    // 每批写入数据库的最大记录数
+		FlushInterval      int    // 批量写入间隔（毫秒）
+		SpoolDir           string // 数据库不可用或队列溢出时的落盘目录
+		Sinks              []AuditSinkConfig
+		SinkBatchSize      int // 每次转发的最大记录数
+		SinkPollInterval   int // 转发轮询间隔（毫秒），发送失败时按指数退避重试
+		SinkGapWait        int // 遇到ID空洞时等待未提交事务的时间（毫秒），0表示不等待
+	}
+
+	// 数据保留与归档配置，租户未单独设置保留策略时使用这里的默认保留天数
+	Retention struct {
+		Interval         int    // 保留任务执行间隔（秒），0表示不启动定期任务
+		AuditLogDays     int    // 审计日志默认保留天数，0表示永久保留
+		LoginHistoryDays int    // 登录历史默认保留天数，0表示永久保留
+		ToolHistoryDays  int    // 工具使用历史默认保留天数，0表示永久保留
+		BatchSize        int    // 每个归档文件的最大记录数
+		RestoreTTL       int    // 恢复的记录保留时间（小时），到期后再次删除
+		Storage          string // 归档存储：local或s3
+		ArchiveDir       string // 本地归档目录
+		S3               struct {
+			Endpoint  string // S3兼容服务地址，如https://s3.us-east-1.amazonaws.com或http://minio:9000
+			Region    string
+			Bucket    string
+			Prefix    string // 对象键前缀
+			AccessKey string
+			SecretKey string
+			PathStyle bool // 使用路径风格的地址（MinIO等需要）
+		}
+	}
+
+	// 安全异常检测配置
+	Anomaly struct {
+		Interval          int    // 检测间隔（秒），0表示不启动定期检测
+		BatchSize         int    // 每次读取的最大记录数
+		NotifyMinSeverity string // 达到该级别的告警才发送webhook通知
+		WebhookURL        string // 告警通知地址，为空表示不发送
+		WebhookSecret     string // 告警通知签名密钥
+		Rules             struct {
+			NewIP               AnomalyRuleConfig // 从未使用过的IP登录
+			NewUserAgent        AnomalyRuleConfig // 从未使用过的客户端登录
+			LoginBurst          AnomalyRuleConfig // 窗口内从Threshold个不同网段登录
+			MassDeletion        AnomalyRuleConfig // 窗口内删除操作达到Threshold次
+			PrivilegeEscalation AnomalyRuleConfig // 提升团队成员为管理员或转让所有权
+		}
+	}
+
+	// LLM提供方与模型路由配置
+	LLM LLMConfig
 }
 
 // 重置默认配置到初始值
@@ -115,6 +262,10 @@ func resetDefaults() {
 	Config.JWT.Secret = ""                 // 敏感信息，将通过环境变量或配置文件设置
 	Config.JWT.AccessTokenExpiry = 60      // 60分钟
 	Config.JWT.RefreshTokenExpiry = 24 * 7 // 7天
+	Config.JWT.Algorithm = "HS256"
+	Config.JWT.KeyDir = "./config/keys"
+	Config.JWT.RotationInterval = 24 * 30 // 30天
+	Config.JWT.KeyRetention = 24 * 7      // 7天，需覆盖刷新令牌有效期
 
 	// CSRF配置
 	Config.CSRF.Enabled = true
@@ -142,6 +293,79 @@ func resetDefaults() {
 	Config.Prometheus.MetricsPath = "/metrics"
 	Config.Prometheus.EnableGoMetrics = true
 	Config.Prometheus.EnableHTTPMetrics = true
+
+	// 多租户配置
+	Config.Tenant.PlatformAdmins = nil
+	Config.Tenant.StatusCacheTTL = 30 // 30秒
+
+	// 租户配额默认值（0表示不限制）
+	Config.Quota.Enabled = true
+	Config.Quota.MaxUsers = 0
+	Config.Quota.MaxTeams = 0
+	Config.Quota.MaxTools = 0
+	Config.Quota.MaxNotes = 0
+	Config.Quota.MaxPluginExecutionsPerDay = 0
+	Config.Quota.MaxLLMTokensPerMonth = 0
+
+	// 团队配置
+	Config.Team.InvitationTTL = 168              // 7天
+	Config.Team.InvitationCleanupInterval = 3600 // 1小时
+	Config.Team.MaxDepth = 8
+
+	// 审计日志配置
+	Config.Audit.CheckpointSecret = "" // 敏感信息，将通过环境变量或配置文件设置
+	Config.Audit.CheckpointInterval = 3600
+	Config.Audit.QueueSize = 10000
+	Config.Audit.BatchSize = 100
+	Config.Audit.FlushInterval = 1000
+	Config.Audit.SpoolDir = "./data/audit-spool"
+	Config.Audit.Sinks = nil
+	Config.Audit.SinkBatchSize = 100
+	Config.Audit.SinkPollInterval = 1000
+	Config.Audit.SinkGapWait = 5000
+
+	// 数据保留配置
+	Config.Retention.Interval = 86400
+	Config.Retention.AuditLogDays = 0
+	Config.Retention.LoginHistoryDays = 0
+	Config.Retention.ToolHistoryDays = 0
+	Config.Retention.BatchSize = 5000
+	Config.Retention.RestoreTTL = 168
+	Config.Retention.Storage = "local"
+	Config.Retention.ArchiveDir = "./data/archive"
+	Config.Retention.S3.Endpoint = ""
+	Config.Retention.S3.Region = "us-east-1"
+	Config.Retention.S3.Bucket = ""
+	Config.Retention.S3.Prefix = ""
+	Config.Retention.S3.AccessKey = "" // 敏感信息，将通过环境变量或配置文件设置
+	Config.Retention.S3.SecretKey = ""
+	Config.Retention.S3.PathStyle = false
+
+	// 安全异常检测配置
+	Config.Anomaly.Interval = 60
+	Config.Anomaly.BatchSize = 500
+	Config.Anomaly.NotifyMinSeverity = "medium"
+	Config.Anomaly.WebhookURL = ""
+	Config.Anomaly.WebhookSecret = "" // 敏感信息，将通过环境变量或配置文件设置
+	Config.Anomaly.Rules.NewIP = AnomalyRuleConfig{Enabled: true, Severity: "medium"}
+	Config.Anomaly.Rules.NewUserAgent = AnomalyRuleConfig{Enabled: true, Severity: "low"}
+	Config.Anomaly.Rules.LoginBurst = AnomalyRuleConfig{Enabled: true, Severity: "high", Window: 3600, Threshold: 3}
+	Config.Anomaly.Rules.MassDeletion = AnomalyRuleConfig{Enabled: true, Severity: "high", Window: 300, Threshold: 20}
+	Config.Anomaly.Rules.PrivilegeEscalation = AnomalyRuleConfig{Enabled: true, Severity: "high"}
+
+	// LLM配置，默认只使用本地Ollama
+	Config.LLM.Providers = []LLMProviderConfig{
+		{Name: "ollama", Type: "ollama", BaseURL: "http://localhost:11434", Model: "deepseek-r1"},
+	}
+	Config.LLM.Aliases = map[string]string{}
+	Config.LLM.Routes = map[string]string{}
+	Config.LLM.Default = "ollama"
+	Config.LLM.Fallback = ""
+	Config.LLM.Timeout = 60
+	Config.LLM.PoolSize = 5
+	Config.LLM.Prices = map[string]LLMPrice{}
+	Config.LLM.Currency = "USD"
+	Config.LLM.Cache = LLMCacheConfig{Store: "memory", RedisAddr: "localhost:6379", TTL: 3600, MaxEntries: 10000}
 }
 
 func init() {
@@ -159,7 +383,7 @@ func ValidateConfig() error {
 		return fmt.Errorf("数据库密码未配置，请设置DB_PASSWORD环境变量或在配置文件中指定")
 	}
 
-	if Config.JWT.Secret == "" {
+	if Config.JWT.Secret == "" && Config.JWT.Algorithm == "HS256" {
 		return fmt.Errorf("JWT密钥未配置，请设置JWT_SECRET环境变量或在配置文件中指定")
 	}
 
@@ -197,6 +421,20 @@ func ValidateConfig() error {
 		return fmt.Errorf("无效的刷新令牌过期时间: %d，必须大于0小时", Config.JWT.RefreshTokenExpiry)
 	}
 
+	validAlgorithms := map[string]bool{"HS256": true, "RS256": true, "EdDSA": true}
+	if !validAlgorithms[Config.JWT.Algorithm] {
+		return fmt.Errorf("无效的JWT签名算法: %s，有效值为: HS256, RS256, EdDSA", Config.JWT.Algorithm)
+	}
+
+	if Config.JWT.Algorithm != "HS256" {
+		if Config.JWT.RotationInterval <= 0 {
+			return fmt.Errorf("无效的JWT密钥轮换间隔: %d，必须大于0小时", Config.JWT.RotationInterval)
+		}
+		if Config.JWT.KeyRetention < Config.JWT.RefreshTokenExpiry {
+			return fmt.Errorf("JWT旧密钥保留时间(%d小时)不能小于刷新令牌有效期(%d小时)", Config.JWT.KeyRetention, Config.JWT.RefreshTokenExpiry)
+		}
+	}
+
 	// 6. 验证CSRF配置
 	if Config.CSRF.TokenLength < 16 {
 		return fmt.Errorf("CSRF令牌长度过小: %d，建议至少16个字符", Config.CSRF.TokenLength)
@@ -229,6 +467,184 @@ func ValidateConfig() error {
 		return fmt.Errorf("Prometheus指标路径必须以斜杠开头: %s", Config.Prometheus.MetricsPath)
 	}
 
+	// 9. 验证多租户配置
+	if Config.Tenant.StatusCacheTTL < 0 {
+		return fmt.Errorf("无效的租户状态缓存时间: %d，不能小于0秒", Config.Tenant.StatusCacheTTL)
+	}
+
+	// 10. 验证配额配置
+	if Config.Quota.MaxUsers < 0 || Config.Quota.MaxTeams < 0 || Config.Quota.MaxTools < 0 || Config.Quota.MaxNotes < 0 ||
+		Config.Quota.MaxPluginExecutionsPerDay < 0 || Config.Quota.MaxLLMTokensPerMonth < 0 {
+		return fmt.Errorf("租户配额不能为负数，0表示不限制")
+	}
+
+	// 11. 验证团队配置
+	if Config.Team.InvitationTTL <= 0 {
+		return fmt.Errorf("无效的团队邀请有效期: %d，必须大于0小时", Config.Team.InvitationTTL)
+	}
+	if Config.Team.InvitationCleanupInterval < 0 {
+		return fmt.Errorf("无效的过期邀请清理间隔: %d，不能小于0秒", Config.Team.InvitationCleanupInterval)
+	}
+	if Config.Team.MaxDepth <= 0 {
+		return fmt.Errorf("无效的团队层级最大深度: %d，必须大于0", Config.Team.MaxDepth)
+	}
+	if Config.Audit.CheckpointInterval < 0 {
+		return fmt.Errorf("无效的审计检查点间隔: %d，不能小于0秒", Config.Audit.CheckpointInterval)
+	}
+	if Config.Audit.QueueSize <= 0 {
+		return fmt.Errorf("无效的审计队列容量: %d，必须大于0", Config.Audit.QueueSize)
+	}
+	if Config.Audit.BatchSize <= 0 {
+		return fmt.Errorf("无效的审计批量大小: %d，必须大于0", Config.Audit.BatchSize)
+	}
+	if Config.Audit.FlushInterval <= 0 {
+		return fmt.Errorf("无效的审计写入间隔: %d，必须大于0毫秒", Config.Audit.FlushInterval)
+	}
+	if Config.Audit.SinkBatchSize <= 0 {
+		return fmt.Errorf("无效的审计转发批量大小: %d，必须大于0", Config.Audit.SinkBatchSize)
+	}
+	if Config.Audit.SinkPollInterval <= 0 {
+		return fmt.Errorf("无效的审计转发轮询间隔: %d，必须大于0毫秒", Config.Audit.SinkPollInterval)
+	}
+	if Config.Audit.SinkGapWait < 0 {
+		return fmt.Errorf("无效的审计转发空洞等待时间: %d，不能小于0毫秒", Config.Audit.SinkGapWait)
+	}
+	sinkNames := make(map[string]bool)
+	for _, sink := range Config.Audit.Sinks {
+		if sink.Name == "" {
+			return fmt.Errorf("审计转发目标名称不能为空")
+		}
+		if sinkNames[sink.Name] {
+			return fmt.Errorf("审计转发目标名称重复: %s", sink.Name)
+		}
+		sinkNames[sink.Name] = true
+		switch sink.Type {
+		case "syslog", "cef":
+			if sink.Address == "" {
+				return fmt.Errorf("审计转发目标%s缺少address", sink.Name)
+			}
+			if sink.Network != "" && sink.Network != "udp" && sink.Network != "tcp" {
+				return fmt.Errorf("审计转发目标%s的协议无效: %s，必须是udp或tcp", sink.Name, sink.Network)
+			}
+		case "webhook":
+			if sink.URL == "" {
+				return fmt.Errorf("审计转发目标%s缺少url", sink.Name)
+			}
+		default:
+			return fmt.Errorf("审计转发目标%s的类型无效: %s，必须是syslog、cef或webhook", sink.Name, sink.Type)
+		}
+	}
+
+	// 验证数据保留配置
+	if Config.Retention.Interval < 0 {
+		return fmt.Errorf("无效的数据保留任务间隔: %d，不能小于0秒", Config.Retention.Interval)
+	}
+	if Config.Retention.AuditLogDays < 0 || Config.Retention.LoginHistoryDays < 0 || Config.Retention.ToolHistoryDays < 0 {
+		return fmt.Errorf("数据保留天数不能小于0")
+	}
+	if Config.Retention.BatchSize <= 0 {
+		return fmt.Errorf("无效的归档批量大小: %d，必须大于0", Config.Retention.BatchSize)
+	}
+	if Config.Retention.RestoreTTL <= 0 {
+		return fmt.Errorf("无效的恢复记录保留时间: %d，必须大于0小时", Config.Retention.RestoreTTL)
+	}
+	switch Config.Retention.Storage {
+	case "local":
+		if Config.Retention.ArchiveDir == "" {
+			return fmt.Errorf("本地归档目录未配置")
+		}
+	case "s3":
+		if Config.Retention.S3.Endpoint == "" || Config.Retention.S3.Bucket == "" {
+			return fmt.Errorf("S3归档存储需要配置endpoint和bucket")
+		}
+	default:
+		return fmt.Errorf("无效的归档存储: %s，必须是local或s3", Config.Retention.Storage)
+	}
+
+	// 验证安全异常检测配置
+	if Config.Anomaly.Interval < 0 {
+		return fmt.Errorf("无效的异常检测间隔: %d，不能小于0秒", Config.Anomaly.Interval)
+	}
+	if Config.Anomaly.BatchSize <= 0 {
+		return fmt.Errorf("无效的异常检测批量大小: %d，必须大于0", Config.Anomaly.BatchSize)
+	}
+	if !isValidSeverity(Config.Anomaly.NotifyMinSeverity) {
+		return fmt.Errorf("无效的告警通知级别: %s，必须是low、medium、high或critical", Config.Anomaly.NotifyMinSeverity)
+	}
+	for name, rule := range map[string]AnomalyRuleConfig{
+		"newIp":               Config.Anomaly.Rules.NewIP,
+		"newUserAgent":        Config.Anomaly.Rules.NewUserAgent,
+		"loginBurst":          Config.Anomaly.Rules.LoginBurst,
+		"massDeletion":        Config.Anomaly.Rules.MassDeletion,
+		"privilegeEscalation": Config.Anomaly.Rules.PrivilegeEscalation,
+	} {
+		if !isValidSeverity(rule.Severity) {
+			return fmt.Errorf("异常检测规则%s的级别无效: %s", name, rule.Severity)
+		}
+	}
+	for name, rule := range map[string]AnomalyRuleConfig{
+		"loginBurst":   Config.Anomaly.Rules.LoginBurst,
+		"massDeletion": Config.Anomaly.Rules.MassDeletion,
+	} {
+		if rule.Enabled && (rule.Window <= 0 || rule.Threshold < 2) {
+			return fmt.Errorf("异常检测规则%s需要大于0的窗口和不小于2的阈值", name)
+		}
+	}
+
+	// 验证LLM配置，模型引用能否解析在创建提供方注册表时校验
+	if len(Config.LLM.Providers) == 0 {
+		return fmt.Errorf("至少需要配置一个LLM提供方")
+	}
+	providerNames := make(map[string]bool)
+	for _, provider := range Config.LLM.Providers {
+		if provider.Name == "" || strings.Contains(provider.Name, "/") {
+			return fmt.Errorf("LLM提供方名称不能为空或包含斜杠: %q", provider.Name)
+		}
+		if providerNames[provider.Name] {
+			return fmt.Errorf("LLM提供方名称重复: %s", provider.Name)
+		}
+		providerNames[provider.Name] = true
+		switch provider.Type {
+		case "ollama", "openai", "ark", "fake":
+		default:
+			return fmt.Errorf("LLM提供方%s的类型无效: %s，必须是ollama、openai、ark或fake", provider.Name, provider.Type)
+		}
+		if provider.Type == "ark" && provider.APIKey == "" {
+			return fmt.Errorf("LLM提供方%s缺少apiKey", provider.Name)
+		}
+		if provider.Timeout < 0 {
+			return fmt.Errorf("LLM提供方%s的超时无效: %d，不能小于0秒", provider.Name, provider.Timeout)
+		}
+	}
+	if Config.LLM.Default == "" {
+		return fmt.Errorf("LLM默认模型未配置")
+	}
+	if Config.LLM.Timeout <= 0 {
+		return fmt.Errorf("无效的LLM调用超时: %d，必须大于0秒", Config.LLM.Timeout)
+	}
+	if Config.LLM.PoolSize <= 0 {
+		return fmt.Errorf("无效的LLM连接池容量: %d，必须大于0", Config.LLM.PoolSize)
+	}
+	for model, price := range Config.LLM.Prices {
+		if price.Input < 0 || price.Output < 0 {
+			return fmt.Errorf("模型%s的令牌单价无效，不能小于0", model)
+		}
+	}
+	if Config.LLM.Cache.Enabled {
+		if Config.LLM.Cache.Store != "memory" && Config.LLM.Cache.Store != "redis" {
+			return fmt.Errorf("无效的LLM缓存存储: %s，必须是memory或redis", Config.LLM.Cache.Store)
+		}
+		if Config.LLM.Cache.TTL <= 0 {
+			return fmt.Errorf("无效的LLM缓存有效期: %d，必须大于0秒", Config.LLM.Cache.TTL)
+		}
+		if Config.LLM.Cache.Store == "memory" && Config.LLM.Cache.MaxEntries <= 0 {
+			return fmt.Errorf("无效的LLM缓存容量: %d，必须大于0", Config.LLM.Cache.MaxEntries)
+		}
+	}
+	if Config.LLM.Cache.SimilarityThreshold < 0 || Config.LLM.Cache.SimilarityThreshold > 1 {
+		return fmt.Errorf("无效的LLM缓存相似度阈值: %v，必须在0到1之间", Config.LLM.Cache.SimilarityThreshold)
+	}
+
 	return nil
 }
 
@@ -274,6 +690,10 @@ func SanitizeConfig() map[string]interface{} {
 			"Secret":             "***", // 隐藏密钥
 			"AccessTokenExpiry":  Config.JWT.AccessTokenExpiry,
 			"RefreshTokenExpiry": Config.JWT.RefreshTokenExpiry,
+			"Algorithm":          Config.JWT.Algorithm,
+			"KeyDir":             Config.JWT.KeyDir,
+			"RotationInterval":   Config.JWT.RotationInterval,
+			"KeyRetention":       Config.JWT.KeyRetention,
 		},
 		"CSRF": map[string]interface{}{
 			"Enabled":        Config.CSRF.Enabled,
@@ -300,11 +720,110 @@ func SanitizeConfig() map[string]interface{} {
 			"EnableGoMetrics":   Config.Prometheus.EnableGoMetrics,
 			"EnableHTTPMetrics": Config.Prometheus.EnableHTTPMetrics,
 		},
+		"Tenant": map[string]interface{}{
+			"PlatformAdmins": Config.Tenant.PlatformAdmins,
+			"StatusCacheTTL": Config.Tenant.StatusCacheTTL,
+		},
+		"Quota": map[string]interface{}{
+			"Enabled":                   Config.Quota.Enabled,
+			"MaxUsers":                  Config.Quota.MaxUsers,
+			"MaxTeams":                  Config.Quota.MaxTeams,
+			"MaxTools":                  Config.Quota.MaxTools,
+			"MaxNotes":                  Config.Quota.MaxNotes,
+			"MaxPluginExecutionsPerDay": Config.Quota.MaxPluginExecutionsPerDay,
+			"MaxLLMTokensPerMonth":      Config.Quota.MaxLLMTokensPerMonth,
+		},
+		"Team": map[string]interface{}{
+			"InvitationTTL":             Config.Team.InvitationTTL,
+			"InvitationCleanupInterval": Config.Team.InvitationCleanupInterval,
+			"MaxDepth":                  Config.Team.MaxDepth,
+		},
+		"Audit": map[string]interface{}{
+			"CheckpointSecret":   "***", // 隐藏密钥
+			"CheckpointInterval": Config.Audit.CheckpointInterval,
+			"QueueSize":          Config.Audit.QueueSize,
+			"BatchSize":          Config.Audit.BatchSize,
+			"FlushInterval":      Config.Audit.FlushInterval,
+			"SpoolDir":           Config.Audit.SpoolDir,
+			"Sinks":              sanitizedAuditSinks(),
+			"SinkBatchSize":      Config.Audit.SinkBatchSize,
+			"SinkPollInterval":   Config.Audit.SinkPollInterval,
+			"SinkGapWait":        Config.Audit.SinkGapWait,
+		},
+		"Retention": map[string]interface{}{
+			"Interval":         Config.Retention.Interval,
+			"AuditLogDays":     Config.Retention.AuditLogDays,
+			"LoginHistoryDays": Config.Retention.LoginHistoryDays,
+			"ToolHistoryDays":  Config.Retention.ToolHistoryDays,
+			"BatchSize":        Config.Retention.BatchSize,
+			"RestoreTTL":       Config.Retention.RestoreTTL,
+			"Storage":          Config.Retention.Storage,
+			"ArchiveDir":       Config.Retention.ArchiveDir,
+			"S3": map[string]interface{}{
+				"Endpoint":  Config.Retention.S3.Endpoint,
+				"Region":    Config.Retention.S3.Region,
+				"Bucket":    Config.Retention.S3.Bucket,
+				"Prefix":    Config.Retention.S3.Prefix,
+				"AccessKey": "***", // 隐藏密钥
+				"SecretKey": "***",
+				"PathStyle": Config.Retention.S3.PathStyle,
+			},
+		},
+		"Anomaly": map[string]interface{}{
+			"Interval":          Config.Anomaly.Interval,
+			"BatchSize":         Config.Anomaly.BatchSize,
+			"NotifyMinSeverity": Config.Anomaly.NotifyMinSeverity,
+			"WebhookURL":        Config.Anomaly.WebhookURL,
+			"WebhookSecret":     "***", // 隐藏密钥
+			"Rules":             Config.Anomaly.Rules,
+		},
+		"LLM": map[string]interface{}{
+			"Providers": sanitizedLLMProviders(),
+			"Aliases":   Config.LLM.Aliases,
+			"Routes":    Config.LLM.Routes,
+			"Default":   Config.LLM.Default,
+			"Fallback":  Config.LLM.Fallback,
+			"Timeout":   Config.LLM.Timeout,
+			"PoolSize":  Config.LLM.PoolSize,
+			"Prices":    Config.LLM.Prices,
+			"Currency":  Config.LLM.Currency,
+			"Cache":     Config.LLM.Cache,
+		},
 	}
 
 	return sanitized
 }
 
+// sanitizedAuditSinks 返回隐藏签名密钥和请求头的审计转发目标
+func sanitizedAuditSinks() []map[string]interface{} {
+	sinks := make([]map[string]interface{}, 0, len(Config.Audit.Sinks))
+	for _, sink := range Config.Audit.Sinks {
+		sinks = append(sinks, map[string]interface{}{
+			"Name":    sink.Name,
+			"Type":    sink.Type,
+			"Network": sink.Network,
+			"Address": sink.Address,
+			"URL":     sink.URL,
+		})
+	}
+	return sinks
+}
+
+// sanitizedLLMProviders 返回隐藏访问密钥的LLM提供方
+func sanitizedLLMProviders() []map[string]interface{} {
+	providers := make([]map[string]interface{}, 0, len(Config.LLM.Providers))
+	for _, provider := range Config.LLM.Providers {
+		providers = append(providers, map[string]interface{}{
+			"Name":    provider.Name,
+			"Type":    provider.Type,
+			"BaseURL": provider.BaseURL,
+			"Model":   provider.Model,
+			"Timeout": provider.Timeout,
+		})
+	}
+	return providers
+}
+
 // LoadConfigFile 从配置文件加载配置
 func LoadConfigFile() error {
 	// 检查配置文件是否存在
@@ -373,6 +892,34 @@ func LoadConfigFile() error {
 		mapToPrometheusConfig(prometheusMap)
 	}
 
+	if tenantMap, ok := configMap["tenant"].(map[string]interface{}); ok {
+		mapToTenantConfig(tenantMap)
+	}
+
+	if quotaMap, ok := configMap["quota"].(map[string]interface{}); ok {
+		mapToQuotaConfig(quotaMap)
+	}
+
+	if teamMap, ok := configMap["team"].(map[string]interface{}); ok {
+		mapToTeamConfig(teamMap)
+	}
+
+	if auditMap, ok := configMap["audit"].(map[string]interface{}); ok {
+		mapToAuditConfig(auditMap)
+	}
+
+	if retentionMap, ok := configMap["retention"].(map[string]interface{}); ok {
+		mapToRetentionConfig(retentionMap)
+	}
+
+	if anomalyMap, ok := configMap["anomaly"].(map[string]interface{}); ok {
+		mapToAnomalyConfig(anomalyMap)
+	}
+
+	if llmMap, ok := configMap["llm"].(map[string]interface{}); ok {
+		mapToLLMConfig(llmMap)
+	}
+
 	return nil
 }
 
@@ -435,6 +982,18 @@ func mapToJWTConfig(configMap map[string]interface{}) {
 	if refreshTokenExpiry, ok := configMap["refreshTokenExpiry"]; ok {
 		Config.JWT.RefreshTokenExpiry = convertToInt(refreshTokenExpiry)
 	}
+	if algorithm, ok := configMap["algorithm"].(string); ok {
+		Config.JWT.Algorithm = algorithm
+	}
+	if keyDir, ok := configMap["keyDir"].(string); ok {
+		Config.JWT.KeyDir = keyDir
+	}
+	if rotationInterval, ok := configMap["rotationInterval"]; ok {
+		Config.JWT.RotationInterval = convertToInt(rotationInterval)
+	}
+	if keyRetention, ok := configMap["keyRetention"]; ok {
+		Config.JWT.KeyRetention = convertToInt(keyRetention)
+	}
 }
 
 // mapToCSRFConfig 将map映射到CSRF配置
@@ -487,6 +1046,349 @@ func mapToPluginsConfig(configMap map[string]interface{}) {
 	}
 }
 
+// mapToTenantConfig 将map映射到Tenant配置
+func mapToTenantConfig(configMap map[string]interface{}) {
+	if platformAdmins, ok := configMap["platformAdmins"].([]interface{}); ok {
+		Config.Tenant.PlatformAdmins = convertToStringSlice(platformAdmins)
+	}
+	if statusCacheTTL, ok := configMap["statusCacheTTL"]; ok {
+		Config.Tenant.StatusCacheTTL = convertToInt(statusCacheTTL)
+	}
+}
+
+// mapToQuotaConfig 将map映射到Quota配置
+func mapToQuotaConfig(configMap map[string]interface{}) {
+	if enabled, ok := configMap["enabled"]; ok {
+		Config.Quota.Enabled = convertToBool(enabled)
+	}
+	if maxUsers, ok := configMap["maxUsers"]; ok {
+		Config.Quota.MaxUsers = int64(convertToInt(maxUsers))
+	}
+	if maxTeams, ok := configMap["maxTeams"]; ok {
+		Config.Quota.MaxTeams = int64(convertToInt(maxTeams))
+	}
+	if maxTools, ok := configMap["maxTools"]; ok {
+		Config.Quota.MaxTools = int64(convertToInt(maxTools))
+	}
+	if maxNotes, ok := configMap["maxNotes"]; ok {
+		Config.Quota.MaxNotes = int64(convertToInt(maxNotes))
+	}
+	if maxPluginExecutions, ok := configMap["maxPluginExecutionsPerDay"]; ok {
+		Config.Quota.MaxPluginExecutionsPerDay = int64(convertToInt(maxPluginExecutions))
+	}
+	if maxLLMTokens, ok := configMap["maxLLMTokensPerMonth"]; ok {
+		Config.Quota.MaxLLMTokensPerMonth = int64(convertToInt(maxLLMTokens))
+	}
+}
+
+// mapToTeamConfig 将map映射到Team配置
+func mapToTeamConfig(configMap map[string]interface{}) {
+	if invitationTTL, ok := configMap["invitationTTL"]; ok {
+		Config.Team.InvitationTTL = convertToInt(invitationTTL)
+	}
+	if cleanupInterval, ok := configMap["invitationCleanupInterval"]; ok {
+		Config.Team.InvitationCleanupInterval = convertToInt(cleanupInterval)
+	}
+	if maxDepth, ok := configMap["maxDepth"]; ok {
+		Config.Team.MaxDepth = convertToInt(maxDepth)
+	}
+}
+
+// mapToAuditConfig 将map映射到Audit配置
+func mapToAuditConfig(configMap map[string]interface{}) {
+	if secret, ok := configMap["checkpointSecret"].(string); ok {
+		Config.Audit.CheckpointSecret = secret
+	}
+	if interval, ok := configMap["checkpointInterval"]; ok {
+		Config.Audit.CheckpointInterval = convertToInt(interval)
+	}
+	if queueSize, ok := configMap["queueSize"]; ok {
+		Config.Audit.QueueSize = convertToInt(queueSize)
+	}
+	if batchSize, ok := configMap["batchSize"]; ok {
+		Config.Audit.BatchSize = convertToInt(batchSize)
+	}
+	if flushInterval, ok := configMap["flushInterval"]; ok {
+		Config.Audit.FlushInterval = convertToInt(flushInterval)
+	}
+	if spoolDir, ok := configMap["spoolDir"].(string); ok {
+		Config.Audit.SpoolDir = spoolDir
+	}
+	if sinks, ok := configMap["sinks"].([]interface{}); ok {
+		Config.Audit.Sinks = convertToAuditSinks(sinks)
+	}
+	if batchSize, ok := configMap["sinkBatchSize"]; ok {
+		Config.Audit.SinkBatchSize = convertToInt(batchSize)
+	}
+	if pollInterval, ok := configMap["sinkPollInterval"]; ok {
+		Config.Audit.SinkPollInterval = convertToInt(pollInterval)
+	}
+	if gapWait, ok := configMap["sinkGapWait"]; ok {
+		Config.Audit.SinkGapWait = convertToInt(gapWait)
+	}
+}
+
+// mapToRetentionConfig 将map映射到Retention配置
+func mapToRetentionConfig(configMap map[string]interface{}) {
+	if interval, ok := configMap["interval"]; ok {
+		Config.Retention.Interval = convertToInt(interval)
+	}
+	if days, ok := configMap["auditLogDays"]; ok {
+		Config.Retention.AuditLogDays = convertToInt(days)
+	}
+	if days, ok := configMap["loginHistoryDays"]; ok {
+		Config.Retention.LoginHistoryDays = convertToInt(days)
+	}
+	if days, ok := configMap["toolHistoryDays"]; ok {
+		Config.Retention.ToolHistoryDays = convertToInt(days)
+	}
+	if batchSize, ok := configMap["batchSize"]; ok {
+		Config.Retention.BatchSize = convertToInt(batchSize)
+	}
+	if restoreTTL, ok := configMap["restoreTTL"]; ok {
+		Config.Retention.RestoreTTL = convertToInt(restoreTTL)
+	}
+	if storage, ok := configMap["storage"].(string); ok {
+		Config.Retention.Storage = storage
+	}
+	if archiveDir, ok := configMap["archiveDir"].(string); ok {
+		Config.Retention.ArchiveDir = archiveDir
+	}
+	if s3Map := convertToStringMap(configMap["s3"]); s3Map != nil {
+		if endpoint, ok := s3Map["endpoint"].(string); ok {
+			Config.Retention.S3.Endpoint = endpoint
+		}
+		if region, ok := s3Map["region"].(string); ok {
+			Config.Retention.S3.Region = region
+		}
+		if bucket, ok := s3Map["bucket"].(string); ok {
+			Config.Retention.S3.Bucket = bucket
+		}
+		if prefix, ok := s3Map["prefix"].(string); ok {
+			Config.Retention.S3.Prefix = prefix
+		}
+		if accessKey, ok := s3Map["accessKey"].(string); ok {
+			Config.Retention.S3.AccessKey = accessKey
+		}
+		if secretKey, ok := s3Map["secretKey"].(string); ok {
+			Config.Retention.S3.SecretKey = secretKey
+		}
+		if pathStyle, ok := s3Map["pathStyle"]; ok {
+			Config.Retention.S3.PathStyle = convertToBool(pathStyle)
+		}
+	}
+}
+
+// mapToAnomalyConfig 将map映射到Anomaly配置
+func mapToAnomalyConfig(configMap map[string]interface{}) {
+	if interval, ok := configMap["interval"]; ok {
+		Config.Anomaly.Interval = convertToInt(interval)
+	}
+	if batchSize, ok := configMap["batchSize"]; ok {
+		Config.Anomaly.BatchSize = convertToInt(batchSize)
+	}
+	if severity, ok := configMap["notifyMinSeverity"].(string); ok {
+		Config.Anomaly.NotifyMinSeverity = severity
+	}
+	if webhookURL, ok := configMap["webhookUrl"].(string); ok {
+		Config.Anomaly.WebhookURL = webhookURL
+	}
+	if webhookSecret, ok := configMap["webhookSecret"].(string); ok {
+		Config.Anomaly.WebhookSecret = webhookSecret
+	}
+	if rulesMap := convertToStringMap(configMap["rules"]); rulesMap != nil {
+		for key, rule := range map[string]*AnomalyRuleConfig{
+			"newIp":               &Config.Anomaly.Rules.NewIP,
+			"newUserAgent":        &Config.Anomaly.Rules.NewUserAgent,
+			"loginBurst":          &Config.Anomaly.Rules.LoginBurst,
+			"massDeletion":        &Config.Anomaly.Rules.MassDeletion,
+			"privilegeEscalation": &Config.Anomaly.Rules.PrivilegeEscalation,
+		} {
+			ruleMap := convertToStringMap(rulesMap[key])
+			if ruleMap == nil {
+				continue
+			}
+			if enabled, ok := ruleMap["enabled"]; ok {
+				rule.Enabled = convertToBool(enabled)
+			}
+			if severity, ok := ruleMap["severity"].(string); ok {
+				rule.Severity = severity
+			}
+			if window, ok := ruleMap["window"]; ok {
+				rule.Window = convertToInt(window)
+			}
+			if threshold, ok := ruleMap["threshold"]; ok {
+				rule.Threshold = convertToInt(threshold)
+			}
+		}
+	}
+}
+
+// mapToLLMConfig 将map映射到LLM配置
+func mapToLLMConfig(configMap map[string]interface{}) {
+	if providers, ok := configMap["providers"].([]interface{}); ok {
+		Config.LLM.Providers = convertToLLMProviders(providers)
+	}
+	if aliases := convertToStringMap(configMap["aliases"]); aliases != nil {
+		Config.LLM.Aliases = convertToStringValues(aliases)
+	}
+	if routes := convertToStringMap(configMap["routes"]); routes != nil {
+		Config.LLM.Routes = convertToStringValues(routes)
+	}
+	if defaultModel, ok := configMap["default"].(string); ok {
+		Config.LLM.Default = defaultModel
+	}
+	if fallback, ok := configMap["fallback"].(string); ok {
+		Config.LLM.Fallback = fallback
+	}
+	if timeout, ok := configMap["timeout"]; ok {
+		Config.LLM.Timeout = convertToInt(timeout)
+	}
+	if poolSize, ok := configMap["poolSize"]; ok {
+		Config.LLM.PoolSize = convertToInt(poolSize)
+	}
+	if prices := convertToStringMap(configMap["prices"]); prices != nil {
+		Config.LLM.Prices = convertToLLMPrices(prices)
+	}
+	if currency, ok := configMap["currency"].(string); ok {
+		Config.LLM.Currency = currency
+	}
+	if cacheMap := convertToStringMap(configMap["cache"]); cacheMap != nil {
+		mapToLLMCacheConfig(cacheMap)
+	}
+}
+
+// mapToLLMCacheConfig 将map映射到LLM回答缓存配置
+func mapToLLMCacheConfig(configMap map[string]interface{}) {
+	if enabled, ok := configMap["enabled"]; ok {
+		Config.LLM.Cache.Enabled = convertToBool(enabled)
+	}
+	if store, ok := configMap["store"].(string); ok {
+		Config.LLM.Cache.Store = store
+	}
+	if redisAddr, ok := configMap["redisAddr"].(string); ok {
+		Config.LLM.Cache.RedisAddr = redisAddr
+	}
+	if ttl, ok := configMap["ttl"]; ok {
+		Config.LLM.Cache.TTL = convertToInt(ttl)
+	}
+	if maxEntries, ok := configMap["maxEntries"]; ok {
+		Config.LLM.Cache.MaxEntries = convertToInt(maxEntries)
+	}
+	if threshold, ok := configMap["similarityThreshold"]; ok {
+		Config.LLM.Cache.SimilarityThreshold = convertToFloat(threshold)
+	}
+	if embeddingModel, ok := configMap["embeddingModel"].(string); ok {
+		Config.LLM.Cache.EmbeddingModel = embeddingModel
+	}
+}
+
+// convertToLLMPrices 将配置文件中的单价表转换为LLMPrice
+func convertToLLMPrices(values map[string]interface{}) map[string]LLMPrice {
+	prices := make(map[string]LLMPrice, len(values))
+	for model, value := range values {
+		item := convertToStringMap(value)
+		if item == nil {
+			continue
+		}
+		prices[model] = LLMPrice{Input: convertToFloat(item["input"]), Output: convertToFloat(item["output"])}
+	}
+	return prices
+}
+
+// convertToLLMProviders 将配置文件中的提供方列表转换为LLMProviderConfig
+func convertToLLMProviders(values []interface{}) []LLMProviderConfig {
+	providers := make([]LLMProviderConfig, 0, len(values))
+	for _, value := range values {
+		item := convertToStringMap(value)
+		if item == nil {
+			continue
+		}
+		provider := LLMProviderConfig{Options: convertToStringValues(convertToStringMap(item["options"]))}
+		provider.Name, _ = item["name"].(string)
+		provider.Type, _ = item["type"].(string)
+		provider.BaseURL, _ = item["baseUrl"].(string)
+		provider.APIKey, _ = item["apiKey"].(string)
+		provider.Model, _ = item["model"].(string)
+		provider.Timeout = convertToInt(item["timeout"])
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// convertToStringValues 保留map中的字符串值，数字等标量按文本形式保留
+func convertToStringValues(values map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(values))
+	for k, v := range values {
+		switch v.(type) {
+		case string, int, float64, bool:
+			result[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return result
+}
+
+// isValidSeverity 校验告警级别
+func isValidSeverity(severity string) bool {
+	switch severity {
+	case "low", "medium", "high", "critical":
+		return true
+	}
+	return false
+}
+
+// convertToAuditSinks 将配置文件中的转发目标列表转换为AuditSinkConfig
+// YAML解析出的嵌套map键类型为interface{}，JSON为string，两种都需要支持
+func convertToAuditSinks(values []interface{}) []AuditSinkConfig {
+	sinks := make([]AuditSinkConfig, 0, len(values))
+	for _, value := range values {
+		item := convertToStringMap(value)
+		if item == nil {
+			continue
+		}
+		sink := AuditSinkConfig{Headers: make(map[string]string)}
+		sink.Name, _ = item["name"].(string)
+		sink.Type, _ = item["type"].(string)
+		sink.Network, _ = item["network"].(string)
+		sink.Address, _ = item["address"].(string)
+		sink.URL, _ = item["url"].(string)
+		sink.Secret, _ = item["secret"].(string)
+		for k, v := range convertToStringMap(item["headers"]) {
+			if s, ok := v.(string); ok {
+				sink.Headers[k] = s
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+// convertToStringMap 将map[string]interface{}或map[interface{}]interface{}统一为map[string]interface{}
+func convertToStringMap(value interface{}) map[string]interface{} {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[fmt.Sprintf("%v", k)] = v
+		}
+		return result
+	}
+	return nil
+}
+
+// convertToStringSlice 将[]interface{}转换为[]string，忽略空值
+func convertToStringSlice(values []interface{}) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok && strings.TrimSpace(s) != "" {
+			result = append(result, strings.TrimSpace(s))
+		}
+	}
+	return result
+}
+
 // convertToInt 将interface{}转换为int
 func convertToInt(value interface{}) int {
 	switch v := value.(type) {
@@ -502,6 +1404,21 @@ func convertToInt(value interface{}) int {
 	return 0
 }
 
+// convertToFloat 将interface{}转换为float64
+func convertToFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
 // convertToBool 将interface{}转换为bool
 func convertToBool(value interface{}) bool {
 	switch v := value.(type) {
@@ -645,6 +1562,26 @@ func LoadConfig() error {
 		}
 	}
 
+	if algorithm := os.Getenv("JWT_ALGORITHM"); algorithm != "" {
+		Config.JWT.Algorithm = algorithm
+	}
+
+	if keyDir := os.Getenv("JWT_KEY_DIR"); keyDir != "" {
+		Config.JWT.KeyDir = keyDir
+	}
+
+	if rotationInterval := os.Getenv("JWT_ROTATION_INTERVAL"); rotationInterval != "" {
+		if interval, err := strconv.Atoi(rotationInterval); err == nil {
+			Config.JWT.RotationInterval = interval
+		}
+	}
+
+	if keyRetention := os.Getenv("JWT_KEY_RETENTION"); keyRetention != "" {
+		if retention, err := strconv.Atoi(keyRetention); err == nil {
+			Config.JWT.KeyRetention = retention
+		}
+	}
+
 	if devMode := os.Getenv("DEV_MODE"); devMode != "" {
 		if dev, err := strconv.ParseBool(devMode); err == nil {
 			Config.Logger.Development = dev
@@ -747,6 +1684,244 @@ func LoadConfig() error {
 		}
 	}
 
+	// 多租户配置
+	if platformAdmins := os.Getenv("TENANT_PLATFORM_ADMINS"); platformAdmins != "" {
+		admins := make([]interface{}, 0)
+		for _, admin := range strings.Split(platformAdmins, ",") {
+			admins = append(admins, admin)
+		}
+		Config.Tenant.PlatformAdmins = convertToStringSlice(admins)
+	}
+
+	if statusCacheTTL := os.Getenv("TENANT_STATUS_CACHE_TTL"); statusCacheTTL != "" {
+		if ttl, err := strconv.Atoi(statusCacheTTL); err == nil {
+			Config.Tenant.StatusCacheTTL = ttl
+		}
+	}
+
+	// 租户配额配置
+	if quotaEnabled := os.Getenv("QUOTA_ENABLED"); quotaEnabled != "" {
+		if enabled, err := strconv.ParseBool(quotaEnabled); err == nil {
+			Config.Quota.Enabled = enabled
+		}
+	}
+
+	quotaEnvs := map[string]*int64{
+		"QUOTA_MAX_USERS":                     &Config.Quota.MaxUsers,
+		"QUOTA_MAX_TEAMS":                     &Config.Quota.MaxTeams,
+		"QUOTA_MAX_TOOLS":                     &Config.Quota.MaxTools,
+		"QUOTA_MAX_NOTES":                     &Config.Quota.MaxNotes,
+		"QUOTA_MAX_PLUGIN_EXECUTIONS_PER_DAY": &Config.Quota.MaxPluginExecutionsPerDay,
+		"QUOTA_MAX_LLM_TOKENS_PER_MONTH":      &Config.Quota.MaxLLMTokensPerMonth,
+	}
+	for envName, target := range quotaEnvs {
+		if value := os.Getenv(envName); value != "" {
+			if limit, err := strconv.ParseInt(value, 10, 64); err == nil {
+				*target = limit
+			}
+		}
+	}
+
+	// 团队配置
+	if invitationTTL := os.Getenv("TEAM_INVITATION_TTL"); invitationTTL != "" {
+		if ttl, err := strconv.Atoi(invitationTTL); err == nil {
+			Config.Team.InvitationTTL = ttl
+		}
+	}
+
+	if cleanupInterval := os.Getenv("TEAM_INVITATION_CLEANUP_INTERVAL"); cleanupInterval != "" {
+		if interval, err := strconv.Atoi(cleanupInterval); err == nil {
+			Config.Team.InvitationCleanupInterval = interval
+		}
+	}
+
+	if maxDepth := os.Getenv("TEAM_MAX_DEPTH"); maxDepth != "" {
+		if depth, err := strconv.Atoi(maxDepth); err == nil {
+			Config.Team.MaxDepth = depth
+		}
+	}
+
+	// 审计日志配置
+	if secret := os.Getenv("AUDIT_CHECKPOINT_SECRET"); secret != "" {
+		Config.Audit.CheckpointSecret = secret
+	}
+
+	if checkpointInterval := os.Getenv("AUDIT_CHECKPOINT_INTERVAL"); checkpointInterval != "" {
+		if interval, err := strconv.Atoi(checkpointInterval); err == nil {
+			Config.Audit.CheckpointInterval = interval
+		}
+	}
+
+	if queueSize := os.Getenv("AUDIT_QUEUE_SIZE"); queueSize != "" {
+		if size, err := strconv.Atoi(queueSize); err == nil {
+			Config.Audit.QueueSize = size
+		}
+	}
+
+	if batchSize := os.Getenv("AUDIT_BATCH_SIZE"); batchSize != "" {
+		if size, err := strconv.Atoi(batchSize); err == nil {
+			Config.Audit.BatchSize = size
+		}
+	}
+
+	if flushInterval := os.Getenv("AUDIT_FLUSH_INTERVAL"); flushInterval != "" {
+		if interval, err := strconv.Atoi(flushInterval); err == nil {
+			Config.Audit.FlushInterval = interval
+		}
+	}
+
+	if spoolDir := os.Getenv("AUDIT_SPOOL_DIR"); spoolDir != "" {
+		Config.Audit.SpoolDir = spoolDir
+	}
+
+	// 转发目标为JSON数组，如[{"name":"siem","type":"cef","address":"siem:514"}]
+	if sinks := os.Getenv("AUDIT_SINKS"); sinks != "" {
+		var parsed []AuditSinkConfig
+		if err := json.Unmarshal([]byte(sinks), &parsed); err != nil {
+			return fmt.Errorf("无效的AUDIT_SINKS: %v", err)
+		}
+		Config.Audit.Sinks = parsed
+	}
+
+	if sinkBatchSize := os.Getenv("AUDIT_SINK_BATCH_SIZE"); sinkBatchSize != "" {
+		if size, err := strconv.Atoi(sinkBatchSize); err == nil {
+			Config.Audit.SinkBatchSize = size
+		}
+	}
+
+	if sinkPollInterval := os.Getenv("AUDIT_SINK_POLL_INTERVAL"); sinkPollInterval != "" {
+		if interval, err := strconv.Atoi(sinkPollInterval); err == nil {
+			Config.Audit.SinkPollInterval = interval
+		}
+	}
+
+	if sinkGapWait := os.Getenv("AUDIT_SINK_GAP_WAIT"); sinkGapWait != "" {
+		if wait, err := strconv.Atoi(sinkGapWait); err == nil {
+			Config.Audit.SinkGapWait = wait
+		}
+	}
+
+	// 数据保留配置
+	for env, target := range map[string]*int{
+		"RETENTION_INTERVAL":           &Config.Retention.Interval,
+		"RETENTION_AUDIT_LOG_DAYS":     &Config.Retention.AuditLogDays,
+		"RETENTION_LOGIN_HISTORY_DAYS": &Config.Retention.LoginHistoryDays,
+		"RETENTION_TOOL_HISTORY_DAYS":  &Config.Retention.ToolHistoryDays,
+		"RETENTION_BATCH_SIZE":         &Config.Retention.BatchSize,
+		"RETENTION_RESTORE_TTL":        &Config.Retention.RestoreTTL,
+	} {
+		if value := os.Getenv(env); value != "" {
+			if v, err := strconv.Atoi(value); err == nil {
+				*target = v
+			}
+		}
+	}
+
+	for env, target := range map[string]*string{
+		"RETENTION_STORAGE":       &Config.Retention.Storage,
+		"RETENTION_ARCHIVE_DIR":   &Config.Retention.ArchiveDir,
+		"RETENTION_S3_ENDPOINT":   &Config.Retention.S3.Endpoint,
+		"RETENTION_S3_REGION":     &Config.Retention.S3.Region,
+		"RETENTION_S3_BUCKET":     &Config.Retention.S3.Bucket,
+		"RETENTION_S3_PREFIX":     &Config.Retention.S3.Prefix,
+		"RETENTION_S3_ACCESS_KEY": &Config.Retention.S3.AccessKey,
+		"RETENTION_S3_SECRET_KEY": &Config.Retention.S3.SecretKey,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*target = value
+		}
+	}
+
+	if pathStyle := os.Getenv("RETENTION_S3_PATH_STYLE"); pathStyle != "" {
+		Config.Retention.S3.PathStyle = pathStyle == "true"
+	}
+
+	// 安全异常检测配置
+	if interval := os.Getenv("ANOMALY_INTERVAL"); interval != "" {
+		if v, err := strconv.Atoi(interval); err == nil {
+			Config.Anomaly.Interval = v
+		}
+	}
+	if batchSize := os.Getenv("ANOMALY_BATCH_SIZE"); batchSize != "" {
+		if v, err := strconv.Atoi(batchSize); err == nil {
+			Config.Anomaly.BatchSize = v
+		}
+	}
+	if severity := os.Getenv("ANOMALY_NOTIFY_MIN_SEVERITY"); severity != "" {
+		Config.Anomaly.NotifyMinSeverity = severity
+	}
+	if webhookURL := os.Getenv("ANOMALY_WEBHOOK_URL"); webhookURL != "" {
+		Config.Anomaly.WebhookURL = webhookURL
+	}
+	if webhookSecret := os.Getenv("ANOMALY_WEBHOOK_SECRET"); webhookSecret != "" {
+		Config.Anomaly.WebhookSecret = webhookSecret
+	}
+
+	// LLM配置，提供方为JSON数组，如[{"name":"ark","type":"ark","apiKey":"...","model":"doubao-pro"}]
+	if providers := os.Getenv("LLM_PROVIDERS"); providers != "" {
+		var parsed []LLMProviderConfig
+		if err := json.Unmarshal([]byte(providers), &parsed); err != nil {
+			return fmt.Errorf("无效的LLM_PROVIDERS: %v", err)
+		}
+		Config.LLM.Providers = parsed
+	}
+	if defaultModel := os.Getenv("LLM_DEFAULT"); defaultModel != "" {
+		Config.LLM.Default = defaultModel
+	}
+	if fallback := os.Getenv("LLM_FALLBACK"); fallback != "" {
+		Config.LLM.Fallback = fallback
+	}
+	if timeout := os.Getenv("LLM_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil {
+			Config.LLM.Timeout = v
+		}
+	}
+	if poolSize := os.Getenv("LLM_POOL_SIZE"); poolSize != "" {
+		if v, err := strconv.Atoi(poolSize); err == nil {
+			Config.LLM.PoolSize = v
+		}
+	}
+	// 令牌单价为JSON对象，如{"openai/gpt-4o-mini":{"input":0.15,"output":0.6}}
+	if prices := os.Getenv("LLM_PRICES"); prices != "" {
+		var parsed map[string]LLMPrice
+		if err := json.Unmarshal([]byte(prices), &parsed); err != nil {
+			return fmt.Errorf("无效的LLM_PRICES: %v", err)
+		}
+		Config.LLM.Prices = parsed
+	}
+	if currency := os.Getenv("LLM_CURRENCY"); currency != "" {
+		Config.LLM.Currency = currency
+	}
+	if enabled := os.Getenv("LLM_CACHE_ENABLED"); enabled != "" {
+		if v, err := strconv.ParseBool(enabled); err == nil {
+			Config.LLM.Cache.Enabled = v
+		}
+	}
+	if store := os.Getenv("LLM_CACHE_STORE"); store != "" {
+		Config.LLM.Cache.Store = store
+	}
+	if redisAddr := os.Getenv("LLM_CACHE_REDIS_ADDR"); redisAddr != "" {
+		Config.LLM.Cache.RedisAddr = redisAddr
+	}
+	if ttl := os.Getenv("LLM_CACHE_TTL"); ttl != "" {
+		if v, err := strconv.Atoi(ttl); err == nil {
+			Config.LLM.Cache.TTL = v
+		}
+	}
+	if maxEntries := os.Getenv("LLM_CACHE_MAX_ENTRIES"); maxEntries != "" {
+		if v, err := strconv.Atoi(maxEntries); err == nil {
+			Config.LLM.Cache.MaxEntries = v
+		}
+	}
+	if threshold := os.Getenv("LLM_CACHE_SIMILARITY_THRESHOLD"); threshold != "" {
+		if v, err := strconv.ParseFloat(threshold, 64); err == nil {
+			Config.LLM.Cache.SimilarityThreshold = v
+		}
+	}
+	if embeddingModel := os.Getenv("LLM_CACHE_EMBEDDING_MODEL"); embeddingModel != "" {
+		Config.LLM.Cache.EmbeddingModel = embeddingModel
+	}
+
 	// 验证配置有效性
 	return ValidateConfig()
 }
@@ -1,13 +1,20 @@
 package controllers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 	"weave/models"
 	"weave/pkg"
+	"weave/pkg/auditsink"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // AuditController 审计日志控制器
@@ -18,11 +25,6 @@ func (ac *AuditController) GetAuditLogs(c *gin.Context) {
 	// 获取查询参数
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	action := c.Query("action")
-	resourceType := c.Query("resource_type")
-	username := c.Query("username")
-	startTimeStr := c.Query("start_time")
-	endTimeStr := c.Query("end_time")
 
 	// 参数验证
 	if page < 1 {
@@ -36,38 +38,13 @@ func (ac *AuditController) GetAuditLogs(c *gin.Context) {
 	offset := (page - 1) * pageSize
 
 	// 构建查询
-	query := pkg.DB.Model(&models.AuditLog{})
-
-	// 添加租户过滤（多租户隔离）
-	tenantID := c.GetUint("tenant_id")
-	query = query.Where("tenant_id = ?", tenantID)
-
-	// 添加过滤条件
-	if action != "" {
-		query = query.Where("action = ?", action)
-	}
-	if resourceType != "" {
-		query = query.Where("resource_type = ?", resourceType)
-	}
-	if username != "" {
-		query = query.Where("username = ?", username)
-	}
-	if startTimeStr != "" {
-		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
-			query = query.Where("created_at >= ?", startTime)
-		}
-	}
-	if endTimeStr != "" {
-		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
-			query = query.Where("created_at <= ?", endTime)
-		}
-	}
+	query := auditLogQuery(c)
 
 	// 获取总数
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to count audit logs", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -75,7 +52,7 @@ func (ac *AuditController) GetAuditLogs(c *gin.Context) {
 	var auditLogs []models.AuditLog
 	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Preload("User").Find(&auditLogs).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to fetch audit logs", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -95,6 +72,121 @@ func (ac *AuditController) GetAuditLogs(c *gin.Context) {
 	})
 }
 
+// auditLogQuery 按列表接口的过滤参数构建当前租户的审计日志查询
+// 支持action、resource_type、username、start_time、end_time（RFC3339），无法解析的时间参数会被忽略
+func auditLogQuery(c *gin.Context) *gorm.DB {
+	query := pkg.TenantDB(c).Model(&models.AuditLog{})
+
+	// 添加租户过滤（多租户隔离）
+	tenantID := c.GetUint("tenant_id")
+	query = query.Where("tenant_id = ?", tenantID)
+
+	// 添加过滤条件
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if resourceType := c.Query("resource_type"); resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if username := c.Query("username"); username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if startTimeStr := c.Query("start_time"); startTimeStr != "" {
+		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
+			query = query.Where("created_at >= ?", startTime)
+		}
+	}
+	if endTimeStr := c.Query("end_time"); endTimeStr != "" {
+		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
+			query = query.Where("created_at <= ?", endTime)
+		}
+	}
+	return query
+}
+
+// auditExportBatchSize 导出时每次从数据库读取的记录数
+const auditExportBatchSize = 500
+
+// auditExportWriteTimeout 导出时每批数据的写入超时，替代服务器全局的WriteTimeout
+const auditExportWriteTimeout = time.Minute
+
+// ExportAuditLogs 按列表接口的过滤条件流式导出审计日志，format为csv（默认）或ndjson
+// 按ID升序分批读取并边读边写，不会把全部记录加载到内存；开始输出后出错只能中断响应
+func (ac *AuditController) ExportAuditLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		err := pkg.NewValidationError("Invalid export format, must be csv or ndjson", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("audit-logs-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Status(http.StatusOK)
+
+	var csvWriter *csv.Writer
+	var encoder *json.Encoder
+	if format == "csv" {
+		csvWriter = csv.NewWriter(c.Writer)
+		csvWriter.Write(auditsink.CSVHeader)
+	} else {
+		encoder = json.NewEncoder(c.Writer)
+	}
+
+	// 导出耗时可能超过服务器的WriteTimeout，改为按批次延长写入期限
+	rc := http.NewResponseController(c.Writer)
+
+	var lastID uint
+	exported := 0
+	for {
+		_ = rc.SetWriteDeadline(time.Now().Add(auditExportWriteTimeout))
+		var batch []models.AuditLog
+		if err := auditLogQuery(c).Where("id > ?", lastID).Order("id").Limit(auditExportBatchSize).Find(&batch).Error; err != nil {
+			pkg.Error("Failed to export audit logs", zap.Error(err), zap.Int("exported", exported))
+			c.Abort()
+			return
+		}
+		for i := range batch {
+			if csvWriter != nil {
+				csvWriter.Write(auditsink.CSVRow(&batch[i]))
+			} else if err := encoder.Encode(auditsink.NewRecord(&batch[i])); err != nil {
+				c.Abort()
+				return
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				c.Abort()
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		exported += len(batch)
+		if len(batch) < auditExportBatchSize {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "export",
+		ResourceType: "audit_log",
+		NewValue: map[string]interface{}{
+			"format":  format,
+			"count":   exported,
+			"filters": c.Request.URL.Query(),
+		},
+	})
+}
+
 // GetAuditLog 获取单个审计日志详情
 func (ac *AuditController) GetAuditLog(c *gin.Context) {
 	id := c.Param("id")
@@ -102,16 +194,95 @@ func (ac *AuditController) GetAuditLog(c *gin.Context) {
 
 	var auditLog models.AuditLog
 	// 预加载用户信息以避免N+1查询问题
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).Preload("User").First(&auditLog)
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).Preload("User").First(&auditLog)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("Audit log not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, auditLog)
 }
 
+// GetAuditLogDiff 获取审计日志操作前后的值和字段级变更
+// lines为渲染后的文本，“+”表示新增字段，“-”表示删除字段，“~”表示修改字段
+func (ac *AuditController) GetAuditLogDiff(c *gin.Context) {
+	id := c.Param("id")
+	tenantID := c.GetUint("tenant_id")
+
+	var auditLog models.AuditLog
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).First(&auditLog)
+	if result.Error != nil {
+		err := pkg.NewNotFoundError("Audit log not found", result.Error)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	changes, err := pkg.AuditLogChanges(&auditLog)
+	if err != nil {
+		err := pkg.NewInternalError("Failed to compute audit diff", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":            auditLog.ID,
+		"action":        auditLog.Action,
+		"resource_type": auditLog.ResourceType,
+		"resource_id":   auditLog.ResourceID,
+		"username":      auditLog.Username,
+		"created_at":    auditLog.CreatedAt,
+		"old_value":     auditJSONValue(auditLog.OldValue),
+		"new_value":     auditJSONValue(auditLog.NewValue),
+		"changes":       changes,
+		"lines":         pkg.RenderAuditDiff(changes),
+	})
+}
+
+// auditJSONValue 将保存的JSON字符串解析为对象返回，无法解析时原样返回
+// 历史记录可能未经统一脱敏，返回前再脱敏一次
+func auditJSONValue(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	redacted, err := pkg.RedactAuditValue(value)
+	if err != nil {
+		return value
+	}
+	return json.RawMessage(redacted)
+}
+
+// VerifyAuditChain 校验租户审计日志哈希链的完整性
+// 默认校验当前租户，平台管理员可以通过tenant_id参数校验其他租户
+func (ac *AuditController) VerifyAuditChain(c *gin.Context) {
+	tenantID := c.GetUint("tenant_id")
+	db := pkg.TenantDB(c)
+	if tenantParam := c.Query("tenant_id"); tenantParam != "" {
+		id, err := strconv.ParseUint(tenantParam, 10, 32)
+		if err != nil {
+			err := pkg.NewValidationError("Invalid tenant ID", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		if uint(id) != tenantID {
+			if !requirePlatformAdmin(c) {
+				return
+			}
+			tenantID = uint(id)
+			db = platformDB(c)
+		}
+	}
+
+	result, err := pkg.VerifyAuditChain(db, tenantID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to verify audit chain", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // GetAuditStats 获取审计日志统计信息
 func (ac *AuditController) GetAuditStats(c *gin.Context) {
 	tenantID := c.GetUint("tenant_id")
@@ -123,13 +294,13 @@ func (ac *AuditController) GetAuditStats(c *gin.Context) {
 	}
 
 	var actionStats []ActionStat
-	if err := pkg.DB.Model(&models.AuditLog{}).
+	if err := pkg.TenantDB(c).Model(&models.AuditLog{}).
 		Select("action, COUNT(*) as count").
 		Where("tenant_id = ?", tenantID).
 		Group("action").
 		Find(&actionStats).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to get action stats", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -140,13 +311,13 @@ func (ac *AuditController) GetAuditStats(c *gin.Context) {
 	}
 
 	var resourceStats []ResourceStat
-	if err := pkg.DB.Model(&models.AuditLog{}).
+	if err := pkg.TenantDB(c).Model(&models.AuditLog{}).
 		Select("resource_type, COUNT(*) as count").
 		Where("tenant_id = ?", tenantID).
 		Group("resource_type").
 		Find(&resourceStats).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to get resource stats", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -175,13 +346,13 @@ func (ac *AuditController) GetAuditStats(c *gin.Context) {
 		Count int64  `json:"count"`
 	}
 
-	if err := pkg.DB.Model(&models.AuditLog{}).
+	if err := pkg.TenantDB(c).Model(&models.AuditLog{}).
 		Select("DATE(created_at) as date, COUNT(*) as count").
 		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, sevenDaysAgo, today.Add(24*time.Hour)).
 		Group("DATE(created_at)").
 		Find(&results).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to get daily stats", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -205,3 +376,63 @@ func (ac *AuditController) GetAuditStats(c *gin.Context) {
 		"daily_stats":    dailyStats,
 	})
 }
+
+// auditStatsDefaultRange 统计查询未指定开始时间时的默认范围
+const auditStatsDefaultRange = 7 * 24 * time.Hour
+
+// QueryAuditStats 按任意维度统计审计日志
+// group_by为逗号分隔的user、action、resource_type、ip以及hour、day、week之一；
+// start_time、end_time为RFC3339时间，默认最近7天；limit为前N组，compare=true时与上一个等长周期对比
+func (ac *AuditController) QueryAuditStats(c *gin.Context) {
+	query := pkg.AuditStatsQuery{
+		TenantID:     c.GetUint("tenant_id"),
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		Username:     c.Query("username"),
+		End:          time.Now(),
+	}
+	for _, dimension := range strings.Split(c.Query("group_by"), ",") {
+		if dimension = strings.TrimSpace(dimension); dimension != "" {
+			query.GroupBy = append(query.GroupBy, dimension)
+		}
+	}
+
+	var err error
+	if endTime := c.Query("end_time"); endTime != "" {
+		if query.End, err = time.Parse(time.RFC3339, endTime); err != nil {
+			err := pkg.NewValidationError("Invalid end_time, expected RFC3339", err)
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+	query.Start = query.End.Add(-auditStatsDefaultRange)
+	if startTime := c.Query("start_time"); startTime != "" {
+		if query.Start, err = time.Parse(time.RFC3339, startTime); err != nil {
+			err := pkg.NewValidationError("Invalid start_time, expected RFC3339", err)
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			err := pkg.NewValidationError("Invalid limit", err)
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+	query.Compare, _ = strconv.ParseBool(c.Query("compare"))
+
+	if err := query.Validate(); err != nil {
+		err := pkg.NewValidationError(err.Error(), err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	result, err := pkg.AuditStats(pkg.TenantDB(c), query)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to query audit stats", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
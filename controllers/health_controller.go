@@ -137,10 +137,7 @@ func (hc *HealthController) PluginHealthCheck(c *gin.Context) {
 
 	if targetPluginInfo == nil {
 		metrics.RecordPluginError(pluginName, "health_check_not_found")
-		c.JSON(404, gin.H{
-			"status":  "error",
-			"message": "插件不存在",
-		})
+		pkg.RespondError(c, pkg.NewPluginNotFoundError("插件不存在", nil).WithDetails(gin.H{"plugin": pluginName}))
 		return
 	}
 
@@ -153,6 +150,14 @@ func (hc *HealthController) PluginHealthCheck(c *gin.Context) {
 	}
 
 	healthy := targetPluginInfo.IsEnabled && status == "enabled"
+
+	// 插件报告外部依赖时，依赖不健康的插件也视为不健康
+	var dependencies interface{}
+	if reporter, ok := targetPluginInfo.Plugin.(core.HealthReporter); ok {
+		var dependenciesHealthy bool
+		dependenciesHealthy, dependencies = reporter.HealthCheck(c.Request.Context())
+		healthy = healthy && dependenciesHealthy
+	}
 	if !healthy && targetPluginInfo.IsEnabled {
 		success = false
 		metrics.RecordPluginError(pluginName, "health_check_failed")
@@ -163,13 +168,17 @@ func (hc *HealthController) PluginHealthCheck(c *gin.Context) {
 	metrics.RecordPluginMethodCall(pluginName, "HealthCheck", success)
 	metrics.RecordPluginExecution(pluginName, success, duration)
 
-	c.JSON(200, gin.H{
+	response := gin.H{
 		"name":    pluginName,
 		"version": targetPluginInfo.Plugin.Version(),
 		"enabled": targetPluginInfo.IsEnabled,
 		"status":  status,
 		"healthy": healthy,
-	})
+	}
+	if dependencies != nil {
+		response["dependencies"] = dependencies
+	}
+	c.JSON(200, response)
 }
 
 // checkPluginHealth 检查插件系统健康状态
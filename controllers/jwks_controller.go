@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"weave/pkg"
+	"weave/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSController JWT公钥发布控制器
+type JWKSController struct{}
+
+// GetJWKS 发布用于验证访问令牌的公钥集合（RFC 7517）
+// 其他服务可通过该端点按kid获取公钥独立验证令牌
+func (jc *JWKSController) GetJWKS(c *gin.Context) {
+	jwks := utils.JWKS{Keys: []utils.JWK{}}
+
+	// 使用HS256共享密钥时没有可公开的公钥，返回空集合
+	if utils.IsAsymmetricSigning() {
+		kr, err := utils.GetKeyRing()
+		if err != nil {
+			err := pkg.NewInternalError("加载签名密钥失败", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		jwks = kr.JWKS()
+	}
+
+	// 允许验证方短暂缓存，轮换后的新密钥在缓存过期后即可获取
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, jwks)
+}
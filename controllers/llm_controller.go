@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"weave/pkg"
+	"weave/plugins"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LLMPluginName 提供LLM对话能力的插件
+const LLMPluginName = "LLMChat"
+
+// LLMController LLM接口控制器，请求转交给LLMChat插件处理
+type LLMController struct{}
+
+// streamHandler LLMChat插件提供的流式处理函数
+type streamHandler interface {
+	HandleStream(c *gin.Context)
+}
+
+// Stream 以Server-Sent Events流式返回模型回复
+func (lc *LLMController) Stream(c *gin.Context) {
+	status, exists := plugins.PluginManager.GetPluginStatus(LLMPluginName)
+	if !exists {
+		pkg.RespondError(c, pkg.NewPluginNotFoundError("插件不存在", nil).WithDetails(gin.H{"plugin": LLMPluginName}))
+		return
+	}
+	if status != "enabled" {
+		pkg.RespondError(c, pkg.NewPluginDisabledError("Plugin is disabled", nil).WithDetails(gin.H{"plugin": LLMPluginName}))
+		return
+	}
+
+	plugin, _ := plugins.PluginManager.GetPlugin(LLMPluginName)
+	handler, ok := plugin.(streamHandler)
+	if !ok {
+		pkg.RespondError(c, pkg.NewNotImplemented("Streaming is not supported by the LLM plugin", nil))
+		return
+	}
+	handler.HandleStream(c)
+}
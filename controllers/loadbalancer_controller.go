@@ -153,10 +153,7 @@ func (lbc *LoadBalancerController) UpdateInstanceWeight(c *gin.Context) {
 			zap.String("instance_id", instanceID),
 			zap.Error(err))
 
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid weight value. Must be between 1 and 10.",
-		})
+		pkg.RespondError(c, pkg.NewValidationRangeError("Invalid weight value. Must be between 1 and 10.", err))
 		return
 	}
 
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"weave/pkg"
 	"weave/plugins"
 
 	"github.com/gin-gonic/gin"
@@ -49,12 +50,15 @@ func (pc *PluginController) GetAllPlugins(c *gin.Context) {
 // @Router /api/v1/plugins/{name}/enable [post]
 func (pc *PluginController) EnablePlugin(c *gin.Context) {
 	pluginName := c.Param("name")
+	oldStatus, _ := plugins.PluginManager.GetPluginStatus(pluginName)
 
 	if err := plugins.PluginManager.EnablePlugin(pluginName); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		pkg.RespondError(c, pkg.NewBadRequestError(err.Error(), err))
 		return
 	}
 
+	auditPluginStatus(c, "enable", pluginName, oldStatus)
+
 	c.JSON(http.StatusOK, gin.H{"message": "插件启用成功", "plugin": pluginName})
 }
 
@@ -69,12 +73,15 @@ func (pc *PluginController) EnablePlugin(c *gin.Context) {
 // @Router /api/v1/plugins/{name}/disable [post]
 func (pc *PluginController) DisablePlugin(c *gin.Context) {
 	pluginName := c.Param("name")
+	oldStatus, _ := plugins.PluginManager.GetPluginStatus(pluginName)
 
 	if err := plugins.PluginManager.DisablePlugin(pluginName); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		pkg.RespondError(c, pkg.NewBadRequestError(err.Error(), err))
 		return
 	}
 
+	auditPluginStatus(c, "disable", pluginName, oldStatus)
+
 	c.JSON(http.StatusOK, gin.H{"message": "插件禁用成功", "plugin": pluginName})
 }
 
@@ -89,15 +96,30 @@ func (pc *PluginController) DisablePlugin(c *gin.Context) {
 // @Router /api/v1/plugins/{name}/reload [post]
 func (pc *PluginController) ReloadPlugin(c *gin.Context) {
 	pluginName := c.Param("name")
+	oldStatus, _ := plugins.PluginManager.GetPluginStatus(pluginName)
 
 	if err := plugins.PluginManager.ReloadPlugin(pluginName); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		pkg.RespondError(c, pkg.NewBadRequestError(err.Error(), err))
 		return
 	}
 
+	auditPluginStatus(c, "reload", pluginName, oldStatus)
+
 	c.JSON(http.StatusOK, gin.H{"message": "插件重载成功", "plugin": pluginName})
 }
 
+// auditPluginStatus 记录插件状态变更前后的审计日志
+func auditPluginStatus(c *gin.Context, action, pluginName, oldStatus string) {
+	newStatus, _ := plugins.PluginManager.GetPluginStatus(pluginName)
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       action,
+		ResourceType: "plugin",
+		ResourceID:   pluginName,
+		OldValue:     map[string]interface{}{"status": oldStatus},
+		NewValue:     map[string]interface{}{"status": newStatus},
+	})
+}
+
 // GetPluginStatus 获取插件状态
 // @Summary 获取插件状态
 // @Description 获取指定插件的详细状态信息
@@ -112,7 +134,7 @@ func (pc *PluginController) GetPluginStatus(c *gin.Context) {
 
 	status, exists := plugins.PluginManager.GetPluginStatus(pluginName)
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "插件不存在", "plugin": pluginName})
+		pkg.RespondError(c, pkg.NewPluginNotFoundError("插件不存在", nil).WithDetails(gin.H{"plugin": pluginName}))
 		return
 	}
 
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"net/http"
+
+	"weave/models"
+	"weave/pkg"
+	"weave/plugins"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// findPluginScope 查询插件在当前租户内的团队范围，未设置时返回nil
+func findPluginScope(c *gin.Context, pluginName string) (*models.PluginTeamScope, bool) {
+	var scope models.PluginTeamScope
+	err := pkg.TenantDB(c).Where("tenant_id = ? AND plugin_name = ?", c.GetUint("tenant_id"), pluginName).First(&scope).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, true
+	}
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to query plugin scope", err)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	return &scope, true
+}
+
+// GetPluginScope 获取插件在当前租户内的团队范围
+// @Summary 获取插件团队范围
+// @Description 获取插件在当前租户内限定的团队子树，team_id为空表示不限制
+// @Tags 插件管理
+// @Security BearerAuth
+// @Param name path string true "插件名称"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/plugins/{name}/scope [get]
+func (pc *PluginController) GetPluginScope(c *gin.Context) {
+	pluginName := c.Param("name")
+
+	scope, ok := findPluginScope(c, pluginName)
+	if !ok {
+		return
+	}
+	if scope == nil {
+		c.JSON(http.StatusOK, gin.H{"plugin_name": pluginName, "team_id": nil})
+		return
+	}
+	c.JSON(http.StatusOK, scope)
+}
+
+// SetPluginScope 将插件在当前租户内限定到团队子树
+// @Summary 设置插件团队范围
+// @Description 限定后只有该团队及其上下级团队的成员可以使用插件，需要是目标团队（以及原范围团队）的管理员
+// @Tags 插件管理
+// @Security BearerAuth
+// @Param name path string true "插件名称"
+// @Success 200 {object} models.PluginTeamScope
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/plugins/{name}/scope [put]
+func (pc *PluginController) SetPluginScope(c *gin.Context) {
+	pluginName := c.Param("name")
+	if _, exists := plugins.PluginManager.GetPlugin(pluginName); !exists {
+		err := pkg.NewPluginNotFoundError("Plugin not found", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	var req struct {
+		TeamID uint `json:"team_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid plugin scope data", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	h, ok := loadTeamHierarchy(c)
+	if !ok {
+		return
+	}
+	if _, ok := requireTeamRole(c, h, req.TeamID, "admin", "Only team admins can scope plugins to the team"); !ok {
+		return
+	}
+
+	existing, ok := findPluginScope(c, pluginName)
+	if !ok {
+		return
+	}
+	var oldValue interface{}
+	if existing != nil {
+		if _, ok := requireTeamRole(c, h, existing.TeamID, "admin", "Only admins of the current scope team can change the plugin scope"); !ok {
+			return
+		}
+		oldValue = *existing
+	}
+
+	scope := models.PluginTeamScope{
+		TenantID:   c.GetUint("tenant_id"),
+		PluginName: pluginName,
+		TeamID:     req.TeamID,
+		CreatedBy:  c.GetUint("user_id"),
+	}
+	var err error
+	if existing != nil {
+		scope = *existing
+		scope.TeamID = req.TeamID
+		err = pkg.TenantDB(c).Model(&models.PluginTeamScope{}).Where("id = ?", existing.ID).Update("team_id", req.TeamID).Error
+	} else {
+		err = pkg.TenantDB(c).Create(&scope).Error
+	}
+	if pkg.IsDuplicateKeyError(err) {
+		err := pkg.NewConflictError("Plugin scope changed, please retry", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to save plugin scope", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "set_scope",
+		ResourceType: "plugin",
+		ResourceID:   pluginName,
+		OldValue:     oldValue,
+		NewValue:     scope,
+	})
+
+	c.JSON(http.StatusOK, scope)
+}
+
+// RemovePluginScope 取消插件在当前租户内的团队范围限制
+// @Summary 取消插件团队范围
+// @Description 取消后租户内所有用户都可以使用插件，需要是当前范围团队的管理员
+// @Tags 插件管理
+// @Security BearerAuth
+// @Param name path string true "插件名称"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/plugins/{name}/scope [delete]
+func (pc *PluginController) RemovePluginScope(c *gin.Context) {
+	pluginName := c.Param("name")
+
+	existing, ok := findPluginScope(c, pluginName)
+	if !ok {
+		return
+	}
+	if existing == nil {
+		err := pkg.NewNotFoundError("Plugin scope not found", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	if _, ok := requireEffectiveTeamRole(c, existing.TeamID, "admin", "Only admins of the scope team can remove the plugin scope"); !ok {
+		return
+	}
+
+	if err := pkg.TenantDB(c).Delete(&models.PluginTeamScope{}, existing.ID).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to remove plugin scope", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "remove_scope",
+		ResourceType: "plugin",
+		ResourceID:   pluginName,
+		OldValue:     *existing,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Plugin scope removed successfully"})
+}
@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/prompt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// promptNamePattern 模板名称格式：小写字母、数字、点、下划线和连字符
+var promptNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}$`)
+
+// PromptController 提示词模板控制器
+// 所有用户可以查看和预览本租户生效的模板，创建和启用版本仅限平台管理员
+type PromptController struct{}
+
+// promptName 校验路径中的模板名称，格式错误时写入400响应
+func promptName(c *gin.Context) (string, bool) {
+	name := c.Param("name")
+	if !promptNamePattern.MatchString(name) {
+		err := pkg.NewValidationError("Invalid prompt template name", nil).WithDetails(gin.H{"name": name})
+		pkg.RespondError(c, err)
+		return "", false
+	}
+	return name, true
+}
+
+// promptScope 返回写操作的范围：tenant_id为空表示平台级版本
+func promptScope(tenantID *uint) (global bool, id uint) {
+	if tenantID == nil {
+		return true, 0
+	}
+	return false, *tenantID
+}
+
+// respondPromptError 将模板错误映射为对应的错误响应
+func respondPromptError(c *gin.Context, message string, err error) {
+	var invalid *prompt.InvalidTemplateError
+	switch {
+	case errors.As(err, &invalid):
+		pkg.RespondError(c, pkg.NewValidationError("Invalid prompt template", err))
+	case errors.Is(err, prompt.ErrVersionNotFound):
+		pkg.RespondError(c, pkg.NewNotFoundError("Prompt template version not found", err))
+	case errors.Is(err, prompt.ErrTemplateNotFound):
+		pkg.RespondError(c, pkg.NewNotFoundError("Prompt template not found", err))
+	default:
+		pkg.RespondError(c, pkg.NewDatabaseError(message, err))
+	}
+}
+
+// GetPrompts 获取租户可以使用的模板及其生效版本
+func (pc *PromptController) GetPrompts(c *gin.Context) {
+	tenantID, ok := viewTenantID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	names, err := prompt.Names(ctx, tenantID)
+	if err != nil {
+		respondPromptError(c, "Failed to fetch prompt templates", err)
+		return
+	}
+	templates := make([]*prompt.Template, 0, len(names))
+	for _, name := range names {
+		t, err := prompt.Resolve(ctx, tenantID, name)
+		if errors.Is(err, prompt.ErrTemplateNotFound) {
+			// 自定义模板的版本都已停用
+			continue
+		}
+		if err != nil {
+			respondPromptError(c, "Failed to fetch prompt templates", err)
+			return
+		}
+		templates = append(templates, t)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenant_id": tenantID, "templates": templates, "builtins": prompt.Builtins()})
+}
+
+// GetPrompt 获取模板的生效版本、内置默认值以及平台级和租户的全部版本
+func (pc *PromptController) GetPrompt(c *gin.Context) {
+	name, ok := promptName(c)
+	if !ok {
+		return
+	}
+	tenantID, ok := viewTenantID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	versions, err := prompt.Versions(ctx, tenantID, name)
+	if err != nil {
+		respondPromptError(c, "Failed to fetch prompt template versions", err)
+		return
+	}
+	builtin, hasBuiltin := prompt.Builtin(name)
+	if !hasBuiltin && len(versions) == 0 {
+		respondPromptError(c, "", prompt.ErrTemplateNotFound)
+		return
+	}
+
+	resp := gin.H{"name": name, "tenant_id": tenantID, "versions": versions}
+	if hasBuiltin {
+		resp["builtin"] = builtin
+	}
+	if t, err := prompt.Resolve(ctx, tenantID, name); err == nil {
+		resp["effective"] = t
+	} else if !errors.Is(err, prompt.ErrTemplateNotFound) {
+		respondPromptError(c, "Failed to resolve prompt template", err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreatePromptVersion 创建模板的新版本，tenant_id为空时创建平台级版本
+func (pc *PromptController) CreatePromptVersion(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+	name, ok := promptName(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content     string   `json:"content" binding:"required,max=65535"`
+		Description string   `json:"description" binding:"max=255"`
+		Variables   []string `json:"variables"`
+		TenantID    *uint    `json:"tenant_id"`
+		Activate    bool     `json:"activate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid prompt template", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	if req.TenantID != nil {
+		if err := platformDB(c).First(&models.Tenant{}, *req.TenantID).Error; err != nil && *req.TenantID != models.DefaultTenantID {
+			err := pkg.NewNotFoundError("Tenant not found", err)
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+
+	global, tenantID := promptScope(req.TenantID)
+	version := models.PromptTemplate{
+		Name:        name,
+		TenantID:    tenantID,
+		Global:      global,
+		Content:     req.Content,
+		Variables:   req.Variables,
+		Description: req.Description,
+		CreatedBy:   c.GetUint("user_id"),
+	}
+	if err := prompt.CreateVersion(c.Request.Context(), &version, req.Activate); err != nil {
+		respondPromptError(c, "Failed to create prompt template version", err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "create",
+		ResourceType: "prompt_template",
+		ResourceID:   fmt.Sprintf("%d", version.ID),
+		NewValue:     version,
+	})
+
+	c.JSON(http.StatusCreated, version)
+}
+
+// ActivatePromptVersion 启用模板的指定版本，同一范围内的其他版本停用
+func (pc *PromptController) ActivatePromptVersion(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+	name, ok := promptName(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Version  int   `json:"version" binding:"required,min=1"`
+		TenantID *uint `json:"tenant_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid prompt template version", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	global, tenantID := promptScope(req.TenantID)
+	version, err := prompt.Activate(c.Request.Context(), name, global, tenantID, req.Version)
+	if err != nil {
+		respondPromptError(c, "Failed to activate prompt template version", err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "activate",
+		ResourceType: "prompt_template",
+		ResourceID:   fmt.Sprintf("%d", version.ID),
+		NewValue:     version,
+	})
+
+	c.JSON(http.StatusOK, version)
+}
+
+// DeactivatePrompt 停用范围内启用的版本，之后改用平台级版本或内置模板
+// tenant_id查询参数为空时停用平台级版本
+func (pc *PromptController) DeactivatePrompt(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+	name, ok := promptName(c)
+	if !ok {
+		return
+	}
+
+	var scope *uint
+	if raw := c.Query("tenant_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			err := pkg.NewValidationError("Invalid tenant ID", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		tenantID := uint(id)
+		scope = &tenantID
+	}
+
+	global, tenantID := promptScope(scope)
+	if err := prompt.Deactivate(c.Request.Context(), name, global, tenantID); err != nil {
+		respondPromptError(c, "Failed to deactivate prompt template", err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "deactivate",
+		ResourceType: "prompt_template",
+		ResourceID:   name,
+		NewValue:     gin.H{"name": name, "global": global, "tenant_id": tenantID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Prompt template deactivated"})
+}
+
+// RenderPrompt 用给定的变量预览渲染结果
+// 默认渲染租户生效的模板；提供content时预览尚未保存的内容，提供version时预览指定版本
+func (pc *PromptController) RenderPrompt(c *gin.Context) {
+	name, ok := promptName(c)
+	if !ok {
+		return
+	}
+	tenantID, ok := viewTenantID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Variables map[string]interface{} `json:"variables"`
+		Content   string                 `json:"content" binding:"max=65535"`
+		Version   int                    `json:"version" binding:"min=0"`
+		Global    bool                   `json:"global"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid render request", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	var t *prompt.Template
+	var err error
+	switch {
+	case req.Content != "":
+		// 自定义模板预览时按提供的变量声明
+		names := make([]string, 0, len(req.Variables))
+		for variable := range req.Variables {
+			names = append(names, variable)
+		}
+		sort.Strings(names)
+		t, err = prompt.Parse(name, req.Content, prompt.VariablesFor(name, names))
+		if err != nil {
+			err = &prompt.InvalidTemplateError{Err: err}
+		}
+	case req.Version > 0:
+		t, err = findPromptVersion(c, tenantID, name, req.Global, req.Version)
+	default:
+		t, err = prompt.Resolve(ctx, tenantID, name)
+	}
+	if err != nil {
+		respondPromptError(c, "Failed to load prompt template", err)
+		return
+	}
+
+	rendered, err := t.Execute(req.Variables)
+	if err != nil {
+		err := pkg.NewValidationError("Failed to render prompt template", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rendered": rendered, "template": t})
+}
+
+// findPromptVersion 加载平台级或租户的指定版本
+func findPromptVersion(c *gin.Context, tenantID uint, name string, global bool, number int) (*prompt.Template, error) {
+	versions, err := prompt.Versions(c.Request.Context(), tenantID, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].Global == global && versions[i].Version == number {
+			t, err := prompt.FromVersion(&versions[i])
+			if err != nil {
+				return nil, &prompt.InvalidTemplateError{Err: err}
+			}
+			return t, nil
+		}
+	}
+	return nil, prompt.ErrVersionNotFound
+}
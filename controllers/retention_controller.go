@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/retention"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetentionController 数据保留策略和归档控制器（平台管理员）
+type RetentionController struct{}
+
+// retentionTenantID 解析tenant_id参数，未提供时使用当前租户，解析失败时写入400响应
+func retentionTenantID(c *gin.Context, value string) (uint, bool) {
+	if value == "" {
+		return c.GetUint("tenant_id"), true
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid tenant ID", err)
+		pkg.RespondError(c, err)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetPolicies 获取租户各资源生效的保留策略，未单独设置的资源返回配置中的默认值
+func (rc *RetentionController) GetPolicies(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+	tenantID, ok := retentionTenantID(c, c.Query("tenant_id"))
+	if !ok {
+		return
+	}
+
+	policies, err := retention.Policies(platformDB(c), tenantID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to get retention policies", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenant_id": tenantID, "policies": policies})
+}
+
+// UpdatePolicy 设置租户某一资源的保留天数和法律保全
+func (rc *RetentionController) UpdatePolicy(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+	resource := c.Param("resource")
+	if !retention.IsResource(resource) {
+		err := pkg.NewValidationError("Unknown retention resource", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	var req struct {
+		TenantID        *uint   `json:"tenant_id"`
+		RetentionDays   *int    `json:"retention_days" binding:"omitempty,min=0"`
+		LegalHold       *bool   `json:"legal_hold"`
+		LegalHoldReason *string `json:"legal_hold_reason" binding:"omitempty,max=255"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid retention policy", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	tenantID := c.GetUint("tenant_id")
+	if req.TenantID != nil {
+		tenantID = *req.TenantID
+	}
+
+	db := platformDB(c)
+	policy, err := retention.Policy(db, tenantID, resource)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to get retention policy", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	oldPolicy := policy
+
+	if req.RetentionDays != nil {
+		policy.RetentionDays = *req.RetentionDays
+	}
+	if req.LegalHold != nil {
+		policy.LegalHold = *req.LegalHold
+	}
+	if req.LegalHoldReason != nil {
+		policy.LegalHoldReason = *req.LegalHoldReason
+	}
+	if !policy.LegalHold {
+		policy.LegalHoldReason = ""
+	}
+	policy.UpdatedBy = c.GetUint("user_id")
+
+	if err := db.Save(&policy).Error; err != nil {
+		if pkg.IsDuplicateKeyError(err) {
+			err := pkg.NewConflictError("Retention policy was modified concurrently", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		err := pkg.NewDatabaseError("Failed to update retention policy", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "update",
+		ResourceType: "retention_policy",
+		ResourceID:   fmt.Sprintf("%d/%s", tenantID, resource),
+		OldValue:     oldPolicy,
+		NewValue:     policy,
+	})
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// GetArchives 获取租户的归档列表，可按resource过滤
+func (rc *RetentionController) GetArchives(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+	tenantID, ok := retentionTenantID(c, c.Query("tenant_id"))
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := platformDB(c).Model(&models.RetentionArchive{}).Where("tenant_id = ?", tenantID)
+	if resource := c.Query("resource"); resource != "" {
+		query = query.Where("resource = ?", resource)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to count archives", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	var archives []models.RetentionArchive
+	if err := query.Order("to_time DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&archives).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch archives", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"archives":  archives,
+	})
+}
+
+// RestoreArchives 将租户某一资源在时间范围内的归档恢复到数据库
+// 恢复的记录在Retention.RestoreTTL之后由保留任务再次删除
+func (rc *RetentionController) RestoreArchives(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	var req struct {
+		TenantID *uint     `json:"tenant_id"`
+		Resource string    `json:"resource" binding:"required"`
+		From     time.Time `json:"from" binding:"required"`
+		To       time.Time `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid restore request", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	if !retention.IsResource(req.Resource) {
+		err := pkg.NewValidationError("Unknown retention resource", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	if req.To.Before(req.From) {
+		err := pkg.NewValidationError("Restore range end must not be before its start", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	tenantID := c.GetUint("tenant_id")
+	if req.TenantID != nil {
+		tenantID = *req.TenantID
+	}
+
+	job, err := retention.Default()
+	if err != nil {
+		err := pkg.NewInternalError("Archive storage is not available", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	result, err := job.Restore(c.Request.Context(), tenantID, req.Resource, req.From, req.To)
+	if err != nil {
+		err := pkg.NewInternalError("Failed to restore archives", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "restore",
+		ResourceType: "retention_archive",
+		ResourceID:   fmt.Sprintf("%d/%s", tenantID, req.Resource),
+		NewValue: gin.H{
+			"from":     req.From,
+			"to":       req.To,
+			"archives": len(result.Archives),
+			"restored": result.Restored,
+		},
+	})
+
+	c.JSON(http.StatusOK, result)
+}
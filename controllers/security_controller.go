@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/anomaly"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SecurityController 安全告警控制器
+type SecurityController struct{}
+
+// alertScope 返回告警查询的租户和数据库会话，默认当前租户，平台管理员可以通过tenant_id参数查看其他租户
+func alertScope(c *gin.Context) (uint, *gorm.DB, bool) {
+	tenantID := c.GetUint("tenant_id")
+	db := pkg.TenantDB(c)
+	if tenantParam := c.Query("tenant_id"); tenantParam != "" {
+		id, err := strconv.ParseUint(tenantParam, 10, 32)
+		if err != nil {
+			err := pkg.NewValidationError("Invalid tenant ID", err)
+			pkg.RespondError(c, err)
+			return 0, nil, false
+		}
+		if uint(id) != tenantID {
+			if !requirePlatformAdmin(c) {
+				return 0, nil, false
+			}
+			tenantID = uint(id)
+			db = platformDB(c)
+		}
+	}
+	return tenantID, db, true
+}
+
+// findAlert 按路径参数查找告警，未找到时写入404响应
+func findAlert(c *gin.Context) (*models.SecurityAlert, *gorm.DB, bool) {
+	tenantID, db, ok := alertScope(c)
+	if !ok {
+		return nil, nil, false
+	}
+	var alert models.SecurityAlert
+	if err := db.Where("id = ? AND tenant_id = ?", c.Param("id"), tenantID).First(&alert).Error; err != nil {
+		err := pkg.NewNotFoundError("Security alert not found", err)
+		pkg.RespondError(c, err)
+		return nil, nil, false
+	}
+	return &alert, db, true
+}
+
+// GetAlerts 获取安全告警列表，支持status、severity、rule、username过滤
+func (sc *SecurityController) GetAlerts(c *gin.Context) {
+	tenantID, db, ok := alertScope(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := db.Model(&models.SecurityAlert{}).Where("tenant_id = ?", tenantID)
+	for _, field := range []string{"status", "severity", "rule", "username"} {
+		if value := c.Query(field); value != "" {
+			query = query.Where(field+" = ?", value)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to count security alerts", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	var alerts []models.SecurityAlert
+	if err := query.Order("occurred_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&alerts).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch security alerts", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"alerts":    alerts,
+	})
+}
+
+// GetAlert 获取单个安全告警
+func (sc *SecurityController) GetAlert(c *gin.Context) {
+	alert, _, ok := findAlert(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+// UpdateAlertStatus 确认或解决安全告警，涉及自己的告警只能由平台管理员处理
+func (sc *SecurityController) UpdateAlertStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required,oneof=open acknowledged resolved"`
+		Note   string `json:"note" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid alert status", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	alert, db, ok := findAlert(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	var user models.User
+	platformDB(c).Select("id", "username").First(&user, userID)
+	if (alert.UserID == userID || (alert.Username != "" && alert.Username == user.Username)) && !isPlatformAdmin(c) {
+		err := pkg.NewForbiddenError("Security alerts about yourself must be handled by another administrator", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	oldStatus := alert.Status
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":     req.Status,
+		"note":       req.Note,
+		"handled_by": userID,
+		"handled_at": now,
+	}
+	if err := db.Model(alert).Updates(updates).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to update security alert", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	alert.Status, alert.Note, alert.HandledBy, alert.HandledAt = req.Status, req.Note, userID, &now
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "update_status",
+		ResourceType: "security_alert",
+		ResourceID:   strconv.FormatUint(uint64(alert.ID), 10),
+		OldValue:     gin.H{"status": oldStatus},
+		NewValue:     gin.H{"status": req.Status, "note": req.Note},
+	})
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// GetRules 获取当前生效的检测规则配置
+func (sc *SecurityController) GetRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"interval":            config.Config.Anomaly.Interval,
+		"notify_min_severity": config.Config.Anomaly.NotifyMinSeverity,
+		"webhook_enabled":     config.Config.Anomaly.WebhookURL != "",
+		"rules":               anomaly.Rules(),
+	})
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"weave/models"
+	"weave/pkg"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ShareController 资源共享控制器
+// 管理笔记和工具对用户或团队的共享
+type ShareController struct{}
+
+// validShareResource 校验资源类型
+func validShareResource(c *gin.Context, resourceType string) bool {
+	if resourceType == models.ShareResourceNote || resourceType == models.ShareResourceTool {
+		return true
+	}
+	err := pkg.NewValidationError("Unsupported resource type", nil)
+	pkg.RespondError(c, err)
+	return false
+}
+
+// requireResourceLevel 校验当前用户对资源的权限级别，不满足时写入错误响应
+func requireResourceLevel(c *gin.Context, resourceType, resourceID, level string) bool {
+	current, err := pkg.ResourceAccessLevel(pkg.TenantDB(c), c.GetUint("tenant_id"), resourceType, resourceID, c.GetUint("user_id"))
+	if errors.Is(err, pkg.ErrResourceNotFound) || (err == nil && current == "") {
+		// 无任何权限时与资源不存在返回相同结果，避免泄露资源是否存在
+		err := pkg.NewNotFoundError("Resource not found", nil)
+		pkg.RespondError(c, err)
+		return false
+	}
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to check resource access", err)
+		pkg.RespondError(c, err)
+		return false
+	}
+	if !pkg.HasShareLevel(current, level) {
+		err := pkg.NewForbiddenError("Only resource owners or admins can manage sharing", nil)
+		pkg.RespondError(c, err)
+		return false
+	}
+	return true
+}
+
+// GetResourceShares 获取资源的共享列表（需要admin权限）
+func (sc *ShareController) GetResourceShares(c *gin.Context) {
+	resourceType, resourceID := c.Param("type"), c.Param("id")
+	if !validShareResource(c, resourceType) || !requireResourceLevel(c, resourceType, resourceID, models.ShareLevelAdmin) {
+		return
+	}
+
+	var shares []models.ResourceShare
+	if err := pkg.TenantDB(c).Where("tenant_id = ? AND resource_type = ? AND resource_id = ?", c.GetUint("tenant_id"), resourceType, resourceID).
+		Order("id ASC").Find(&shares).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to query shares", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+// ShareResource 将资源共享给用户或团队，已共享时更新权限级别（需要admin权限）
+func (sc *ShareController) ShareResource(c *gin.Context) {
+	resourceType, resourceID := c.Param("type"), c.Param("id")
+	if !validShareResource(c, resourceType) {
+		return
+	}
+
+	var req struct {
+		SubjectType string `json:"subject_type" binding:"required,oneof=user team"`
+		SubjectID   uint   `json:"subject_id" binding:"required"`
+		Level       string `json:"level" binding:"required,oneof=read write admin"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid share data", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	if !requireResourceLevel(c, resourceType, resourceID, models.ShareLevelAdmin) {
+		return
+	}
+
+	tenantID := c.GetUint("tenant_id")
+	userID := c.GetUint("user_id")
+
+	// 共享对象必须属于当前租户
+	var subjectErr error
+	if req.SubjectType == models.ShareSubjectUser {
+		if req.SubjectID == userID {
+			err := pkg.NewBadRequestError("Cannot share a resource with yourself", nil)
+			pkg.RespondError(c, err)
+			return
+		}
+		subjectErr = pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", req.SubjectID, tenantID).First(&models.User{}).Error
+	} else {
+		subjectErr = pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", req.SubjectID, tenantID).First(&models.Team{}).Error
+	}
+	if subjectErr != nil {
+		if subjectErr == gorm.ErrRecordNotFound {
+			err := pkg.NewNotFoundError("Share subject not found", nil)
+			pkg.RespondError(c, err)
+		} else {
+			err := pkg.NewDatabaseError("Failed to query share subject", subjectErr)
+			pkg.RespondError(c, err)
+		}
+		return
+	}
+
+	var share models.ResourceShare
+	var oldValue interface{}
+	status := http.StatusOK
+	err := pkg.TenantDB(c).Where("tenant_id = ? AND resource_type = ? AND resource_id = ? AND subject_type = ? AND subject_id = ?",
+		tenantID, resourceType, resourceID, req.SubjectType, req.SubjectID).First(&share).Error
+	switch {
+	case err == nil:
+		oldValue = share
+		share.Level = req.Level
+		err = pkg.TenantDB(c).Model(&models.ResourceShare{}).Where("id = ?", share.ID).Update("level", req.Level).Error
+	case err == gorm.ErrRecordNotFound:
+		share = models.ResourceShare{
+			TenantID:     tenantID,
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			SubjectType:  req.SubjectType,
+			SubjectID:    req.SubjectID,
+			Level:        req.Level,
+			CreatedBy:    userID,
+		}
+		status = http.StatusCreated
+		err = pkg.TenantDB(c).Create(&share).Error
+	}
+	if pkg.IsDuplicateKeyError(err) {
+		err := pkg.NewConflictError("Share changed, please retry", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to save share", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	action := "share"
+	if oldValue != nil {
+		action = "update_share"
+	}
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		OldValue:     oldValue,
+		NewValue:     share,
+	})
+
+	c.JSON(status, share)
+}
+
+// RevokeShare 取消共享（需要admin权限）
+func (sc *ShareController) RevokeShare(c *gin.Context) {
+	resourceType, resourceID := c.Param("type"), c.Param("id")
+	if !validShareResource(c, resourceType) || !requireResourceLevel(c, resourceType, resourceID, models.ShareLevelAdmin) {
+		return
+	}
+
+	var share models.ResourceShare
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ? AND resource_type = ? AND resource_id = ?",
+		c.Param("shareId"), c.GetUint("tenant_id"), resourceType, resourceID).First(&share).Error; err != nil {
+		err := pkg.NewNotFoundError("Share not found", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	if err := pkg.TenantDB(c).Delete(&models.ResourceShare{}, share.ID).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to revoke share", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "revoke_share",
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		OldValue:     share,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share revoked successfully"})
+}
+
+// sharedItem 共享给当前用户的资源
+type sharedItem struct {
+	ResourceType string      `json:"resource_type"`
+	ResourceID   string      `json:"resource_id"`
+	Level        string      `json:"level"`
+	Resource     interface{} `json:"resource"`
+}
+
+// GetSharedWithMe 获取共享给当前用户（直接或通过团队）的笔记和工具
+// 可通过type参数只查询某一类资源
+func (sc *ShareController) GetSharedWithMe(c *gin.Context) {
+	tenantID := c.GetUint("tenant_id")
+	userID := c.GetUint("user_id")
+
+	resourceTypes := []string{models.ShareResourceNote, models.ShareResourceTool}
+	if resourceType := c.Query("type"); resourceType != "" {
+		if !validShareResource(c, resourceType) {
+			return
+		}
+		resourceTypes = []string{resourceType}
+	}
+
+	items := []sharedItem{}
+	for _, resourceType := range resourceTypes {
+		levels, err := pkg.SharedWithUser(pkg.TenantDB(c), tenantID, resourceType, userID)
+		if err != nil {
+			err := pkg.NewDatabaseError("Failed to query shared resources", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		if len(levels) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(levels))
+		for id := range levels {
+			ids = append(ids, id)
+		}
+
+		switch resourceType {
+		case models.ShareResourceNote:
+			var notes []models.Note
+			if err = pkg.TenantDB(c).Where("id IN ? AND tenant_id = ? AND user_id <> ?", ids, tenantID, userID).
+				Order("created_time DESC").Find(&notes).Error; err == nil {
+				for _, note := range notes {
+					items = append(items, sharedItem{ResourceType: resourceType, ResourceID: note.ID, Level: levels[note.ID], Resource: note})
+				}
+			}
+		case models.ShareResourceTool:
+			var tools []models.Tool
+			if err = pkg.TenantDB(c).Where("id IN ? AND tenant_id = ?", ids, tenantID).Order("name ASC").Find(&tools).Error; err == nil {
+				for _, tool := range tools {
+					id := strconv.FormatUint(uint64(tool.ID), 10)
+					items = append(items, sharedItem{ResourceType: resourceType, ResourceID: id, Level: levels[id], Resource: tool})
+				}
+			}
+		}
+		if err != nil {
+			err := pkg.NewDatabaseError("Failed to query shared resources", err)
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, items)
+}
@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"weave/config"
 	"weave/models"
 	"weave/pkg"
+	"weave/pkg/quota"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -14,41 +17,8 @@ import (
 // TeamController 团队控制器
 type TeamController struct{}
 
-// updateTeamMembers 更新团队成员列表字段
-func (tc *TeamController) updateTeamMembers(teamID uint) error {
-	// 定义用于存储成员用户名的切片
-	var usernames []string
-
-	// 联表查询获取团队成员的用户名
-	if err := pkg.DB.Table("team_member tm").
-		Select("u.username").
-		Joins("JOIN user u ON tm.user_id = u.id").
-		Where("tm.team_id = ?", teamID).
-		Pluck("u.username", &usernames).Error; err != nil {
-		return err
-	}
-
-	// 将用户名列表转换为逗号分隔的字符串
-	membersStr := ""
-	for i, username := range usernames {
-		if i > 0 {
-			membersStr += ","
-		}
-		membersStr += username
-	}
-
-	// 更新团队的members字段
-	if membersStr == "" {
-		// 如果没有成员，设置为nil
-		return pkg.DB.Model(&models.Team{}).
-			Where("id = ?", teamID).
-			Update("members", nil).Error
-	} else {
-		return pkg.DB.Model(&models.Team{}).
-			Where("id = ?", teamID).
-			Update("members", membersStr).Error
-	}
-}
+// errTeamMembershipChanged 成员关系在操作期间被并发修改
+var errTeamMembershipChanged = errors.New("team membership changed concurrently")
 
 // UpdateTeam 更新团队信息
 func (tc *TeamController) UpdateTeam(c *gin.Context) {
@@ -60,7 +30,7 @@ func (tc *TeamController) UpdateTeam(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		err := pkg.NewValidationError("Invalid team data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -68,7 +38,7 @@ func (tc *TeamController) UpdateTeam(c *gin.Context) {
 	teamID := c.Param("id")
 	if teamID == "" {
 		err := pkg.NewValidationError("Team ID is required", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -78,31 +48,34 @@ func (tc *TeamController) UpdateTeam(c *gin.Context) {
 
 	// 查找团队
 	var team models.Team
-	if err := pkg.DB.Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
 	// 检查权限：只有团队所有者可以更新团队信息
 	var teamMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND role = 'owner'", team.ID, userID).First(&teamMember).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("team_id = ? AND user_id = ? AND role = 'owner'", team.ID, userID).First(&teamMember).Error; err != nil {
 		err := pkg.NewForbiddenError("Only team owners can update team information", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
+	// 保存原始值用于审计日志
+	oldTeam := team
+
 	// 如果要更新名称，检查名称是否已存在
 	if req.Name != "" && req.Name != team.Name {
 		var existingTeam models.Team
-		if err := pkg.DB.Where("name = ? AND tenant_id = ? AND id != ?", req.Name, tenantID, teamID).First(&existingTeam).Error; err == nil {
+		if err := pkg.TenantDB(c).Where("name = ? AND tenant_id = ? AND id != ?", req.Name, tenantID, teamID).First(&existingTeam).Error; err == nil {
 			err := pkg.NewConflictError("Team name already exists", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 			return
 		}
 		team.Name = req.Name
@@ -114,9 +87,9 @@ func (tc *TeamController) UpdateTeam(c *gin.Context) {
 	}
 
 	// 保存更新
-	if err := pkg.DB.Save(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Save(&team).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to update team", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -125,6 +98,7 @@ func (tc *TeamController) UpdateTeam(c *gin.Context) {
 		Action:       "update",
 		ResourceType: "team",
 		ResourceID:   team.Name,
+		OldValue:     oldTeam,
 		NewValue:     team,
 	})
 
@@ -136,11 +110,12 @@ func (tc *TeamController) CreateTeam(c *gin.Context) {
 	var req struct {
 		Name        string `json:"name" binding:"required,min=2,max=100"`
 		Description string `json:"description"`
+		ParentID    *uint  `json:"parent_id"` // 上级团队，创建者需是其管理员
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		err := pkg.NewValidationError("Invalid team data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -149,9 +124,28 @@ func (tc *TeamController) CreateTeam(c *gin.Context) {
 
 	// 防止重复名称（租户内唯一）
 	var existing models.Team
-	if err := pkg.DB.Where("name = ? AND tenant_id = ?", req.Name, tenantID).First(&existing).Error; err == nil {
+	if err := pkg.TenantDB(c).Where("name = ? AND tenant_id = ?", req.Name, tenantID).First(&existing).Error; err == nil {
 		err := pkg.NewConflictError("Team name already exists", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 在上级团队下创建子团队需要是上级团队的管理员，且不能超过层级深度限制
+	if req.ParentID != nil {
+		h, ok := loadTeamHierarchy(c)
+		if !ok {
+			return
+		}
+		if err := h.ValidateParent(0, req.ParentID, config.Config.Team.MaxDepth); err != nil {
+			writeTeamHierarchyError(c, err)
+			return
+		}
+		if _, ok := requireTeamRole(c, h, *req.ParentID, "admin", "Only admins of the parent team can create sub-teams"); !ok {
+			return
+		}
+	}
+
+	if !enforceResourceQuota(c, tenantID, quota.ResourceTeams) {
 		return
 	}
 
@@ -159,23 +153,22 @@ func (tc *TeamController) CreateTeam(c *gin.Context) {
 		Name:        req.Name,
 		Description: req.Description,
 		OwnerID:     ownerID,
+		ParentID:    req.ParentID,
 		TenantID:    tenantID,
 	}
-	if err := pkg.DB.Create(&team).Error; err != nil {
+	// 团队与创建者的owner成员记录在同一事务中创建
+	err := pkg.TenantDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TeamMember{TeamID: team.ID, UserID: ownerID, Role: "owner", TenantID: tenantID}).Error
+	})
+	if err != nil {
 		err := pkg.NewDatabaseError("Failed to create team", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
-	// 将创建者加入团队成员，角色为owner
-	_ = pkg.DB.Create(&models.TeamMember{TeamID: team.ID, UserID: ownerID, Role: "owner", TenantID: tenantID}).Error
-
-	// 更新团队成员列表字段
-	if err := tc.updateTeamMembers(team.ID); err != nil {
-		// 记录错误但不影响主要功能
-		pkg.Error("Failed to update team members field after team creation")
-	}
-
 	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
 		Action:       "create",
 		ResourceType: "team",
@@ -193,40 +186,36 @@ func (tc *TeamController) GetTeamMembers(c *gin.Context) {
 	teamID, err := strconv.ParseUint(teamIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid team ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 获取当前用户信息
-	userID := c.GetUint("user_id")
 	tenantID := c.GetUint("tenant_id")
 
 	// 查找团队
 	var team models.Team
-	if err := pkg.DB.Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
-	// 检查用户是否为团队成员
-	var teamMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ?", teamID, userID).First(&teamMember).Error; err != nil {
-		err := pkg.NewForbiddenError("You are not a member of this team", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	// 检查用户是否为团队成员（上级团队成员继承下级团队的成员身份）
+	if _, ok := requireEffectiveTeamRole(c, uint(teamID), "member", "You are not a member of this team"); !ok {
 		return
 	}
 
 	// 查询团队成员列表
 	var members []models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND tenant_id = ?", teamID, tenantID).Find(&members).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("team_id = ? AND tenant_id = ?", teamID, tenantID).Find(&members).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to query team members", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -240,7 +229,7 @@ func (tc *TeamController) AddTeamMember(c *gin.Context) {
 	teamID, err := strconv.ParseUint(teamIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid team ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -252,61 +241,56 @@ func (tc *TeamController) AddTeamMember(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		err := pkg.NewValidationError("Invalid member data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 获取当前用户信息
-	userID := c.GetUint("user_id")
 	tenantID := c.GetUint("tenant_id")
 
 	// 查找团队
 	var team models.Team
-	if err := pkg.DB.Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
-	// 检查权限：只有团队所有者或管理员可以添加成员
-	var currentMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND role IN ('owner', 'admin')", teamID, userID).First(&currentMember).Error; err != nil {
-		err := pkg.NewForbiddenError("Only team owners or admins can add members", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
-		return
-	}
-
-	// 检查用户是否已存在
-	var existingMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ?", teamID, req.UserID).First(&existingMember).Error; err == nil {
-		err := pkg.NewConflictError("User is already a member of the team", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	// 检查权限：只有团队所有者或管理员（含上级团队管理员）可以添加成员
+	if _, ok := requireEffectiveTeamRole(c, uint(teamID), "admin", "Only team owners or admins can add members"); !ok {
 		return
 	}
 
-	// 添加新成员
+	// 添加新成员，并发添加同一用户时由(team_id, user_id)唯一约束兜底
 	newMember := models.TeamMember{
 		TeamID:   uint(teamID),
 		UserID:   req.UserID,
 		Role:     req.Role,
 		TenantID: tenantID,
 	}
-
-	if err := pkg.DB.Create(&newMember).Error; err != nil {
-		err := pkg.NewDatabaseError("Failed to add team member", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	err = pkg.TenantDB(c).Transaction(func(tx *gorm.DB) error {
+		var existingMember models.TeamMember
+		if err := tx.Where("team_id = ? AND user_id = ?", teamID, req.UserID).First(&existingMember).Error; err == nil {
+			return gorm.ErrDuplicatedKey
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		return tx.Create(&newMember).Error
+	})
+	if pkg.IsDuplicateKeyError(err) {
+		err := pkg.NewConflictError("User is already a member of the team", nil)
+		pkg.RespondError(c, err)
 		return
 	}
-
-	// 更新团队成员列表字段
-	if err := tc.updateTeamMembers(uint(teamID)); err != nil {
-		// 记录错误但不影响主要功能
-		pkg.Error("Failed to update team members field")
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to add team member", err)
+		pkg.RespondError(c, err)
+		return
 	}
 
 	// 记录审计日志
@@ -329,43 +313,42 @@ func (tc *TeamController) RemoveTeamMember(c *gin.Context) {
 	teamID, err := strconv.ParseUint(teamIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid team ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	memberID, err := strconv.ParseUint(memberIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid member ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 获取当前用户信息
-	userID := c.GetUint("user_id")
 	tenantID := c.GetUint("tenant_id")
 
 	// 查找团队
 	var team models.Team
-	if err := pkg.DB.Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
 	// 查找要移除的成员
 	var teamMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND tenant_id = ?", teamID, memberID, tenantID).First(&teamMember).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("team_id = ? AND user_id = ? AND tenant_id = ?", teamID, memberID, tenantID).First(&teamMember).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team member not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team member", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
@@ -373,28 +356,25 @@ func (tc *TeamController) RemoveTeamMember(c *gin.Context) {
 	// 检查权限：只有团队所有者或管理员可以移除成员，且不能移除所有者
 	if teamMember.Role == "owner" {
 		err := pkg.NewForbiddenError("Cannot remove team owner", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
-	var currentMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND role IN ('owner', 'admin')", teamID, userID).First(&currentMember).Error; err != nil {
-		err := pkg.NewForbiddenError("Only team owners or admins can remove members", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	if _, ok := requireEffectiveTeamRole(c, uint(teamID), "admin", "Only team owners or admins can remove members"); !ok {
 		return
 	}
 
-	// 移除成员
-	if err := pkg.DB.Delete(&teamMember).Error; err != nil {
-		err := pkg.NewDatabaseError("Failed to remove team member", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	// 移除成员，删除条件带上角色，防止期间被转让为所有者的成员被误删
+	result := pkg.TenantDB(c).Where("id = ? AND role <> 'owner'", teamMember.ID).Delete(&models.TeamMember{})
+	if result.Error != nil {
+		err := pkg.NewDatabaseError("Failed to remove team member", result.Error)
+		pkg.RespondError(c, err)
 		return
 	}
-
-	// 更新团队成员列表字段
-	if err := tc.updateTeamMembers(uint(teamID)); err != nil {
-		// 记录错误但不影响主要功能
-		pkg.Error("Failed to update team members field")
+	if result.RowsAffected == 0 {
+		err := pkg.NewConflictError("Team member changed, please retry", nil)
+		pkg.RespondError(c, err)
+		return
 	}
 
 	// 记录审计日志
@@ -416,9 +396,9 @@ func (tc *TeamController) GetTeams(c *gin.Context) {
 
 	// 查询用户所属的所有团队
 	var teamMembers []models.TeamMember
-	if err := pkg.DB.Where("user_id = ? AND tenant_id = ?", userID, tenantID).Find(&teamMembers).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("user_id = ? AND tenant_id = ?", userID, tenantID).Find(&teamMembers).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to query team memberships", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -431,9 +411,9 @@ func (tc *TeamController) GetTeams(c *gin.Context) {
 	// 查询团队信息
 	var teams []models.Team
 	if len(teamIDs) > 0 {
-		if err := pkg.DB.Where("id IN ? AND tenant_id = ?", teamIDs, tenantID).Find(&teams).Error; err != nil {
+		if err := pkg.TenantDB(c).Where("id IN ? AND tenant_id = ?", teamIDs, tenantID).Find(&teams).Error; err != nil {
 			err := pkg.NewDatabaseError("Failed to query teams", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 			return
 		}
 	}
@@ -448,7 +428,7 @@ func (tc *TeamController) TransferTeamOwner(c *gin.Context) {
 	teamID, err := strconv.ParseUint(teamIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid team ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -459,7 +439,7 @@ func (tc *TeamController) TransferTeamOwner(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		err := pkg.NewValidationError("Invalid owner data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -469,80 +449,76 @@ func (tc *TeamController) TransferTeamOwner(c *gin.Context) {
 
 	// 查找团队
 	var team models.Team
-	if err := pkg.DB.Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
 	// 检查权限：只有团队所有者可以转让所有权
 	var currentMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND role = 'owner'", teamID, userID).First(&currentMember).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("team_id = ? AND user_id = ? AND role = 'owner'", teamID, userID).First(&currentMember).Error; err != nil {
 		err := pkg.NewForbiddenError("Only team owners can transfer ownership", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 检查新所有者是否为团队成员
 	var newOwnerMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND tenant_id = ?", teamID, req.NewOwnerID, tenantID).First(&newOwnerMember).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("team_id = ? AND user_id = ? AND tenant_id = ?", teamID, req.NewOwnerID, tenantID).First(&newOwnerMember).Error; err != nil {
 		err := pkg.NewNotFoundError("The new owner must be a team member", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
-	// 开始事务
-	tx := pkg.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// 在同一事务中交换角色并更新团队所有者，每步都校验前置状态，并发转让时只有一个生效
+	err = pkg.TenantDB(c).Transaction(func(tx *gorm.DB) error {
+		// 将原所有者角色改为admin
+		result := tx.Model(&models.TeamMember{}).Where("id = ? AND role = 'owner'", currentMember.ID).Update("role", "admin")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTeamMembershipChanged
 		}
-	}()
-
-	// 将原所有者角色改为admin
-	currentMember.Role = "admin"
-	if err := tx.Save(&currentMember).Error; err != nil {
-		tx.Rollback()
-		err := pkg.NewDatabaseError("Failed to update current owner role", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
-		return
-	}
 
-	// 将新所有者角色改为owner
-	newOwnerMember.Role = "owner"
-	if err := tx.Save(&newOwnerMember).Error; err != nil {
-		tx.Rollback()
-		err := pkg.NewDatabaseError("Failed to update new owner role", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
-		return
-	}
+		// 将新所有者角色改为owner
+		result = tx.Model(&models.TeamMember{}).Where("id = ?", newOwnerMember.ID).Update("role", "owner")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTeamMembershipChanged
+		}
 
-	// 更新团队的OwnerID字段
-	team.OwnerID = req.NewOwnerID
-	if err := tx.Save(&team).Error; err != nil {
-		tx.Rollback()
-		err := pkg.NewDatabaseError("Failed to update team owner", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		// 更新团队的OwnerID字段
+		result = tx.Model(&models.Team{}).Where("id = ? AND owner_id = ?", team.ID, team.OwnerID).Update("owner_id", req.NewOwnerID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTeamMembershipChanged
+		}
+		return nil
+	})
+	if errors.Is(err, errTeamMembershipChanged) {
+		err := pkg.NewConflictError("Team membership changed, please retry", nil)
+		pkg.RespondError(c, err)
 		return
 	}
-
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		err := pkg.NewDatabaseError("Failed to commit transaction", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to transfer team ownership", err)
+		pkg.RespondError(c, err)
 		return
 	}
-
-	// 更新团队成员列表字段
-	if err := tc.updateTeamMembers(uint(teamID)); err != nil {
-		// 记录错误但不影响主要功能
-		pkg.Error("Failed to update team members field")
-	}
+	currentMember.Role = "admin"
+	newOwnerMember.Role = "owner"
+	team.OwnerID = req.NewOwnerID
 
 	// 记录审计日志
 	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
@@ -568,32 +544,28 @@ func (tc *TeamController) SearchTeamMembers(c *gin.Context) {
 	teamID, err := strconv.ParseUint(teamIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid team ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 获取当前用户信息
-	userID := c.GetUint("user_id")
 	tenantID := c.GetUint("tenant_id")
 
 	// 查找团队
 	var team models.Team
-	if err := pkg.DB.Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
-	// 检查用户是否为团队成员
-	var teamMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ?", teamID, userID).First(&teamMember).Error; err != nil {
-		err := pkg.NewForbiddenError("You are not a member of this team", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	// 检查用户是否为团队成员（上级团队成员继承下级团队的成员身份）
+	if _, ok := requireEffectiveTeamRole(c, uint(teamID), "member", "You are not a member of this team"); !ok {
 		return
 	}
 
@@ -601,12 +573,12 @@ func (tc *TeamController) SearchTeamMembers(c *gin.Context) {
 	keyword := c.Query("keyword")
 	if keyword == "" {
 		err := pkg.NewValidationError("Search keyword is required", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 构建查询
-	query := pkg.DB.Table("team_member tm").
+	query := pkg.TenantDB(c).Table("team_member tm").
 		Select("tm.*, u.username, u.email").
 		Joins("JOIN user u ON tm.user_id = u.id").
 		Where("tm.team_id = ? AND tm.tenant_id = ?", teamID, tenantID)
@@ -630,7 +602,7 @@ func (tc *TeamController) SearchTeamMembers(c *gin.Context) {
 	var members []MemberWithInfo
 	if err := query.Find(&members).Error; err != nil {
 		err := pkg.NewDatabaseError("Failed to search team members", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -646,14 +618,14 @@ func (tc *TeamController) UpdateMemberRole(c *gin.Context) {
 	teamID, err := strconv.ParseUint(teamIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid team ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	memberID, err := strconv.ParseUint(memberIDStr, 10, 32)
 	if err != nil {
 		err := pkg.NewValidationError("Invalid member ID", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -664,7 +636,7 @@ func (tc *TeamController) UpdateMemberRole(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		err := pkg.NewValidationError("Invalid role data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -674,54 +646,63 @@ func (tc *TeamController) UpdateMemberRole(c *gin.Context) {
 
 	// 查找团队
 	var team models.Team
-	if err := pkg.DB.Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
 	// 查找要更新的成员
 	var teamMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND tenant_id = ?", teamID, memberID, tenantID).First(&teamMember).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("team_id = ? AND user_id = ? AND tenant_id = ?", teamID, memberID, tenantID).First(&teamMember).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			err := pkg.NewNotFoundError("Team member not found", nil)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		} else {
 			err := pkg.NewDatabaseError("Failed to query team member", err)
-			c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+			pkg.RespondError(c, err)
 		}
 		return
 	}
 
 	// 检查权限：只有团队所有者可以更新成员角色
 	var currentMember models.TeamMember
-	if err := pkg.DB.Where("team_id = ? AND user_id = ? AND role = 'owner'", teamID, userID).First(&currentMember).Error; err != nil {
+	if err := pkg.TenantDB(c).Where("team_id = ? AND user_id = ? AND role = 'owner'", teamID, userID).First(&currentMember).Error; err != nil {
 		err := pkg.NewForbiddenError("Only team owners can update member roles", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 所有者角色只能通过转让所有权变更，避免团队失去所有者
+	if teamMember.Role == "owner" {
+		err := pkg.NewForbiddenError("Cannot change the owner's role, transfer ownership instead", nil)
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 保存旧角色用于审计日志
 	oldRole := teamMember.Role
 
-	// 更新角色
-	teamMember.Role = req.Role
-	if err := pkg.DB.Save(&teamMember).Error; err != nil {
-		err := pkg.NewDatabaseError("Failed to update member role", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	// 更新角色，条件更新防止覆盖期间发生的所有权转让
+	result := pkg.TenantDB(c).Model(&models.TeamMember{}).
+		Where("id = ? AND role = ?", teamMember.ID, oldRole).
+		Update("role", req.Role)
+	if result.Error != nil {
+		err := pkg.NewDatabaseError("Failed to update member role", result.Error)
+		pkg.RespondError(c, err)
 		return
 	}
-
-	// 更新团队成员列表字段
-	if err := tc.updateTeamMembers(uint(teamID)); err != nil {
-		// 记录错误但不影响主要功能
-		pkg.Error("Failed to update team members field")
+	if result.RowsAffected == 0 && oldRole != req.Role {
+		err := pkg.NewConflictError("Team membership changed, please retry", nil)
+		pkg.RespondError(c, err)
+		return
 	}
+	teamMember.Role = req.Role
 
 	// 记录审计日志
 	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
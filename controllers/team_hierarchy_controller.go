@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// teamTreeNode 团队树节点
+type teamTreeNode struct {
+	models.Team
+	Role     *pkg.TeamRole   `json:"role,omitempty"`
+	Children []*teamTreeNode `json:"children"`
+}
+
+// buildTeamTree 构建以指定团队为根的子树，只包含visible中的团队
+func buildTeamTree(h *pkg.TeamHierarchy, id uint, roles map[uint]*pkg.TeamRole, visible map[uint]bool) *teamTreeNode {
+	team, _ := h.Team(id)
+	node := &teamTreeNode{Team: team, Role: roles[id], Children: []*teamTreeNode{}}
+	for _, child := range h.Children(id) {
+		if visible[child] {
+			node.Children = append(node.Children, buildTeamTree(h, child, roles, visible))
+		}
+	}
+	return node
+}
+
+// requireTeamRole 校验当前用户在团队中的有效角色（含上级团队继承的角色），不满足时写入错误响应
+func requireTeamRole(c *gin.Context, h *pkg.TeamHierarchy, teamID uint, minRole, message string) (*pkg.TeamRole, bool) {
+	role, err := h.EffectiveTeamRole(pkg.TenantDB(c), teamID, c.GetUint("user_id"))
+	if errors.Is(err, pkg.ErrTeamNotFound) {
+		err := pkg.NewNotFoundError("Team not found", nil)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to query team membership", err)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	if !role.AtLeast(minRole) {
+		err := pkg.NewForbiddenError(message, nil)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	return role, true
+}
+
+// loadTeamHierarchy 加载当前租户的团队层级，失败时写入错误响应
+func loadTeamHierarchy(c *gin.Context) (*pkg.TeamHierarchy, bool) {
+	h, err := pkg.LoadTeamHierarchy(pkg.TenantDB(c), c.GetUint("tenant_id"))
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to query teams", err)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	return h, true
+}
+
+// requireEffectiveTeamRole 加载团队层级并校验当前用户的有效角色
+func requireEffectiveTeamRole(c *gin.Context, teamID uint, minRole, message string) (*pkg.TeamRole, bool) {
+	h, ok := loadTeamHierarchy(c)
+	if !ok {
+		return nil, false
+	}
+	return requireTeamRole(c, h, teamID, minRole, message)
+}
+
+// writeTeamHierarchyError 将层级校验错误转换为错误响应
+func writeTeamHierarchyError(c *gin.Context, err error) {
+	var appErr *pkg.AppError
+	switch {
+	case errors.Is(err, pkg.ErrTeamNotFound):
+		appErr = pkg.NewNotFoundError("Parent team not found", nil)
+	case errors.Is(err, pkg.ErrTeamCycle):
+		appErr = pkg.NewConflictError("Team cannot be moved under itself or its descendants", nil)
+	case errors.Is(err, pkg.ErrTeamDepthExceed):
+		appErr = pkg.NewValidationRangeError(fmt.Sprintf("Team hierarchy cannot exceed %d levels", config.Config.Team.MaxDepth), nil)
+	default:
+		appErr = pkg.NewDatabaseError("Failed to update team hierarchy", err)
+	}
+	pkg.RespondError(c, appErr)
+}
+
+// GetTeamTree 获取当前用户可见的团队树
+// 用户直接所属的团队及其所有下级团队可见，返回以最上层可见团队为根的森林
+func (tc *TeamController) GetTeamTree(c *gin.Context) {
+	h, ok := loadTeamHierarchy(c)
+	if !ok {
+		return
+	}
+
+	roles, err := h.UserTeamRoles(pkg.TenantDB(c), c.GetUint("user_id"))
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to query team memberships", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	visible := make(map[uint]bool, len(roles))
+	for id := range roles {
+		visible[id] = true
+	}
+
+	var walk func(ids []uint, parentVisible bool) []*teamTreeNode
+	walk = func(ids []uint, parentVisible bool) []*teamTreeNode {
+		nodes := []*teamTreeNode{}
+		for _, id := range ids {
+			if visible[id] && !parentVisible {
+				nodes = append(nodes, buildTeamTree(h, id, roles, visible))
+				continue
+			}
+			if !visible[id] {
+				nodes = append(nodes, walk(h.Children(id), false)...)
+			}
+		}
+		return nodes
+	}
+
+	c.JSON(http.StatusOK, walk(h.Roots(), false))
+}
+
+// GetTeamSubtree 获取指定团队及其所有下级团队
+func (tc *TeamController) GetTeamSubtree(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid team ID", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	h, ok := loadTeamHierarchy(c)
+	if !ok {
+		return
+	}
+	if _, ok := requireTeamRole(c, h, uint(teamID), "member", "You are not a member of this team"); !ok {
+		return
+	}
+
+	roles, err := h.UserTeamRoles(pkg.TenantDB(c), c.GetUint("user_id"))
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to query team memberships", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	visible := make(map[uint]bool)
+	for _, id := range h.Subtree(uint(teamID)) {
+		visible[id] = true
+	}
+
+	ancestors := []models.Team{}
+	for _, id := range h.Ancestors(uint(teamID)) {
+		team, _ := h.Team(id)
+		ancestors = append(ancestors, team)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ancestors": ancestors,
+		"tree":      buildTeamTree(h, uint(teamID), roles, visible),
+	})
+}
+
+// MoveTeam 移动团队到新的上级团队下，parent_id为空表示移动为根团队
+// 需要同时是该团队、原上级团队和新上级团队的管理员（含继承的角色）
+func (tc *TeamController) MoveTeam(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid team ID", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	var req struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid team data", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	h, ok := loadTeamHierarchy(c)
+	if !ok {
+		return
+	}
+	if _, ok := requireTeamRole(c, h, uint(teamID), "admin", "Only team owners or admins can move the team"); !ok {
+		return
+	}
+	team, _ := h.Team(uint(teamID))
+	if team.ParentID != nil {
+		if _, ok := requireTeamRole(c, h, *team.ParentID, "admin", "Only admins of the current parent team can move the team out"); !ok {
+			return
+		}
+	}
+	if req.ParentID != nil {
+		if _, exists := h.Team(*req.ParentID); !exists {
+			writeTeamHierarchyError(c, pkg.ErrTeamNotFound)
+			return
+		}
+		if _, ok := requireTeamRole(c, h, *req.ParentID, "admin", "Only admins of the new parent team can move teams under it"); !ok {
+			return
+		}
+	}
+
+	// 在事务内基于最新数据重新校验，避免并发移动形成环
+	oldParentID := team.ParentID
+	err = pkg.TenantDB(c).Transaction(func(tx *gorm.DB) error {
+		current, err := pkg.LoadTeamHierarchy(tx, team.TenantID)
+		if err != nil {
+			return err
+		}
+		if err := current.ValidateParent(team.ID, req.ParentID, config.Config.Team.MaxDepth); err != nil {
+			return err
+		}
+		return tx.Model(&models.Team{}).Where("id = ?", team.ID).Update("parent_id", req.ParentID).Error
+	})
+	if err != nil {
+		writeTeamHierarchyError(c, err)
+		return
+	}
+	team.ParentID = req.ParentID
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "move",
+		ResourceType: "team",
+		ResourceID:   team.Name,
+		OldValue:     gin.H{"parent_id": oldParentID},
+		NewValue:     gin.H{"parent_id": req.ParentID},
+	})
+
+	c.JSON(http.StatusOK, team)
+}
+
+// GetMyTeamRole 获取当前用户在团队中的有效角色
+func (tc *TeamController) GetMyTeamRole(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid team ID", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	role, ok := requireEffectiveTeamRole(c, uint(teamID), "member", "You are not a member of this team")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
@@ -0,0 +1,419 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxInvitationTTLHours 邀请有效期上限（30天）
+const maxInvitationTTLHours = 720
+
+// errInvitationNotPending 邀请已被处理或已过期
+var errInvitationNotPending = errors.New("invitation is no longer pending")
+
+// InviteTeamMember 邀请用户加入团队
+// 可按用户名或邮箱邀请，被邀请人接受后才成为团队成员
+func (tc *TeamController) InviteTeamMember(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid team ID", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	var req struct {
+		Username       string `json:"username" binding:"omitempty,min=3,max=50"`
+		Email          string `json:"email" binding:"omitempty,email"`
+		Role           string `json:"role" binding:"required,oneof=admin member"`
+		ExpiresInHours int    `json:"expires_in_hours" binding:"omitempty,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid invitation data", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	if (req.Username == "") == (req.Email == "") {
+		err := pkg.NewValidationError("Exactly one of username or email is required", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	if req.ExpiresInHours > maxInvitationTTLHours {
+		err := pkg.NewValidationRangeError(fmt.Sprintf("Invitation expiry cannot exceed %d hours", maxInvitationTTLHours), nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	tenantID := c.GetUint("tenant_id")
+
+	team, ok := tc.findTeam(c, uint(teamID), tenantID)
+	if !ok {
+		return
+	}
+
+	// 检查权限：只有团队所有者或管理员可以发出邀请
+	if _, ok := requireEffectiveTeamRole(c, uint(teamID), "admin", "Only team owners or admins can invite members"); !ok {
+		return
+	}
+
+	invitation := models.TeamInvitation{
+		TeamID:    team.ID,
+		TenantID:  tenantID,
+		InviterID: userID,
+		Role:      req.Role,
+		Status:    models.InvitationStatusPending,
+	}
+
+	// 解析被邀请人：用户名必须是本租户已有用户，邮箱允许尚未注册
+	var invitee models.User
+	if req.Username != "" {
+		if err := pkg.TenantDB(c).Where("username = ? AND tenant_id = ?", req.Username, tenantID).First(&invitee).Error; err != nil {
+			err := pkg.NewNotFoundError("User not found", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		invitation.InviteeUserID = &invitee.ID
+	} else {
+		invitation.InviteeEmail = strings.ToLower(strings.TrimSpace(req.Email))
+		if err := pkg.TenantDB(c).Where("email = ? AND tenant_id = ?", invitation.InviteeEmail, tenantID).First(&invitee).Error; err == nil {
+			invitation.InviteeUserID = &invitee.ID
+		}
+	}
+
+	if invitation.InviteeUserID != nil {
+		if *invitation.InviteeUserID == userID {
+			err := pkg.NewBadRequestError("Cannot invite yourself", nil)
+			pkg.RespondError(c, err)
+			return
+		}
+
+		var existingMember models.TeamMember
+		if err := pkg.TenantDB(c).Where("team_id = ? AND user_id = ?", teamID, *invitation.InviteeUserID).First(&existingMember).Error; err == nil {
+			err := pkg.NewConflictError("User is already a member of the team", nil)
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+
+	// 同一被邀请人在同一团队只能有一条有效的待处理邀请
+	now := time.Now()
+	pendingQuery := pkg.TenantDB(c).Model(&models.TeamInvitation{}).
+		Where("team_id = ? AND status = ? AND expires_at > ?", teamID, models.InvitationStatusPending, now)
+	if invitation.InviteeUserID != nil {
+		pendingQuery = pendingQuery.Where("invitee_user_id = ?", *invitation.InviteeUserID)
+	} else {
+		pendingQuery = pendingQuery.Where("invitee_email = ?", invitation.InviteeEmail)
+	}
+	var pendingCount int64
+	if err := pendingQuery.Count(&pendingCount).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to query invitations", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	if pendingCount > 0 {
+		err := pkg.NewConflictError("A pending invitation already exists for this user", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	ttlHours := config.Config.Team.InvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttlHours = req.ExpiresInHours
+	}
+	invitation.ExpiresAt = now.Add(time.Duration(ttlHours) * time.Hour)
+
+	if err := pkg.TenantDB(c).Create(&invitation).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to create invitation", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	pkg.PublishTeamInvitationEvent(pkg.EventTeamInvitationCreated, &invitation, userID)
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "invite_member",
+		ResourceType: "team_invitation",
+		ResourceID:   fmt.Sprintf("%d", invitation.ID),
+		NewValue:     invitation,
+	})
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// GetTeamInvitations 获取团队的邀请列表（团队所有者或管理员）
+func (tc *TeamController) GetTeamInvitations(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid team ID", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	tenantID := c.GetUint("tenant_id")
+
+	if _, ok := tc.findTeam(c, uint(teamID), tenantID); !ok {
+		return
+	}
+
+	if _, ok := requireEffectiveTeamRole(c, uint(teamID), "admin", "Only team owners or admins can view invitations"); !ok {
+		return
+	}
+
+	query := pkg.TenantDB(c).Where("team_id = ? AND tenant_id = ?", teamID, tenantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var invitations []models.TeamInvitation
+	if err := query.Order("created_at DESC").Find(&invitations).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to query invitations", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeTeamInvitation 撤销待处理的邀请（邀请人、团队所有者或管理员）
+func (tc *TeamController) RevokeTeamInvitation(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid team ID", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	tenantID := c.GetUint("tenant_id")
+
+	var invitation models.TeamInvitation
+	if err := pkg.TenantDB(c).Where("id = ? AND team_id = ? AND tenant_id = ?", c.Param("invitationId"), teamID, tenantID).First(&invitation).Error; err != nil {
+		err := pkg.NewNotFoundError("Invitation not found", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	if invitation.InviterID != userID {
+		if _, ok := requireEffectiveTeamRole(c, uint(teamID), "admin", "Only the inviter, team owners or admins can revoke invitations"); !ok {
+			return
+		}
+	}
+
+	tc.respondToInvitation(c, &invitation, models.InvitationStatusRevoked)
+}
+
+// GetMyInvitations 获取当前用户收到的邀请
+// 默认只返回未过期的待处理邀请，可通过status参数查看其他状态
+func (tc *TeamController) GetMyInvitations(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", models.InvitationStatusPending)
+	query := pkg.TenantDB(c).Where("tenant_id = ? AND status = ?", user.TenantID, status).
+		Where("invitee_user_id = ? OR (invitee_user_id IS NULL AND invitee_email = ?)", user.ID, strings.ToLower(user.Email))
+	if status == models.InvitationStatusPending {
+		query = query.Where("expires_at > ?", time.Now())
+	}
+
+	var invitations []models.TeamInvitation
+	if err := query.Order("created_at DESC").Find(&invitations).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to query invitations", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 附带团队名称，方便被邀请人识别
+	teamNames := make(map[uint]string)
+	if len(invitations) > 0 {
+		teamIDs := make([]uint, 0, len(invitations))
+		for _, invitation := range invitations {
+			teamIDs = append(teamIDs, invitation.TeamID)
+		}
+		var teams []models.Team
+		if err := pkg.TenantDB(c).Select("id", "name").Where("id IN ?", teamIDs).Find(&teams).Error; err == nil {
+			for _, team := range teams {
+				teamNames[team.ID] = team.Name
+			}
+		}
+	}
+
+	type invitationWithTeam struct {
+		models.TeamInvitation
+		TeamName string `json:"team_name"`
+	}
+	result := make([]invitationWithTeam, 0, len(invitations))
+	for _, invitation := range invitations {
+		result = append(result, invitationWithTeam{TeamInvitation: invitation, TeamName: teamNames[invitation.TeamID]})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// AcceptInvitation 接受邀请并加入团队
+func (tc *TeamController) AcceptInvitation(c *gin.Context) {
+	invitation, ok := tc.findMyInvitation(c)
+	if !ok {
+		return
+	}
+	tc.respondToInvitation(c, invitation, models.InvitationStatusAccepted)
+}
+
+// DeclineInvitation 拒绝邀请
+func (tc *TeamController) DeclineInvitation(c *gin.Context) {
+	invitation, ok := tc.findMyInvitation(c)
+	if !ok {
+		return
+	}
+	tc.respondToInvitation(c, invitation, models.InvitationStatusDeclined)
+}
+
+// respondToInvitation 将待处理邀请切换到目标状态
+// 状态更新带pending条件，保证并发的接受、拒绝、撤销和过期清理只有一个生效
+func (tc *TeamController) respondToInvitation(c *gin.Context, invitation *models.TeamInvitation, status string) {
+	userID := c.GetUint("user_id")
+	now := time.Now()
+
+	if invitation.Status != models.InvitationStatusPending {
+		err := pkg.NewConflictError(fmt.Sprintf("Invitation is already %s", invitation.Status), nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	if !invitation.IsPending(now) {
+		err := pkg.NewConflictError("Invitation has expired", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	oldStatus := invitation.Status
+	err := pkg.TenantDB(c).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"status": status, "responded_at": now}
+		if status == models.InvitationStatusAccepted {
+			// 按邮箱邀请的记录在接受时绑定到实际用户
+			updates["invitee_user_id"] = userID
+		}
+		result := tx.Model(&models.TeamInvitation{}).
+			Where("id = ? AND status = ?", invitation.ID, models.InvitationStatusPending).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationNotPending
+		}
+
+		if status != models.InvitationStatusAccepted {
+			return nil
+		}
+
+		var existing models.TeamMember
+		err := tx.Where("team_id = ? AND user_id = ?", invitation.TeamID, userID).First(&existing).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(&models.TeamMember{
+			TeamID:   invitation.TeamID,
+			UserID:   userID,
+			Role:     invitation.Role,
+			TenantID: invitation.TenantID,
+		}).Error
+	})
+	if errors.Is(err, errInvitationNotPending) {
+		err := pkg.NewConflictError("Invitation is no longer pending", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to update invitation", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	invitation.Status = status
+	invitation.RespondedAt = &now
+	if status == models.InvitationStatusAccepted {
+		invitation.InviteeUserID = &userID
+	}
+
+	eventTypes := map[string]string{
+		models.InvitationStatusAccepted: pkg.EventTeamInvitationAccepted,
+		models.InvitationStatusDeclined: pkg.EventTeamInvitationDeclined,
+		models.InvitationStatusRevoked:  pkg.EventTeamInvitationRevoked,
+	}
+	actions := map[string]string{
+		models.InvitationStatusAccepted: "accept_invitation",
+		models.InvitationStatusDeclined: "decline_invitation",
+		models.InvitationStatusRevoked:  "revoke_invitation",
+	}
+	pkg.PublishTeamInvitationEvent(eventTypes[status], invitation, userID)
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       actions[status],
+		ResourceType: "team_invitation",
+		ResourceID:   fmt.Sprintf("%d", invitation.ID),
+		OldValue:     map[string]interface{}{"status": oldStatus},
+		NewValue:     map[string]interface{}{"status": status, "team_id": invitation.TeamID, "role": invitation.Role},
+	})
+
+	c.JSON(http.StatusOK, invitation)
+}
+
+// findMyInvitation 查找发给当前用户的邀请，不属于当前用户时按未找到处理
+func (tc *TeamController) findMyInvitation(c *gin.Context) (*models.TeamInvitation, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	var invitation models.TeamInvitation
+	err := pkg.TenantDB(c).
+		Where("id = ? AND tenant_id = ?", c.Param("id"), user.TenantID).
+		Where("invitee_user_id = ? OR (invitee_user_id IS NULL AND invitee_email = ?)", user.ID, strings.ToLower(user.Email)).
+		First(&invitation).Error
+	if err != nil {
+		err := pkg.NewNotFoundError("Invitation not found", err)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	return &invitation, true
+}
+
+// findTeam 查找当前租户下的团队，未找到时写入错误响应
+func (tc *TeamController) findTeam(c *gin.Context, teamID, tenantID uint) (*models.Team, bool) {
+	var team models.Team
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", teamID, tenantID).First(&team).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			err := pkg.NewNotFoundError("Team not found", nil)
+			pkg.RespondError(c, err)
+		} else {
+			err := pkg.NewDatabaseError("Failed to query team", err)
+			pkg.RespondError(c, err)
+		}
+		return nil, false
+	}
+	return &team, true
+}
+
+// currentUser 加载当前登录用户，失败时写入错误响应
+func currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", c.GetUint("user_id"), c.GetUint("tenant_id")).First(&user).Error; err != nil {
+		err := pkg.NewUnauthorizedError("User not found", err)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	return &user, true
+}
@@ -0,0 +1,576 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/quota"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tenantSlugPattern 租户标识格式：小写字母、数字和连字符
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}[a-z0-9]$`)
+
+// TenantController 租户管理控制器
+type TenantController struct{}
+
+// platformDB 返回跳过租户隔离的数据库会话，仅用于平台级租户管理
+func platformDB(c *gin.Context) *gorm.DB {
+	return pkg.DB.WithContext(pkg.WithoutTenantScope(c.Request.Context()))
+}
+
+// isPlatformAdmin 判断当前用户是否为平台管理员
+func isPlatformAdmin(c *gin.Context) bool {
+	userID := c.GetUint("user_id")
+
+	var user models.User
+	if err := platformDB(c).Select("id", "username").First(&user, userID).Error; err == nil {
+		for _, admin := range config.Config.Tenant.PlatformAdmins {
+			if admin == user.Username {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requirePlatformAdmin 校验当前用户是否为平台管理员，不是则写入403响应并返回false
+func requirePlatformAdmin(c *gin.Context) bool {
+	if isPlatformAdmin(c) {
+		return true
+	}
+
+	err := pkg.NewForbiddenError("Only platform administrators can manage tenants", nil)
+	pkg.RespondError(c, err)
+	return false
+}
+
+// viewTenantID 返回查询的租户，默认为当前租户；平台管理员可以通过tenant_id查询参数查看其他租户
+// 参数无效或无权查看时写入错误响应并返回false
+func viewTenantID(c *gin.Context) (uint, bool) {
+	raw := c.Query("tenant_id")
+	if raw == "" {
+		return c.GetUint("tenant_id"), true
+	}
+	if !isPlatformAdmin(c) {
+		err := pkg.NewForbiddenError("Only platform administrators can view other tenants", nil)
+		pkg.RespondError(c, err)
+		return 0, false
+	}
+	tenantID, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		err := pkg.NewValidationError("Invalid tenant ID", err)
+		pkg.RespondError(c, err)
+		return 0, false
+	}
+	return uint(tenantID), true
+}
+
+// findTenant 按路径参数查找租户，未找到时写入404响应
+func findTenant(c *gin.Context) (*models.Tenant, bool) {
+	var tenant models.Tenant
+	if err := platformDB(c).First(&tenant, c.Param("id")).Error; err != nil {
+		err := pkg.NewNotFoundError("Tenant not found", err)
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+	return &tenant, true
+}
+
+// GetCurrentTenant 获取当前用户所属租户
+func (tc *TenantController) GetCurrentTenant(c *gin.Context) {
+	tenantID := c.GetUint("tenant_id")
+
+	var tenant models.Tenant
+	if err := platformDB(c).First(&tenant, tenantID).Error; err != nil {
+		// 引入租户表之前的历史租户没有记录，返回最小信息
+		c.JSON(http.StatusOK, gin.H{"id": tenantID, "status": models.TenantStatusActive})
+		return
+	}
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// GetTenants 获取租户列表（平台管理员）
+func (tc *TenantController) GetTenants(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	query := platformDB(c).Model(&models.Tenant{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var tenants []models.Tenant
+	if err := query.Order("id ASC").Find(&tenants).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch tenants", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tenants)
+}
+
+// GetTenant 获取单个租户（平台管理员）
+func (tc *TenantController) GetTenant(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+
+	var userCount int64
+	platformDB(c).Model(&models.User{}).Where("tenant_id = ?", tenant.ID).Count(&userCount)
+
+	c.JSON(http.StatusOK, gin.H{"tenant": tenant, "user_count": userCount})
+}
+
+// CreateTenant 创建租户（平台管理员）
+func (tc *TenantController) CreateTenant(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name" binding:"required,min=1,max=100"`
+		Slug        string `json:"slug" binding:"required"`
+		Description string `json:"description"`
+		AllowSignup bool   `json:"allow_signup"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid tenant data", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	if !tenantSlugPattern.MatchString(req.Slug) {
+		err := pkg.NewValidationFormatError("Tenant slug must be 3-64 lowercase letters, digits or hyphens", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 标识全局唯一，包括已删除的租户，避免新租户继承旧租户的外部引用
+	var existing models.Tenant
+	if err := platformDB(c).Unscoped().Where("slug = ?", req.Slug).First(&existing).Error; err == nil {
+		err := pkg.NewConflictError("Tenant slug already exists", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	tenant := models.Tenant{
+		Name:        req.Name,
+		Slug:        req.Slug,
+		Description: req.Description,
+		Status:      models.TenantStatusActive,
+		AllowSignup: req.AllowSignup,
+	}
+	if err := platformDB(c).Create(&tenant).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to create tenant", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "create",
+		ResourceType: "tenant",
+		ResourceID:   fmt.Sprintf("%d", tenant.ID),
+		NewValue:     tenant,
+	})
+
+	c.JSON(http.StatusCreated, tenant)
+}
+
+// UpdateTenant 更新租户信息（平台管理员）
+func (tc *TenantController) UpdateTenant(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+	oldTenant := *tenant
+
+	var req struct {
+		Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+		Description *string `json:"description"`
+		AllowSignup *bool   `json:"allow_signup"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid tenant data", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	if req.Name != nil {
+		tenant.Name = *req.Name
+	}
+	if req.Description != nil {
+		tenant.Description = *req.Description
+	}
+	if req.AllowSignup != nil {
+		tenant.AllowSignup = *req.AllowSignup
+	}
+
+	if err := platformDB(c).Save(tenant).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to update tenant", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "update",
+		ResourceType: "tenant",
+		ResourceID:   fmt.Sprintf("%d", tenant.ID),
+		OldValue:     oldTenant,
+		NewValue:     tenant,
+	})
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// SuspendTenant 暂停租户（平台管理员），暂停后租户成员无法登录和访问API
+func (tc *TenantController) SuspendTenant(c *gin.Context) {
+	tc.changeTenantStatus(c, models.TenantStatusSuspended, "suspend")
+}
+
+// ActivateTenant 恢复已暂停的租户（平台管理员）
+func (tc *TenantController) ActivateTenant(c *gin.Context) {
+	tc.changeTenantStatus(c, models.TenantStatusActive, "activate")
+}
+
+// changeTenantStatus 切换租户状态
+func (tc *TenantController) changeTenantStatus(c *gin.Context, status, action string) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+
+	if tenant.Status == status {
+		c.JSON(http.StatusOK, tenant)
+		return
+	}
+	oldStatus := tenant.Status
+
+	tenant.Status = status
+	if status == models.TenantStatusSuspended {
+		now := time.Now()
+		tenant.SuspendedAt = &now
+	} else {
+		tenant.SuspendedAt = nil
+	}
+
+	if err := platformDB(c).Save(tenant).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to update tenant status", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	pkg.InvalidateTenantStatus(tenant.ID)
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       action,
+		ResourceType: "tenant",
+		ResourceID:   fmt.Sprintf("%d", tenant.ID),
+		OldValue:     gin.H{"status": oldStatus},
+		NewValue:     gin.H{"status": status},
+	})
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// DeleteTenant 删除租户（平台管理员）
+// 租户记录软删除，租户数据保留以便审计和恢复，成员立即失去访问权限
+func (tc *TenantController) DeleteTenant(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+
+	// 不允许删除当前操作者所在的租户，避免管理员把自己锁在系统外
+	if tenant.ID == c.GetUint("tenant_id") {
+		err := pkg.NewBadRequestError("Cannot delete the tenant you belong to", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	err := platformDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(tenant).Update("status", models.TenantStatusDeleted).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tenant).Error
+	})
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to delete tenant", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	pkg.InvalidateTenantStatus(tenant.ID)
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "delete",
+		ResourceType: "tenant",
+		ResourceID:   fmt.Sprintf("%d", tenant.ID),
+		OldValue:     tenant,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tenant deleted successfully"})
+}
+
+// GetTenantQuota 获取租户配额配置（平台管理员）
+func (tc *TenantController) GetTenantQuota(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+
+	var override models.TenantQuota
+	if err := platformDB(c).Where("tenant_id = ?", tenant.ID).First(&override).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		err := pkg.NewDatabaseError("Failed to fetch tenant quota", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	override.TenantID = tenant.ID
+
+	limits, err := quota.GetLimits(c.Request.Context(), tenant.ID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch tenant quota", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	usage, err := quota.GetUsage(c.Request.Context(), tenant.ID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch tenant usage", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"override": override, "effective": limits, "usage": usage})
+}
+
+// UpdateTenantQuota 设置租户配额（平台管理员）
+// 字段为null表示使用全局默认值，0表示不限制
+func (tc *TenantController) UpdateTenantQuota(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MaxUsers                  *int64 `json:"max_users"`
+		MaxTeams                  *int64 `json:"max_teams"`
+		MaxTools                  *int64 `json:"max_tools"`
+		MaxNotes                  *int64 `json:"max_notes"`
+		MaxPluginExecutionsPerDay *int64 `json:"max_plugin_executions_per_day"`
+		MaxLLMTokensPerMonth      *int64 `json:"max_llm_tokens_per_month"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid quota data", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	for _, v := range []*int64{req.MaxUsers, req.MaxTeams, req.MaxTools, req.MaxNotes, req.MaxPluginExecutionsPerDay, req.MaxLLMTokensPerMonth} {
+		if v != nil && *v < 0 {
+			err := pkg.NewValidationError("Quota limits cannot be negative", nil)
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+
+	var override models.TenantQuota
+	err := platformDB(c).Where("tenant_id = ?", tenant.ID).First(&override).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		err := pkg.NewDatabaseError("Failed to fetch tenant quota", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	oldOverride := override
+
+	override.TenantID = tenant.ID
+	override.MaxUsers = req.MaxUsers
+	override.MaxTeams = req.MaxTeams
+	override.MaxTools = req.MaxTools
+	override.MaxNotes = req.MaxNotes
+	override.MaxPluginExecutionsPerDay = req.MaxPluginExecutionsPerDay
+	override.MaxLLMTokensPerMonth = req.MaxLLMTokensPerMonth
+
+	if err := platformDB(c).Save(&override).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to update tenant quota", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "update_quota",
+		ResourceType: "tenant",
+		ResourceID:   fmt.Sprintf("%d", tenant.ID),
+		OldValue:     oldOverride,
+		NewValue:     override,
+	})
+
+	c.JSON(http.StatusOK, override)
+}
+
+// GetTenantLLMConfig 获取租户的LLM模型配置及各任务生效的模型（平台管理员）
+func (tc *TenantController) GetTenantLLMConfig(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+
+	override, err := llmprovider.TenantConfig(c.Request.Context(), tenant.ID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch tenant LLM config", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	if override == nil {
+		override = &models.TenantLLMConfig{TenantID: tenant.ID, Routes: map[string]string{}}
+	}
+
+	registry, err := llmprovider.FromConfig()
+	if err != nil {
+		err := pkg.NewInternalError("Invalid LLM configuration", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 列出内置任务以及全局和租户路由规则中出现的任务
+	tasks := map[string]bool{llmprovider.TaskChat: true, llmprovider.TaskRAG: true}
+	for task := range config.Config.LLM.Routes {
+		tasks[task] = true
+	}
+	for task := range override.Routes {
+		tasks[task] = true
+	}
+	effective := make(map[string][]llmprovider.Target, len(tasks))
+	for task := range tasks {
+		targets, err := registry.Plan(c.Request.Context(), tenant.ID, task, "")
+		if err != nil {
+			err := pkg.NewInternalError("Failed to resolve tenant LLM models", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		effective[task] = targets
+	}
+
+	c.JSON(http.StatusOK, gin.H{"override": override, "effective": effective, "aliases": registry.Aliases()})
+}
+
+// UpdateTenantLLMConfig 设置租户的默认模型、备用模型和按任务的路由规则（平台管理员）
+// 模型必须能按全局配置解析，字段为空表示使用全局配置
+func (tc *TenantController) UpdateTenantLLMConfig(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	tenant, ok := findTenant(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DefaultModel  string            `json:"default_model" binding:"max=255"`
+		FallbackModel string            `json:"fallback_model" binding:"max=255"`
+		Routes        map[string]string `json:"routes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		err := pkg.NewValidationError("Invalid LLM config", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	registry, err := llmprovider.FromConfig()
+	if err != nil {
+		err := pkg.NewInternalError("Invalid LLM configuration", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	// 默认和备用模型可以为空，路由规则中的模型不能为空
+	refs := map[string]string{}
+	if req.DefaultModel != "" {
+		refs["default_model"] = req.DefaultModel
+	}
+	if req.FallbackModel != "" {
+		refs["fallback_model"] = req.FallbackModel
+	}
+	for task, ref := range req.Routes {
+		refs["routes."+task] = ref
+	}
+	for field, ref := range refs {
+		if _, err := registry.Resolve(ref); err != nil {
+			err := pkg.NewValidationError("Unknown model", err).WithDetails(gin.H{"field": field, "model": ref})
+			pkg.RespondError(c, err)
+			return
+		}
+	}
+
+	var override models.TenantLLMConfig
+	err = platformDB(c).Where("tenant_id = ?", tenant.ID).First(&override).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		err := pkg.NewDatabaseError("Failed to fetch tenant LLM config", err)
+		pkg.RespondError(c, err)
+		return
+	}
+	oldOverride := override
+
+	override.TenantID = tenant.ID
+	override.DefaultModel = req.DefaultModel
+	override.FallbackModel = req.FallbackModel
+	override.Routes = req.Routes
+	if override.Routes == nil {
+		override.Routes = map[string]string{}
+	}
+	override.UpdatedBy = c.GetUint("user_id")
+
+	if err := platformDB(c).Save(&override).Error; err != nil {
+		err := pkg.NewDatabaseError("Failed to update tenant LLM config", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "update_llm_config",
+		ResourceType: "tenant",
+		ResourceID:   fmt.Sprintf("%d", tenant.ID),
+		OldValue:     oldOverride,
+		NewValue:     override,
+	})
+
+	c.JSON(http.StatusOK, override)
+}
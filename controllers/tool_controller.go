@@ -2,27 +2,60 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
 	"weave/models"
 	"weave/pkg"
+	"weave/pkg/quota"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ToolController 工具控制器
 type ToolController struct{}
 
 // GetTools 获取所有工具
+// 限定团队范围的工具只返回给该团队子树内的成员，以及被共享的用户和团队
 func (tc *ToolController) GetTools(c *gin.Context) {
 	tenantID := c.GetUint("tenant_id")
-	var tools []models.Tool
-	result := pkg.DB.Where("tenant_id = ?", tenantID).Find(&tools)
-	if result.Error != nil {
-		err := pkg.NewDatabaseError("Failed to fetch tools", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	userID := c.GetUint("user_id")
+	visibleTools, err := pkg.VisibleTools(pkg.TenantDB(c), tenantID, userID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch tools", err)
+		pkg.RespondError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, tools)
+	c.JSON(http.StatusOK, visibleTools)
+}
+
+// requireToolLevel 校验当前用户对工具的权限级别（团队范围、所有者和共享），不满足时写入错误响应
+func requireToolLevel(c *gin.Context, tool *models.Tool, level string) bool {
+	current, err := pkg.ToolAccessLevel(pkg.TenantDB(c), tool, c.GetUint("user_id"))
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to check tool access", err)
+		pkg.RespondError(c, err)
+		return false
+	}
+	if !pkg.HasShareLevel(current, level) {
+		message := "Tool is restricted to another team"
+		if current != "" {
+			message = "Insufficient permission on this tool"
+		}
+		err := pkg.NewForbiddenError(message, nil)
+		pkg.RespondError(c, err)
+		return false
+	}
+	return true
+}
+
+// requireToolTeamAdmin 将工具限定到团队子树时，要求当前用户是该团队的管理员
+func requireToolTeamAdmin(c *gin.Context, teamID *uint) bool {
+	if teamID == nil {
+		return true
+	}
+	_, ok := requireEffectiveTeamRole(c, *teamID, "admin", "Only team admins can scope tools to the team")
+	return ok
 }
 
 // GetTool 获取单个工具
@@ -31,10 +64,13 @@ func (tc *ToolController) GetTool(c *gin.Context) {
 	tenantID := c.GetUint("tenant_id")
 
 	var tool models.Tool
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&tool)
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).First(&tool)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("Tool not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+	if !requireToolLevel(c, &tool, models.ShareLevelRead) {
 		return
 	}
 
@@ -46,19 +82,35 @@ func (tc *ToolController) CreateTool(c *gin.Context) {
 	var tool models.Tool
 	if err := c.ShouldBindJSON(&tool); err != nil {
 		err := pkg.NewValidationError("Invalid tool data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	tool.TenantID = c.GetUint("tenant_id")
+	tool.OwnerID = c.GetUint("user_id")
+
+	if !requireToolTeamAdmin(c, tool.TeamID) {
+		return
+	}
+
+	if !enforceResourceQuota(c, tool.TenantID, quota.ResourceTools) {
+		return
+	}
 
-	result := pkg.DB.Create(&tool)
+	result := pkg.TenantDB(c).Create(&tool)
 	if result.Error != nil {
 		err := pkg.NewDatabaseError("Failed to create tool", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "create",
+		ResourceType: "tool",
+		ResourceID:   strconv.FormatUint(uint64(tool.ID), 10),
+		NewValue:     tool,
+	})
+
 	c.JSON(http.StatusCreated, tool)
 }
 
@@ -68,30 +120,49 @@ func (tc *ToolController) UpdateTool(c *gin.Context) {
 	tenantID := c.GetUint("tenant_id")
 
 	var oldTool models.Tool
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&oldTool)
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).First(&oldTool)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("Tool not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+	if !requireToolLevel(c, &oldTool, models.ShareLevelWrite) {
 		return
 	}
 
 	var newTool models.Tool
 	if err := c.ShouldBindJSON(&newTool); err != nil {
 		err := pkg.NewValidationError("Invalid tool data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	newTool.ID = oldTool.ID
 	newTool.TenantID = tenantID
+	newTool.OwnerID = oldTool.OwnerID
+
+	// 变更团队范围需要同时是原团队和新团队的管理员
+	if !sameTeamScope(oldTool.TeamID, newTool.TeamID) {
+		if !requireToolTeamAdmin(c, oldTool.TeamID) || !requireToolTeamAdmin(c, newTool.TeamID) {
+			return
+		}
+	}
 
-	result = pkg.DB.Save(&newTool)
+	result = pkg.TenantDB(c).Save(&newTool)
 	if result.Error != nil {
 		err := pkg.NewDatabaseError("Failed to update tool", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "update",
+		ResourceType: "tool",
+		ResourceID:   strconv.FormatUint(uint64(oldTool.ID), 10),
+		OldValue:     oldTool,
+		NewValue:     newTool,
+	})
+
 	c.JSON(http.StatusOK, newTool)
 }
 
@@ -101,20 +172,36 @@ func (tc *ToolController) DeleteTool(c *gin.Context) {
 	tenantID := c.GetUint("tenant_id")
 
 	var tool models.Tool
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&tool)
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).First(&tool)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("Tool not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+	if !requireToolLevel(c, &tool, models.ShareLevelAdmin) {
 		return
 	}
 
-	result = pkg.DB.Delete(&tool)
-	if result.Error != nil {
-		err := pkg.NewDatabaseError("Failed to delete tool", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+	// 工具与其共享记录一起删除
+	err := pkg.TenantDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&tool).Error; err != nil {
+			return err
+		}
+		return pkg.DeleteResourceShares(tx, tenantID, models.ShareResourceTool, strconv.FormatUint(uint64(tool.ID), 10))
+	})
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to delete tool", err)
+		pkg.RespondError(c, err)
 		return
 	}
 
+	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
+		Action:       "delete",
+		ResourceType: "tool",
+		ResourceID:   strconv.FormatUint(uint64(tool.ID), 10),
+		OldValue:     tool,
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Tool deleted successfully"})
 }
 
@@ -124,13 +211,25 @@ func (tc *ToolController) ExecuteTool(c *gin.Context) {
 	tenantID := c.GetUint("tenant_id")
 
 	var tool models.Tool
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&tool)
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).First(&tool)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("Tool not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+
+	if !requireToolLevel(c, &tool, models.ShareLevelRead) {
 		return
 	}
 
 	// 执行逻辑保持不变
 	c.JSON(http.StatusOK, gin.H{"message": "Tool execution started", "tool": tool})
 }
+
+// sameTeamScope 判断两个团队范围是否相同
+func sameTeamScope(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
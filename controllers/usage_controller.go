@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"weave/config"
+	"weave/pkg"
+	"weave/pkg/llmusage"
+	"weave/pkg/quota"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxUsageRangeDays 用量查询允许的最大日期跨度
+const maxUsageRangeDays = 366
+
+// UsageController 租户用量控制器
+type UsageController struct{}
+
+// enforceResourceQuota 创建资源前校验租户配额，超限时写入403响应并返回false
+// 配额查询本身失败时放行，避免数据库抖动影响正常业务
+func enforceResourceQuota(c *gin.Context, tenantID uint, resource string) bool {
+	err := quota.CheckResource(c.Request.Context(), tenantID, resource)
+	if err == nil {
+		return true
+	}
+
+	var appErr *pkg.AppError
+	if pkg.IsQuotaExceeded(err) && errors.As(err, &appErr) {
+		pkg.RespondError(c, appErr)
+		return false
+	}
+
+	pkg.Warn("Quota check failed", zap.String("resource", resource), zap.Uint("tenant_id", tenantID), zap.Error(err))
+	return true
+}
+
+// GetUsage 获取当前租户的配额与用量
+func (uc *UsageController) GetUsage(c *gin.Context) {
+	tenantID := c.GetUint("tenant_id")
+
+	limits, err := quota.GetLimits(c.Request.Context(), tenantID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch quota", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	usage, err := quota.GetUsage(c.Request.Context(), tenantID)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch usage", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant_id": tenantID,
+		"limits":    limits,
+		"usage":     usage,
+	})
+}
+
+// GetDailyUsage 获取当前租户的每日用量汇总
+// 支持参数：metric（plugin_executions/llm_tokens）、from、to（YYYY-MM-DD，默认最近30天）
+func (uc *UsageController) GetDailyUsage(c *gin.Context) {
+	tenantID := c.GetUint("tenant_id")
+
+	from, to, ok := parseUsageRange(c)
+	if !ok {
+		return
+	}
+
+	metric := c.Query("metric")
+	if metric != "" && metric != quota.MetricPluginExecutions && metric != quota.MetricLLMTokens {
+		err := pkg.NewValidationError("Unknown usage metric", nil)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	rollups, err := quota.GetDailyRollups(c.Request.Context(), tenantID, metric, from, to)
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch daily usage", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"from":  from.Format("2006-01-02"),
+		"to":    to.Format("2006-01-02"),
+		"daily": rollups,
+	}
+	// 指定指标时附带按资源（插件名、模型名）的分布
+	if metric != "" {
+		breakdown, err := quota.GetResourceBreakdown(c.Request.Context(), tenantID, metric, from, to)
+		if err != nil {
+			err := pkg.NewDatabaseError("Failed to fetch usage breakdown", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		response["by_resource"] = breakdown
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetLLMUsage 获取租户的模型令牌用量和费用报表
+// 支持参数：group_by（model/user/source/day，默认model）、user_id、from、to（YYYY-MM-DD，默认最近30天），
+// 平台管理员可以通过tenant_id查看其他租户
+func (uc *UsageController) GetLLMUsage(c *gin.Context) {
+	tenantID, ok := viewTenantID(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseUsageRange(c)
+	if !ok {
+		return
+	}
+
+	query := llmusage.ReportQuery{TenantID: tenantID, From: from, To: to, GroupBy: c.DefaultQuery("group_by", llmusage.GroupByModel)}
+	if v := c.Query("user_id"); v != "" {
+		userID, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			err := pkg.NewValidationError("Invalid user ID", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		query.UserID = uint(userID)
+	}
+
+	report, err := llmusage.GetReport(c.Request.Context(), query)
+	if errors.Is(err, llmusage.ErrInvalidGroup) {
+		err := pkg.NewValidationError("Unknown usage grouping", err).WithDetails(gin.H{"group_by": query.GroupBy})
+		pkg.RespondError(c, err)
+		return
+	}
+	if err != nil {
+		err := pkg.NewDatabaseError("Failed to fetch LLM usage", err)
+		pkg.RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant_id": tenantID,
+		"from":      from.Format("2006-01-02"),
+		"to":        to.Format("2006-01-02"),
+		"report":    report,
+	})
+}
+
+// GetLLMPrices 获取用于计算费用的模型令牌单价，单价按每百万令牌计
+func (uc *UsageController) GetLLMPrices(c *gin.Context) {
+	prices := config.Config.LLM.Prices
+	if prices == nil {
+		prices = map[string]config.LLMPrice{}
+	}
+	c.JSON(http.StatusOK, gin.H{"currency": config.Config.LLM.Currency, "unit": "1M tokens", "prices": prices})
+}
+
+// parseUsageRange 解析用量查询的日期范围，参数无效时写入400响应并返回false
+func parseUsageRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	to := now
+	from := now.AddDate(0, 0, -29)
+
+	if v := c.Query("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			err := pkg.NewValidationFormatError("Invalid from date, expected YYYY-MM-DD", err)
+			pkg.RespondError(c, err)
+			return from, to, false
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			err := pkg.NewValidationFormatError("Invalid to date, expected YYYY-MM-DD", err)
+			pkg.RespondError(c, err)
+			return from, to, false
+		}
+		to = t
+	}
+
+	if to.Before(from) || to.Sub(from) > maxUsageRangeDays*24*time.Hour {
+		err := pkg.NewValidationError(fmt.Sprintf("Date range must be within %d days", maxUsageRangeDays), nil)
+		pkg.RespondError(c, err)
+		return from, to, false
+	}
+	return from, to, true
+}
@@ -9,6 +9,7 @@ import (
 
 	"weave/models"
 	"weave/pkg"
+	"weave/pkg/quota"
 	"weave/utils"
 
 	"github.com/gin-gonic/gin"
@@ -25,19 +26,20 @@ func (uc *UserController) Register(c *gin.Context) {
 		Password        string `json:"password" binding:"required,min=6"`
 		ConfirmPassword string `json:"confirm_password" binding:"required,min=6"`
 		Email           string `json:"email" binding:"required,email"`
+		Tenant          string `json:"tenant"` // 可选，租户标识（slug），为空时注册到默认租户
 	}
 
 	// 绑定JSON请求体
 	if err := c.ShouldBindJSON(&registerRequest); err != nil {
 		err := pkg.NewValidationError("Invalid registration data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 检查两次输入的密码是否一致
 	if registerRequest.Password != registerRequest.ConfirmPassword {
 		err := pkg.NewValidationError("Passwords do not match", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -46,7 +48,7 @@ func (uc *UserController) Register(c *gin.Context) {
 	result := pkg.DB.Where("username = ?", registerRequest.Username).First(&existingUser)
 	if result.Error == nil {
 		err := pkg.NewConflictError("Username already exists", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -54,7 +56,33 @@ func (uc *UserController) Register(c *gin.Context) {
 	result = pkg.DB.Where("email = ?", registerRequest.Email).First(&existingUser)
 	if result.Error == nil {
 		err := pkg.NewConflictError("Email already registered", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 确定注册的目标租户，只允许注册到开放自助注册的正常租户
+	tenantID := models.DefaultTenantID
+	if registerRequest.Tenant != "" {
+		var tenant models.Tenant
+		if err := pkg.DB.Where("slug = ?", registerRequest.Tenant).First(&tenant).Error; err != nil {
+			err := pkg.NewNotFoundError("Tenant not found", err)
+			pkg.RespondError(c, err)
+			return
+		}
+		if !tenant.IsActive() {
+			err := pkg.NewTenantSuspendedError("Tenant is not active", nil)
+			pkg.RespondError(c, err)
+			return
+		}
+		if !tenant.AllowSignup {
+			err := pkg.NewForbiddenError("Tenant does not allow self registration", nil)
+			pkg.RespondError(c, err)
+			return
+		}
+		tenantID = tenant.ID
+	}
+
+	if !enforceResourceQuota(c, tenantID, quota.ResourceUsers) {
 		return
 	}
 
@@ -62,7 +90,7 @@ func (uc *UserController) Register(c *gin.Context) {
 	passwordHash, err := utils.HashPassword(registerRequest.Password)
 	if err != nil {
 		err := pkg.NewInternalError("Failed to encrypt password", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -71,6 +99,7 @@ func (uc *UserController) Register(c *gin.Context) {
 		Username: registerRequest.Username,
 		Password: passwordHash,
 		Email:    registerRequest.Email,
+		TenantID: tenantID,
 	}
 
 	result = pkg.DB.Create(&newUser)
@@ -80,7 +109,7 @@ func (uc *UserController) Register(c *gin.Context) {
 			"username": registerRequest.Username,
 			"email":    registerRequest.Email,
 		})
-		c.JSON(pkg.GetHTTPStatus(dbErr), gin.H{"code": string(dbErr.Code), "message": dbErr.Message})
+		pkg.RespondError(c, dbErr)
 		return
 	}
 
@@ -102,7 +131,7 @@ func (uc *UserController) Login(c *gin.Context) {
 		// 记录绑定失败的登录尝试
 		recordLoginHistory(loginRequest.Username, c.ClientIP(), c.Request.UserAgent(), false, "请求参数验证失败: "+err.Error(), 0)
 		err := pkg.NewValidationError("Missing required login fields", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -113,7 +142,7 @@ func (uc *UserController) Login(c *gin.Context) {
 		// 记录用户不存在的登录尝试
 		recordLoginHistory(loginRequest.Username, c.ClientIP(), c.Request.UserAgent(), false, "用户名或密码错误", 0)
 		err := pkg.NewAuthError("Invalid username or password", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -122,7 +151,15 @@ func (uc *UserController) Login(c *gin.Context) {
 		// 记录密码错误的登录尝试
 		recordLoginHistory(loginRequest.Username, c.ClientIP(), c.Request.UserAgent(), false, "用户名或密码错误", user.TenantID)
 		err := pkg.NewAuthError("Invalid username or password", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 检查用户所属租户是否可用
+	if err := pkg.CheckTenantActive(c.Request.Context(), user.TenantID); err != nil {
+		recordLoginHistory(loginRequest.Username, c.ClientIP(), c.Request.UserAgent(), false, "租户已暂停或已删除", user.TenantID)
+		err := pkg.NewTenantSuspendedError("Tenant is suspended or deleted", nil)
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -132,7 +169,7 @@ func (uc *UserController) Login(c *gin.Context) {
 		// 记录生成token失败的情况
 		recordLoginHistory(loginRequest.Username, c.ClientIP(), c.Request.UserAgent(), false, "生成访问令牌失败: "+err.Error(), user.TenantID)
 		err := pkg.NewInternalError("Failed to generate access token", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -141,7 +178,7 @@ func (uc *UserController) Login(c *gin.Context) {
 		// 记录生成刷新令牌失败的情况
 		recordLoginHistory(loginRequest.Username, c.ClientIP(), c.Request.UserAgent(), false, "生成刷新令牌失败: "+err.Error(), user.TenantID)
 		err := pkg.NewInternalError("Failed to generate refresh token", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -178,7 +215,7 @@ func (uc *UserController) RefreshToken(c *gin.Context) {
 	// 绑定JSON请求体
 	if err := c.ShouldBindJSON(&refreshRequest); err != nil {
 		err := pkg.NewValidationError("Refresh token is required", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -186,7 +223,7 @@ func (uc *UserController) RefreshToken(c *gin.Context) {
 	userID, tenantID, err := utils.VerifyRefreshToken(refreshRequest.RefreshToken)
 	if err != nil {
 		err := pkg.NewAuthError("Invalid refresh token", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -195,7 +232,14 @@ func (uc *UserController) RefreshToken(c *gin.Context) {
 	result := pkg.DB.First(&user, userID)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("User not found", nil)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
+		return
+	}
+
+	// 租户暂停后不再续发令牌
+	if err := pkg.CheckTenantActive(c.Request.Context(), tenantID); err != nil {
+		err := pkg.NewTenantSuspendedError("Tenant is suspended or deleted", nil)
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -203,7 +247,7 @@ func (uc *UserController) RefreshToken(c *gin.Context) {
 	accessToken, err := utils.GenerateToken(userID, tenantID)
 	if err != nil {
 		err := pkg.NewInternalError("Failed to generate access token", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -211,7 +255,7 @@ func (uc *UserController) RefreshToken(c *gin.Context) {
 	refreshToken, err := utils.GenerateRefreshToken(userID, tenantID)
 	if err != nil {
 		err := pkg.NewInternalError("Failed to generate refresh token", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -246,10 +290,10 @@ func (uc *UserController) GetUsers(c *gin.Context) {
 	var users []models.User
 	tenantID := c.GetUint("tenant_id")
 	// 根据需要预加载关联数据，避免N+1查询问题
-	result := pkg.DB.Where("tenant_id = ?", tenantID).Find(&users)
+	result := pkg.TenantDB(c).Where("tenant_id = ?", tenantID).Find(&users)
 	if result.Error != nil {
 		err := pkg.NewDatabaseError("Failed to fetch users", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -263,14 +307,14 @@ func (uc *UserController) GetUser(c *gin.Context) {
 
 	var user models.User
 	// 根据API需求预加载关联数据，这里根据常见使用场景选择预加载审计日志
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).
 		Preload("AuditLogs", func(db *gorm.DB) *gorm.DB {
 			// 只预加载最近30天的审计日志
 			return db.Where("created_at > ?", time.Now().AddDate(0, 0, -30)).Order("created_at DESC").Limit(100)
 		}).First(&user)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("User not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -282,21 +326,25 @@ func (uc *UserController) CreateUser(c *gin.Context) {
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
 		err := pkg.NewValidationError("Invalid user data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 绑定租户ID，防止跨租户创建
 	user.TenantID = c.GetUint("tenant_id")
 
+	if !enforceResourceQuota(c, user.TenantID, quota.ResourceUsers) {
+		return
+	}
+
 	// 创建用户前先记录审计日志（不包含密码）
 	logUser := user
 	logUser.Password = "[REDACTED]"
 
-	result := pkg.DB.Create(&user)
+	result := pkg.TenantDB(c).Create(&user)
 	if result.Error != nil {
 		err := pkg.NewDatabaseError("Failed to create user", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -321,22 +369,21 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 
 	// 获取原始用户信息
 	var oldUser models.User
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&oldUser)
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).First(&oldUser)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("User not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
-	// 记录原始值（不包含密码）
+	// 记录原始值，密码由审计日志统一脱敏，差异中只标记密码是否被修改
 	auditOldUser := oldUser
-	auditOldUser.Password = "[REDACTED]"
 
 	// 绑定新的用户信息
 	var newUser models.User
 	if err := c.ShouldBindJSON(&newUser); err != nil {
 		err := pkg.NewValidationError("Invalid user data", err)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -349,16 +396,15 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		newUser.Password = oldUser.Password
 	}
 
-	result = pkg.DB.Save(&newUser)
+	result = pkg.TenantDB(c).Save(&newUser)
 	if result.Error != nil {
 		err := pkg.NewDatabaseError("Failed to update user", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
 	// 记录更新用户的审计日志
 	auditNewUser := newUser
-	auditNewUser.Password = "[REDACTED]"
 	_ = pkg.AuditLogFromContext(c, pkg.AuditLogOptions{
 		Action:       "update",
 		ResourceType: "user",
@@ -379,10 +425,10 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 
 	// 先获取要删除的用户信息，用于审计日志
 	var user models.User
-	result := pkg.DB.Where("id = ? AND tenant_id = ?", id, tenantID).First(&user)
+	result := pkg.TenantDB(c).Where("id = ? AND tenant_id = ?", id, tenantID).First(&user)
 	if result.Error != nil {
 		err := pkg.NewNotFoundError("User not found", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -391,10 +437,10 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 	auditUser.Password = "[REDACTED]"
 
 	// 执行删除操作
-	result = pkg.DB.Delete(&user)
+	result = pkg.TenantDB(c).Delete(&user)
 	if result.Error != nil {
 		err := pkg.NewDatabaseError("Failed to delete user", result.Error)
-		c.JSON(pkg.GetHTTPStatus(err), gin.H{"code": string(err.Code), "message": err.Message})
+		pkg.RespondError(c, err)
 		return
 	}
 
@@ -16,6 +16,10 @@ import (
 	"weave/middleware"
 	"weave/models"
 	"weave/pkg"
+	"weave/pkg/anomaly"
+	"weave/pkg/auditsink"
+	"weave/pkg/retention"
+	"weave/pkg/events"
 	"weave/pkg/migrate/migration"
 	"weave/plugins"
 	"weave/plugins/examples"
@@ -23,6 +27,9 @@ import (
 	note "weave/plugins/features/Note"
 	"weave/routers"
 	"weave/services/llm"
+	"weave/services/rag/eino/rag"
+	"weave/services/rag/ragplugin"
+	"weave/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -96,6 +103,7 @@ func main() {
 
 	// 设置PluginManager的日志记录器
 	plugins.PluginManager.SetLogger(pkg.GetLogger())
+	events.Default().SetLogger(pkg.GetLogger().Logger)
 
 	// 加载配置
 	if err := config.LoadConfig(); err != nil {
@@ -111,6 +119,11 @@ func main() {
 	}
 	pkg.Info("Configuration validation passed successfully")
 
+	// 初始化JWT签名密钥环（RS256/EdDSA）并启动定期轮换
+	if err := utils.InitKeyRing(); err != nil {
+		pkg.Fatal("Failed to initialize JWT key ring", zap.Error(err))
+	}
+
 	// 监控指标将在路由设置中初始化
 
 	// 初始化数据库
@@ -143,6 +156,28 @@ func main() {
 		}
 	}
 
+	// 启动审计日志写入管道
+	pkg.StartAuditPipeline()
+
+	// 启动过期团队邀请清理任务
+	pkg.StartInvitationCleanup()
+
+	// 启动审计日志签名检查点任务
+	pkg.StartAuditCheckpointer()
+
+	// 启动审计日志外部转发
+	if err := auditsink.StartForwarder(); err != nil {
+		pkg.Error("Failed to start audit log forwarding", zap.Error(err))
+	}
+
+	// 启动数据保留与归档任务
+	if err := retention.Start(); err != nil {
+		pkg.Error("Failed to start retention job", zap.Error(err))
+	}
+
+	// 启动安全异常检测
+	anomaly.Start()
+
 	// 初始化路由
 	router := routers.SetupRouter()
 
@@ -196,6 +231,21 @@ func main() {
 	// 停止插件监控器
 	plugins.PluginManager.StopPluginWatcher()
 
+	// 停止JWT密钥轮换
+	utils.StopKeyRing()
+
+	// 停止过期邀请清理任务
+	pkg.StopInvitationCleanup()
+
+	// 停止审计日志签名检查点任务
+	pkg.StopAuditCheckpointer()
+
+	// 停止数据保留任务
+	retention.Stop()
+
+	// 停止安全异常检测
+	anomaly.Stop()
+
 	// 创建超时上下文，用于优雅关闭服务器和数据库
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -204,6 +254,14 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		pkg.Fatal("Server forced to shutdown", zap.Error(err))
 	}
+
+	// 服务器停止接收请求后写入队列中剩余的审计日志，数据库不可用时落盘
+	if err := pkg.StopAuditPipeline(ctx); err != nil {
+		pkg.Error("Audit pipeline shutdown error", zap.Error(err))
+	}
+
+	// 停止审计日志外部转发，未发送的记录在下次启动时从游标处继续
+	auditsink.StopForwarder()
 	
 	// 然后使用相同上下文优雅关闭数据库连接
 	// 确保数据库连接在服务器停止接收新请求后有足够时间完成正在进行的操作
@@ -251,6 +309,14 @@ func registerPlugins(router *gin.Engine) {
 		pkg.Info("Successfully registered plugin", zap.String("plugin", llmChatPlugin.Name()))
 	}
 
+	// 注册RAG插件，知识库问答引擎在插件初始化时创建
+	ragPlugin := ragplugin.NewRAGPlugin(rag.NewEngine)
+	if err := plugins.PluginManager.Register(ragPlugin); err != nil {
+		pkg.Error("Failed to register plugin", zap.String("plugin", ragPlugin.Name()), zap.Error(err))
+	} else {
+		pkg.Info("Successfully registered plugin", zap.String("plugin", ragPlugin.Name()))
+	}
+
 	// 统一注册所有插件路由（可选）
 	// if err := plugins.PluginManager.RegisterAllRoutes(); err != nil {
 	// 	pkg.Error("Failed to register all plugin routes", zap.Error(err))
@@ -1,8 +1,8 @@
 package middleware
 
 import (
-	"net/http"
 	"strings"
+	"weave/pkg"
 	"weave/utils"
 
 	"github.com/gin-gonic/gin"
@@ -14,16 +14,14 @@ func AuthMiddleware() gin.HandlerFunc {
 		// 获取Authorization头
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+			pkg.AbortWithError(c, pkg.NewUnauthorized("Authorization header is required", nil))
 			return
 		}
 
 		// 检查token格式
 		parts := strings.SplitN(authHeader, " ", 2)
 		if !(len(parts) == 2 && parts[0] == "Bearer") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
-			c.Abort()
+			pkg.AbortWithError(c, pkg.NewUnauthorized("Authorization header format must be Bearer {token}", nil))
 			return
 		}
 
@@ -31,8 +29,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString := parts[1]
 		userID, _, tenantID, err := utils.VerifyToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			pkg.AbortWithError(c, pkg.NewAuthInvalidTokenError("Invalid or expired token", err))
+			return
+		}
+
+		// 已暂停或删除的租户不允许继续访问
+		if err := pkg.CheckTenantActive(c.Request.Context(), tenantID); err != nil {
+			pkg.AbortWithError(c, pkg.NewTenantSuspendedError("Tenant is suspended or deleted", err))
 			return
 		}
 
@@ -43,6 +46,9 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Set("userID", userID)
 		c.Set("tenantID", tenantID)
 
+		// 将租户写入请求上下文，数据库操作据此自动进行租户隔离
+		c.Request = c.Request.WithContext(pkg.WithTenantID(c.Request.Context(), tenantID))
+
 		// 继续处理请求
 		c.Next()
 	}
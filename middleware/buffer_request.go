@@ -5,6 +5,8 @@ import (
 	"io"
 	"net/http"
 
+	"weave/pkg"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,20 +21,14 @@ func RequestBufferMiddleware() gin.HandlerFunc {
 			const maxBodySize = 10 * 1024 * 1024 // 10MB，可根据需求调整
 
 			if contentLength > maxBodySize {
-				c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-					"error": "Request body too large",
-				})
-				c.Abort()
+				pkg.AbortWithError(c, pkg.NewPayloadTooLarge("Request body too large", nil))
 				return
 			}
 
 			// 读取整个请求体
 			body, err := io.ReadAll(c.Request.Body)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Failed to read request body",
-				})
-				c.Abort()
+				pkg.AbortWithError(c, pkg.NewBadRequest("Failed to read request body", err))
 				return
 			}
 
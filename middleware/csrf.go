@@ -3,7 +3,6 @@ package middleware
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"net/http"
 
 	"weave/config"
 	"weave/pkg"
@@ -32,7 +31,7 @@ func CSRFMiddleware() gin.HandlerFunc {
 		// 验证CSRF令牌
 		if !validateCSRFToken(c) {
 			pkg.Error("CSRF token validation failed", zap.String("path", c.Request.URL.Path))
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "CSRF token validation failed"})
+			pkg.AbortWithError(c, pkg.NewForbidden("CSRF token validation failed", nil))
 			return
 		}
 
@@ -24,36 +24,24 @@ func (eh *ErrorHandler) HandlerFunc() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 记录请求开始时间
 		reqStart := time.Now()
-		requestID := c.GetString("X-Request-ID")
-		if requestID == "" {
-			requestID = generateRequestID()
-			c.Set("X-Request-ID", requestID)
-		}
+		requestID := pkg.RequestID(c)
 
 		// 处理请求
 		c.Next()
 
 		// 检查是否有错误
 		if len(c.Errors) > 0 {
-			// 获取最后一个错误作为主要错误
+			// 获取最后一个错误作为主要错误，非AppError类型的错误按内部错误处理
 			err := c.Errors.Last().Err
 			var appErr *pkg.AppError
-			var statusCode int
-
-			// 检查是否为AppError类型
-			if errors.As(err, &appErr) {
-				// 设置请求ID和路径
-				appErr.WithRequestID(requestID).WithPath(c.Request.URL.Path)
-				// 获取对应的HTTP状态码
-				statusCode = pkg.GetHTTPStatus(appErr)
-				// 以统一格式返回错误
-				c.JSON(statusCode, appErr)
-			} else {
-				// 对于非AppError类型的错误，创建一个内部错误
+			if !errors.As(err, &appErr) {
 				appErr = pkg.NewInternalError("Internal server error", err)
-				appErr.WithRequestID(requestID).WithPath(c.Request.URL.Path)
-				statusCode = http.StatusInternalServerError
-				c.JSON(statusCode, appErr)
+			}
+			statusCode := pkg.GetHTTPStatus(appErr)
+
+			// 以统一的problem+json格式返回错误
+			if !c.Writer.Written() {
+				pkg.RespondError(c, appErr)
 			}
 
 			// 记录错误日志
@@ -106,13 +94,6 @@ func (eh *ErrorHandler) HandlerFunc() gin.HandlerFunc {
 	}
 }
 
-// generateRequestID 生成一个简单的请求ID
-func generateRequestID() string {
-	// 在实际项目中，应该使用更安全的方式生成请求ID
-	// 这里为了简化，使用时间戳和随机数的组合
-	return time.Now().Format("20060102150405") + "-" + pkg.RandomString(8)
-}
-
 // responseWriterWrapper 用于包装http.ResponseWriter，捕获状态码
 // 这个结构体用于内部跟踪响应状态码，以便在中间件中记录日志
 type responseWriterWrapper struct {
@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"net/http"
 	"sync"
 	"time"
 
@@ -32,10 +31,7 @@ func RateLimiter(rate float64, burst int) gin.HandlerFunc {
 			).Info("Rate limit exceeded")
 
 			// 返回429 Too Many Requests状态码
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded. Please try again later.",
-			})
-			c.Abort()
+			pkg.AbortWithError(c, pkg.NewTooManyRequests("Rate limit exceeded. Please try again later.", nil))
 			return
 		}
 
@@ -332,10 +332,7 @@ func RetryMiddleware(config RetryConfig) gin.HandlerFunc {
 				zap.String("path", c.Request.URL.Path),
 				zap.Error(err))
 			
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "Service temporarily unavailable after retries",
-			})
-			c.Abort()
+			pkg.AbortWithError(c, pkg.NewServiceUnavailable("Service temporarily unavailable after retries", err))
 			return
 		}
 		
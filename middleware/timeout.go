@@ -32,6 +32,7 @@ func DefaultTimeoutConfig() TimeoutConfig {
 		PathTimeouts: map[string]time.Duration{
 			"/api/v1/llm/chat":   60 * time.Second,  // LLM聊天接口需要更长时间
 			"/api/v1/llm/stream": 120 * time.Second, // 流式接口需要更长时间
+			"/plugins/RAG/ask":   90 * time.Second,  // 知识库问答需要检索和生成
 			"/api/v1/health":     5 * time.Second,   // 健康检查快速响应
 			"/api/v1/metrics":    10 * time.Second,  // 监控指标
 			"/auth/login":        10 * time.Second,  // 登录接口
@@ -53,11 +54,7 @@ func DefaultOnTimeout(c *gin.Context, timeout time.Duration) {
 
 // DefaultTimeoutHandler 默认超时处理函数
 func DefaultTimeoutHandler(c *gin.Context) {
-	c.JSON(http.StatusRequestTimeout, gin.H{
-		"error": "Request timeout",
-		"code":  "REQUEST_TIMEOUT",
-	})
-	c.Abort()
+	pkg.AbortWithError(c, pkg.NewRequestTimeout("Request timeout", nil))
 }
 
 // TimeoutMiddleware 超时控制中间件
@@ -106,6 +103,18 @@ func TimeoutMiddleware(config TimeoutConfig) gin.HandlerFunc {
 	}
 }
 
+// ContextTimeoutMiddleware 只为请求上下文设置截止时间，超时后不写入响应
+// 用于SSE等流式接口：处理函数在上下文结束时自行结束响应流，避免与超时响应并发写入
+func ContextTimeoutMiddleware(config TimeoutConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), getTimeoutForPath(c.Request.URL.Path, config))
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
 // getTimeoutForPath 获取特定路径的超时时间
 func getTimeoutForPath(path string, config TimeoutConfig) time.Duration {
 	// 精确匹配
@@ -1,24 +1,35 @@
 package models
 
 import (
+	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// ErrAuditLogImmutable 审计日志只允许追加，禁止修改和删除
+var ErrAuditLogImmutable = errors.New("audit logs are append-only")
+
 // AuditLog 安全审计日志模型
 // 记录系统中所有关键操作的详细信息，用于安全审计和合规性检查
+// 每个租户的审计日志按Sequence组成哈希链，Hash覆盖本条记录内容和上一条记录的Hash
 type AuditLog struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
-	UserID       uint      `json:"user_id"`                       // 操作用户ID，如果未登录则为0
-	Username     string    `gorm:"size:50" json:"username"`       // 操作用户名
-	Action       string    `gorm:"size:100" json:"action"`        // 操作类型，如create、update、delete、login、logout等
-	ResourceType string    `gorm:"size:100" json:"resource_type"` // 资源类型，如user、tool、plugin等
-	ResourceID   string    `gorm:"size:100" json:"resource_id"`   // 资源ID
-	OldValue     string    `gorm:"type:text" json:"old_value"`    // 操作前的值（JSON格式）
-	NewValue     string    `gorm:"type:text" json:"new_value"`    // 操作后的值（JSON格式）
-	IPAddress    string    `gorm:"size:50" json:"ip_address"`     // 操作IP地址
-	UserAgent    string    `gorm:"type:text" json:"user_agent"`   // 用户代理信息
-	TenantID     uint      `gorm:"index" json:"tenant_id"`        // 租户ID，用于多租户环境
-	CreatedAt    time.Time `json:"created_at"`                    // 操作时间
+	UserID       uint      `json:"user_id"`                                                                 // 操作用户ID，如果未登录则为0
+	Username     string    `gorm:"size:50" json:"username"`                                                 // 操作用户名
+	Action       string    `gorm:"size:100" json:"action"`                                                  // 操作类型，如create、update、delete、login、logout等
+	ResourceType string    `gorm:"size:100" json:"resource_type"`                                           // 资源类型，如user、tool、plugin等
+	ResourceID   string    `gorm:"size:100" json:"resource_id"`                                             // 资源ID
+	OldValue     string    `gorm:"type:text" json:"old_value"`                                              // 操作前的值（JSON格式）
+	NewValue     string    `gorm:"type:text" json:"new_value"`                                              // 操作后的值（JSON格式）
+	Diff         string    `gorm:"type:text" json:"diff"`                                                   // 字段级变更列表（JSON格式），敏感字段已脱敏
+	IPAddress    string    `gorm:"size:50" json:"ip_address"`                                               // 操作IP地址
+	UserAgent    string    `gorm:"type:text" json:"user_agent"`                                             // 用户代理信息
+	TenantID     uint      `gorm:"index;uniqueIndex:idx_audit_logs_tenant_sequence" json:"tenant_id"`       // 租户ID，用于多租户环境
+	CreatedAt    time.Time `json:"created_at"`                                                              // 操作时间
+	Sequence     uint64    `gorm:"default:null;uniqueIndex:idx_audit_logs_tenant_sequence" json:"sequence"` // 租户内哈希链序号，从1开始；0表示引入哈希链之前的历史记录
+	PrevHash     string    `gorm:"size:64" json:"prev_hash"`                                                // 上一条记录的哈希
+	Hash         string    `gorm:"size:64" json:"hash"`                                                     // 本条记录的哈希（SHA-256）
 	// 添加关联关系
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
@@ -27,3 +38,32 @@ type AuditLog struct {
 func (AuditLog) TableName() string {
 	return "audit_logs"
 }
+
+// BeforeUpdate 禁止通过ORM修改审计日志
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete 禁止通过ORM删除审计日志
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// AuditCheckpoint 审计日志签名检查点
+// 定期记录租户哈希链的链头并使用服务端密钥签名，用于发现整链重算或尾部截断
+type AuditCheckpoint struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TenantID  uint      `gorm:"index" json:"tenant_id"`
+	Sequence  uint64    `gorm:"not null" json:"sequence"`          // 检查点对应的链头序号
+	Hash      string    `gorm:"size:64;not null" json:"hash"`      // 链头记录的哈希
+	Signature string    `gorm:"size:64;not null" json:"signature"` // HMAC-SHA256签名
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditSinkCursor 审计日志转发游标
+// 每个转发目标记录已成功发送的最大审计日志ID，重启后从游标之后继续转发
+type AuditSinkCursor struct {
+	Sink      string    `gorm:"primaryKey;size:100" json:"sink"` // 转发目标名称
+	LastID    uint      `gorm:"not null;default:0" json:"last_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// 对话消息的角色
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// Conversation LLM对话，每个用户在租户内可以有多个命名对话
+type Conversation struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	TenantID          uint      `gorm:"index:idx_conversation_owner,priority:1" json:"tenant_id"`
+	UserID            uint      `gorm:"not null;index:idx_conversation_owner,priority:2" json:"user_id"`
+	Title             string    `gorm:"size:255;not null" json:"title"`
+	MessageCount      int       `gorm:"not null;default:0" json:"message_count"`
+	SystemPrompt      string    `gorm:"type:text" json:"system_prompt"`               // 固定的系统提示词，为空时使用默认提示词
+	Summary           string    `gorm:"type:text" json:"summary"`                     // 较早消息的滚动摘要
+	SummarizedThrough uint      `gorm:"not null;default:0" json:"summarized_through"` // 已并入摘要的最后一条消息ID
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `gorm:"index" json:"updated_at"` // 最近一条消息的时间，对话列表按此排序
+}
+
+// ConversationMessage 对话中的单条消息
+type ConversationMessage struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ConversationID uint      `gorm:"not null;index" json:"conversation_id"`
+	TenantID       uint      `gorm:"index" json:"tenant_id"`
+	UserID         uint      `gorm:"not null" json:"user_id"`
+	Role           string    `gorm:"size:20;not null" json:"role"` // user或assistant
+	Content        string    `gorm:"type:text;not null" json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// 知识库文档的索引状态
+const (
+	DocumentStatusPending  = "pending"  // 等待索引
+	DocumentStatusIndexing = "indexing" // 正在索引
+	DocumentStatusIndexed  = "indexed"  // 已写入向量库，可以检索
+	DocumentStatusFailed   = "failed"   // 索引失败，Error记录原因
+)
+
+// KnowledgeDocument 上传到知识库的文档
+// 上传的内容统一转为Markdown保存，按标题切分后写入Redis向量库；同一集合中内容相同的文档只保存一份
+type KnowledgeDocument struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	TenantID    uint       `gorm:"uniqueIndex:idx_knowledge_document_hash,priority:1" json:"tenant_id"`
+	Collection  string     `gorm:"size:64;not null;uniqueIndex:idx_knowledge_document_hash,priority:2" json:"collection"`
+	ContentHash string     `gorm:"size:64;not null;uniqueIndex:idx_knowledge_document_hash,priority:3" json:"content_hash"` // 转换后内容的SHA-256
+	Title       string     `gorm:"size:255;not null" json:"title"`
+	Filename    string     `gorm:"size:255" json:"filename,omitempty"`
+	ContentType string     `gorm:"size:20;not null" json:"content_type"` // markdown、text、html或pdf
+	Size        int64      `gorm:"not null;default:0" json:"size"`       // 上传内容的字节数
+	Content     string     `gorm:"type:mediumtext" json:"-"`             // 转换后的Markdown，重新索引时使用
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	Progress    int        `gorm:"not null;default:0" json:"progress"` // 索引进度，0到100
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	ChunkIDs    string     `gorm:"type:text" json:"-"` // 向量库中切片的ID（JSON数组）
+	ChunkCount  int        `gorm:"not null;default:0" json:"chunk_count"`
+	CreatedBy   uint       `json:"created_by"`
+	IndexedAt   *time.Time `json:"indexed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"index" json:"updated_at"`
+}
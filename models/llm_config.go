@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// TenantLLMConfig 租户级LLM模型配置
+// 模型以别名、提供方名称或“提供方/模型”的形式引用；字段为空时使用全局配置，Routes中的任务覆盖全局同名任务
+type TenantLLMConfig struct {
+	ID            uint              `gorm:"primaryKey" json:"id"`
+	TenantID      uint              `gorm:"uniqueIndex" json:"tenant_id"`
+	DefaultModel  string            `gorm:"size:255" json:"default_model"`
+	FallbackModel string            `gorm:"size:255" json:"fallback_model"`
+	Routes        map[string]string `gorm:"type:text;serializer:json" json:"routes"` // 任务到模型的路由规则
+	UpdatedBy     uint              `json:"updated_by"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PluginTeamScope 插件在租户内的团队范围限制
+// 设置后只有该团队子树内的成员（以及继承权限的上级团队成员）可以使用该插件的工具
+type PluginTeamScope struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TenantID   uint      `gorm:"uniqueIndex:idx_plugin_scope_tenant_plugin" json:"tenant_id"`
+	PluginName string    `gorm:"size:100;not null;uniqueIndex:idx_plugin_scope_tenant_plugin" json:"plugin_name"`
+	TeamID     uint      `gorm:"index;not null" json:"team_id"`
+	CreatedBy  uint      `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
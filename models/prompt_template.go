@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// PromptTemplate 提示词模板的一个版本
+// Global为true时是对所有租户生效的平台级版本，否则是TenantID租户的覆盖版本；
+// 同一名称在每个范围内最多有一个启用的版本，租户版本优先于平台级版本，都没有时使用内置模板
+type PromptTemplate struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;not null;uniqueIndex:idx_prompt_version" json:"name"`
+	TenantID    uint      `gorm:"uniqueIndex:idx_prompt_version" json:"tenant_id"`
+	Global      bool      `gorm:"uniqueIndex:idx_prompt_version" json:"global"`
+	Version     int       `gorm:"uniqueIndex:idx_prompt_version" json:"version"`
+	Content     string    `gorm:"type:text;not null" json:"content"`          // text/template语法，变量以{{.name}}引用
+	Variables   []string  `gorm:"type:text;serializer:json" json:"variables"` // 模板可以使用的变量
+	Description string    `gorm:"size:255" json:"description"`                // 版本说明
+	Active      bool      `gorm:"default:false;index" json:"active"`          // 是否为该范围内生效的版本
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// 可共享的资源类型
+const (
+	ShareResourceNote = "note"
+	ShareResourceTool = "tool"
+)
+
+// 共享对象类型
+const (
+	ShareSubjectUser = "user"
+	ShareSubjectTeam = "team"
+)
+
+// 共享权限级别：read可查看/执行，write可修改，admin可删除并管理共享
+const (
+	ShareLevelRead  = "read"
+	ShareLevelWrite = "write"
+	ShareLevelAdmin = "admin"
+)
+
+// shareLevelRank 共享权限级别高低
+var shareLevelRank = map[string]int{ShareLevelRead: 1, ShareLevelWrite: 2, ShareLevelAdmin: 3}
+
+// ShareLevelRank 返回共享权限级别的等级，未知级别为0
+func ShareLevelRank(level string) int {
+	return shareLevelRank[level]
+}
+
+// ResourceShare 资源共享记录
+// 将笔记或工具共享给用户或团队，团队共享对团队（含继承）成员生效
+type ResourceShare struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	TenantID     uint      `gorm:"index" json:"tenant_id"`
+	ResourceType string    `gorm:"size:20;not null;uniqueIndex:idx_resource_share_subject" json:"resource_type"`
+	ResourceID   string    `gorm:"size:100;not null;uniqueIndex:idx_resource_share_subject" json:"resource_id"`
+	SubjectType  string    `gorm:"size:20;not null;uniqueIndex:idx_resource_share_subject;index:idx_resource_share_lookup" json:"subject_type"`
+	SubjectID    uint      `gorm:"not null;uniqueIndex:idx_resource_share_subject;index:idx_resource_share_lookup" json:"subject_id"`
+	Level        string    `gorm:"size:20;not null;default:read" json:"level"`
+	CreatedBy    uint      `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
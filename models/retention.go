@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// 数据保留策略适用的资源
+const (
+	RetentionResourceAuditLog     = "audit_log"
+	RetentionResourceLoginHistory = "login_history"
+	RetentionResourceToolHistory  = "tool_history"
+)
+
+// RetentionResources 支持保留策略的全部资源
+var RetentionResources = []string{RetentionResourceAuditLog, RetentionResourceLoginHistory, RetentionResourceToolHistory}
+
+// RetentionPolicy 租户级数据保留策略
+// 超过保留天数的记录先归档再删除；LegalHold为true时暂停该资源的一切删除，包括已恢复记录的到期清理
+type RetentionPolicy struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	TenantID        uint      `gorm:"not null;uniqueIndex:idx_retention_policy_tenant_resource" json:"tenant_id"`
+	Resource        string    `gorm:"size:50;not null;uniqueIndex:idx_retention_policy_tenant_resource" json:"resource"`
+	RetentionDays   int       `gorm:"not null;default:0" json:"retention_days"` // 保留天数，0表示永久保留
+	LegalHold       bool      `gorm:"not null;default:false" json:"legal_hold"`
+	LegalHoldReason string    `gorm:"size:255" json:"legal_hold_reason,omitempty"`
+	UpdatedBy       uint      `json:"updated_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// RetentionArchive 归档文件记录
+// 每个归档文件包含同一租户、同一资源ID连续的一段记录，内容为gzip压缩的NDJSON
+type RetentionArchive struct {
+	ID       uint      `gorm:"primaryKey" json:"id"`
+	TenantID uint      `gorm:"not null;uniqueIndex:idx_retention_archive_range" json:"tenant_id"`
+	Resource string    `gorm:"size:50;not null;uniqueIndex:idx_retention_archive_range" json:"resource"`
+	FromID   uint      `gorm:"not null;uniqueIndex:idx_retention_archive_range" json:"from_id"`
+	ToID     uint      `gorm:"not null" json:"to_id"`
+	FromTime time.Time `json:"from_time"`
+	ToTime   time.Time `gorm:"index" json:"to_time"`
+	Count    int       `gorm:"not null" json:"count"`
+	Storage  string    `gorm:"size:20;not null" json:"storage"`   // local或s3
+	Location string    `gorm:"size:512;not null" json:"location"` // 存储中的对象键
+	SHA256   string    `gorm:"column:sha256;size:64;not null" json:"sha256"`
+	Size     int64     `json:"size"`
+	// 审计日志归档时记录最后一条链上记录，被删除的链段之后的校验从这里接续
+	LastSequence  uint64     `json:"last_sequence,omitempty"`
+	LastHash      string     `gorm:"size:64" json:"last_hash,omitempty"`
+	RestoredAt    *time.Time `json:"restored_at,omitempty"`
+	RestoredUntil *time.Time `json:"restored_until,omitempty"` // 恢复的记录到期后再次删除
+	CreatedAt     time.Time  `json:"created_at"`
+}
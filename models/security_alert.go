@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// 告警级别，按严重程度递增
+const (
+	AlertSeverityLow      = "low"
+	AlertSeverityMedium   = "medium"
+	AlertSeverityHigh     = "high"
+	AlertSeverityCritical = "critical"
+)
+
+// 告警状态
+const (
+	AlertStatusOpen         = "open"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+)
+
+// SecurityAlert 安全异常告警
+// 由异常检测规则根据登录历史和审计日志生成，同一规则对同一条来源记录只生成一条告警
+type SecurityAlert struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	TenantID    uint       `gorm:"index" json:"tenant_id"`
+	Rule        string     `gorm:"size:50;not null;index" json:"rule"`
+	Severity    string     `gorm:"size:20;not null;index" json:"severity"`
+	Status      string     `gorm:"size:20;not null;default:open;index" json:"status"`
+	UserID      uint       `gorm:"index" json:"user_id,omitempty"` // 登录类告警按用户名关联，可能为0
+	Username    string     `gorm:"size:50;index" json:"username"`
+	Source      string     `gorm:"size:20;not null" json:"source"` // 触发告警的记录来源：login_history或audit_log
+	SourceID    uint       `gorm:"not null" json:"source_id"`
+	Summary     string     `gorm:"size:255" json:"summary"`
+	Details     string     `gorm:"type:text" json:"details"`               // 规则相关的上下文（JSON格式）
+	Fingerprint string     `gorm:"size:100;not null;uniqueIndex" json:"-"` // 去重键：规则、来源和来源记录ID
+	OccurredAt  time.Time  `gorm:"index" json:"occurred_at"`               // 来源记录的发生时间
+	HandledBy   uint       `json:"handled_by,omitempty"`                   // 最后确认或解决告警的用户
+	HandledAt   *time.Time `json:"handled_at,omitempty"`
+	Note        string     `gorm:"size:500" json:"note,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// AnomalyCursor 异常检测游标，记录每个数据来源已检测的最大ID
+type AnomalyCursor struct {
+	Source    string    `gorm:"primaryKey;size:50" json:"source"`
+	LastID    uint      `gorm:"not null;default:0" json:"last_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,27 +1,88 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Team 团队模型
-// 用于在租户内组织和管理成员
+// 用于在租户内组织和管理成员，可通过ParentID组成部门与子团队的层级结构
 type Team struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	Name        string    `gorm:"size:100;not null;index:idx_tenant_team_name,unique" json:"name"`
 	Description string    `gorm:"type:text" json:"description"`
 	OwnerID     uint      `gorm:"index" json:"owner_id"`
+	ParentID    *uint     `gorm:"index" json:"parent_id"` // 上级团队，为空表示根团队
 	TenantID    uint      `gorm:"index:idx_tenant_team_name,unique" json:"tenant_id"`
-	Members     string    `gorm:"type:text;default:null;comment:团队成员列表（用户名形式）" json:"members"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // TeamMember 团队成员模型
-// 记录用户在团队内的角色
+// 记录用户在团队内的角色，是团队成员关系的唯一数据来源，同一用户在同一团队只有一条记录
 type TeamMember struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	TeamID    uint      `gorm:"index" json:"team_id"`
-	UserID    uint      `gorm:"index" json:"user_id"`
+	TeamID    uint      `gorm:"uniqueIndex:idx_team_member_team_user" json:"team_id"`
+	UserID    uint      `gorm:"index;uniqueIndex:idx_team_member_team_user" json:"user_id"`
 	Role      string    `gorm:"size:50;default:member" json:"role"`
 	TenantID  uint      `gorm:"index" json:"tenant_id"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// teamRoleRank 团队角色权限高低，用于合并重复成员记录时保留权限最高的一条
+var teamRoleRank = map[string]int{"owner": 3, "admin": 2, "member": 1}
+
+// TeamRoleRank 返回团队角色的权限等级，未知角色为0
+func TeamRoleRank(role string) int {
+	return teamRoleRank[role]
+}
+
+// DeduplicateTeamMembers 合并同一团队内同一用户的重复成员记录
+// 每组保留角色权限最高的一条（同级保留最早创建的），返回删除的记录数
+// 在添加(team_id, user_id)唯一约束之前调用，避免历史重复数据导致迁移失败
+func DeduplicateTeamMembers(db *gorm.DB) (int64, error) {
+	type duplicateKey struct {
+		TeamID uint
+		UserID uint
+	}
+	var keys []duplicateKey
+	if err := db.Model(&TeamMember{}).
+		Select("team_id, user_id").
+		Group("team_id, user_id").
+		Having("COUNT(*) > 1").
+		Scan(&keys).Error; err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, key := range keys {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var rows []TeamMember
+			if err := tx.Where("team_id = ? AND user_id = ?", key.TeamID, key.UserID).Order("id ASC").Find(&rows).Error; err != nil {
+				return err
+			}
+			if len(rows) < 2 {
+				return nil
+			}
+
+			keep := rows[0]
+			for _, row := range rows[1:] {
+				if teamRoleRank[row.Role] > teamRoleRank[keep.Role] {
+					keep = row
+				}
+			}
+
+			result := tx.Where("team_id = ? AND user_id = ? AND id <> ?", key.TeamID, key.UserID, keep.ID).Delete(&TeamMember{})
+			if result.Error != nil {
+				return result.Error
+			}
+			removed += result.RowsAffected
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
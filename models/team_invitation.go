@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// 团队邀请状态
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusDeclined = "declined"
+	InvitationStatusRevoked  = "revoked"
+	InvitationStatusExpired  = "expired"
+)
+
+// TeamInvitation 团队邀请模型
+// 被邀请人接受后才会成为团队成员，邀请可按用户名或邮箱发出
+type TeamInvitation struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	TeamID        uint       `gorm:"index;not null" json:"team_id"`
+	TenantID      uint       `gorm:"index" json:"tenant_id"`
+	InviterID     uint       `gorm:"index;not null" json:"inviter_id"`
+	InviteeUserID *uint      `gorm:"index" json:"invitee_user_id,omitempty"`        // 按用户名邀请或邮箱已注册时关联用户
+	InviteeEmail  string     `gorm:"size:100;index" json:"invitee_email,omitempty"` // 按邮箱邀请时记录，用户注册后可凭邮箱接受
+	Role          string     `gorm:"size:50;default:member" json:"role"`
+	Status        string     `gorm:"size:20;index;default:pending" json:"status"`
+	ExpiresAt     time.Time  `gorm:"index" json:"expires_at"`
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// IsPending 邀请是否仍可响应
+func (i *TeamInvitation) IsPending(now time.Time) bool {
+	return i.Status == InvitationStatusPending && now.Before(i.ExpiresAt)
+}
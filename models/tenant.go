@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 租户状态
+const (
+	TenantStatusActive    = "active"    // 正常
+	TenantStatusSuspended = "suspended" // 已暂停，成员无法登录和访问API
+	TenantStatusDeleted   = "deleted"   // 已删除（软删除）
+)
+
+// DefaultTenantID 默认租户ID，未指定租户注册的用户归属该租户
+const DefaultTenantID uint = 0
+
+// Tenant 租户模型
+// 租户是数据隔离的边界，所有带TenantID字段的模型都归属某个租户
+type Tenant struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"size:100;not null" json:"name"`
+	Slug        string         `gorm:"size:64;not null;uniqueIndex" json:"slug"` // 租户唯一标识，用于注册时指定租户
+	Description string         `gorm:"type:text" json:"description"`
+	Status      string         `gorm:"size:20;not null;default:active;index" json:"status"`
+	AllowSignup bool           `gorm:"default:false" json:"allow_signup"` // 是否允许用户自助注册到该租户
+	SuspendedAt *time.Time     `json:"suspended_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// IsActive 租户是否处于正常状态
+func (t *Tenant) IsActive() bool {
+	return t.Status == TenantStatusActive
+}
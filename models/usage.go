@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// TenantQuota 租户配额
+// 字段为空时使用全局默认配额，0表示不限制
+type TenantQuota struct {
+	ID                        uint      `gorm:"primaryKey" json:"id"`
+	TenantID                  uint      `gorm:"uniqueIndex" json:"tenant_id"`
+	MaxUsers                  *int64    `json:"max_users"`
+	MaxTeams                  *int64    `json:"max_teams"`
+	MaxTools                  *int64    `json:"max_tools"`
+	MaxNotes                  *int64    `json:"max_notes"`
+	MaxPluginExecutionsPerDay *int64    `json:"max_plugin_executions_per_day"`
+	MaxLLMTokensPerMonth      *int64    `json:"max_llm_tokens_per_month"`
+	CreatedAt                 time.Time `json:"created_at"`
+	UpdatedAt                 time.Time `json:"updated_at"`
+}
+
+// UsageDaily 按天汇总的租户用量
+// 每个租户、指标、资源每天一行，写入时原子累加
+type UsageDaily struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TenantID  uint      `gorm:"uniqueIndex:idx_usage_daily_key" json:"tenant_id"`
+	Metric    string    `gorm:"size:50;not null;uniqueIndex:idx_usage_daily_key" json:"metric"`    // 计量指标，如plugin_executions、llm_tokens
+	Resource  string    `gorm:"size:100;not null;uniqueIndex:idx_usage_daily_key" json:"resource"` // 资源名称，如插件名、模型名
+	Day       string    `gorm:"size:10;not null;uniqueIndex:idx_usage_daily_key;index" json:"day"` // 日期，格式YYYY-MM-DD
+	Quantity  int64     `gorm:"not null;default:0" json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LLMUsage 一次模型调用的令牌用量
+// 模型返回用量时使用返回值，否则按文本长度估算；费用按记录时的单价计算
+type LLMUsage struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	TenantID         uint      `gorm:"index:idx_llm_usage_tenant_time" json:"tenant_id"`
+	UserID           uint      `gorm:"index" json:"user_id"`
+	Source           string    `gorm:"size:20;not null" json:"source"` // 调用来源，如chat、stream、agent、summary、rag
+	Provider         string    `gorm:"size:100;not null" json:"provider"`
+	Model            string    `gorm:"size:255;not null" json:"model"`
+	PromptTokens     int64     `gorm:"not null;default:0" json:"prompt_tokens"`
+	CompletionTokens int64     `gorm:"not null;default:0" json:"completion_tokens"`
+	TotalTokens      int64     `gorm:"not null;default:0" json:"total_tokens"`
+	Estimated        bool      `json:"estimated"` // 模型没有返回用量，按文本长度估算
+	Cost             float64   `json:"cost"`
+	CreatedAt        time.Time `gorm:"index:idx_llm_usage_tenant_time" json:"created_at"`
+}
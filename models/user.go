@@ -8,17 +8,17 @@ import (
 
 // User 用户模型
 type User struct {
-	ID             uint      `gorm:"primaryKey" json:"id"`
-	Username       string    `gorm:"size:50;not null;unique" json:"username"`
-	Password       string    `gorm:"size:100;not null" json:"password,omitempty"`
-	Email          string    `gorm:"size:100;unique" json:"email"`
-	TenantID       uint      `gorm:"index" json:"tenant_id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Username  string    `gorm:"size:50;not null;unique" json:"username"`
+	Password  string    `gorm:"size:100;not null" json:"password,omitempty"`
+	Email     string    `gorm:"size:100;unique" json:"email"`
+	TenantID  uint      `gorm:"index" json:"tenant_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 	// 添加关联关系
-	Notes           []Note         `gorm:"foreignKey:UserID" json:"notes,omitempty"`
-	LoginHistories  []LoginHistory `gorm:"foreignKey:Username;references:Username" json:"login_histories,omitempty"`
-	AuditLogs       []AuditLog     `gorm:"foreignKey:UserID" json:"audit_logs,omitempty"`
+	Notes          []Note         `gorm:"foreignKey:UserID" json:"notes,omitempty"`
+	LoginHistories []LoginHistory `gorm:"foreignKey:Username;references:Username" json:"login_histories,omitempty"`
+	AuditLogs      []AuditLog     `gorm:"foreignKey:UserID" json:"audit_logs,omitempty"`
 }
 
 // Tool 工具模型
@@ -30,6 +30,8 @@ type Tool struct {
 	PluginName  string    `gorm:"size:100;not null" json:"plugin_name"`
 	IsEnabled   bool      `gorm:"default:true" json:"is_enabled"`
 	TenantID    uint      `gorm:"index" json:"tenant_id"`
+	TeamID      *uint     `gorm:"index" json:"team_id,omitempty"` // 限定可用范围的团队子树，为空表示租户内所有用户可用
+	OwnerID     uint      `gorm:"index" json:"owner_id"`          // 创建者，为0表示历史工具，租户内可用即可编辑
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -43,14 +45,30 @@ type ToolHistory struct {
 	UsedAt   time.Time `json:"used_at"`
 	Params   string    `gorm:"type:text" json:"params"`
 	Result   string    `gorm:"type:text" json:"result"`
+	// PluginName 执行的插件，LLM直接调用插件时ToolID为0
+	PluginName string `gorm:"size:100" json:"plugin_name"`
 }
 
 // MigrateTables 执行数据库迁移
 func MigrateTables(db *gorm.DB) error {
+	// 添加团队成员唯一约束前先清理历史重复记录
+	if db.Migrator().HasTable(&TeamMember{}) {
+		if _, err := DeduplicateTeamMembers(db); err != nil {
+			return err
+		}
+	}
+
 	// 自动迁移表结构
-	if err := db.AutoMigrate(&User{}, &Tool{}, &ToolHistory{}, &Note{}, &LoginHistory{}, &AuditLog{}, &Team{}, &TeamMember{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &Tool{}, &ToolHistory{}, &Note{}, &LoginHistory{}, &AuditLog{}, &Team{}, &TeamMember{}, &Tenant{}, &TenantQuota{}, &UsageDaily{}, &TeamInvitation{}, &PluginTeamScope{}, &ResourceShare{}, &AuditCheckpoint{}, &AuditSinkCursor{}, &RetentionPolicy{}, &RetentionArchive{}, &SecurityAlert{}, &AnomalyCursor{}, &Conversation{}, &ConversationMessage{}, &TenantLLMConfig{}, &PromptTemplate{}, &LLMUsage{}, &KnowledgeDocument{}); err != nil {
 		return err
 	}
 
+	// 团队成员关系已统一由TeamMember维护，移除冗余的members列
+	if db.Migrator().HasColumn(&Team{}, "members") {
+		if err := db.Migrator().DropColumn(&Team{}, "members"); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
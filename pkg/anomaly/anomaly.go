@@ -0,0 +1,482 @@
+// Package anomaly 根据登录历史和审计日志检测可疑行为并生成安全告警
+//
+// 检测器按ID顺序增量读取login_history和audit_log，每个来源在anomaly_cursor表中保存已检测的位置。
+// 规则只参考ID小于当前记录的历史数据，重复检测同一条记录得到相同的结果；告警按规则、来源和来源记录ID去重。
+// 新告警写入security_alert表后在事件总线上发布EventAlertCreated事件，配置了webhook时由通知器转发。
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/events"
+	"weave/pkg/metrics"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 检测规则
+const (
+	RuleNewIP               = "new_ip"
+	RuleNewUserAgent        = "new_user_agent"
+	RuleLoginBurst          = "login_burst"
+	RuleMassDeletion        = "mass_deletion"
+	RulePrivilegeEscalation = "privilege_escalation"
+)
+
+// 告警来源
+const (
+	SourceLoginHistory = "login_history"
+	SourceAuditLog     = "audit_log"
+)
+
+// EventAlertCreated 新告警事件，Payload包含告警的主要字段
+const EventAlertCreated = "security.alert.created"
+
+// settleDelay 只检测发生时间早于该间隔的记录，给异步写入和较晚提交的事务留出时间
+const settleDelay = 10 * time.Second
+
+// severityRank 告警级别的严重程度
+var severityRank = map[string]int{
+	models.AlertSeverityLow:      1,
+	models.AlertSeverityMedium:   2,
+	models.AlertSeverityHigh:     3,
+	models.AlertSeverityCritical: 4,
+}
+
+// SeverityAtLeast 判断告警级别是否达到min
+func SeverityAtLeast(severity, min string) bool {
+	return severityRank[severity] >= severityRank[min]
+}
+
+// Rules 返回当前生效的规则配置
+func Rules() map[string]config.AnomalyRuleConfig {
+	rules := config.Config.Anomaly.Rules
+	return map[string]config.AnomalyRuleConfig{
+		RuleNewIP:               rules.NewIP,
+		RuleNewUserAgent:        rules.NewUserAgent,
+		RuleLoginBurst:          rules.LoginBurst,
+		RuleMassDeletion:        rules.MassDeletion,
+		RulePrivilegeEscalation: rules.PrivilegeEscalation,
+	}
+}
+
+// Options 检测器配置
+type Options struct {
+	BatchSize int           // 每次读取的最大记录数
+	Settle    time.Duration // 只检测发生时间早于该间隔的记录，0表示不等待
+}
+
+// Detector 异常检测器
+type Detector struct {
+	db   *gorm.DB
+	opts Options
+}
+
+// NewDetector 创建检测器，db为nil时使用pkg.DB
+func NewDetector(db *gorm.DB, opts Options) *Detector {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	return &Detector{db: db, opts: opts}
+}
+
+// database 返回跳过租户隔离的数据库会话
+func (d *Detector) database(ctx context.Context) *gorm.DB {
+	db := d.db
+	if db == nil {
+		db = pkg.DB
+	}
+	return db.WithContext(pkg.WithoutTenantScope(ctx))
+}
+
+// settled 判断记录是否已经超过等待时间
+func (d *Detector) settled(at time.Time) bool {
+	return d.opts.Settle <= 0 || at.Before(time.Now().Add(-d.opts.Settle))
+}
+
+// Run 检测一批新的登录历史和审计日志，返回新生成的告警数
+func (d *Detector) Run(ctx context.Context) (int, error) {
+	db := d.database(ctx)
+	logins, err := d.scanLogins(db)
+	if err != nil {
+		return logins, err
+	}
+	audits, err := d.scanAuditLogs(db)
+	return logins + audits, err
+}
+
+// scanLogins 检测游标之后的登录历史
+func (d *Detector) scanLogins(db *gorm.DB) (int, error) {
+	lastID, err := LoadCursor(db, SourceLoginHistory)
+	if err != nil {
+		return 0, err
+	}
+	var rows []models.LoginHistory
+	if err := db.Where("id > ?", lastID).Order("id").Limit(d.opts.BatchSize).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	cursor := lastID
+	for i := range rows {
+		login := &rows[i]
+		if !d.settled(login.LoginTime) {
+			break
+		}
+		alerts, err := d.checkLogin(db, login)
+		if err != nil {
+			return created, err
+		}
+		for _, alert := range alerts {
+			ok, err := raise(db, alert)
+			if err != nil {
+				return created, err
+			}
+			if ok {
+				created++
+			}
+		}
+		cursor = login.ID
+	}
+	if cursor != lastID {
+		return created, saveCursor(db, SourceLoginHistory, cursor)
+	}
+	return created, nil
+}
+
+// scanAuditLogs 检测游标之后的审计日志
+func (d *Detector) scanAuditLogs(db *gorm.DB) (int, error) {
+	lastID, err := LoadCursor(db, SourceAuditLog)
+	if err != nil {
+		return 0, err
+	}
+	var rows []models.AuditLog
+	if err := db.Where("id > ?", lastID).Order("id").Limit(d.opts.BatchSize).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	cursor := lastID
+	for i := range rows {
+		log := &rows[i]
+		if !d.settled(log.CreatedAt) {
+			break
+		}
+		alerts, err := d.checkAuditLog(db, log)
+		if err != nil {
+			return created, err
+		}
+		for _, alert := range alerts {
+			ok, err := raise(db, alert)
+			if err != nil {
+				return created, err
+			}
+			if ok {
+				created++
+			}
+		}
+		cursor = log.ID
+	}
+	if cursor != lastID {
+		return created, saveCursor(db, SourceAuditLog, cursor)
+	}
+	return created, nil
+}
+
+// checkLogin 对一次成功登录执行登录类规则，用户第一次登录只作为基线，不产生新IP和新客户端告警
+func (d *Detector) checkLogin(db *gorm.DB, login *models.LoginHistory) ([]*models.SecurityAlert, error) {
+	if !login.Success || login.Username == "" {
+		return nil, nil
+	}
+	rules := config.Config.Anomaly.Rules
+	prior := func() *gorm.DB {
+		return db.Model(&models.LoginHistory{}).
+			Where("tenant_id = ? AND username = ? AND success = ? AND id < ?", login.TenantID, login.Username, true, login.ID)
+	}
+	newAlert := func(rule string, severity string, summary string, details map[string]interface{}) *models.SecurityAlert {
+		return newSecurityAlert(rule, severity, SourceLoginHistory, login.ID, login.TenantID, 0, login.Username, login.LoginTime, summary, details)
+	}
+
+	var previous int64
+	if err := prior().Count(&previous).Error; err != nil {
+		return nil, err
+	}
+
+	var alerts []*models.SecurityAlert
+	if rules.NewIP.Enabled && previous > 0 && login.IPAddress != "" {
+		var seen int64
+		if err := prior().Where("ip_address = ?", login.IPAddress).Count(&seen).Error; err != nil {
+			return nil, err
+		}
+		if seen == 0 {
+			alerts = append(alerts, newAlert(RuleNewIP, rules.NewIP.Severity,
+				fmt.Sprintf("%s logged in from a new IP address %s", login.Username, login.IPAddress),
+				map[string]interface{}{"ip_address": login.IPAddress, "user_agent": login.UserAgent, "previous_logins": previous}))
+		}
+	}
+
+	if rules.NewUserAgent.Enabled && previous > 0 && login.UserAgent != "" {
+		var seen int64
+		if err := prior().Where("user_agent = ?", login.UserAgent).Count(&seen).Error; err != nil {
+			return nil, err
+		}
+		if seen == 0 {
+			alerts = append(alerts, newAlert(RuleNewUserAgent, rules.NewUserAgent.Severity,
+				fmt.Sprintf("%s logged in from a new client", login.Username),
+				map[string]interface{}{"ip_address": login.IPAddress, "user_agent": login.UserAgent, "previous_logins": previous}))
+		}
+	}
+
+	if rules.LoginBurst.Enabled && login.IPAddress != "" {
+		window := time.Duration(rules.LoginBurst.Window) * time.Second
+		var recent []string
+		if err := prior().Where("login_time >= ? AND login_time <= ?", login.LoginTime.Add(-window), login.LoginTime).
+			Pluck("ip_address", &recent).Error; err != nil {
+			return nil, err
+		}
+		networks := make(map[string]bool)
+		for _, ip := range recent {
+			if ip != "" {
+				networks[networkOf(ip)] = true
+			}
+		}
+		// 只在不同网段数刚好达到阈值的那次登录告警，同一波登录不重复告警
+		current := networkOf(login.IPAddress)
+		if !networks[current] && len(networks)+1 == rules.LoginBurst.Threshold {
+			networks[current] = true
+			list := make([]string, 0, len(networks))
+			for network := range networks {
+				list = append(list, network)
+			}
+			sort.Strings(list)
+			alerts = append(alerts, newAlert(RuleLoginBurst, rules.LoginBurst.Severity,
+				fmt.Sprintf("%s logged in from %d different networks within %s", login.Username, len(list), window),
+				map[string]interface{}{"networks": list, "window_seconds": rules.LoginBurst.Window, "ip_address": login.IPAddress}))
+		}
+	}
+	return alerts, nil
+}
+
+// checkAuditLog 对一条审计日志执行操作类规则
+func (d *Detector) checkAuditLog(db *gorm.DB, log *models.AuditLog) ([]*models.SecurityAlert, error) {
+	rules := config.Config.Anomaly.Rules
+	newAlert := func(rule string, severity string, summary string, details map[string]interface{}) *models.SecurityAlert {
+		return newSecurityAlert(rule, severity, SourceAuditLog, log.ID, log.TenantID, log.UserID, log.Username, log.CreatedAt, summary, details)
+	}
+	actor := log.Username
+	if actor == "" {
+		actor = fmt.Sprintf("user %d", log.UserID)
+	}
+
+	var alerts []*models.SecurityAlert
+	if rules.MassDeletion.Enabled && log.UserID != 0 && strings.HasPrefix(log.Action, "delete") {
+		window := time.Duration(rules.MassDeletion.Window) * time.Second
+		var count int64
+		if err := db.Model(&models.AuditLog{}).
+			Where("tenant_id = ? AND user_id = ? AND action LIKE ? AND created_at >= ? AND created_at <= ? AND id <= ?",
+				log.TenantID, log.UserID, "delete%", log.CreatedAt.Add(-window), log.CreatedAt, log.ID).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		// 只在删除次数刚好达到阈值时告警
+		if count == int64(rules.MassDeletion.Threshold) {
+			alerts = append(alerts, newAlert(RuleMassDeletion, rules.MassDeletion.Severity,
+				fmt.Sprintf("%s deleted %d resources within %s", actor, count, window),
+				map[string]interface{}{"deletions": count, "window_seconds": rules.MassDeletion.Window, "last_resource_type": log.ResourceType}))
+		}
+	}
+
+	if rules.PrivilegeEscalation.Enabled {
+		switch log.Action {
+		case "update_member_role":
+			oldValue, newValue := decodeValue(log.OldValue), decodeValue(log.NewValue)
+			oldRole, _ := oldValue["role"].(string)
+			newRole, _ := newValue["role"].(string)
+			if (newRole == "admin" || newRole == "owner") && newRole != oldRole {
+				alerts = append(alerts, newAlert(RulePrivilegeEscalation, rules.PrivilegeEscalation.Severity,
+					fmt.Sprintf("%s promoted a member of team %s to %s", actor, log.ResourceID, newRole),
+					map[string]interface{}{"team": log.ResourceID, "target_user_id": newValue["user_id"], "old_role": oldRole, "new_role": newRole}))
+			}
+		case "transfer_ownership":
+			newValue := decodeValue(log.NewValue)
+			alerts = append(alerts, newAlert(RulePrivilegeEscalation, rules.PrivilegeEscalation.Severity,
+				fmt.Sprintf("%s transferred ownership of team %s", actor, log.ResourceID),
+				map[string]interface{}{"team": log.ResourceID, "new_owner_id": newValue["owner_id"]}))
+		}
+	}
+	return alerts, nil
+}
+
+// newSecurityAlert 创建告警，去重键由规则、来源和来源记录ID组成
+func newSecurityAlert(rule, severity, source string, sourceID, tenantID, userID uint, username string, occurredAt time.Time, summary string, details map[string]interface{}) *models.SecurityAlert {
+	detailJSON, _ := json.Marshal(details)
+	if len(summary) > 255 {
+		summary = summary[:255]
+	}
+	return &models.SecurityAlert{
+		TenantID:    tenantID,
+		Rule:        rule,
+		Severity:    severity,
+		Status:      models.AlertStatusOpen,
+		UserID:      userID,
+		Username:    username,
+		Source:      source,
+		SourceID:    sourceID,
+		Summary:     summary,
+		Details:     string(detailJSON),
+		Fingerprint: fmt.Sprintf("%s:%s:%d", rule, source, sourceID),
+		OccurredAt:  occurredAt,
+	}
+}
+
+// raise 保存告警，已存在相同告警时返回false；新告警发布EventAlertCreated事件
+func raise(db *gorm.DB, alert *models.SecurityAlert) (bool, error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	metrics.RecordSecurityAlert(alert.Rule, alert.Severity)
+	events.Publish(events.Event{
+		Type:     EventAlertCreated,
+		TenantID: alert.TenantID,
+		ActorID:  alert.UserID,
+		Payload: map[string]interface{}{
+			"alert_id":    alert.ID,
+			"rule":        alert.Rule,
+			"severity":    alert.Severity,
+			"username":    alert.Username,
+			"summary":     alert.Summary,
+			"source":      alert.Source,
+			"source_id":   alert.SourceID,
+			"occurred_at": alert.OccurredAt,
+		},
+	})
+	return true, nil
+}
+
+// decodeValue 解析审计日志中的JSON值，无法解析时返回空map
+func decodeValue(value string) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &m); err != nil || m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+// networkOf 返回IP所在的网段，IPv4取/16，IPv6取/48，用于近似判断登录地点
+func networkOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// LoadCursor 读取来源的检测游标，没有记录时从头开始
+func LoadCursor(db *gorm.DB, source string) (uint, error) {
+	var cursor models.AnomalyCursor
+	err := db.Where("source = ?", source).First(&cursor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return cursor.LastID, nil
+}
+
+func saveCursor(db *gorm.DB, source string, lastID uint) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_id", "updated_at"}),
+	}).Create(&models.AnomalyCursor{Source: source, LastID: lastID}).Error
+}
+
+// subscribeNotifier 只订阅一次webhook通知
+var subscribeNotifier sync.Once
+
+// defaultDetector 定期检测的后台任务
+var defaultDetector struct {
+	sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start 启动定期检测，间隔由Anomaly.Interval配置；配置了WebhookURL时订阅告警事件并发送通知
+func Start() {
+	cfg := config.Config.Anomaly
+	if cfg.WebhookURL != "" {
+		subscribeNotifier.Do(func() {
+			notifier := NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookSecret, cfg.NotifyMinSeverity)
+			events.Subscribe(EventAlertCreated, notifier.Handle)
+		})
+	}
+
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		return
+	}
+
+	defaultDetector.Lock()
+	defer defaultDetector.Unlock()
+	if defaultDetector.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defaultDetector.stop = stop
+	defaultDetector.done = done
+
+	detector := NewDetector(nil, Options{BatchSize: cfg.BatchSize, Settle: settleDelay})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				count, err := detector.Run(context.Background())
+				if err != nil {
+					pkg.Warn("Anomaly detection failed", zap.Error(err))
+				} else if count > 0 {
+					pkg.Info("Security alerts raised", zap.Int("count", count))
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定期检测
+func Stop() {
+	defaultDetector.Lock()
+	stop, done := defaultDetector.stop, defaultDetector.done
+	defaultDetector.stop, defaultDetector.done = nil, nil
+	defaultDetector.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
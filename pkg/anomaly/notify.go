@@ -0,0 +1,81 @@
+package anomaly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"weave/pkg"
+	"weave/pkg/auditsink"
+	"weave/pkg/events"
+
+	"go.uber.org/zap"
+)
+
+// notifyTimeout 单次通知请求的超时时间
+const notifyTimeout = 10 * time.Second
+
+// WebhookNotifier 将告警事件POST到webhook，签名方式与审计日志webhook转发相同
+type WebhookNotifier struct {
+	url         string
+	secret      string
+	minSeverity string
+	client      *http.Client
+}
+
+// NewWebhookNotifier 创建webhook通知器，只通知级别不低于minSeverity的告警
+func NewWebhookNotifier(url, secret, minSeverity string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:         url,
+		secret:      secret,
+		minSeverity: minSeverity,
+		client:      &http.Client{Timeout: notifyTimeout},
+	}
+}
+
+// Handle 事件总线的订阅函数，在独立协程中发送，不阻塞检测
+func (n *WebhookNotifier) Handle(event events.Event) {
+	severity, _ := event.Payload["severity"].(string)
+	if !SeverityAtLeast(severity, n.minSeverity) {
+		return
+	}
+	go func() {
+		if err := n.Send(context.Background(), event); err != nil {
+			pkg.Warn("Failed to deliver security alert notification",
+				zap.Any("alert_id", event.Payload["alert_id"]),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+// Send 发送一条告警事件，2xx响应视为成功
+func (n *WebhookNotifier) Send(ctx context.Context, event events.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set(auditsink.SignatureHeader, "sha256="+auditsink.SignPayload(n.secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post security alert: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("security alert webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -35,23 +35,28 @@ type AuditLogOptions struct {
 
 // Log 记录审计日志
 func (al *AuditLogger) Log(options AuditLogOptions) error {
-	// 转换OldValue和NewValue为JSON字符串
-	oldValueStr := ""
-	if options.OldValue != nil {
-		oldValue, err := json.Marshal(options.OldValue)
-		if err != nil {
-			return fmt.Errorf("failed to marshal old value: %v", err)
-		}
-		oldValueStr = string(oldValue)
+	// 转换OldValue和NewValue为JSON字符串，并脱敏密码、令牌等敏感字段
+	oldValueStr, err := RedactAuditValue(options.OldValue)
+	if err != nil {
+		return fmt.Errorf("failed to marshal old value: %v", err)
+	}
+	newValueStr, err := RedactAuditValue(options.NewValue)
+	if err != nil {
+		return fmt.Errorf("failed to marshal new value: %v", err)
 	}
 
-	newValueStr := ""
-	if options.NewValue != nil {
-		newValue, err := json.Marshal(options.NewValue)
+	// 基于原始值计算字段级差异，敏感字段变更只标记不记录值
+	diffStr := ""
+	if options.OldValue != nil || options.NewValue != nil {
+		changes, err := ComputeAuditDiff(options.OldValue, options.NewValue)
 		if err != nil {
-			return fmt.Errorf("failed to marshal new value: %v", err)
+			return fmt.Errorf("failed to compute audit diff: %v", err)
 		}
-		newValueStr = string(newValue)
+		diff, err := json.Marshal(changes)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit diff: %v", err)
+		}
+		diffStr = string(diff)
 	}
 
 	// 创建审计日志记录
@@ -63,23 +68,28 @@ func (al *AuditLogger) Log(options AuditLogOptions) error {
 		ResourceID:   options.ResourceID,
 		OldValue:     oldValueStr,
 		NewValue:     newValueStr,
+		Diff:         diffStr,
 		IPAddress:    options.IPAddress,
 		UserAgent:    options.UserAgent,
 		TenantID:     options.TenantID,
 		CreatedAt:    time.Now(),
 	}
 
-	// 保存到数据库（异步保存，不阻塞主流程）
-	go func() {
-		if err := DB.Create(&auditLog).Error; err != nil {
-			Error("Failed to save audit log",
-				zap.Error(err),
-				zap.String("action", options.Action),
-				zap.String("resource_type", options.ResourceType),
-			)
-		}
-	}()
-
+	// 全局管道运行时交给管道批量写入，不阻塞主流程；未启动（如命令行工具）时同步追加到租户哈希链
+	if p := defaultAuditPipeline.Load(); p != nil && p.Enqueue(&auditLog) {
+		return nil
+	}
+	if DB == nil {
+		return fmt.Errorf("failed to save audit log: database is not initialized")
+	}
+	if err := AppendAuditLog(DB, &auditLog); err != nil {
+		Error("Failed to save audit log",
+			zap.Error(err),
+			zap.String("action", options.Action),
+			zap.String("resource_type", options.ResourceType),
+		)
+		return err
+	}
 	return nil
 }
 
@@ -130,20 +140,14 @@ func AuditLogMiddleware() gin.HandlerFunc {
 		c.Next()
 
 		// 对于写操作（POST/PUT/DELETE）进行审计日志记录
+		// 在请求协程内同步提取上下文数据，gin会在处理结束后回收Context；写入由审计管道异步完成
 		method := c.Request.Method
 		if method == "POST" || method == "PUT" || method == "DELETE" {
-			// 异步记录审计日志，避免影响响应时间
-			go func() {
-				action := strings.ToLower(method)
-				resourceType := extractResourceType(path)
-				resourceID := extractResourceID(path)
-
-				auditLogger.FromContext(c, AuditLogOptions{
-					Action:       action,
-					ResourceType: resourceType,
-					ResourceID:   resourceID,
-				})
-			}()
+			auditLogger.FromContext(c, AuditLogOptions{
+				Action:       strings.ToLower(method),
+				ResourceType: extractResourceType(path),
+				ResourceID:   extractResourceID(path),
+			})
 		}
 
 		// 记录处理时间（调试用）
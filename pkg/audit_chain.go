@@ -0,0 +1,453 @@
+package pkg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 哈希链断裂原因
+const (
+	AuditBreakSequenceGap       = "sequence_gap"         // 序号不连续，记录被删除
+	AuditBreakPrevHashMismatch  = "prev_hash_mismatch"   // 与上一条记录的哈希不一致，记录被删除或重排
+	AuditBreakHashMismatch      = "hash_mismatch"        // 记录内容与哈希不一致，记录被修改
+	AuditBreakCheckpointInvalid = "checkpoint_signature" // 检查点签名无效
+	AuditBreakCheckpointHash    = "checkpoint_mismatch"  // 记录哈希与检查点不一致，哈希链被整体重算
+	AuditBreakTruncated         = "truncated"            // 检查点之后的记录缺失，哈希链尾部被截断
+)
+
+// auditVerifyBatchSize 校验哈希链时每批读取的记录数
+const auditVerifyBatchSize = 500
+
+// auditAppendRetries 并发追加产生序号冲突时的重试次数
+const auditAppendRetries = 3
+
+// auditInsertBatchSize 单条INSERT语句包含的最大记录数
+const auditInsertBatchSize = 100
+
+// auditChainPayload 参与哈希计算的审计日志字段，字段顺序固定
+type auditChainPayload struct {
+	TenantID     uint   `json:"tenant_id"`
+	Sequence     uint64 `json:"sequence"`
+	PrevHash     string `json:"prev_hash"`
+	UserID       uint   `json:"user_id"`
+	Username     string `json:"username"`
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	OldValue     string `json:"old_value"`
+	NewValue     string `json:"new_value"`
+	Diff         string `json:"diff,omitempty"` // 引入字段级差异之前的记录没有该字段，省略后哈希保持不变
+	IPAddress    string `json:"ip_address"`
+	UserAgent    string `json:"user_agent"`
+	CreatedAt    int64  `json:"created_at"` // 毫秒时间戳，与数据库时间精度一致
+}
+
+// ComputeAuditHash 计算审计日志在哈希链中的哈希
+func ComputeAuditHash(log *models.AuditLog) string {
+	payload, _ := json.Marshal(auditChainPayload{
+		TenantID:     log.TenantID,
+		Sequence:     log.Sequence,
+		PrevHash:     log.PrevHash,
+		UserID:       log.UserID,
+		Username:     log.Username,
+		Action:       log.Action,
+		ResourceType: log.ResourceType,
+		ResourceID:   log.ResourceID,
+		OldValue:     log.OldValue,
+		NewValue:     log.NewValue,
+		Diff:         log.Diff,
+		IPAddress:    log.IPAddress,
+		UserAgent:    log.UserAgent,
+		CreatedAt:    log.CreatedAt.UnixMilli(),
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditChainLocks 按租户串行化本进程内的追加操作，跨进程的并发由唯一索引兜底
+var auditChainLocks sync.Map
+
+func auditChainLock(tenantID uint) *sync.Mutex {
+	mu, _ := auditChainLocks.LoadOrStore(tenantID, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// lastAuditLog 查询租户哈希链的链头，没有记录时返回零值
+func lastAuditLog(db *gorm.DB, tenantID uint) (models.AuditLog, error) {
+	var last models.AuditLog
+	err := db.Select("id", "tenant_id", "sequence", "hash").
+		Where("tenant_id = ? AND sequence > 0", tenantID).
+		Order("sequence DESC").Limit(1).Find(&last).Error
+	return last, err
+}
+
+// AppendAuditLog 将审计日志追加到所属租户哈希链的末尾
+func AppendAuditLog(db *gorm.DB, log *models.AuditLog) error {
+	_, err := AppendAuditLogs(db, []*models.AuditLog{log})
+	return err
+}
+
+// AppendAuditLogs 按租户批量追加审计日志，同一租户内保持传入顺序
+// 每个租户在一个事务内锁定链头并连续分配序号，多实例并发追加时依靠(tenant_id, sequence)唯一索引发现冲突并重试
+// 写入失败时返回尚未写入的记录，已写入的租户不会重复写入
+func AppendAuditLogs(db *gorm.DB, logs []*models.AuditLog) ([]*models.AuditLog, error) {
+	var tenantIDs []uint
+	groups := make(map[uint][]*models.AuditLog)
+	for _, log := range logs {
+		if log.CreatedAt.IsZero() {
+			log.CreatedAt = time.Now()
+		}
+		log.CreatedAt = log.CreatedAt.Truncate(time.Millisecond)
+		if _, ok := groups[log.TenantID]; !ok {
+			tenantIDs = append(tenantIDs, log.TenantID)
+		}
+		groups[log.TenantID] = append(groups[log.TenantID], log)
+	}
+
+	for i, tenantID := range tenantIDs {
+		if err := appendTenantAuditLogs(db, tenantID, groups[tenantID]); err != nil {
+			var unwritten []*models.AuditLog
+			for _, id := range tenantIDs[i:] {
+				unwritten = append(unwritten, groups[id]...)
+			}
+			return unwritten, err
+		}
+	}
+	return nil, nil
+}
+
+// appendTenantAuditLogs 将同一租户的审计日志追加到哈希链末尾
+func appendTenantAuditLogs(db *gorm.DB, tenantID uint, logs []*models.AuditLog) error {
+	mu := auditChainLock(tenantID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < auditAppendRetries; attempt++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			last, err := lastAuditLog(tx.Clauses(clause.Locking{Strength: "UPDATE"}), tenantID)
+			if err != nil {
+				return err
+			}
+			prev := last
+			for _, log := range logs {
+				log.ID = 0
+				log.Sequence = prev.Sequence + 1
+				log.PrevHash = prev.Hash
+				log.Hash = ComputeAuditHash(log)
+				prev = *log
+			}
+			return tx.CreateInBatches(logs, auditInsertBatchSize).Error
+		})
+		if !IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		// 写入失败时清除已分配的链字段，避免调用方落盘或重试时带上无效的序号
+		for _, log := range logs {
+			log.ID, log.Sequence, log.PrevHash, log.Hash = 0, 0, "", ""
+		}
+	}
+	return err
+}
+
+// auditCheckpointSecret 返回检查点签名密钥
+func auditCheckpointSecret() string {
+	if config.Config.Audit.CheckpointSecret != "" {
+		return config.Config.Audit.CheckpointSecret
+	}
+	return config.Config.JWT.Secret
+}
+
+// signAuditCheckpoint 计算检查点签名
+func signAuditCheckpoint(secret string, cp *models.AuditCheckpoint) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d:%d:%s:%d", cp.TenantID, cp.Sequence, cp.Hash, cp.CreatedAt.UnixMilli())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyAuditCheckpoint 校验检查点签名
+func verifyAuditCheckpoint(secret string, cp *models.AuditCheckpoint) bool {
+	if secret == "" {
+		return false
+	}
+	return hmac.Equal([]byte(signAuditCheckpoint(secret, cp)), []byte(cp.Signature))
+}
+
+// CreateAuditCheckpoint 为租户哈希链的当前链头生成签名检查点
+// 租户没有链上记录，或链头自上次检查点后没有变化时返回nil
+func CreateAuditCheckpoint(db *gorm.DB, tenantID uint) (*models.AuditCheckpoint, error) {
+	secret := auditCheckpointSecret()
+	if secret == "" {
+		return nil, fmt.Errorf("audit checkpoint secret is not configured")
+	}
+
+	head, err := lastAuditLog(db, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if head.Sequence == 0 {
+		return nil, nil
+	}
+
+	var latest models.AuditCheckpoint
+	if err := db.Where("tenant_id = ?", tenantID).Order("sequence DESC").Limit(1).Find(&latest).Error; err != nil {
+		return nil, err
+	}
+	if latest.ID != 0 && latest.Sequence >= head.Sequence {
+		return nil, nil
+	}
+
+	cp := models.AuditCheckpoint{
+		TenantID:  tenantID,
+		Sequence:  head.Sequence,
+		Hash:      head.Hash,
+		CreatedAt: time.Now().Truncate(time.Millisecond),
+	}
+	cp.Signature = signAuditCheckpoint(secret, &cp)
+	if err := db.Create(&cp).Error; err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// CreateAuditCheckpoints 为所有存在链上记录的租户生成签名检查点，返回新生成的检查点数量
+func CreateAuditCheckpoints(ctx context.Context) (int, error) {
+	db := DB.WithContext(WithoutTenantScope(ctx))
+
+	var tenantIDs []uint
+	if err := db.Model(&models.AuditLog{}).Where("sequence > 0").Distinct().Pluck("tenant_id", &tenantIDs).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, tenantID := range tenantIDs {
+		cp, err := CreateAuditCheckpoint(db, tenantID)
+		if err != nil {
+			return created, err
+		}
+		if cp != nil {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// AuditChainBreak 哈希链中第一处断裂
+type AuditChainBreak struct {
+	Sequence     uint64 `json:"sequence"`
+	AuditLogID   uint   `json:"audit_log_id,omitempty"`
+	CheckpointID uint   `json:"checkpoint_id,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// AuditVerifyResult 哈希链校验结果
+type AuditVerifyResult struct {
+	TenantID     uint             `json:"tenant_id"`
+	Valid        bool             `json:"valid"`
+	Entries      int64            `json:"entries"`   // 已校验的链上记录数
+	Unchained    int64            `json:"unchained"` // 引入哈希链之前的历史记录数，不参与校验
+	HeadSequence uint64           `json:"head_sequence"`
+	HeadHash     string           `json:"head_hash"`
+	Checkpoints  int              `json:"checkpoints"` // 已校验的检查点数
+	FirstBroken  *AuditChainBreak `json:"first_broken,omitempty"`
+	// ArchivedSequence 已归档并从数据库删除的链段的最后序号，校验从该序号之后开始
+	ArchivedSequence uint64 `json:"archived_sequence,omitempty"`
+}
+
+// fail 记录断裂位置，只保留序号最小的一处
+func (r *AuditVerifyResult) fail(b AuditChainBreak) {
+	if r.FirstBroken == nil || b.Sequence < r.FirstBroken.Sequence {
+		r.FirstBroken = &b
+	}
+	r.Valid = false
+}
+
+// AuditArchiveAnchor 返回租户已归档链段的最后一条记录，只包含序号和哈希；保留任务只删除链头之前连续的链段，
+// 没有归档时返回零值
+func AuditArchiveAnchor(db *gorm.DB, tenantID uint) (models.AuditLog, error) {
+	var archive models.RetentionArchive
+	err := db.Select("last_sequence", "last_hash").
+		Where("tenant_id = ? AND resource = ? AND last_sequence > 0", tenantID, models.RetentionResourceAuditLog).
+		Order("last_sequence DESC").Limit(1).Find(&archive).Error
+	return models.AuditLog{Sequence: archive.LastSequence, Hash: archive.LastHash}, err
+}
+
+// VerifyAuditChain 按序号遍历租户的哈希链，校验序号连续性、前后哈希链接、记录哈希和签名检查点
+// 已归档删除的链段从归档记录的最后序号和哈希接续，恢复回来的归档记录不重复校验
+// 返回的结果中FirstBroken为序号最小的断裂位置
+func VerifyAuditChain(db *gorm.DB, tenantID uint) (*AuditVerifyResult, error) {
+	result := &AuditVerifyResult{TenantID: tenantID, Valid: true}
+
+	prev, err := AuditArchiveAnchor(db, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	result.ArchivedSequence = prev.Sequence
+	result.HeadSequence, result.HeadHash = prev.Sequence, prev.Hash
+
+	if err := db.Model(&models.AuditLog{}).Where("tenant_id = ? AND (sequence IS NULL OR sequence = 0)", tenantID).
+		Count(&result.Unchained).Error; err != nil {
+		return nil, err
+	}
+
+	var checkpoints []models.AuditCheckpoint
+	if err := db.Where("tenant_id = ?", tenantID).Order("sequence ASC").Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	secret := auditCheckpointSecret()
+	pending := make(map[uint64][]models.AuditCheckpoint)
+	for _, cp := range checkpoints {
+		if cp.Sequence <= prev.Sequence {
+			// 检查点指向的记录已归档，归档时已确认链头之前的链段完整
+			continue
+		}
+		if !verifyAuditCheckpoint(secret, &cp) {
+			result.fail(AuditChainBreak{Sequence: cp.Sequence, CheckpointID: cp.ID, Reason: AuditBreakCheckpointInvalid})
+			continue
+		}
+		pending[cp.Sequence] = append(pending[cp.Sequence], cp)
+	}
+
+walk:
+	for {
+		var batch []models.AuditLog
+		if err := db.Where("tenant_id = ? AND sequence > ?", tenantID, prev.Sequence).
+			Order("sequence ASC").Limit(auditVerifyBatchSize).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			entry := &batch[i]
+			switch {
+			case entry.Sequence != prev.Sequence+1:
+				result.fail(AuditChainBreak{Sequence: prev.Sequence + 1, AuditLogID: entry.ID, Reason: AuditBreakSequenceGap})
+			case entry.PrevHash != prev.Hash:
+				result.fail(AuditChainBreak{Sequence: entry.Sequence, AuditLogID: entry.ID, Reason: AuditBreakPrevHashMismatch})
+			case ComputeAuditHash(entry) != entry.Hash:
+				result.fail(AuditChainBreak{Sequence: entry.Sequence, AuditLogID: entry.ID, Reason: AuditBreakHashMismatch})
+			}
+			for _, cp := range pending[entry.Sequence] {
+				if cp.Hash != entry.Hash {
+					result.fail(AuditChainBreak{Sequence: entry.Sequence, AuditLogID: entry.ID, CheckpointID: cp.ID, Reason: AuditBreakCheckpointHash})
+				} else {
+					result.Checkpoints++
+				}
+			}
+			delete(pending, entry.Sequence)
+			if !result.Valid && result.FirstBroken.Sequence <= entry.Sequence {
+				// 断裂之后的记录无法再证明完整性，停止遍历
+				break walk
+			}
+			result.Entries++
+			result.HeadSequence, result.HeadHash = entry.Sequence, entry.Hash
+			prev = *entry
+		}
+		if len(batch) < auditVerifyBatchSize {
+			break
+		}
+	}
+
+	// 检查点之后的记录缺失说明链尾被截断
+	if result.Valid {
+		for seq, cps := range pending {
+			result.fail(AuditChainBreak{Sequence: seq, CheckpointID: cps[0].ID, Reason: AuditBreakTruncated})
+		}
+	}
+	return result, nil
+}
+
+// VerifyAllAuditChains 校验所有租户的哈希链
+func VerifyAllAuditChains(ctx context.Context) ([]*AuditVerifyResult, error) {
+	db := DB.WithContext(WithoutTenantScope(ctx))
+
+	var tenantIDs []uint
+	if err := db.Model(&models.AuditLog{}).Distinct().Order("tenant_id").Pluck("tenant_id", &tenantIDs).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]*AuditVerifyResult, 0, len(tenantIDs))
+	for _, tenantID := range tenantIDs {
+		result, err := VerifyAuditChain(db, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// auditCheckpointer 定期生成签名检查点的后台任务
+var auditCheckpointer struct {
+	sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartAuditCheckpointer 启动签名检查点定期任务，间隔由Audit.CheckpointInterval配置
+func StartAuditCheckpointer() {
+	interval := time.Duration(config.Config.Audit.CheckpointInterval) * time.Second
+	if interval <= 0 {
+		return
+	}
+	if auditCheckpointSecret() == "" {
+		Warn("Audit checkpoint secret is not configured, signed checkpoints are disabled")
+		return
+	}
+
+	auditCheckpointer.Lock()
+	defer auditCheckpointer.Unlock()
+	if auditCheckpointer.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	auditCheckpointer.stop = stop
+	auditCheckpointer.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				count, err := CreateAuditCheckpoints(context.Background())
+				if err != nil {
+					Warn("Failed to create audit checkpoints", zap.Error(err))
+				} else if count > 0 {
+					Info("Created audit checkpoints", zap.Int("count", count))
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopAuditCheckpointer 停止签名检查点定期任务
+func StopAuditCheckpointer() {
+	auditCheckpointer.Lock()
+	stop, done := auditCheckpointer.stop, auditCheckpointer.done
+	auditCheckpointer.stop, auditCheckpointer.done = nil, nil
+	auditCheckpointer.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,259 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"weave/models"
+)
+
+// AuditRedacted 敏感字段脱敏后的占位值
+const AuditRedacted = "[REDACTED]"
+
+// 字段变更类型
+const (
+	AuditChangeAdded   = "added"
+	AuditChangeRemoved = "removed"
+	AuditChangeChanged = "changed"
+)
+
+// auditSensitiveSuffixes 字段名（去掉下划线和连字符并转小写后）以这些后缀结尾时视为敏感字段
+var auditSensitiveSuffixes = []string{"password", "passwd", "secret", "secretkey", "token", "apikey", "privatekey", "authorization", "credential", "credentials"}
+
+// auditDiffIgnoredFields 每次保存都会变化、不反映业务变更的字段
+var auditDiffIgnoredFields = map[string]bool{"updated_at": true}
+
+// IsSensitiveAuditField 判断字段是否需要脱敏，匹配password、token、secret、api_key等
+func IsSensitiveAuditField(name string) bool {
+	key := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+	if strings.Contains(key, "password") {
+		return true
+	}
+	for _, suffix := range auditSensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditFieldChange 字段级变更，嵌套对象的字段以点号连接，如settings.theme
+type AuditFieldChange struct {
+	Field    string      `json:"field"`
+	Type     string      `json:"type"` // added、removed或changed
+	Old      interface{} `json:"old"`
+	New      interface{} `json:"new"`
+	Redacted bool        `json:"redacted,omitempty"` // 敏感字段只记录发生了变化，不记录值
+}
+
+// normalizeAuditValue 将任意值转换为JSON通用结构（map、slice、json.Number等），nil保持为nil
+func normalizeAuditValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var raw []byte
+	switch value := v.(type) {
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		raw = []byte(value)
+	case json.RawMessage:
+		raw = value
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// redactAuditValue 递归替换敏感字段的值，空值保留以便区分“未设置”
+func redactAuditValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if IsSensitiveAuditField(k) {
+				if item != nil && item != "" {
+					value[k] = AuditRedacted
+				}
+				continue
+			}
+			value[k] = redactAuditValue(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactAuditValue(item)
+		}
+	}
+	return v
+}
+
+// RedactAuditValue 将值序列化为JSON并脱敏敏感字段，nil返回空字符串
+// 值为JSON字符串时按JSON解析，便于对已序列化的数据脱敏
+func RedactAuditValue(v interface{}) (string, error) {
+	normalized, err := normalizeAuditValue(v)
+	if err != nil {
+		return "", err
+	}
+	if normalized == nil {
+		return "", nil
+	}
+	out, err := json.Marshal(redactAuditValue(normalized))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// flattenAuditValue 将嵌套对象展开为“路径->值”，数组作为整体比较
+func flattenAuditValue(prefix string, v interface{}, out map[string]interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok || (len(obj) == 0 && prefix != "") {
+		if prefix == "" {
+			prefix = "value"
+		}
+		out[prefix] = v
+		return
+	}
+	for k, item := range obj {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		flattenAuditValue(path, item, out)
+	}
+}
+
+// auditPathSensitive 路径中任一层字段为敏感字段时整条路径视为敏感
+func auditPathSensitive(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		if IsSensitiveAuditField(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputeAuditDiff 计算操作前后的字段级差异，按字段名排序
+// 敏感字段用原始值比较，变更只标记为已脱敏，不输出值
+func ComputeAuditDiff(oldValue, newValue interface{}) ([]AuditFieldChange, error) {
+	oldNorm, err := normalizeAuditValue(oldValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize old value: %w", err)
+	}
+	newNorm, err := normalizeAuditValue(newValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize new value: %w", err)
+	}
+
+	oldFields := make(map[string]interface{})
+	newFields := make(map[string]interface{})
+	if oldNorm != nil {
+		flattenAuditValue("", oldNorm, oldFields)
+	}
+	if newNorm != nil {
+		flattenAuditValue("", newNorm, newFields)
+	}
+
+	paths := make(map[string]struct{}, len(oldFields)+len(newFields))
+	for path := range oldFields {
+		paths[path] = struct{}{}
+	}
+	for path := range newFields {
+		paths[path] = struct{}{}
+	}
+
+	changes := make([]AuditFieldChange, 0)
+	for path := range paths {
+		if auditDiffIgnoredFields[path] {
+			continue
+		}
+		oldItem, inOld := oldFields[path]
+		newItem, inNew := newFields[path]
+
+		change := AuditFieldChange{Field: path, Old: oldItem, New: newItem}
+		switch {
+		case !inOld:
+			change.Type = AuditChangeAdded
+		case !inNew:
+			change.Type = AuditChangeRemoved
+		default:
+			if auditValuesEqual(oldItem, newItem) {
+				continue
+			}
+			change.Type = AuditChangeChanged
+		}
+
+		if auditPathSensitive(path) {
+			change.Redacted = true
+			if change.Old != nil {
+				change.Old = AuditRedacted
+			}
+			if change.New != nil {
+				change.New = AuditRedacted
+			}
+		} else {
+			change.Old = redactAuditValue(change.Old)
+			change.New = redactAuditValue(change.New)
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// auditValuesEqual 按JSON编码比较两个值，map的键顺序不影响结果
+func auditValuesEqual(a, b interface{}) bool {
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aj, bj)
+}
+
+// RenderAuditDiff 将字段变更渲染为便于阅读的文本行，如“~ name: "a" -> "b"”
+func RenderAuditDiff(changes []AuditFieldChange) []string {
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		switch change.Type {
+		case AuditChangeAdded:
+			lines = append(lines, fmt.Sprintf("+ %s: %s", change.Field, renderAuditDiffValue(change.New)))
+		case AuditChangeRemoved:
+			lines = append(lines, fmt.Sprintf("- %s: %s", change.Field, renderAuditDiffValue(change.Old)))
+		default:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", change.Field, renderAuditDiffValue(change.Old), renderAuditDiffValue(change.New)))
+		}
+	}
+	return lines
+}
+
+func renderAuditDiffValue(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(out)
+}
+
+// AuditLogChanges 返回审计日志的字段级变更，没有保存差异的历史记录根据操作前后的值计算
+func AuditLogChanges(log *models.AuditLog) ([]AuditFieldChange, error) {
+	if log.Diff != "" {
+		var changes []AuditFieldChange
+		if err := json.Unmarshal([]byte(log.Diff), &changes); err != nil {
+			return nil, fmt.Errorf("failed to parse audit diff: %w", err)
+		}
+		return changes, nil
+	}
+	return ComputeAuditDiff(log.OldValue, log.NewValue)
+}
@@ -0,0 +1,387 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// 审计日志管道事件，对应audit_events_total指标的result标签
+const (
+	auditEventEnqueued = "enqueued"
+	auditEventWritten  = "written"
+	auditEventSpooled  = "spooled"
+	auditEventReplayed = "replayed"
+	auditEventDropped  = "dropped"
+)
+
+// auditSpoolReplayLimit 每次重放的最大落盘文件数，避免数据库刚恢复时长时间占用写入协程
+const auditSpoolReplayLimit = 10
+
+// AuditPipelineOptions 审计日志管道配置
+type AuditPipelineOptions struct {
+	QueueSize     int           // 内存队列容量
+	BatchSize     int           // 每批写入的最大记录数
+	FlushInterval time.Duration // 批量写入间隔
+	SpoolDir      string        // 落盘目录，为空时无法写入的记录直接丢弃
+}
+
+// AuditPipeline 非阻塞的审计日志写入管道
+// 记录先进入有界内存队列，由后台协程批量追加到哈希链；队列已满或数据库不可用时落盘为NDJSON文件，数据库恢复后按文件顺序重放
+type AuditPipeline struct {
+	opts  AuditPipelineOptions
+	queue chan *models.AuditLog
+
+	// mu 保证停止后不再入队，入队持读锁，停止持写锁
+	mu      sync.RWMutex
+	closed  bool
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+
+	spoolMu  sync.Mutex // 串行化落盘文件的写入与重放
+	spoolSeq atomic.Uint64
+}
+
+// NewAuditPipeline 创建审计日志管道，调用Start后开始写入
+func NewAuditPipeline(opts AuditPipelineOptions) *AuditPipeline {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	return &AuditPipeline{
+		opts:  opts,
+		queue: make(chan *models.AuditLog, opts.QueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start 启动后台写入协程
+func (p *AuditPipeline) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started || p.closed {
+		return
+	}
+	p.started = true
+	go p.run()
+}
+
+// Enqueue 将审计日志放入队列，不会阻塞调用方
+// 队列已满时同步落盘，落盘失败时丢弃并记录指标；管道已停止时返回false
+func (p *AuditPipeline) Enqueue(log *models.AuditLog) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.queue <- log:
+		metrics.RecordAuditEvents(auditEventEnqueued, 1)
+		metrics.SetAuditQueueDepth(len(p.queue))
+		return true
+	default:
+		p.spool([]*models.AuditLog{log}, "audit queue is full")
+		return true
+	}
+}
+
+// Stop 停止管道，写入队列中剩余的记录，数据库不可用时落盘
+// ctx超时后不再等待，剩余记录仍由后台协程继续落盘
+func (p *AuditPipeline) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	started := p.started
+	p.mu.Unlock()
+
+	close(p.stop)
+	if !started {
+		// 未启动时在当前协程写入已入队的记录
+		p.drain(nil)
+		return nil
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("audit pipeline flush interrupted: %w", ctx.Err())
+	}
+}
+
+// run 后台写入循环：攒够一批或到达写入间隔时写入，空闲时重放落盘文件
+func (p *AuditPipeline) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.AuditLog, 0, p.opts.BatchSize)
+	for {
+		select {
+		case log := <-p.queue:
+			batch = append(batch, log)
+			if len(batch) >= p.opts.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+			p.ReplaySpool()
+		case <-p.stop:
+			p.drain(batch)
+			return
+		}
+	}
+}
+
+// drain 写入未满一批的记录和队列中剩余的记录
+func (p *AuditPipeline) drain(batch []*models.AuditLog) {
+	for {
+		select {
+		case log := <-p.queue:
+			batch = append(batch, log)
+			if len(batch) >= p.opts.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		default:
+			if len(batch) > 0 {
+				p.flush(batch)
+			}
+			return
+		}
+	}
+}
+
+// flush 批量追加到哈希链，写入失败的记录落盘
+func (p *AuditPipeline) flush(batch []*models.AuditLog) {
+	metrics.SetAuditQueueDepth(len(p.queue))
+	if DB == nil {
+		p.spool(batch, "database is not initialized")
+		return
+	}
+
+	start := time.Now()
+	unwritten, err := AppendAuditLogs(DB, batch)
+	metrics.RecordAuditFlush(time.Since(start))
+	metrics.RecordAuditEvents(auditEventWritten, len(batch)-len(unwritten))
+	if err != nil {
+		Warn("Failed to write audit logs, spooling to disk", zap.Error(err), zap.Int("count", len(unwritten)))
+		p.spool(unwritten, err.Error())
+	}
+}
+
+// spool 将记录写入落盘文件，先写临时文件再重命名，重放时不会读到写了一半的文件
+func (p *AuditPipeline) spool(logs []*models.AuditLog, reason string) {
+	if len(logs) == 0 {
+		return
+	}
+	if err := p.writeSpoolFile(logs); err != nil {
+		metrics.RecordAuditEvents(auditEventDropped, len(logs))
+		Error("Failed to spool audit logs, dropping",
+			zap.Error(err),
+			zap.String("reason", reason),
+			zap.Int("count", len(logs)),
+		)
+		return
+	}
+	metrics.RecordAuditEvents(auditEventSpooled, len(logs))
+}
+
+func (p *AuditPipeline) writeSpoolFile(logs []*models.AuditLog) error {
+	if p.opts.SpoolDir == "" {
+		return fmt.Errorf("audit spool directory is not configured")
+	}
+
+	p.spoolMu.Lock()
+	defer p.spoolMu.Unlock()
+
+	if err := os.MkdirAll(p.opts.SpoolDir, 0700); err != nil {
+		return err
+	}
+	// 文件名按时间和序号排序，重放时保持写入顺序
+	name := fmt.Sprintf("audit-%020d-%06d.ndjson", time.Now().UnixNano(), p.spoolSeq.Add(1)%1000000)
+	tmp := filepath.Join(p.opts.SpoolDir, name+".tmp")
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, log := range logs {
+		if err = enc.Encode(log); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(p.opts.SpoolDir, name))
+}
+
+// ReplaySpool 按写入顺序重放落盘文件，数据库仍不可用时停止，返回重放的记录数
+func (p *AuditPipeline) ReplaySpool() int {
+	if p.opts.SpoolDir == "" || DB == nil {
+		return 0
+	}
+
+	p.spoolMu.Lock()
+	defer p.spoolMu.Unlock()
+
+	entries, err := os.ReadDir(p.opts.SpoolDir)
+	if err != nil {
+		return 0
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".ndjson") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	if len(files) > auditSpoolReplayLimit {
+		files = files[:auditSpoolReplayLimit]
+	}
+
+	replayed := 0
+	for _, name := range files {
+		path := filepath.Join(p.opts.SpoolDir, name)
+		logs, err := readSpoolFile(path)
+		if err != nil {
+			// 无法解析的文件改名隔离，避免阻塞后续文件
+			Error("Failed to read audit spool file", zap.String("file", path), zap.Error(err))
+			os.Rename(path, path+".corrupt")
+			continue
+		}
+		unwritten, err := AppendAuditLogs(DB, logs)
+		replayed += len(logs) - len(unwritten)
+		metrics.RecordAuditEvents(auditEventReplayed, len(logs)-len(unwritten))
+		if err != nil {
+			// 部分租户已写入时用未写入的记录覆盖原文件，避免重复写入
+			if len(unwritten) < len(logs) {
+				if rewriteErr := rewriteSpoolFile(path, unwritten); rewriteErr != nil {
+					Error("Failed to rewrite audit spool file", zap.String("file", path), zap.Error(rewriteErr))
+				}
+			}
+			Warn("Failed to replay audit spool, will retry later", zap.String("file", path), zap.Error(err))
+			break
+		}
+		if err := os.Remove(path); err != nil {
+			Error("Failed to remove replayed audit spool file", zap.String("file", path), zap.Error(err))
+		}
+	}
+	if replayed > 0 {
+		Info("Replayed spooled audit logs", zap.Int("count", replayed))
+	}
+	return replayed
+}
+
+// readSpoolFile 读取落盘文件中的审计日志，清除链字段后重新分配序号
+func readSpoolFile(path string) ([]*models.AuditLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var logs []*models.AuditLog
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var log models.AuditLog
+		if err := dec.Decode(&log); err != nil {
+			return nil, err
+		}
+		log.ID, log.Sequence, log.PrevHash, log.Hash = 0, 0, "", ""
+		log.User = models.User{}
+		logs = append(logs, &log)
+	}
+	return logs, nil
+}
+
+// rewriteSpoolFile 用剩余记录覆盖落盘文件
+func rewriteSpoolFile(path string, logs []*models.AuditLog) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, log := range logs {
+		if err = enc.Encode(log); err != nil {
+			break
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// defaultAuditPipeline 全局审计日志管道，未启动时审计日志同步写入
+var defaultAuditPipeline atomic.Pointer[AuditPipeline]
+
+// StartAuditPipeline 按Audit配置启动全局审计日志管道
+func StartAuditPipeline() {
+	p := NewAuditPipeline(AuditPipelineOptions{
+		QueueSize:     config.Config.Audit.QueueSize,
+		BatchSize:     config.Config.Audit.BatchSize,
+		FlushInterval: time.Duration(config.Config.Audit.FlushInterval) * time.Millisecond,
+		SpoolDir:      config.Config.Audit.SpoolDir,
+	})
+	if !defaultAuditPipeline.CompareAndSwap(nil, p) {
+		return
+	}
+	p.Start()
+}
+
+// StopAuditPipeline 停止全局审计日志管道并写入剩余记录，应在关闭数据库之前调用
+func StopAuditPipeline(ctx context.Context) error {
+	p := defaultAuditPipeline.Swap(nil)
+	if p == nil {
+		return nil
+	}
+	return p.Stop(ctx)
+}
@@ -0,0 +1,422 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"weave/models"
+
+	"gorm.io/gorm"
+)
+
+// 审计统计的分组维度
+const (
+	AuditStatsUser         = "user"
+	AuditStatsAction       = "action"
+	AuditStatsResourceType = "resource_type"
+	AuditStatsIP           = "ip"
+	AuditStatsHour         = "hour"
+	AuditStatsDay          = "day"
+	AuditStatsWeek         = "week"
+)
+
+// 审计统计的限制
+const (
+	AuditStatsDefaultLimit = 10
+	AuditStatsMaxLimit     = 100
+	// AuditStatsMaxBuckets 时间序列的最大时间段数，按小时统计约41天
+	AuditStatsMaxBuckets = 1000
+)
+
+// auditStatsColumns 非时间维度对应的列
+var auditStatsColumns = map[string]string{
+	AuditStatsUser:         "username",
+	AuditStatsAction:       "action",
+	AuditStatsResourceType: "resource_type",
+	AuditStatsIP:           "ip_address",
+}
+
+// auditStatsBucketLayouts 时间维度的标签格式，周以周一为起点
+var auditStatsBucketLayouts = map[string]string{
+	AuditStatsHour: "2006-01-02 15:00",
+	AuditStatsDay:  "2006-01-02",
+	AuditStatsWeek: "2006-01-02",
+}
+
+// auditStatsBucketExprs 各数据库计算时间段标签的表达式，结果与auditStatsBucketLayouts一致
+// MySQL和PostgreSQL使用会话时区，SQLite转换为本地时间
+var auditStatsBucketExprs = map[string]map[string]string{
+	"mysql": {
+		AuditStatsHour: "DATE_FORMAT(created_at, '%Y-%m-%d %H:00')",
+		AuditStatsDay:  "DATE_FORMAT(created_at, '%Y-%m-%d')",
+		AuditStatsWeek: "DATE_FORMAT(DATE_SUB(created_at, INTERVAL WEEKDAY(created_at) DAY), '%Y-%m-%d')",
+	},
+	"postgres": {
+		AuditStatsHour: "to_char(date_trunc('hour', created_at), 'YYYY-MM-DD HH24:00')",
+		AuditStatsDay:  "to_char(date_trunc('day', created_at), 'YYYY-MM-DD')",
+		AuditStatsWeek: "to_char(date_trunc('week', created_at), 'YYYY-MM-DD')",
+	},
+	"sqlite": {
+		AuditStatsHour: "strftime('%Y-%m-%d %H:00', created_at, 'localtime')",
+		AuditStatsDay:  "strftime('%Y-%m-%d', created_at, 'localtime')",
+		AuditStatsWeek: "date(created_at, 'localtime', 'weekday 0', '-6 days')",
+	},
+}
+
+// AuditStatsQuery 审计统计查询
+type AuditStatsQuery struct {
+	TenantID     uint
+	GroupBy      []string  // 分组维度，最多包含一个时间维度
+	Start        time.Time // 统计范围的开始时间（包含）
+	End          time.Time // 统计范围的结束时间（不包含）
+	Action       string
+	ResourceType string
+	Username     string
+	Limit        int  // 非时间维度只返回数量最多的前Limit组，0表示默认值
+	Compare      bool // 是否与上一个等长周期对比
+}
+
+// AuditStatsRow 一个分组的统计结果
+type AuditStatsRow struct {
+	Key      map[string]string `json:"key"`
+	Count    int64             `json:"count"`
+	Previous *int64            `json:"previous,omitempty"` // 上一周期对应分组的数量
+	Change   *float64          `json:"change,omitempty"`   // 相对上一周期的变化百分比，上一周期为0时省略
+}
+
+// AuditStatsPeriod 对比周期的汇总
+type AuditStatsPeriod struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Total  int64     `json:"total"`
+	Change *float64  `json:"change,omitempty"`
+}
+
+// AuditStatsResult 审计统计结果
+type AuditStatsResult struct {
+	GroupBy  []string          `json:"group_by"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Total    int64             `json:"total"`
+	Others   int64             `json:"others"` // 不在前Limit组中的记录数
+	Rows     []AuditStatsRow   `json:"rows"`
+	Previous *AuditStatsPeriod `json:"previous,omitempty"`
+}
+
+// auditStatsRaw 分组查询的一行，d0-d3为非时间维度
+type auditStatsRaw struct {
+	D0, D1, D2, D3 string
+	Bucket         string
+	Count          int64
+}
+
+func (r auditStatsRaw) dims(n int) []string {
+	return []string{r.D0, r.D1, r.D2, r.D3}[:n]
+}
+
+// split 拆分非时间维度和时间维度
+func (q *AuditStatsQuery) split() (dims []string, bucket string) {
+	for _, dimension := range q.GroupBy {
+		if _, ok := auditStatsBucketLayouts[dimension]; ok {
+			bucket = dimension
+		} else {
+			dims = append(dims, dimension)
+		}
+	}
+	return dims, bucket
+}
+
+// Validate 校验查询参数，并补全默认的Limit
+func (q *AuditStatsQuery) Validate() error {
+	if len(q.GroupBy) == 0 {
+		return fmt.Errorf("group_by is required")
+	}
+	seen := make(map[string]bool)
+	buckets := 0
+	for _, dimension := range q.GroupBy {
+		if seen[dimension] {
+			return fmt.Errorf("duplicate group_by dimension %q", dimension)
+		}
+		seen[dimension] = true
+		if _, ok := auditStatsBucketLayouts[dimension]; ok {
+			buckets++
+		} else if _, ok := auditStatsColumns[dimension]; !ok {
+			return fmt.Errorf("unknown group_by dimension %q", dimension)
+		}
+	}
+	if buckets > 1 {
+		return fmt.Errorf("group_by accepts at most one of hour, day and week")
+	}
+	if !q.End.After(q.Start) {
+		return fmt.Errorf("end time must be after start time")
+	}
+	if _, bucket := q.split(); bucket != "" {
+		if n := len(auditStatsBuckets(bucket, q.Start, q.End)); n > AuditStatsMaxBuckets {
+			return fmt.Errorf("time range has %d %s buckets, at most %d are allowed", n, bucket, AuditStatsMaxBuckets)
+		}
+	}
+	if q.Limit < 0 || q.Limit > AuditStatsMaxLimit {
+		return fmt.Errorf("limit must be between 1 and %d", AuditStatsMaxLimit)
+	}
+	if q.Limit == 0 {
+		q.Limit = AuditStatsDefaultLimit
+	}
+	return nil
+}
+
+// AuditStats 按维度统计审计日志
+//
+// 只有非时间维度时返回数量最多的前Limit组；同时包含时间维度时先选出前Limit组，再返回这些组补全空时间段的时间序列。
+// 所有分组和计数都在数据库中完成，每个周期最多三次查询，适合(tenant_id, created_at)索引。
+func AuditStats(db *gorm.DB, q AuditStatsQuery) (*AuditStatsResult, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	exprs, ok := auditStatsBucketExprs[db.Dialector.Name()]
+	if !ok {
+		return nil, fmt.Errorf("audit stats are not supported on %s", db.Dialector.Name())
+	}
+	dims, bucket := q.split()
+
+	result := &AuditStatsResult{GroupBy: q.GroupBy, Start: q.Start, End: q.End, Rows: []AuditStatsRow{}}
+	current, err := auditStatsPeriod(db, &q, exprs, dims, bucket, q.Start, q.End, nil)
+	if err != nil {
+		return nil, err
+	}
+	result.Total = current.total
+	result.Others = current.others
+	for _, row := range current.rows {
+		result.Rows = append(result.Rows, AuditStatsRow{Key: row.key, Count: row.count})
+	}
+
+	if !q.Compare {
+		return result, nil
+	}
+
+	// 上一周期沿用本周期的分组，时间段按序号一一对应
+	length := q.End.Sub(q.Start)
+	previous, err := auditStatsPeriod(db, &q, exprs, dims, bucket, q.Start.Add(-length), q.Start, current.combos)
+	if err != nil {
+		return nil, err
+	}
+	result.Previous = &AuditStatsPeriod{
+		Start:  q.Start.Add(-length),
+		End:    q.Start,
+		Total:  previous.total,
+		Change: percentChange(result.Total, previous.total),
+	}
+	previousCounts := make(map[[2]int]int64, len(previous.rows))
+	for _, row := range previous.rows {
+		previousCounts[[2]int{row.combo, row.index}] = row.count
+	}
+	for i, row := range current.rows {
+		count := previousCounts[[2]int{row.combo, row.index}]
+		result.Rows[i].Previous = &count
+		result.Rows[i].Change = percentChange(result.Rows[i].Count, count)
+	}
+	return result, nil
+}
+
+// auditStatsRow 一个周期内的分组结果
+type auditStatsRow struct {
+	key   map[string]string
+	count int64
+	combo int // 非时间维度组合的序号
+	index int // 时间段的序号
+}
+
+// auditStatsPeriodResult 一个周期的统计结果
+type auditStatsPeriodResult struct {
+	total  int64
+	others int64
+	combos [][]string // 按数量排序的非时间维度组合
+	rows   []auditStatsRow
+}
+
+// auditStatsPeriod 统计一个周期，combos为nil时按数量选出前Limit组，否则只统计给定的组合
+func auditStatsPeriod(db *gorm.DB, q *AuditStatsQuery, exprs map[string]string, dims []string, bucket string, start, end time.Time, combos [][]string) (*auditStatsPeriodResult, error) {
+	base := func() *gorm.DB {
+		query := db.Model(&models.AuditLog{}).
+			Where("tenant_id = ? AND created_at >= ? AND created_at < ?", q.TenantID, start, end)
+		if q.Action != "" {
+			query = query.Where("action = ?", q.Action)
+		}
+		if q.ResourceType != "" {
+			query = query.Where("resource_type = ?", q.ResourceType)
+		}
+		if q.Username != "" {
+			query = query.Where("username = ?", q.Username)
+		}
+		return query
+	}
+	selects := make([]string, 0, len(dims)+2)
+	groups := make([]string, 0, len(dims)+1)
+	for i, dimension := range dims {
+		selects = append(selects, fmt.Sprintf("COALESCE(%s, '') AS d%d", auditStatsColumns[dimension], i))
+		groups = append(groups, fmt.Sprintf("d%d", i))
+	}
+
+	result := &auditStatsPeriodResult{}
+	if err := base().Count(&result.total).Error; err != nil {
+		return nil, err
+	}
+
+	if len(dims) > 0 {
+		if combos == nil {
+			var top []auditStatsRaw
+			if err := base().Select(strings.Join(append(selects, "COUNT(*) AS count"), ", ")).
+				Group(strings.Join(groups, ", ")).
+				Order("count DESC, " + strings.Join(groups, ", ")).
+				Limit(q.Limit).
+				Scan(&top).Error; err != nil {
+				return nil, err
+			}
+			combos = make([][]string, 0, len(top))
+			for _, row := range top {
+				combos = append(combos, row.dims(len(dims)))
+			}
+		}
+		result.combos = combos
+		if len(combos) == 0 {
+			result.others = result.total
+			return result, nil
+		}
+	}
+
+	var rows []auditStatsRaw
+	query := base()
+	if len(dims) > 0 {
+		query = whereCombos(query, dims, combos)
+	}
+	if bucket != "" {
+		selects = append(selects, exprs[bucket]+" AS bucket")
+		groups = append(groups, "bucket")
+	}
+	if len(groups) > 0 {
+		query = query.Group(strings.Join(groups, ", "))
+	}
+	if err := query.Select(strings.Join(append(selects, "COUNT(*) AS count"), ", ")).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// 按组合和时间段索引查询结果
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[comboKey(row.dims(len(dims)))+"\x00"+row.Bucket] += row.Count
+	}
+	if len(dims) == 0 {
+		combos = [][]string{{}}
+	}
+	labels := []string{""}
+	if bucket != "" {
+		labels = auditStatsBuckets(bucket, start, end)
+		known := make(map[string]bool, len(labels))
+		for _, label := range labels {
+			known[label] = true
+		}
+		// 数据库时区与服务器不一致时保留数据库返回的时间段
+		for _, row := range rows {
+			if !known[row.Bucket] {
+				known[row.Bucket] = true
+				labels = insertSorted(labels, row.Bucket)
+			}
+		}
+	}
+
+	var matched int64
+	for c, combo := range combos {
+		for index, label := range labels {
+			key := make(map[string]string, len(dims)+1)
+			for i, dimension := range dims {
+				key[dimension] = combo[i]
+			}
+			if bucket != "" {
+				key[bucket] = label
+			}
+			count := counts[comboKey(combo)+"\x00"+label]
+			matched += count
+			result.rows = append(result.rows, auditStatsRow{key: key, count: count, combo: c, index: index})
+		}
+	}
+	result.others = result.total - matched
+	return result, nil
+}
+
+// whereCombos 限定非时间维度的组合
+func whereCombos(query *gorm.DB, dims []string, combos [][]string) *gorm.DB {
+	if len(dims) == 1 {
+		values := make([]string, len(combos))
+		for i, combo := range combos {
+			values[i] = combo[0]
+		}
+		return query.Where(fmt.Sprintf("COALESCE(%s, '') IN ?", auditStatsColumns[dims[0]]), values)
+	}
+	columns := make([]string, len(dims))
+	for i, dimension := range dims {
+		columns[i] = fmt.Sprintf("COALESCE(%s, '')", auditStatsColumns[dimension])
+	}
+	tuples := make([][]interface{}, len(combos))
+	for i, combo := range combos {
+		tuples[i] = make([]interface{}, len(combo))
+		for j, value := range combo {
+			tuples[i][j] = value
+		}
+	}
+	return query.Where(fmt.Sprintf("(%s) IN ?", strings.Join(columns, ", ")), tuples)
+}
+
+// auditStatsBuckets 返回[start, end)覆盖的所有时间段标签，按本地时区计算
+func auditStatsBuckets(bucket string, start, end time.Time) []string {
+	start, end = start.Local(), end.Local()
+	var t time.Time
+	switch bucket {
+	case AuditStatsHour:
+		t = time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, time.Local)
+	case AuditStatsDay:
+		t = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+	case AuditStatsWeek:
+		t = time.Date(start.Year(), start.Month(), start.Day()-(int(start.Weekday())+6)%7, 0, 0, 0, 0, time.Local)
+	default:
+		return nil
+	}
+	var labels []string
+	for t.Before(end) && len(labels) <= AuditStatsMaxBuckets {
+		labels = append(labels, t.Format(auditStatsBucketLayouts[bucket]))
+		switch bucket {
+		case AuditStatsHour:
+			t = t.Add(time.Hour)
+		case AuditStatsDay:
+			t = t.AddDate(0, 0, 1)
+		case AuditStatsWeek:
+			t = t.AddDate(0, 0, 7)
+		}
+	}
+	return labels
+}
+
+// insertSorted 将标签插入有序列表
+func insertSorted(labels []string, label string) []string {
+	i := len(labels)
+	for i > 0 && labels[i-1] > label {
+		i--
+	}
+	labels = append(labels, "")
+	copy(labels[i+1:], labels[i:])
+	labels[i] = label
+	return labels
+}
+
+func comboKey(combo []string) string {
+	return strings.Join(combo, "\x00")
+}
+
+// percentChange 计算相对变化百分比，保留一位小数；基数为0时返回nil
+func percentChange(current, previous int64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := math.Round(float64(current-previous)*1000/float64(previous)) / 10
+	return &change
+}
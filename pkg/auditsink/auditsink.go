@@ -0,0 +1,150 @@
+// Package auditsink 提供审计日志的导出格式和外部转发目标
+//
+// 转发目标（Sink）把审计日志实时发送到SIEM等外部系统，支持RFC 5424 syslog、CEF和HTTP webhook。
+// Forwarder按审计日志ID顺序轮询数据库，每个目标独立保存转发游标，发送失败时按指数退避重试，
+// 游标只在发送成功后推进，因此重启不会丢失记录；游标保存失败时可能重复发送，接收方应按id去重。
+package auditsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+)
+
+// 转发目标类型
+const (
+	TypeSyslog  = "syslog"
+	TypeCEF     = "cef"
+	TypeWebhook = "webhook"
+)
+
+// Sink 审计日志转发目标
+type Sink interface {
+	// Name 返回目标名称，用作转发游标的键
+	Name() string
+	// Send 发送一批按ID升序排列的审计日志，返回错误时整批重试
+	Send(ctx context.Context, logs []models.AuditLog) error
+	// Close 释放连接等资源
+	Close() error
+}
+
+// New 按配置创建转发目标
+func New(cfg config.AuditSinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case TypeSyslog:
+		return NewSyslogSink(cfg.Name, cfg.Network, cfg.Address, FormatSyslog), nil
+	case TypeCEF:
+		return NewSyslogSink(cfg.Name, cfg.Network, cfg.Address, FormatCEFSyslog), nil
+	case TypeWebhook:
+		return NewWebhookSink(cfg.Name, cfg.URL, cfg.Secret, cfg.Headers), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink type: %s", cfg.Type)
+	}
+}
+
+// Record 审计日志的导出和转发格式，JSON字段保持为嵌套对象而不是字符串
+type Record struct {
+	ID           uint            `json:"id"`
+	TenantID     uint            `json:"tenant_id"`
+	Sequence     uint64          `json:"sequence,omitempty"`
+	UserID       uint            `json:"user_id"`
+	Username     string          `json:"username"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	OldValue     json.RawMessage `json:"old_value,omitempty"`
+	NewValue     json.RawMessage `json:"new_value,omitempty"`
+	Diff         json.RawMessage `json:"diff,omitempty"`
+	IPAddress    string          `json:"ip_address"`
+	UserAgent    string          `json:"user_agent"`
+	Hash         string          `json:"hash,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// NewRecord 将审计日志转换为导出格式，操作前后的值再次脱敏，避免历史记录泄露敏感字段
+func NewRecord(log *models.AuditLog) Record {
+	return Record{
+		ID:           log.ID,
+		TenantID:     log.TenantID,
+		Sequence:     log.Sequence,
+		UserID:       log.UserID,
+		Username:     log.Username,
+		Action:       log.Action,
+		ResourceType: log.ResourceType,
+		ResourceID:   log.ResourceID,
+		OldValue:     redactedJSON(log.OldValue),
+		NewValue:     redactedJSON(log.NewValue),
+		Diff:         rawJSON(log.Diff),
+		IPAddress:    log.IPAddress,
+		UserAgent:    log.UserAgent,
+		Hash:         log.Hash,
+		CreatedAt:    log.CreatedAt,
+	}
+}
+
+// rawJSON 合法的JSON原样返回，否则作为字符串编码
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	if json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+	out, _ := json.Marshal(value)
+	return out
+}
+
+func redactedJSON(value string) json.RawMessage {
+	redacted, err := pkg.RedactAuditValue(value)
+	if err != nil {
+		return rawJSON(value)
+	}
+	return rawJSON(redacted)
+}
+
+// CSVHeader CSV导出的表头
+var CSVHeader = []string{
+	"id", "created_at", "tenant_id", "sequence", "user_id", "username", "action",
+	"resource_type", "resource_id", "ip_address", "user_agent", "old_value", "new_value", "diff", "hash",
+}
+
+// CSVRow 将审计日志转换为CSV行，字段顺序与CSVHeader一致
+func CSVRow(log *models.AuditLog) []string {
+	record := NewRecord(log)
+	row := []string{
+		strconv.FormatUint(uint64(record.ID), 10),
+		record.CreatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatUint(uint64(record.TenantID), 10),
+		strconv.FormatUint(record.Sequence, 10),
+		strconv.FormatUint(uint64(record.UserID), 10),
+		record.Username,
+		record.Action,
+		record.ResourceType,
+		record.ResourceID,
+		record.IPAddress,
+		record.UserAgent,
+		string(record.OldValue),
+		string(record.NewValue),
+		string(record.Diff),
+		record.Hash,
+	}
+	for i, cell := range row {
+		row[i] = escapeCSVFormula(cell)
+	}
+	return row
+}
+
+// escapeCSVFormula 以=、+、-、@等开头的单元格会被电子表格当作公式执行，加单引号前缀防止CSV注入
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
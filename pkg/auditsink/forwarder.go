@@ -0,0 +1,252 @@
+package auditsink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/metrics"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBackoff 发送失败时重试间隔的上限
+const maxBackoff = time.Minute
+
+// Options 转发配置
+type Options struct {
+	BatchSize    int           // 每次转发的最大记录数
+	PollInterval time.Duration // 没有新记录时的轮询间隔，也是失败重试的初始间隔
+	GapWait      time.Duration // 遇到ID空洞时等待的时间，0表示不等待
+}
+
+// Forwarder 按审计日志ID顺序把记录转发给各个目标，每个目标在独立的协程中运行
+type Forwarder struct {
+	db    *gorm.DB
+	sinks []Sink
+	opts  Options
+
+	// gaps 记录每个目标首次遇到ID空洞的时间
+	gapMu sync.Mutex
+	gaps  map[string]time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewForwarder 创建转发器，调用Start后开始转发
+func NewForwarder(db *gorm.DB, sinks []Sink, opts Options) *Forwarder {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	return &Forwarder{db: db, sinks: sinks, opts: opts, gaps: make(map[string]time.Time)}
+}
+
+// Start 为每个目标启动转发协程
+func (f *Forwarder) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	for _, sink := range f.sinks {
+		f.wg.Add(1)
+		go f.run(ctx, sink)
+	}
+}
+
+// Stop 停止转发并关闭所有目标，正在发送的批次会被中断，下次启动时从游标处重发
+func (f *Forwarder) Stop() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.wg.Wait()
+	for _, sink := range f.sinks {
+		sink.Close()
+	}
+}
+
+// run 转发循环：有积压时连续转发，没有新记录时按轮询间隔等待，失败时指数退避
+func (f *Forwarder) run(ctx context.Context, sink Sink) {
+	defer f.wg.Done()
+	backoff := f.opts.PollInterval
+	for {
+		n, err := f.Forward(ctx, sink)
+		wait := f.opts.PollInterval
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			pkg.Warn("Failed to forward audit logs, will retry",
+				zap.String("sink", sink.Name()),
+				zap.Duration("retry_in", backoff),
+				zap.Error(err),
+			)
+			wait = backoff
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		case n >= f.opts.BatchSize:
+			backoff = f.opts.PollInterval
+			wait = 0
+		default:
+			backoff = f.opts.PollInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Forward 从目标的游标之后读取一批审计日志并发送，成功后推进游标，返回发送的记录数
+func (f *Forwarder) Forward(ctx context.Context, sink Sink) (int, error) {
+	db := f.db.WithContext(pkg.WithoutTenantScope(ctx))
+
+	lastID, err := LoadCursor(db, sink.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	var logs []models.AuditLog
+	if err := db.Where("id > ?", lastID).Order("id").Limit(f.opts.BatchSize).Find(&logs).Error; err != nil {
+		return 0, err
+	}
+	logs = f.settle(sink.Name(), lastID, logs)
+	if len(logs) == 0 {
+		return 0, nil
+	}
+
+	if err := sink.Send(ctx, logs); err != nil {
+		metrics.RecordAuditSinkEvents(sink.Name(), "failed", len(logs))
+		return 0, err
+	}
+	metrics.RecordAuditSinkEvents(sink.Name(), "sent", len(logs))
+
+	newID := logs[len(logs)-1].ID
+	if err := saveCursor(db, sink.Name(), newID); err != nil {
+		return len(logs), err
+	}
+	metrics.SetAuditSinkCursor(sink.Name(), newID)
+	return len(logs), nil
+}
+
+// settle 处理ID空洞：较小ID的事务可能晚于较大ID提交，遇到空洞时只发送空洞之前的连续记录，
+// 空洞持续超过GapWait后视为回滚的事务留下的空号，继续发送
+func (f *Forwarder) settle(name string, lastID uint, logs []models.AuditLog) []models.AuditLog {
+	f.gapMu.Lock()
+	defer f.gapMu.Unlock()
+
+	contiguous := 0
+	expected := lastID + 1
+	for _, log := range logs {
+		if log.ID != expected {
+			break
+		}
+		contiguous++
+		expected++
+	}
+	if contiguous == len(logs) || f.opts.GapWait <= 0 {
+		delete(f.gaps, name)
+		return logs
+	}
+	if contiguous > 0 {
+		// 先发送空洞之前的记录，下次从空洞处开始计时
+		delete(f.gaps, name)
+		return logs[:contiguous]
+	}
+
+	since, ok := f.gaps[name]
+	if !ok {
+		f.gaps[name] = time.Now()
+		return nil
+	}
+	if time.Since(since) < f.opts.GapWait {
+		return nil
+	}
+	delete(f.gaps, name)
+	return logs
+}
+
+// LoadCursor 读取目标的转发游标，没有记录时从头开始
+func LoadCursor(db *gorm.DB, name string) (uint, error) {
+	var cursor models.AuditSinkCursor
+	err := db.Where("sink = ?", name).First(&cursor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return cursor.LastID, nil
+}
+
+func saveCursor(db *gorm.DB, name string, lastID uint) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sink"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_id", "updated_at"}),
+	}).Create(&models.AuditSinkCursor{Sink: name, LastID: lastID}).Error
+}
+
+// defaultForwarder 全局转发器
+var defaultForwarder struct {
+	sync.Mutex
+	f *Forwarder
+}
+
+// StartForwarder 按Audit.Sinks配置启动全局转发器，没有配置转发目标时不启动
+func StartForwarder() error {
+	if len(config.Config.Audit.Sinks) == 0 {
+		return nil
+	}
+
+	defaultForwarder.Lock()
+	defer defaultForwarder.Unlock()
+	if defaultForwarder.f != nil {
+		return nil
+	}
+
+	sinks := make([]Sink, 0, len(config.Config.Audit.Sinks))
+	for _, cfg := range config.Config.Audit.Sinks {
+		sink, err := New(cfg)
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	f := NewForwarder(pkg.DB, sinks, Options{
+		BatchSize:    config.Config.Audit.SinkBatchSize,
+		PollInterval: time.Duration(config.Config.Audit.SinkPollInterval) * time.Millisecond,
+		GapWait:      time.Duration(config.Config.Audit.SinkGapWait) * time.Millisecond,
+	})
+	f.Start()
+	defaultForwarder.f = f
+	pkg.Info("Audit log forwarding started", zap.Int("sinks", len(sinks)))
+	return nil
+}
+
+// StopForwarder 停止全局转发器
+func StopForwarder() {
+	defaultForwarder.Lock()
+	defer defaultForwarder.Unlock()
+	if defaultForwarder.f == nil {
+		return
+	}
+	defaultForwarder.f.Stop()
+	defaultForwarder.f = nil
+}
@@ -0,0 +1,235 @@
+package auditsink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"weave/models"
+)
+
+const (
+	syslogAppName = "weave"
+	// syslogFacility 对应RFC 5424中的log audit（13）
+	syslogFacility = 13
+	// syslogSDID 结构化数据ID，32473为RFC 5612保留给文档示例的企业号
+	syslogSDID = "audit@32473"
+	// syslogTimeout 建立连接和写入的超时时间
+	syslogTimeout = 5 * time.Second
+)
+
+// cefVendor、cefProduct CEF头部的厂商和产品
+const (
+	cefVendor  = "Weave"
+	cefProduct = "Weave"
+	cefVersion = "1.0"
+)
+
+// Formatter 将一条审计日志格式化为完整的syslog消息（不含传输层分帧）
+type Formatter func(log *models.AuditLog, hostname string) string
+
+// syslogSeverity 删除类操作为notice（5），其余为informational（6）
+func syslogSeverity(action string) int {
+	if strings.HasPrefix(action, "delete") || strings.HasPrefix(action, "remove") {
+		return 5
+	}
+	return 6
+}
+
+// cefSeverity CEF严重级别（0-10）
+func cefSeverity(action string) int {
+	if syslogSeverity(action) == 5 {
+		return 5
+	}
+	return 3
+}
+
+// syslogHeader 生成RFC 5424头部：<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+func syslogHeader(log *models.AuditLog, hostname string, severity int, msgID string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s",
+		syslogFacility*8+severity,
+		log.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(hostname, 255),
+		syslogAppName,
+		os.Getpid(),
+		syslogHeaderField(msgID, 32),
+	)
+}
+
+// syslogHeaderField 头部字段只允许可打印ASCII且不含空格，为空时使用NILVALUE“-”
+func syslogHeaderField(value string, maxLen int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r > 32 && r < 127 {
+			b.WriteRune(r)
+		}
+		if b.Len() >= maxLen {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// escapeSDValue 结构化数据参数值需要转义"、\和]
+func escapeSDValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// FormatSyslog 格式化为RFC 5424消息，审计字段放在结构化数据中，MSG为便于阅读的摘要
+func FormatSyslog(log *models.AuditLog, hostname string) string {
+	params := [][2]string{
+		{"id", strconv.FormatUint(uint64(log.ID), 10)},
+		{"tenant", strconv.FormatUint(uint64(log.TenantID), 10)},
+		{"seq", strconv.FormatUint(log.Sequence, 10)},
+		{"uid", strconv.FormatUint(uint64(log.UserID), 10)},
+		{"user", log.Username},
+		{"action", log.Action},
+		{"resourceType", log.ResourceType},
+		{"resourceId", log.ResourceID},
+		{"src", log.IPAddress},
+	}
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	for _, p := range params {
+		fmt.Fprintf(&sd, ` %s="%s"`, p[0], escapeSDValue(p[1]))
+	}
+	sd.WriteString("]")
+
+	username := log.Username
+	if username == "" {
+		username = "anonymous"
+	}
+	msg := strings.TrimSpace(fmt.Sprintf("%s %s %s %s", username, log.Action, log.ResourceType, log.ResourceID))
+	return syslogHeader(log, hostname, syslogSeverity(log.Action), log.Action) + " " + sd.String() + " " + msg
+}
+
+// escapeCEFHeader CEF头部字段需要转义\和|
+func escapeCEFHeader(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ").Replace(value)
+}
+
+// escapeCEFValue CEF扩展字段值需要转义\、=和换行
+func escapeCEFValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`).Replace(value)
+}
+
+// FormatCEF 格式化为CEF事件：CEF:Version|Vendor|Product|Version|SignatureID|Name|Severity|Extension
+func FormatCEF(log *models.AuditLog) string {
+	name := strings.TrimSpace(log.ResourceType + " " + log.Action)
+	ext := [][2]string{
+		{"rt", strconv.FormatInt(log.CreatedAt.UnixMilli(), 10)},
+		{"externalId", strconv.FormatUint(uint64(log.ID), 10)},
+		{"act", log.Action},
+		{"suser", log.Username},
+		{"suid", strconv.FormatUint(uint64(log.UserID), 10)},
+		{"src", log.IPAddress},
+		{"requestClientApplication", log.UserAgent},
+		{"cs1Label", "resourceType"},
+		{"cs1", log.ResourceType},
+		{"cs2Label", "resourceId"},
+		{"cs2", log.ResourceID},
+		{"cn1Label", "tenantId"},
+		{"cn1", strconv.FormatUint(uint64(log.TenantID), 10)},
+		{"cn2Label", "sequence"},
+		{"cn2", strconv.FormatUint(log.Sequence, 10)},
+	}
+	parts := make([]string, 0, len(ext))
+	for _, kv := range ext {
+		if kv[1] == "" {
+			continue
+		}
+		parts = append(parts, kv[0]+"="+escapeCEFValue(kv[1]))
+	}
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		escapeCEFHeader(cefVendor),
+		escapeCEFHeader(cefProduct),
+		escapeCEFHeader(cefVersion),
+		escapeCEFHeader(log.Action),
+		escapeCEFHeader(name),
+		cefSeverity(log.Action),
+		strings.Join(parts, " "),
+	)
+}
+
+// FormatCEFSyslog 以RFC 5424消息承载CEF事件，结构化数据为空
+func FormatCEFSyslog(log *models.AuditLog, hostname string) string {
+	return syslogHeader(log, hostname, syslogSeverity(log.Action), log.Action) + " - " + FormatCEF(log)
+}
+
+// SyslogSink 通过UDP或TCP发送syslog消息，TCP使用RFC 6587的octet-counting分帧
+type SyslogSink struct {
+	name     string
+	network  string
+	address  string
+	format   Formatter
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink 创建syslog转发目标，network为空时使用udp，连接在首次发送时建立
+func NewSyslogSink(name, network, address string, format Formatter) *SyslogSink {
+	if network == "" {
+		network = "udp"
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &SyslogSink{name: name, network: network, address: address, format: format, hostname: hostname}
+}
+
+// Name 返回目标名称
+func (s *SyslogSink) Name() string {
+	return s.name
+}
+
+// Send 逐条发送消息，写入失败时关闭连接，下次发送时重新建立
+func (s *SyslogSink) Send(ctx context.Context, logs []models.AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: syslogTimeout}
+		conn, err := dialer.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog %s: %w", s.address, err)
+		}
+		s.conn = conn
+	}
+
+	for i := range logs {
+		msg := s.format(&logs[i], s.hostname)
+		if s.network == "tcp" {
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err := s.conn.Write([]byte(msg)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("failed to write to syslog %s: %w", s.address, err)
+		}
+	}
+	return nil
+}
+
+// Close 关闭连接
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package auditsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"weave/models"
+)
+
+// SignatureHeader webhook签名请求头，值为“sha256=<HMAC-SHA256(body)的十六进制>”
+const SignatureHeader = "X-Weave-Signature"
+
+const webhookTimeout = 10 * time.Second
+
+// WebhookPayload webhook请求体
+type WebhookPayload struct {
+	Sink    string   `json:"sink"`
+	Entries []Record `json:"entries"`
+}
+
+// WebhookSink 将一批审计日志以JSON POST到HTTP地址，2xx响应视为成功
+type WebhookSink struct {
+	name    string
+	url     string
+	secret  string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookSink 创建webhook转发目标，secret非空时对请求体签名
+func NewWebhookSink(name, url, secret string, headers map[string]string) *WebhookSink {
+	return &WebhookSink{
+		name:    name,
+		url:     url,
+		secret:  secret,
+		headers: headers,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Name 返回目标名称
+func (s *WebhookSink) Name() string {
+	return s.name
+}
+
+// Send 发送一批审计日志
+func (s *WebhookSink) Send(ctx context.Context, logs []models.AuditLog) error {
+	payload := WebhookPayload{Sink: s.name, Entries: make([]Record, 0, len(logs))}
+	for i := range logs {
+		payload.Entries = append(payload.Entries, NewRecord(&logs[i]))
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	if s.secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+SignPayload(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post audit webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close webhook没有需要释放的资源
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// SignPayload 计算webhook请求体的HMAC-SHA256签名，接收方用相同密钥校验
+func SignPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -2,9 +2,11 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"weave/config"
@@ -100,6 +102,11 @@ func InitDatabase() error {
 		return fmt.Errorf("failed to connect database after %d retries: %w", maxRetries, lastErr)
 	}
 
+	// 注册租户隔离回调，按请求上下文中的租户自动过滤数据
+	if err := RegisterTenantCallbacks(DB); err != nil {
+		return fmt.Errorf("failed to register tenant callbacks: %w", err)
+	}
+
 	// 获取底层数据库连接池
 	sqlDB, err := DB.DB()
 	if err != nil {
@@ -216,3 +223,17 @@ func CloseDatabaseWithContext(ctx context.Context) error {
 
 	return nil
 }
+
+// IsDuplicateKeyError 判断是否为唯一约束冲突错误，兼容MySQL、PostgreSQL和SQLite
+func IsDuplicateKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Duplicate entry") || // MySQL 1062
+		strings.Contains(msg, "duplicate key value") || // PostgreSQL 23505
+		strings.Contains(msg, "UNIQUE constraint failed") // SQLite
+}
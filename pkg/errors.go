@@ -23,6 +23,8 @@ const (
 	AuthErrorPrefix = "AUTH_"
 	// 参数验证错误
 	ValidationErrorPrefix = "VALIDATION_"
+	// 租户错误
+	TenantErrorPrefix = "TENANT_"
 )
 
 // 常用错误码定义
@@ -35,6 +37,8 @@ const (
 	ErrConflict             ErrorCode = "CONFLICT"
 	ErrTooManyRequests      ErrorCode = "TOO_MANY_REQUESTS"
 	ErrUnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	ErrRequestTimeout       ErrorCode = "REQUEST_TIMEOUT"
+	ErrPayloadTooLarge      ErrorCode = "PAYLOAD_TOO_LARGE"
 
 	// 服务器错误
 	ErrInternalError      ErrorCode = "INTERNAL_ERROR"
@@ -69,6 +73,11 @@ const (
 	ErrValidationRange    ErrorCode = "VALIDATION_RANGE_ERROR"
 	ErrValidationUnique   ErrorCode = "VALIDATION_UNIQUE_ERROR"
 	ErrValidationLength   ErrorCode = "VALIDATION_LENGTH_ERROR"
+
+	// 租户错误
+	ErrTenantSuspended ErrorCode = "TENANT_SUSPENDED"
+	ErrTenantMismatch  ErrorCode = "TENANT_MISMATCH"
+	ErrQuotaExceeded   ErrorCode = "TENANT_QUOTA_EXCEEDED"
 )
 
 // 错误码对应的默认错误信息
@@ -80,6 +89,8 @@ var DefaultErrorMessages = map[ErrorCode]string{
 	ErrConflict:             "请求冲突",
 	ErrTooManyRequests:      "请求过于频繁",
 	ErrUnsupportedMediaType: "不支持的媒体类型",
+	ErrRequestTimeout:       "请求超时",
+	ErrPayloadTooLarge:      "请求体过大",
 	ErrInternalError:        "服务器内部错误",
 	ErrNotImplemented:       "功能尚未实现",
 	ErrServiceUnavailable:   "服务不可用",
@@ -104,6 +115,9 @@ var DefaultErrorMessages = map[ErrorCode]string{
 	ErrValidationRange:      "参数值超出范围",
 	ErrValidationUnique:     "值必须唯一",
 	ErrValidationLength:     "参数长度不符合要求",
+	ErrTenantSuspended:      "租户已暂停或已删除",
+	ErrTenantMismatch:       "禁止跨租户访问数据",
+	ErrQuotaExceeded:        "租户配额已用尽",
 }
 
 // HTTPStatusMap 错误码对应的HTTP状态码
@@ -116,6 +130,8 @@ var HTTPStatusMap = map[ErrorCode]int{
 	ErrConflict:             409,
 	ErrTooManyRequests:      429,
 	ErrUnsupportedMediaType: 415,
+	ErrRequestTimeout:       408,
+	ErrPayloadTooLarge:      413,
 
 	// 服务器错误 (5xx)
 	ErrInternalError:      500,
@@ -150,6 +166,11 @@ var HTTPStatusMap = map[ErrorCode]int{
 	ErrValidationRange:    400,
 	ErrValidationUnique:   409,
 	ErrValidationLength:   400,
+
+	// 租户错误
+	ErrTenantSuspended: 403,
+	ErrTenantMismatch:  403,
+	ErrQuotaExceeded:   403,
 }
 
 // AppError 应用错误结构
@@ -277,6 +298,14 @@ func NewUnsupportedMediaType(message string, err error) *AppError {
 	return New(ErrUnsupportedMediaType, message, err)
 }
 
+func NewRequestTimeout(message string, err error) *AppError {
+	return New(ErrRequestTimeout, message, err)
+}
+
+func NewPayloadTooLarge(message string, err error) *AppError {
+	return New(ErrPayloadTooLarge, message, err)
+}
+
 // 服务器错误辅助函数
 func NewInternalError(message string, err error) *AppError {
 	return New(ErrInternalError, message, err)
@@ -398,6 +427,19 @@ func NewValidationError(message string, err error) *AppError {
 	return NewValidationFormatError(message, err)
 }
 
+// 租户错误辅助函数
+func NewTenantSuspendedError(message string, err error) *AppError {
+	return New(ErrTenantSuspended, message, err)
+}
+
+func NewTenantMismatchError(message string, err error) *AppError {
+	return New(ErrTenantMismatch, message, err)
+}
+
+func NewQuotaExceededError(message string, err error) *AppError {
+	return New(ErrQuotaExceeded, message, err)
+}
+
 // Wrap 包装现有错误为AppError
 func Wrap(err error, code ErrorCode, message string) *AppError {
 	if err == nil {
@@ -494,6 +536,14 @@ func IsAuthError(err error) bool {
 	return false
 }
 
+func IsQuotaExceeded(err error) bool {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr.Code == ErrQuotaExceeded
+	}
+	return false
+}
+
 func IsValidationError(err error) bool {
 	var appErr *AppError
 	if errors.As(err, &appErr) {
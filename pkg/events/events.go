@@ -0,0 +1,101 @@
+// Package events 提供进程内的领域事件发布订阅
+//
+// 事件在发布方的goroutine中同步分发给订阅者，订阅者应尽快返回，耗时操作需自行异步处理。
+// 单个订阅者panic不会影响其他订阅者和发布方。
+package events
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Event 领域事件
+type Event struct {
+	Type       string                 `json:"type"`
+	TenantID   uint                   `json:"tenant_id"`
+	ActorID    uint                   `json:"actor_id"` // 触发事件的用户ID，系统任务为0
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+}
+
+// Handler 事件处理函数
+type Handler func(Event)
+
+// Wildcard 订阅所有类型的事件
+const Wildcard = "*"
+
+// Bus 事件总线
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	logger   *zap.Logger
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// SetLogger 设置记录订阅者panic的日志器
+func (b *Bus) SetLogger(logger *zap.Logger) {
+	b.mu.Lock()
+	b.logger = logger
+	b.mu.Unlock()
+}
+
+// Subscribe 订阅指定类型的事件，eventType为Wildcard时订阅所有事件
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+	b.mu.Unlock()
+}
+
+// Publish 发布事件
+func (b *Bus) Publish(event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers[event.Type])+len(b.handlers[Wildcard]))
+	handlers = append(handlers, b.handlers[event.Type]...)
+	handlers = append(handlers, b.handlers[Wildcard]...)
+	logger := b.logger
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		b.dispatch(handler, event, logger)
+	}
+}
+
+// dispatch 调用单个订阅者并隔离其panic
+func (b *Bus) dispatch(handler Handler, event Event, logger *zap.Logger) {
+	defer func() {
+		if r := recover(); r != nil && logger != nil {
+			logger.Error("Event handler panicked",
+				zap.String("event_type", event.Type),
+				zap.Any("panic", r))
+		}
+	}()
+	handler(event)
+}
+
+// defaultBus 全局事件总线
+var defaultBus = NewBus()
+
+// Default 返回全局事件总线
+func Default() *Bus {
+	return defaultBus
+}
+
+// Subscribe 在全局事件总线上订阅事件
+func Subscribe(eventType string, handler Handler) {
+	defaultBus.Subscribe(eventType, handler)
+}
+
+// Publish 在全局事件总线上发布事件
+func Publish(event Event) {
+	defaultBus.Publish(event)
+}
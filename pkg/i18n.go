@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 支持的错误信息语言
+const (
+	LangZhCN = "zh-CN"
+	LangEn   = "en"
+)
+
+// ErrorTitles 各语言下错误码的标题，中文沿用DefaultErrorMessages
+var ErrorTitles = map[string]map[ErrorCode]string{
+	LangZhCN: DefaultErrorMessages,
+	LangEn: {
+		ErrBadRequest:           "Bad request",
+		ErrUnauthorized:         "Unauthorized",
+		ErrForbidden:            "Forbidden",
+		ErrNotFound:             "Resource not found",
+		ErrConflict:             "Conflict",
+		ErrTooManyRequests:      "Too many requests",
+		ErrUnsupportedMediaType: "Unsupported media type",
+		ErrRequestTimeout:       "Request timeout",
+		ErrPayloadTooLarge:      "Payload too large",
+		ErrInternalError:        "Internal server error",
+		ErrNotImplemented:       "Not implemented",
+		ErrServiceUnavailable:   "Service unavailable",
+		ErrGatewayTimeout:       "Gateway timeout",
+		ErrDatabaseError:        "Database error",
+		ErrDatabaseConnection:   "Database connection failed",
+		ErrDatabaseQuery:        "Database query error",
+		ErrDatabaseTransaction:  "Database transaction error",
+		ErrDatabaseConstraint:   "Database constraint violation",
+		ErrPluginError:          "Plugin error",
+		ErrPluginNotFound:       "Plugin not found",
+		ErrPluginDisabled:       "Plugin disabled",
+		ErrPluginDependency:     "Plugin dependency error",
+		ErrPluginInit:           "Plugin initialization failed",
+		ErrPluginExecution:      "Plugin execution error",
+		ErrAuthInvalidToken:     "Invalid token",
+		ErrAuthExpiredToken:     "Token expired",
+		ErrAuthInsufficientRole: "Insufficient role",
+		ErrAuthRateLimited:      "Authentication rate limited",
+		ErrValidationRequired:   "Missing required parameter",
+		ErrValidationFormat:     "Invalid parameter format",
+		ErrValidationRange:      "Parameter out of range",
+		ErrValidationUnique:     "Value must be unique",
+		ErrValidationLength:     "Invalid parameter length",
+		ErrTenantSuspended:      "Tenant suspended or deleted",
+		ErrTenantMismatch:       "Cross-tenant access denied",
+		ErrQuotaExceeded:        "Tenant quota exceeded",
+	},
+}
+
+// validationTemplates 字段校验失败的提示模板，{field}为字段名，{param}为校验参数
+var validationTemplates = map[string]map[string]string{
+	LangZhCN: {
+		"required": "{field}不能为空",
+		"email":    "{field}必须是有效的邮箱地址",
+		"url":      "{field}必须是有效的URL",
+		"min":      "{field}的长度或值不能小于{param}",
+		"max":      "{field}的长度或值不能大于{param}",
+		"len":      "{field}的长度必须为{param}",
+		"gte":      "{field}必须大于或等于{param}",
+		"lte":      "{field}必须小于或等于{param}",
+		"gt":       "{field}必须大于{param}",
+		"lt":       "{field}必须小于{param}",
+		"oneof":    "{field}必须是以下值之一：{param}",
+		"eqfield":  "{field}必须与{param}一致",
+		"alphanum": "{field}只能包含字母和数字",
+		"numeric":  "{field}必须是数字",
+		"type":     "{field}的类型不正确",
+		"default":  "{field}格式不正确",
+	},
+	LangEn: {
+		"required": "{field} is required",
+		"email":    "{field} must be a valid email address",
+		"url":      "{field} must be a valid URL",
+		"min":      "{field} must be at least {param}",
+		"max":      "{field} must be at most {param}",
+		"len":      "{field} must have length {param}",
+		"gte":      "{field} must be greater than or equal to {param}",
+		"lte":      "{field} must be less than or equal to {param}",
+		"gt":       "{field} must be greater than {param}",
+		"lt":       "{field} must be less than {param}",
+		"oneof":    "{field} must be one of: {param}",
+		"eqfield":  "{field} must match {param}",
+		"alphanum": "{field} may only contain letters and digits",
+		"numeric":  "{field} must be numeric",
+		"type":     "{field} has the wrong type",
+		"default":  "{field} is invalid",
+	},
+}
+
+// NegotiateLanguage 根据Accept-Language选择错误信息语言
+// 按q值从高到低匹配zh*和en*，没有请求头或都不支持时返回空字符串，表示保持原始信息
+func NegotiateLanguage(acceptLanguage string) string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		switch {
+		case c.tag == "zh" || strings.HasPrefix(c.tag, "zh-"):
+			return LangZhCN
+		case c.tag == "en" || strings.HasPrefix(c.tag, "en-"):
+			return LangEn
+		}
+	}
+	return ""
+}
+
+// ErrorTitle 返回错误码在指定语言下的标题，语言为空时使用中文
+func ErrorTitle(lang string, code ErrorCode) string {
+	if lang == "" {
+		lang = LangZhCN
+	}
+	if title, ok := ErrorTitles[lang][code]; ok {
+		return title
+	}
+	if title, ok := ErrorTitles[LangEn][code]; ok {
+		return title
+	}
+	return string(code)
+}
+
+// LocalizeMessage 翻译错误信息，目录中没有对应条目或语言为空时返回原文
+func LocalizeMessage(lang, message string) string {
+	if translated, ok := MessageCatalogs[lang][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// localizeValidation 生成字段校验失败的提示
+func localizeValidation(lang, field, tag, param string) string {
+	if lang == "" {
+		lang = LangEn
+	}
+	templates := validationTemplates[lang]
+	template, ok := templates[tag]
+	if !ok {
+		template = templates["default"]
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(template)
+}
@@ -0,0 +1,257 @@
+package pkg
+
+// MessageCatalogs 错误信息的翻译目录，键为代码中的原始信息
+// 服务端信息以英文为主，zh-CN目录提供中文翻译；少数中文信息（如插件）由en目录提供英文翻译
+var MessageCatalogs = map[string]map[string]string{
+	LangZhCN: {
+		"A pending invitation already exists for this user":          "该用户已有待处理的邀请",
+		"Archive storage is not available":                           "归档存储不可用",
+		"Audit log not found":                                        "审计日志不存在",
+		"Authorization header format must be Bearer {token}":         "Authorization请求头格式必须为Bearer {token}",
+		"Authorization header is required":                           "缺少Authorization请求头",
+		"CSRF token validation failed":                               "CSRF令牌校验失败",
+		"Cannot change the owner's role, transfer ownership instead": "不能修改所有者的角色，请改为转移所有权",
+		"Cannot delete the tenant you belong to":                     "不能删除自己所属的租户",
+		"Cannot invite yourself":                                     "不能邀请自己",
+		"Cannot remove team owner":                                   "不能移除团队所有者",
+		"Cannot share a resource with yourself":                      "不能将资源共享给自己",
+		"Conversation not found":                                     "对话不存在",
+		"Database health check failed":                               "数据库健康检查失败",
+		"Document is too large":                                      "文档过大",
+		"Document not found":                                         "文档不存在",
+		"Document with the same content already exists":              "已存在内容相同的文档",
+		"Email already registered":                                   "邮箱已被注册",
+		"Exactly one of username or email is required":               "用户名和邮箱必须且只能提供一个",
+		"Failed to activate prompt template version":                 "启用提示词模板版本失败",
+		"Failed to add team member":                                  "添加团队成员失败",
+		"Failed to check resource access":                            "检查资源访问权限失败",
+		"Failed to check tool access":                                "检查工具访问权限失败",
+		"Failed to clear messages":                                   "清空对话消息失败",
+		"Failed to compute audit diff":                               "计算审计日志变更失败",
+		"Failed to count archives":                                   "统计归档数量失败",
+		"Failed to count audit logs":                                 "统计审计日志数量失败",
+		"Failed to count security alerts":                            "统计安全告警数量失败",
+		"Failed to create conversation":                              "创建对话失败",
+		"Failed to create invitation":                                "创建邀请失败",
+		"Failed to create prompt template version":                   "创建提示词模板版本失败",
+		"Failed to create team":                                      "创建团队失败",
+		"Failed to create tenant":                                    "创建租户失败",
+		"Failed to create tool":                                      "创建工具失败",
+		"Failed to create user":                                      "创建用户失败",
+		"Failed to deactivate prompt template":                       "停用提示词模板失败",
+		"Failed to delete conversation":                              "删除对话失败",
+		"Failed to delete document":                                  "删除文档失败",
+		"Failed to delete document chunks":                           "删除文档切片失败",
+		"Failed to delete tenant":                                    "删除租户失败",
+		"Failed to delete tool":                                      "删除工具失败",
+		"Failed to delete user":                                      "删除用户失败",
+		"Failed to encrypt password":                                 "密码加密失败",
+		"Failed to fetch LLM usage":                                  "获取模型用量失败",
+		"Failed to fetch archives":                                   "获取归档列表失败",
+		"Failed to fetch audit logs":                                 "获取审计日志失败",
+		"Failed to fetch daily usage":                                "获取每日用量失败",
+		"Failed to fetch prompt template versions":                   "获取提示词模板版本失败",
+		"Failed to fetch prompt templates":                           "获取提示词模板失败",
+		"Failed to fetch quota":                                      "获取配额失败",
+		"Failed to fetch security alerts":                            "获取安全告警失败",
+		"Failed to fetch tenant LLM config":                          "获取租户LLM配置失败",
+		"Failed to fetch tenant quota":                               "获取租户配额失败",
+		"Failed to fetch tenant usage":                               "获取租户用量失败",
+		"Failed to fetch tenants":                                    "获取租户列表失败",
+		"Failed to fetch tools":                                      "获取工具列表失败",
+		"Failed to fetch usage breakdown":                            "获取用量明细失败",
+		"Failed to fetch usage":                                      "获取用量失败",
+		"Failed to fetch users":                                      "获取用户列表失败",
+		"Failed to generate access token":                            "生成访问令牌失败",
+		"Failed to generate refresh token":                           "生成刷新令牌失败",
+		"Failed to get LLM instance":                                 "获取LLM实例失败",
+		"Failed to get action stats":                                 "获取操作统计失败",
+		"Failed to get daily stats":                                  "获取每日统计失败",
+		"Failed to get resource stats":                               "获取资源统计失败",
+		"Failed to get retention policies":                           "获取保留策略失败",
+		"Failed to get retention policy":                             "获取保留策略失败",
+		"Failed to load conversation":                                "获取对话失败",
+		"Failed to load conversations":                               "获取对话列表失败",
+		"Failed to load documents":                                   "加载文档失败",
+		"Failed to load messages":                                    "获取对话消息失败",
+		"Failed to load prompt template":                             "加载提示词模板失败",
+		"Failed to load tools":                                       "获取工具列表失败",
+		"Failed to query audit stats":                                "查询审计统计失败",
+		"Failed to query invitations":                                "查询邀请失败",
+		"Failed to query plugin scope":                               "查询插件范围失败",
+		"Failed to query share subject":                              "查询共享对象失败",
+		"Failed to query shared resources":                           "查询共享资源失败",
+		"Failed to query shares":                                     "查询共享失败",
+		"Failed to query team member":                                "查询团队成员失败",
+		"Failed to query team members":                               "查询团队成员失败",
+		"Failed to query team membership":                            "查询团队成员关系失败",
+		"Failed to query team memberships":                           "查询团队成员关系失败",
+		"Failed to query team":                                       "查询团队失败",
+		"Failed to query teams":                                      "查询团队列表失败",
+		"Failed to read request body":                                "读取请求体失败",
+		"Failed to register user":                                    "注册用户失败",
+		"Failed to remove plugin scope":                              "移除插件范围失败",
+		"Failed to remove team member":                               "移除团队成员失败",
+		"Failed to rename conversation":                              "重命名对话失败",
+		"Failed to render prompt template":                           "渲染提示词模板失败",
+		"Failed to resolve prompt template":                          "解析提示词模板失败",
+		"Failed to resolve tenant LLM models":                        "解析租户LLM模型失败",
+		"Failed to restore archives":                                 "恢复归档失败",
+		"Failed to revoke share":                                     "撤销共享失败",
+		"Failed to save document":                                    "保存文档失败",
+		"Failed to save messages":                                    "保存对话消息失败",
+		"Failed to save plugin scope":                                "保存插件范围失败",
+		"Failed to save share":                                       "保存共享失败",
+		"Failed to search team members":                              "搜索团队成员失败",
+		"Failed to transfer team ownership":                          "转移团队所有权失败",
+		"Failed to update conversation":                              "更新对话失败",
+		"Failed to update invitation":                                "更新邀请失败",
+		"Failed to update member role":                               "更新成员角色失败",
+		"Failed to update retention policy":                          "更新保留策略失败",
+		"Failed to update security alert":                            "更新安全告警失败",
+		"Failed to update team hierarchy":                            "更新团队层级失败",
+		"Failed to update team":                                      "更新团队失败",
+		"Failed to update tenant LLM config":                         "更新租户LLM配置失败",
+		"Failed to update tenant quota":                              "更新租户配额失败",
+		"Failed to update tenant status":                             "更新租户状态失败",
+		"Failed to update tenant":                                    "更新租户失败",
+		"Failed to update tool":                                      "更新工具失败",
+		"Failed to update user":                                      "更新用户失败",
+		"Failed to verify audit chain":                               "校验审计日志哈希链失败",
+		"Internal server error":                                      "服务器内部错误",
+		"Invalid LLM config":                                         "无效的LLM配置",
+		"Invalid LLM configuration":                                  "LLM配置无效",
+		"Invalid alert status":                                       "告警状态无效",
+		"Invalid chat request":                                       "对话请求无效",
+		"Invalid conversation ID":                                    "对话ID无效",
+		"Invalid conversation data":                                  "对话数据无效",
+		"Invalid document":                                           "无效的文档",
+		"Invalid document ID":                                        "无效的文档ID",
+		"Invalid end_time, expected RFC3339":                         "end_time无效，应为RFC3339格式",
+		"Invalid export format, must be csv or ndjson":               "导出格式无效，必须是csv或ndjson",
+		"Invalid from date, expected YYYY-MM-DD":                     "开始日期无效，应为YYYY-MM-DD格式",
+		"Invalid invitation data":                                    "邀请数据无效",
+		"Invalid limit":                                              "limit参数无效",
+		"Invalid member ID":                                          "成员ID无效",
+		"Invalid member data":                                        "成员数据无效",
+		"Invalid or expired token":                                   "令牌无效或已过期",
+		"Invalid owner data":                                         "所有者数据无效",
+		"Invalid plugin scope data":                                  "插件范围数据无效",
+		"Invalid prompt template":                                    "提示词模板无效",
+		"Invalid prompt template name":                               "提示词模板名称无效",
+		"Invalid prompt template version":                            "提示词模板版本无效",
+		"Invalid question":                                           "问题无效",
+		"Invalid quota data":                                         "配额数据无效",
+		"Invalid refresh token":                                      "刷新令牌无效",
+		"Invalid registration data":                                  "注册数据无效",
+		"Invalid render request":                                     "渲染请求无效",
+		"Invalid restore request":                                    "恢复请求无效",
+		"Invalid retention policy":                                   "保留策略无效",
+		"Invalid role data":                                          "角色数据无效",
+		"Invalid share data":                                         "共享数据无效",
+		"Invalid start_time, expected RFC3339":                       "start_time无效，应为RFC3339格式",
+		"Invalid team ID":                                            "团队ID无效",
+		"Invalid team data":                                          "团队数据无效",
+		"Invalid tenant ID":                                          "租户ID无效",
+		"Invalid tenant data":                                        "租户数据无效",
+		"Invalid to date, expected YYYY-MM-DD":                       "结束日期无效，应为YYYY-MM-DD格式",
+		"Invalid tool data":                                          "工具数据无效",
+		"Invalid user ID":                                            "用户ID无效",
+		"Invalid user data":                                          "用户数据无效",
+		"Invalid username or password":                               "用户名或密码错误",
+		"Invalid weight value. Must be between 1 and 10.":            "权重无效，必须在1到10之间",
+		"Invitation has expired":                                     "邀请已过期",
+		"Invitation is no longer pending":                            "邀请已处理",
+		"Invitation not found":                                       "邀请不存在",
+		"Knowledge base is unavailable":                              "知识库不可用",
+		"Knowledge base request failed":                              "知识库请求失败",
+		"LLM request failed":                                         "LLM请求失败",
+		"Missing required login fields":                              "缺少必要的登录字段",
+		"No LLM model available":                                     "没有可用的LLM模型",
+		"Only platform administrators can manage tenants":            "只有平台管理员可以管理租户",
+		"Only platform administrators can view other tenants":        "只有平台管理员可以查看其他租户",
+		"Only resource owners or admins can manage sharing":          "只有资源所有者或管理员可以管理共享",
+		"Only team owners can transfer ownership":                    "只有团队所有者可以转移所有权",
+		"Only team owners can update member roles":                   "只有团队所有者可以修改成员角色",
+		"Only team owners can update team information":               "只有团队所有者可以修改团队信息",
+		"Parent team not found":                                      "上级团队不存在",
+		"Passwords do not match":                                     "两次输入的密码不一致",
+		"Plugin is disabled":                                         "插件已禁用",
+		"Plugin not found":                                           "插件不存在",
+		"Plugin scope changed, please retry":                         "插件范围已被修改，请重试",
+		"Plugin scope not found":                                     "插件范围不存在",
+		"Prompt template deactivated":                                "提示词模板已停用",
+		"Prompt template not found":                                  "提示词模板不存在",
+		"Prompt template version not found":                          "提示词模板版本不存在",
+		"Quota limits cannot be negative":                            "配额不能为负数",
+		"Rate limit exceeded. Please try again later.":               "请求过于频繁，请稍后重试",
+		"Refresh token is required":                                  "缺少刷新令牌",
+		"Request body too large":                                     "请求体过大",
+		"Request timeout":                                            "请求超时",
+		"Resource not found":                                         "资源不存在",
+		"Restore range end must not be before its start":             "恢复范围的结束时间不能早于开始时间",
+		"Retention policy was modified concurrently":                 "保留策略已被并发修改",
+		"Search keyword is required":                                 "缺少搜索关键字",
+		"Security alert not found":                                   "安全告警不存在",
+		"Security alerts about yourself must be handled by another administrator": "与自己有关的安全告警必须由其他管理员处理",
+		"Service temporarily unavailable after retries":                           "重试后服务仍暂时不可用",
+		"Share changed, please retry":                                             "共享已被修改，请重试",
+		"Share not found":                                                         "共享不存在",
+		"Share subject not found":                                                 "共享对象不存在",
+		"Streaming is not supported by the LLM plugin":                            "LLM插件不支持流式响应",
+		"System health is degraded":                                               "系统健康状态降级",
+		"Team ID is required":                                                     "缺少团队ID",
+		"Team cannot be moved under itself or its descendants":                    "团队不能移动到自身或其下级团队之下",
+		"Team member changed, please retry":                                       "团队成员已被修改，请重试",
+		"Team member not found":                                                   "团队成员不存在",
+		"Team membership changed, please retry":                                   "团队成员关系已被修改，请重试",
+		"Team name already exists":                                                "团队名称已存在",
+		"Team not found":                                                          "团队不存在",
+		"Tenant does not allow self registration":                                 "租户不允许自助注册",
+		"Tenant is not active":                                                    "租户未激活",
+		"Tenant is suspended or deleted":                                          "租户已暂停或已删除",
+		"Tenant not found":                                                        "租户不存在",
+		"Tenant slug already exists":                                              "租户标识已存在",
+		"Tenant slug must be 3-64 lowercase letters, digits or hyphens":           "租户标识必须是3-64个小写字母、数字或连字符",
+		"The new owner must be a team member":                                     "新的所有者必须是团队成员",
+		"Tool calling is not supported for streaming":                             "流式接口不支持工具调用",
+		"Tool not found":                                                          "工具不存在",
+		"Unknown model":                                                           "未知的模型",
+		"Unknown retention resource":                                              "未知的保留资源",
+		"Unknown usage grouping":                                                  "未知的用量分组方式",
+		"Unknown usage metric":                                                    "未知的用量指标",
+		"Unsupported document type":                                               "不支持的文档类型",
+		"Unsupported resource type":                                               "不支持的资源类型",
+		"User is already a member of the team":                                    "用户已是团队成员",
+		"User not found":                                                          "用户不存在",
+		"Username already exists":                                                 "用户名已存在",
+	},
+	LangEn: {
+		"Protobuf序列化失败":          "Failed to serialize Protobuf",
+		"scope必须是own、shared或all": "scope must be own, shared or all",
+		"笔记数据无效":                 "Invalid note data",
+		"依赖插件执行失败":               "Dependency plugin execution failed",
+		"请求数据无效":                 "Invalid request data",
+		"内容不能为空":                 "Content must not be empty",
+		"创建笔记失败，请稍后重试":           "Failed to create note, please try again later",
+		"删除笔记失败，请稍后重试":           "Failed to delete note, please try again later",
+		"加载签名密钥失败":               "Failed to load signing keys",
+		"插件不存在":                  "Plugin not found",
+		"搜索笔记失败，请稍后重试":           "Failed to search notes, please try again later",
+		"无权执行该操作，需要更高的共享权限":      "Operation not permitted, a higher share permission is required",
+		"更新笔记失败，请稍后重试":           "Failed to update note, please try again later",
+		"标题不能为空":                 "Title must not be empty",
+		"消息不能为空":                 "Message must not be empty",
+		"笔记不存在或无权访问":             "Note not found or access denied",
+		"缺少笔记ID参数":               "Note ID is required",
+		"获取笔记列表失败，请稍后重试":         "Failed to list notes, please try again later",
+		"获取笔记失败，请稍后重试":           "Failed to get note, please try again later",
+		"解析JSON失败":               "Failed to parse JSON",
+		"解析Protobuf失败":           "Failed to parse Protobuf",
+		"解析YAML失败":               "Failed to parse YAML",
+		"读取请求体失败":                "Failed to read request body",
+		"转换为JSON失败":              "Failed to convert to JSON",
+		"转换为Protobuf结构失败":        "Failed to convert to a Protobuf structure",
+		"转换为YAML失败":              "Failed to convert to YAML",
+	},
+}
@@ -0,0 +1,305 @@
+// Package llmcache 缓存LLM对话和知识库问答的回答，避免重复的问题每次都调用模型
+//
+// 缓存按租户、调用类型、模型和上下文分桶：对话的上下文是问题之前的提示词（系统提示词、摘要和历史消息），
+// 知识库问答的上下文是检索到的文档ID。同一个桶中规范化后相同的问题直接命中；
+// 配置了相似度阈值和嵌入模型时，问题向量与桶中问题的余弦相似度达到阈值也视为命中。
+// 不同租户的条目位于不同的桶，互不可见。存储出错时按未命中处理，不影响正常调用。
+package llmcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"weave/config"
+	"weave/pkg"
+	"weave/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// 调用类型
+const (
+	KindChat = "chat" // LLM对话
+	KindRAG  = "rag"  // 知识库问答
+)
+
+// 查询结果，同时作为指标的result标签
+const (
+	ResultHit     = "hit"     // 规范化后的问题相同
+	ResultSimilar = "similar" // 问题向量的相似度达到阈值
+	ResultMiss    = "miss"
+	ResultError   = "error" // 存储出错，按未命中处理
+)
+
+// maxBucketEntries 每个桶最多保留的条目数，相似问题匹配需要遍历整个桶
+const maxBucketEntries = 100
+
+// Embedder 计算问题的向量，用于匹配相似问题
+type Embedder func(ctx context.Context, text string) ([]float32, error)
+
+// Entry 一条缓存的回答
+type Entry struct {
+	Question  string    `json:"question"` // 规范化后的问题
+	Vector    []float32 `json:"vector,omitempty"`
+	Response  string    `json:"response"`
+	Model     string    `json:"model"` // 实际生成回答的提供方/模型
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expired 返回条目是否已过期
+func (e *Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.After(now)
+}
+
+// Store 缓存条目的存储，桶名以“租户ID:”开头
+type Store interface {
+	// Get 返回桶中指定问题的条目，不存在或已过期时返回nil
+	Get(ctx context.Context, bucket, key string) (*Entry, error)
+	// Entries 返回桶中未过期的条目
+	Entries(ctx context.Context, bucket string) ([]Entry, error)
+	// Put 保存条目，桶中条目超过maxBucketEntries时淘汰最早的条目
+	Put(ctx context.Context, bucket, key string, entry Entry) error
+	// Purge 删除租户的所有条目
+	Purge(ctx context.Context, tenantID uint) error
+}
+
+// Request 一次调用的缓存键
+type Request struct {
+	TenantID uint
+	Kind     string
+	Model    string   // 计划使用的主模型，“提供方/模型”
+	Context  string   // 问题之前的提示词，为空表示没有上下文
+	DocIDs   []string // 检索到的文档ID，与顺序无关
+	Question string
+}
+
+// Result 缓存查询结果，未命中时传给Save保存生成的回答
+type Result struct {
+	Result     string
+	Response   string
+	Model      string
+	Similarity float64
+
+	kind     string
+	bucket   string
+	key      string
+	question string
+	vector   []float32
+}
+
+// Hit 返回是否命中缓存
+func (r *Result) Hit() bool {
+	return r.Result == ResultHit || r.Result == ResultSimilar
+}
+
+// Cache 回答缓存，nil表示未启用缓存
+type Cache struct {
+	store     Store
+	embedder  Embedder
+	ttl       time.Duration
+	threshold float64
+}
+
+// Options 缓存参数
+type Options struct {
+	TTL       time.Duration
+	Threshold float64  // 相似问题的余弦相似度阈值，0表示只按原文匹配
+	Embedder  Embedder // 为nil时只按原文匹配
+}
+
+// New 创建使用指定存储的缓存
+func New(store Store, opts Options) *Cache {
+	cache := &Cache{store: store, ttl: opts.TTL, threshold: opts.Threshold}
+	if opts.Threshold > 0 {
+		cache.embedder = opts.Embedder
+	}
+	return cache
+}
+
+// FromConfig 按config.Config.LLM.Cache创建缓存，未启用时返回nil
+func FromConfig(embedder Embedder) (*Cache, error) {
+	cfg := config.Config.LLM.Cache
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var store Store
+	switch cfg.Store {
+	case "redis":
+		redisStore, err := NewRedisStore(cfg.RedisAddr)
+		if err != nil {
+			return nil, err
+		}
+		store = redisStore
+	case "memory", "":
+		store = NewMemoryStore(cfg.MaxEntries)
+	default:
+		return nil, fmt.Errorf("unknown llm cache store: %s", cfg.Store)
+	}
+	return New(store, Options{
+		TTL:       time.Duration(cfg.TTL) * time.Second,
+		Threshold: cfg.SimilarityThreshold,
+		Embedder:  embedder,
+	}), nil
+}
+
+// Lookup 查询问题的缓存回答，缓存未启用或出错时返回未命中
+func (c *Cache) Lookup(ctx context.Context, req Request) *Result {
+	if c == nil {
+		return &Result{Result: ResultMiss}
+	}
+
+	result := newResult(req)
+	entry, err := c.store.Get(ctx, result.bucket, result.key)
+	if err == nil && entry != nil && !entry.expired(time.Now()) {
+		result.hit(ResultHit, entry, 1)
+	} else if err == nil && c.embedder != nil {
+		err = c.matchSimilar(ctx, result)
+	}
+
+	if err != nil {
+		pkg.Warn("LLM cache lookup failed", zap.String("kind", req.Kind), zap.Uint("tenant_id", req.TenantID), zap.Error(err))
+		result.Result = ResultError
+	}
+	metrics.RecordLLMCacheLookup(req.Kind, result.Result, result.Similarity)
+	return result
+}
+
+// Skip 不查询缓存，返回可以传给Save的未命中结果，用于请求要求重新生成回答时
+func (c *Cache) Skip(req Request) *Result {
+	if c == nil {
+		return &Result{Result: ResultMiss}
+	}
+	return newResult(req)
+}
+
+// newResult 返回请求的未命中结果
+func newResult(req Request) *Result {
+	question := Normalize(req.Question)
+	return &Result{
+		Result:   ResultMiss,
+		kind:     req.Kind,
+		bucket:   bucketName(req),
+		key:      hash(question),
+		question: question,
+	}
+}
+
+// matchSimilar 在桶中查找与问题最相似的条目，相似度达到阈值时命中
+func (c *Cache) matchSimilar(ctx context.Context, result *Result) error {
+	vector, err := c.embedder(ctx, result.question)
+	if err != nil {
+		return fmt.Errorf("embed question: %w", err)
+	}
+	result.vector = vector
+
+	entries, err := c.store.Entries(ctx, result.bucket)
+	if err != nil {
+		return err
+	}
+	var best *Entry
+	bestScore := 0.0
+	now := time.Now()
+	for i := range entries {
+		if entries[i].expired(now) {
+			continue
+		}
+		if score := Cosine(vector, entries[i].Vector); score > bestScore {
+			best, bestScore = &entries[i], score
+		}
+	}
+	if best != nil && bestScore >= c.threshold {
+		result.hit(ResultSimilar, best, bestScore)
+	}
+	return nil
+}
+
+// hit 把结果标记为命中
+func (r *Result) hit(result string, entry *Entry, similarity float64) {
+	r.Result = result
+	r.Response = entry.Response
+	r.Model = entry.Model
+	r.Similarity = similarity
+}
+
+// Save 保存未命中的问题生成的回答，空回答不缓存
+func (c *Cache) Save(ctx context.Context, result *Result, response, model string) {
+	if c == nil || result == nil || result.bucket == "" || result.Hit() || strings.TrimSpace(response) == "" {
+		return
+	}
+
+	vector := result.vector
+	if vector == nil && c.embedder != nil {
+		var err error
+		if vector, err = c.embedder(ctx, result.question); err != nil {
+			pkg.Warn("LLM cache embedding failed", zap.String("kind", result.kind), zap.Error(err))
+		}
+	}
+	now := time.Now()
+	entry := Entry{
+		Question:  result.question,
+		Vector:    vector,
+		Response:  response,
+		Model:     model,
+		CreatedAt: now,
+		ExpiresAt: now.Add(c.ttl),
+	}
+	if err := c.store.Put(ctx, result.bucket, result.key, entry); err != nil {
+		pkg.Warn("Failed to save LLM cache entry", zap.String("kind", result.kind), zap.Error(err))
+	}
+}
+
+// Purge 删除租户的所有缓存，知识库文档索引完成或删除后由问答插件调用
+func (c *Cache) Purge(ctx context.Context, tenantID uint) error {
+	if c == nil {
+		return nil
+	}
+	return c.store.Purge(ctx, tenantID)
+}
+
+// Normalize 规范化问题：转为小写、合并空白并去掉结尾的标点
+func Normalize(question string) string {
+	question = strings.ToLower(strings.Join(strings.Fields(question), " "))
+	return strings.TrimRightFunc(question, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+}
+
+// Cosine 返回两个向量的余弦相似度，维度不同或为零向量时返回0
+func Cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// bucketName 返回请求所在的桶：租户ID、调用类型、模型和上下文的摘要
+func bucketName(req Request) string {
+	docIDs := append([]string(nil), req.DocIDs...)
+	sort.Strings(docIDs)
+	scope := hash(req.Context + "\x00" + strings.Join(docIDs, "\x00"))
+	return fmt.Sprintf("%d:%s:%s:%s", req.TenantID, req.Kind, req.Model, scope[:32])
+}
+
+// hash 返回文本的SHA-256十六进制摘要
+func hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
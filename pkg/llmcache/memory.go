@@ -0,0 +1,140 @@
+package llmcache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内的缓存存储，多实例部署时各实例的缓存互不共享
+type MemoryStore struct {
+	mu         sync.Mutex
+	buckets    map[string]map[string]Entry
+	size       int
+	maxEntries int
+}
+
+// NewMemoryStore 创建最多保存maxEntries个条目的内存存储
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]map[string]Entry), maxEntries: maxEntries}
+}
+
+// Get 返回桶中指定问题的条目
+func (s *MemoryStore) Get(ctx context.Context, bucket, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.buckets[bucket][key]
+	if !ok || entry.expired(time.Now()) {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// Entries 返回桶中未过期的条目
+func (s *MemoryStore) Entries(ctx context.Context, bucket string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entries := make([]Entry, 0, len(s.buckets[bucket]))
+	for _, entry := range s.buckets[bucket] {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Put 保存条目，超出桶或存储的容量时先清理过期条目，再淘汰最早的条目
+func (s *MemoryStore) Put(ctx context.Context, bucket, key string, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.buckets[bucket][key]; !exists {
+		if len(s.buckets[bucket]) >= maxBucketEntries {
+			s.evictOldest(bucket)
+		}
+		if s.maxEntries > 0 && s.size >= s.maxEntries {
+			s.removeExpired()
+		}
+		if s.maxEntries > 0 && s.size >= s.maxEntries {
+			s.evictOldest("")
+		}
+		s.size++
+	}
+
+	// 淘汰可能删除了空桶，淘汰之后再取桶
+	entries, ok := s.buckets[bucket]
+	if !ok {
+		entries = make(map[string]Entry)
+		s.buckets[bucket] = entries
+	}
+	entries[key] = entry
+	return nil
+}
+
+// Purge 删除租户的所有条目
+func (s *MemoryStore) Purge(ctx context.Context, tenantID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := strconv.FormatUint(uint64(tenantID), 10) + ":"
+	for bucket, entries := range s.buckets {
+		if strings.HasPrefix(bucket, prefix) {
+			s.size -= len(entries)
+			delete(s.buckets, bucket)
+		}
+	}
+	return nil
+}
+
+// Len 返回保存的条目数，包括尚未清理的过期条目
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// removeExpired 删除所有过期条目，调用方需持有锁
+func (s *MemoryStore) removeExpired() {
+	now := time.Now()
+	for bucket, entries := range s.buckets {
+		for key, entry := range entries {
+			if entry.expired(now) {
+				s.remove(bucket, key)
+			}
+		}
+	}
+}
+
+// evictOldest 删除桶中最早的条目，bucket为空时在所有桶中查找，调用方需持有锁
+func (s *MemoryStore) evictOldest(bucket string) {
+	var oldestBucket, oldestKey string
+	var oldest time.Time
+	for name, entries := range s.buckets {
+		if bucket != "" && name != bucket {
+			continue
+		}
+		for key, entry := range entries {
+			if oldestKey == "" || entry.CreatedAt.Before(oldest) {
+				oldestBucket, oldestKey, oldest = name, key, entry.CreatedAt
+			}
+		}
+	}
+	if oldestKey != "" {
+		s.remove(oldestBucket, oldestKey)
+	}
+}
+
+// remove 删除一个条目，桶为空时一并删除，调用方需持有锁
+func (s *MemoryStore) remove(bucket, key string) {
+	entries := s.buckets[bucket]
+	if _, ok := entries[key]; !ok {
+		return
+	}
+	delete(entries, key)
+	s.size--
+	if len(entries) == 0 {
+		delete(s.buckets, bucket)
+	}
+}
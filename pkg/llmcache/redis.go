@@ -0,0 +1,146 @@
+package llmcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix 缓存键的前缀，每个桶是一个以问题摘要为字段的哈希
+const redisKeyPrefix = "weave:llmcache:"
+
+// RedisStore 基于Redis的缓存存储，多个实例共享缓存
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 连接Redis并创建存储
+func NewRedisStore(addr string) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr, Protocol: 2})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Get 返回桶中指定问题的条目
+func (s *RedisStore) Get(ctx context.Context, bucket, key string) (*Entry, error) {
+	data, err := s.client.HGet(ctx, redisKeyPrefix+bucket, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if entry.expired(time.Now()) {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// Entries 返回桶中未过期的条目，无法解析的条目被忽略
+func (s *RedisStore) Entries(ctx context.Context, bucket string) ([]Entry, error) {
+	values, err := s.client.HGetAll(ctx, redisKeyPrefix+bucket).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entries := make([]Entry, 0, len(values))
+	for _, value := range values {
+		var entry Entry
+		if json.Unmarshal([]byte(value), &entry) == nil && !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Put 保存条目并把桶的过期时间延长到条目过期时，桶中条目过多时删除最早的条目
+func (s *RedisStore) Put(ctx context.Context, bucket, key string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	name := redisKeyPrefix + bucket
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, name, key, data)
+	pipe.ExpireAt(ctx, name, entry.ExpiresAt)
+	size := pipe.HLen(ctx, name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if size.Val() <= maxBucketEntries {
+		return nil
+	}
+	return s.trim(ctx, name)
+}
+
+// trim 删除桶中过期和超出容量的最早条目
+func (s *RedisStore) trim(ctx context.Context, name string) error {
+	values, err := s.client.HGetAll(ctx, name).Result()
+	if err != nil {
+		return err
+	}
+	type field struct {
+		key       string
+		createdAt time.Time
+	}
+	now := time.Now()
+	var stale []string
+	fields := make([]field, 0, len(values))
+	for key, value := range values {
+		var entry Entry
+		if json.Unmarshal([]byte(value), &entry) != nil || entry.expired(now) {
+			stale = append(stale, key)
+			continue
+		}
+		fields = append(fields, field{key: key, createdAt: entry.CreatedAt})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].createdAt.Before(fields[j].createdAt) })
+	for i := 0; i < len(fields)-maxBucketEntries; i++ {
+		stale = append(stale, fields[i].key)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return s.client.HDel(ctx, name, stale...).Err()
+}
+
+// Purge 删除租户的所有桶
+func (s *RedisStore) Purge(ctx context.Context, tenantID uint) error {
+	iter := s.client.Scan(ctx, 0, fmt.Sprintf("%s%d:*", redisKeyPrefix, tenantID), 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) >= 100 {
+			if err := s.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// Ping 检查Redis连接
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
@@ -0,0 +1,127 @@
+package llmprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+	"unicode"
+
+	"weave/config"
+	"weave/pkg/quota"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// FakeModel 确定性的假模型，不访问网络，用于测试和本地开发
+// 默认回复“[提供方/模型] 最后一条用户消息”，按空格切分为多个片段流式返回
+type FakeModel struct {
+	Target   Target
+	Response string        // 固定回复，为空时回显最后一条用户消息
+	Err      error         // 非空时每次调用都返回该错误
+	Delay    time.Duration // 生成前等待的时间，上下文结束时提前返回
+}
+
+// newFake 按提供方的options创建假模型：response为固定回复，error为固定错误，delay为等待时间（如2s）
+func newFake(provider config.LLMProviderConfig, model string) (llms.Model, error) {
+	fake := &FakeModel{Target: Target{Provider: provider.Name, Model: model}, Response: provider.Options["response"]}
+	if message := provider.Options["error"]; message != "" {
+		fake.Err = errors.New(message)
+	}
+	if delay := provider.Options["delay"]; delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fake provider delay %q: %w", delay, err)
+		}
+		fake.Delay = d
+	}
+	return fake, nil
+}
+
+// GenerateContent 生成固定回复，令牌数按文本长度估算
+func (f *FakeModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	var prompt strings.Builder
+	var lastHuman string
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				prompt.WriteString(text.Text)
+				if message.Role == llms.ChatMessageTypeHuman {
+					lastHuman = text.Text
+				}
+			}
+		}
+	}
+	response := f.Response
+	if response == "" {
+		response = fmt.Sprintf("[%s] %s", f.Target, lastHuman)
+	}
+
+	if opts.StreamingFunc != nil {
+		for _, chunk := range strings.SplitAfter(response, " ") {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := opts.StreamingFunc(ctx, []byte(chunk)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content: response,
+		GenerationInfo: map[string]any{
+			"PromptTokens":     int(quota.EstimateTokens(prompt.String())),
+			"CompletionTokens": int(quota.EstimateTokens(response)),
+		},
+	}}}, nil
+}
+
+// Call 以单条提示词生成回复
+func (f *FakeModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, f, prompt, options...)
+}
+
+// fakeEmbeddingDim 假模型向量的维度
+const fakeEmbeddingDim = 64
+
+// CreateEmbedding 按词频生成确定性的向量，用词相近的文本向量相似
+func (f *FakeModel) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vector := make([]float32, fakeEmbeddingDim)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, word := range words {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			vector[h.Sum32()%fakeEmbeddingDim]++
+		}
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
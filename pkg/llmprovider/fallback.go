@@ -0,0 +1,59 @@
+package llmprovider
+
+import (
+	"context"
+	"errors"
+
+	"weave/pkg"
+
+	"go.uber.org/zap"
+)
+
+// permanentError 不应改用备用模型重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记不能改用备用模型重试的错误，如流式输出已经开始后的失败
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Call 依次用targets中的模型执行attempt，直到有一次成功，返回最后使用的调用目标
+// 每次尝试的上下文带有提供方的超时；调用方的上下文结束或attempt返回Permanent错误时不再尝试后续模型
+func (r *Registry) Call(ctx context.Context, targets []Target, attempt func(ctx context.Context, target Target) error) (Target, error) {
+	var used Target
+	var lastErr error
+	for i, target := range targets {
+		used = target
+		attemptCtx, cancel := context.WithTimeout(ctx, r.Timeout(target))
+		err := attempt(attemptCtx, target)
+		cancel()
+		if err == nil {
+			return target, nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return target, permanent.err
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(targets)-1 {
+			pkg.Warn("LLM call failed, falling back",
+				zap.String("target", target.String()),
+				zap.String("fallback", targets[i+1].String()),
+				zap.Error(err))
+		}
+	}
+	return used, lastErr
+}
@@ -0,0 +1,270 @@
+// Package llmprovider 管理LLM提供方、模型别名与按任务的路由
+//
+// 模型引用有三种形式：别名（如fast）、提供方名称（使用该提供方配置的模型）和“提供方/模型”。
+// 选择主模型时依次取：请求指定的模型、租户的任务路由、全局任务路由、租户默认模型、全局默认模型；
+// 主模型出错或超时后改用租户或全局配置的备用模型重试一次。
+package llmprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 路由规则中的任务
+const (
+	TaskChat = "chat" // LLM对话
+	TaskRAG  = "rag"  // 检索增强生成
+)
+
+// ErrUnknownModel 模型引用无法解析为已配置的提供方和模型
+var ErrUnknownModel = errors.New("unknown llm model")
+
+// Target 一次调用使用的提供方和模型
+type Target struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// String 返回“提供方/模型”形式的引用
+func (t Target) String() string {
+	return t.Provider + "/" + t.Model
+}
+
+// Factory 按提供方配置创建指定模型的实例
+type Factory func(provider config.LLMProviderConfig, model string) (llms.Model, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{
+		"ollama": newOllama,
+		"openai": newOpenAI,
+		"ark":    newArk,
+		"fake":   newFake,
+	}
+)
+
+// RegisterType 注册提供方类型，同名类型会被替换，需在创建Registry之前调用
+func RegisterType(typ string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[typ] = factory
+}
+
+// factoryFor 返回提供方类型的创建函数
+func factoryFor(typ string) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok := factories[typ]
+	return factory, ok
+}
+
+// Registry 按配置解析模型引用、规划调用顺序并创建模型实例
+// 创建后只读，可以并发使用；租户配置在每次规划时从数据库读取
+type Registry struct {
+	providers    map[string]config.LLMProviderConfig
+	aliases      map[string]string
+	routes       map[string]string
+	defaultModel string
+	fallback     string
+	timeout      time.Duration
+	poolSize     int
+}
+
+// FromConfig 按全局配置创建注册表
+func FromConfig() (*Registry, error) {
+	return NewRegistry(config.Config.LLM)
+}
+
+// NewRegistry 创建注册表，校验提供方类型以及别名、路由、默认和备用模型都能解析
+func NewRegistry(cfg config.LLMConfig) (*Registry, error) {
+	r := &Registry{
+		providers:    make(map[string]config.LLMProviderConfig, len(cfg.Providers)),
+		aliases:      make(map[string]string, len(cfg.Aliases)),
+		routes:       make(map[string]string, len(cfg.Routes)),
+		defaultModel: strings.TrimSpace(cfg.Default),
+		fallback:     strings.TrimSpace(cfg.Fallback),
+		timeout:      time.Duration(cfg.Timeout) * time.Second,
+		poolSize:     cfg.PoolSize,
+	}
+	if r.timeout <= 0 {
+		r.timeout = 60 * time.Second
+	}
+	if r.poolSize <= 0 {
+		r.poolSize = 5
+	}
+
+	for _, provider := range cfg.Providers {
+		if provider.Name == "" || strings.Contains(provider.Name, "/") {
+			return nil, fmt.Errorf("invalid llm provider name %q", provider.Name)
+		}
+		if _, exists := r.providers[provider.Name]; exists {
+			return nil, fmt.Errorf("duplicate llm provider %s", provider.Name)
+		}
+		if _, ok := factoryFor(provider.Type); !ok {
+			return nil, fmt.Errorf("llm provider %s has unknown type %q", provider.Name, provider.Type)
+		}
+		r.providers[provider.Name] = provider
+	}
+
+	// 别名只能指向提供方，不能指向其他别名
+	for alias, ref := range cfg.Aliases {
+		if _, conflict := r.providers[alias]; conflict {
+			return nil, fmt.Errorf("llm alias %s conflicts with a provider name", alias)
+		}
+		r.aliases[alias] = strings.TrimSpace(ref)
+	}
+	for alias, ref := range r.aliases {
+		if _, isAlias := r.aliases[ref]; isAlias {
+			return nil, fmt.Errorf("llm alias %s must reference a provider, not alias %s", alias, ref)
+		}
+		if _, err := r.Resolve(alias); err != nil {
+			return nil, fmt.Errorf("llm alias %s: %w", alias, err)
+		}
+	}
+
+	for task, ref := range cfg.Routes {
+		if _, err := r.Resolve(ref); err != nil {
+			return nil, fmt.Errorf("llm route %s: %w", task, err)
+		}
+		r.routes[task] = strings.TrimSpace(ref)
+	}
+	if _, err := r.Resolve(r.defaultModel); err != nil {
+		return nil, fmt.Errorf("default llm model: %w", err)
+	}
+	if r.fallback != "" {
+		if _, err := r.Resolve(r.fallback); err != nil {
+			return nil, fmt.Errorf("fallback llm model: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// Resolve 将别名、提供方名称或“提供方/模型”解析为调用目标
+func (r *Registry) Resolve(ref string) (Target, error) {
+	ref = strings.TrimSpace(ref)
+	if alias, ok := r.aliases[ref]; ok {
+		ref = alias
+	}
+	name, model, explicit := strings.Cut(ref, "/")
+	provider, ok := r.providers[name]
+	if !ok {
+		return Target{}, fmt.Errorf("%w: %q", ErrUnknownModel, ref)
+	}
+	if !explicit {
+		model = provider.Model
+	}
+	if model == "" {
+		return Target{}, fmt.Errorf("%w: provider %s has no default model", ErrUnknownModel, name)
+	}
+	return Target{Provider: name, Model: model}, nil
+}
+
+// New 创建调用目标的模型实例
+func (r *Registry) New(target Target) (llms.Model, error) {
+	provider, ok := r.providers[target.Provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownModel, target)
+	}
+	factory, _ := factoryFor(provider.Type)
+	return factory(provider, target.Model)
+}
+
+// Timeout 返回调用目标的单次调用超时
+func (r *Registry) Timeout(target Target) time.Duration {
+	if provider, ok := r.providers[target.Provider]; ok && provider.Timeout > 0 {
+		return time.Duration(provider.Timeout) * time.Second
+	}
+	return r.timeout
+}
+
+// PoolSize 返回每个提供方/模型的连接池容量
+func (r *Registry) PoolSize() int {
+	return r.poolSize
+}
+
+// Aliases 返回别名及其解析结果
+func (r *Registry) Aliases() map[string]Target {
+	result := make(map[string]Target, len(r.aliases))
+	for alias := range r.aliases {
+		result[alias], _ = r.Resolve(alias)
+	}
+	return result
+}
+
+// Providers 返回按名称排序的提供方名称
+func (r *Registry) Providers() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TenantConfig 读取租户的LLM配置，租户没有单独配置时返回nil
+func TenantConfig(ctx context.Context, tenantID uint) (*models.TenantLLMConfig, error) {
+	if pkg.DB == nil || tenantID == 0 {
+		return nil, nil
+	}
+	var override models.TenantLLMConfig
+	err := pkg.DB.WithContext(pkg.WithoutTenantScope(ctx)).Where("tenant_id = ?", tenantID).First(&override).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// Plan 返回任务依次尝试的调用目标：主模型和可选的备用模型
+// requested为请求指定的模型，为空时按租户和全局的路由规则选择
+func (r *Registry) Plan(ctx context.Context, tenantID uint, task, requested string) ([]Target, error) {
+	override, err := TenantConfig(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if override == nil {
+		override = &models.TenantLLMConfig{}
+	}
+
+	ref := strings.TrimSpace(requested)
+	for _, candidate := range []string{override.Routes[task], r.routes[task], override.DefaultModel, r.defaultModel} {
+		if ref == "" {
+			ref = candidate
+		}
+	}
+	primary, err := r.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	targets := []Target{primary}
+
+	fallbackRef := override.FallbackModel
+	if fallbackRef == "" {
+		fallbackRef = r.fallback
+	}
+	if fallbackRef != "" {
+		fallback, err := r.Resolve(fallbackRef)
+		if err != nil {
+			// 租户配置引用的模型已从全局配置中移除时不影响主模型
+			pkg.Warn("Ignoring unresolvable LLM fallback model", zap.Uint("tenant_id", tenantID), zap.Error(err))
+		} else if fallback != primary {
+			targets = append(targets, fallback)
+		}
+	}
+	return targets, nil
+}
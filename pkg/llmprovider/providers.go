@@ -0,0 +1,46 @@
+package llmprovider
+
+import (
+	"weave/config"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// arkBaseURL 方舟（火山引擎）的默认接口地址，方舟提供OpenAI兼容的接口
+const arkBaseURL = "https://ark.cn-beijing.volces.com/api/v3"
+
+// newOllama 创建Ollama模型实例
+func newOllama(provider config.LLMProviderConfig, model string) (llms.Model, error) {
+	opts := []ollama.Option{ollama.WithModel(model)}
+	if provider.BaseURL != "" {
+		opts = append(opts, ollama.WithServerURL(provider.BaseURL))
+	}
+	return ollama.New(opts...)
+}
+
+// newOpenAI 创建OpenAI或兼容接口的模型实例，未配置apiKey时读取OPENAI_API_KEY环境变量
+func newOpenAI(provider config.LLMProviderConfig, model string) (llms.Model, error) {
+	opts := []openai.Option{openai.WithModel(model)}
+	if provider.BaseURL != "" {
+		opts = append(opts, openai.WithBaseURL(provider.BaseURL))
+	}
+	if provider.APIKey != "" {
+		opts = append(opts, openai.WithToken(provider.APIKey))
+	}
+	return openai.New(opts...)
+}
+
+// newArk 创建方舟模型实例，模型为推理接入点ID
+func newArk(provider config.LLMProviderConfig, model string) (llms.Model, error) {
+	baseURL := provider.BaseURL
+	if baseURL == "" {
+		baseURL = arkBaseURL
+	}
+	return openai.New(
+		openai.WithModel(model),
+		openai.WithBaseURL(baseURL),
+		openai.WithToken(provider.APIKey),
+	)
+}
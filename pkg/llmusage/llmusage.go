@@ -0,0 +1,261 @@
+// Package llmusage 记录每次模型调用的令牌用量和费用，并生成按模型、用户、来源或日期汇总的用量报表
+//
+// 令牌数优先使用模型返回的用量，没有时按文本长度估算；费用按config.Config.LLM.Prices中的单价在记录时计算，
+// 修改单价只影响之后的记录。租户的月度令牌配额仍由quota包按usage_daily汇总表校验。
+package llmusage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/metrics"
+	"weave/pkg/quota"
+
+	"github.com/tmc/langchaingo/llms"
+	"gorm.io/gorm"
+)
+
+// 调用来源
+const (
+	SourceChat    = "chat"    // 普通对话
+	SourceStream  = "stream"  // 流式对话
+	SourceAgent   = "agent"   // 工具调用循环中的一次模型调用
+	SourceSummary = "summary" // 压缩对话历史
+	SourceRAG     = "rag"     // 知识库问答
+)
+
+// 报表的分组方式
+const (
+	GroupByModel  = "model"
+	GroupByUser   = "user"
+	GroupBySource = "source"
+	GroupByDay    = "day"
+)
+
+// ErrInvalidGroup 不支持的分组方式
+var ErrInvalidGroup = errors.New("llmusage: unknown group")
+
+// Tokens 一次模型调用的令牌数
+type Tokens struct {
+	Prompt     int64 `json:"prompt_tokens"`
+	Completion int64 `json:"completion_tokens"`
+	Estimated  bool  `json:"estimated"` // 模型没有返回用量时按文本长度估算
+}
+
+// Total 返回提示词和生成的令牌总数
+func (t Tokens) Total() int64 {
+	return t.Prompt + t.Completion
+}
+
+// Add 返回两次调用的令牌数之和，任一次为估算值时结果也标记为估算值
+func (t Tokens) Add(other Tokens) Tokens {
+	return Tokens{
+		Prompt:     t.Prompt + other.Prompt,
+		Completion: t.Completion + other.Completion,
+		Estimated:  t.Estimated || other.Estimated,
+	}
+}
+
+// Estimate 按提示词和生成内容估算令牌数
+func Estimate(prompt, completion string) Tokens {
+	return Tokens{Prompt: quota.EstimateTokens(prompt), Completion: quota.EstimateTokens(completion), Estimated: true}
+}
+
+// FromResponse 优先使用模型返回的令牌数，没有时用估算的提示词令牌数和生成内容估算
+// completion为空时使用响应的内容，流式调用时传入已生成的内容
+func FromResponse(resp *llms.ContentResponse, promptTokens int64, completion string) Tokens {
+	if resp != nil && len(resp.Choices) > 0 {
+		info := resp.Choices[0].GenerationInfo
+		prompt, okPrompt := info["PromptTokens"].(int)
+		generated, okCompletion := info["CompletionTokens"].(int)
+		if okPrompt && okCompletion && prompt+generated > 0 {
+			return Tokens{Prompt: int64(prompt), Completion: int64(generated)}
+		}
+		if completion == "" {
+			completion = resp.Choices[0].Content
+		}
+	}
+	return Tokens{Prompt: promptTokens, Completion: quota.EstimateTokens(completion), Estimated: true}
+}
+
+// PriceFor 返回模型的单价，依次按“提供方/模型”和模型名称查找
+func PriceFor(target llmprovider.Target) (config.LLMPrice, bool) {
+	if price, ok := config.Config.LLM.Prices[target.String()]; ok {
+		return price, true
+	}
+	price, ok := config.Config.LLM.Prices[target.Model]
+	return price, ok
+}
+
+// Cost 按单价计算费用，没有配置单价的模型费用为0
+func Cost(target llmprovider.Target, tokens Tokens) float64 {
+	price, ok := PriceFor(target)
+	if !ok {
+		return 0
+	}
+	return (float64(tokens.Prompt)*price.Input + float64(tokens.Completion)*price.Output) / 1e6
+}
+
+// Entry 待记录的一次模型调用
+type Entry struct {
+	TenantID uint
+	UserID   uint // 为0表示无法归属到用户，如后台任务
+	Source   string
+	Target   llmprovider.Target
+	Tokens   Tokens
+}
+
+// Record 记录一次模型调用的用量并更新指标，没有消耗令牌时忽略
+func Record(ctx context.Context, entry Entry) error {
+	if entry.Tokens.Total() <= 0 {
+		return nil
+	}
+
+	cost := Cost(entry.Target, entry.Tokens)
+	metrics.RecordLLMUsage(entry.Target.Provider, entry.Target.Model, entry.Source, entry.Tokens.Prompt, entry.Tokens.Completion, cost)
+	if pkg.DB == nil {
+		return nil
+	}
+
+	record := models.LLMUsage{
+		TenantID:         entry.TenantID,
+		UserID:           entry.UserID,
+		Source:           entry.Source,
+		Provider:         entry.Target.Provider,
+		Model:            entry.Target.Model,
+		PromptTokens:     entry.Tokens.Prompt,
+		CompletionTokens: entry.Tokens.Completion,
+		TotalTokens:      entry.Tokens.Total(),
+		Estimated:        entry.Tokens.Estimated,
+		Cost:             cost,
+	}
+	return db(ctx).Create(&record).Error
+}
+
+// db 返回跳过自动租户隔离的会话，本包的查询都显式带租户条件
+func db(ctx context.Context) *gorm.DB {
+	return pkg.DB.WithContext(pkg.WithoutTenantScope(ctx))
+}
+
+// ReportQuery 用量报表的查询条件
+type ReportQuery struct {
+	TenantID uint
+	UserID   uint      // 为0时包括租户的所有用户
+	From     time.Time // 起始日期，包含当天
+	To       time.Time // 结束日期，包含当天
+	GroupBy  string
+}
+
+// ReportRow 一个分组的用量
+type ReportRow struct {
+	Group            string  `json:"group"` // 分组的值：“提供方/模型”、用户ID、来源或日期
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Report 用量报表
+type Report struct {
+	GroupBy  string      `json:"group_by"`
+	Currency string      `json:"currency"`
+	Rows     []ReportRow `json:"rows"`
+	Total    ReportRow   `json:"total"`
+}
+
+// groupColumns 各分组方式的分组表达式
+var groupColumns = map[string]string{
+	GroupByModel:  "provider, model",
+	GroupByUser:   "user_id",
+	GroupBySource: "source",
+	GroupByDay:    "DATE(created_at)",
+}
+
+// reportRow 报表查询的结果行
+type reportRow struct {
+	Provider         string
+	Model            string
+	UserID           uint
+	Source           string
+	Day              string
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	Cost             float64
+}
+
+// GetReport 按分组方式汇总租户在日期范围内的用量，按费用和令牌数倒序排列，按日期分组时按日期排列
+func GetReport(ctx context.Context, query ReportQuery) (*Report, error) {
+	columns, ok := groupColumns[query.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGroup, query.GroupBy)
+	}
+
+	from := startOfDay(query.From)
+	to := startOfDay(query.To).AddDate(0, 0, 1)
+	selectColumns := columns
+	if query.GroupBy == GroupByDay {
+		selectColumns = "DATE(created_at) AS day"
+	}
+	tx := db(ctx).Model(&models.LLMUsage{}).
+		Select(selectColumns+", COUNT(*) AS requests, SUM(prompt_tokens) AS prompt_tokens, "+
+			"SUM(completion_tokens) AS completion_tokens, SUM(total_tokens) AS total_tokens, SUM(cost) AS cost").
+		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", query.TenantID, from, to)
+	if query.UserID != 0 {
+		tx = tx.Where("user_id = ?", query.UserID)
+	}
+	if query.GroupBy == GroupByDay {
+		tx = tx.Order("day ASC")
+	} else {
+		tx = tx.Order("cost DESC, total_tokens DESC")
+	}
+
+	var rows []reportRow
+	if err := tx.Group(columns).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	report := &Report{GroupBy: query.GroupBy, Currency: config.Config.LLM.Currency, Rows: make([]ReportRow, 0, len(rows))}
+	for _, row := range rows {
+		out := ReportRow{
+			Requests:         row.Requests,
+			PromptTokens:     row.PromptTokens,
+			CompletionTokens: row.CompletionTokens,
+			TotalTokens:      row.TotalTokens,
+			Cost:             row.Cost,
+		}
+		switch query.GroupBy {
+		case GroupByModel:
+			out.Group = llmprovider.Target{Provider: row.Provider, Model: row.Model}.String()
+		case GroupByUser:
+			out.Group = strconv.FormatUint(uint64(row.UserID), 10)
+		case GroupBySource:
+			out.Group = row.Source
+		case GroupByDay:
+			out.Group = row.Day
+		}
+		report.Rows = append(report.Rows, out)
+
+		report.Total.Requests += row.Requests
+		report.Total.PromptTokens += row.PromptTokens
+		report.Total.CompletionTokens += row.CompletionTokens
+		report.Total.TotalTokens += row.TotalTokens
+		report.Total.Cost += row.Cost
+	}
+	report.Total.Group = "total"
+	return report, nil
+}
+
+// startOfDay 返回当天零点
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
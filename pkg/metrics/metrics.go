@@ -104,6 +104,132 @@ var (
 		[]string{"type", "component"},
 	)
 
+	// 租户配额拒绝次数
+	quotaRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tenant_quota_rejections_total",
+			Help: "Total number of requests rejected by tenant quotas",
+		},
+		[]string{"resource"},
+	)
+
+	// 计量用量
+	usageRecorded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tenant_usage_recorded_total",
+			Help: "Total metered usage recorded across tenants",
+		},
+		[]string{"metric"},
+	)
+
+	// 模型调用消耗的令牌数，type为prompt或completion
+	llmTokens = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tokens_total",
+			Help: "Total number of LLM tokens consumed",
+		},
+		[]string{"provider", "model", "source", "type"},
+	)
+
+	// 模型调用次数
+	llmRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_requests_total",
+			Help: "Total number of LLM calls with recorded usage",
+		},
+		[]string{"provider", "model", "source"},
+	)
+
+	// 按配置的单价计算的模型调用费用
+	llmCost = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cost_total",
+			Help: "Total cost of LLM calls according to the configured price table",
+		},
+		[]string{"provider", "model"},
+	)
+
+	// 回答缓存查询结果：hit按原文命中、similar按相似问题命中、miss未命中、error存储出错
+	llmCacheLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cache_lookups_total",
+			Help: "Total number of LLM response cache lookups",
+		},
+		[]string{"kind", "result"},
+	)
+
+	// 命中缓存的问题与缓存问题的相似度
+	llmCacheSimilarity = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_cache_hit_similarity",
+			Help:    "Similarity between the question and the cached question on cache hits",
+			Buckets: []float64{0.8, 0.85, 0.9, 0.95, 0.98, 0.99, 1},
+		},
+		[]string{"kind"},
+	)
+
+	// 审计日志管道事件：enqueued入队、written写入、spooled落盘、replayed重放、dropped丢弃
+	auditEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_events_total",
+			Help: "Total number of audit events processed by the audit pipeline",
+		},
+		[]string{"result"},
+	)
+
+	// 审计日志队列长度
+	auditQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "audit_queue_depth",
+			Help: "Number of audit events waiting in the in-memory queue",
+		},
+	)
+
+	// 审计日志批量写入耗时
+	auditFlushDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "audit_flush_duration_seconds",
+			Help:    "Duration of audit log batch inserts in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	// 审计日志转发结果：sent发送成功、failed发送失败
+	auditSinkEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_sink_events_total",
+			Help: "Total number of audit events forwarded to external sinks",
+		},
+		[]string{"sink", "result"},
+	)
+
+	// 审计日志转发游标，即已转发的最大审计日志ID
+	auditSinkCursor = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "audit_sink_cursor",
+			Help: "Highest audit log ID forwarded to each sink",
+		},
+		[]string{"sink"},
+	)
+
+	// 数据保留任务处理的记录数，result为archived、purged或restored
+	retentionRows = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "retention_rows_total",
+			Help: "Total number of rows archived, purged or restored by the retention job",
+		},
+		[]string{"resource", "result"},
+	)
+
+	// 异常检测生成的安全告警数
+	securityAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "security_alerts_total",
+			Help: "Total number of security alerts raised by anomaly detection rules",
+		},
+		[]string{"rule", "severity"},
+	)
+
 	// 初始启动时间
 	startTime = time.Now()
 )
@@ -265,6 +391,69 @@ func RecordError(errorType, component string) {
 	errorCount.WithLabelValues(errorType, component).Inc()
 }
 
+// RecordQuotaRejection 记录配额拒绝
+func RecordQuotaRejection(resource string) {
+	quotaRejections.WithLabelValues(resource).Inc()
+}
+
+// RecordUsage 记录计量用量
+func RecordUsage(metric string, quantity int64) {
+	usageRecorded.WithLabelValues(metric).Add(float64(quantity))
+}
+
+// RecordLLMUsage 记录一次模型调用的令牌数和费用
+func RecordLLMUsage(provider, model, source string, promptTokens, completionTokens int64, cost float64) {
+	llmRequests.WithLabelValues(provider, model, source).Inc()
+	llmTokens.WithLabelValues(provider, model, source, "prompt").Add(float64(promptTokens))
+	llmTokens.WithLabelValues(provider, model, source, "completion").Add(float64(completionTokens))
+	if cost > 0 {
+		llmCost.WithLabelValues(provider, model).Add(cost)
+	}
+}
+
+// RecordLLMCacheLookup 记录一次回答缓存查询，命中时记录相似度
+func RecordLLMCacheLookup(kind, result string, similarity float64) {
+	llmCacheLookups.WithLabelValues(kind, result).Inc()
+	if result == "hit" || result == "similar" {
+		llmCacheSimilarity.WithLabelValues(kind).Observe(similarity)
+	}
+}
+
+// RecordAuditEvents 记录审计日志管道事件数量
+func RecordAuditEvents(result string, count int) {
+	auditEvents.WithLabelValues(result).Add(float64(count))
+}
+
+// SetAuditQueueDepth 更新审计日志队列长度
+func SetAuditQueueDepth(depth int) {
+	auditQueueDepth.Set(float64(depth))
+}
+
+// RecordAuditFlush 记录审计日志批量写入耗时
+func RecordAuditFlush(duration time.Duration) {
+	auditFlushDuration.Observe(duration.Seconds())
+}
+
+// RecordAuditSinkEvents 记录审计日志转发数量
+func RecordAuditSinkEvents(sink, result string, count int) {
+	auditSinkEvents.WithLabelValues(sink, result).Add(float64(count))
+}
+
+// SetAuditSinkCursor 更新审计日志转发游标
+func SetAuditSinkCursor(sink string, lastID uint) {
+	auditSinkCursor.WithLabelValues(sink).Set(float64(lastID))
+}
+
+// RecordRetentionRows 记录数据保留任务处理的记录数
+func RecordRetentionRows(resource, result string, count int) {
+	retentionRows.WithLabelValues(resource, result).Add(float64(count))
+}
+
+// RecordSecurityAlert 记录一条新的安全告警
+func RecordSecurityAlert(rule, severity string) {
+	securityAlerts.WithLabelValues(rule, severity).Inc()
+}
+
 // PluginMonitoringMiddleware 创建插件监控中间件
 func PluginMonitoringMiddleware(pluginName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,3 @@
+-- Rollback tenant table
+
+DROP TABLE IF EXISTS tenant;
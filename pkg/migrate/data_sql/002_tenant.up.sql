@@ -0,0 +1,18 @@
+-- Tenant table (MySQL)
+
+CREATE TABLE IF NOT EXISTS tenant (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    name varchar(100) NOT NULL,
+    slug varchar(64) NOT NULL,
+    description text,
+    status varchar(20) NOT NULL DEFAULT 'active',
+    allow_signup tinyint(1) DEFAULT 0,
+    suspended_at timestamp NULL DEFAULT NULL,
+    created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at timestamp NULL DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_tenant_slug (slug),
+    KEY idx_tenant_status (status),
+    KEY idx_tenant_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
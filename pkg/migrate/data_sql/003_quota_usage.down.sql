@@ -0,0 +1,4 @@
+-- Rollback tenant quota and usage rollup tables
+
+DROP TABLE IF EXISTS usage_daily;
+DROP TABLE IF EXISTS tenant_quota;
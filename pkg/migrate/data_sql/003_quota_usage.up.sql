@@ -0,0 +1,30 @@
+-- Tenant quota and usage rollup tables (MySQL)
+
+CREATE TABLE IF NOT EXISTS tenant_quota (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned NOT NULL,
+    max_users bigint DEFAULT NULL,
+    max_teams bigint DEFAULT NULL,
+    max_tools bigint DEFAULT NULL,
+    max_notes bigint DEFAULT NULL,
+    max_plugin_executions_per_day bigint DEFAULT NULL,
+    max_llm_tokens_per_month bigint DEFAULT NULL,
+    created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_tenant_quota_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS usage_daily (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned NOT NULL,
+    metric varchar(50) NOT NULL,
+    resource varchar(100) NOT NULL,
+    day varchar(10) NOT NULL,
+    quantity bigint NOT NULL DEFAULT 0,
+    created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_usage_daily_key (tenant_id,metric,resource,day),
+    KEY idx_usage_daily_day (day)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+-- Rollback team invitation table
+
+DROP TABLE IF EXISTS team_invitation;
@@ -0,0 +1,24 @@
+-- Team invitation table (MySQL)
+
+CREATE TABLE IF NOT EXISTS team_invitation (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    team_id bigint unsigned NOT NULL,
+    tenant_id bigint unsigned DEFAULT NULL,
+    inviter_id bigint unsigned NOT NULL,
+    invitee_user_id bigint unsigned DEFAULT NULL,
+    invitee_email varchar(100) DEFAULT NULL,
+    role varchar(50) DEFAULT 'member',
+    status varchar(20) DEFAULT 'pending',
+    expires_at timestamp NULL DEFAULT NULL,
+    responded_at timestamp NULL DEFAULT NULL,
+    created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_team_invitation_team_id (team_id),
+    KEY idx_team_invitation_tenant_id (tenant_id),
+    KEY idx_team_invitation_inviter_id (inviter_id),
+    KEY idx_team_invitation_invitee_user_id (invitee_user_id),
+    KEY idx_team_invitation_invitee_email (invitee_email),
+    KEY idx_team_invitation_status (status),
+    KEY idx_team_invitation_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
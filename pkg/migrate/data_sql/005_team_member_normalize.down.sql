@@ -0,0 +1,14 @@
+-- Restore the denormalized team.members column and drop the membership unique constraint
+
+ALTER TABLE team ADD COLUMN members text DEFAULT NULL COMMENT '团队成员列表（用户名形式）';
+
+UPDATE team t
+JOIN (
+    SELECT tm.team_id, GROUP_CONCAT(u.username ORDER BY tm.id SEPARATOR ',') AS members
+    FROM team_member tm
+    JOIN users u ON u.id = tm.user_id
+    GROUP BY tm.team_id
+) m ON m.team_id = t.id
+SET t.members = m.members;
+
+ALTER TABLE team_member DROP INDEX idx_team_member_team_user;
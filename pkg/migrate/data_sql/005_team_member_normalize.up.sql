@@ -0,0 +1,21 @@
+-- Normalize team membership (MySQL)
+-- team_member becomes the single source of truth; the denormalized team.members column is dropped
+
+-- Keep the highest role when the same user appears more than once in a team
+UPDATE team_member keep_row
+JOIN team_member dup ON dup.team_id = keep_row.team_id AND dup.user_id = keep_row.user_id AND dup.id > keep_row.id
+SET keep_row.role = 'owner'
+WHERE dup.role = 'owner' AND keep_row.role <> 'owner';
+
+UPDATE team_member keep_row
+JOIN team_member dup ON dup.team_id = keep_row.team_id AND dup.user_id = keep_row.user_id AND dup.id > keep_row.id
+SET keep_row.role = 'admin'
+WHERE dup.role = 'admin' AND keep_row.role NOT IN ('owner', 'admin');
+
+-- Remove duplicate rows, keeping the oldest one per (team_id, user_id)
+DELETE dup FROM team_member dup
+JOIN team_member keep_row ON keep_row.team_id = dup.team_id AND keep_row.user_id = dup.user_id AND keep_row.id < dup.id;
+
+ALTER TABLE team_member ADD UNIQUE KEY idx_team_member_team_user (team_id, user_id);
+
+ALTER TABLE team DROP COLUMN members;
@@ -0,0 +1,9 @@
+-- Remove hierarchical teams and team-scoped tools/plugins
+
+DROP TABLE IF EXISTS plugin_team_scope;
+
+ALTER TABLE tools DROP KEY idx_tools_team_id;
+ALTER TABLE tools DROP COLUMN team_id;
+
+ALTER TABLE team DROP KEY idx_team_parent_id;
+ALTER TABLE team DROP COLUMN parent_id;
@@ -0,0 +1,20 @@
+-- Hierarchical teams and team-scoped tools/plugins (MySQL)
+
+ALTER TABLE team ADD COLUMN parent_id bigint unsigned DEFAULT NULL COMMENT '上级团队，为空表示根团队';
+ALTER TABLE team ADD KEY idx_team_parent_id (parent_id);
+
+ALTER TABLE tools ADD COLUMN team_id bigint unsigned DEFAULT NULL COMMENT '限定可用范围的团队子树';
+ALTER TABLE tools ADD KEY idx_tools_team_id (team_id);
+
+CREATE TABLE IF NOT EXISTS plugin_team_scope (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned DEFAULT NULL,
+    plugin_name varchar(100) NOT NULL,
+    team_id bigint unsigned NOT NULL,
+    created_by bigint unsigned DEFAULT NULL,
+    created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_plugin_scope_tenant_plugin (tenant_id, plugin_name),
+    KEY idx_plugin_team_scope_team_id (team_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
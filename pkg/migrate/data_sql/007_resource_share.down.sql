@@ -0,0 +1,6 @@
+-- Remove resource sharing ACL
+
+DROP TABLE IF EXISTS resource_share;
+
+ALTER TABLE tools DROP KEY idx_tools_owner_id;
+ALTER TABLE tools DROP COLUMN owner_id;
@@ -0,0 +1,21 @@
+-- Resource sharing ACL for notes and tools (MySQL)
+
+ALTER TABLE tools ADD COLUMN owner_id bigint unsigned NOT NULL DEFAULT 0 COMMENT '工具所有者，0表示历史工具';
+ALTER TABLE tools ADD KEY idx_tools_owner_id (owner_id);
+
+CREATE TABLE IF NOT EXISTS resource_share (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned DEFAULT NULL,
+    resource_type varchar(20) NOT NULL,
+    resource_id varchar(100) NOT NULL,
+    subject_type varchar(20) NOT NULL,
+    subject_id bigint unsigned NOT NULL,
+    level varchar(20) NOT NULL DEFAULT 'read',
+    created_by bigint unsigned DEFAULT NULL,
+    created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_resource_share_subject (resource_type, resource_id, subject_type, subject_id),
+    KEY idx_resource_share_tenant_id (tenant_id),
+    KEY idx_resource_share_lookup (subject_type, subject_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+-- Remove audit log hash chain and append-only enforcement
+
+DROP TRIGGER IF EXISTS audit_logs_no_delete;
+DROP TRIGGER IF EXISTS audit_logs_no_update;
+
+DROP TABLE IF EXISTS audit_checkpoint;
+
+ALTER TABLE audit_logs DROP KEY idx_audit_logs_tenant_sequence;
+ALTER TABLE audit_logs DROP COLUMN hash;
+ALTER TABLE audit_logs DROP COLUMN prev_hash;
+ALTER TABLE audit_logs DROP COLUMN sequence;
+ALTER TABLE audit_logs MODIFY created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,26 @@
+-- Tamper-evident audit log: per-tenant hash chain, signed checkpoints and append-only enforcement (MySQL)
+
+ALTER TABLE audit_logs ADD COLUMN sequence bigint unsigned DEFAULT NULL COMMENT '租户内哈希链序号，NULL表示引入哈希链之前的历史记录';
+ALTER TABLE audit_logs ADD COLUMN prev_hash varchar(64) DEFAULT NULL COMMENT '上一条记录的哈希';
+ALTER TABLE audit_logs ADD COLUMN hash varchar(64) DEFAULT NULL COMMENT '本条记录的哈希（SHA-256）';
+-- 哈希覆盖毫秒精度的创建时间
+ALTER TABLE audit_logs MODIFY created_at timestamp(3) NULL DEFAULT CURRENT_TIMESTAMP(3);
+ALTER TABLE audit_logs ADD UNIQUE KEY idx_audit_logs_tenant_sequence (tenant_id, sequence);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoint (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned DEFAULT NULL,
+    sequence bigint unsigned NOT NULL,
+    hash varchar(64) NOT NULL,
+    signature varchar(64) NOT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    KEY idx_audit_checkpoint_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 审计日志只允许追加：拒绝任何修改和删除
+CREATE TRIGGER audit_logs_no_update BEFORE UPDATE ON audit_logs
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_logs is append-only';
+
+CREATE TRIGGER audit_logs_no_delete BEFORE DELETE ON audit_logs
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_logs is append-only';
@@ -0,0 +1,3 @@
+-- Remove field-level audit diff
+
+ALTER TABLE audit_logs DROP COLUMN diff;
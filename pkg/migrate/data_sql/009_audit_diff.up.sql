@@ -0,0 +1,3 @@
+-- Field-level before/after diff for audit logs (MySQL)
+
+ALTER TABLE audit_logs ADD COLUMN diff text COMMENT '字段级变更列表（JSON格式），敏感字段已脱敏' AFTER new_value;
@@ -0,0 +1,3 @@
+-- Remove audit log sink cursors
+
+DROP TABLE IF EXISTS audit_sink_cursor;
@@ -0,0 +1,8 @@
+-- Per-sink forwarding cursors for audit log SIEM sinks (MySQL)
+
+CREATE TABLE IF NOT EXISTS audit_sink_cursor (
+    sink varchar(100) NOT NULL COMMENT '转发目标名称',
+    last_id bigint unsigned NOT NULL DEFAULT 0 COMMENT '已转发的最大审计日志ID',
+    updated_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (sink)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
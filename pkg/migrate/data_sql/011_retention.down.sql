@@ -0,0 +1,9 @@
+-- Remove retention policies and archive index, restore the unconditional audit log delete guard
+
+DROP TRIGGER IF EXISTS audit_logs_no_delete;
+
+CREATE TRIGGER audit_logs_no_delete BEFORE DELETE ON audit_logs
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_logs is append-only';
+
+DROP TABLE IF EXISTS retention_archive;
+DROP TABLE IF EXISTS retention_policy;
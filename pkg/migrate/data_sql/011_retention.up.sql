@@ -0,0 +1,49 @@
+-- Per-tenant retention policies, archive index and retention-aware audit log delete guard (MySQL)
+
+CREATE TABLE IF NOT EXISTS retention_policy (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned NOT NULL,
+    resource varchar(50) NOT NULL COMMENT 'audit_log、login_history或tool_history',
+    retention_days bigint NOT NULL DEFAULT 0 COMMENT '保留天数，0表示永久保留',
+    legal_hold tinyint(1) NOT NULL DEFAULT 0 COMMENT '法律保全，暂停一切删除',
+    legal_hold_reason varchar(255) DEFAULT NULL,
+    updated_by bigint unsigned DEFAULT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    updated_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_retention_policy_tenant_resource (tenant_id, resource)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS retention_archive (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned NOT NULL,
+    resource varchar(50) NOT NULL,
+    from_id bigint unsigned NOT NULL,
+    to_id bigint unsigned NOT NULL,
+    from_time datetime(3) DEFAULT NULL,
+    to_time datetime(3) DEFAULT NULL,
+    count bigint NOT NULL,
+    storage varchar(20) NOT NULL COMMENT 'local或s3',
+    location varchar(512) NOT NULL COMMENT '存储中的对象键',
+    sha256 varchar(64) NOT NULL,
+    size bigint DEFAULT NULL,
+    last_sequence bigint unsigned DEFAULT NULL COMMENT '归档的最后一条链上审计日志序号',
+    last_hash varchar(64) DEFAULT NULL,
+    restored_at datetime(3) DEFAULT NULL,
+    restored_until datetime(3) DEFAULT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_retention_archive_range (tenant_id, resource, from_id),
+    KEY idx_retention_archive_to_time (to_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 审计日志仍然禁止删除，只有保留任务在事务内设置@weave_audit_retention后才能删除已归档的记录
+DROP TRIGGER IF EXISTS audit_logs_no_delete;
+
+CREATE TRIGGER audit_logs_no_delete BEFORE DELETE ON audit_logs
+FOR EACH ROW
+BEGIN
+    IF @weave_audit_retention IS NULL OR @weave_audit_retention <> 1 THEN
+        SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_logs is append-only';
+    END IF;
+END;
@@ -0,0 +1,6 @@
+-- Remove security anomaly alerts and detection cursors
+
+DROP INDEX idx_audit_logs_user_created ON audit_logs;
+
+DROP TABLE IF EXISTS anomaly_cursor;
+DROP TABLE IF EXISTS security_alert;
@@ -0,0 +1,41 @@
+-- Security anomaly alerts and detection cursors (MySQL)
+
+CREATE TABLE IF NOT EXISTS security_alert (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned DEFAULT NULL,
+    rule varchar(50) NOT NULL COMMENT '触发告警的检测规则',
+    severity varchar(20) NOT NULL COMMENT 'low、medium、high或critical',
+    status varchar(20) NOT NULL DEFAULT 'open' COMMENT 'open、acknowledged或resolved',
+    user_id bigint unsigned DEFAULT NULL,
+    username varchar(50) DEFAULT NULL,
+    source varchar(20) NOT NULL COMMENT 'login_history或audit_log',
+    source_id bigint unsigned NOT NULL,
+    summary varchar(255) DEFAULT NULL,
+    details text,
+    fingerprint varchar(100) NOT NULL COMMENT '去重键',
+    occurred_at datetime(3) DEFAULT NULL,
+    handled_by bigint unsigned DEFAULT NULL,
+    handled_at datetime(3) DEFAULT NULL,
+    note varchar(500) DEFAULT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    updated_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_security_alert_fingerprint (fingerprint),
+    KEY idx_security_alert_tenant_id (tenant_id),
+    KEY idx_security_alert_rule (rule),
+    KEY idx_security_alert_severity (severity),
+    KEY idx_security_alert_status (status),
+    KEY idx_security_alert_user_id (user_id),
+    KEY idx_security_alert_username (username),
+    KEY idx_security_alert_occurred_at (occurred_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS anomaly_cursor (
+    source varchar(50) NOT NULL COMMENT '数据来源',
+    last_id bigint unsigned NOT NULL DEFAULT 0 COMMENT '已检测的最大ID',
+    updated_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (source)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 批量删除规则按用户和时间窗口统计审计日志
+CREATE INDEX idx_audit_logs_user_created ON audit_logs (tenant_id, user_id, created_at);
@@ -0,0 +1,5 @@
+-- Remove audit statistics indexes
+
+DROP INDEX idx_audit_logs_tenant_resource_created ON audit_logs;
+DROP INDEX idx_audit_logs_tenant_action_created ON audit_logs;
+DROP INDEX idx_audit_logs_tenant_created ON audit_logs;
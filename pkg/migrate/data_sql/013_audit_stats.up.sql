@@ -0,0 +1,6 @@
+-- Indexes for audit statistics queries (MySQL)
+-- 统计查询总是按租户和时间范围过滤，按操作和资源类型过滤时可以直接使用对应的复合索引
+
+CREATE INDEX idx_audit_logs_tenant_created ON audit_logs (tenant_id, created_at);
+CREATE INDEX idx_audit_logs_tenant_action_created ON audit_logs (tenant_id, action, created_at);
+CREATE INDEX idx_audit_logs_tenant_resource_created ON audit_logs (tenant_id, resource_type, created_at);
@@ -0,0 +1,4 @@
+-- Remove per-user LLM conversations and messages
+
+DROP TABLE IF EXISTS conversation_message;
+DROP TABLE IF EXISTS conversation;
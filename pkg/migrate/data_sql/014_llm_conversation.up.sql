@@ -0,0 +1,27 @@
+-- Per-user LLM conversations and messages (MySQL)
+
+CREATE TABLE IF NOT EXISTS conversation (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned DEFAULT NULL,
+    user_id bigint unsigned NOT NULL,
+    title varchar(255) NOT NULL,
+    message_count bigint NOT NULL DEFAULT 0,
+    created_at datetime(3) DEFAULT NULL,
+    updated_at datetime(3) DEFAULT NULL COMMENT '最近一条消息的时间',
+    PRIMARY KEY (id),
+    KEY idx_conversation_owner (tenant_id, user_id),
+    KEY idx_conversation_updated_at (updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS conversation_message (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    conversation_id bigint unsigned NOT NULL,
+    tenant_id bigint unsigned DEFAULT NULL,
+    user_id bigint unsigned NOT NULL,
+    role varchar(20) NOT NULL COMMENT 'user或assistant',
+    content text NOT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    KEY idx_conversation_message_conversation_id (conversation_id),
+    KEY idx_conversation_message_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
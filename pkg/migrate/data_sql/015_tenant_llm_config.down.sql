@@ -0,0 +1,3 @@
+-- Remove per-tenant LLM model routing overrides
+
+DROP TABLE IF EXISTS tenant_llm_config;
@@ -0,0 +1,14 @@
+-- Per-tenant LLM model routing overrides (MySQL)
+
+CREATE TABLE IF NOT EXISTS tenant_llm_config (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned DEFAULT NULL,
+    default_model varchar(255) DEFAULT NULL,
+    fallback_model varchar(255) DEFAULT NULL,
+    routes text COMMENT '任务到模型的路由规则（JSON格式）',
+    updated_by bigint unsigned DEFAULT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    updated_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_tenant_llm_config_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+-- Remove pinned system prompts and rolling summaries from LLM conversations
+
+ALTER TABLE conversation DROP COLUMN summarized_through;
+ALTER TABLE conversation DROP COLUMN summary;
+ALTER TABLE conversation DROP COLUMN system_prompt;
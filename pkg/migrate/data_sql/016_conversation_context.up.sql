@@ -0,0 +1,5 @@
+-- Pinned system prompts and rolling summaries for LLM conversations (MySQL)
+
+ALTER TABLE conversation ADD COLUMN system_prompt text DEFAULT NULL COMMENT '固定的系统提示词，为空时使用默认提示词';
+ALTER TABLE conversation ADD COLUMN summary text DEFAULT NULL COMMENT '较早消息的滚动摘要';
+ALTER TABLE conversation ADD COLUMN summarized_through bigint unsigned NOT NULL DEFAULT 0 COMMENT '已并入摘要的最后一条消息ID';
@@ -0,0 +1,5 @@
+-- Restore the tool_id foreign key; plugin-level calls lose their tool reference
+
+UPDATE tool_histories SET tool_id = NULL WHERE tool_id = 0;
+ALTER TABLE tool_histories ADD CONSTRAINT fk_tool_history_tool FOREIGN KEY (tool_id) REFERENCES tools (id) ON DELETE SET NULL;
+ALTER TABLE tool_histories DROP COLUMN plugin_name;
@@ -0,0 +1,5 @@
+-- Record plugin-level tool calls from the LLM agent loop (MySQL)
+-- Plugin calls have no tools row, so tool_id no longer references tools
+
+ALTER TABLE tool_histories DROP FOREIGN KEY fk_tool_history_tool;
+ALTER TABLE tool_histories ADD COLUMN plugin_name varchar(100) DEFAULT NULL COMMENT '执行的插件，LLM直接调用插件时tool_id为0';
@@ -0,0 +1,3 @@
+-- Remove versioned prompt templates
+
+DROP TABLE IF EXISTS prompt_template;
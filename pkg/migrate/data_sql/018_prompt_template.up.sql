@@ -0,0 +1,18 @@
+-- Versioned prompt templates with platform-wide and per-tenant overrides (MySQL)
+
+CREATE TABLE IF NOT EXISTS prompt_template (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    name varchar(100) NOT NULL,
+    tenant_id bigint unsigned NOT NULL DEFAULT 0,
+    global tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否为对所有租户生效的平台级版本',
+    version bigint NOT NULL,
+    content text NOT NULL COMMENT 'text/template语法的模板内容',
+    variables text COMMENT '模板可以使用的变量（JSON格式）',
+    description varchar(255) DEFAULT NULL,
+    active tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否为该范围内生效的版本',
+    created_by bigint unsigned DEFAULT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_prompt_version (name, tenant_id, global, version),
+    KEY idx_prompt_template_active (active)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
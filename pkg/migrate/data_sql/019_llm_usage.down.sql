@@ -0,0 +1,3 @@
+-- Remove per-call LLM token usage records
+
+DROP TABLE IF EXISTS llm_usage;
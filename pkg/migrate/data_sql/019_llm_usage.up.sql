@@ -0,0 +1,19 @@
+-- Per-call LLM token usage and cost records (MySQL)
+
+CREATE TABLE IF NOT EXISTS llm_usage (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned NOT NULL DEFAULT 0,
+    user_id bigint unsigned NOT NULL DEFAULT 0,
+    source varchar(20) NOT NULL COMMENT '调用来源，如chat、stream、agent、summary、rag',
+    provider varchar(100) NOT NULL,
+    model varchar(255) NOT NULL,
+    prompt_tokens bigint NOT NULL DEFAULT 0,
+    completion_tokens bigint NOT NULL DEFAULT 0,
+    total_tokens bigint NOT NULL DEFAULT 0,
+    estimated tinyint(1) NOT NULL DEFAULT 0 COMMENT '模型没有返回用量时按文本长度估算',
+    cost double NOT NULL DEFAULT 0 COMMENT '按记录时的单价计算的费用',
+    created_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    KEY idx_llm_usage_tenant_time (tenant_id, created_at),
+    KEY idx_llm_usage_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
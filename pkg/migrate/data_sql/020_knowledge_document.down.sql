@@ -0,0 +1,3 @@
+-- Remove knowledge base documents
+
+DROP TABLE IF EXISTS knowledge_document;
@@ -0,0 +1,26 @@
+-- Knowledge base documents uploaded for RAG indexing (MySQL)
+
+CREATE TABLE IF NOT EXISTS knowledge_document (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    tenant_id bigint unsigned NOT NULL DEFAULT 0,
+    collection varchar(64) NOT NULL,
+    content_hash varchar(64) NOT NULL COMMENT '转换后内容的SHA-256',
+    title varchar(255) NOT NULL,
+    filename varchar(255) DEFAULT NULL,
+    content_type varchar(20) NOT NULL COMMENT 'markdown、text、html或pdf',
+    size bigint NOT NULL DEFAULT 0 COMMENT '上传内容的字节数',
+    content mediumtext COMMENT '转换后的Markdown',
+    status varchar(20) NOT NULL COMMENT 'pending、indexing、indexed或failed',
+    progress bigint NOT NULL DEFAULT 0 COMMENT '索引进度，0到100',
+    error text,
+    chunk_ids text COMMENT '向量库中切片的ID（JSON数组）',
+    chunk_count bigint NOT NULL DEFAULT 0,
+    created_by bigint unsigned DEFAULT NULL,
+    indexed_at datetime(3) DEFAULT NULL,
+    created_at datetime(3) DEFAULT NULL,
+    updated_at datetime(3) DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_knowledge_document_hash (tenant_id, collection, content_hash),
+    KEY idx_knowledge_document_status (status),
+    KEY idx_knowledge_document_updated_at (updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
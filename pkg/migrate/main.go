@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -8,7 +10,9 @@ import (
 
 	"weave/config"
 	"weave/pkg"
+	"weave/pkg/anomaly"
 	"weave/pkg/migrate/migration"
+	"weave/pkg/retention"
 )
 
 func main() {
@@ -34,11 +38,18 @@ func main() {
 	createCmd := flag.NewFlagSet("create", flag.ExitOnError)
 	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
 	initCmd := flag.NewFlagSet("init", flag.ExitOnError)
+	checkTeamsCmd := flag.NewFlagSet("check-teams", flag.ExitOnError)
+	auditVerifyCmd := flag.NewFlagSet("audit-verify", flag.ExitOnError)
+	auditCheckpointCmd := flag.NewFlagSet("audit-checkpoint", flag.ExitOnError)
+	retentionRunCmd := flag.NewFlagSet("retention-run", flag.ExitOnError)
+	anomalyScanCmd := flag.NewFlagSet("anomaly-scan", flag.ExitOnError)
 
 	createName := createCmd.String("name", "", "Migration name")
+	checkTeamsFix := checkTeamsCmd.Bool("fix", false, "Fix inconsistent team membership data")
+	auditVerifyTenant := auditVerifyCmd.Uint("tenant", 0, "Tenant ID to verify, 0 verifies all tenants")
 
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: migrate [up|down|create|status|init]")
+		fmt.Println("Usage: migrate [up|down|create|status|init|check-teams|audit-verify|audit-checkpoint|retention-run|anomaly-scan]")
 		os.Exit(1)
 	}
 
@@ -91,8 +102,72 @@ func main() {
 		}
 		fmt.Println("Initial migrations generated successfully")
 
+	case "check-teams":
+		checkTeamsCmd.Parse(os.Args[2:])
+		report, err := pkg.CheckTeamMembership(context.Background(), *checkTeamsFix)
+		if err != nil {
+			log.Fatalf("Failed to check team membership: %v", err)
+		}
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+		if len(report.Issues) > 0 && !*checkTeamsFix {
+			os.Exit(2)
+		}
+
+	case "audit-verify":
+		auditVerifyCmd.Parse(os.Args[2:])
+		var results []*pkg.AuditVerifyResult
+		if *auditVerifyTenant != 0 {
+			result, err := pkg.VerifyAuditChain(pkg.DB.WithContext(pkg.WithoutTenantScope(context.Background())), *auditVerifyTenant)
+			if err != nil {
+				log.Fatalf("Failed to verify audit chain: %v", err)
+			}
+			results = append(results, result)
+		} else {
+			var err error
+			if results, err = pkg.VerifyAllAuditChains(context.Background()); err != nil {
+				log.Fatalf("Failed to verify audit chains: %v", err)
+			}
+		}
+		output, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(output))
+		for _, result := range results {
+			if !result.Valid {
+				os.Exit(2)
+			}
+		}
+
+	case "audit-checkpoint":
+		auditCheckpointCmd.Parse(os.Args[2:])
+		count, err := pkg.CreateAuditCheckpoints(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to create audit checkpoints: %v", err)
+		}
+		fmt.Printf("Created %d audit checkpoints\n", count)
+
+	case "retention-run":
+		retentionRunCmd.Parse(os.Args[2:])
+		job, err := retention.Default()
+		if err != nil {
+			log.Fatalf("Failed to initialize retention job: %v", err)
+		}
+		report, err := job.Run(context.Background())
+		output, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(output))
+		if err != nil {
+			log.Fatalf("Failed to run retention job: %v", err)
+		}
+
+	case "anomaly-scan":
+		anomalyScanCmd.Parse(os.Args[2:])
+		count, err := anomaly.NewDetector(nil, anomaly.Options{BatchSize: config.Config.Anomaly.BatchSize}).Run(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to run anomaly detection: %v", err)
+		}
+		fmt.Printf("Raised %d security alerts\n", count)
+
 	default:
-		fmt.Println("Usage: migrate [up|down|create|status|init]")
+		fmt.Println("Usage: migrate [up|down|create|status|init|check-teams|audit-verify|audit-checkpoint|retention-run|anomaly-scan]")
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ProblemContentType RFC 7807错误响应的媒体类型
+const ProblemContentType = "application/problem+json"
+
+// RequestIDHeader 请求ID的请求头和上下文键
+const RequestIDHeader = "X-Request-ID"
+
+// ProblemTypeBase 错误类型URI的前缀，完整URI为前缀加上小写、以连字符分隔的错误码
+var ProblemTypeBase = "https://weave.dev/problems/"
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Problem RFC 7807错误响应
+// code、message和details是扩展字段，message与detail相同，兼容旧的{code, message}格式
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	Message   string       `json:"message,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Details   interface{}  `json:"details,omitempty"`
+}
+
+// ProblemType 返回错误码对应的类型URI
+func ProblemType(code ErrorCode) string {
+	return ProblemTypeBase + strings.ReplaceAll(strings.ToLower(string(code)), "_", "-")
+}
+
+// RequestID 返回当前请求的ID，依次取上下文、请求头，都没有时生成新的ID并写入响应头
+func RequestID(c *gin.Context) string {
+	requestID := c.GetString(RequestIDHeader)
+	if requestID == "" {
+		requestID = c.GetHeader(RequestIDHeader)
+	}
+	if requestID == "" {
+		requestID = GenerateRequestID()
+	}
+	c.Set(RequestIDHeader, requestID)
+	c.Header(RequestIDHeader, requestID)
+	return requestID
+}
+
+// NewProblem 将错误转换为Problem，非AppError按内部错误处理，不暴露原始错误信息
+// 信息和字段错误按Accept-Language翻译；details只在4xx错误中返回
+func NewProblem(c *gin.Context, err error) *Problem {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		appErr = NewInternalError("Internal server error", err)
+	}
+	lang := NegotiateLanguage(c.GetHeader("Accept-Language"))
+	status := GetHTTPStatus(appErr)
+	detail := LocalizeMessage(lang, appErr.Message)
+
+	problem := &Problem{
+		Type:      ProblemType(appErr.Code),
+		Title:     ErrorTitle(lang, appErr.Code),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      appErr.Code,
+		Message:   detail,
+		RequestID: RequestID(c),
+		Errors:    fieldErrors(lang, appErr.Err),
+	}
+	if status < 500 {
+		problem.Details = appErr.Details
+	}
+	return problem
+}
+
+// RespondError 以application/problem+json格式写入错误响应，所有错误路径都应通过该函数输出
+func RespondError(c *gin.Context, err error) {
+	problem := NewProblem(c, err)
+	if lang := NegotiateLanguage(c.GetHeader("Accept-Language")); lang != "" {
+		c.Header("Content-Language", lang)
+	}
+	c.Header("Vary", "Accept-Language")
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(problem.Status, problem)
+}
+
+// AbortWithError 写入错误响应并中止后续处理，用于中间件
+func AbortWithError(c *gin.Context, err error) {
+	RespondError(c, err)
+	c.Abort()
+}
+
+// fieldErrors 从请求绑定错误中提取字段错误
+func fieldErrors(lang string, err error) []FieldError {
+	if err == nil {
+		return nil
+	}
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		result := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			result = append(result, FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: localizeValidation(lang, fe.Field(), fe.Tag(), fe.Param()),
+			})
+		}
+		return result
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: localizeValidation(lang, typeErr.Field, "type", typeErr.Type.String()),
+		}}
+	}
+	return nil
+}
+
+// init 让校验错误中的字段名使用json、form或uri标签中的名称，与请求中的字段一致
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, key := range []string{"json", "form", "uri"} {
+				name := strings.SplitN(field.Tag.Get(key), ",", 2)[0]
+				if name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
@@ -0,0 +1,407 @@
+// Package prompt 提供LLM和RAG服务使用的提示词模板库
+//
+// 模板按名称解析，依次使用租户启用的版本、平台级启用的版本和内置模板：
+//   - 内置模板随代码发布，声明了调用方会提供的变量，保证未做任何配置时行为不变
+//   - 平台级和租户版本保存在prompt_template表中，每次修改创建新版本，可以随时切换回旧版本
+//
+// 模板使用text/template语法，变量以{{.name}}引用。解析结果缓存一小段时间，通过本包修改版本时立即失效。
+package prompt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"weave/models"
+	"weave/pkg"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 内置模板名称
+const (
+	ChatSystem  = "chat.system"  // 对话未固定系统提示词时使用的系统提示词
+	ChatSummary = "chat.summary" // 将较早的对话压缩为摘要
+	RAGSystem   = "rag.system"   // 知识库问答的系统提示词
+	RAGUser     = "rag.user"     // 组合检索到的文档和问题
+)
+
+// 模板来源
+const (
+	SourceTenant  = "tenant"
+	SourceGlobal  = "global"
+	SourceBuiltin = "builtin"
+)
+
+// cacheTTL 解析结果的缓存时间，其他实例修改的版本最迟在这之后生效
+const cacheTTL = 30 * time.Second
+
+var (
+	// ErrTemplateNotFound 既没有内置模板也没有启用的版本
+	ErrTemplateNotFound = errors.New("prompt template not found")
+	// ErrVersionNotFound 指定的版本不存在
+	ErrVersionNotFound = errors.New("prompt template version not found")
+)
+
+// Definition 内置模板
+type Definition struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Variables   []string `json:"variables"`
+	Content     string   `json:"content"`
+}
+
+// builtins 内置模板，内容与引入模板库之前硬编码的提示词一致
+var builtins = map[string]Definition{
+	ChatSystem: {
+		Name:        ChatSystem,
+		Description: "对话未固定系统提示词时使用的系统提示词",
+		Variables:   []string{},
+		Content:     "PaiChat，回答应当:\n- 简洁明了\n- 逻辑清晰\n- 必要时提供示例\n",
+	},
+	ChatSummary: {
+		Name:        ChatSummary,
+		Description: "将已有摘要和较早的对话合并为新摘要",
+		Variables:   []string{"max_tokens", "summary", "conversation"},
+		Content: "将以下对话压缩为不超过{{.max_tokens}}个令牌的摘要，保留关键事实、用户的偏好和尚未解决的问题，只输出摘要。\n\n" +
+			"{{if .summary}}已有摘要:\n{{.summary}}\n\n{{end}}" +
+			"对话:\n{{.conversation}}\n摘要:",
+	},
+	RAGSystem: {
+		Name:        RAGSystem,
+		Description: "知识库问答的系统提示词",
+		Variables:   []string{},
+		Content:     "你是一个知识助手。基于提供的文档回答用户问题。如果文档中没有相关信息，请诚实地表明你不知道，不要编造答案。",
+	},
+	RAGUser: {
+		Name:        RAGUser,
+		Description: "组合检索到的文档片段和问题，没有检索到文档时context为空",
+		Variables:   []string{"query", "context"},
+		Content:     "{{if .context}}基于以下信息回答我的问题：\n\n{{.context}}\n\n问题：{{.query}}{{else}}{{.query}}{{end}}",
+	},
+}
+
+// Builtins 返回所有内置模板，按名称排序
+func Builtins() []Definition {
+	definitions := make([]Definition, 0, len(builtins))
+	for _, definition := range builtins {
+		definitions = append(definitions, definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	return definitions
+}
+
+// Builtin 返回内置模板
+func Builtin(name string) (Definition, bool) {
+	definition, ok := builtins[name]
+	return definition, ok
+}
+
+// Template 可以渲染的模板
+type Template struct {
+	Name      string   `json:"name"`
+	Content   string   `json:"content"`
+	Variables []string `json:"variables"`
+	Source    string   `json:"source"`            // tenant、global或builtin
+	Version   int      `json:"version,omitempty"` // 内置模板为0
+
+	tmpl *template.Template
+}
+
+// Parse 解析模板内容，内容只能引用声明的变量
+func Parse(name, content string, variables []string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{Name: name, Content: content, Variables: variables, tmpl: tmpl}
+	// 用空值试渲染一次，检查是否引用了未声明的变量
+	if _, err := t.Execute(nil); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Execute 渲染模板，未提供的已声明变量按空字符串处理，提供未声明的变量时返回错误
+func (t *Template) Execute(vars map[string]interface{}) (string, error) {
+	declared := make(map[string]bool, len(t.Variables))
+	data := make(map[string]interface{}, len(t.Variables))
+	for _, name := range t.Variables {
+		declared[name] = true
+		data[name] = ""
+	}
+	for name, value := range vars {
+		if !declared[name] {
+			return "", fmt.Errorf("undeclared variable %q", name)
+		}
+		data[name] = value
+	}
+
+	var out bytes.Buffer
+	if err := t.tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// FromVersion 解析保存的模板版本
+func FromVersion(version *models.PromptTemplate) (*Template, error) {
+	t, err := Parse(version.Name, version.Content, version.Variables)
+	if err != nil {
+		return nil, err
+	}
+	t.Source, t.Version = SourceTenant, version.Version
+	if version.Global {
+		t.Source = SourceGlobal
+	}
+	return t, nil
+}
+
+// fromBuiltin 解析内置模板
+func fromBuiltin(definition Definition) *Template {
+	t, err := Parse(definition.Name, definition.Content, definition.Variables)
+	if err != nil {
+		panic(fmt.Sprintf("invalid builtin prompt %s: %v", definition.Name, err))
+	}
+	t.Source = SourceBuiltin
+	return t
+}
+
+// VariablesFor 返回模板名称可以使用的变量：内置模板使用声明的变量，自定义模板使用请求提供的变量
+func VariablesFor(name string, requested []string) []string {
+	if definition, ok := builtins[name]; ok {
+		return definition.Variables
+	}
+	if requested == nil {
+		return []string{}
+	}
+	return requested
+}
+
+// cacheEntry 解析结果缓存项
+type cacheEntry struct {
+	template  *Template
+	expiresAt time.Time
+}
+
+// cache 按租户和模板名称缓存解析结果
+var cache = struct {
+	sync.RWMutex
+	entries map[string]cacheEntry
+}{entries: make(map[string]cacheEntry)}
+
+// Invalidate 清空解析结果缓存
+func Invalidate() {
+	cache.Lock()
+	cache.entries = make(map[string]cacheEntry)
+	cache.Unlock()
+}
+
+// db 返回跳过自动租户隔离的会话，本包的查询都显式带范围条件
+func db(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return pkg.DB.WithContext(pkg.WithoutTenantScope(ctx))
+}
+
+// Resolve 返回租户生效的模板：租户启用的版本、平台级启用的版本、内置模板
+func Resolve(ctx context.Context, tenantID uint, name string) (*Template, error) {
+	key := fmt.Sprintf("%d/%s", tenantID, name)
+	cache.RLock()
+	entry, ok := cache.entries[key]
+	cache.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.template, nil
+	}
+
+	t, err := resolve(ctx, tenantID, name)
+	if err != nil {
+		return nil, err
+	}
+	cache.Lock()
+	cache.entries[key] = cacheEntry{template: t, expiresAt: time.Now().Add(cacheTTL)}
+	cache.Unlock()
+	return t, nil
+}
+
+// resolve 不经过缓存解析模板
+func resolve(ctx context.Context, tenantID uint, name string) (*Template, error) {
+	if pkg.DB != nil {
+		var versions []models.PromptTemplate
+		err := db(ctx).Where("name = ? AND active = ?", name, true).
+			Where("(global = ? AND tenant_id = 0) OR (global = ? AND tenant_id = ?)", true, false, tenantID).
+			Order("global ASC").Find(&versions).Error
+		if err != nil {
+			return nil, err
+		}
+		// 租户版本排在平台级版本之前
+		if len(versions) > 0 {
+			return FromVersion(&versions[0])
+		}
+	}
+	if definition, ok := builtins[name]; ok {
+		return fromBuiltin(definition), nil
+	}
+	return nil, ErrTemplateNotFound
+}
+
+// Render 按租户生效的模板渲染提示词
+// 启用的版本无法加载或渲染失败时记录警告并改用内置模板，避免错误的配置中断服务
+func Render(ctx context.Context, tenantID uint, name string, vars map[string]interface{}) (string, error) {
+	t, err := Resolve(ctx, tenantID, name)
+	if err == nil {
+		var text string
+		if text, err = t.Execute(vars); err == nil {
+			return text, nil
+		}
+	}
+	if _, ok := builtins[name]; !ok {
+		return "", err
+	}
+	pkg.Warn("Failed to render prompt template, using builtin", zap.String("name", name), zap.Uint("tenant_id", tenantID), zap.Error(err))
+	return RenderBuiltin(name, vars)
+}
+
+// RenderBuiltin 用内置模板渲染提示词，不读取数据库
+func RenderBuiltin(name string, vars map[string]interface{}) (string, error) {
+	definition, ok := builtins[name]
+	if !ok {
+		return "", ErrTemplateNotFound
+	}
+	return fromBuiltin(definition).Execute(vars)
+}
+
+// scopeQuery 限定为平台级或租户的版本
+func scopeQuery(tx *gorm.DB, name string, global bool, tenantID uint) *gorm.DB {
+	if global {
+		tenantID = 0
+	}
+	return tx.Model(&models.PromptTemplate{}).Where("name = ? AND global = ? AND tenant_id = ?", name, global, tenantID)
+}
+
+// Versions 返回模板的平台级版本和租户版本，按范围和版本号倒序排列
+func Versions(ctx context.Context, tenantID uint, name string) ([]models.PromptTemplate, error) {
+	var versions []models.PromptTemplate
+	err := db(ctx).Where("name = ? AND ((global = ? AND tenant_id = 0) OR (global = ? AND tenant_id = ?))", name, true, false, tenantID).
+		Order("global DESC, version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Names 返回租户可以使用的模板名称：内置模板以及平台级或租户有版本的自定义模板
+func Names(ctx context.Context, tenantID uint) ([]string, error) {
+	var stored []string
+	err := db(ctx).Model(&models.PromptTemplate{}).
+		Where("(global = ? AND tenant_id = 0) OR (global = ? AND tenant_id = ?)", true, false, tenantID).
+		Distinct().Pluck("name", &stored).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(builtins)+len(stored))
+	names := make([]string, 0, len(builtins)+len(stored))
+	for _, name := range append(sortedBuiltinNames(), stored...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// sortedBuiltinNames 返回内置模板名称
+func sortedBuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CreateVersion 校验并保存模板的新版本，版本号在范围内递增；activate为true时同时启用该版本
+// 内置模板的变量固定为声明的变量
+func CreateVersion(ctx context.Context, version *models.PromptTemplate, activate bool) error {
+	version.Name = strings.TrimSpace(version.Name)
+	version.Variables = VariablesFor(version.Name, version.Variables)
+	if version.Global {
+		version.TenantID = 0
+	}
+	if _, err := Parse(version.Name, version.Content, version.Variables); err != nil {
+		return &InvalidTemplateError{Err: err}
+	}
+
+	err := db(ctx).Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := scopeQuery(tx, version.Name, version.Global, version.TenantID).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		version.Version = latest + 1
+		if activate {
+			if err := scopeQuery(tx, version.Name, version.Global, version.TenantID).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		version.Active = activate
+		return tx.Create(version).Error
+	})
+	if err != nil {
+		return err
+	}
+	Invalidate()
+	return nil
+}
+
+// Activate 启用范围内的指定版本，同一范围内的其他版本停用
+func Activate(ctx context.Context, name string, global bool, tenantID uint, number int) (*models.PromptTemplate, error) {
+	var version models.PromptTemplate
+	err := db(ctx).Transaction(func(tx *gorm.DB) error {
+		err := scopeQuery(tx, name, global, tenantID).Where("version = ?", number).First(&version).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVersionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := scopeQuery(tx, name, global, tenantID).Update("active", false).Error; err != nil {
+			return err
+		}
+		version.Active = true
+		return tx.Model(&version).Update("active", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	Invalidate()
+	return &version, nil
+}
+
+// Deactivate 停用范围内启用的版本，之后改用下一级的模板
+func Deactivate(ctx context.Context, name string, global bool, tenantID uint) error {
+	if err := scopeQuery(db(ctx), name, global, tenantID).Update("active", false).Error; err != nil {
+		return err
+	}
+	Invalidate()
+	return nil
+}
+
+// InvalidTemplateError 模板内容无法解析或引用了未声明的变量
+type InvalidTemplateError struct {
+	Err error
+}
+
+func (e *InvalidTemplateError) Error() string {
+	return "invalid prompt template: " + e.Err.Error()
+}
+
+func (e *InvalidTemplateError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,355 @@
+// Package quota 提供租户配额校验与用量计量
+//
+// 配额分为两类：
+//   - 存量配额：用户、团队、工具、笔记数量，创建前按当前记录数校验
+//   - 用量配额：每日插件执行次数、每月LLM令牌数，按usage_daily汇总表校验
+//
+// 校验与写入不在同一事务中，并发请求可能让用量略微超出上限，这是为避免热点锁而接受的误差。
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/metrics"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 存量资源
+const (
+	ResourceUsers = "users"
+	ResourceTeams = "teams"
+	ResourceTools = "tools"
+	ResourceNotes = "notes"
+)
+
+// 计量指标
+const (
+	MetricPluginExecutions = "plugin_executions"
+	MetricLLMTokens        = "llm_tokens"
+)
+
+// dayLayout usage_daily.day 的日期格式
+const dayLayout = "2006-01-02"
+
+// Limits 租户生效配额，0表示不限制
+type Limits struct {
+	MaxUsers                  int64 `json:"max_users"`
+	MaxTeams                  int64 `json:"max_teams"`
+	MaxTools                  int64 `json:"max_tools"`
+	MaxNotes                  int64 `json:"max_notes"`
+	MaxPluginExecutionsPerDay int64 `json:"max_plugin_executions_per_day"`
+	MaxLLMTokensPerMonth      int64 `json:"max_llm_tokens_per_month"`
+}
+
+// Usage 租户当前用量
+type Usage struct {
+	Users                 int64 `json:"users"`
+	Teams                 int64 `json:"teams"`
+	Tools                 int64 `json:"tools"`
+	Notes                 int64 `json:"notes"`
+	PluginExecutionsToday int64 `json:"plugin_executions_today"`
+	LLMTokensThisMonth    int64 `json:"llm_tokens_this_month"`
+}
+
+// resourceModels 存量资源对应的模型
+var resourceModels = map[string]interface{}{
+	ResourceUsers: &models.User{},
+	ResourceTeams: &models.Team{},
+	ResourceTools: &models.Tool{},
+	ResourceNotes: &models.Note{},
+}
+
+// db 返回跳过自动租户隔离的会话，本包的查询都显式带tenant_id条件
+func db(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return pkg.DB.WithContext(pkg.WithoutTenantScope(ctx))
+}
+
+// GetLimits 获取租户生效配额：租户单独配置优先，否则使用全局默认值
+func GetLimits(ctx context.Context, tenantID uint) (Limits, error) {
+	limits := Limits{
+		MaxUsers:                  config.Config.Quota.MaxUsers,
+		MaxTeams:                  config.Config.Quota.MaxTeams,
+		MaxTools:                  config.Config.Quota.MaxTools,
+		MaxNotes:                  config.Config.Quota.MaxNotes,
+		MaxPluginExecutionsPerDay: config.Config.Quota.MaxPluginExecutionsPerDay,
+		MaxLLMTokensPerMonth:      config.Config.Quota.MaxLLMTokensPerMonth,
+	}
+	if pkg.DB == nil {
+		return limits, nil
+	}
+
+	var override models.TenantQuota
+	err := db(ctx).Where("tenant_id = ?", tenantID).First(&override).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return limits, nil
+	}
+	if err != nil {
+		return limits, err
+	}
+
+	applyOverride(&limits.MaxUsers, override.MaxUsers)
+	applyOverride(&limits.MaxTeams, override.MaxTeams)
+	applyOverride(&limits.MaxTools, override.MaxTools)
+	applyOverride(&limits.MaxNotes, override.MaxNotes)
+	applyOverride(&limits.MaxPluginExecutionsPerDay, override.MaxPluginExecutionsPerDay)
+	applyOverride(&limits.MaxLLMTokensPerMonth, override.MaxLLMTokensPerMonth)
+	return limits, nil
+}
+
+// applyOverride 用租户配置覆盖默认值
+func applyOverride(target *int64, value *int64) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// limitForResource 返回存量资源的上限
+func (l Limits) limitForResource(resource string) int64 {
+	switch resource {
+	case ResourceUsers:
+		return l.MaxUsers
+	case ResourceTeams:
+		return l.MaxTeams
+	case ResourceTools:
+		return l.MaxTools
+	case ResourceNotes:
+		return l.MaxNotes
+	}
+	return 0
+}
+
+// CheckResource 校验租户是否还能再创建一个存量资源
+func CheckResource(ctx context.Context, tenantID uint, resource string) error {
+	if !config.Config.Quota.Enabled || pkg.DB == nil {
+		return nil
+	}
+
+	model, ok := resourceModels[resource]
+	if !ok {
+		return fmt.Errorf("unknown quota resource: %s", resource)
+	}
+
+	limits, err := GetLimits(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	limit := limits.limitForResource(resource)
+	if limit <= 0 {
+		return nil
+	}
+
+	var count int64
+	if err := db(ctx).Model(model).Where("tenant_id = ?", tenantID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= limit {
+		metrics.RecordQuotaRejection(resource)
+		return quotaExceeded(resource, limit, count)
+	}
+	return nil
+}
+
+// CheckUsage 校验租户在当前周期内追加amount用量后是否超出配额
+// 插件执行按自然日计算，LLM令牌按自然月计算
+func CheckUsage(ctx context.Context, tenantID uint, metric string, amount int64) error {
+	if !config.Config.Quota.Enabled || pkg.DB == nil {
+		return nil
+	}
+
+	limits, err := GetLimits(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	var limit int64
+	var used int64
+	now := time.Now()
+	switch metric {
+	case MetricPluginExecutions:
+		limit = limits.MaxPluginExecutionsPerDay
+		if limit <= 0 {
+			return nil
+		}
+		used, err = sumUsage(ctx, tenantID, metric, now, now)
+	case MetricLLMTokens:
+		limit = limits.MaxLLMTokensPerMonth
+		if limit <= 0 {
+			return nil
+		}
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		used, err = sumUsage(ctx, tenantID, metric, monthStart, now)
+	default:
+		return fmt.Errorf("unknown quota metric: %s", metric)
+	}
+	if err != nil {
+		return err
+	}
+
+	if used+amount > limit {
+		metrics.RecordQuotaRejection(metric)
+		return quotaExceeded(metric, limit, used)
+	}
+	return nil
+}
+
+// quotaExceeded 构造配额超限错误
+func quotaExceeded(resource string, limit, used int64) *pkg.AppError {
+	return pkg.NewQuotaExceededError(fmt.Sprintf("Tenant quota exceeded for %s", resource), nil).
+		WithDetails(map[string]interface{}{
+			"resource": resource,
+			"limit":    limit,
+			"used":     used,
+		})
+}
+
+// sumUsage 汇总租户在[from, to]日期范围内的用量
+func sumUsage(ctx context.Context, tenantID uint, metric string, from, to time.Time) (int64, error) {
+	var total int64
+	err := db(ctx).Model(&models.UsageDaily{}).
+		Where("tenant_id = ? AND metric = ? AND day >= ? AND day <= ?", tenantID, metric, from.Format(dayLayout), to.Format(dayLayout)).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// Record 记录一次用量，累加到当天的汇总行
+func Record(ctx context.Context, tenantID uint, metric, resource string, quantity int64) error {
+	if quantity <= 0 || pkg.DB == nil {
+		return nil
+	}
+
+	row := models.UsageDaily{
+		TenantID: tenantID,
+		Metric:   metric,
+		Resource: resource,
+		Day:      time.Now().Format(dayLayout),
+		Quantity: quantity,
+	}
+	err := db(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tenant_id"}, {Name: "metric"}, {Name: "resource"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":   gorm.Expr("usage_daily.quantity + ?", quantity),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+
+	metrics.RecordUsage(metric, quantity)
+	return nil
+}
+
+// RecordFromContext 从上下文获取租户并记录用量，上下文没有租户信息时忽略
+func RecordFromContext(ctx context.Context, metric, resource string, quantity int64) error {
+	tenantID, ok := pkg.TenantIDFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return Record(ctx, tenantID, metric, resource, quantity)
+}
+
+// CheckUsageFromContext 从上下文获取租户并校验用量配额，上下文没有租户信息时放行
+func CheckUsageFromContext(ctx context.Context, metric string, amount int64) error {
+	tenantID, ok := pkg.TenantIDFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return CheckUsage(ctx, tenantID, metric, amount)
+}
+
+// GetUsage 获取租户当前用量
+func GetUsage(ctx context.Context, tenantID uint) (Usage, error) {
+	var usage Usage
+	if pkg.DB == nil {
+		return usage, nil
+	}
+
+	counts := map[string]*int64{
+		ResourceUsers: &usage.Users,
+		ResourceTeams: &usage.Teams,
+		ResourceTools: &usage.Tools,
+		ResourceNotes: &usage.Notes,
+	}
+	for resource, target := range counts {
+		if err := db(ctx).Model(resourceModels[resource]).Where("tenant_id = ?", tenantID).Count(target).Error; err != nil {
+			return usage, err
+		}
+	}
+
+	now := time.Now()
+	var err error
+	if usage.PluginExecutionsToday, err = sumUsage(ctx, tenantID, MetricPluginExecutions, now, now); err != nil {
+		return usage, err
+	}
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if usage.LLMTokensThisMonth, err = sumUsage(ctx, tenantID, MetricLLMTokens, monthStart, now); err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// DailyRollup 按天汇总的用量
+type DailyRollup struct {
+	Day      string `json:"day"`
+	Metric   string `json:"metric"`
+	Quantity int64  `json:"quantity"`
+}
+
+// GetDailyRollups 获取租户在日期范围内按天、按指标汇总的用量
+func GetDailyRollups(ctx context.Context, tenantID uint, metric string, from, to time.Time) ([]DailyRollup, error) {
+	query := db(ctx).Model(&models.UsageDaily{}).
+		Select("day, metric, SUM(quantity) AS quantity").
+		Where("tenant_id = ? AND day >= ? AND day <= ?", tenantID, from.Format(dayLayout), to.Format(dayLayout))
+	if metric != "" {
+		query = query.Where("metric = ?", metric)
+	}
+
+	var rollups []DailyRollup
+	err := query.Group("day, metric").Order("day ASC, metric ASC").Scan(&rollups).Error
+	return rollups, err
+}
+
+// ResourceUsage 按资源汇总的用量
+type ResourceUsage struct {
+	Resource string `json:"resource"`
+	Quantity int64  `json:"quantity"`
+}
+
+// GetResourceBreakdown 获取租户在日期范围内按资源（插件、模型）汇总的用量
+func GetResourceBreakdown(ctx context.Context, tenantID uint, metric string, from, to time.Time) ([]ResourceUsage, error) {
+	var rows []ResourceUsage
+	err := db(ctx).Model(&models.UsageDaily{}).
+		Select("resource, SUM(quantity) AS quantity").
+		Where("tenant_id = ? AND metric = ? AND day >= ? AND day <= ?", tenantID, metric, from.Format(dayLayout), to.Format(dayLayout)).
+		Group("resource").
+		Order("quantity DESC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// EstimateTokens 估算文本的令牌数
+// 中日韩字符按每字一个令牌计，其余字符按约4个字符一个令牌计
+func EstimateTokens(text string) int64 {
+	var cjk, other int64
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk++
+		} else if !unicode.IsSpace(r) {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
@@ -0,0 +1,656 @@
+// Package retention 按租户保留策略归档并删除过期的审计日志、登录历史和工具使用历史
+//
+// 保留任务按ID顺序取出早于保留期限的连续记录，写成gzip压缩的NDJSON归档文件（本地目录或S3兼容存储），
+// 在同一事务内记录归档并删除这些记录。归档按ID范围组织，可以按时间范围恢复回数据库，
+// 恢复的记录在RestoreTTL后再次删除。保留策略设置了法律保全时暂停该资源的一切删除。
+//
+// 审计日志归档前校验链段的哈希链，链头记录永远保留，使新的审计日志可以继续链接；
+// 归档记录保存最后一条链上记录的序号和哈希，哈希链校验从这里接续。
+package retention
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/metrics"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrUnknownResource 不支持保留策略的资源
+var ErrUnknownResource = errors.New("unknown retention resource")
+
+// insertBatchSize 恢复时单条INSERT语句包含的最大记录数
+const insertBatchSize = 100
+
+// row 待归档或已恢复的一条记录
+type row struct {
+	id    uint
+	at    time.Time
+	value interface{}
+}
+
+// resource 描述一种可归档的数据
+type resource struct {
+	name        string
+	model       interface{}
+	defaultDays func() int
+	// fetch 按ID升序读取租户中ID大于afterID的记录
+	fetch func(db *gorm.DB, tenantID, afterID uint, limit int) ([]row, error)
+	// decode 解析归档文件中的一行
+	decode func(line []byte) (row, error)
+	// insert 恢复记录，已存在的ID跳过，返回写入的记录数
+	insert func(db *gorm.DB, rows []row) (int64, error)
+}
+
+// newResource 为模型T创建资源描述，meta返回记录的ID和用于判断过期的时间
+func newResource[T any](name string, defaultDays func() int, meta func(*T) (uint, time.Time)) *resource {
+	var model T
+	toRow := func(item *T) row {
+		id, at := meta(item)
+		return row{id: id, at: at, value: item}
+	}
+	return &resource{
+		name:        name,
+		model:       &model,
+		defaultDays: defaultDays,
+		fetch: func(db *gorm.DB, tenantID, afterID uint, limit int) ([]row, error) {
+			var items []T
+			if err := db.Where("tenant_id = ? AND id > ?", tenantID, afterID).Order("id").Limit(limit).Find(&items).Error; err != nil {
+				return nil, err
+			}
+			rows := make([]row, len(items))
+			for i := range items {
+				rows[i] = toRow(&items[i])
+			}
+			return rows, nil
+		},
+		decode: func(line []byte) (row, error) {
+			item := new(T)
+			if err := json.Unmarshal(line, item); err != nil {
+				return row{}, err
+			}
+			return toRow(item), nil
+		},
+		insert: func(db *gorm.DB, rows []row) (int64, error) {
+			items := make([]T, len(rows))
+			for i, r := range rows {
+				items[i] = *r.value.(*T)
+			}
+			result := db.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&items, insertBatchSize)
+			return result.RowsAffected, result.Error
+		},
+	}
+}
+
+var resources = map[string]*resource{
+	models.RetentionResourceAuditLog: newResource(models.RetentionResourceAuditLog,
+		func() int { return config.Config.Retention.AuditLogDays },
+		func(l *models.AuditLog) (uint, time.Time) { return l.ID, l.CreatedAt }),
+	models.RetentionResourceLoginHistory: newResource(models.RetentionResourceLoginHistory,
+		func() int { return config.Config.Retention.LoginHistoryDays },
+		func(h *models.LoginHistory) (uint, time.Time) { return h.ID, h.LoginTime }),
+	models.RetentionResourceToolHistory: newResource(models.RetentionResourceToolHistory,
+		func() int { return config.Config.Retention.ToolHistoryDays },
+		func(h *models.ToolHistory) (uint, time.Time) { return h.ID, h.UsedAt }),
+}
+
+// IsResource 判断资源是否支持保留策略
+func IsResource(name string) bool {
+	_, ok := resources[name]
+	return ok
+}
+
+// Policy 返回租户对资源生效的保留策略，租户没有单独设置时返回配置中的默认保留天数（ID为0）
+func Policy(db *gorm.DB, tenantID uint, name string) (models.RetentionPolicy, error) {
+	res, ok := resources[name]
+	if !ok {
+		return models.RetentionPolicy{}, ErrUnknownResource
+	}
+	var policy models.RetentionPolicy
+	if err := db.Where("tenant_id = ? AND resource = ?", tenantID, name).Limit(1).Find(&policy).Error; err != nil {
+		return policy, err
+	}
+	if policy.ID == 0 {
+		policy = models.RetentionPolicy{TenantID: tenantID, Resource: name, RetentionDays: res.defaultDays()}
+	}
+	return policy, nil
+}
+
+// Policies 返回租户所有资源生效的保留策略
+func Policies(db *gorm.DB, tenantID uint) ([]models.RetentionPolicy, error) {
+	policies := make([]models.RetentionPolicy, 0, len(models.RetentionResources))
+	for _, name := range models.RetentionResources {
+		policy, err := Policy(db, tenantID, name)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// Options 保留任务配置
+type Options struct {
+	BatchSize  int           // 每个归档文件的最大记录数
+	RestoreTTL time.Duration // 恢复的记录保留时间
+}
+
+// Report 一次保留任务的执行结果
+type Report struct {
+	Archives int `json:"archives"` // 新生成的归档文件数
+	Archived int `json:"archived"` // 归档并删除的记录数
+	Purged   int `json:"purged"`   // 恢复期满后再次删除的记录数
+	Held     int `json:"held"`     // 因法律保全跳过的租户资源数
+}
+
+// Job 数据保留任务
+type Job struct {
+	db    *gorm.DB
+	store Store
+	opts  Options
+}
+
+// NewJob 创建保留任务，db为nil时使用pkg.DB
+func NewJob(db *gorm.DB, store Store, opts Options) *Job {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 5000
+	}
+	if opts.RestoreTTL <= 0 {
+		opts.RestoreTTL = 7 * 24 * time.Hour
+	}
+	return &Job{db: db, store: store, opts: opts}
+}
+
+// database 返回跳过租户隔离的数据库会话
+func (j *Job) database(ctx context.Context) *gorm.DB {
+	db := j.db
+	if db == nil {
+		db = pkg.DB
+	}
+	return db.WithContext(pkg.WithoutTenantScope(ctx))
+}
+
+// Run 对所有租户执行一次保留任务：清理恢复期满的记录，再归档并删除超过保留期限的记录
+func (j *Job) Run(ctx context.Context) (*Report, error) {
+	db := j.database(ctx)
+	report := &Report{}
+	for _, name := range models.RetentionResources {
+		res := resources[name]
+		var tenantIDs []uint
+		if err := db.Model(res.model).Distinct().Order("tenant_id").Pluck("tenant_id", &tenantIDs).Error; err != nil {
+			return report, err
+		}
+		for _, tenantID := range tenantIDs {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			if err := j.runTenant(ctx, db, res, tenantID, report); err != nil {
+				return report, fmt.Errorf("retention for tenant %d %s: %w", tenantID, name, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// runTenant 对一个租户的一种资源执行保留任务
+func (j *Job) runTenant(ctx context.Context, db *gorm.DB, res *resource, tenantID uint, report *Report) error {
+	policy, err := Policy(db, tenantID, res.name)
+	if err != nil {
+		return err
+	}
+	if policy.LegalHold {
+		report.Held++
+		return nil
+	}
+
+	purged, err := j.purgeRestored(db, res, tenantID)
+	report.Purged += purged
+	if err != nil {
+		return err
+	}
+
+	if policy.RetentionDays <= 0 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -policy.RetentionDays)
+	return j.archiveExpired(ctx, db, res, tenantID, cutoff, report)
+}
+
+// archiveExpired 从上次归档的位置开始，按批归档ID连续且早于cutoff的记录
+func (j *Job) archiveExpired(ctx context.Context, db *gorm.DB, res *resource, tenantID uint, cutoff time.Time, report *Report) error {
+	var watermark uint
+	if err := db.Model(&models.RetentionArchive{}).Where("tenant_id = ? AND resource = ?", tenantID, res.name).
+		Select("COALESCE(MAX(to_id), 0)").Scan(&watermark).Error; err != nil {
+		return err
+	}
+
+	// 审计日志的链头必须保留，新的审计日志需要链接到它
+	var headID uint
+	if res.name == models.RetentionResourceAuditLog {
+		if err := db.Model(&models.AuditLog{}).Where("tenant_id = ?", tenantID).
+			Select("COALESCE(MAX(id), 0)").Scan(&headID).Error; err != nil {
+			return err
+		}
+	}
+
+	for {
+		rows, err := res.fetch(db, tenantID, watermark, j.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		expired := 0
+		for _, r := range rows {
+			if !r.at.Before(cutoff) || (headID != 0 && r.id >= headID) {
+				break
+			}
+			expired++
+		}
+		if expired == 0 {
+			return nil
+		}
+
+		archive, err := j.archive(ctx, db, res, tenantID, rows[:expired])
+		if err != nil {
+			return err
+		}
+		report.Archives++
+		report.Archived += archive.Count
+		watermark = archive.ToID
+		if expired < len(rows) || len(rows) < j.opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+// archive 将一批记录写入归档文件，然后在同一事务内记录归档并删除这些记录
+func (j *Job) archive(ctx context.Context, db *gorm.DB, res *resource, tenantID uint, rows []row) (*models.RetentionArchive, error) {
+	first, last := rows[0], rows[len(rows)-1]
+	archive := &models.RetentionArchive{
+		TenantID: tenantID,
+		Resource: res.name,
+		FromID:   first.id,
+		ToID:     last.id,
+		FromTime: first.at,
+		ToTime:   last.at,
+		Count:    len(rows),
+		Storage:  j.store.Name(),
+		Location: fmt.Sprintf("tenant-%d/%s/%010d-%010d.ndjson.gz", tenantID, res.name, first.id, last.id),
+	}
+	for _, r := range rows {
+		if r.at.Before(archive.FromTime) {
+			archive.FromTime = r.at
+		}
+		if r.at.After(archive.ToTime) {
+			archive.ToTime = r.at
+		}
+	}
+
+	if res.name == models.RetentionResourceAuditLog {
+		anchor, err := pkg.AuditArchiveAnchor(db, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		if archive.LastSequence, archive.LastHash, err = verifyAuditRows(anchor, rows); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := encodeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	archive.SHA256 = hex.EncodeToString(sum[:])
+	archive.Size = int64(len(data))
+	if err := j.store.Put(ctx, archive.Location, data); err != nil {
+		return nil, fmt.Errorf("failed to store archive %s: %w", archive.Location, err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(archive).Error; err != nil {
+			return err
+		}
+		deleted, err := deleteRange(tx, res, tenantID, archive.FromID, archive.ToID)
+		if err != nil {
+			return err
+		}
+		if deleted != int64(archive.Count) {
+			// 读取之后有记录被恢复或写入到该范围，放弃本次归档，下次重新读取
+			return fmt.Errorf("archive %s expected to delete %d rows, deleted %d", archive.Location, archive.Count, deleted)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.RecordRetentionRows(res.name, "archived", archive.Count)
+	pkg.Info("Archived expired records",
+		zap.Uint("tenant_id", tenantID),
+		zap.String("resource", res.name),
+		zap.Uint("from_id", archive.FromID),
+		zap.Uint("to_id", archive.ToID),
+		zap.Int("count", archive.Count),
+	)
+	return archive, nil
+}
+
+// purgeRestored 删除恢复期满的记录
+func (j *Job) purgeRestored(db *gorm.DB, res *resource, tenantID uint) (int, error) {
+	var archives []models.RetentionArchive
+	if err := db.Where("tenant_id = ? AND resource = ? AND restored_until < ?", tenantID, res.name, time.Now()).
+		Order("from_id").Find(&archives).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, archive := range archives {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			deleted, err := deleteRange(tx, res, tenantID, archive.FromID, archive.ToID)
+			if err != nil {
+				return err
+			}
+			purged += int(deleted)
+			return tx.Model(&models.RetentionArchive{}).Where("id = ?", archive.ID).
+				Updates(map[string]interface{}{"restored_at": nil, "restored_until": nil}).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+	}
+	if purged > 0 {
+		metrics.RecordRetentionRows(res.name, "purged", purged)
+	}
+	return purged, nil
+}
+
+// deleteRange 删除租户ID范围内的记录
+// 审计日志只允许追加，保留任务需要跳过ORM钩子，在MySQL上还需要在当前连接上设置变量放行删除触发器
+func deleteRange(tx *gorm.DB, res *resource, tenantID, fromID, toID uint) (int64, error) {
+	if res.name != models.RetentionResourceAuditLog {
+		result := tx.Where("tenant_id = ? AND id BETWEEN ? AND ?", tenantID, fromID, toID).Delete(res.model)
+		return result.RowsAffected, result.Error
+	}
+
+	mysql := tx.Dialector.Name() == "mysql"
+	if mysql {
+		if err := tx.Exec("SET @weave_audit_retention = 1").Error; err != nil {
+			return 0, err
+		}
+	}
+	result := tx.Session(&gorm.Session{SkipHooks: true}).
+		Where("tenant_id = ? AND id BETWEEN ? AND ?", tenantID, fromID, toID).Delete(&models.AuditLog{})
+	if mysql {
+		if err := tx.Exec("SET @weave_audit_retention = NULL").Error; err != nil && result.Error == nil {
+			return 0, err
+		}
+	}
+	return result.RowsAffected, result.Error
+}
+
+// verifyAuditRows 校验一段审计日志的哈希链，prev为链段之前的最后一条记录，
+// prev.Sequence为0时不检查链段的起点；返回最后一条链上记录的序号和哈希
+func verifyAuditRows(prev models.AuditLog, rows []row) (uint64, string, error) {
+	for _, r := range rows {
+		log := r.value.(*models.AuditLog)
+		if log.Sequence == 0 {
+			// 引入哈希链之前的历史记录
+			continue
+		}
+		if prev.Sequence != 0 && (log.Sequence != prev.Sequence+1 || log.PrevHash != prev.Hash) {
+			return 0, "", fmt.Errorf("audit chain is broken at sequence %d (audit log %d)", log.Sequence, log.ID)
+		}
+		if pkg.ComputeAuditHash(log) != log.Hash {
+			return 0, "", fmt.Errorf("audit log %d does not match its hash", log.ID)
+		}
+		prev = *log
+	}
+	return prev.Sequence, prev.Hash, nil
+}
+
+// encodeRows 将记录编码为gzip压缩的NDJSON，关联对象不写入归档
+func encodeRows(rows []row) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for _, r := range rows {
+		data, err := json.Marshal(r.value)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		delete(fields, "user")
+		if data, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+		zw.Write(data)
+		zw.Write([]byte{'\n'})
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeRows 解析gzip压缩的NDJSON归档文件
+func decodeRows(res *resource, data []byte) ([]row, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var rows []row
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		r, err := res.decode(scanner.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+	return rows, scanner.Err()
+}
+
+// RestoreResult 恢复结果
+type RestoreResult struct {
+	Archives []models.RetentionArchive `json:"archives"`
+	Restored int64                     `json:"restored"` // 写入数据库的记录数，已存在的记录不计入
+}
+
+// Restore 将租户在[from, to]时间范围内的归档恢复到数据库，恢复前校验文件摘要，审计日志还会校验每条记录的哈希
+// 恢复的记录在RestoreTTL后由保留任务再次删除，处于法律保全时保留到解除保全之后
+func (j *Job) Restore(ctx context.Context, tenantID uint, name string, from, to time.Time) (*RestoreResult, error) {
+	res, ok := resources[name]
+	if !ok {
+		return nil, ErrUnknownResource
+	}
+	db := j.database(ctx)
+
+	var archives []models.RetentionArchive
+	if err := db.Where("tenant_id = ? AND resource = ? AND to_time >= ? AND from_time <= ?", tenantID, name, from, to).
+		Order("from_id").Find(&archives).Error; err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{Archives: archives}
+	until := time.Now().Add(j.opts.RestoreTTL)
+	for i := range archives {
+		archive := &archives[i]
+		rows, err := j.load(ctx, res, archive)
+		if err != nil {
+			return nil, err
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			inserted, err := res.insert(tx, rows)
+			if err != nil {
+				return err
+			}
+			result.Restored += inserted
+			now := time.Now()
+			archive.RestoredAt, archive.RestoredUntil = &now, &until
+			return tx.Model(&models.RetentionArchive{}).Where("id = ?", archive.ID).
+				Updates(map[string]interface{}{"restored_at": now, "restored_until": until}).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.Restored > 0 {
+		metrics.RecordRetentionRows(name, "restored", int(result.Restored))
+	}
+	return result, nil
+}
+
+// load 读取并校验归档文件
+func (j *Job) load(ctx context.Context, res *resource, archive *models.RetentionArchive) ([]row, error) {
+	if archive.Storage != j.store.Name() {
+		return nil, fmt.Errorf("archive %s is stored in %s, current storage is %s", archive.Location, archive.Storage, j.store.Name())
+	}
+	data, err := j.store.Get(ctx, archive.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", archive.Location, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != archive.SHA256 {
+		return nil, fmt.Errorf("archive %s does not match its checksum", archive.Location)
+	}
+	rows, err := decodeRows(res, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode archive %s: %w", archive.Location, err)
+	}
+	if len(rows) != archive.Count {
+		return nil, fmt.Errorf("archive %s contains %d records, expected %d", archive.Location, len(rows), archive.Count)
+	}
+	for _, r := range rows {
+		if r.id < archive.FromID || r.id > archive.ToID || r.value == nil {
+			return nil, fmt.Errorf("archive %s contains record %d outside its range", archive.Location, r.id)
+		}
+	}
+	if res.name == models.RetentionResourceAuditLog {
+		lastSeq, lastHash, err := verifyAuditRows(models.AuditLog{}, rows)
+		if err != nil {
+			return nil, fmt.Errorf("archive %s: %w", archive.Location, err)
+		}
+		if lastSeq != archive.LastSequence || lastHash != archive.LastHash {
+			return nil, fmt.Errorf("archive %s does not end at the recorded audit chain position", archive.Location)
+		}
+	}
+	return rows, nil
+}
+
+// defaultJob 全局保留任务
+var defaultJob struct {
+	sync.Mutex
+	job  *Job
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Default 返回按Retention配置创建的全局保留任务
+func Default() (*Job, error) {
+	defaultJob.Lock()
+	defer defaultJob.Unlock()
+	if defaultJob.job != nil {
+		return defaultJob.job, nil
+	}
+	store, err := NewStore()
+	if err != nil {
+		return nil, err
+	}
+	defaultJob.job = NewJob(nil, store, Options{
+		BatchSize:  config.Config.Retention.BatchSize,
+		RestoreTTL: time.Duration(config.Config.Retention.RestoreTTL) * time.Hour,
+	})
+	return defaultJob.job, nil
+}
+
+// Start 启动保留定期任务，间隔由Retention.Interval配置
+func Start() error {
+	interval := time.Duration(config.Config.Retention.Interval) * time.Second
+	if interval <= 0 {
+		return nil
+	}
+	job, err := Default()
+	if err != nil {
+		return err
+	}
+
+	defaultJob.Lock()
+	defer defaultJob.Unlock()
+	if defaultJob.stop != nil {
+		return nil
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defaultJob.stop = stop
+	defaultJob.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-done:
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				report, err := job.Run(ctx)
+				if err != nil {
+					pkg.Warn("Retention job failed", zap.Error(err))
+				} else if report.Archived > 0 || report.Purged > 0 {
+					pkg.Info("Retention job finished",
+						zap.Int("archives", report.Archives),
+						zap.Int("archived", report.Archived),
+						zap.Int("purged", report.Purged),
+					)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop 停止保留定期任务，正在执行的归档会被中断，已删除的记录都已归档
+func Stop() {
+	defaultJob.Lock()
+	stop, done := defaultJob.stop, defaultJob.done
+	defaultJob.stop, defaultJob.done = nil, nil
+	defaultJob.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
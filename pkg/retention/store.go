@@ -0,0 +1,109 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"weave/config"
+)
+
+// 归档存储类型
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// Store 归档文件存储
+type Store interface {
+	// Name 返回存储类型，记录在归档记录中，恢复时据此确认归档所在的存储
+	Name() string
+	// Put 写入归档文件，键已存在时覆盖
+	Put(ctx context.Context, key string, data []byte) error
+	// Get 读取归档文件
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// NewStore 按Retention配置创建归档存储
+func NewStore() (Store, error) {
+	cfg := config.Config.Retention
+	switch cfg.Storage {
+	case StorageLocal:
+		return NewLocalStore(cfg.ArchiveDir), nil
+	case StorageS3:
+		return NewS3Store(S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    cfg.S3.Prefix,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PathStyle: cfg.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown retention storage: %s", cfg.Storage)
+	}
+}
+
+// LocalStore 将归档文件保存在本地目录
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore 创建本地目录存储，目录在首次写入时创建
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// Name 返回存储类型
+func (s *LocalStore) Name() string {
+	return StorageLocal
+}
+
+// path 将对象键转换为目录内的文件路径，拒绝跳出归档目录的键
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid archive key: %s", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+// Put 先写入临时文件再重命名，避免中断时留下不完整的归档
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get 读取归档文件
+func (s *LocalStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,196 @@
+package pkg
+
+import (
+	"errors"
+	"strconv"
+
+	"weave/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrResourceNotFound 共享的资源不存在
+var ErrResourceNotFound = errors.New("resource not found")
+
+// HasShareLevel 判断权限级别是否不低于指定级别
+func HasShareLevel(level, required string) bool {
+	return level != "" && models.ShareLevelRank(level) >= models.ShareLevelRank(required)
+}
+
+// maxShareLevel 返回两个权限级别中较高的一个
+func maxShareLevel(a, b string) string {
+	if models.ShareLevelRank(b) > models.ShareLevelRank(a) {
+		return b
+	}
+	return a
+}
+
+// userShareTeams 返回用户拥有有效角色（含继承）的团队，团队共享对这些团队生效
+func userShareTeams(db *gorm.DB, tenantID, userID uint) ([]uint, error) {
+	h, err := LoadTeamHierarchy(db, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := h.UserTeamRoles(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	teamIDs := make([]uint, 0, len(roles))
+	for id := range roles {
+		teamIDs = append(teamIDs, id)
+	}
+	return teamIDs, nil
+}
+
+// sharesForUser 查询直接共享给用户或其所在团队的共享记录
+func sharesForUser(db *gorm.DB, tenantID uint, resourceType string, resourceIDs []string, userID uint) ([]models.ResourceShare, error) {
+	teamIDs, err := userShareTeams(db, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Where("tenant_id = ? AND resource_type = ?", tenantID, resourceType)
+	if resourceIDs != nil {
+		query = query.Where("resource_id IN ?", resourceIDs)
+	}
+	subject := db.Where("subject_type = ? AND subject_id = ?", models.ShareSubjectUser, userID)
+	if len(teamIDs) > 0 {
+		subject = subject.Or("subject_type = ? AND subject_id IN ?", models.ShareSubjectTeam, teamIDs)
+	}
+
+	var shares []models.ResourceShare
+	if err := query.Where(subject).Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// SharedLevel 计算资源共享给用户的最高权限级别，未共享时返回空字符串
+func SharedLevel(db *gorm.DB, tenantID uint, resourceType, resourceID string, userID uint) (string, error) {
+	shares, err := sharesForUser(db, tenantID, resourceType, []string{resourceID}, userID)
+	if err != nil {
+		return "", err
+	}
+	level := ""
+	for _, share := range shares {
+		level = maxShareLevel(level, share.Level)
+	}
+	return level, nil
+}
+
+// SharedWithUser 返回共享给用户的资源ID及对应的最高权限级别
+func SharedWithUser(db *gorm.DB, tenantID uint, resourceType string, userID uint) (map[string]string, error) {
+	shares, err := sharesForUser(db, tenantID, resourceType, nil, userID)
+	if err != nil {
+		return nil, err
+	}
+	levels := make(map[string]string, len(shares))
+	for _, share := range shares {
+		levels[share.ResourceID] = maxShareLevel(levels[share.ResourceID], share.Level)
+	}
+	return levels, nil
+}
+
+// NoteAccessLevel 计算用户对笔记的权限级别，笔记所有者拥有admin权限
+func NoteAccessLevel(db *gorm.DB, note *models.Note, userID uint) (string, error) {
+	if note.UserID == userID {
+		return models.ShareLevelAdmin, nil
+	}
+	return SharedLevel(db, note.TenantID, models.ShareResourceNote, note.ID, userID)
+}
+
+// ToolAccessLevel 计算用户对工具的权限级别
+// 工具所有者和范围团队管理员拥有admin权限；团队范围允许使用的用户拥有read权限，未设置所有者的历史工具保持原有的admin权限；
+// 共享可以在此基础上提升权限，也可以让团队范围外的用户使用工具
+func ToolAccessLevel(db *gorm.DB, tool *models.Tool, userID uint) (string, error) {
+	if tool.OwnerID != 0 && tool.OwnerID == userID {
+		return models.ShareLevelAdmin, nil
+	}
+
+	level := ""
+	allowed, err := CanUseTool(db, tool, userID)
+	if err != nil {
+		return "", err
+	}
+	if allowed {
+		level = models.ShareLevelRead
+		if tool.OwnerID == 0 {
+			level = models.ShareLevelAdmin
+		}
+	}
+	// 范围团队的管理员（含继承）可以管理团队工具
+	if tool.TeamID != nil && level != models.ShareLevelAdmin {
+		role, err := EffectiveTeamRole(db, tool.TenantID, *tool.TeamID, userID)
+		if err != nil && !errors.Is(err, ErrTeamNotFound) {
+			return "", err
+		}
+		if role.AtLeast("admin") {
+			level = models.ShareLevelAdmin
+		}
+	}
+
+	shared, err := SharedLevel(db, tool.TenantID, models.ShareResourceTool, strconv.FormatUint(uint64(tool.ID), 10), userID)
+	if err != nil {
+		return "", err
+	}
+	return maxShareLevel(level, shared), nil
+}
+
+// VisibleTools 返回租户内用户可见的工具：团队范围允许使用的、自己创建的以及共享给用户的工具
+func VisibleTools(db *gorm.DB, tenantID, userID uint) ([]models.Tool, error) {
+	var tools []models.Tool
+	if err := db.Where("tenant_id = ?", tenantID).Find(&tools).Error; err != nil {
+		return nil, err
+	}
+	accessible, err := FilterAccessibleTools(db, tenantID, userID, tools)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := SharedWithUser(db, tenantID, models.ShareResourceTool, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make(map[uint]bool, len(accessible))
+	for _, tool := range accessible {
+		visible[tool.ID] = true
+	}
+	visibleTools := make([]models.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if visible[tool.ID] || tool.OwnerID == userID || shared[strconv.FormatUint(uint64(tool.ID), 10)] != "" {
+			visibleTools = append(visibleTools, tool)
+		}
+	}
+	return visibleTools, nil
+}
+
+// ResourceAccessLevel 加载资源并计算用户的权限级别，资源不存在时返回ErrResourceNotFound
+func ResourceAccessLevel(db *gorm.DB, tenantID uint, resourceType, resourceID string, userID uint) (string, error) {
+	switch resourceType {
+	case models.ShareResourceNote:
+		var note models.Note
+		if err := db.Where("id = ? AND tenant_id = ?", resourceID, tenantID).First(&note).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return "", ErrResourceNotFound
+			}
+			return "", err
+		}
+		return NoteAccessLevel(db, &note, userID)
+	case models.ShareResourceTool:
+		var tool models.Tool
+		if err := db.Where("id = ? AND tenant_id = ?", resourceID, tenantID).First(&tool).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return "", ErrResourceNotFound
+			}
+			return "", err
+		}
+		return ToolAccessLevel(db, &tool, userID)
+	}
+	return "", ErrResourceNotFound
+}
+
+// DeleteResourceShares 删除资源的所有共享记录，资源删除时调用
+func DeleteResourceShares(db *gorm.DB, tenantID uint, resourceType, resourceID string) error {
+	return db.Where("tenant_id = ? AND resource_type = ? AND resource_id = ?", tenantID, resourceType, resourceID).
+		Delete(&models.ResourceShare{}).Error
+}
@@ -0,0 +1,261 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+
+	"weave/models"
+
+	"gorm.io/gorm"
+)
+
+// 团队成员一致性问题类型
+const (
+	TeamIssueDuplicateMember = "duplicate_member" // 同一用户在同一团队有多条成员记录
+	TeamIssueOrphanTeam      = "orphan_team"      // 成员记录指向不存在的团队
+	TeamIssueOrphanUser      = "orphan_user"      // 成员记录指向不存在的用户
+	TeamIssueTenantMismatch  = "tenant_mismatch"  // 成员记录的租户与团队不一致
+	TeamIssueMissingOwner    = "missing_owner"    // 团队所有者没有owner角色的成员记录
+	TeamIssueExtraOwner      = "extra_owner"      // 非团队所有者的成员记录为owner角色
+	TeamIssueInvalidParent   = "invalid_parent"   // 上级团队不存在、跨租户或形成环
+)
+
+// TeamConsistencyIssue 团队成员数据不一致项
+type TeamConsistencyIssue struct {
+	Kind     string `json:"kind"`
+	TeamID   uint   `json:"team_id"`
+	UserID   uint   `json:"user_id"`
+	MemberID uint   `json:"member_id,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// TeamConsistencyReport 团队成员一致性检查结果
+type TeamConsistencyReport struct {
+	Teams   int                    `json:"teams"`
+	Members int                    `json:"members"`
+	Issues  []TeamConsistencyIssue `json:"issues"`
+	Fixed   int                    `json:"fixed"`
+}
+
+// CheckTeamMembership 检查团队成员数据一致性，fix为true时同时修复
+// 修复规则：合并重复记录、删除孤立记录、以团队租户为准、补齐所有者记录、多余的owner降为admin、
+// 无效的上级团队关系置为根团队
+func CheckTeamMembership(ctx context.Context, fix bool) (*TeamConsistencyReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	db := DB.WithContext(WithoutTenantScope(ctx))
+	report := &TeamConsistencyReport{Issues: []TeamConsistencyIssue{}}
+
+	// 重复记录先行合并，后续检查基于去重后的数据
+	type duplicateKey struct {
+		TeamID uint
+		UserID uint
+		Count  int
+	}
+	var duplicates []duplicateKey
+	if err := db.Model(&models.TeamMember{}).
+		Select("team_id, user_id, COUNT(*) AS count").
+		Group("team_id, user_id").
+		Having("COUNT(*) > 1").
+		Scan(&duplicates).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range duplicates {
+		report.Issues = append(report.Issues, TeamConsistencyIssue{
+			Kind:   TeamIssueDuplicateMember,
+			TeamID: d.TeamID,
+			UserID: d.UserID,
+			Detail: fmt.Sprintf("%d membership rows", d.Count),
+		})
+	}
+	if fix && len(duplicates) > 0 {
+		removed, err := models.DeduplicateTeamMembers(db)
+		if err != nil {
+			return report, err
+		}
+		report.Fixed += int(removed)
+	}
+
+	var teams []models.Team
+	if err := db.Select("id", "owner_id", "tenant_id", "parent_id").Find(&teams).Error; err != nil {
+		return report, err
+	}
+	teamByID := make(map[uint]models.Team, len(teams))
+	for _, team := range teams {
+		teamByID[team.ID] = team
+	}
+	report.Teams = len(teams)
+
+	var userIDs []uint
+	if err := db.Model(&models.User{}).Pluck("id", &userIDs).Error; err != nil {
+		return report, err
+	}
+	userExists := make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		userExists[id] = true
+	}
+
+	var members []models.TeamMember
+	if err := db.Order("id ASC").Find(&members).Error; err != nil {
+		return report, err
+	}
+	report.Members = len(members)
+
+	ownerRows := make(map[uint]bool)
+	for _, member := range members {
+		team, ok := teamByID[member.TeamID]
+		switch {
+		case !ok:
+			report.Issues = append(report.Issues, TeamConsistencyIssue{Kind: TeamIssueOrphanTeam, TeamID: member.TeamID, UserID: member.UserID, MemberID: member.ID, Detail: "team does not exist"})
+			if fix {
+				if err := fixDelete(db, &member, report); err != nil {
+					return report, err
+				}
+			}
+			continue
+		case !userExists[member.UserID]:
+			report.Issues = append(report.Issues, TeamConsistencyIssue{Kind: TeamIssueOrphanUser, TeamID: member.TeamID, UserID: member.UserID, MemberID: member.ID, Detail: "user does not exist"})
+			if fix {
+				if err := fixDelete(db, &member, report); err != nil {
+					return report, err
+				}
+			}
+			continue
+		}
+
+		if member.TenantID != team.TenantID {
+			report.Issues = append(report.Issues, TeamConsistencyIssue{
+				Kind: TeamIssueTenantMismatch, TeamID: member.TeamID, UserID: member.UserID, MemberID: member.ID,
+				Detail: fmt.Sprintf("member tenant %d, team tenant %d", member.TenantID, team.TenantID),
+			})
+			if fix {
+				if err := fixUpdate(db, &member, "tenant_id", team.TenantID, report); err != nil {
+					return report, err
+				}
+			}
+		}
+
+		if member.Role != "owner" {
+			continue
+		}
+		if member.UserID == team.OwnerID {
+			ownerRows[team.ID] = true
+			continue
+		}
+		report.Issues = append(report.Issues, TeamConsistencyIssue{
+			Kind: TeamIssueExtraOwner, TeamID: member.TeamID, UserID: member.UserID, MemberID: member.ID,
+			Detail: fmt.Sprintf("team owner is user %d", team.OwnerID),
+		})
+		if fix {
+			if err := fixUpdate(db, &member, "role", "admin", report); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	for _, team := range teams {
+		if ownerRows[team.ID] || team.OwnerID == 0 {
+			continue
+		}
+		report.Issues = append(report.Issues, TeamConsistencyIssue{
+			Kind: TeamIssueMissingOwner, TeamID: team.ID, UserID: team.OwnerID,
+			Detail: "owner has no owner membership row",
+		})
+		if !fix || !userExists[team.OwnerID] {
+			continue
+		}
+
+		// 所有者已是成员时提升角色，否则补建成员记录
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var existing models.TeamMember
+			err := tx.Where("team_id = ? AND user_id = ?", team.ID, team.OwnerID).First(&existing).Error
+			if err == nil {
+				return tx.Model(&existing).Update("role", "owner").Error
+			}
+			if err != gorm.ErrRecordNotFound {
+				return err
+			}
+			return tx.Create(&models.TeamMember{TeamID: team.ID, UserID: team.OwnerID, Role: "owner", TenantID: team.TenantID}).Error
+		})
+		if err != nil {
+			return report, err
+		}
+		report.Fixed++
+	}
+
+	if err := checkTeamParents(db, teams, teamByID, fix, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// checkTeamParents 检查团队上级关系，上级团队必须存在、属于同一租户且不能形成环
+func checkTeamParents(db *gorm.DB, teams []models.Team, teamByID map[uint]models.Team, fix bool, report *TeamConsistencyReport) error {
+	for _, team := range teams {
+		team = teamByID[team.ID]
+		if team.ParentID == nil {
+			continue
+		}
+
+		detail := ""
+		if parent, ok := teamByID[*team.ParentID]; !ok {
+			detail = fmt.Sprintf("parent team %d does not exist", *team.ParentID)
+		} else if parent.TenantID != team.TenantID {
+			detail = fmt.Sprintf("parent team %d belongs to tenant %d", parent.ID, parent.TenantID)
+		} else {
+			// 沿上级链向上查找，回到自身说明团队处在环上；遇到其他已访问团队说明环在更上层，由环上团队各自处理
+			seen := map[uint]bool{parent.ID: true}
+			for current := parent; current.ParentID != nil; {
+				if *current.ParentID == team.ID {
+					detail = fmt.Sprintf("parent chain through team %d forms a cycle", parent.ID)
+					break
+				}
+				next, ok := teamByID[*current.ParentID]
+				if !ok || seen[next.ID] {
+					break
+				}
+				seen[next.ID] = true
+				current = next
+			}
+			if parent.ID == team.ID {
+				detail = "team is its own parent"
+			}
+		}
+		if detail == "" {
+			continue
+		}
+
+		report.Issues = append(report.Issues, TeamConsistencyIssue{Kind: TeamIssueInvalidParent, TeamID: team.ID, Detail: detail})
+		if !fix {
+			continue
+		}
+		if err := db.Model(&models.Team{}).Where("id = ?", team.ID).Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+		// 后续检查基于修复后的关系，环上其余团队不再重复处理
+		team.ParentID = nil
+		teamByID[team.ID] = team
+		report.Fixed++
+	}
+	return nil
+}
+
+// fixDelete 删除不一致的成员记录
+func fixDelete(db *gorm.DB, member *models.TeamMember, report *TeamConsistencyReport) error {
+	if err := db.Delete(&models.TeamMember{}, member.ID).Error; err != nil {
+		return err
+	}
+	report.Fixed++
+	return nil
+}
+
+// fixUpdate 修正成员记录的单个字段
+func fixUpdate(db *gorm.DB, member *models.TeamMember, column string, value interface{}, report *TeamConsistencyReport) error {
+	if err := db.Model(&models.TeamMember{}).Where("id = ?", member.ID).Update(column, value).Error; err != nil {
+		return err
+	}
+	report.Fixed++
+	return nil
+}
@@ -0,0 +1,387 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+
+	"weave/models"
+
+	"gorm.io/gorm"
+)
+
+// 团队层级校验错误
+var (
+	ErrTeamNotFound    = errors.New("team not found")
+	ErrTeamCycle       = errors.New("team cannot be moved under itself or its descendants")
+	ErrTeamDepthExceed = errors.New("team hierarchy exceeds the maximum depth")
+)
+
+// TeamHierarchy 租户内团队层级结构的快照
+type TeamHierarchy struct {
+	teams    map[uint]models.Team
+	children map[uint][]uint
+	roots    []uint
+}
+
+// LoadTeamHierarchy 加载租户内所有团队并构建层级结构
+func LoadTeamHierarchy(db *gorm.DB, tenantID uint) (*TeamHierarchy, error) {
+	var teams []models.Team
+	if err := db.Where("tenant_id = ?", tenantID).Order("name ASC").Find(&teams).Error; err != nil {
+		return nil, err
+	}
+
+	h := &TeamHierarchy{
+		teams:    make(map[uint]models.Team, len(teams)),
+		children: make(map[uint][]uint),
+	}
+	for _, team := range teams {
+		h.teams[team.ID] = team
+	}
+	for _, team := range teams {
+		// 上级团队不存在（已删除或跨租户）时按根团队处理
+		if team.ParentID != nil {
+			if _, ok := h.teams[*team.ParentID]; ok {
+				h.children[*team.ParentID] = append(h.children[*team.ParentID], team.ID)
+				continue
+			}
+		}
+		h.roots = append(h.roots, team.ID)
+	}
+	return h, nil
+}
+
+// Team 返回指定团队
+func (h *TeamHierarchy) Team(id uint) (models.Team, bool) {
+	team, ok := h.teams[id]
+	return team, ok
+}
+
+// Roots 返回所有根团队ID
+func (h *TeamHierarchy) Roots() []uint {
+	return h.roots
+}
+
+// Children 返回直接下级团队ID
+func (h *TeamHierarchy) Children(id uint) []uint {
+	return h.children[id]
+}
+
+// parentOf 返回有效的上级团队ID，根团队返回0
+func (h *TeamHierarchy) parentOf(id uint) uint {
+	team, ok := h.teams[id]
+	if !ok || team.ParentID == nil {
+		return 0
+	}
+	if _, ok := h.teams[*team.ParentID]; !ok {
+		return 0
+	}
+	return *team.ParentID
+}
+
+// Ancestors 返回所有上级团队ID，按由近到远排列
+func (h *TeamHierarchy) Ancestors(id uint) []uint {
+	var ancestors []uint
+	seen := map[uint]bool{id: true}
+	for parent := h.parentOf(id); parent != 0 && !seen[parent]; parent = h.parentOf(parent) {
+		seen[parent] = true
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// Descendants 返回所有下级团队ID（不含自身），按层级广度优先排列
+func (h *TeamHierarchy) Descendants(id uint) []uint {
+	var descendants []uint
+	seen := map[uint]bool{id: true}
+	queue := append([]uint(nil), h.children[id]...)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		descendants = append(descendants, current)
+		queue = append(queue, h.children[current]...)
+	}
+	return descendants
+}
+
+// Subtree 返回团队自身及所有下级团队ID
+func (h *TeamHierarchy) Subtree(id uint) []uint {
+	return append([]uint{id}, h.Descendants(id)...)
+}
+
+// Depth 返回团队所在层级，根团队为1
+func (h *TeamHierarchy) Depth(id uint) int {
+	return len(h.Ancestors(id)) + 1
+}
+
+// height 返回以团队为根的子树高度，叶子团队为1
+func (h *TeamHierarchy) height(id uint, seen map[uint]bool) int {
+	if seen[id] {
+		return 0
+	}
+	seen[id] = true
+	max := 0
+	for _, child := range h.children[id] {
+		if ch := h.height(child, seen); ch > max {
+			max = ch
+		}
+	}
+	return max + 1
+}
+
+// ValidateParent 校验将团队移动到新的上级团队下是否合法
+// teamID为0表示新建团队；parentID为nil表示移动为根团队
+func (h *TeamHierarchy) ValidateParent(teamID uint, parentID *uint, maxDepth int) error {
+	if teamID != 0 {
+		if _, ok := h.teams[teamID]; !ok {
+			return ErrTeamNotFound
+		}
+	}
+
+	parentDepth := 0
+	if parentID != nil {
+		if _, ok := h.teams[*parentID]; !ok {
+			return ErrTeamNotFound
+		}
+		if *parentID == teamID {
+			return ErrTeamCycle
+		}
+		for _, ancestor := range h.Ancestors(*parentID) {
+			if ancestor == teamID {
+				return ErrTeamCycle
+			}
+		}
+		parentDepth = h.Depth(*parentID)
+	}
+
+	height := 1
+	if teamID != 0 {
+		height = h.height(teamID, map[uint]bool{})
+	}
+	if maxDepth > 0 && parentDepth+height > maxDepth {
+		return ErrTeamDepthExceed
+	}
+	return nil
+}
+
+// TeamRole 用户在团队中的有效角色
+type TeamRole struct {
+	Role         string `json:"role"`
+	Inherited    bool   `json:"inherited"`      // 是否继承自上级团队
+	SourceTeamID uint   `json:"source_team_id"` // 角色来源的团队
+}
+
+// AtLeast 判断有效角色是否不低于指定角色
+func (r *TeamRole) AtLeast(role string) bool {
+	return r != nil && models.TeamRoleRank(r.Role) >= models.TeamRoleRank(role)
+}
+
+// inheritedRole 上级团队角色在下级团队中的继承结果
+// 上级团队的所有者和管理员在下级团队中视为管理员，普通成员视为成员
+func inheritedRole(role string) string {
+	if models.TeamRoleRank(role) >= models.TeamRoleRank("admin") {
+		return "admin"
+	}
+	return "member"
+}
+
+// resolveRole 根据用户的直接成员角色计算其在团队中的有效角色
+func (h *TeamHierarchy) resolveRole(teamID uint, roleByTeam map[uint]string) *TeamRole {
+	var best *TeamRole
+	for i, id := range append([]uint{teamID}, h.Ancestors(teamID)...) {
+		role, ok := roleByTeam[id]
+		if !ok {
+			continue
+		}
+		candidate := &TeamRole{Role: role, SourceTeamID: id}
+		if i > 0 {
+			candidate.Role = inheritedRole(role)
+			candidate.Inherited = true
+		}
+		// 同级时优先直接角色和距离更近的团队
+		if best == nil || models.TeamRoleRank(candidate.Role) > models.TeamRoleRank(best.Role) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// memberRoles 查询用户在各团队中的直接成员角色
+func memberRoles(db *gorm.DB, userID uint, teamIDs []uint) (map[uint]string, error) {
+	query := db.Where("user_id = ?", userID)
+	if teamIDs != nil {
+		query = query.Where("team_id IN ?", teamIDs)
+	}
+	var members []models.TeamMember
+	if err := query.Find(&members).Error; err != nil {
+		return nil, err
+	}
+	roleByTeam := make(map[uint]string, len(members))
+	for _, member := range members {
+		roleByTeam[member.TeamID] = member.Role
+	}
+	return roleByTeam, nil
+}
+
+// EffectiveTeamRole 计算用户在团队中的有效角色，综合直接成员身份与上级团队继承的角色
+// 用户与该团队及其上级团队均无关系时返回nil
+func (h *TeamHierarchy) EffectiveTeamRole(db *gorm.DB, teamID, userID uint) (*TeamRole, error) {
+	if _, ok := h.teams[teamID]; !ok {
+		return nil, ErrTeamNotFound
+	}
+	roleByTeam, err := memberRoles(db, userID, append([]uint{teamID}, h.Ancestors(teamID)...))
+	if err != nil {
+		return nil, err
+	}
+	return h.resolveRole(teamID, roleByTeam), nil
+}
+
+// UserTeamRoles 计算用户在租户内所有团队中的有效角色，只包含有角色的团队
+func (h *TeamHierarchy) UserTeamRoles(db *gorm.DB, userID uint) (map[uint]*TeamRole, error) {
+	roleByTeam, err := memberRoles(db, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[uint]*TeamRole)
+	for id := range h.teams {
+		if role := h.resolveRole(id, roleByTeam); role != nil {
+			roles[id] = role
+		}
+	}
+	return roles, nil
+}
+
+// EffectiveTeamRole 计算用户在团队中的有效角色
+func EffectiveTeamRole(db *gorm.DB, tenantID, teamID, userID uint) (*TeamRole, error) {
+	h, err := LoadTeamHierarchy(db, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return h.EffectiveTeamRole(db, teamID, userID)
+}
+
+// AccessibleTeamIDs 返回用户可使用其限定资源的团队集合
+// 团队限定的资源对整个子树开放：用户是该团队、其上级或其下级团队的成员即可使用
+func (h *TeamHierarchy) AccessibleTeamIDs(db *gorm.DB, userID uint) (map[uint]bool, error) {
+	roleByTeam, err := memberRoles(db, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	accessible := make(map[uint]bool)
+	for id := range roleByTeam {
+		if _, ok := h.teams[id]; !ok {
+			continue
+		}
+		for _, related := range h.Subtree(id) {
+			accessible[related] = true
+		}
+		for _, ancestor := range h.Ancestors(id) {
+			accessible[ancestor] = true
+		}
+	}
+	return accessible, nil
+}
+
+// canUseScopes 判断用户能否使用同时受多个团队范围限制的资源，nil表示不限制
+func canUseScopes(db *gorm.DB, tenantID, userID uint, teamIDs ...*uint) (bool, error) {
+	scoped := false
+	for _, id := range teamIDs {
+		scoped = scoped || id != nil
+	}
+	if !scoped {
+		return true, nil
+	}
+
+	h, err := LoadTeamHierarchy(db, tenantID)
+	if err != nil {
+		return false, err
+	}
+	accessible, err := h.AccessibleTeamIDs(db, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range teamIDs {
+		if id != nil && !accessible[*id] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// pluginScope 查询插件在租户内的团队范围，未限制时返回nil
+func pluginScope(db *gorm.DB, tenantID uint, pluginName string) (*uint, error) {
+	var scope models.PluginTeamScope
+	err := db.Where("tenant_id = ? AND plugin_name = ?", tenantID, pluginName).First(&scope).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &scope.TeamID, nil
+}
+
+// CanUseTool 判断用户能否使用工具，同时校验工具和所属插件的团队范围限制
+func CanUseTool(db *gorm.DB, tool *models.Tool, userID uint) (bool, error) {
+	scope, err := pluginScope(db, tool.TenantID, tool.PluginName)
+	if err != nil {
+		return false, err
+	}
+	return canUseScopes(db, tool.TenantID, userID, tool.TeamID, scope)
+}
+
+// CanUsePlugin 判断用户能否在租户内使用插件
+func CanUsePlugin(ctx context.Context, tenantID uint, pluginName string, userID uint) (bool, error) {
+	if DB == nil {
+		return true, nil
+	}
+	db := DB.WithContext(WithTenantID(ctx, tenantID))
+	scope, err := pluginScope(db, tenantID, pluginName)
+	if err != nil {
+		return false, err
+	}
+	return canUseScopes(db, tenantID, userID, scope)
+}
+
+// FilterAccessibleTools 过滤出用户可使用的工具
+func FilterAccessibleTools(db *gorm.DB, tenantID, userID uint, tools []models.Tool) ([]models.Tool, error) {
+	var scopes []models.PluginTeamScope
+	if err := db.Where("tenant_id = ?", tenantID).Find(&scopes).Error; err != nil {
+		return nil, err
+	}
+	pluginScope := make(map[string]uint, len(scopes))
+	for _, scope := range scopes {
+		pluginScope[scope.PluginName] = scope.TeamID
+	}
+
+	var accessible map[uint]bool
+	result := make([]models.Tool, 0, len(tools))
+	for _, tool := range tools {
+		scopeTeamID, hasPluginScope := pluginScope[tool.PluginName]
+		if tool.TeamID == nil && !hasPluginScope {
+			result = append(result, tool)
+			continue
+		}
+		if accessible == nil {
+			h, err := LoadTeamHierarchy(db, tenantID)
+			if err != nil {
+				return nil, err
+			}
+			if accessible, err = h.AccessibleTeamIDs(db, userID); err != nil {
+				return nil, err
+			}
+		}
+		if tool.TeamID != nil && !accessible[*tool.TeamID] {
+			continue
+		}
+		if hasPluginScope && !accessible[scopeTeamID] {
+			continue
+		}
+		result = append(result, tool)
+	}
+	return result, nil
+}
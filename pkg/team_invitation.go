@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg/events"
+
+	"go.uber.org/zap"
+)
+
+// 团队邀请事件类型
+const (
+	EventTeamInvitationCreated  = "team.invitation.created"
+	EventTeamInvitationAccepted = "team.invitation.accepted"
+	EventTeamInvitationDeclined = "team.invitation.declined"
+	EventTeamInvitationRevoked  = "team.invitation.revoked"
+	EventTeamInvitationExpired  = "team.invitation.expired"
+)
+
+// PublishTeamInvitationEvent 发布团队邀请状态变更事件
+func PublishTeamInvitationEvent(eventType string, invitation *models.TeamInvitation, actorID uint) {
+	payload := map[string]interface{}{
+		"invitation_id": invitation.ID,
+		"team_id":       invitation.TeamID,
+		"inviter_id":    invitation.InviterID,
+		"role":          invitation.Role,
+		"status":        invitation.Status,
+	}
+	if invitation.InviteeUserID != nil {
+		payload["invitee_user_id"] = *invitation.InviteeUserID
+	}
+	if invitation.InviteeEmail != "" {
+		payload["invitee_email"] = invitation.InviteeEmail
+	}
+
+	events.Publish(events.Event{
+		Type:     eventType,
+		TenantID: invitation.TenantID,
+		ActorID:  actorID,
+		Payload:  payload,
+	})
+}
+
+// ExpireTeamInvitations 将已过期的待处理邀请标记为expired，返回处理的数量
+// 每条邀请单独更新并校验状态，避免与同时进行的接受/拒绝操作互相覆盖
+func ExpireTeamInvitations(ctx context.Context, now time.Time) (int, error) {
+	if DB == nil {
+		return 0, nil
+	}
+	db := DB.WithContext(WithoutTenantScope(ctx))
+
+	var expired []models.TeamInvitation
+	if err := db.Where("status = ? AND expires_at <= ?", models.InvitationStatusPending, now).
+		Limit(500).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range expired {
+		invitation := &expired[i]
+		result := db.Model(&models.TeamInvitation{}).
+			Where("id = ? AND status = ?", invitation.ID, models.InvitationStatusPending).
+			Updates(map[string]interface{}{"status": models.InvitationStatusExpired, "updated_at": now})
+		if result.Error != nil {
+			return count, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		count++
+		invitation.Status = models.InvitationStatusExpired
+
+		PublishTeamInvitationEvent(EventTeamInvitationExpired, invitation, 0)
+		_ = AuditLog(AuditLogOptions{
+			Username:     "system",
+			Action:       "expire_invitation",
+			ResourceType: "team_invitation",
+			ResourceID:   fmt.Sprintf("%d", invitation.ID),
+			OldValue:     map[string]interface{}{"status": models.InvitationStatusPending},
+			NewValue:     map[string]interface{}{"status": models.InvitationStatusExpired, "team_id": invitation.TeamID},
+			TenantID:     invitation.TenantID,
+		})
+	}
+	return count, nil
+}
+
+// invitationCleanup 过期邀请清理任务
+var invitationCleanup struct {
+	sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartInvitationCleanup 启动过期邀请定期清理任务，间隔由Team.InvitationCleanupInterval配置
+func StartInvitationCleanup() {
+	interval := time.Duration(config.Config.Team.InvitationCleanupInterval) * time.Second
+	if interval <= 0 {
+		return
+	}
+
+	invitationCleanup.Lock()
+	defer invitationCleanup.Unlock()
+	if invitationCleanup.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	invitationCleanup.stop = stop
+	invitationCleanup.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				count, err := ExpireTeamInvitations(context.Background(), time.Now())
+				if err != nil {
+					Warn("Failed to expire team invitations", zap.Error(err))
+				} else if count > 0 {
+					Info("Expired team invitations", zap.Int("count", count))
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopInvitationCleanup 停止过期邀请清理任务
+func StopInvitationCleanup() {
+	invitationCleanup.Lock()
+	stop, done := invitationCleanup.stop, invitationCleanup.done
+	invitationCleanup.stop, invitationCleanup.done = nil, nil
+	invitationCleanup.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantContextKey 请求上下文中租户ID的键
+type tenantContextKey struct{}
+
+// skipTenantScopeKey 标记跨租户访问的上下文键
+type skipTenantScopeKey struct{}
+
+// tenantScopedSetting 标记语句已注入租户过滤条件，避免链式查询重复注入
+const tenantScopedSetting = "tenant:scoped"
+
+// WithTenantID 将租户ID写入上下文，之后使用该上下文的数据库操作会自动按租户隔离
+func WithTenantID(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantIDFromContext 从上下文获取租户ID
+// 上下文未设置租户或显式跳过租户隔离时返回false
+func TenantIDFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	if skip, _ := ctx.Value(skipTenantScopeKey{}).(bool); skip {
+		return 0, false
+	}
+	tenantID, ok := ctx.Value(tenantContextKey{}).(uint)
+	return tenantID, ok
+}
+
+// WithoutTenantScope 返回跳过租户隔离的上下文
+// 仅用于平台管理、登录查找等确需跨租户访问的场景
+func WithoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipTenantScopeKey{}, true)
+}
+
+// TenantDB 返回绑定当前请求租户的数据库会话，查询会自动附加租户过滤条件
+// 请求上下文中没有租户信息时，回退使用认证中间件写入gin上下文的tenant_id
+func TenantDB(c *gin.Context) *gorm.DB {
+	ctx := context.Background()
+	if c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	if _, ok := TenantIDFromContext(ctx); !ok {
+		if tenantID, exists := c.Get("tenant_id"); exists {
+			if id, ok := tenantID.(uint); ok {
+				ctx = WithTenantID(ctx, id)
+			}
+		}
+	}
+	return DB.WithContext(ctx)
+}
+
+// RegisterTenantCallbacks 注册租户隔离回调
+// 对带TenantID字段的模型，查询/更新/删除自动追加tenant_id条件，创建时自动填充租户ID
+// 原生SQL（Raw/Exec）不经过这些回调，需要自行添加租户条件
+func RegisterTenantCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:query", tenantScopeCallback); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:row", tenantScopeCallback); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:update", tenantScopeCallback); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant:delete", tenantScopeCallback); err != nil {
+		return err
+	}
+	return callbacks.Create().Before("gorm:create").Register("tenant:create", tenantCreateCallback)
+}
+
+// tenantScopeCallback 为查询、更新和删除语句追加租户过滤条件
+func tenantScopeCallback(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	tenantID, ok := TenantIDFromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField("TenantID")
+	if field == nil {
+		return
+	}
+
+	if _, scoped := db.Statement.Settings.Load(tenantScopedSetting); scoped {
+		return
+	}
+	db.Statement.Settings.Store(tenantScopedSetting, true)
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID},
+	}})
+}
+
+// tenantCreateCallback 创建记录时填充租户ID，并拒绝写入其他租户的数据
+func tenantCreateCallback(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	tenantID, ok := TenantIDFromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField("TenantID")
+	if field == nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	rv := db.Statement.ReflectValue
+	assign := func(value reflect.Value) {
+		current, isZero := field.ValueOf(ctx, value)
+		if isZero {
+			if err := field.Set(ctx, value, tenantID); err != nil {
+				_ = db.AddError(err)
+			}
+			return
+		}
+		if id, ok := current.(uint); ok && id != tenantID {
+			_ = db.AddError(NewTenantMismatchError("", errors.New("record belongs to another tenant")))
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
+}
+
+// tenantStatusEntry 租户状态缓存项
+type tenantStatusEntry struct {
+	active    bool
+	expiresAt time.Time
+}
+
+// tenantStatusCache 租户状态缓存，避免每个请求都查询租户表
+var tenantStatusCache = struct {
+	sync.RWMutex
+	entries map[uint]tenantStatusEntry
+}{entries: make(map[uint]tenantStatusEntry)}
+
+// CheckTenantActive 检查租户是否可用
+// 没有对应租户记录的历史租户（含默认租户）视为可用，以兼容引入租户表之前的数据
+func CheckTenantActive(ctx context.Context, tenantID uint) error {
+	if DB == nil {
+		return nil
+	}
+
+	tenantStatusCache.RLock()
+	entry, ok := tenantStatusCache.entries[tenantID]
+	tenantStatusCache.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		if !entry.active {
+			return NewTenantSuspendedError("", nil)
+		}
+		return nil
+	}
+
+	var tenant models.Tenant
+	active := true
+	err := DB.WithContext(WithoutTenantScope(ctx)).Unscoped().Where("id = ?", tenantID).First(&tenant).Error
+	switch {
+	case err == nil:
+		active = tenant.IsActive() && !tenant.DeletedAt.Valid
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		active = true
+	default:
+		// 查询失败时不缓存，放行请求以免数据库抖动导致全部请求被拒绝
+		return nil
+	}
+
+	ttl := time.Duration(config.Config.Tenant.StatusCacheTTL) * time.Second
+	tenantStatusCache.Lock()
+	tenantStatusCache.entries[tenantID] = tenantStatusEntry{active: active, expiresAt: time.Now().Add(ttl)}
+	tenantStatusCache.Unlock()
+
+	if !active {
+		return NewTenantSuspendedError("", nil)
+	}
+	return nil
+}
+
+// InvalidateTenantStatus 清除租户状态缓存，租户状态变更后调用
+func InvalidateTenantStatus(tenantID uint) {
+	tenantStatusCache.Lock()
+	delete(tenantStatusCache.entries, tenantID)
+	tenantStatusCache.Unlock()
+}
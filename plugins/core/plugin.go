@@ -1,15 +1,20 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"weave/middleware"
 	"weave/pkg"
 	"weave/pkg/metrics"
+	"weave/pkg/quota"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // Route 定义路由结构
@@ -53,6 +58,23 @@ type Plugin interface {
 	SetPluginManager(manager *PluginManager)  // 设置插件管理器引用
 }
 
+// ToolDescriber 可选接口，插件实现后作为LLM函数调用工具时使用自定义的描述和参数结构
+// 只有实现了该接口的插件会提供给模型，模型的参数按参数结构校验后才执行
+type ToolDescriber interface {
+	ToolSchema() ToolSchema
+}
+
+// HealthReporter 可选接口，插件实现后健康检查接口报告其外部依赖的状态
+type HealthReporter interface {
+	HealthCheck(ctx context.Context) (healthy bool, details interface{})
+}
+
+// ToolSchema 插件作为函数调用工具时的描述
+type ToolSchema struct {
+	Description string                 // 工具用途，为空时使用插件描述
+	Parameters  map[string]interface{} // Execute参数的JSON Schema，类型为object
+}
+
 // PluginInfo 存储插件信息和路由元数据
 type PluginInfo struct {
 	Plugin       Plugin   // 插件实例
@@ -409,12 +431,14 @@ func (pm *PluginManager) registerPluginRoutes(name string) error {
 	// 注册每个路由
 	for _, route := range routes {
 		// 创建路由处理函数链
-		handlers := append(route.Middlewares, route.Handler)
+		handlers := make([]gin.HandlerFunc, 0, len(route.Middlewares)+4)
 
-		// 如果需要认证，则在处理链前添加认证中间件
+		// 如果需要认证，则在处理链前添加认证中间件，认证后再校验调用者能否使用插件并按租户计量
 		if route.AuthRequired {
-			handlers = append([]gin.HandlerFunc{middleware.AuthMiddleware()}, handlers...)
+			handlers = append(handlers, middleware.AuthMiddleware(), PluginScopeMiddleware(pluginName), PluginQuotaMiddleware(pluginName))
 		}
+		handlers = append(handlers, route.Middlewares...)
+		handlers = append(handlers, route.Handler)
 
 		// 根据HTTP方法注册路由
 		switch route.Method {
@@ -541,6 +565,12 @@ func (pm *PluginManager) GetAllRoutes() map[string][]Route {
 
 // ExecutePlugin 执行插件功能
 func (pm *PluginManager) ExecutePlugin(name string, params map[string]interface{}) (interface{}, error) {
+	return pm.ExecutePluginContext(context.Background(), name, params)
+}
+
+// ExecutePluginContext 在请求上下文中执行插件功能，按上下文中的租户校验配额和团队范围并计量
+// 上下文没有租户信息时回退使用参数中的tenant_id
+func (pm *PluginManager) ExecutePluginContext(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
 	pm.mutex.RLock()
 	info, exists := pm.plugins[name]
 	pm.mutex.RUnlock()
@@ -554,6 +584,25 @@ func (pm *PluginManager) ExecutePlugin(name string, params map[string]interface{
 		return nil, fmt.Errorf("插件 '%s' 已被禁用", name)
 	}
 
+	// 带租户信息的调用按租户计量，执行前校验每日执行次数配额
+	tenantID, hasTenant := pkg.TenantIDFromContext(ctx)
+	if !hasTenant {
+		tenantID, hasTenant = tenantIDFromParams(params)
+	}
+	if hasTenant {
+		if err := checkPluginQuota(ctx, tenantID, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// 插件限定了团队范围时，只有该团队子树内的用户可以执行
+	if hasTenant {
+		userID, _ := uintParam(params, "user_id")
+		if err := checkPluginScope(ctx, tenantID, name, userID); err != nil {
+			return nil, err
+		}
+	}
+
 	startTime := time.Now()
 	success := true
 
@@ -569,9 +618,112 @@ func (pm *PluginManager) ExecutePlugin(name string, params map[string]interface{
 	metrics.RecordPluginExecution(name, success, duration)
 	metrics.RecordPluginMethodCall(name, "Execute", success)
 
+	if hasTenant {
+		recordPluginExecution(ctx, tenantID, name)
+	}
+
 	return result, err
 }
 
+// checkPluginQuota 校验租户当天的插件执行次数配额，只有超出配额时拒绝执行
+func checkPluginQuota(ctx context.Context, tenantID uint, name string) error {
+	err := quota.CheckUsage(ctx, tenantID, quota.MetricPluginExecutions, 1)
+	if err == nil {
+		return nil
+	}
+	if pkg.IsQuotaExceeded(err) {
+		metrics.RecordPluginError(name, "quota_exceeded")
+		return err
+	}
+	pkg.Warn("插件执行配额校验失败", zap.String("plugin", name), zap.Error(err))
+	return nil
+}
+
+// recordPluginExecution 记录租户的一次插件执行用量
+func recordPluginExecution(ctx context.Context, tenantID uint, name string) {
+	if err := quota.Record(ctx, tenantID, quota.MetricPluginExecutions, name, 1); err != nil {
+		pkg.Warn("记录插件执行用量失败", zap.String("plugin", name), zap.Error(err))
+	}
+}
+
+// checkPluginScope 校验用户能否在租户内使用插件，无法校验时同样拒绝
+func checkPluginScope(ctx context.Context, tenantID uint, name string, userID uint) error {
+	allowed, err := pkg.CanUsePlugin(ctx, tenantID, name, userID)
+	if err != nil {
+		pkg.Warn("插件团队范围校验失败", zap.String("plugin", name), zap.Error(err))
+	}
+	if err != nil || !allowed {
+		metrics.RecordPluginError(name, "team_scope_denied")
+		return pkg.NewForbiddenError(fmt.Sprintf("插件 '%s' 仅限指定团队使用", name), err)
+	}
+	return nil
+}
+
+// PluginScopeMiddleware 按认证后的租户和用户校验插件的团队范围，范围外的用户返回403
+// 插件路由自动使用；转交给插件处理的其他路由需要自行添加
+func PluginScopeMiddleware(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID, ok := pkg.TenantIDFromContext(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+		if err := checkPluginScope(c.Request.Context(), tenantID, name, c.GetUint("user_id")); err != nil {
+			pkg.AbortWithError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// PluginQuotaMiddleware 按认证后的租户校验插件执行次数配额，请求成功处理后计量一次执行
+// GET和HEAD等读取请求不算插件执行，既不校验配额也不计量
+func PluginQuotaMiddleware(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		tenantID, ok := pkg.TenantIDFromContext(ctx)
+		if !ok || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		if err := checkPluginQuota(ctx, tenantID, name); err != nil {
+			pkg.AbortWithError(c, err)
+			return
+		}
+		c.Next()
+		// 校验失败等错误响应不消耗配额
+		if !c.IsAborted() && c.Writer.Status() < http.StatusBadRequest {
+			recordPluginExecution(ctx, tenantID, name)
+		}
+	}
+}
+
+// tenantIDFromParams 从执行参数中解析租户ID
+func tenantIDFromParams(params map[string]interface{}) (uint, bool) {
+	return uintParam(params, "tenant_id")
+}
+
+// uintParam 从执行参数中解析无符号整数，兼容字符串和JSON数字
+func uintParam(params map[string]interface{}, key string) (uint, bool) {
+	switch v := params[key].(type) {
+	case uint:
+		return v, true
+	case int:
+		if v >= 0 {
+			return uint(v), true
+		}
+	case float64:
+		if v >= 0 {
+			return uint(v), true
+		}
+	case string:
+		if id, err := strconv.ParseUint(v, 10, 32); err == nil {
+			return uint(id), true
+		}
+	}
+	return 0, false
+}
+
 // RegisterPlugins 批量注册插件，自动处理依赖顺序
 func (pm *PluginManager) RegisterPlugins(plugins []Plugin) error {
 	// 1. 构建依赖图
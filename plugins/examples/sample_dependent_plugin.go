@@ -2,6 +2,7 @@ package examples
 
 import (
 	"fmt"
+	"weave/pkg"
 	"weave/plugins/core"
 
 	"github.com/gin-gonic/gin"
@@ -144,9 +145,9 @@ func (p *SampleDependentPlugin) handleUseDependency(c *gin.Context) {
 	action := c.DefaultQuery("action", "greet")
 	params := map[string]interface{}{"action": action}
 
-	result, err := p.pluginManager.ExecutePlugin("sample_optimized", params)
+	result, err := p.pluginManager.ExecutePluginContext(c.Request.Context(), "sample_optimized", params)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		pkg.RespondError(c, pkg.NewPluginExecutionError("依赖插件执行失败", err))
 		return
 	}
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 
+	"weave/pkg"
 	"weave/plugins/core"
 
 	"github.com/gin-gonic/gin"
@@ -192,7 +193,7 @@ func (p *SampleOptimizedPlugin) handleEcho(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		pkg.RespondError(c, pkg.NewValidationError("请求数据无效", err))
 		return
 	}
 
@@ -234,8 +235,7 @@ func (p *SampleOptimizedPlugin) validateEchoRequest(c *gin.Context) {
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(400, gin.H{"error": "消息不能为空"})
-			c.Abort()
+			pkg.AbortWithError(c, pkg.NewValidationError("消息不能为空", err))
 			return
 		}
 
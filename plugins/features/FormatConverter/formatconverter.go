@@ -66,17 +66,17 @@ func (p *FormatConverterPlugin) GetRoutes() []core.Route {
 		{Path: "/convert/json-to-yaml", Method: "POST", Handler: func(c *gin.Context) {
 			data, err := c.GetRawData()
 			if err != nil {
-				c.JSON(400, gin.H{"error": fmt.Sprintf("读取请求体失败: %v", err)})
+				pkg.RespondError(c, pkg.NewBadRequestError("读取请求体失败", err).WithDetails(err.Error()))
 				return
 			}
 			var obj interface{}
 			if err = json.Unmarshal(data, &obj); err != nil {
-				c.JSON(400, gin.H{"error": fmt.Sprintf("解析JSON失败: %v", err)})
+				pkg.RespondError(c, pkg.NewBadRequestError("解析JSON失败", err).WithDetails(err.Error()))
 				return
 			}
 			out, err := yaml.Marshal(obj)
 			if err != nil {
-				c.JSON(500, gin.H{"error": fmt.Sprintf("转换为YAML失败: %v", err)})
+				pkg.RespondError(c, pkg.NewInternalError("转换为YAML失败", err))
 				return
 			}
 			c.Data(200, "text/yaml; charset=utf-8", out)
@@ -84,18 +84,18 @@ func (p *FormatConverterPlugin) GetRoutes() []core.Route {
 		{Path: "/convert/yaml-to-json", Method: "POST", Handler: func(c *gin.Context) {
 			data, err := c.GetRawData()
 			if err != nil {
-				c.JSON(400, gin.H{"error": fmt.Sprintf("读取请求体失败: %v", err)})
+				pkg.RespondError(c, pkg.NewBadRequestError("读取请求体失败", err).WithDetails(err.Error()))
 				return
 			}
 			var obj interface{}
 			if err = yaml.Unmarshal(data, &obj); err != nil {
-				c.JSON(400, gin.H{"error": fmt.Sprintf("解析YAML失败: %v", err)})
+				pkg.RespondError(c, pkg.NewBadRequestError("解析YAML失败", err).WithDetails(err.Error()))
 				return
 			}
 			norm := normalizeYaml(obj)
 			out, err := json.Marshal(norm)
 			if err != nil {
-				c.JSON(500, gin.H{"error": fmt.Sprintf("转换为JSON失败: %v", err)})
+				pkg.RespondError(c, pkg.NewInternalError("转换为JSON失败", err))
 				return
 			}
 			c.Data(200, "application/json; charset=utf-8", out)
@@ -138,28 +138,28 @@ func normalizeYaml(i interface{}) interface{} {
 func (p *FormatConverterPlugin) jsonToProtobufHandler(c *gin.Context) {
 	data, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(400, gin.H{"error": fmt.Sprintf("读取请求体失败: %v", err)})
+		pkg.RespondError(c, pkg.NewBadRequestError("读取请求体失败", err).WithDetails(err.Error()))
 		return
 	}
 
 	// 将JSON转换为Structpb.Struct
 	var obj interface{}
 	if err = json.Unmarshal(data, &obj); err != nil {
-		c.JSON(400, gin.H{"error": fmt.Sprintf("解析JSON失败: %v", err)})
+		pkg.RespondError(c, pkg.NewBadRequestError("解析JSON失败", err).WithDetails(err.Error()))
 		return
 	}
 
 	// 使用structpb将interface{}转换为protobuf兼容的结构
 	structObj, err := structpb.NewValue(obj)
 	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("转换为Protobuf结构失败: %v", err)})
+		pkg.RespondError(c, pkg.NewInternalError("转换为Protobuf结构失败", err))
 		return
 	}
 
 	// 转换为二进制格式
 	binaryData, err := proto.Marshal(structObj)
 	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Protobuf序列化失败: %v", err)})
+		pkg.RespondError(c, pkg.NewInternalError("Protobuf序列化失败", err))
 		return
 	}
 
@@ -170,27 +170,42 @@ func (p *FormatConverterPlugin) jsonToProtobufHandler(c *gin.Context) {
 func (p *FormatConverterPlugin) protobufToJsonHandler(c *gin.Context) {
 	data, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(400, gin.H{"error": fmt.Sprintf("读取请求体失败: %v", err)})
+		pkg.RespondError(c, pkg.NewBadRequestError("读取请求体失败", err).WithDetails(err.Error()))
 		return
 	}
 
 	// 创建一个新的Structpb.Value作为接收容器
 	value := &structpb.Value{}
 	if err = proto.Unmarshal(data, value); err != nil {
-		c.JSON(400, gin.H{"error": fmt.Sprintf("解析Protobuf失败: %v", err)})
+		pkg.RespondError(c, pkg.NewBadRequestError("解析Protobuf失败", err).WithDetails(err.Error()))
 		return
 	}
 
 	// 将Protobuf转换为JSON
 	jsonData, err := protojson.Marshal(value)
 	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("转换为JSON失败: %v", err)})
+		pkg.RespondError(c, pkg.NewInternalError("转换为JSON失败", err))
 		return
 	}
 
 	c.Data(200, "application/json; charset=utf-8", jsonData)
 }
 
+// ToolSchema 以函数调用工具暴露JSON与YAML互转，Protobuf结果为二进制，不适合交给模型
+func (p *FormatConverterPlugin) ToolSchema() core.ToolSchema {
+	return core.ToolSchema{
+		Description: "在JSON和YAML之间转换文本",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"action": map[string]interface{}{"type": "string", "enum": []string{"json_to_yaml", "yaml_to_json"}},
+				"input":  map[string]interface{}{"type": "string", "description": "待转换的文本"},
+			},
+			"required": []string{"action", "input"},
+		},
+	}
+}
+
 func (p *FormatConverterPlugin) Execute(params map[string]interface{}) (interface{}, error) {
 	action, _ := params["action"].(string)
 	input, _ := params["input"].(string)
@@ -1,6 +1,7 @@
 package features
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -11,10 +12,12 @@ import (
 
 	"weave/models"
 	"weave/pkg"
+	"weave/pkg/quota"
 	"weave/plugins/core"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // Note 表示一条事件记录
@@ -26,6 +29,19 @@ type Note struct {
 	UpdatedTime time.Time `json:"updated_time"`
 }
 
+// 笔记访问错误，路由据此返回404或403
+var (
+	errNoteNotFound  = errors.New("笔记不存在或无权访问")
+	errNoteForbidden = errors.New("无权执行该操作，需要更高的共享权限")
+)
+
+// 笔记列表范围
+const (
+	noteScopeOwn    = "own"    // 自己创建的笔记
+	noteScopeShared = "shared" // 共享给我的笔记
+	noteScopeAll    = "all"    // 以上两者
+)
+
 // NotePlugin 记事本插件
 type NotePlugin struct {
 	// 使用MySQL数据库存储
@@ -99,6 +115,27 @@ func (p *NotePlugin) RegisterRoutes(router *gin.Engine) {
 	fmt.Printf("%s: 注意：使用了旧的RegisterRoutes方法，建议使用新的GetRoutes方法\n", p.Name())
 }
 
+// ToolSchema 以函数调用工具暴露笔记的查询、创建和更新，删除不交给模型执行
+func (p *NotePlugin) ToolSchema() core.ToolSchema {
+	return core.ToolSchema{
+		Description: "查询、搜索、创建和更新当前用户的笔记",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"action":    map[string]interface{}{"type": "string", "enum": []string{"list", "get", "search", "create", "update"}},
+				"id":        map[string]interface{}{"type": "string", "description": "笔记ID，get和update时必填"},
+				"title":     map[string]interface{}{"type": "string", "description": "笔记标题，create和update时必填"},
+				"content":   map[string]interface{}{"type": "string", "description": "笔记内容，create和update时必填"},
+				"keyword":   map[string]interface{}{"type": "string", "description": "search的关键词"},
+				"scope":     map[string]interface{}{"type": "string", "enum": []string{"own", "shared", "all"}},
+				"page":      map[string]interface{}{"type": "integer", "minimum": 1},
+				"page_size": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 100},
+			},
+			"required": []string{"action"},
+		},
+	}
+}
+
 // Execute 执行插件功能
 func (p *NotePlugin) Execute(params map[string]interface{}) (interface{}, error) {
 	action, ok := params["action"].(string)
@@ -131,7 +168,8 @@ func (p *NotePlugin) Execute(params map[string]interface{}) (interface{}, error)
 		if pageSizeParam, ok := params["page_size"].(float64); ok {
 			pageSize = int(pageSizeParam)
 		}
-		return p.listNotes(userID, tenantID, page, pageSize)
+		scope, _ := params["scope"].(string)
+		return p.listNotes(userID, tenantID, scope, page, pageSize)
 
 	case "get":
 		if noteID, ok := params["id"].(string); ok {
@@ -187,7 +225,7 @@ func (p *NotePlugin) Execute(params map[string]interface{}) (interface{}, error)
 				"description": p.Description(),
 				"version":     p.Version(),
 				"available_actions": []string{
-					"list - 列出笔记",
+					"list - 列出笔记（scope: own/shared/all）",
 					"get - 获取单个笔记",
 					"create - 创建新笔记",
 					"update - 更新笔记",
@@ -199,8 +237,8 @@ func (p *NotePlugin) Execute(params map[string]interface{}) (interface{}, error)
 	}
 }
 
-// listNotes 获取当前用户的所有笔记
-func (p *NotePlugin) listNotes(userID uint, tenantID uint, page, pageSize int) (interface{}, error) {
+// listNotes 获取当前用户的笔记，scope决定是否包含共享给当前用户的笔记
+func (p *NotePlugin) listNotes(userID uint, tenantID uint, scope string, page, pageSize int) (interface{}, error) {
 	// 获取读锁
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
@@ -217,7 +255,30 @@ func (p *NotePlugin) listNotes(userID uint, tenantID uint, page, pageSize int) (
 
 	offset := (page - 1) * pageSize
 
-	db := pkg.DB.Where("user_id = ? AND tenant_id = ?", userID, tenantID)
+	if scope == "" {
+		scope = noteScopeOwn
+	}
+	tdb := noteDB(tenantID)
+	db := tdb.Where("user_id = ?", userID)
+	if scope != noteScopeOwn {
+		shared, err := pkg.SharedWithUser(tdb, tenantID, models.ShareResourceNote, userID)
+		if err != nil {
+			log.Printf("Database error when fetching shared notes: %v", err)
+			return nil, fmt.Errorf("获取笔记列表失败，请稍后重试")
+		}
+		sharedIDs := make([]string, 0, len(shared))
+		for id := range shared {
+			sharedIDs = append(sharedIDs, id)
+		}
+		switch {
+		case scope == noteScopeShared && len(sharedIDs) == 0:
+			db = tdb.Where("1 = 0")
+		case scope == noteScopeShared:
+			db = tdb.Where("id IN ? AND user_id <> ?", sharedIDs, userID)
+		case len(sharedIDs) > 0:
+			db = tdb.Where("(user_id = ? OR id IN ?)", userID, sharedIDs)
+		}
+	}
 
 	if err := db.Model(&models.Note{}).Count(&total).Error; err != nil {
 		log.Printf("Database error when counting notes: %v", err)
@@ -246,12 +307,28 @@ func (p *NotePlugin) getNote(userID uint, tenantID uint, noteID string) (interfa
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
+	return p.findNote(userID, tenantID, noteID, models.ShareLevelRead)
+}
+
+// findNote 查找笔记并校验当前用户的权限级别（所有者或共享）
+func (p *NotePlugin) findNote(userID uint, tenantID uint, noteID, level string) (*models.Note, error) {
+	db := noteDB(tenantID)
 	var note models.Note
-	db := pkg.DB.Where("id = ? AND user_id = ? AND tenant_id = ?", noteID, userID, tenantID)
-	if err := db.First(&note).Error; err != nil {
-		return nil, fmt.Errorf("笔记不存在或无权访问")
+	if err := db.Where("id = ?", noteID).First(&note).Error; err != nil {
+		return nil, errNoteNotFound
 	}
-	return note, nil
+	current, err := pkg.NoteAccessLevel(db, &note, userID)
+	if err != nil {
+		log.Printf("Database error when checking note access: %v", err)
+		return nil, fmt.Errorf("获取笔记失败，请稍后重试")
+	}
+	if current == "" {
+		return nil, errNoteNotFound
+	}
+	if !pkg.HasShareLevel(current, level) {
+		return nil, errNoteForbidden
+	}
+	return &note, nil
 }
 
 // createNote 创建新笔记
@@ -259,17 +336,23 @@ func (p *NotePlugin) createNote(userID uint, tenantID uint, title, content strin
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	if err := quota.CheckResource(context.Background(), tenantID, quota.ResourceNotes); err != nil {
+		if pkg.IsQuotaExceeded(err) {
+			return nil, err
+		}
+		log.Printf("Quota check failed when creating note: %v", err)
+	}
+
 	note := models.Note{
 		ID:          uuid.New().String(),
 		Title:       title,
 		Content:     content,
 		UserID:      userID,
-		TenantID:    tenantID,
 		CreatedTime: time.Now(),
 		UpdatedTime: time.Now(),
 	}
 
-	if err := pkg.DB.Create(&note).Error; err != nil {
+	if err := noteDB(tenantID).Create(&note).Error; err != nil {
 		log.Printf("Database error when creating note: %v", err)
 		return nil, fmt.Errorf("创建笔记失败，请稍后重试")
 	}
@@ -281,17 +364,16 @@ func (p *NotePlugin) updateNote(userID uint, tenantID uint, noteID, title, conte
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	var note models.Note
-	db := pkg.DB.Where("id = ? AND user_id = ? AND tenant_id = ?", noteID, userID, tenantID)
-	if err := db.First(&note).Error; err != nil {
-		return nil, fmt.Errorf("笔记不存在或无权访问")
+	note, err := p.findNote(userID, tenantID, noteID, models.ShareLevelWrite)
+	if err != nil {
+		return nil, err
 	}
 
 	note.Title = title
 	note.Content = content
 	note.UpdatedTime = time.Now()
 
-	if err := pkg.DB.Save(&note).Error; err != nil {
+	if err := noteDB(tenantID).Save(note).Error; err != nil {
 		log.Printf("Database error when updating note: %v", err)
 		return nil, fmt.Errorf("更新笔记失败，请稍后重试")
 	}
@@ -303,13 +385,12 @@ func (p *NotePlugin) deleteNoteHandler(userID uint, tenantID uint, noteID string
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	var note models.Note
-	db := pkg.DB.Where("id = ? AND user_id = ? AND tenant_id = ?", noteID, userID, tenantID)
-	if err := db.First(&note).Error; err != nil {
-		return nil, fmt.Errorf("笔记不存在或无权访问")
+	note, err := p.findNote(userID, tenantID, noteID, models.ShareLevelAdmin)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := pkg.DB.Delete(&note).Error; err != nil {
+	if err := deleteNoteWithShares(note); err != nil {
 		log.Printf("Database error when deleting note: %v", err)
 		return nil, fmt.Errorf("删除笔记失败，请稍后重试")
 	}
@@ -322,16 +403,40 @@ func (p *NotePlugin) deleteNote(userID uint, tenantID uint, noteID string) error
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	var note models.Note
-	db := pkg.DB
-	if err := db.Where("id = ? AND user_id = ? AND tenant_id = ?", noteID, userID, tenantID).First(&note).Error; err != nil {
-		return errors.New("笔记不存在或无权访问")
+	note, err := p.findNote(userID, tenantID, noteID, models.ShareLevelAdmin)
+	if err != nil {
+		return err
 	}
+	return deleteNoteWithShares(note)
+}
 
-	if err := db.Delete(&note).Error; err != nil {
-		return err
+// deleteNoteWithShares 删除笔记及其共享记录
+func deleteNoteWithShares(note *models.Note) error {
+	return noteDB(note.TenantID).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(note).Error; err != nil {
+			return err
+		}
+		return pkg.DeleteResourceShares(tx, note.TenantID, models.ShareResourceNote, note.ID)
+	})
+}
+
+// noteDB 返回绑定租户的数据库会话，查询自动按租户过滤，创建时自动填充租户ID
+func noteDB(tenantID uint) *gorm.DB {
+	return pkg.DB.WithContext(pkg.WithTenantID(context.Background(), tenantID))
+}
+
+// noteError 将笔记操作错误转换为AppError，配额等已有的AppError原样返回
+func noteError(err error) *pkg.AppError {
+	var appErr *pkg.AppError
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, errNoteNotFound):
+		return pkg.NewNotFoundError(err.Error(), err)
+	case errors.Is(err, errNoteForbidden):
+		return pkg.NewForbiddenError(err.Error(), err)
 	}
-	return nil
+	return pkg.NewInternalError(err.Error(), err)
 }
 
 // searchNotes 搜索当前用户的笔记
@@ -352,7 +457,7 @@ func (p *NotePlugin) searchNotes(userID uint, tenantID uint, keyword string, pag
 	offset := (page - 1) * pageSize
 
 	query := "%" + keyword + "%"
-	db := pkg.DB.Where("user_id = ? AND tenant_id = ? AND (title LIKE ? OR content LIKE ?)", userID, tenantID, query, query)
+	db := noteDB(tenantID).Where("user_id = ? AND (title LIKE ? OR content LIKE ?)", userID, query, query)
 
 	if err := db.Model(&models.Note{}).Count(&total).Error; err != nil {
 		log.Printf("Database error when counting search results: %v", err)
@@ -397,7 +502,8 @@ func (p *NotePlugin) GetRoutes() []core.Route {
 					"version":     p.Version(),
 					"endpoints": []string{
 						"GET /plugins/note/ - 获取插件信息",
-						"GET /plugins/note/notes - 获取所有笔记（需认证；按租户与用户隔离）",
+						"GET /plugins/note/notes - 获取所有笔记（需认证；scope=own/shared/all，默认own）",
+						"GET /plugins/note/notes/shared - 获取共享给我的笔记（需认证）",
 						"GET /plugins/note/notes/:id - 获取单个笔记（需认证；按租户与用户隔离）",
 						"POST /plugins/note/notes - 创建新笔记（需认证；按租户与用户隔离）",
 						"PUT /plugins/note/notes/:id - 更新笔记（需认证；按租户与用户隔离）",
@@ -418,17 +524,47 @@ func (p *NotePlugin) GetRoutes() []core.Route {
 				tenantID := c.GetUint("tenant_id")
 				page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 				pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+				scope := c.DefaultQuery("scope", noteScopeOwn)
+				if scope != noteScopeOwn && scope != noteScopeShared && scope != noteScopeAll {
+					pkg.RespondError(c, pkg.NewValidationError("scope必须是own、shared或all", nil))
+					return
+				}
 
-				result, err := p.listNotes(userID, tenantID, page, pageSize)
+				result, err := p.listNotes(userID, tenantID, scope, page, pageSize)
 				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
+					pkg.RespondError(c, noteError(err))
 					return
 				}
 				c.JSON(200, result)
 			},
-			Description:  "获取所有笔记（支持分页和用户关联）",
+			Description:  "获取所有笔记（支持分页、用户关联和共享范围）",
 			AuthRequired: true,
 			Tags:         []string{"notes", "list"},
+			Params: map[string]string{
+				"page":      "页码，默认1",
+				"page_size": "每页数量，默认10",
+				"scope":     "own-自己的笔记，shared-共享给我的笔记，all-全部，默认own",
+			},
+		},
+		{
+			Path:   "/notes/shared",
+			Method: "GET",
+			Handler: func(c *gin.Context) {
+				userID := c.GetUint("user_id")
+				tenantID := c.GetUint("tenant_id")
+				page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+				pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+				result, err := p.listNotes(userID, tenantID, noteScopeShared, page, pageSize)
+				if err != nil {
+					pkg.RespondError(c, noteError(err))
+					return
+				}
+				c.JSON(200, result)
+			},
+			Description:  "获取共享给我的笔记（直接共享或通过团队共享）",
+			AuthRequired: true,
+			Tags:         []string{"notes", "list", "share"},
 			Params: map[string]string{
 				"page":      "页码，默认1",
 				"page_size": "每页数量，默认10",
@@ -444,7 +580,7 @@ func (p *NotePlugin) GetRoutes() []core.Route {
 
 				result, err := p.getNote(userID, tenantID, id)
 				if err != nil {
-					c.JSON(404, gin.H{"error": err.Error()})
+					pkg.RespondError(c, noteError(err))
 					return
 				}
 				c.JSON(200, result)
@@ -468,13 +604,13 @@ func (p *NotePlugin) GetRoutes() []core.Route {
 					Content string `json:"content" binding:"required,min=1"`
 				}
 				if err := c.ShouldBindJSON(&request); err != nil {
-					c.JSON(400, gin.H{"error": err.Error()})
+					pkg.RespondError(c, pkg.NewValidationError("笔记数据无效", err))
 					return
 				}
 
 				result, err := p.createNote(userID, tenantID, request.Title, request.Content)
 				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
+					pkg.RespondError(c, noteError(err))
 					return
 				}
 				c.JSON(201, result)
@@ -496,13 +632,13 @@ func (p *NotePlugin) GetRoutes() []core.Route {
 					Content string `json:"content" binding:"required,min=1"`
 				}
 				if err := c.ShouldBindJSON(&request); err != nil {
-					c.JSON(400, gin.H{"error": err.Error()})
+					pkg.RespondError(c, pkg.NewValidationError("笔记数据无效", err))
 					return
 				}
 
 				result, err := p.updateNote(userID, tenantID, id, request.Title, request.Content)
 				if err != nil {
-					c.JSON(404, gin.H{"error": err.Error()})
+					pkg.RespondError(c, noteError(err))
 					return
 				}
 				c.JSON(200, result)
@@ -521,7 +657,7 @@ func (p *NotePlugin) GetRoutes() []core.Route {
 
 				result, err := p.deleteNoteHandler(userID, tenantID, id)
 				if err != nil {
-					c.JSON(404, gin.H{"error": err.Error()})
+					pkg.RespondError(c, noteError(err))
 					return
 				}
 				c.JSON(200, result)
@@ -542,7 +678,7 @@ func (p *NotePlugin) GetRoutes() []core.Route {
 
 				result, err := p.searchNotes(userID, tenantID, keyword, page, pageSize)
 				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
+					pkg.RespondError(c, noteError(err))
 					return
 				}
 				c.JSON(200, result)
@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	"weave/pkg"
 	"weave/plugins/core"
 
 	"github.com/gin-gonic/gin"
@@ -316,7 +317,7 @@ func (p *ComprehensivePlugin) handleEcho(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		pkg.RespondError(c, pkg.NewValidationError("请求数据无效", err))
 		return
 	}
 
@@ -359,8 +360,7 @@ func (p *ComprehensivePlugin) validateEchoRequest(c *gin.Context) {
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(400, gin.H{"error": "消息不能为空"})
-			c.Abort()
+			pkg.AbortWithError(c, pkg.NewValidationError("消息不能为空", err))
 			return
 		}
 
@@ -6,6 +6,7 @@ import (
 	"weave/middleware"
 	"weave/pkg"
 	"weave/pkg/metrics"
+	"weave/plugins/core"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
@@ -106,6 +107,54 @@ func SetupRouter() *gin.Engine {
 				users.DELETE("/:id", userCtrl.DeleteUser)
 			}
 
+			// 租户相关路由
+			tenants := api.Group("/tenants")
+			{
+				// 为租户服务添加重试和超时保护
+				tenants.Use(middleware.RetryMiddleware(middleware.DefaultRetryConfig()))
+				tenants.Use(middleware.TimeoutMiddleware(middleware.DefaultTimeoutConfig()))
+
+				tenantCtrl := &controllers.TenantController{}
+				tenants.GET("/current", tenantCtrl.GetCurrentTenant) // 获取当前用户所属租户
+				// 以下接口仅平台管理员可用
+				tenants.GET("/", tenantCtrl.GetTenants)
+				tenants.GET("/:id", tenantCtrl.GetTenant)
+				tenants.POST("/", tenantCtrl.CreateTenant)
+				tenants.PUT("/:id", tenantCtrl.UpdateTenant)
+				tenants.POST("/:id/suspend", tenantCtrl.SuspendTenant)
+				tenants.POST("/:id/activate", tenantCtrl.ActivateTenant)
+				tenants.DELETE("/:id", tenantCtrl.DeleteTenant)
+				tenants.GET("/:id/quota", tenantCtrl.GetTenantQuota)      // 获取租户配额
+				tenants.PUT("/:id/quota", tenantCtrl.UpdateTenantQuota)   // 设置租户配额
+				tenants.GET("/:id/llm", tenantCtrl.GetTenantLLMConfig)    // 获取租户LLM模型配置
+				tenants.PUT("/:id/llm", tenantCtrl.UpdateTenantLLMConfig) // 设置租户LLM模型配置
+			}
+
+			// 租户用量相关路由
+			usage := api.Group("/usage")
+			{
+				usageCtrl := &controllers.UsageController{}
+				usage.GET("/", usageCtrl.GetUsage)               // 获取当前租户配额与用量
+				usage.GET("/daily", usageCtrl.GetDailyUsage)     // 获取每日用量汇总
+				usage.GET("/llm", usageCtrl.GetLLMUsage)         // 获取模型令牌用量和费用报表
+				usage.GET("/llm/prices", usageCtrl.GetLLMPrices) // 获取模型令牌单价
+			}
+
+			// 提示词模板相关路由，查看和预览面向所有用户，版本管理仅限平台管理员
+			prompts := api.Group("/prompts")
+			{
+				prompts.Use(middleware.RetryMiddleware(middleware.DefaultRetryConfig()))
+				prompts.Use(middleware.TimeoutMiddleware(middleware.DefaultTimeoutConfig()))
+
+				promptCtrl := &controllers.PromptController{}
+				prompts.GET("/", promptCtrl.GetPrompts)
+				prompts.GET("/:name", promptCtrl.GetPrompt)
+				prompts.POST("/:name/versions", promptCtrl.CreatePromptVersion) // 创建模板版本
+				prompts.PUT("/:name/active", promptCtrl.ActivatePromptVersion)  // 启用指定版本
+				prompts.DELETE("/:name/active", promptCtrl.DeactivatePrompt)    // 停用启用的版本
+				prompts.POST("/:name/render", promptCtrl.RenderPrompt)          // 预览渲染结果
+			}
+
 			// 团队相关路由
 			teams := api.Group("/teams")
 			{
@@ -116,18 +165,50 @@ func SetupRouter() *gin.Engine {
 				teamCtrl := &controllers.TeamController{}
 				teams.GET("/", teamCtrl.GetTeams) // 获取用户所属的团队列表
 				teams.POST("/", teamCtrl.CreateTeam)
+				teams.GET("/tree", teamCtrl.GetTeamTree)                      // 获取用户可见的团队树
 				teams.PUT("/:id", teamCtrl.UpdateTeam)                        // 更新团队信息
 				teams.POST("/:id/transfer-owner", teamCtrl.TransferTeamOwner) // 转让团队所有权
 
+				// 团队层级路由
+				teams.GET("/:id/tree", teamCtrl.GetTeamSubtree) // 获取团队子树及上级团队
+				teams.PUT("/:id/parent", teamCtrl.MoveTeam)     // 移动团队到新的上级团队
+				teams.GET("/:id/role", teamCtrl.GetMyTeamRole)  // 获取当前用户的有效角色
+
 				// 团队成员管理路由
 				teams.GET("/:id/members", teamCtrl.GetTeamMembers)                  // 获取团队成员列表
 				teams.GET("/:id/members/search", teamCtrl.SearchTeamMembers)        // 搜索团队成员
 				teams.POST("/:id/members", teamCtrl.AddTeamMember)                  // 添加团队成员
 				teams.DELETE("/:id/members/:memberId", teamCtrl.RemoveTeamMember)   // 移除团队成员
 				teams.PUT("/:id/members/:memberId/role", teamCtrl.UpdateMemberRole) // 更新成员角色
+
+				// 团队邀请管理路由
+				teams.POST("/:id/invitations", teamCtrl.InviteTeamMember)                     // 邀请成员
+				teams.GET("/:id/invitations", teamCtrl.GetTeamInvitations)                    // 获取团队邀请列表
+				teams.DELETE("/:id/invitations/:invitationId", teamCtrl.RevokeTeamInvitation) // 撤销邀请
+			}
+
+			// 当前用户收到的团队邀请
+			invitations := api.Group("/invitations")
+			{
+				teamCtrl := &controllers.TeamController{}
+				invitations.GET("/", teamCtrl.GetMyInvitations)              // 获取我的邀请
+				invitations.POST("/:id/accept", teamCtrl.AcceptInvitation)   // 接受邀请
+				invitations.POST("/:id/decline", teamCtrl.DeclineInvitation) // 拒绝邀请
+			}
+
+			// 资源共享相关路由（笔记、工具）
+			shares := api.Group("/shares")
+			{
+				shareCtrl := &controllers.ShareController{}
+				shares.GET("/with-me", shareCtrl.GetSharedWithMe)           // 获取共享给我的资源
+				shares.GET("/:type/:id", shareCtrl.GetResourceShares)       // 获取资源的共享列表
+				shares.POST("/:type/:id", shareCtrl.ShareResource)          // 共享资源
+				shares.DELETE("/:type/:id/:shareId", shareCtrl.RevokeShare) // 取消共享
 			}
 
 			// 审计日志相关路由
+			// 导出为长时间的流式响应，不经过重试和超时中间件
+			api.GET("/audit/export", (&controllers.AuditController{}).ExportAuditLogs)
 			audit := api.Group("/audit")
 			{
 				// 为审计服务添加重试和超时保护
@@ -135,9 +216,38 @@ func SetupRouter() *gin.Engine {
 				audit.Use(middleware.TimeoutMiddleware(middleware.DefaultTimeoutConfig()))
 
 				auditCtrl := &controllers.AuditController{}
-				audit.GET("/logs", auditCtrl.GetAuditLogs)    // 获取审计日志列表
-				audit.GET("/logs/:id", auditCtrl.GetAuditLog) // 获取单个审计日志详情
-				audit.GET("/stats", auditCtrl.GetAuditStats)  // 获取审计日志统计信息
+				audit.GET("/logs", auditCtrl.GetAuditLogs)             // 获取审计日志列表
+				audit.GET("/logs/:id", auditCtrl.GetAuditLog)          // 获取单个审计日志详情
+				audit.GET("/logs/:id/diff", auditCtrl.GetAuditLogDiff) // 获取审计日志的字段级变更
+				audit.GET("/stats", auditCtrl.GetAuditStats)           // 获取审计日志统计信息
+				audit.GET("/stats/query", auditCtrl.QueryAuditStats)   // 按维度统计审计日志，支持时间序列和周期对比
+				audit.GET("/verify", auditCtrl.VerifyAuditChain)       // 校验审计日志哈希链
+			}
+
+			// 数据保留与归档路由（平台管理员）
+			retentionGroup := api.Group("/retention")
+			{
+				retentionGroup.Use(middleware.RetryMiddleware(middleware.DefaultRetryConfig()))
+				retentionGroup.Use(middleware.TimeoutMiddleware(middleware.DefaultTimeoutConfig()))
+
+				retentionCtrl := &controllers.RetentionController{}
+				retentionGroup.GET("/policies", retentionCtrl.GetPolicies)            // 获取保留策略
+				retentionGroup.PUT("/policies/:resource", retentionCtrl.UpdatePolicy) // 设置保留天数和法律保全
+				retentionGroup.GET("/archives", retentionCtrl.GetArchives)            // 获取归档列表
+				retentionGroup.POST("/restore", retentionCtrl.RestoreArchives)        // 按时间范围恢复归档
+			}
+
+			// 安全告警路由
+			security := api.Group("/security")
+			{
+				security.Use(middleware.RetryMiddleware(middleware.DefaultRetryConfig()))
+				security.Use(middleware.TimeoutMiddleware(middleware.DefaultTimeoutConfig()))
+
+				securityCtrl := &controllers.SecurityController{}
+				security.GET("/alerts", securityCtrl.GetAlerts)                    // 获取安全告警列表
+				security.GET("/alerts/:id", securityCtrl.GetAlert)                 // 获取单个安全告警
+				security.PUT("/alerts/:id/status", securityCtrl.UpdateAlertStatus) // 确认或解决告警
+				security.GET("/rules", securityCtrl.GetRules)                      // 获取检测规则配置
 			}
 
 			// 工具相关路由
@@ -173,6 +283,10 @@ func SetupRouter() *gin.Engine {
 				plugins.GET("/", pluginCtrl.GetAllPlugins)
 				// 获取插件状态
 				plugins.GET("/:name/status", pluginCtrl.GetPluginStatus)
+				// 插件团队范围
+				plugins.GET("/:name/scope", pluginCtrl.GetPluginScope)
+				plugins.PUT("/:name/scope", pluginCtrl.SetPluginScope)
+				plugins.DELETE("/:name/scope", pluginCtrl.RemovePluginScope)
 				// 启用插件
 				plugins.POST("/:name/enable", pluginCtrl.EnablePlugin)
 				// 禁用插件
@@ -183,6 +297,17 @@ func SetupRouter() *gin.Engine {
 				plugins.GET("/dependency-graph", pluginCtrl.GetDependencyGraph)
 			}
 
+			// LLM相关路由
+			llm := api.Group("/llm")
+			{
+				// 流式响应不能重试，也不能在超时后另外写入响应，只为上下文设置截止时间，超时后由处理函数结束流
+				llm.Use(middleware.ContextTimeoutMiddleware(middleware.DefaultTimeoutConfig()))
+
+				// 与插件路由/plugins/LLMChat/api/stream一样校验插件的团队范围和执行次数配额
+				llmCtrl := &controllers.LLMController{}
+				llm.POST("/stream", core.PluginScopeMiddleware(controllers.LLMPluginName), core.PluginQuotaMiddleware(controllers.LLMPluginName), llmCtrl.Stream)
+			}
+
 			// 负载均衡管理路由
 			loadbalancer := api.Group("/loadbalancer")
 			{
@@ -222,5 +347,9 @@ func SetupRouter() *gin.Engine {
 	// 插件健康检查API
 	appGroup.GET("/health/plugins/:name", healthCtrl.PluginHealthCheck)
 
+	// JWT公钥集合，供其他服务验证Weave签发的令牌
+	jwksCtrl := &controllers.JWKSController{}
+	appGroup.GET("/.well-known/jwks.json", jwksCtrl.GetJWKS)
+
 	return router
 }
@@ -0,0 +1,458 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	dbmodels "weave/models"
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/llmusage"
+	"weave/pkg/quota"
+	"weave/plugins/core"
+	"weave/services/llm/internal/chat"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+)
+
+// invalidToolNameChars 函数名中不允许的字符，函数调用接口只接受字母、数字、下划线和连字符
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// agentTool 提供给模型的函数调用工具，执行时转交给对应的插件
+type agentTool struct {
+	plugin     string // 执行的插件
+	toolID     uint   // 对应的工具记录，直接暴露插件时为0
+	definition llms.Tool
+	parameters map[string]interface{} // 参数的JSON Schema，执行前按它校验模型提供的参数
+}
+
+// ToolCallRecord 本轮对话中模型发起的一次工具调用
+type ToolCallRecord struct {
+	Name       string `json:"name"`
+	Plugin     string `json:"plugin,omitempty"`
+	ToolID     uint   `json:"tool_id,omitempty"`
+	Arguments  string `json:"arguments"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// agentResult 工具调用循环的结果
+type agentResult struct {
+	response string
+	target   llmprovider.Target // 生成最终回复的提供方/模型
+	calls    []ToolCallRecord
+	tokens   int64 // 所有模型调用消耗的令牌数
+}
+
+// agentTools 返回当前用户可以通过模型调用的工具
+// 实现了ToolDescriber的启用插件按插件名暴露，用户可见且已启用的工具记录以tool_<ID>暴露并使用所属插件的参数结构；
+// 没有声明参数结构的插件、限定了团队范围而用户不在范围内的插件及其工具不会提供给模型
+func (p *LLMChatPlugin) agentTools(c *gin.Context, owner chat.Owner) ([]agentTool, error) {
+	if p.manager == nil {
+		return nil, nil
+	}
+
+	ctx := c.Request.Context()
+	plugins := make(map[string]core.Plugin)
+	for _, info := range p.manager.GetAllPluginsInfo() {
+		name := info.Plugin.Name()
+		if !info.IsEnabled || name == p.Name() {
+			continue
+		}
+		allowed, err := pkg.CanUsePlugin(ctx, owner.TenantID, name, owner.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := info.Plugin.(core.ToolDescriber); allowed && ok {
+			plugins[name] = info.Plugin
+		}
+	}
+
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]agentTool, 0, len(names))
+	for _, name := range names {
+		schema := pluginToolSchema(plugins[name])
+		tools = append(tools, agentTool{
+			plugin:     name,
+			definition: functionTool(name, schema.Description, schema.Parameters),
+			parameters: schema.Parameters,
+		})
+	}
+
+	visible, err := pkg.VisibleTools(pkg.TenantDB(c), owner.TenantID, owner.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, tool := range visible {
+		plugin, ok := plugins[tool.PluginName]
+		if !tool.IsEnabled || !ok {
+			continue
+		}
+		schema := pluginToolSchema(plugin)
+		description := tool.Description
+		if description == "" {
+			description = tool.Name
+		}
+		tools = append(tools, agentTool{
+			plugin:     tool.PluginName,
+			toolID:     tool.ID,
+			definition: functionTool(fmt.Sprintf("tool_%d", tool.ID), description, schema.Parameters),
+			parameters: schema.Parameters,
+		})
+	}
+	return tools, nil
+}
+
+// pluginToolSchema 返回插件的工具描述，描述为空时使用插件描述
+// 没有参数结构时使用不接受任何参数的结构，模型提供的参数都会被拒绝
+func pluginToolSchema(plugin core.Plugin) core.ToolSchema {
+	var schema core.ToolSchema
+	if describer, ok := plugin.(core.ToolDescriber); ok {
+		schema = describer.ToolSchema()
+	}
+	if schema.Description == "" {
+		schema.Description = plugin.Description()
+	}
+	if schema.Parameters == nil {
+		schema.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}, "additionalProperties": false}
+	}
+	return schema
+}
+
+// functionTool 创建函数调用工具定义，名称中的非法字符替换为下划线
+func functionTool(name, description string, parameters map[string]interface{}) llms.Tool {
+	name = invalidToolNameChars.ReplaceAllString(name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return llms.Tool{
+		Type: "function",
+		Function: &llms.FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+	}
+}
+
+// runAgent 运行工具调用循环：模型请求调用工具时执行并把结果交回模型，直到模型给出最终回复
+// 达到迭代次数、工具调用次数或令牌数上限后不再提供工具，要求模型根据已有结果直接回答
+func (p *LLMChatPlugin) runAgent(c *gin.Context, turn *chatTurn, tools []agentTool) (*agentResult, error) {
+	ctx := c.Request.Context()
+	byName := make(map[string]agentTool, len(tools))
+	definitions := make([]llms.Tool, 0, len(tools))
+	for _, tool := range tools {
+		byName[tool.definition.Function.Name] = tool
+		definitions = append(definitions, tool.definition)
+	}
+
+	result := &agentResult{}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, turn.prompt)}
+	for iteration := 0; ; iteration++ {
+		offerTools := len(definitions) > 0 &&
+			iteration < p.agent.MaxIterations &&
+			len(result.calls) < p.agent.MaxToolCalls &&
+			result.tokens < int64(p.agent.MaxTokens)
+		var options []llms.CallOption
+		if offerTools {
+			options = append(options, llms.WithTools(definitions))
+		}
+
+		// 主模型出错或超时后改用备用模型
+		var resp *llms.ContentResponse
+		target, err := p.registry.Call(ctx, turn.targets, func(ctx context.Context, target llmprovider.Target) error {
+			llm, err := p.pool.Get(target)
+			if err != nil {
+				return err
+			}
+			defer p.pool.Put(target, llm)
+
+			resp, err = llm.GenerateContent(ctx, messages, options...)
+			if err == nil && len(resp.Choices) == 0 {
+				err = fmt.Errorf("模型没有返回结果")
+			}
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+		result.target = target
+		usage := llmusage.FromResponse(resp, messageTokens(messages), "")
+		result.tokens += usage.Total()
+		p.recordUsage(context.WithoutCancel(ctx), turn, llmusage.SourceAgent, target, usage)
+
+		choice := resp.Choices[0]
+		if !offerTools || len(choice.ToolCalls) == 0 {
+			result.response = choice.Content
+			return result, nil
+		}
+
+		assistant := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+		if choice.Content != "" {
+			assistant.Parts = append(assistant.Parts, llms.TextContent{Text: choice.Content})
+		}
+		for _, call := range choice.ToolCalls {
+			assistant.Parts = append(assistant.Parts, call)
+		}
+		messages = append(messages, assistant)
+
+		for _, call := range choice.ToolCalls {
+			var content string
+			if len(result.calls) >= p.agent.MaxToolCalls {
+				content = "工具调用次数已达上限，未执行"
+			} else {
+				var record ToolCallRecord
+				content, record = p.executeToolCall(c, turn, byName, call)
+				result.calls = append(result.calls, record)
+			}
+			messages = append(messages, llms.MessageContent{
+				Role:  llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: call.ID, Name: toolCallName(call), Content: content}},
+			})
+		}
+	}
+}
+
+// executeToolCall 以调用者的身份执行模型请求的工具，返回交给模型的结果
+// 参数不符合工具定义时不执行；模型提供的user_id和tenant_id会被当前用户覆盖，插件执行时按调用者校验团队范围和配额
+func (p *LLMChatPlugin) executeToolCall(c *gin.Context, turn *chatTurn, byName map[string]agentTool, call llms.ToolCall) (string, ToolCallRecord) {
+	name := toolCallName(call)
+	record := ToolCallRecord{Name: name}
+	if call.FunctionCall != nil {
+		record.Arguments = call.FunctionCall.Arguments
+	}
+
+	tool, ok := byName[name]
+	if !ok {
+		record.Error = "未知的工具: " + name
+		return record.Error, record
+	}
+	record.Plugin, record.ToolID = tool.plugin, tool.toolID
+
+	params := make(map[string]interface{})
+	if record.Arguments != "" {
+		if err := json.Unmarshal([]byte(record.Arguments), &params); err != nil {
+			record.Error = "参数不是有效的JSON对象: " + err.Error()
+			return record.Error, record
+		}
+	}
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	// 插件的Execute可能支持未开放给模型的操作（如删除笔记），只执行工具定义允许的参数
+	if err := validateToolArguments(tool.parameters, params); err != nil {
+		record.Error = "参数不符合工具定义: " + err.Error()
+		return record.Error, record
+	}
+	params["user_id"] = strconv.FormatUint(uint64(turn.owner.UserID), 10)
+	params["tenant_id"] = strconv.FormatUint(uint64(turn.owner.TenantID), 10)
+
+	start := time.Now()
+	output, err := p.manager.ExecutePluginContext(c.Request.Context(), tool.plugin, params)
+	record.DurationMs = time.Since(start).Milliseconds()
+
+	var content string
+	if err != nil {
+		record.Error = err.Error()
+		content = "工具执行失败: " + err.Error()
+	} else if data, marshalErr := json.Marshal(output); marshalErr != nil {
+		content = fmt.Sprint(output)
+	} else {
+		content = string(data)
+	}
+	content = truncateRunes(content, p.agent.MaxResultChars)
+
+	history := dbmodels.ToolHistory{
+		UserID:     turn.owner.UserID,
+		ToolID:     tool.toolID,
+		TenantID:   turn.owner.TenantID,
+		PluginName: tool.plugin,
+		UsedAt:     start,
+		Params:     record.Arguments,
+		Result:     content,
+	}
+	if err := pkg.TenantDB(c).Create(&history).Error; err != nil {
+		pkg.Warn("Failed to record tool history", zap.String("plugin", tool.plugin), zap.Error(err))
+	}
+	return content, record
+}
+
+// validateToolArguments 按工具参数的JSON Schema校验模型提供的参数：必填参数、类型、枚举值和数值范围
+// 只校验顶层参数；schema的additionalProperties为false时不允许未声明的参数
+func validateToolArguments(schema, params map[string]interface{}) error {
+	for _, name := range schemaStrings(schema["required"]) {
+		if _, ok := params[name]; !ok {
+			return fmt.Errorf("缺少必填参数%s", name)
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := properties[name].(map[string]interface{})
+		if !ok {
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				return fmt.Errorf("不支持参数%s", name)
+			}
+			continue
+		}
+		if err := validateToolArgument(property, params[name]); err != nil {
+			return fmt.Errorf("参数%s%s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// validateToolArgument 校验单个参数的类型、枚举值和数值范围
+func validateToolArgument(property map[string]interface{}, value interface{}) error {
+	if typ, _ := property["type"].(string); typ != "" && !matchesSchemaType(typ, value) {
+		return fmt.Errorf("必须是%s类型", typ)
+	}
+	if enum, ok := property["enum"]; ok {
+		allowed := false
+		for _, option := range schemaValues(enum) {
+			if option == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("必须是以下值之一: %v", schemaValues(enum))
+		}
+	}
+	if number, ok := value.(float64); ok {
+		if minimum, ok := schemaNumber(property["minimum"]); ok && number < minimum {
+			return fmt.Errorf("不能小于%v", minimum)
+		}
+		if maximum, ok := schemaNumber(property["maximum"]); ok && number > maximum {
+			return fmt.Errorf("不能大于%v", maximum)
+		}
+	}
+	return nil
+}
+
+// matchesSchemaType 返回JSON解码后的值是否符合JSON Schema类型
+func matchesSchemaType(typ string, value interface{}) bool {
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// schemaValues 返回schema中的列表，插件可以用[]string或[]interface{}声明枚举值，数值统一为float64
+func schemaValues(value interface{}) []interface{} {
+	switch values := value.(type) {
+	case []string:
+		result := make([]interface{}, len(values))
+		for i, v := range values {
+			result[i] = v
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(values))
+		for i, v := range values {
+			if number, ok := schemaNumber(v); ok {
+				v = number
+			}
+			result[i] = v
+		}
+		return result
+	}
+	return nil
+}
+
+// schemaStrings 返回schema中的字符串列表，如required
+func schemaStrings(value interface{}) []string {
+	var result []string
+	for _, v := range schemaValues(value) {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// schemaNumber 返回schema中的数值，插件可以用任意整数或浮点类型声明
+func schemaNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// toolCallName 返回模型请求调用的函数名
+func toolCallName(call llms.ToolCall) string {
+	if call.FunctionCall == nil {
+		return ""
+	}
+	return call.FunctionCall.Name
+}
+
+// messageTokens 估算消息列表的令牌数，包括工具调用参数和工具结果
+func messageTokens(messages []llms.MessageContent) int64 {
+	var tokens int64
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			switch part := part.(type) {
+			case llms.TextContent:
+				tokens += quota.EstimateTokens(part.Text)
+			case llms.ToolCall:
+				if part.FunctionCall != nil {
+					tokens += quota.EstimateTokens(part.FunctionCall.Name + part.FunctionCall.Arguments)
+				}
+			case llms.ToolCallResponse:
+				tokens += quota.EstimateTokens(part.Content)
+			}
+		}
+	}
+	return tokens
+}
+
+// truncateRunes 将文本截断为最多limit个字符
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if limit <= 0 || len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "...(已截断)"
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"weave/pkg/llmprovider"
 	"weave/services/llm/internal/chat"
 	"weave/services/llm/internal/config"
 	"weave/services/llm/internal/server"
@@ -33,22 +34,27 @@ func main() {
 		log.SetOutput(logFile)
 	}
 
+	// 加载配置信息
+	appConfig, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal("failed to load config: ", err)
+	}
+	target := llmprovider.Target{Provider: "ollama", Model: appConfig.ModelName}
+
 	// 初始化LLM连接池
-	pool := chat.NewLLMPool(5, func() (llms.LLM, error) {
-		// 加载配置信息
-		config, _ := config.LoadConfig()
+	pool := chat.NewLLMPool(5, func(target llmprovider.Target) (llms.LLM, error) {
 		// 创建新的LLM实例
 		return ollama.New(
-			ollama.WithModel(config.ModelName),     // 模型名称
-			ollama.WithServerURL(config.ServerURL), // 服务器地址
+			ollama.WithModel(target.Model),            // 模型名称
+			ollama.WithServerURL(appConfig.ServerURL), // 服务器地址
 		)
 	})
 
 	// 启动HTTP服务器（异步）
-	go server.StartWebServer(pool)
+	go server.StartWebServer(pool, target)
 
 	// 初始化聊天实例
-	c, err := chat.NewChat(pool)
+	c, err := chat.NewChat(pool, target)
 	if err != nil {
 		log.Fatal("failed to create chat: ", err) // 如果初始化失败，记录错误并退出
 	}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	dbmodels "weave/models"
+	"weave/pkg/llmprovider"
 	"weave/services/llm/internal/config"
 
 	"github.com/tmc/langchaingo/llms"
@@ -16,17 +18,26 @@ import (
 
 // 聊天会话核心组件
 type Chat struct {
-	pool    *LLMPool           // LLM连接池
-	ctx     context.Context    // 上下文
-	cancel  context.CancelFunc // 取消函数
-	reader  *bufio.Reader      // 输入读取器
-	history []string           // 对话历史记录
+	pool              *LLMPool                       // LLM连接池
+	target            llmprovider.Target             // 使用的提供方和模型
+	ctx               context.Context                // 上下文
+	cancel            context.CancelFunc             // 取消函数
+	reader            *bufio.Reader                  // 输入读取器
+	window            *Window                        // 模型的上下文窗口
+	system            string                         // 固定的系统提示词，为空时使用默认提示词
+	summary           string                         // 较早消息的滚动摘要
+	summarizedThrough uint                           // 已并入摘要的最后一条消息ID
+	history           []dbmodels.ConversationMessage // 尚未并入摘要的对话历史
 }
 
+// Summarizer 调用模型生成不超过maxTokens个令牌的摘要
+type Summarizer func(ctx context.Context, prompt string, maxTokens int) (string, error)
+
 // 创建初始化Chat实例
-func NewChat(pool *LLMPool) (*Chat, error) {
+// target: 从连接池获取模型实例时使用的提供方和模型
+func NewChat(pool *LLMPool, target llmprovider.Target) (*Chat, error) {
 	// 加载配置(检查配置有效性)
-	_, err := config.LoadConfig()
+	appConfig, err := config.LoadConfig()
 	if err != nil {
 		return nil, fmt.Errorf("加载配置失败: %v", err)
 	}
@@ -34,17 +45,18 @@ func NewChat(pool *LLMPool) (*Chat, error) {
 	// 创建带超时的上下文(30分钟)
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	return &Chat{
-		pool:    pool,
-		ctx:     ctx,
-		cancel:  cancel,
-		reader:  bufio.NewReader(os.Stdin),     // 从标准输入读取
-		history: make([]string, 0, maxHistory), // 初始化历史记录切片
+		pool:   pool,
+		target: target,
+		ctx:    ctx,
+		cancel: cancel,
+		reader: bufio.NewReader(os.Stdin), // 从标准输入读取
+		window: NewWindow(appConfig.Context, target),
 	}, nil
 }
 
 // 从连接池获取LLM实例
 func (c *Chat) GetLLM() llms.LLM {
-	llm, err := c.pool.Get()
+	llm, err := c.pool.Get(c.target)
 	if err != nil {
 		log.Printf("Failed to get LLM from pool: %v", err)
 		return nil
@@ -52,8 +64,6 @@ func (c *Chat) GetLLM() llms.LLM {
 	return llm
 }
 
-const maxHistory = 10 // 最大历史记录条数
-
 // 聊天对话主循环
 func (c *Chat) Start() error {
 	fmt.Println("Welcome to AI PaiChat!")
@@ -74,7 +84,8 @@ func (c *Chat) Start() error {
 			fmt.Println("Thank you for using it, looking forward to our next encounter.")
 			return nil
 		case "clear":
-			c.history = make([]string, 0)
+			c.history = nil
+			c.summary, c.summarizedThrough = "", 0
 			fmt.Println("Chat history cleared.")
 			continue
 		case "help":
@@ -85,19 +96,28 @@ func (c *Chat) Start() error {
 			continue
 		case "history":
 			fmt.Println("\n对话历史:")
+			if c.summary != "" {
+				fmt.Printf("[摘要] %s\n", c.summary)
+			}
 			for _, msg := range c.history {
-				fmt.Println(msg)
+				fmt.Print(historyLine(msg))
 			}
 			continue
 		}
 
-		// 构建提示词
+		// 历史超出上下文窗口时先摘要较早的消息，失败时按令牌预算截断
+		if _, err := c.Compact(c.ctx, input, c.summarize); err != nil {
+			log.Printf("摘要对话历史失败: %v", err)
+		}
 		prompt := c.BuildPrompt(input)
 
 		// 获取AI响应
 		fmt.Print("\nPaiChat: ")
 		var response strings.Builder
 		llm := c.GetLLM()
+		if llm == nil {
+			continue
+		}
 		_, err = llms.GenerateFromSinglePrompt(c.ctx, llm, prompt,
 			llms.WithTemperature(0.8),
 			llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
@@ -106,6 +126,7 @@ func (c *Chat) Start() error {
 				return nil
 			}),
 		)
+		c.pool.Put(c.target, llm)
 		if err != nil {
 			log.Printf("模型调用失败: %v\n提示词内容: %s", err, prompt)
 			continue
@@ -124,28 +145,90 @@ func (c *Chat) Close() {
 	}
 }
 
-// 构建完整提示词
+// 构建完整提示词，历史记录按模型的上下文窗口截断
 func (c *Chat) BuildPrompt(input string) string {
-	var prompt strings.Builder
-	prompt.WriteString("PaiChat，回答应当:\n")
-	prompt.WriteString("- 简洁明了\n- 逻辑清晰\n- 必要时提供示例\n\n")
+	return c.window.Prompt(c.system, c.summary, c.history, input)
+}
+
+// PromptContext 返回BuildPrompt(input)中本次输入之前的部分
+func (c *Chat) PromptContext(input string) string {
+	return c.window.Context(c.system, c.summary, c.history, input)
+}
+
+// LoadPrompts 按租户的提示词模板组装之后的提示词，未调用时使用内置模板
+func (c *Chat) LoadPrompts(ctx context.Context, tenantID uint) {
+	c.window = c.window.WithPrompts(ctx, tenantID)
+}
+
+// HistoryLimit 返回每次最多加载的历史消息条数
+func (c *Chat) HistoryLimit() int {
+	return c.window.MaxMessages()
+}
 
-	for _, msg := range c.history {
-		prompt.WriteString(msg)
+// LoadConversation 用已保存的对话替换系统提示词、摘要和历史记录
+// 已并入摘要的消息不再原样放入提示词；conversation为nil时表示新对话
+func (c *Chat) LoadConversation(conversation *dbmodels.Conversation, messages []dbmodels.ConversationMessage) {
+	c.system, c.summary, c.summarizedThrough = "", "", 0
+	if conversation != nil {
+		c.system, c.summary, c.summarizedThrough = conversation.SystemPrompt, conversation.Summary, conversation.SummarizedThrough
+	}
+	c.history = c.history[:0]
+	for _, msg := range messages {
+		if msg.ID == 0 || msg.ID > c.summarizedThrough {
+			c.history = append(c.history, msg)
+		}
 	}
-	prompt.WriteString(fmt.Sprintf("You: %s\nPaiChat: ", input))
-	return prompt.String()
 }
 
-// 添加对话到历史记录
-func (c *Chat) addHistory(userInput, aiResponse string) {
-	if len(c.history) >= maxHistory {
-		c.history = c.history[1:]
+// Summary 返回当前的摘要和已并入摘要的最后一条消息ID
+func (c *Chat) Summary() (string, uint) {
+	return c.summary, c.summarizedThrough
+}
+
+// Compact 在摘要策略下，历史放不进上下文窗口时将较早的消息与已有摘要合并为新摘要
+// 返回摘要是否更新；摘要失败时历史保持不变，由BuildPrompt按令牌预算截断
+func (c *Chat) Compact(ctx context.Context, input string, summarize Summarizer) (bool, error) {
+	cut := c.window.summaryCut(c.system, c.summary, c.history, input)
+	if cut == 0 {
+		return false, nil
+	}
+	prompt, err := c.window.summaryPrompt(ctx, c.summary, c.history[:cut])
+	if err != nil {
+		return false, err
 	}
-	timestamp := time.Now().Format("2025-05-01 16:05:05")
+	summary, err := summarize(ctx, prompt, c.window.summaryMaxTokens)
+	if err != nil {
+		return false, err
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return false, fmt.Errorf("模型返回了空摘要")
+	}
+
+	c.summary = summary
+	c.summarizedThrough = c.history[cut-1].ID
+	c.history = append([]dbmodels.ConversationMessage(nil), c.history[cut:]...)
+	return true, nil
+}
+
+// summarize 用连接池中的模型生成摘要
+func (c *Chat) summarize(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	llm := c.GetLLM()
+	if llm == nil {
+		return "", fmt.Errorf("没有可用的LLM实例")
+	}
+	defer c.pool.Put(c.target, llm)
+	return llms.GenerateFromSinglePrompt(ctx, llm, prompt, llms.WithMaxTokens(maxTokens))
+}
+
+// 添加对话到历史记录，超出加载上限时丢弃最早的消息
+func (c *Chat) addHistory(userInput, aiResponse string) {
+	now := time.Now()
 	c.history = append(c.history,
-		fmt.Sprintf("[%s] You: %s\n[%s] PaiChat: %s\n",
-			timestamp, userInput,
-			timestamp, aiResponse),
+		dbmodels.ConversationMessage{Role: dbmodels.MessageRoleUser, Content: userInput, CreatedAt: now},
+		dbmodels.ConversationMessage{Role: dbmodels.MessageRoleAssistant, Content: aiResponse, CreatedAt: now},
 	)
+	if limit := c.window.MaxMessages(); len(c.history) > limit {
+		c.history = c.history[len(c.history)-limit:]
+	}
 }
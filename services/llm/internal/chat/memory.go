@@ -0,0 +1,196 @@
+package chat
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	dbmodels "weave/models"
+)
+
+// memoryRepository 内存中的ChatRepository实现，供不连接数据库的独立服务使用，重启后数据丢失
+type memoryRepository struct {
+	mu            sync.RWMutex
+	nextID        uint
+	nextMessageID uint
+	conversations map[uint]*dbmodels.Conversation
+	messages      map[uint][]dbmodels.ConversationMessage
+}
+
+// NewMemoryRepository 创建内存对话存储库
+func NewMemoryRepository() ChatRepository {
+	return &memoryRepository{
+		conversations: make(map[uint]*dbmodels.Conversation),
+		messages:      make(map[uint][]dbmodels.ConversationMessage),
+	}
+}
+
+// find 查找属于所有者的对话，调用方需持有锁
+func (r *memoryRepository) find(owner Owner, id uint) (*dbmodels.Conversation, error) {
+	conversation, ok := r.conversations[id]
+	if !ok || conversation.TenantID != owner.TenantID || conversation.UserID != owner.UserID {
+		return nil, ErrConversationNotFound
+	}
+	return conversation, nil
+}
+
+func (r *memoryRepository) CreateConversation(ctx context.Context, owner Owner, title string) (*dbmodels.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	now := time.Now()
+	conversation := &dbmodels.Conversation{ID: r.nextID, TenantID: owner.TenantID, UserID: owner.UserID, Title: title, CreatedAt: now, UpdatedAt: now}
+	r.conversations[conversation.ID] = conversation
+	copied := *conversation
+	return &copied, nil
+}
+
+func (r *memoryRepository) ListConversations(ctx context.Context, owner Owner, page, pageSize int) ([]dbmodels.Conversation, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var owned []dbmodels.Conversation
+	for _, conversation := range r.conversations {
+		if conversation.TenantID == owner.TenantID && conversation.UserID == owner.UserID {
+			owned = append(owned, *conversation)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		if !owned[i].UpdatedAt.Equal(owned[j].UpdatedAt) {
+			return owned[i].UpdatedAt.After(owned[j].UpdatedAt)
+		}
+		return owned[i].ID > owned[j].ID
+	})
+	return paginate(owned, page, pageSize), int64(len(owned)), nil
+}
+
+func (r *memoryRepository) GetConversation(ctx context.Context, owner Owner, id uint) (*dbmodels.Conversation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conversation, err := r.find(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *conversation
+	return &copied, nil
+}
+
+func (r *memoryRepository) RenameConversation(ctx context.Context, owner Owner, id uint, title string) (*dbmodels.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation, err := r.find(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	conversation.Title = title
+	copied := *conversation
+	return &copied, nil
+}
+
+func (r *memoryRepository) SetSystemPrompt(ctx context.Context, owner Owner, id uint, prompt string) (*dbmodels.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation, err := r.find(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	conversation.SystemPrompt = prompt
+	copied := *conversation
+	return &copied, nil
+}
+
+func (r *memoryRepository) SaveSummary(ctx context.Context, owner Owner, id uint, summary string, throughID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation, err := r.find(owner, id)
+	if err != nil {
+		return err
+	}
+	conversation.Summary = summary
+	conversation.SummarizedThrough = throughID
+	return nil
+}
+
+func (r *memoryRepository) DeleteConversation(ctx context.Context, owner Owner, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.find(owner, id); err != nil {
+		return err
+	}
+	delete(r.conversations, id)
+	delete(r.messages, id)
+	return nil
+}
+
+func (r *memoryRepository) SaveMessages(ctx context.Context, owner Owner, conversationID uint, messages ...dbmodels.ConversationMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation, err := r.find(owner, conversationID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, message := range messages {
+		r.nextMessageID++
+		message.ID = r.nextMessageID
+		message.ConversationID = conversationID
+		message.TenantID = owner.TenantID
+		message.UserID = owner.UserID
+		if message.CreatedAt.IsZero() {
+			message.CreatedAt = now
+		}
+		r.messages[conversationID] = append(r.messages[conversationID], message)
+	}
+	conversation.MessageCount = len(r.messages[conversationID])
+	conversation.UpdatedAt = now
+	return nil
+}
+
+func (r *memoryRepository) ListMessages(ctx context.Context, owner Owner, conversationID uint, page, pageSize int) ([]dbmodels.ConversationMessage, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, err := r.find(owner, conversationID); err != nil {
+		return nil, 0, err
+	}
+	messages := r.messages[conversationID]
+	return paginate(messages, page, pageSize), int64(len(messages)), nil
+}
+
+func (r *memoryRepository) RecentMessages(ctx context.Context, owner Owner, conversationID uint, limit int) ([]dbmodels.ConversationMessage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, err := r.find(owner, conversationID); err != nil {
+		return nil, err
+	}
+	messages := r.messages[conversationID]
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return append([]dbmodels.ConversationMessage(nil), messages...), nil
+}
+
+func (r *memoryRepository) ClearMessages(ctx context.Context, owner Owner, conversationID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation, err := r.find(owner, conversationID)
+	if err != nil {
+		return err
+	}
+	delete(r.messages, conversationID)
+	conversation.MessageCount = 0
+	conversation.Summary, conversation.SummarizedThrough = "", 0
+	return nil
+}
+
+// paginate 返回指定页的副本，页码从1开始
+func paginate[T any](items []T, page, pageSize int) []T {
+	start := (page - 1) * pageSize
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	return append([]T(nil), items[start:end]...)
+}
@@ -4,70 +4,120 @@ import (
 	"sync"
 	"time"
 
+	"weave/pkg/llmprovider"
+
 	"github.com/tmc/langchaingo/llms"
 )
 
 // 管理LLM连接资源池
+// 每个提供方/模型使用独立的子池，互不占用容量
 type LLMPool struct {
-	pool     chan llms.LLM            // 存放LLM连接缓冲通道
-	creator  func() (llms.LLM, error) // 创建新连接回调函数
-	mu       sync.Mutex               // 保护并发访问互斥锁
-	timeout  time.Duration            // 获取连接超时时间
-	maxRetry int                      // 创建连接最大重试次数
+	size     int                                               // 每个子池的容量
+	creator  func(target llmprovider.Target) (llms.LLM, error) // 创建新连接回调函数
+	mu       sync.Mutex                                        // 保护子池表和配置
+	pools    map[llmprovider.Target]*modelPool                 // 按提供方/模型划分的子池
+	timeout  time.Duration                                     // 获取连接超时时间
+	maxRetry int                                               // 创建连接最大重试次数
+}
+
+// 单个提供方/模型的连接子池
+type modelPool struct {
+	pool    chan llms.LLM // 存放LLM连接缓冲通道
+	mu      sync.Mutex    // 保护并发访问互斥锁
+	created int           // 已创建且未关闭的连接数
 }
 
 // 创建新LLM连接池
-// size: 连接池容量
-// creator: 创建新连接的函数
-func NewLLMPool(size int, creator func() (llms.LLM, error)) *LLMPool {
+// size: 每个提供方/模型的连接池容量
+// creator: 按提供方/模型创建新连接的函数
+func NewLLMPool(size int, creator func(target llmprovider.Target) (llms.LLM, error)) *LLMPool {
 	return &LLMPool{
-		pool:     make(chan llms.LLM, size),
+		size:     size,
 		creator:  creator,
+		pools:    make(map[llmprovider.Target]*modelPool),
 		timeout:  5 * time.Second, // 默认5秒超时
 		maxRetry: 3,               // 默认重试3次
 	}
 }
 
-// 从池中获取一个LLM连接
-// 如果池中没有可用连接，会等待直到超时或获取成功
-// 超时后会尝试创建新连接
-func (p *LLMPool) Get() (llms.LLM, error) {
+// 返回提供方/模型的子池，不存在时创建
+func (p *LLMPool) modelPool(target llmprovider.Target) *modelPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mp, ok := p.pools[target]
+	if !ok {
+		mp = &modelPool{pool: make(chan llms.LLM, p.size)}
+		p.pools[target] = mp
+	}
+	return mp
+}
+
+// 从池中获取一个指定提供方/模型的LLM连接
+// 池中没有空闲连接且未达到容量时直接创建新连接，
+// 达到容量后等待其他调用方归还，超时后仍会尝试创建新连接
+func (p *LLMPool) Get(target llmprovider.Target) (llms.LLM, error) {
+	mp := p.modelPool(target)
+	select {
+	case llm := <-mp.pool:
+		return llm, nil
+	default:
+	}
+
+	mp.mu.Lock()
+	canCreate := mp.created < cap(mp.pool)
+	mp.mu.Unlock()
+	if canCreate {
+		return p.createWithRetry(mp, target)
+	}
+
+	p.mu.Lock()
+	timeout := p.timeout
+	p.mu.Unlock()
 	select {
-	case llm := <-p.pool:
+	case llm := <-mp.pool:
 		return llm, nil
-	case <-time.After(p.timeout):
-		return p.createWithRetry() // 超时后重试创建
+	case <-time.After(timeout):
+		return p.createWithRetry(mp, target) // 超时后重试创建
 	}
 }
 
 // 带重试机制的连接创建方法
 // 使用指数退避策略进行重试
-func (p *LLMPool) createWithRetry() (llms.LLM, error) {
+func (p *LLMPool) createWithRetry(mp *modelPool, target llmprovider.Target) (llms.LLM, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	maxRetry := p.maxRetry
+	p.mu.Unlock()
 
 	var lastErr error
-	for i := 0; i < p.maxRetry; i++ {
-		llm, err := p.creator()
+	for i := 0; i < maxRetry; i++ {
+		llm, err := p.creator(target)
 		if err == nil {
+			mp.created++
 			return llm, nil
 		}
 		lastErr = err
-		time.Sleep(time.Second * time.Duration(i+1)) // 指数退避
+		if i < maxRetry-1 {
+			time.Sleep(time.Second * time.Duration(i+1)) // 指数退避
+		}
 	}
 	return nil, lastErr
 }
 
-// 将连接放回池中
+// 将连接放回所属提供方/模型的池中
 // 如果池已满，会安全关闭连接
-func (p *LLMPool) Put(llm llms.LLM) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+func (p *LLMPool) Put(target llmprovider.Target, llm llms.LLM) {
+	mp := p.modelPool(target)
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
 
 	select {
-	case p.pool <- llm: // 尝试放回池中
+	case mp.pool <- llm: // 尝试放回池中
 	default:
 		// 池已满，安全关闭连接
+		mp.created--
 		if closer, ok := llm.(interface{ Close() error }); ok {
 			_ = closer.Close()
 		}
@@ -76,19 +126,35 @@ func (p *LLMPool) Put(llm llms.LLM) {
 
 // 设置获取连接的超时时间
 func (p *LLMPool) SetTimeout(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.timeout = d
 }
 
 // 设置创建连接的最大重试次数
 func (p *LLMPool) SetMaxRetry(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.maxRetry = n
 }
 
-// 获取连接池的统计信息
+// 获取连接池的统计信息，models按“提供方/模型”列出各子池的连接数
 func (p *LLMPool) Stats() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	models := make(map[string]interface{}, len(p.pools))
+	for target, mp := range p.pools {
+		mp.mu.Lock()
+		models[target.String()] = map[string]interface{}{
+			"created":   mp.created,   // 已创建的连接数
+			"available": len(mp.pool), // 当前可用连接数
+		}
+		mp.mu.Unlock()
+	}
 	return map[string]interface{}{
-		"capacity":  cap(p.pool), // 池总容量
-		"available": len(p.pool), // 当前可用连接数
-		"timeout":   p.timeout,   // 当前超时设置
+		"capacity": p.size,    // 每个子池的容量
+		"timeout":  p.timeout, // 当前超时设置
+		"models":   models,
 	}
 }
@@ -0,0 +1,181 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	dbmodels "weave/models"
+
+	"gorm.io/gorm"
+)
+
+// gormRepository 基于数据库的ChatRepository实现
+// 所有查询都同时按租户和用户过滤，用户只能访问自己的对话
+type gormRepository struct {
+	db *gorm.DB
+}
+
+// NewGormRepository 创建基于数据库的对话存储库
+func NewGormRepository(db *gorm.DB) ChatRepository {
+	return &gormRepository{db: db}
+}
+
+// scoped 返回限定在所有者范围内的查询
+func (r *gormRepository) scoped(ctx context.Context, owner Owner) *gorm.DB {
+	return r.db.WithContext(ctx).Where("tenant_id = ? AND user_id = ?", owner.TenantID, owner.UserID)
+}
+
+func (r *gormRepository) CreateConversation(ctx context.Context, owner Owner, title string) (*dbmodels.Conversation, error) {
+	conversation := &dbmodels.Conversation{TenantID: owner.TenantID, UserID: owner.UserID, Title: title}
+	if err := r.db.WithContext(ctx).Create(conversation).Error; err != nil {
+		return nil, err
+	}
+	return conversation, nil
+}
+
+func (r *gormRepository) ListConversations(ctx context.Context, owner Owner, page, pageSize int) ([]dbmodels.Conversation, int64, error) {
+	var total int64
+	if err := r.scoped(ctx, owner).Model(&dbmodels.Conversation{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var conversations []dbmodels.Conversation
+	err := r.scoped(ctx, owner).Order("updated_at DESC, id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&conversations).Error
+	return conversations, total, err
+}
+
+func (r *gormRepository) GetConversation(ctx context.Context, owner Owner, id uint) (*dbmodels.Conversation, error) {
+	var conversation dbmodels.Conversation
+	if err := r.scoped(ctx, owner).Where("id = ?", id).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+func (r *gormRepository) RenameConversation(ctx context.Context, owner Owner, id uint, title string) (*dbmodels.Conversation, error) {
+	conversation, err := r.GetConversation(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	// 重命名不改变对话在列表中的位置
+	if err := r.db.WithContext(ctx).Model(conversation).UpdateColumn("title", title).Error; err != nil {
+		return nil, err
+	}
+	conversation.Title = title
+	return conversation, nil
+}
+
+func (r *gormRepository) SetSystemPrompt(ctx context.Context, owner Owner, id uint, prompt string) (*dbmodels.Conversation, error) {
+	conversation, err := r.GetConversation(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.WithContext(ctx).Model(conversation).UpdateColumn("system_prompt", prompt).Error; err != nil {
+		return nil, err
+	}
+	conversation.SystemPrompt = prompt
+	return conversation, nil
+}
+
+func (r *gormRepository) SaveSummary(ctx context.Context, owner Owner, id uint, summary string, throughID uint) error {
+	conversation, err := r.GetConversation(ctx, owner, id)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Model(conversation).UpdateColumns(map[string]interface{}{
+		"summary":            summary,
+		"summarized_through": throughID,
+	}).Error
+}
+
+func (r *gormRepository) DeleteConversation(ctx context.Context, owner Owner, id uint) error {
+	conversation, err := r.GetConversation(ctx, owner, id)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&dbmodels.ConversationMessage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(conversation).Error
+	})
+}
+
+func (r *gormRepository) SaveMessages(ctx context.Context, owner Owner, conversationID uint, messages ...dbmodels.ConversationMessage) error {
+	conversation, err := r.GetConversation(ctx, owner, conversationID)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for i := range messages {
+		messages[i].ConversationID = conversation.ID
+		messages[i].TenantID = owner.TenantID
+		messages[i].UserID = owner.UserID
+		if messages[i].CreatedAt.IsZero() {
+			messages[i].CreatedAt = now
+		}
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&messages).Error; err != nil {
+			return err
+		}
+		return tx.Model(conversation).UpdateColumns(map[string]interface{}{
+			"message_count": gorm.Expr("message_count + ?", len(messages)),
+			"updated_at":    now,
+		}).Error
+	})
+}
+
+func (r *gormRepository) ListMessages(ctx context.Context, owner Owner, conversationID uint, page, pageSize int) ([]dbmodels.ConversationMessage, int64, error) {
+	if _, err := r.GetConversation(ctx, owner, conversationID); err != nil {
+		return nil, 0, err
+	}
+	query := r.db.WithContext(ctx).Where("conversation_id = ?", conversationID)
+	var total int64
+	if err := query.Model(&dbmodels.ConversationMessage{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var messages []dbmodels.ConversationMessage
+	err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&messages).Error
+	return messages, total, err
+}
+
+func (r *gormRepository) RecentMessages(ctx context.Context, owner Owner, conversationID uint, limit int) ([]dbmodels.ConversationMessage, error) {
+	if _, err := r.GetConversation(ctx, owner, conversationID); err != nil {
+		return nil, err
+	}
+	var messages []dbmodels.ConversationMessage
+	if err := r.db.WithContext(ctx).Where("conversation_id = ?", conversationID).
+		Order("id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	// 按时间正序返回，便于直接拼接提示词
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (r *gormRepository) ClearMessages(ctx context.Context, owner Owner, conversationID uint) error {
+	conversation, err := r.GetConversation(ctx, owner, conversationID)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&dbmodels.ConversationMessage{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(conversation).UpdateColumns(map[string]interface{}{
+			"message_count":      0,
+			"summary":            "",
+			"summarized_through": 0,
+		}).Error
+	})
+}
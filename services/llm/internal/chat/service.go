@@ -2,93 +2,164 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
-	"time"
+	dbmodels "weave/models"
+	"weave/pkg/llmprovider"
+	"weave/services/llm/internal/config"
 	"weave/services/llm/internal/models"
 
 	"github.com/tmc/langchaingo/llms"
 )
 
+// ErrConversationNotFound 对话不存在或不属于当前用户
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// Owner 对话的所有者，存储库的所有操作都限定在所有者的租户和用户范围内
+type Owner struct {
+	TenantID uint
+	UserID   uint
+}
+
 // 核心接口
 type ChatService interface {
-	// 发送消息并获取响应
-	SendMessage(ctx context.Context, req *models.ChatRequest) (*models.ChatResponse, error)
-	// 获取对话历史记录
-	GetHistory(ctx context.Context) ([]*models.ChatHistory, error)
-	// 清空对话历史记录
-	ClearHistory(ctx context.Context) error
+	// 发送消息并获取响应，未指定对话时创建新对话
+	SendMessage(ctx context.Context, owner Owner, req *models.ChatRequest) (*models.ChatResponse, error)
+	// 获取对话的消息记录
+	GetHistory(ctx context.Context, owner Owner, conversationID uint) ([]dbmodels.ConversationMessage, error)
+	// 清空对话的消息记录
+	ClearHistory(ctx context.Context, owner Owner, conversationID uint) error
 }
 
 // 数据存储层的接口
 type ChatRepository interface {
-	// 保存单条对话记录
-	SaveHistory(history *models.ChatHistory) error
-	// 获取所有对话记录
-	GetHistories() ([]*models.ChatHistory, error)
-	// 清空所有对话记录
-	ClearHistories() error
+	// 创建对话
+	CreateConversation(ctx context.Context, owner Owner, title string) (*dbmodels.Conversation, error)
+	// 分页获取对话列表，按最近活动时间倒序
+	ListConversations(ctx context.Context, owner Owner, page, pageSize int) ([]dbmodels.Conversation, int64, error)
+	// 获取单个对话，不存在或不属于所有者时返回ErrConversationNotFound
+	GetConversation(ctx context.Context, owner Owner, id uint) (*dbmodels.Conversation, error)
+	// 重命名对话
+	RenameConversation(ctx context.Context, owner Owner, id uint, title string) (*dbmodels.Conversation, error)
+	// 设置对话固定的系统提示词，为空时使用默认提示词
+	SetSystemPrompt(ctx context.Context, owner Owner, id uint, prompt string) (*dbmodels.Conversation, error)
+	// 保存对话的滚动摘要，throughID为已并入摘要的最后一条消息ID
+	SaveSummary(ctx context.Context, owner Owner, id uint, summary string, throughID uint) error
+	// 删除对话及其消息
+	DeleteConversation(ctx context.Context, owner Owner, id uint) error
+	// 向对话追加消息
+	SaveMessages(ctx context.Context, owner Owner, conversationID uint, messages ...dbmodels.ConversationMessage) error
+	// 分页获取对话的消息，按时间正序
+	ListMessages(ctx context.Context, owner Owner, conversationID uint, page, pageSize int) ([]dbmodels.ConversationMessage, int64, error)
+	// 获取对话最近的若干条消息，按时间正序
+	RecentMessages(ctx context.Context, owner Owner, conversationID uint, limit int) ([]dbmodels.ConversationMessage, error)
+	// 清空对话的消息和摘要，保留对话本身和系统提示词
+	ClearMessages(ctx context.Context, owner Owner, conversationID uint) error
+}
+
+// 新对话标题的最大长度（字符数）
+const maxTitleLength = 50
+
+// ConversationTitle 根据第一条消息生成对话标题
+func ConversationTitle(message string) string {
+	title := []rune(strings.Join(strings.Fields(message), " "))
+	if len(title) > maxTitleLength {
+		return string(title[:maxTitleLength]) + "..."
+	}
+	return string(title)
 }
 
 // ChatService接口
 type chatService struct {
-	repo ChatRepository // 数据存储层实例
-	llm  llms.LLM       // 语言模型实例
+	repo   ChatRepository // 数据存储层实例
+	llm    llms.LLM       // 语言模型实例
+	window *Window        // 按默认上下文窗口截断历史
 }
 
 // 创建新的聊天服务实例
 func NewChatService(repo ChatRepository, llm llms.LLM) ChatService {
-	return &chatService{repo: repo, llm: llm}
+	return &chatService{repo: repo, llm: llm, window: NewWindow(config.DefaultContextConfig(), llmprovider.Target{})}
 }
 
 // 处理用户消息并返回AI响应
-func (s *chatService) SendMessage(ctx context.Context, req *models.ChatRequest) (*models.ChatResponse, error) {
+func (s *chatService) SendMessage(ctx context.Context, owner Owner, req *models.ChatRequest) (*models.ChatResponse, error) {
 	// 验证消息内容非空
 	if strings.TrimSpace(req.Message) == "" {
 		return nil, fmt.Errorf("消息内容不能为空")
 	}
 
-	// 构建提示词
-	prompt := fmt.Sprintf("You: %s\nPaiChat: ", req.Message)
+	var conversation *dbmodels.Conversation
+	var err error
+	if req.ConversationID == 0 {
+		conversation, err = s.repo.CreateConversation(ctx, owner, ConversationTitle(req.Message))
+	} else {
+		conversation, err = s.repo.GetConversation(ctx, owner, req.ConversationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conversationID := conversation.ID
+
+	// 用对话的系统提示词、摘要和放得进上下文窗口的最近消息构建提示词
+	window := s.window.WithPrompts(ctx, owner.TenantID)
+	recent, err := s.repo.RecentMessages(ctx, owner, conversationID, window.MaxMessages())
+	if err != nil {
+		return nil, err
+	}
+	var history []dbmodels.ConversationMessage
+	for _, msg := range recent {
+		if msg.ID > conversation.SummarizedThrough {
+			history = append(history, msg)
+		}
+	}
+	prompt := window.Prompt(conversation.SystemPrompt, conversation.Summary, history, req.Message)
 
 	// 调用语言模型获取响应
 	response, err := s.llm.Call(ctx, prompt)
 	if err != nil {
 		return &models.ChatResponse{
-			Status: 500,
-			Error:  err.Error(),
+			ConversationID: conversationID,
+			Status:         500,
+			Error:          err.Error(),
 		}, err
 	}
 
 	// 保存对话记录
-	history := &models.ChatHistory{
-		Timestamp:  time.Now(),
-		UserInput:  req.Message,
-		AIResponse: response,
-	}
-	if err := s.repo.SaveHistory(history); err != nil {
+	if err := s.repo.SaveMessages(ctx, owner, conversationID,
+		dbmodels.ConversationMessage{Role: dbmodels.MessageRoleUser, Content: req.Message},
+		dbmodels.ConversationMessage{Role: dbmodels.MessageRoleAssistant, Content: response},
+	); err != nil {
 		return nil, err
 	}
 
 	// 返回成功响应
 	return &models.ChatResponse{
-		Response: response,
-		Status:   200,
+		ConversationID: conversationID,
+		Response:       response,
+		Status:         200,
 	}, nil
 }
 
-// 获取所有对话记录
-func (s *chatService) GetHistory(ctx context.Context) ([]*models.ChatHistory, error) {
-	histories, err := s.repo.GetHistories()
+// 获取对话的所有消息
+func (s *chatService) GetHistory(ctx context.Context, owner Owner, conversationID uint) ([]dbmodels.ConversationMessage, error) {
+	conversation, err := s.repo.GetConversation(ctx, owner, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	messages, _, err := s.repo.ListMessages(ctx, owner, conversationID, 1, conversation.MessageCount+1)
 	if err != nil {
 		return nil, fmt.Errorf("获取历史记录失败: %v", err)
 	}
-	return histories, nil
+	return messages, nil
 }
 
-// 清空所有对话记录
-func (s *chatService) ClearHistory(ctx context.Context) error {
-	if err := s.repo.ClearHistories(); err != nil {
+// 清空对话的消息记录
+func (s *chatService) ClearHistory(ctx context.Context, owner Owner, conversationID uint) error {
+	if err := s.repo.ClearMessages(ctx, owner, conversationID); err != nil {
+		if errors.Is(err, ErrConversationNotFound) {
+			return err
+		}
 		return fmt.Errorf("清空历史记录失败: %v", err)
 	}
 	return nil
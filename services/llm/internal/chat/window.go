@@ -0,0 +1,223 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	dbmodels "weave/models"
+	"weave/pkg/llmprovider"
+	"weave/pkg/prompt"
+	"weave/services/llm/internal/config"
+)
+
+// Tokenizer 估算文本的令牌数
+type Tokenizer func(text string) int
+
+// tokenizerProfile 一类模型的分词粒度：每个令牌平均对应的字符数
+type tokenizerProfile struct {
+	families     []string // 模型名称中包含的系列名称
+	charsPerCJK  float64  // 中日韩字符
+	charsPerText float64  // 其他非空白字符
+}
+
+// tokenizerProfiles 已知模型系列的分词粒度，未匹配的模型按每个中日韩字符一个令牌、其他约4个字符一个令牌估算
+// 针对中文优化的词表会把常见词合并为一个令牌，Llama等英文词表则常把一个汉字拆成多个令牌
+var tokenizerProfiles = []tokenizerProfile{
+	{families: []string{"qwen", "deepseek", "doubao", "glm", "yi-"}, charsPerCJK: 1.4, charsPerText: 4},
+	{families: []string{"gpt-4o", "o1", "o3", "gpt-4.1"}, charsPerCJK: 1.2, charsPerText: 4},
+	{families: []string{"llama", "mistral", "gemma", "phi"}, charsPerCJK: 0.7, charsPerText: 3.5},
+}
+
+// TokenizerFor 返回模型的令牌数估算函数
+func TokenizerFor(model string) Tokenizer {
+	model = strings.ToLower(model)
+	profile := tokenizerProfile{charsPerCJK: 1, charsPerText: 4}
+	for _, candidate := range tokenizerProfiles {
+		for _, family := range candidate.families {
+			if strings.Contains(model, family) {
+				profile = candidate
+				break
+			}
+		}
+	}
+	return func(text string) int {
+		var cjk, other float64
+		for _, r := range text {
+			if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+				cjk++
+			} else if !unicode.IsSpace(r) {
+				other++
+			}
+		}
+		return int(cjk/profile.charsPerCJK+0.999) + int(other/profile.charsPerText+0.999)
+	}
+}
+
+// Window 按模型的上下文窗口组装提示词
+// 系统提示词、摘要和本次输入总是保留，历史消息从最新的开始放入，放不下的较早消息被丢弃或摘要
+type Window struct {
+	strategy         string
+	budget           int // 提示词可用的令牌数：上下文窗口减去为回复预留的令牌数
+	keepRecent       int
+	summaryMaxTokens int
+	maxMessages      int
+	count            Tokenizer
+	defaultSystem    string // 对话未固定系统提示词时使用的系统提示词
+	tenantID         uint   // 解析提示词模板的租户
+	tenantScoped     bool   // 是否按租户解析提示词模板，否则使用内置模板
+}
+
+// NewWindow 按配置创建模型的上下文窗口
+func NewWindow(cfg config.ContextConfig, target llmprovider.Target) *Window {
+	maxTokens := cfg.MaxTokens
+	if n, ok := cfg.ModelMaxTokens[target.String()]; ok {
+		maxTokens = n
+	} else if n, ok := cfg.ModelMaxTokens[target.Model]; ok {
+		maxTokens = n
+	}
+	return &Window{
+		strategy:         cfg.Strategy,
+		budget:           maxTokens - cfg.ReserveTokens,
+		keepRecent:       cfg.KeepRecent,
+		summaryMaxTokens: cfg.SummaryMaxTokens,
+		maxMessages:      cfg.MaxMessages,
+		count:            TokenizerFor(target.Model),
+		defaultSystem:    builtinPrompt(prompt.ChatSystem, nil),
+	}
+}
+
+// builtinPrompt 渲染内置提示词模板，内置模板随代码发布，渲染失败属于编程错误
+func builtinPrompt(name string, vars map[string]interface{}) string {
+	text, err := prompt.RenderBuiltin(name, vars)
+	if err != nil {
+		panic(fmt.Sprintf("内置提示词模板%s渲染失败: %v", name, err))
+	}
+	return text
+}
+
+// WithPrompts 返回按租户的提示词模板组装提示词的窗口副本
+func (w *Window) WithPrompts(ctx context.Context, tenantID uint) *Window {
+	scoped := *w
+	scoped.tenantID, scoped.tenantScoped = tenantID, true
+	if system, err := prompt.Render(ctx, tenantID, prompt.ChatSystem, nil); err != nil {
+		log.Printf("加载系统提示词模板失败: %v", err)
+	} else {
+		scoped.defaultSystem = system
+	}
+	return &scoped
+}
+
+// MaxMessages 返回每次最多加载的历史消息条数
+func (w *Window) MaxMessages() int {
+	return w.maxMessages
+}
+
+// CountTokens 按模型估算文本的令牌数
+func (w *Window) CountTokens(text string) int {
+	return w.count(text)
+}
+
+// fit 返回能放入预算的第一条历史消息的下标，保留的历史总是从用户消息开始
+// 历史全部放得下时返回0，一条也放不下时返回len(history)
+func (w *Window) fit(fixed string, history []dbmodels.ConversationMessage) int {
+	remaining := w.budget - w.count(fixed)
+	start := len(history)
+	for start > 0 {
+		cost := w.count(historyLine(history[start-1]))
+		if cost > remaining {
+			break
+		}
+		remaining -= cost
+		start--
+	}
+	for start < len(history) && history[start].Role != dbmodels.MessageRoleUser {
+		start++
+	}
+	return start
+}
+
+// Prompt 组装提示词：系统提示词、较早对话的摘要、放得进预算的最近消息和本次输入
+// system为空时使用默认提示词
+func (w *Window) Prompt(system, summary string, history []dbmodels.ConversationMessage, input string) string {
+	fixed := w.header(system, summary) + promptInput(input)
+	start := w.fit(fixed, history)
+
+	var text strings.Builder
+	text.WriteString(w.header(system, summary))
+	for _, msg := range history[start:] {
+		text.WriteString(historyLine(msg))
+	}
+	text.WriteString(promptInput(input))
+	return text.String()
+}
+
+// Context 返回提示词中本次输入之前的部分：系统提示词、摘要和放得进预算的历史消息
+func (w *Window) Context(system, summary string, history []dbmodels.ConversationMessage, input string) string {
+	return strings.TrimSuffix(w.Prompt(system, summary, history, input), promptInput(input))
+}
+
+// summaryCut 返回摘要策略下应并入摘要的消息条数，历史放得进预算或策略不是摘要时返回0
+// 超出预算时将最近keepRecent条之前的消息全部并入摘要，避免每轮对话都重新摘要
+func (w *Window) summaryCut(system, summary string, history []dbmodels.ConversationMessage, input string) int {
+	if w.strategy != config.StrategySummarize {
+		return 0
+	}
+	fixed := w.header(system, summary) + promptInput(input)
+	if w.fit(fixed, history) == 0 {
+		return 0
+	}
+	cut := len(history) - w.keepRecent
+	for cut > 0 && cut < len(history) && history[cut].Role != dbmodels.MessageRoleUser {
+		cut++
+	}
+	if cut < 0 {
+		return 0
+	}
+	return cut
+}
+
+// summaryPrompt 构建让模型将已有摘要和较早消息合并为新摘要的提示词
+func (w *Window) summaryPrompt(ctx context.Context, summary string, messages []dbmodels.ConversationMessage) (string, error) {
+	var conversation strings.Builder
+	for _, msg := range messages {
+		conversation.WriteString(historyLine(msg))
+	}
+	vars := map[string]interface{}{
+		"max_tokens":   w.summaryMaxTokens,
+		"summary":      summary,
+		"conversation": conversation.String(),
+	}
+	if !w.tenantScoped {
+		return prompt.RenderBuiltin(prompt.ChatSummary, vars)
+	}
+	return prompt.Render(ctx, w.tenantID, prompt.ChatSummary, vars)
+}
+
+// header 返回提示词开头的系统提示词和摘要，system为空时使用默认系统提示词
+func (w *Window) header(system, summary string) string {
+	if strings.TrimSpace(system) == "" {
+		system = w.defaultSystem
+	}
+	header := strings.TrimRight(system, "\n") + "\n\n"
+	if summary != "" {
+		header += "较早对话的摘要:\n" + summary + "\n\n"
+	}
+	return header
+}
+
+// promptInput 返回提示词结尾的本次输入
+func promptInput(input string) string {
+	return fmt.Sprintf("You: %s\nPaiChat: ", input)
+}
+
+// historyLine 将对话消息转换为提示词中的历史记录行
+func historyLine(msg dbmodels.ConversationMessage) string {
+	speaker := "You"
+	if msg.Role == dbmodels.MessageRoleAssistant {
+		speaker = "PaiChat"
+	}
+	return fmt.Sprintf("%s: %s\n", speaker, msg.Content)
+}
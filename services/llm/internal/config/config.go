@@ -2,22 +2,193 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strconv"
+)
+
+// 上下文窗口管理策略
+const (
+	StrategyTruncate  = "truncate"  // 超出令牌预算时丢弃最早的消息
+	StrategySummarize = "summarize" // 超出令牌预算时由模型将较早的消息滚动摘要
 )
 
 // 配置结构
 type AppConfig struct {
-	ModelName   string  `json:"model_name"`  // 模型名称
-	ServerURL   string  `json:"server_url"`  // 服务端URL
-	Port        int     `json:"port"`        // 服务监听端口
-	MaxHistory  int     `json:"max_history"` // 最大历史记录条数
-	Temperature float64 `json:"temperature"` // 模型生成温度参数
+	ModelName   string        `json:"model_name"`  // 模型名称
+	ServerURL   string        `json:"server_url"`  // 服务端URL
+	Port        int           `json:"port"`        // 服务监听端口
+	MaxHistory  int           `json:"max_history"` // 最大历史记录条数
+	Temperature float64       `json:"temperature"` // 模型生成温度参数
+	Context     ContextConfig `json:"context"`     // 对话历史的上下文窗口管理
+	Agent       AgentConfig   `json:"agent"`       // 工具调用循环的限制
+}
+
+// ContextConfig 对话历史的上下文窗口配置，令牌数均为按模型估算的值
+type ContextConfig struct {
+	Strategy         string         `json:"strategy"`           // truncate或summarize
+	MaxTokens        int            `json:"max_tokens"`         // 模型的上下文窗口大小
+	ModelMaxTokens   map[string]int `json:"model_max_tokens"`   // 按模型覆盖上下文窗口，键为“提供方/模型”或模型名称
+	ReserveTokens    int            `json:"reserve_tokens"`     // 为模型回复预留的令牌数
+	KeepRecent       int            `json:"keep_recent"`        // 摘要时原样保留的最近消息条数
+	SummaryMaxTokens int            `json:"summary_max_tokens"` // 摘要的最大令牌数
+	MaxMessages      int            `json:"max_messages"`       // 每次最多加载的历史消息条数
+}
+
+// AgentConfig 一轮对话中工具调用循环的上限，令牌数包括所有模型调用
+type AgentConfig struct {
+	MaxIterations  int `json:"max_iterations"`   // 最多向模型提供工具的次数
+	MaxToolCalls   int `json:"max_tool_calls"`   // 最多执行的工具调用次数
+	MaxTokens      int `json:"max_tokens"`       // 最多消耗的令牌数
+	MaxResultChars int `json:"max_result_chars"` // 交给模型的单个工具结果的最大字符数
+}
+
+// DefaultAgentConfig 返回默认的工具调用限制
+func DefaultAgentConfig() AgentConfig {
+	return AgentConfig{
+		MaxIterations:  5,
+		MaxToolCalls:   10,
+		MaxTokens:      20000,
+		MaxResultChars: 8000,
+	}
+}
+
+// applyDefaults 用默认值填充未配置的字段
+func (c *AgentConfig) applyDefaults() {
+	defaults := DefaultAgentConfig()
+	if c.MaxIterations <= 0 {
+		c.MaxIterations = defaults.MaxIterations
+	}
+	if c.MaxToolCalls <= 0 {
+		c.MaxToolCalls = defaults.MaxToolCalls
+	}
+	if c.MaxTokens <= 0 {
+		c.MaxTokens = defaults.MaxTokens
+	}
+	if c.MaxResultChars <= 0 {
+		c.MaxResultChars = defaults.MaxResultChars
+	}
+}
+
+// loadAgentEnv 用环境变量覆盖工具调用限制
+func (c *AgentConfig) loadAgentEnv() error {
+	for name, field := range map[string]*int{
+		"LLM_AGENT_MAX_ITERATIONS":   &c.MaxIterations,
+		"LLM_AGENT_MAX_TOOL_CALLS":   &c.MaxToolCalls,
+		"LLM_AGENT_MAX_TOKENS":       &c.MaxTokens,
+		"LLM_AGENT_MAX_RESULT_CHARS": &c.MaxResultChars,
+	} {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("无效的%s: %v", name, err)
+			}
+			*field = n
+		}
+	}
+	return nil
+}
+
+// DefaultContextConfig 返回默认的上下文窗口配置
+func DefaultContextConfig() ContextConfig {
+	return ContextConfig{
+		Strategy:         StrategyTruncate,
+		MaxTokens:        4096,
+		ReserveTokens:    1024,
+		KeepRecent:       6,
+		SummaryMaxTokens: 256,
+		MaxMessages:      50,
+	}
+}
+
+// applyDefaults 用默认值填充未配置的字段
+func (c *ContextConfig) applyDefaults() {
+	defaults := DefaultContextConfig()
+	if c.Strategy == "" {
+		c.Strategy = defaults.Strategy
+	}
+	if c.MaxTokens <= 0 {
+		c.MaxTokens = defaults.MaxTokens
+	}
+	if c.ReserveTokens <= 0 {
+		c.ReserveTokens = defaults.ReserveTokens
+	}
+	if c.KeepRecent <= 0 {
+		c.KeepRecent = defaults.KeepRecent
+	}
+	if c.SummaryMaxTokens <= 0 {
+		c.SummaryMaxTokens = defaults.SummaryMaxTokens
+	}
+	if c.MaxMessages <= 0 {
+		c.MaxMessages = defaults.MaxMessages
+	}
+}
+
+// validate 校验上下文窗口配置
+func (c *ContextConfig) validate() error {
+	if c.Strategy != StrategyTruncate && c.Strategy != StrategySummarize {
+		return fmt.Errorf("未知的上下文窗口策略: %s", c.Strategy)
+	}
+	if c.ReserveTokens >= c.MaxTokens {
+		return fmt.Errorf("预留令牌数(%d)必须小于上下文窗口(%d)", c.ReserveTokens, c.MaxTokens)
+	}
+	for model, maxTokens := range c.ModelMaxTokens {
+		if maxTokens <= c.ReserveTokens {
+			return fmt.Errorf("模型%s的上下文窗口(%d)必须大于预留令牌数(%d)", model, maxTokens, c.ReserveTokens)
+		}
+	}
+	return nil
+}
+
+// loadContextEnv 用环境变量覆盖上下文窗口配置
+func (c *ContextConfig) loadContextEnv() error {
+	if strategy := os.Getenv("LLM_CONTEXT_STRATEGY"); strategy != "" {
+		c.Strategy = strategy
+	}
+	for name, field := range map[string]*int{
+		"LLM_CONTEXT_MAX_TOKENS":         &c.MaxTokens,
+		"LLM_CONTEXT_RESERVE_TOKENS":     &c.ReserveTokens,
+		"LLM_CONTEXT_KEEP_RECENT":        &c.KeepRecent,
+		"LLM_CONTEXT_SUMMARY_MAX_TOKENS": &c.SummaryMaxTokens,
+		"LLM_CONTEXT_MAX_MESSAGES":       &c.MaxMessages,
+	} {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("无效的%s: %v", name, err)
+			}
+			*field = n
+		}
+	}
+	return nil
 }
 
 // 加载应用程序配置
 // 优先从config.json文件读取配置，如果不存在则使用默认值
 // 环境变量可以覆盖配置文件中的值
 func LoadConfig() (*AppConfig, error) {
+	config, err := loadAppConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// 上下文窗口和工具调用配置在两种来源下都支持环境变量覆盖
+	if err := config.Context.loadContextEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.Agent.loadAgentEnv(); err != nil {
+		return nil, err
+	}
+	config.Context.applyDefaults()
+	config.Agent.applyDefaults()
+	if err := config.Context.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// loadAppConfig 读取配置文件或返回默认配置
+func loadAppConfig() (*AppConfig, error) {
 	configFile := "config.json"
 	if _, err := os.Stat(configFile); err == nil {
 		// 读取配置文件内容
@@ -50,5 +221,7 @@ func LoadConfig() (*AppConfig, error) {
 		Port:        11434,
 		MaxHistory:  20,
 		Temperature: 0.7,
+		Context:     DefaultContextConfig(),
+		Agent:       DefaultAgentConfig(),
 	}, nil
 }
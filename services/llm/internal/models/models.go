@@ -1,24 +1,17 @@
 package models
 
-import "time"
-
 // API请求结构
 type ChatRequest struct {
-	Message string `json:"message"`
+	ConversationID uint   `json:"conversation_id"` // 为0时创建新对话
+	Message        string `json:"message"`
 }
 
 // API响应结构
 type ChatResponse struct {
-	Response string `json:"response"`
-	Status   int    `json:"status"`
-	Error    string `json:"error,omitempty"`
-}
-
-// 对话历史记录结构
-type ChatHistory struct {
-	Timestamp  time.Time `json:"timestamp"`
-	UserInput  string    `json:"user_input"`
-	AIResponse string    `json:"ai_response"`
+	ConversationID uint   `json:"conversation_id"`
+	Response       string `json:"response"`
+	Status         int    `json:"status"`
+	Error          string `json:"error,omitempty"`
 }
 
 // Config 可以替代原有的AppConfig
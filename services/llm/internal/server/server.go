@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"errors"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
+	"weave/pkg/llmprovider"
 	"weave/services/llm/internal/chat"
 	"weave/services/llm/internal/models"
 
@@ -62,9 +64,34 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// 独立服务没有用户体系，所有对话都属于匿名所有者，保存在内存中
+var (
+	repo  = chat.NewMemoryRepository()
+	owner = chat.Owner{}
+)
+
+// conversationID 从查询参数conversation_id解析对话ID
+func conversationID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("conversation_id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid conversation_id")
+	}
+	return uint(id), nil
+}
+
+// writeChatError 写入对话相关的错误，对话不存在时返回404
+func writeChatError(w http.ResponseWriter, err error) {
+	if errors.Is(err, chat.ErrConversationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
 // 启动HTTP服务器
 // pool: LLM连接池实例
-func StartWebServer(pool *chat.LLMPool) {
+// target: 使用的提供方和模型
+func StartWebServer(pool *chat.LLMPool, target llmprovider.Target) {
 	// 构建中间件链: XSS防护 -> CORS控制 -> 请求限流
 	handlerChain := xssMiddleware(
 		corsMiddleware(
@@ -82,32 +109,27 @@ func StartWebServer(pool *chat.LLMPool) {
 			return
 		}
 
-		var req struct {
-			Message string `json:"message"`
-		}
+		var req models.ChatRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		chat, err := chat.NewChat(pool)
+		llm, err := pool.Get(target)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Failed to get LLM instance", http.StatusInternalServerError)
 			return
 		}
-		defer chat.Close()
+		defer pool.Put(target, llm)
 
-		prompt := chat.BuildPrompt(req.Message)
-		response, err := chat.GetLLM().Call(context.Background(), prompt)
+		response, err := chat.NewChatService(repo, llm).SendMessage(context.Background(), owner, &req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeChatError(w, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"response": response,
-		})
+		json.NewEncoder(w).Encode(response)
 	})))
 
 	// 获取对话历史记录的HTTP端点
@@ -117,22 +139,24 @@ func StartWebServer(pool *chat.LLMPool) {
 			return
 		}
 
+		id, err := conversationID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// 获取LLM实例
-		llm, err := pool.Get()
+		llm, err := pool.Get(target)
 		if err != nil {
 			http.Error(w, "Failed to get LLM instance", http.StatusInternalServerError)
 			return
 		}
-		defer pool.Put(llm)
-
-		// 创建chat服务实例
-		repo := MemoryRepository()
-		chatService := chat.NewChatService(repo, llm)
+		defer pool.Put(target, llm)
 
 		// 获取历史记录
-		histories, err := chatService.GetHistory(context.Background())
+		histories, err := chat.NewChatService(repo, llm).GetHistory(context.Background(), owner, id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeChatError(w, err)
 			return
 		}
 
@@ -151,21 +175,23 @@ func StartWebServer(pool *chat.LLMPool) {
 			return
 		}
 
+		id, err := conversationID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// 获取LLM实例
-		llm, err := pool.Get()
+		llm, err := pool.Get(target)
 		if err != nil {
 			http.Error(w, "Failed to get LLM instance", http.StatusInternalServerError)
 			return
 		}
-		defer pool.Put(llm)
-
-		// 创建chat服务实例
-		repo := MemoryRepository()
-		chatService := chat.NewChatService(repo, llm)
+		defer pool.Put(target, llm)
 
 		// 清空历史记录
-		if err := chatService.ClearHistory(context.Background()); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := chat.NewChatService(repo, llm).ClearHistory(context.Background(), owner, id); err != nil {
+			writeChatError(w, err)
 			return
 		}
 
@@ -178,9 +204,6 @@ func StartWebServer(pool *chat.LLMPool) {
 		})
 	})))
 
-	// 初始化内存历史记录
-	memoryHistory = make([]*models.ChatHistory, 0)
-
 	fmt.Println("Web server started at http://localhost:8080")
 	// 启动服务器监听8080端口
 	http.ListenAndServe(":8080", handlerChain)
@@ -192,40 +215,3 @@ type APIResponse struct {
 	Data    interface{} `json:"data"`            // 响应数据
 	Error   string      `json:"error,omitempty"` // 错误信息(可选)
 }
-
-// 内存存储库实现
-var (
-	memoryHistory []*models.ChatHistory
-	memoryMutex   sync.RWMutex
-)
-
-// MemoryRepository 内存存储库实现
-// 实现ChatRepository接口
-func MemoryRepository() chat.ChatRepository {
-	return &memoryRepo{}
-}
-
-type memoryRepo struct{}
-
-func (r *memoryRepo) SaveHistory(history *models.ChatHistory) error {
-	memoryMutex.Lock()
-	defer memoryMutex.Unlock()
-	memoryHistory = append(memoryHistory, history)
-	return nil
-}
-
-func (r *memoryRepo) GetHistories() ([]*models.ChatHistory, error) {
-	memoryMutex.RLock()
-	defer memoryMutex.RUnlock()
-	// 返回历史记录的副本
-	histories := make([]*models.ChatHistory, len(memoryHistory))
-	copy(histories, memoryHistory)
-	return histories, nil
-}
-
-func (r *memoryRepo) ClearHistories() error {
-	memoryMutex.Lock()
-	defer memoryMutex.Unlock()
-	memoryHistory = make([]*models.ChatHistory, 0)
-	return nil
-}
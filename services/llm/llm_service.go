@@ -2,23 +2,35 @@ package llm
 
 import (
 	"context"
-	"sync"
-	"time"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	appconfig "weave/config"
+	dbmodels "weave/models"
 	"weave/pkg"
+	"weave/pkg/llmcache"
+	"weave/pkg/llmprovider"
+	"weave/pkg/llmusage"
+	"weave/pkg/quota"
 	"weave/plugins/core"
 	"weave/services/llm/internal/chat"
 	"weave/services/llm/internal/config"
-	"weave/services/llm/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
+	"go.uber.org/zap"
 )
 
 // LLMChatPlugin 实现LLM聊天功能的插件
+// 对话按用户和租户保存在数据库中，所有路由都需要认证
 type LLMChatPlugin struct {
-	pool    *chat.LLMPool
-	manager *core.PluginManager
+	pool     *chat.LLMPool
+	repo     chat.ChatRepository
+	registry *llmprovider.Registry
+	manager  *core.PluginManager
+	agent    config.AgentConfig // 工具调用循环的限制
+	cache    *llmcache.Cache    // 回答缓存，nil表示未启用
 }
 
 // NewLLMChatPlugin 创建LLM聊天插件实例
@@ -26,6 +38,11 @@ func NewLLMChatPlugin() *LLMChatPlugin {
 	return &LLMChatPlugin{}
 }
 
+// SetRegistry 替换LLM提供方注册表，需在Init之前调用，默认按全局LLM配置创建
+func (p *LLMChatPlugin) SetRegistry(registry *llmprovider.Registry) {
+	p.registry = registry
+}
+
 // 基础信息接口实现
 func (p *LLMChatPlugin) Name() string {
 	return "LLMChat"
@@ -51,33 +68,74 @@ func (p *LLMChatPlugin) GetConflicts() []string {
 func (p *LLMChatPlugin) Init() error {
 	pkg.Info("Initializing LLM Chat Plugin...")
 
-	// 初始化LLM连接池
-	p.pool = chat.NewLLMPool(5, func() (llms.LLM, error) {
-		// 加载配置信息
-		appConfig, err := config.LoadConfig()
+	p.repo = chat.NewGormRepository(pkg.DB)
+
+	appConfig, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	p.agent = appConfig.Agent
+
+	if p.registry == nil {
+		registry, err := llmprovider.FromConfig()
 		if err != nil {
-			pkg.Warn("Failed to load LLM config, using defaults")
-			// 使用默认配置
-			appConfig = &config.AppConfig{
-				ModelName:   "deepseek-r1",
-				ServerURL:   "http://localhost:11434",
-				Port:        11434,
-				MaxHistory:  20,
-				Temperature: 0.7,
-			}
+			return err
 		}
+		p.registry = registry
+	}
 
-		// 创建新的LLM实例
-		return ollama.New(
-			ollama.WithModel(appConfig.ModelName),
-			ollama.WithServerURL(appConfig.ServerURL),
-		)
+	// 初始化LLM连接池，每个提供方/模型使用独立的子池
+	registry := p.registry
+	p.pool = chat.NewLLMPool(registry.PoolSize(), func(target llmprovider.Target) (llms.LLM, error) {
+		return registry.New(target)
 	})
 
+	// 回答缓存不可用时不影响对话，只是每次都调用模型
+	cache, err := llmcache.FromConfig(p.cacheEmbedder())
+	if err != nil {
+		pkg.Warn("LLM response cache disabled", zap.Error(err))
+	}
+	p.cache = cache
+
 	pkg.Info("LLM Chat Plugin initialized successfully")
 	return nil
 }
 
+// cacheEmbedder 返回回答缓存匹配相似问题使用的嵌入模型，未配置或模型不支持向量时返回nil
+func (p *LLMChatPlugin) cacheEmbedder() llmcache.Embedder {
+	cfg := appconfig.Config.LLM.Cache
+	if cfg.SimilarityThreshold <= 0 || cfg.EmbeddingModel == "" {
+		return nil
+	}
+	target, err := p.registry.Resolve(cfg.EmbeddingModel)
+	if err != nil {
+		pkg.Warn("Unknown LLM cache embedding model", zap.String("model", cfg.EmbeddingModel), zap.Error(err))
+		return nil
+	}
+	model, err := p.registry.New(target)
+	if err != nil {
+		pkg.Warn("Failed to create LLM cache embedding model", zap.String("model", target.String()), zap.Error(err))
+		return nil
+	}
+	embedder, ok := model.(interface {
+		CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error)
+	})
+	if !ok {
+		pkg.Warn("LLM cache embedding model does not support embeddings", zap.String("model", target.String()))
+		return nil
+	}
+	return func(ctx context.Context, text string) ([]float32, error) {
+		vectors, err := embedder.CreateEmbedding(ctx, []string{text})
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) == 0 {
+			return nil, errors.New("嵌入模型返回空向量")
+		}
+		return vectors[0], nil
+	}
+}
+
 func (p *LLMChatPlugin) Shutdown() error {
 	pkg.Info("Shutting down LLM Chat Plugin...")
 	// 这里可以添加清理资源的代码
@@ -101,24 +159,72 @@ func (p *LLMChatPlugin) GetRoutes() []core.Route {
 			Path:         "api/chat",
 			Method:       "POST",
 			Handler:      p.handleChat,
-			Description:  "发送聊天消息",
-			AuthRequired: false,
+			Description:  "发送聊天消息，未指定conversation_id时创建新对话；use_tools为true时模型可以调用插件和工具",
+			AuthRequired: true,
+			Tags:         []string{"LLM", "Chat"},
+		},
+		{
+			Path:         "api/stream",
+			Method:       "POST",
+			Handler:      p.HandleStream,
+			Description:  "以SSE流式返回聊天回复，也可通过/api/v1/llm/stream访问",
+			AuthRequired: true,
 			Tags:         []string{"LLM", "Chat"},
 		},
 		{
-			Path:         "api/history",
+			Path:         "api/conversations",
 			Method:       "GET",
-			Handler:      p.handleGetHistory,
-			Description:  "获取对话历史",
-			AuthRequired: false,
-			Tags:         []string{"LLM", "History"},
+			Handler:      p.handleListConversations,
+			Description:  "获取对话列表",
+			AuthRequired: true,
+			Tags:         []string{"LLM", "Conversation"},
 		},
 		{
-			Path:         "api/clear-history",
+			Path:         "api/conversations",
 			Method:       "POST",
-			Handler:      p.handleClearHistory,
-			Description:  "清空对话历史",
-			AuthRequired: false,
+			Handler:      p.handleCreateConversation,
+			Description:  "创建对话",
+			AuthRequired: true,
+			Tags:         []string{"LLM", "Conversation"},
+		},
+		{
+			Path:         "api/conversations/:id",
+			Method:       "GET",
+			Handler:      p.handleGetConversation,
+			Description:  "获取对话",
+			AuthRequired: true,
+			Tags:         []string{"LLM", "Conversation"},
+		},
+		{
+			Path:         "api/conversations/:id",
+			Method:       "PUT",
+			Handler:      p.handleUpdateConversation,
+			Description:  "修改对话标题或固定的系统提示词",
+			AuthRequired: true,
+			Tags:         []string{"LLM", "Conversation"},
+		},
+		{
+			Path:         "api/conversations/:id",
+			Method:       "DELETE",
+			Handler:      p.handleDeleteConversation,
+			Description:  "删除对话",
+			AuthRequired: true,
+			Tags:         []string{"LLM", "Conversation"},
+		},
+		{
+			Path:         "api/conversations/:id/messages",
+			Method:       "GET",
+			Handler:      p.handleListMessages,
+			Description:  "获取对话消息",
+			AuthRequired: true,
+			Tags:         []string{"LLM", "History"},
+		},
+		{
+			Path:         "api/conversations/:id/messages",
+			Method:       "DELETE",
+			Handler:      p.handleClearMessages,
+			Description:  "清空对话消息",
+			AuthRequired: true,
 			Tags:         []string{"LLM", "History"},
 		},
 	}
@@ -147,132 +253,463 @@ func (p *LLMChatPlugin) SetPluginManager(manager *core.PluginManager) {
 	p.manager = manager
 }
 
-// HTTP处理函数
-func (p *LLMChatPlugin) handleChat(c *gin.Context) {
+// chatTurn 一轮对话的请求上下文
+type chatTurn struct {
+	owner          chat.Owner
+	conversationID uint // 为0时在保存回复时创建新对话
+	message        string
+	prompt         string
+	context        string               // 提示词中本次输入之前的部分，作为回答缓存的上下文
+	promptTokens   int64                // 按提示词估算的令牌数
+	targets        []llmprovider.Target // 依次尝试的模型，第一个为主模型
+	useTools       bool                 // 是否允许模型调用插件和工具
+	noCache        bool                 // 跳过回答缓存，生成的回答仍会写入缓存
+}
+
+// prepareChat 解析请求、加载对话上下文并校验配额，失败时写入错误响应并返回false
+func (p *LLMChatPlugin) prepareChat(c *gin.Context) (*chatTurn, bool) {
 	var req struct {
-		Message string `json:"message" binding:"required"`
+		ConversationID uint   `json:"conversation_id"`
+		Message        string `json:"message" binding:"required"`
+		Model          string `json:"model"`     // 模型别名或“提供方/模型”，为空时按路由规则选择
+		UseTools       bool   `json:"use_tools"` // 允许模型调用当前用户可用的插件和工具
+		NoCache        bool   `json:"no_cache"`  // 不使用缓存的回答
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
-		return
+		pkg.RespondError(c, pkg.NewValidationError("Invalid chat request", err))
+		return nil, false
+	}
+
+	turn := &chatTurn{owner: conversationOwner(c), conversationID: req.ConversationID, message: req.Message, useTools: req.UseTools, noCache: req.NoCache}
+	ctx := c.Request.Context()
+
+	targets, err := p.registry.Plan(ctx, turn.owner.TenantID, llmprovider.TaskChat, req.Model)
+	if err != nil {
+		if req.Model != "" && errors.Is(err, llmprovider.ErrUnknownModel) {
+			pkg.RespondError(c, pkg.NewValidationError("Unknown model", err).WithDetails(gin.H{"model": req.Model}))
+			return nil, false
+		}
+		pkg.RespondError(c, pkg.NewServiceUnavailable("No LLM model available", err))
+		return nil, false
+	}
+	turn.targets = targets
+
+	session, err := chat.NewChat(p.pool, targets[0])
+	if err != nil {
+		pkg.RespondError(c, pkg.NewServiceUnavailable("Failed to get LLM instance", err))
+		return nil, false
 	}
+	defer session.Close()
+	session.LoadPrompts(ctx, turn.owner.TenantID)
 
-	chat, err := chat.NewChat(p.pool)
+	// 继续已有对话时加载系统提示词、摘要和最近的消息作为上下文
+	if req.ConversationID != 0 {
+		conversation, err := p.repo.GetConversation(ctx, turn.owner, req.ConversationID)
+		if err != nil {
+			pkg.RespondError(c, conversationError("Failed to load conversation", err))
+			return nil, false
+		}
+		recent, err := p.repo.RecentMessages(ctx, turn.owner, req.ConversationID, session.HistoryLimit())
+		if err != nil {
+			pkg.RespondError(c, conversationError("Failed to load messages", err))
+			return nil, false
+		}
+		session.LoadConversation(conversation, recent)
+	}
+	turn.prompt = session.BuildPrompt(req.Message)
+	turn.context = session.PromptContext(req.Message)
+
+	// 按租户计量令牌用量，调用前按提示词估算值校验月度配额
+	turn.promptTokens = quota.EstimateTokens(turn.prompt)
+	if err := quota.CheckUsage(ctx, turn.owner.TenantID, quota.MetricLLMTokens, turn.promptTokens); err != nil && pkg.IsQuotaExceeded(err) {
+		pkg.RespondError(c, err)
+		return nil, false
+	}
+
+	// 历史超出上下文窗口时先摘要较早的消息，摘要失败时按令牌预算截断
+	compacted, err := session.Compact(ctx, req.Message, p.summarizer(turn))
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		pkg.Warn("Failed to summarize conversation history", zap.Uint("conversation_id", req.ConversationID), zap.Error(err))
+	} else if compacted {
+		summary, throughID := session.Summary()
+		if err := p.repo.SaveSummary(ctx, turn.owner, req.ConversationID, summary, throughID); err != nil {
+			pkg.Warn("Failed to save conversation summary", zap.Uint("conversation_id", req.ConversationID), zap.Error(err))
+		}
+		turn.prompt = session.BuildPrompt(req.Message)
+		turn.context = session.PromptContext(req.Message)
+		turn.promptTokens = quota.EstimateTokens(turn.prompt)
+	}
+	return turn, true
+}
+
+// summarizer 返回用本轮对话的模型生成摘要的函数，摘要消耗的令牌计入租户用量
+func (p *LLMChatPlugin) summarizer(turn *chatTurn) chat.Summarizer {
+	return func(ctx context.Context, prompt string, maxTokens int) (string, error) {
+		var resp *llms.ContentResponse
+		target, err := p.registry.Call(ctx, turn.targets, func(ctx context.Context, target llmprovider.Target) error {
+			llm, err := p.pool.Get(target)
+			if err != nil {
+				return err
+			}
+			defer p.pool.Put(target, llm)
+
+			resp, err = llm.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, prompt)},
+				llms.WithMaxTokens(maxTokens))
+			if err == nil && len(resp.Choices) == 0 {
+				err = fmt.Errorf("模型没有返回结果")
+			}
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		p.recordUsage(ctx, turn, llmusage.SourceSummary, target, llmusage.FromResponse(resp, quota.EstimateTokens(prompt), ""))
+		return resp.Choices[0].Content, nil
+	}
+}
+
+// recordUsage 记录一次模型调用消耗的令牌：按租户累计月度用量，并按用户和模型保存用量记录
+func (p *LLMChatPlugin) recordUsage(ctx context.Context, turn *chatTurn, source string, target llmprovider.Target, tokens llmusage.Tokens) {
+	if err := quota.Record(ctx, turn.owner.TenantID, quota.MetricLLMTokens, p.Name(), tokens.Total()); err != nil {
+		pkg.Warn("Failed to record LLM token usage: " + err.Error())
+	}
+	entry := llmusage.Entry{TenantID: turn.owner.TenantID, UserID: turn.owner.UserID, Source: source, Target: target, Tokens: tokens}
+	if err := llmusage.Record(ctx, entry); err != nil {
+		pkg.Warn("Failed to save LLM usage record", zap.String("model", target.String()), zap.Error(err))
+	}
+}
+
+// cacheLookup 按租户、主模型和对话上下文查询本轮问题的缓存回答，请求跳过缓存时返回未命中
+func (p *LLMChatPlugin) cacheLookup(ctx context.Context, turn *chatTurn) *llmcache.Result {
+	req := llmcache.Request{
+		TenantID: turn.owner.TenantID,
+		Kind:     llmcache.KindChat,
+		Model:    turn.targets[0].String(),
+		Context:  turn.context,
+		Question: turn.message,
+	}
+	if turn.noCache {
+		// 不查询缓存，但保留缓存键以便保存新生成的回答
+		return p.cache.Skip(req)
+	}
+	return p.cache.Lookup(ctx, req)
+}
+
+// saveTurn 保存用户消息和模型回复，返回所在对话的ID
+// 新对话在模型成功响应后才创建，避免留下空对话
+func (p *LLMChatPlugin) saveTurn(ctx context.Context, turn *chatTurn, response string) (uint, *pkg.AppError) {
+	conversationID := turn.conversationID
+	if conversationID == 0 {
+		conversation, err := p.repo.CreateConversation(ctx, turn.owner, chat.ConversationTitle(turn.message))
+		if err != nil {
+			return 0, pkg.NewDatabaseError("Failed to create conversation", err)
+		}
+		conversationID = conversation.ID
+	}
+
+	if err := p.repo.SaveMessages(ctx, turn.owner, conversationID,
+		dbmodels.ConversationMessage{Role: dbmodels.MessageRoleUser, Content: turn.message},
+		dbmodels.ConversationMessage{Role: dbmodels.MessageRoleAssistant, Content: response},
+	); err != nil {
+		return 0, conversationError("Failed to save messages", err)
+	}
+	return conversationID, nil
+}
+
+// HTTP处理函数
+func (p *LLMChatPlugin) handleChat(c *gin.Context) {
+	turn, ok := p.prepareChat(c)
+	if !ok {
 		return
 	}
-	defer chat.Close()
+	if turn.useTools {
+		p.handleAgentChat(c, turn)
+		return
+	}
+	ctx := c.Request.Context()
+
+	// 同一上下文中重复的问题直接返回缓存的回答，不调用模型也不消耗令牌
+	cached := p.cacheLookup(ctx, turn)
+	if cached.Hit() {
+		conversationID, appErr := p.saveTurn(ctx, turn, cached.Response)
+		if appErr != nil {
+			pkg.RespondError(c, appErr)
+			return
+		}
+		c.JSON(200, gin.H{
+			"conversation_id": conversationID,
+			"response":        cached.Response,
+			"model":           cached.Model,
+			"usage":           StreamUsage{},
+			"cached":          true,
+		})
+		return
+	}
+
+	// 主模型出错或超时后改用备用模型
+	var resp *llms.ContentResponse
+	target, err := p.registry.Call(ctx, turn.targets, func(ctx context.Context, target llmprovider.Target) error {
+		llm, err := p.pool.Get(target)
+		if err != nil {
+			return err
+		}
+		defer p.pool.Put(target, llm)
 
-	prompt := chat.BuildPrompt(req.Message)
-	response, err := chat.GetLLM().Call(context.Background(), prompt)
+		resp, err = llm.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, turn.prompt)})
+		if err == nil && len(resp.Choices) == 0 {
+			err = fmt.Errorf("模型没有返回结果")
+		}
+		return err
+	})
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		pkg.RespondError(c, llmError(ctx, err))
 		return
 	}
+	response := resp.Choices[0].Content
+	usage := llmusage.FromResponse(resp, turn.promptTokens, "")
+	p.recordUsage(ctx, turn, llmusage.SourceChat, target, usage)
+	p.cache.Save(ctx, cached, response, target.String())
 
 	// 保存对话历史
-	historyRepo := NewMemoryRepository()
-	history := &models.ChatHistory{
-		UserInput:  req.Message,
-		AIResponse: response,
-		Timestamp:  time.Now(),
+	conversationID, appErr := p.saveTurn(ctx, turn, response)
+	if appErr != nil {
+		pkg.RespondError(c, appErr)
+		return
 	}
-	historyRepo.SaveHistory(history)
 
 	c.JSON(200, gin.H{
-		"response": response,
+		"conversation_id": conversationID,
+		"response":        response,
+		"model":           target.String(),
+		"usage":           streamUsageOf(usage),
+		"cached":          false,
 	})
 }
 
-func (p *LLMChatPlugin) handleGetHistory(c *gin.Context) {
-	// 获取LLM实例
-	llm, err := p.pool.Get()
+// handleAgentChat 允许模型调用插件和工具，只保存用户消息和最终回复，工具调用记录在工具使用历史中
+func (p *LLMChatPlugin) handleAgentChat(c *gin.Context, turn *chatTurn) {
+	ctx := c.Request.Context()
+	tools, err := p.agentTools(c, turn.owner)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to get LLM instance"})
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load tools", err))
 		return
 	}
-	defer p.pool.Put(llm)
 
-	// 创建chat服务实例
-	repo := NewMemoryRepository()
-	chatService := chat.NewChatService(repo, llm)
+	// 每次模型调用的用量在工具调用循环中记录，失败前已完成的调用同样计入
+	result, err := p.runAgent(c, turn, tools)
+	if err != nil {
+		pkg.RespondError(c, llmError(ctx, err))
+		return
+	}
+
+	conversationID, appErr := p.saveTurn(ctx, turn, result.response)
+	if appErr != nil {
+		pkg.RespondError(c, appErr)
+		return
+	}
+
+	calls := result.calls
+	if calls == nil {
+		calls = []ToolCallRecord{}
+	}
+	c.JSON(200, gin.H{
+		"conversation_id": conversationID,
+		"response":        result.response,
+		"model":           result.target.String(),
+		"tool_calls":      calls,
+		"total_tokens":    result.tokens,
+	})
+}
+
+// llmError 将模型调用失败转换为应用错误，超时返回408，其他失败返回503
+func llmError(ctx context.Context, err error) *pkg.AppError {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return pkg.NewRequestTimeout("Request timeout", err)
+	}
+	return pkg.NewServiceUnavailable("LLM request failed", err)
+}
 
-	// 获取历史记录
-	histories, err := chatService.GetHistory(context.Background())
+// handleListConversations 分页获取当前用户的对话列表
+func (p *LLMChatPlugin) handleListConversations(c *gin.Context) {
+	page, pageSize := pagination(c)
+	conversations, total, err := p.repo.ListConversations(c.Request.Context(), conversationOwner(c), page, pageSize)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load conversations", err))
 		return
 	}
 
-	// 返回成功响应
 	c.JSON(200, gin.H{
-		"success": true,
-		"data":    histories,
-		"error":   "",
+		"conversations": conversations,
+		"total":         total,
+		"page":          page,
+		"page_size":     pageSize,
 	})
 }
 
-func (p *LLMChatPlugin) handleClearHistory(c *gin.Context) {
-	// 获取LLM实例
-	llm, err := p.pool.Get()
+// handleCreateConversation 创建空对话，可以同时固定系统提示词
+func (p *LLMChatPlugin) handleCreateConversation(c *gin.Context) {
+	var req struct {
+		Title        string `json:"title" binding:"required,max=255"`
+		SystemPrompt string `json:"system_prompt" binding:"max=4000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid conversation data", err))
+		return
+	}
+
+	ctx, owner := c.Request.Context(), conversationOwner(c)
+	conversation, err := p.repo.CreateConversation(ctx, owner, strings.TrimSpace(req.Title))
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to get LLM instance"})
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to create conversation", err))
 		return
 	}
-	defer p.pool.Put(llm)
+	if prompt := strings.TrimSpace(req.SystemPrompt); prompt != "" {
+		conversation, err = p.repo.SetSystemPrompt(ctx, owner, conversation.ID, prompt)
+		if err != nil {
+			pkg.RespondError(c, conversationError("Failed to update conversation", err))
+			return
+		}
+	}
+	c.JSON(201, conversation)
+}
 
-	// 创建chat服务实例
-	repo := NewMemoryRepository()
-	chatService := chat.NewChatService(repo, llm)
+// handleGetConversation 获取单个对话
+func (p *LLMChatPlugin) handleGetConversation(c *gin.Context) {
+	id, ok := conversationID(c)
+	if !ok {
+		return
+	}
+	conversation, err := p.repo.GetConversation(c.Request.Context(), conversationOwner(c), id)
+	if err != nil {
+		pkg.RespondError(c, conversationError("Failed to load conversation", err))
+		return
+	}
+	c.JSON(200, conversation)
+}
 
-	// 清空历史记录
-	if err := chatService.ClearHistory(context.Background()); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+// handleUpdateConversation 修改对话标题或固定的系统提示词，未提供的字段保持不变
+// system_prompt为空字符串时恢复默认提示词
+func (p *LLMChatPlugin) handleUpdateConversation(c *gin.Context) {
+	id, ok := conversationID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title        *string `json:"title" binding:"omitempty,min=1,max=255"`
+		SystemPrompt *string `json:"system_prompt" binding:"omitempty,max=4000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid conversation data", err))
+		return
+	}
+	if req.Title == nil && req.SystemPrompt == nil {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid conversation data", errors.New("title or system_prompt is required")))
+		return
+	}
+
+	ctx, owner := c.Request.Context(), conversationOwner(c)
+	conversation, err := p.repo.GetConversation(ctx, owner, id)
+	if err != nil {
+		pkg.RespondError(c, conversationError("Failed to load conversation", err))
+		return
+	}
+	if req.Title != nil {
+		conversation, err = p.repo.RenameConversation(ctx, owner, id, strings.TrimSpace(*req.Title))
+		if err != nil {
+			pkg.RespondError(c, conversationError("Failed to rename conversation", err))
+			return
+		}
+	}
+	if req.SystemPrompt != nil {
+		conversation, err = p.repo.SetSystemPrompt(ctx, owner, id, strings.TrimSpace(*req.SystemPrompt))
+		if err != nil {
+			pkg.RespondError(c, conversationError("Failed to update conversation", err))
+			return
+		}
+	}
+	c.JSON(200, conversation)
+}
+
+// handleDeleteConversation 删除对话及其消息
+func (p *LLMChatPlugin) handleDeleteConversation(c *gin.Context) {
+	id, ok := conversationID(c)
+	if !ok {
+		return
+	}
+	if err := p.repo.DeleteConversation(c.Request.Context(), conversationOwner(c), id); err != nil {
+		pkg.RespondError(c, conversationError("Failed to delete conversation", err))
+		return
+	}
+	c.JSON(200, gin.H{"message": "Conversation deleted successfully"})
+}
+
+// handleListMessages 分页获取对话的消息
+func (p *LLMChatPlugin) handleListMessages(c *gin.Context) {
+	id, ok := conversationID(c)
+	if !ok {
+		return
+	}
+	page, pageSize := pagination(c)
+	messages, total, err := p.repo.ListMessages(c.Request.Context(), conversationOwner(c), id, page, pageSize)
+	if err != nil {
+		pkg.RespondError(c, conversationError("Failed to load messages", err))
 		return
 	}
 
-	// 返回成功响应
 	c.JSON(200, gin.H{
-		"success": true,
-		"data":    nil,
-		"error":   "",
+		"messages":  messages,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
 	})
 }
 
-// 内存存储库实现
-var (
-	memoryHistory []*models.ChatHistory
-	memoryMutex   sync.RWMutex
-)
-
-// NewMemoryRepository 创建内存存储库实例
-func NewMemoryRepository() chat.ChatRepository {
-	return &memoryRepo{}
+// handleClearMessages 清空对话的消息，保留对话本身
+func (p *LLMChatPlugin) handleClearMessages(c *gin.Context) {
+	id, ok := conversationID(c)
+	if !ok {
+		return
+	}
+	if err := p.repo.ClearMessages(c.Request.Context(), conversationOwner(c), id); err != nil {
+		pkg.RespondError(c, conversationError("Failed to clear messages", err))
+		return
+	}
+	c.JSON(200, gin.H{"message": "Messages cleared successfully"})
 }
 
-type memoryRepo struct{}
+// conversationOwner 返回当前认证用户作为对话所有者
+func conversationOwner(c *gin.Context) chat.Owner {
+	return chat.Owner{TenantID: c.GetUint("tenant_id"), UserID: c.GetUint("user_id")}
+}
 
-func (r *memoryRepo) SaveHistory(history *models.ChatHistory) error {
-	memoryMutex.Lock()
-	defer memoryMutex.Unlock()
-	memoryHistory = append(memoryHistory, history)
-	return nil
+// conversationID 解析路径中的对话ID，无效时写入错误响应并返回false
+func conversationID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		pkg.RespondError(c, pkg.NewBadRequest("Invalid conversation ID", err))
+		return 0, false
+	}
+	return uint(id), true
 }
 
-func (r *memoryRepo) GetHistories() ([]*models.ChatHistory, error) {
-	memoryMutex.RLock()
-	defer memoryMutex.RUnlock()
-	// 返回历史记录的副本
-	histories := make([]*models.ChatHistory, len(memoryHistory))
-	copy(histories, memoryHistory)
-	return histories, nil
+// conversationError 对话不存在时返回404，其他错误按数据库错误处理
+func conversationError(message string, err error) *pkg.AppError {
+	if errors.Is(err, chat.ErrConversationNotFound) {
+		return pkg.NewNotFoundError("Conversation not found", err)
+	}
+	return pkg.NewDatabaseError(message, err)
 }
 
-func (r *memoryRepo) ClearHistories() error {
-	memoryMutex.Lock()
-	defer memoryMutex.Unlock()
-	memoryHistory = make([]*models.ChatHistory, 0)
-	return nil
+// pagination 解析分页参数，page_size默认20，最大100
+func pagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
 }
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/llmusage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+)
+
+// 流式响应的SSE事件名
+const (
+	StreamEventToken = "token" // 模型生成的片段：{"content": "..."}
+	StreamEventDone  = "done"  // 生成结束：StreamDone
+	StreamEventError = "error" // 生成失败：problem+json结构
+)
+
+// StreamUsage 本轮对话的令牌用量
+type StreamUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	Estimated        bool  `json:"estimated"` // 模型没有返回用量时按文本长度估算
+}
+
+// StreamDone done事件的数据
+type StreamDone struct {
+	ConversationID uint        `json:"conversation_id"`
+	Model          string      `json:"model"` // 实际生成回复的提供方/模型
+	Usage          StreamUsage `json:"usage"`
+	LatencyMs      int64       `json:"latency_ms"`     // 从收到请求到生成结束的耗时
+	FirstTokenMs   int64       `json:"first_token_ms"` // 从收到请求到第一个片段的耗时
+	Cached         bool        `json:"cached"`         // 回答来自缓存，没有调用模型
+}
+
+// HandleStream 以Server-Sent Events流式返回模型回复
+// 开始推送前的错误以普通的problem+json响应返回；开始推送后依次发送token事件，
+// 结束时发送done事件，失败时发送error事件。客户端断开连接或请求超时会取消生成，未完成的回复不保存。
+// 主模型在推送第一个片段之前出错或超时会改用备用模型，开始推送后不再切换；流式响应不支持工具调用
+func (p *LLMChatPlugin) HandleStream(c *gin.Context) {
+	start := time.Now()
+	turn, ok := p.prepareChat(c)
+	if !ok {
+		return
+	}
+	if turn.useTools {
+		pkg.RespondError(c, pkg.NewBadRequest("Tool calling is not supported for streaming", nil))
+		return
+	}
+	ctx := c.Request.Context()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止反向代理缓冲
+	c.Status(200)
+	c.Writer.Flush()
+
+	// 命中缓存时一次性推送缓存的回答
+	cached := p.cacheLookup(ctx, turn)
+	if cached.Hit() {
+		c.SSEvent(StreamEventToken, gin.H{"content": cached.Response})
+		firstToken := time.Since(start)
+		conversationID, appErr := p.saveTurn(ctx, turn, cached.Response)
+		if appErr != nil {
+			c.SSEvent(StreamEventError, pkg.NewProblem(c, appErr))
+			c.Writer.Flush()
+			return
+		}
+		c.SSEvent(StreamEventDone, StreamDone{
+			ConversationID: conversationID,
+			Model:          cached.Model,
+			LatencyMs:      time.Since(start).Milliseconds(),
+			FirstTokenMs:   firstToken.Milliseconds(),
+			Cached:         true,
+		})
+		c.Writer.Flush()
+		return
+	}
+
+	var completion []byte
+	var firstToken time.Duration
+	var resp *llms.ContentResponse
+	target, err := p.registry.Call(ctx, turn.targets, func(ctx context.Context, target llmprovider.Target) error {
+		llm, err := p.pool.Get(target)
+		if err != nil {
+			return err
+		}
+		defer p.pool.Put(target, llm)
+
+		resp, err = llm.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, turn.prompt)},
+			llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if len(completion) == 0 {
+					firstToken = time.Since(start)
+				}
+				completion = append(completion, chunk...)
+				c.SSEvent(StreamEventToken, gin.H{"content": string(chunk)})
+				c.Writer.Flush()
+				return nil
+			}),
+		)
+		if err != nil && len(completion) > 0 {
+			// 客户端已经收到部分回复，改用备用模型会重复输出
+			return llmprovider.Permanent(err)
+		}
+		return err
+	})
+
+	tokens := llmusage.FromResponse(resp, turn.promptTokens, string(completion))
+	usage := streamUsageOf(tokens)
+	if err != nil {
+		// 已经生成的部分同样消耗令牌
+		p.recordUsage(context.WithoutCancel(ctx), turn, llmusage.SourceStream, target, tokens)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			pkg.Info("LLM stream cancelled by client", zap.Uint("user_id", turn.owner.UserID), zap.Int("completion_bytes", len(completion)))
+			return
+		}
+		c.SSEvent(StreamEventError, pkg.NewProblem(c, llmError(ctx, err)))
+		c.Writer.Flush()
+		return
+	}
+	p.recordUsage(ctx, turn, llmusage.SourceStream, target, tokens)
+
+	response := string(completion)
+	if response == "" && len(resp.Choices) > 0 {
+		// 不支持流式输出的模型只在结束时返回完整内容
+		response = resp.Choices[0].Content
+		firstToken = time.Since(start)
+		c.SSEvent(StreamEventToken, gin.H{"content": response})
+	}
+
+	p.cache.Save(ctx, cached, response, target.String())
+
+	conversationID, appErr := p.saveTurn(ctx, turn, response)
+	if appErr != nil {
+		c.SSEvent(StreamEventError, pkg.NewProblem(c, appErr))
+		c.Writer.Flush()
+		return
+	}
+
+	c.SSEvent(StreamEventDone, StreamDone{
+		ConversationID: conversationID,
+		Model:          target.String(),
+		Usage:          usage,
+		LatencyMs:      time.Since(start).Milliseconds(),
+		FirstTokenMs:   firstToken.Milliseconds(),
+	})
+	c.Writer.Flush()
+}
+
+// streamUsageOf 将令牌数转换为响应中的用量
+func streamUsageOf(tokens llmusage.Tokens) StreamUsage {
+	return StreamUsage{
+		PromptTokens:     tokens.Prompt,
+		CompletionTokens: tokens.Completion,
+		TotalTokens:      tokens.Total(),
+		Estimated:        tokens.Estimated,
+	}
+}
@@ -0,0 +1,24 @@
+package knowledgeindexing
+
+import "context"
+
+// Document 通过上传接口索引的文档信息，随上下文传给索引节点
+type Document struct {
+	DocumentID uint
+	TenantID   uint
+	Collection string
+	Title      string // 切片没有标题时使用的文档标题
+}
+
+type documentKey struct{}
+
+// WithDocument 返回带文档信息的上下文，用于调用索引图
+func WithDocument(ctx context.Context, doc Document) context.Context {
+	return context.WithValue(ctx, documentKey{}, doc)
+}
+
+// DocumentFromContext 返回上下文中的文档信息
+func DocumentFromContext(ctx context.Context) (Document, bool) {
+	doc, ok := ctx.Value(documentKey{}).(Document)
+	return doc, ok
+}
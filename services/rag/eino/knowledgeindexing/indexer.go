@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 
 	"github.com/cloudwego/eino-ext/components/indexer/redis"
@@ -16,17 +15,17 @@ import (
 	redispkg "weave/services/rag/pkg/redis"
 )
 
-func init() {
-	err := redispkg.Init()
-	if err != nil {
-		log.Fatalf("failed to init redis index: %v", err)
-	}
-}
-
 // newIndexer component initialization function of node 'RedisIndexer' in graph 'KnowledgeIndexing'
 func newIndexer(ctx context.Context) (idr indexer.Indexer, err error) {
-	// TODO Modify component configuration here.
+	// 创建向量索引，索引已存在时补充缺少的字段
+	if err := redispkg.Init(); err != nil {
+		return nil, fmt.Errorf("failed to init redis index: %w", err)
+	}
+
 	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
 	redisClient := redisCli.NewClient(&redisCli.Options{
 		Addr:     redisAddr,
 		Protocol: 2,
@@ -37,6 +36,20 @@ func newIndexer(ctx context.Context) (idr indexer.Indexer, err error) {
 		KeyPrefix: redispkg.RedisPrefix,
 		BatchSize: 1,
 		DocumentToHashes: func(ctx context.Context, doc *schema.Document) (*redis.Hashes, error) {
+			// 通过上传接口索引的文档带有文档信息，切片ID以文档ID开头，元数据记录租户和集合
+			tenant, collection := redispkg.SharedTenant, redispkg.DefaultCollection
+			if info, ok := DocumentFromContext(ctx); ok {
+				tenant, collection = fmt.Sprint(info.TenantID), info.Collection
+				doc.ID = fmt.Sprintf("%d:%s", info.DocumentID, uuid.New().String())
+				if doc.MetaData == nil {
+					doc.MetaData = map[string]any{}
+				}
+				doc.MetaData["document_id"] = info.DocumentID
+				doc.MetaData["collection"] = info.Collection
+				if _, ok := doc.MetaData["title"]; !ok && info.Title != "" {
+					doc.MetaData["title"] = info.Title
+				}
+			}
 			if doc.ID == "" {
 				doc.ID = uuid.New().String()
 			}
@@ -50,8 +63,10 @@ func newIndexer(ctx context.Context) (idr indexer.Indexer, err error) {
 			return &redis.Hashes{
 				Key: key,
 				Field2Value: map[string]redis.FieldValue{
-					redispkg.ContentField:  {Value: doc.Content, EmbedKey: redispkg.VectorField},
-					redispkg.MetadataField: {Value: metadataBytes},
+					redispkg.ContentField:    {Value: doc.Content, EmbedKey: redispkg.VectorField},
+					redispkg.MetadataField:   {Value: metadataBytes},
+					redispkg.TenantField:     {Value: tenant},
+					redispkg.CollectionField: {Value: collection},
 				},
 			}, nil
 		},
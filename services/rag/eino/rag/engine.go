@@ -0,0 +1,192 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"weave/services/rag/eino/knowledgeindexing"
+	redispkg "weave/services/rag/pkg/redis"
+	"weave/services/rag/ragplugin"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/document"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/compose"
+)
+
+// snippetRunes 引用文档摘要的最大字符数
+const snippetRunes = 300
+
+// Engine 把RAG系统适配为知识库问答插件的引擎，并用知识库索引图索引上传的文档
+type Engine struct {
+	rag      *RAG
+	embedder embedding.Embedder
+
+	indexingMu sync.Mutex
+	indexing   compose.Runnable[document.Source, []string] // 首次索引文档时创建
+}
+
+// NewEngine 按环境变量和LLM配置创建使用Redis检索的问答引擎，可以作为ragplugin.Factory
+func NewEngine(ctx context.Context) (ragplugin.Engine, error) {
+	// 检索按租户和集合过滤，先为旧版本创建的索引补充这两个字段
+	if err := redispkg.Init(); err != nil {
+		return nil, fmt.Errorf("初始化Redis索引失败: %w", err)
+	}
+	embedder, err := newEmbedding(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("创建嵌入模型失败: %w", err)
+	}
+	rag, err := buildRAG(ctx, embedder, true, 3)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{rag: rag, embedder: embedder}, nil
+}
+
+// Ask 回答问题，检索到的文档作为引用返回
+func (e *Engine) Ask(ctx context.Context, query ragplugin.Query) (*ragplugin.Answer, error) {
+	if query.Collection != "" {
+		ctx = WithCollection(ctx, query.Collection)
+	}
+	result, err := e.rag.Ask(ctx, query.Question, query.TopK)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]ragplugin.Source, 0, len(result.Documents))
+	for _, doc := range result.Documents {
+		metadata := make(map[string]interface{}, len(doc.MetaData))
+		for key, value := range doc.MetaData {
+			// 文件加载器记录的临时文件信息以下划线开头，不返回给调用方
+			if key != "score" && key != "title" && !strings.HasPrefix(key, "_") {
+				metadata[key] = value
+			}
+		}
+		sources = append(sources, ragplugin.Source{
+			ID:       doc.ID,
+			Title:    docTitle(doc),
+			Score:    docScore(doc),
+			Snippet:  snippet(doc.Content, snippetRunes),
+			Metadata: metadata,
+		})
+	}
+	return &ragplugin.Answer{Answer: result.Answer, Sources: sources, Cached: result.Cached}, nil
+}
+
+// Check 检查Redis向量库和嵌入模型
+func (e *Engine) Check(ctx context.Context) []ragplugin.Dependency {
+	var dependencies []ragplugin.Dependency
+	if retriever, ok := e.rag.retriever.(*RedisRetriever); ok {
+		dependencies = append(dependencies, checkDependency("redis", func() error {
+			return retriever.Ping(ctx)
+		}))
+	}
+	dependencies = append(dependencies, checkDependency("embedding", func() error {
+		vectors, err := e.embedder.EmbedStrings(ctx, []string{"health check"})
+		if err == nil && (len(vectors) == 0 || len(vectors[0]) == 0) {
+			err = fmt.Errorf("嵌入模型返回空向量")
+		}
+		return err
+	}))
+	return dependencies
+}
+
+// Index 把文档写入临时文件后调用知识库索引图，切片带有文档的租户和集合
+// 加载和切分完成后进度分别为10和20，之后按已计算向量的切片数增加
+func (e *Engine) Index(ctx context.Context, doc ragplugin.IndexDocument, progress func(percent int)) ([]string, error) {
+	runner, err := e.indexingRunner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "weave-knowledge-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, fmt.Sprintf("document-%d.md", doc.ID))
+	if err := os.WriteFile(path, []byte(doc.Content), 0o600); err != nil {
+		return nil, fmt.Errorf("写入临时文件失败: %w", err)
+	}
+
+	var mu sync.Mutex
+	chunks, embedded := 0, 0
+	handler := callbacks.NewHandlerBuilder().OnEndFn(func(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+		mu.Lock()
+		defer mu.Unlock()
+		switch info.Component {
+		case components.ComponentOfLoader:
+			progress(10)
+		case components.ComponentOfTransformer:
+			if out := document.ConvTransformerCallbackOutput(output); out != nil {
+				chunks = len(out.Output)
+			}
+			progress(20)
+		case components.ComponentOfEmbedding:
+			embedded++
+			if chunks > 0 {
+				progress(20 + 75*min(embedded, chunks)/chunks)
+			}
+		}
+		return ctx
+	}).Build()
+
+	ctx = knowledgeindexing.WithDocument(ctx, knowledgeindexing.Document{
+		DocumentID: doc.ID,
+		TenantID:   doc.TenantID,
+		Collection: doc.Collection,
+		Title:      doc.Title,
+	})
+	ids, err := runner.Invoke(ctx, document.Source{URI: path}, compose.WithCallbacks(handler))
+	if err != nil {
+		return nil, fmt.Errorf("索引文档失败: %w", err)
+	}
+	return ids, nil
+}
+
+// DeleteChunks 从Redis删除文档切片
+func (e *Engine) DeleteChunks(ctx context.Context, chunkIDs []string) error {
+	retriever, ok := e.rag.retriever.(*RedisRetriever)
+	if !ok {
+		return errors.New("检索器不支持删除文档")
+	}
+	return retriever.Delete(ctx, chunkIDs)
+}
+
+// PurgeAnswers 清除租户的缓存回答
+func (e *Engine) PurgeAnswers(ctx context.Context, tenantID uint) error {
+	return e.rag.cache.Purge(ctx, tenantID)
+}
+
+// indexingRunner 返回知识库索引图，首次调用时创建
+func (e *Engine) indexingRunner(ctx context.Context) (compose.Runnable[document.Source, []string], error) {
+	e.indexingMu.Lock()
+	defer e.indexingMu.Unlock()
+	if e.indexing == nil {
+		runner, err := knowledgeindexing.BuildKnowledgeIndexing(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("创建知识库索引图失败: %w", err)
+		}
+		e.indexing = runner
+	}
+	return e.indexing, nil
+}
+
+// checkDependency 执行一次依赖检查并记录耗时
+func checkDependency(name string, check func() error) ragplugin.Dependency {
+	start := time.Now()
+	dependency := ragplugin.Dependency{Name: name, Healthy: true}
+	if err := check(); err != nil {
+		dependency.Healthy = false
+		dependency.Error = err.Error()
+	}
+	dependency.LatencyMs = time.Since(start).Milliseconds()
+	return dependency
+}
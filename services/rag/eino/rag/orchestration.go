@@ -4,11 +4,21 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"maps"
 	"math"
 	"os"
+	"slices"
+
+	"weave/config"
+	"weave/pkg"
+	"weave/pkg/llmcache"
+	"weave/pkg/llmprovider"
+	"weave/pkg/prompt"
+	"weave/pkg/quota"
 
 	"github.com/cloudwego/eino-ext/components/embedding/ark"
 	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/schema"
 )
 
 // RAG 表示一个检索增强生成系统
@@ -16,6 +26,19 @@ type RAG struct {
 	retriever Retriever
 	generator Generator
 	topK      int
+	cache     *llmcache.Cache // 回答缓存，nil表示未启用
+}
+
+// Result 一次问答的结果
+type Result struct {
+	Answer    string
+	Documents []*schema.Document // 检索到的文档，按相似度排序
+	Cached    bool               // 回答来自回答缓存
+}
+
+// plannedModel 可以报告将要使用的模型的生成器，回答缓存按模型区分不同生成器的回答
+type plannedModel interface {
+	PlannedModel(ctx context.Context) (string, error)
 }
 
 // NewRAG 创建一个新的RAG系统
@@ -27,50 +50,142 @@ func NewRAG(retriever Retriever, generator Generator, topK int) *RAG {
 	}
 }
 
-// Answer 处理问题并生成回答
+// Answer 处理问题并生成回答，打印检索到的文档
 func (r *RAG) Answer(ctx context.Context, query string) (string, error) {
-	// 检索相关文档
-	docs, err := r.retriever.Retrieve(ctx, query, r.topK)
+	result, err := r.Ask(ctx, query, r.topK)
 	if err != nil {
-		return "", fmt.Errorf("检索失败: %w", err)
+		return "", err
 	}
 
 	// 打印检索到的文档
-	fmt.Printf("\n===== 检索到 %d 个相关文档 =====\n", len(docs))
-	for i, doc := range docs {
-		score := 0.0
-		if scoreVal, ok := doc.MetaData["score"]; ok {
-			if s, ok := scoreVal.(float32); ok {
-				score = float64(s)
-			}
-		}
-
-		// 提取标题（如果有）
-		title := "无标题"
-		if titleVal, ok := doc.MetaData["title"]; ok {
-			if t, ok := titleVal.(string); ok && t != "" {
-				title = t
-			}
+	fmt.Printf("\n===== 检索到 %d 个相关文档 =====\n", len(result.Documents))
+	for i, doc := range result.Documents {
+		title := docTitle(doc)
+		if title == "" {
+			title = "无标题"
 		}
-
-		fmt.Printf("\n文档[%d] 相似度: %.4f  标题: %s\n", i+1, score, title)
+		fmt.Printf("\n文档[%d] 相似度: %.4f  标题: %s\n", i+1, docScore(doc), title)
 		fmt.Printf("----------------------------------------\n")
 		// 打印内容摘要（最多显示300个字符）
-		content := doc.Content
-		if len(content) > 300 {
-			content = content[:300] + "..."
-		}
-		fmt.Printf("%s\n", content)
+		fmt.Printf("%s\n", snippet(doc.Content, 300))
 	}
 	fmt.Printf("\n==============================\n\n")
+	if result.Cached {
+		fmt.Printf("命中回答缓存\n")
+	}
+
+	return result.Answer, nil
+}
+
+// Ask 检索topK个相关文档并生成回答，topK不大于0时使用创建时的数量
+func (r *RAG) Ask(ctx context.Context, query string, topK int) (*Result, error) {
+	if topK <= 0 {
+		topK = r.topK
+	}
+	// 检索相关文档
+	docs, err := r.retriever.Retrieve(ctx, query, topK)
+	if err != nil {
+		return nil, fmt.Errorf("检索失败: %w", err)
+	}
+
+	// 同一租户对相同文档提出的重复问题直接返回缓存的回答
+	cached := r.cacheLookup(ctx, query, docs)
+	if cached.Hit() {
+		return &Result{Answer: cached.Response, Documents: docs, Cached: true}, nil
+	}
 
-	// 使用检索到的文档生成回答
+	// 上下文带租户信息时按租户计量令牌用量，生成前按问题和检索文档估算值校验配额
+	promptTokens := quota.EstimateTokens(query)
+	for _, doc := range docs {
+		promptTokens += quota.EstimateTokens(doc.Content)
+	}
+	if err := quota.CheckUsageFromContext(ctx, quota.MetricLLMTokens, promptTokens); err != nil && pkg.IsQuotaExceeded(err) {
+		return nil, err
+	}
+
+	// 使用检索到的文档生成回答，生成器按实际消耗的令牌计量用量
 	answer, err := r.generator.Generate(ctx, query, docs)
 	if err != nil {
-		return "", fmt.Errorf("生成回答失败: %w", err)
+		return nil, fmt.Errorf("生成回答失败: %w", err)
+	}
+	r.cache.Save(ctx, cached, answer, cached.Model)
+
+	return &Result{Answer: answer, Documents: docs}, nil
+}
+
+// docScore 返回文档与问题的相似度，检索器把它记录在元数据的score中
+func docScore(doc *schema.Document) float64 {
+	switch s := doc.MetaData["score"].(type) {
+	case float32:
+		return float64(s)
+	case float64:
+		return s
+	}
+	return 0
+}
+
+// docTitle 返回文档标题，没有标题时返回空字符串
+func docTitle(doc *schema.Document) string {
+	title, _ := doc.MetaData["title"].(string)
+	return title
+}
+
+// snippet 截取文本的前limit个字符
+func snippet(content string, limit int) string {
+	runes := []rune(content)
+	if len(runes) <= limit {
+		return content
 	}
+	return string(runes[:limit]) + "..."
+}
 
-	return answer, nil
+// SetCache 设置回答缓存，nil表示不使用缓存
+func (r *RAG) SetCache(cache *llmcache.Cache) {
+	r.cache = cache
+}
+
+// cacheLookup 按租户、模型、提示词和检索到的文档ID查询问题的缓存回答
+// 上下文没有租户信息或无法确定模型时不使用缓存，避免不同租户共享回答
+func (r *RAG) cacheLookup(ctx context.Context, query string, docs []*schema.Document) *llmcache.Result {
+	tenantID, ok := pkg.TenantIDFromContext(ctx)
+	planner, canPlan := r.generator.(plannedModel)
+	if r.cache == nil || !ok || !canPlan {
+		return &llmcache.Result{Result: llmcache.ResultMiss}
+	}
+	model, err := planner.PlannedModel(ctx)
+	if err != nil {
+		return &llmcache.Result{Result: llmcache.ResultMiss}
+	}
+
+	// 提示词作为上下文，租户启用新的模板版本后之前缓存的回答不再命中
+	promptContext, err := ragPromptContext(ctx, tenantID)
+	if err != nil {
+		return &llmcache.Result{Result: llmcache.ResultMiss}
+	}
+
+	docIDs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		docIDs = append(docIDs, doc.ID)
+	}
+	result := r.cache.Lookup(ctx, llmcache.Request{TenantID: tenantID, Kind: llmcache.KindRAG, Model: model, Context: promptContext, DocIDs: docIDs, Question: query})
+	if !result.Hit() {
+		// 未命中时记录计划使用的模型，保存回答时使用
+		result.Model = model
+	}
+	return result
+}
+
+// ragPromptContext 返回生成回答使用的提示词：渲染后的系统提示词和用户提示词模板
+func ragPromptContext(ctx context.Context, tenantID uint) (string, error) {
+	systemPrompt, err := prompt.Render(ctx, tenantID, prompt.RAGSystem, nil)
+	if err != nil {
+		return "", err
+	}
+	userTemplate, err := prompt.Resolve(ctx, tenantID, prompt.RAGUser)
+	if err != nil {
+		return "", err
+	}
+	return systemPrompt + "\n" + userTemplate.Content, nil
 }
 
 // BuildRAG 构建一个完整的RAG系统
@@ -80,9 +195,14 @@ func BuildRAG(ctx context.Context, useRedis bool, topK int) (*RAG, error) {
 	if err != nil {
 		return nil, fmt.Errorf("创建嵌入模型失败: %w", err)
 	}
+	return buildRAG(ctx, embedder, useRedis, topK)
+}
 
+// buildRAG 使用指定的嵌入模型构建RAG系统
+func buildRAG(ctx context.Context, embedder embedding.Embedder, useRedis bool, topK int) (*RAG, error) {
 	// 创建检索器
 	var retriever Retriever
+	var err error
 	if useRedis {
 		redisAddr := os.Getenv("REDIS_ADDR")
 		if redisAddr == "" {
@@ -96,27 +216,55 @@ func BuildRAG(ctx context.Context, useRedis bool, topK int) (*RAG, error) {
 		retriever = NewNoRetriever()
 	}
 
-	// 创建生成器
+	// 创建生成器，模型按LLM配置中rag任务的路由规则选择
+	registry, err := llmprovider.NewRegistry(ragLLMConfig())
+	if err != nil {
+		return nil, fmt.Errorf("创建LLM提供方注册表失败: %w", err)
+	}
+	generator := NewModelGenerator(registry)
+
+	// 创建RAG系统，回答缓存不可用时每次都调用模型
+	rag := NewRAG(retriever, generator, topK)
+	cache, err := llmcache.FromConfig(cacheEmbedder(embedder))
+	if err != nil {
+		fmt.Printf("回答缓存不可用: %v\n", err)
+	}
+	rag.SetCache(cache)
+	return rag, nil
+}
+
+// ragLLMConfig 返回生成回答使用的LLM配置
+// 兼容只设置了ARK_*环境变量的部署：LLM配置中没有ark提供方时按环境变量注册，并把rag任务路由到它
+func ragLLMConfig() config.LLMConfig {
+	llmConfig := config.Config.LLM
 	apiKey := os.Getenv("ARK_API_KEY")
 	if apiKey == "" {
-		return nil, fmt.Errorf("环境变量ARK_API_KEY未设置")
+		return llmConfig
+	}
+	for _, provider := range llmConfig.Providers {
+		if provider.Name == "ark" {
+			return llmConfig
+		}
 	}
 
 	modelName := os.Getenv("ARK_CHAT_MODEL")
 	if modelName == "" {
 		modelName = "doubao" // 默认使用doubao模型
 	}
-
-	baseURL := os.Getenv("ARK_API_BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://ark.cn-beijing.volces.com/api/v3"
+	llmConfig.Providers = append(slices.Clone(llmConfig.Providers), config.LLMProviderConfig{
+		Name:    "ark",
+		Type:    "ark",
+		BaseURL: os.Getenv("ARK_API_BASE_URL"),
+		APIKey:  apiKey,
+		Model:   modelName,
+	})
+	routes := make(map[string]string, len(llmConfig.Routes)+1)
+	maps.Copy(routes, llmConfig.Routes)
+	if routes[llmprovider.TaskRAG] == "" {
+		routes[llmprovider.TaskRAG] = "ark"
 	}
-
-	generator := NewArkGenerator(baseURL, apiKey, modelName)
-
-	// 创建RAG系统
-	rag := NewRAG(retriever, generator, topK)
-	return rag, nil
+	llmConfig.Routes = routes
+	return llmConfig
 }
 
 // 重用嵌入模型创建函数
@@ -157,6 +305,24 @@ func newEmbedding(ctx context.Context) (eb embedding.Embedder, err error) {
 	return eb, nil
 }
 
+// cacheEmbedder 用检索使用的嵌入模型计算问题向量，供回答缓存匹配相似问题
+func cacheEmbedder(embedder embedding.Embedder) llmcache.Embedder {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		vectors, err := embedder.EmbedStrings(ctx, []string{text})
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) == 0 {
+			return nil, fmt.Errorf("嵌入模型返回空向量")
+		}
+		vector := make([]float32, len(vectors[0]))
+		for i, v := range vectors[0] {
+			vector[i] = float32(v)
+		}
+		return vector, nil
+	}
+}
+
 func vectorToBytes(vector []float64) []byte {
 	// 转换为float32数组
 	float32Vector := make([]float32, len(vector))
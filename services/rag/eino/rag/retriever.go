@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"strings"
+	"unicode"
+
+	"weave/pkg"
 
 	"github.com/cloudwego/eino/components/embedding"
 	"github.com/cloudwego/eino/schema"
@@ -60,8 +64,9 @@ func (r *RedisRetriever) Retrieve(ctx context.Context, query string, topK int) (
 
 	queryVector := queryVectors[0]
 
-	// 构建向量搜索查询
-	searchQuery := fmt.Sprintf("(*)=>[KNN %d @%s $query_vector AS %s]",
+	// 构建向量搜索查询，上下文带租户或集合时只检索对应的文档
+	searchQuery := fmt.Sprintf("(%s)=>[KNN %d @%s $query_vector AS %s]",
+		searchFilter(ctx),
 		topK,
 		redispkg.VectorField,
 		redispkg.DistanceField)
@@ -85,6 +90,53 @@ func (r *RedisRetriever) Retrieve(ctx context.Context, query string, topK int) (
 	return r.parseSearchResults(res)
 }
 
+type collectionKey struct{}
+
+// WithCollection 返回只检索指定集合的上下文
+func WithCollection(ctx context.Context, collection string) context.Context {
+	return context.WithValue(ctx, collectionKey{}, collection)
+}
+
+// searchFilter 返回向量搜索的过滤条件
+// 带租户时只检索该租户和共享的文档，没有租户信息时检索全部文档（如命令行工具）
+func searchFilter(ctx context.Context) string {
+	var filters []string
+	if tenantID, ok := pkg.TenantIDFromContext(ctx); ok {
+		filters = append(filters, fmt.Sprintf("@%s:{%s|%d}", redispkg.TenantField, redispkg.SharedTenant, tenantID))
+	}
+	if collection, _ := ctx.Value(collectionKey{}).(string); collection != "" {
+		filters = append(filters, fmt.Sprintf("@%s:{%s}", redispkg.CollectionField, escapeTag(collection)))
+	}
+	if len(filters) == 0 {
+		return "*"
+	}
+	return strings.Join(filters, " ")
+}
+
+// escapeTag 转义TAG查询中的标点和空白
+func escapeTag(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Delete 删除指定ID的文档切片
+func (r *RedisRetriever) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, r.prefix+id)
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
 // NoRetriever 实现一个不进行检索的空实现
 type NoRetriever struct{}
 
@@ -192,3 +244,8 @@ func (r *RedisRetriever) parseSearchResults(redisResult interface{}) ([]*schema.
 
 	return docs, nil
 }
+
+// Ping 检查Redis连接
+func (r *RedisRetriever) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
@@ -19,6 +19,7 @@ package redis
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 
@@ -33,19 +34,41 @@ const (
 	MetadataField = "metadata"
 	VectorField   = "content_vector"
 	DistanceField = "distance"
+
+	// TenantField 和CollectionField 为TAG字段，检索时按租户和集合过滤
+	TenantField     = "tenant_id"
+	CollectionField = "collection"
+
+	// SharedTenant 没有租户的文档（如命令行索引的文档）对所有租户可见
+	SharedTenant = "0"
+	// DefaultCollection 未指定集合时使用的集合
+	DefaultCollection = "default"
 )
 
-var initOnce sync.Once
+var (
+	initMu   sync.Mutex
+	initDone bool
+)
 
+// Init 创建或更新向量索引，成功后不再重复执行，失败时下次调用重试
 func Init() error {
-	var err error
-	initOnce.Do(func() {
-		err = InitRedisIndex(context.Background(), &Config{
-			RedisAddr: "localhost:6379",
-			Dimension: 4096,
-		})
-	})
-	return err
+	initMu.Lock()
+	defer initMu.Unlock()
+	if initDone {
+		return nil
+	}
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
+	if err := InitRedisIndex(context.Background(), &Config{
+		RedisAddr: redisAddr,
+		Dimension: 4096,
+	}); err != nil {
+		return err
+	}
+	initDone = true
+	return nil
 }
 
 type Config struct {
@@ -84,7 +107,7 @@ func InitRedisIndex(ctx context.Context, config *Config) (err error) {
 		}
 		err = nil
 	} else if exists != nil {
-		return nil
+		return ensureTagFields(ctx, client, indexName)
 	}
 
 	// Create new index
@@ -95,6 +118,8 @@ func InitRedisIndex(ctx context.Context, config *Config) (err error) {
 		"SCHEMA",
 		ContentField, "TEXT",
 		MetadataField, "TEXT",
+		TenantField, "TAG",
+		CollectionField, "TAG",
 		VectorField, "VECTOR", "FLAT",
 		"6",
 		"TYPE", "FLOAT32",
@@ -113,3 +138,14 @@ func InitRedisIndex(ctx context.Context, config *Config) (err error) {
 
 	return nil
 }
+
+// ensureTagFields 为早期创建的索引补充租户和集合字段，字段已存在时忽略
+func ensureTagFields(ctx context.Context, client *redis.Client, indexName string) error {
+	for _, field := range []string{TenantField, CollectionField} {
+		err := client.Do(ctx, "FT.ALTER", indexName, "SCHEMA", "ADD", field, "TAG").Err()
+		if err != nil && !strings.Contains(strings.ToLower(err.Error()), "duplicate") {
+			return fmt.Errorf("failed to add field %s to index: %w", field, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+package ragplugin
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// 支持的文档类型
+const (
+	ContentTypeMarkdown = "markdown"
+	ContentTypeText     = "text"
+	ContentTypeHTML     = "html"
+	ContentTypePDF      = "pdf"
+)
+
+// contentTypeAliases 请求中content_type可以使用的名称和MIME类型
+var contentTypeAliases = map[string]string{
+	"markdown":          ContentTypeMarkdown,
+	"md":                ContentTypeMarkdown,
+	"text/markdown":     ContentTypeMarkdown,
+	"text":              ContentTypeText,
+	"txt":               ContentTypeText,
+	"text/plain":        ContentTypeText,
+	"html":              ContentTypeHTML,
+	"text/html":         ContentTypeHTML,
+	"pdf":               ContentTypePDF,
+	"application/pdf":   ContentTypePDF,
+	"application/x-pdf": ContentTypePDF,
+}
+
+// extensionTypes 按文件扩展名识别文档类型
+var extensionTypes = map[string]string{
+	".md":       ContentTypeMarkdown,
+	".markdown": ContentTypeMarkdown,
+	".txt":      ContentTypeText,
+	".text":     ContentTypeText,
+	".html":     ContentTypeHTML,
+	".htm":      ContentTypeHTML,
+	".pdf":      ContentTypePDF,
+}
+
+var errNoText = errors.New("document has no text content")
+
+// detectContentType 按content_type或文件扩展名确定文档类型
+// 都没有时直接提交的内容按Markdown处理，没有扩展名的文件按纯文本处理
+func detectContentType(contentType, filename string) (string, error) {
+	if contentType != "" {
+		name := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+		if resolved, ok := contentTypeAliases[name]; ok {
+			return resolved, nil
+		}
+		return "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+	if filename == "" {
+		return ContentTypeMarkdown, nil
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		return ContentTypeText, nil
+	}
+	if resolved, ok := extensionTypes[ext]; ok {
+		return resolved, nil
+	}
+	return "", fmt.Errorf("unsupported file extension %q", ext)
+}
+
+// convertDocument 把上传的内容转为Markdown，返回内容和标题
+// 没有指定标题时依次使用HTML的<title>、第一个一级标题和文件名；内容没有一级标题时以标题开头，
+// 使每个切片都带有标题
+func convertDocument(contentType, title, filename string, data []byte) (string, string, error) {
+	var content, detected string
+	switch contentType {
+	case ContentTypePDF:
+		text, err := pdfText(data)
+		if err != nil {
+			return "", "", err
+		}
+		content = text
+	case ContentTypeMarkdown, ContentTypeText, ContentTypeHTML:
+		if !utf8.Valid(data) {
+			return "", "", errors.New("document must be UTF-8 encoded")
+		}
+		content = string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+		if contentType == ContentTypeHTML {
+			content, detected = htmlToMarkdown(content)
+		}
+	default:
+		return "", "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	content = strings.TrimSpace(strings.ReplaceAll(content, "\r\n", "\n"))
+	if content == "" {
+		return "", "", errNoText
+	}
+
+	heading := firstHeading(content)
+	title = strings.TrimSpace(title)
+	for _, candidate := range []string{detected, heading, strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))} {
+		if title == "" && candidate != "" && candidate != "." {
+			title = candidate
+		}
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	title = truncateRunes(strings.Join(strings.Fields(title), " "), 255)
+
+	if heading == "" {
+		content = "# " + title + "\n\n" + content
+	}
+	return content, title, nil
+}
+
+// firstHeading 返回第一个一级标题，没有时返回空字符串
+func firstHeading(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(line[2:])
+		}
+	}
+	return ""
+}
+
+// truncateRunes 截取前limit个字符
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit])
+}
+
+// blankLines 连续的空行
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// htmlToMarkdown 提取HTML的正文，标题转为Markdown标题，列表项转为“- ”开头的行，返回正文和<title>
+func htmlToMarkdown(source string) (string, string) {
+	tokenizer := html.NewTokenizer(strings.NewReader(source))
+	var out, title strings.Builder
+	skip := 0 // 位于script、style等不可见元素内的层数
+	inTitle, inPre := false, false
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.Data {
+			case "script", "style", "noscript", "template", "svg", "head":
+				if tokenType == html.StartTagToken {
+					skip++
+				}
+			case "title":
+				inTitle = true
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				out.WriteString("\n\n" + strings.Repeat("#", int(token.Data[1]-'0')) + " ")
+			case "li":
+				out.WriteString("\n- ")
+			case "br":
+				out.WriteString("\n")
+			case "pre":
+				inPre = true
+				out.WriteString("\n\n")
+			case "td", "th":
+				out.WriteString(" ")
+			case "p", "div", "section", "article", "main", "header", "footer", "table", "tr", "ul", "ol", "blockquote", "hr":
+				out.WriteString("\n\n")
+			}
+		case html.EndTagToken:
+			switch token.Data {
+			case "script", "style", "noscript", "template", "svg", "head":
+				if skip > 0 {
+					skip--
+				}
+			case "title":
+				inTitle = false
+			case "pre":
+				inPre = false
+				out.WriteString("\n\n")
+			case "h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "section", "article", "main", "header", "footer", "table", "tr", "ul", "ol", "blockquote":
+				out.WriteString("\n\n")
+			}
+		case html.TextToken:
+			switch {
+			case inTitle:
+				title.WriteString(token.Data)
+			case skip > 0:
+			case inPre:
+				out.WriteString(token.Data)
+			default:
+				if text := strings.Join(strings.Fields(token.Data), " "); text != "" {
+					// 保留相邻文本之间的空格
+					if strings.TrimLeft(token.Data, " \t\n") != token.Data && !endsWithSpace(&out) {
+						out.WriteString(" ")
+					}
+					out.WriteString(text)
+					if strings.TrimRight(token.Data, " \t\n") != token.Data {
+						out.WriteString(" ")
+					}
+				}
+			}
+		}
+	}
+
+	// 只有<pre>中的行可能以空白开头，保留其缩进
+	lines := strings.Split(out.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	content := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(content), strings.Join(strings.Fields(title.String()), " ")
+}
+
+// endsWithSpace 返回已输出的内容是否以空白结尾
+func endsWithSpace(b *strings.Builder) bool {
+	s := b.String()
+	return s == "" || strings.HasSuffix(s, " ") || strings.HasSuffix(s, "\n")
+}
+
+// pdfStreamStart 匹配流对象内容的开始，第1组为对象的字典
+var pdfStreamStart = regexp.MustCompile(`(?s)\bobj\b(.*?)\bstream\r?\n`)
+
+// pdfText 提取PDF中文本操作符（Tj、TJ、'、"）绘制的文字，支持未压缩和FlateDecode压缩的内容流
+// 扫描件和使用自定义字体编码的PDF无法提取文字，需要先转为文本再上传
+// 所有压缩流解压后的总大小不能超过maxDocumentBytes，避免少量压缩数据膨胀耗尽内存
+func pdfText(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", errors.New("invalid PDF file")
+	}
+
+	var out strings.Builder
+	remaining := int64(maxDocumentBytes)
+	for offset := 0; offset < len(data); {
+		match := pdfStreamStart.FindSubmatchIndex(data[offset:])
+		if match == nil {
+			break
+		}
+		// 匹配可能从前面没有流的对象开始，只保留最后一个对象的字典
+		dict := data[offset+match[2] : offset+match[3]]
+		if i := bytes.LastIndex(dict, []byte("obj")); i >= 0 {
+			dict = dict[i:]
+		}
+		start := offset + match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := data[start : start+end]
+		offset = start + end
+
+		if bytes.Contains(dict, []byte("/Filter")) {
+			if !bytes.Contains(dict, []byte("/FlateDecode")) {
+				continue // 图片等其他编码的流
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			decoded, err := io.ReadAll(io.LimitReader(reader, remaining+1))
+			reader.Close()
+			if int64(len(decoded)) > remaining {
+				return "", errDocumentTooLarge
+			}
+			remaining -= int64(len(decoded))
+			if err != nil && len(decoded) == 0 {
+				continue
+			}
+			stream = decoded
+		}
+		if bytes.Contains(stream, []byte("BT")) {
+			extractPDFText(stream, &out)
+		}
+	}
+
+	text := blankLines.ReplaceAllString(strings.TrimSpace(out.String()), "\n\n")
+	if text == "" {
+		return "", errors.New("PDF has no extractable text")
+	}
+	return text, nil
+}
+
+// extractPDFText 解析内容流中的文本对象，把文字写入out
+func extractPDFText(stream []byte, out *strings.Builder) {
+	var operands []string // 上一个操作符之后的字符串操作数
+	inText := false
+	for i := 0; i < len(stream); {
+		c := stream[i]
+		switch {
+		case c == '(':
+			s, next := pdfLiteralString(stream, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(stream) && stream[i+1] != '<':
+			s, next := pdfHexString(stream, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[' || c == ']':
+			i++
+		case c == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(stream) && (stream[i] == '-' || stream[i] == '.' || (stream[i] >= '0' && stream[i] <= '9')) {
+				i++
+			}
+			// TJ数组中较大的负数间距通常表示单词之间的空格
+			if inText && len(operands) > 0 && i-start > 3 && stream[start] == '-' {
+				operands[len(operands)-1] += " "
+			}
+		case isPDFOperatorChar(c):
+			start := i
+			for i < len(stream) && isPDFOperatorChar(stream[i]) {
+				i++
+			}
+			switch op := string(stream[start:i]); op {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				out.WriteString("\n")
+			case "Tj", "TJ":
+				out.WriteString(strings.Join(operands, ""))
+			case "'", "\"":
+				out.WriteString("\n" + strings.Join(operands, ""))
+			case "T*", "Td", "TD":
+				if inText {
+					out.WriteString("\n")
+				}
+			}
+			operands = operands[:0]
+		default:
+			i++
+		}
+	}
+}
+
+// isPDFOperatorChar 返回字符是否可以组成操作符
+func isPDFOperatorChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*' || c == '\'' || c == '"'
+}
+
+// pdfLiteralString 解析从start开始的括号字符串，返回内容和字符串之后的位置
+func pdfLiteralString(stream []byte, start int) (string, int) {
+	var buf []byte
+	depth := 0
+	i := start
+	for ; i < len(stream); i++ {
+		c := stream[i]
+		switch {
+		case c == '\\' && i+1 < len(stream):
+			i++
+			switch e := stream[i]; e {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// 行尾的反斜杠表示续行
+			default:
+				if e >= '0' && e <= '7' {
+					value := 0
+					for n := 0; n < 3 && i < len(stream) && stream[i] >= '0' && stream[i] <= '7'; n++ {
+						value = value*8 + int(stream[i]-'0')
+						i++
+					}
+					i--
+					buf = append(buf, byte(value))
+				} else {
+					buf = append(buf, e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				buf = append(buf, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return pdfDecode(buf), i + 1
+			}
+			buf = append(buf, c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return pdfDecode(buf), i
+}
+
+// pdfHexString 解析从start开始的十六进制字符串，返回内容和字符串之后的位置
+func pdfHexString(stream []byte, start int) (string, int) {
+	end := bytes.IndexByte(stream[start:], '>')
+	if end < 0 {
+		return "", len(stream)
+	}
+	var digits []byte
+	for _, c := range stream[start+1 : start+end] {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	buf := make([]byte, len(digits)/2)
+	for i := range buf {
+		fmt.Sscanf(string(digits[i*2:i*2+2]), "%02x", &buf[i])
+	}
+	return pdfDecode(buf), start + end + 1
+}
+
+// pdfDecode 把PDF字符串转为UTF-8：带BOM的按UTF-16BE解码，其余按Latin-1解码，去掉不可见字符
+func pdfDecode(buf []byte) string {
+	if len(buf) >= 2 && buf[0] == 0xfe && buf[1] == 0xff {
+		units := make([]uint16, 0, len(buf)/2)
+		for i := 2; i+1 < len(buf); i += 2 {
+			units = append(units, uint16(buf[i])<<8|uint16(buf[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	var b strings.Builder
+	for _, c := range buf {
+		if c >= 0x20 || c == '\n' || c == '\t' {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,632 @@
+package ragplugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"weave/models"
+	"weave/pkg"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultCollection 未指定集合时文档所在的集合
+	DefaultCollection = "default"
+	// maxDocumentBytes 单个文档的最大字节数
+	maxDocumentBytes = 10 << 20
+	// maxConcurrentIndexing 同时执行的索引任务数，其余任务排队等待
+	maxConcurrentIndexing = 2
+	// indexTimeout 单个文档的索引超时
+	indexTimeout = 10 * time.Minute
+)
+
+var (
+	collectionPattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+	errInvalidCollection = errors.New("collection must be 1-64 letters, digits, '_' or '-'")
+	errDocumentTooLarge  = fmt.Errorf("document must be at most %d bytes", maxDocumentBytes)
+)
+
+// DocumentIndexer 可选接口，引擎实现后插件提供知识库文档的上传和索引接口
+type DocumentIndexer interface {
+	// Index 把文档切分后写入向量库，返回切片ID；progress报告0到100的索引进度
+	Index(ctx context.Context, doc IndexDocument, progress func(percent int)) ([]string, error)
+	// DeleteChunks 从向量库删除切片
+	DeleteChunks(ctx context.Context, chunkIDs []string) error
+}
+
+// AnswerPurger 可选接口，引擎缓存回答时实现，文档索引完成或删除后清除租户的缓存回答
+type AnswerPurger interface {
+	PurgeAnswers(ctx context.Context, tenantID uint) error
+}
+
+// IndexDocument 待索引的文档
+type IndexDocument struct {
+	ID         uint
+	TenantID   uint
+	Collection string
+	Title      string
+	Content    string // Markdown
+}
+
+// indexJob 一个文档正在执行或排队的索引任务
+type indexJob struct {
+	cancel context.CancelFunc
+}
+
+// indexJobs 按文档ID记录索引任务，同一文档的新任务会取消旧任务
+type indexJobs struct {
+	mu    sync.Mutex
+	jobs  map[uint]*indexJob
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newIndexJobs() *indexJobs {
+	return &indexJobs{jobs: make(map[uint]*indexJob), slots: make(chan struct{}, maxConcurrentIndexing)}
+}
+
+// handleUploadDocument 上传文档，同一集合中已有相同内容的文档时直接返回该文档
+func (p *RAGPlugin) handleUploadDocument(c *gin.Context) {
+	if !p.checkEnabled(c) {
+		return
+	}
+	input, ok := readDocumentInput(c, "")
+	if !ok {
+		return
+	}
+	if input.Collection == "" {
+		input.Collection = DefaultCollection
+	}
+	if !validCollection(input.Collection) {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid document", errInvalidCollection))
+		return
+	}
+	if _, err := p.documentIndexer(); err != nil {
+		pkg.RespondError(c, pkg.NewServiceUnavailable("Knowledge base is unavailable", err))
+		return
+	}
+
+	db := pkg.TenantDB(c)
+	var existing models.KnowledgeDocument
+	err := db.Where("collection = ? AND content_hash = ?", input.Collection, input.hash).First(&existing).Error
+	if err == nil {
+		c.JSON(200, gin.H{"document": existing, "duplicate": true})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load documents", err))
+		return
+	}
+
+	doc := models.KnowledgeDocument{
+		Collection:  input.Collection,
+		ContentHash: input.hash,
+		Title:       input.Title,
+		Filename:    input.Filename,
+		ContentType: input.ContentType,
+		Size:        input.size,
+		Content:     input.content,
+		Status:      models.DocumentStatusPending,
+		CreatedBy:   c.GetUint("user_id"),
+	}
+	if err := db.Create(&doc).Error; err != nil {
+		// 并发上传相同内容时唯一索引冲突，返回先创建的文档
+		if db.Where("collection = ? AND content_hash = ?", input.Collection, input.hash).First(&existing).Error == nil {
+			c.JSON(200, gin.H{"document": existing, "duplicate": true})
+			return
+		}
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to save document", err))
+		return
+	}
+
+	p.startIndexing(doc.TenantID, doc.ID, doc.ContentHash)
+	c.JSON(202, gin.H{"document": doc, "duplicate": false})
+}
+
+// handleListDocuments 分页获取文档，可以按集合和索引状态过滤
+func (p *RAGPlugin) handleListDocuments(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := pkg.TenantDB(c).Model(&models.KnowledgeDocument{})
+	if collection := c.Query("collection"); collection != "" {
+		query = query.Where("collection = ?", collection)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load documents", err))
+		return
+	}
+	documents := []models.KnowledgeDocument{}
+	if err := query.Omit("content", "chunk_ids").Order("updated_at DESC, id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&documents).Error; err != nil {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load documents", err))
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"documents": documents,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// handleGetDocument 获取文档的索引状态和进度
+func (p *RAGPlugin) handleGetDocument(c *gin.Context) {
+	doc, ok := loadDocument(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, doc)
+}
+
+// handleUpdateDocument 替换文档内容，内容不变时不重新索引
+// 新内容与同一集合中的其他文档相同时返回409
+func (p *RAGPlugin) handleUpdateDocument(c *gin.Context) {
+	if !p.checkEnabled(c) {
+		return
+	}
+	doc, ok := loadDocument(c)
+	if !ok {
+		return
+	}
+	input, ok := readDocumentInput(c, doc.Title)
+	if !ok {
+		return
+	}
+	if input.hash == doc.ContentHash && doc.Status != models.DocumentStatusFailed {
+		c.JSON(200, gin.H{"document": doc, "changed": false})
+		return
+	}
+	if _, err := p.documentIndexer(); err != nil {
+		pkg.RespondError(c, pkg.NewServiceUnavailable("Knowledge base is unavailable", err))
+		return
+	}
+
+	db := pkg.TenantDB(c)
+	var duplicate models.KnowledgeDocument
+	err := db.Select("id").Where("collection = ? AND content_hash = ? AND id <> ?", doc.Collection, input.hash, doc.ID).First(&duplicate).Error
+	if err == nil {
+		pkg.RespondError(c, pkg.NewConflict("Document with the same content already exists", nil).WithDetails(gin.H{"document_id": duplicate.ID}))
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load documents", err))
+		return
+	}
+
+	// 旧的切片在新内容索引完成后删除，重新索引期间仍然可以检索到旧内容
+	updates := map[string]interface{}{
+		"content_hash": input.hash,
+		"title":        input.Title,
+		"content_type": input.ContentType,
+		"size":         input.size,
+		"content":      input.content,
+		"status":       models.DocumentStatusPending,
+		"progress":     0,
+		"error":        "",
+	}
+	if input.Filename != "" {
+		updates["filename"] = input.Filename
+	}
+	if err := db.Model(doc).Updates(updates).Error; err != nil {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to save document", err))
+		return
+	}
+	if err := db.First(doc, doc.ID).Error; err != nil {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load documents", err))
+		return
+	}
+
+	p.startIndexing(doc.TenantID, doc.ID, doc.ContentHash)
+	c.JSON(202, gin.H{"document": doc, "changed": true})
+}
+
+// handleReindexDocument 按保存的内容重新索引文档，用于索引失败或更换嵌入模型后
+func (p *RAGPlugin) handleReindexDocument(c *gin.Context) {
+	if !p.checkEnabled(c) {
+		return
+	}
+	doc, ok := loadDocument(c)
+	if !ok {
+		return
+	}
+	if _, err := p.documentIndexer(); err != nil {
+		pkg.RespondError(c, pkg.NewServiceUnavailable("Knowledge base is unavailable", err))
+		return
+	}
+	if err := pkg.TenantDB(c).Model(doc).Updates(map[string]interface{}{
+		"status": models.DocumentStatusPending, "progress": 0, "error": "",
+	}).Error; err != nil {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to save document", err))
+		return
+	}
+
+	p.startIndexing(doc.TenantID, doc.ID, doc.ContentHash)
+	c.JSON(202, gin.H{"document": doc})
+}
+
+// handleDeleteDocument 取消文档的索引任务，从向量库删除切片后删除文档
+func (p *RAGPlugin) handleDeleteDocument(c *gin.Context) {
+	doc, ok := loadDocument(c)
+	if !ok {
+		return
+	}
+	p.cancelIndexing(doc.ID)
+
+	if chunkIDs := chunkIDsOf(doc); len(chunkIDs) > 0 {
+		indexer, err := p.documentIndexer()
+		if err == nil {
+			err = indexer.DeleteChunks(c.Request.Context(), chunkIDs)
+		}
+		if err != nil {
+			pkg.RespondError(c, pkg.NewServiceUnavailable("Failed to delete document chunks", err))
+			return
+		}
+	}
+	if err := pkg.TenantDB(c).Delete(&models.KnowledgeDocument{}, doc.ID).Error; err != nil {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to delete document", err))
+		return
+	}
+	p.purgeAnswers(doc.TenantID)
+	c.JSON(200, gin.H{"message": "Document deleted successfully"})
+}
+
+// documentInput 上传或更新的文档
+type documentInput struct {
+	Title       string
+	Collection  string
+	ContentType string
+	Filename    string
+
+	content string // 转换后的Markdown
+	hash    string
+	size    int64
+}
+
+// readDocumentInput 读取multipart/form-data上传的文件或JSON格式的文本，并转为Markdown
+// 请求没有指定标题时使用defaultTitle，defaultTitle为空时从内容和文件名推断；无效时写入错误响应并返回false
+func readDocumentInput(c *gin.Context, defaultTitle string) (*documentInput, bool) {
+	input := &documentInput{}
+	var data []byte
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxDocumentBytes+1<<20)
+
+	if c.ContentType() == "multipart/form-data" {
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				pkg.RespondError(c, pkg.NewPayloadTooLarge("Document is too large", errDocumentTooLarge))
+				return nil, false
+			}
+			pkg.RespondError(c, pkg.NewValidationError("Invalid document", errors.New("file is required")))
+			return nil, false
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(io.LimitReader(file, maxDocumentBytes+1)); err != nil {
+			pkg.RespondError(c, pkg.NewValidationError("Invalid document", err))
+			return nil, false
+		}
+		input.Title = c.PostForm("title")
+		input.Collection = c.PostForm("collection")
+		input.ContentType = c.PostForm("content_type")
+		input.Filename = header.Filename
+	} else {
+		var req struct {
+			Title       string `json:"title"`
+			Collection  string `json:"collection"`
+			ContentType string `json:"content_type"`
+			Filename    string `json:"filename"`
+			Content     string `json:"content" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				pkg.RespondError(c, pkg.NewPayloadTooLarge("Document is too large", errDocumentTooLarge))
+				return nil, false
+			}
+			pkg.RespondError(c, pkg.NewValidationError("Invalid document", err))
+			return nil, false
+		}
+		input.Title = req.Title
+		input.Collection = req.Collection
+		input.ContentType = req.ContentType
+		input.Filename = req.Filename
+		data = []byte(req.Content)
+	}
+	if strings.TrimSpace(input.Title) == "" {
+		input.Title = defaultTitle
+	}
+	if len(data) > maxDocumentBytes {
+		pkg.RespondError(c, pkg.NewPayloadTooLarge("Document is too large", errDocumentTooLarge))
+		return nil, false
+	}
+
+	contentType, err := detectContentType(input.ContentType, input.Filename)
+	if err != nil {
+		pkg.RespondError(c, pkg.NewUnsupportedMediaType("Unsupported document type", err))
+		return nil, false
+	}
+	if contentType == ContentTypePDF && c.ContentType() != "multipart/form-data" {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid document", errors.New("PDF documents must be uploaded as files")))
+		return nil, false
+	}
+	content, title, err := convertDocument(contentType, input.Title, input.Filename, data)
+	if errors.Is(err, errDocumentTooLarge) {
+		pkg.RespondError(c, pkg.NewPayloadTooLarge("Document is too large", err))
+		return nil, false
+	}
+	if err != nil {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid document", err))
+		return nil, false
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	input.ContentType, input.Title, input.content = contentType, title, content
+	input.hash, input.size = hex.EncodeToString(sum[:]), int64(len(data))
+	return input, true
+}
+
+// loadDocument 按路径中的ID加载当前租户的文档，不存在时写入错误响应并返回false
+func loadDocument(c *gin.Context) (*models.KnowledgeDocument, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		pkg.RespondError(c, pkg.NewBadRequest("Invalid document ID", err))
+		return nil, false
+	}
+	var doc models.KnowledgeDocument
+	if err := pkg.TenantDB(c).First(&doc, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			pkg.RespondError(c, pkg.NewNotFoundError("Document not found", err))
+		} else {
+			pkg.RespondError(c, pkg.NewDatabaseError("Failed to load documents", err))
+		}
+		return nil, false
+	}
+	return &doc, true
+}
+
+// validCollection 返回集合名称是否有效
+func validCollection(collection string) bool {
+	return collectionPattern.MatchString(collection)
+}
+
+// documentIndexer 返回支持文档索引的引擎
+func (p *RAGPlugin) documentIndexer() (DocumentIndexer, error) {
+	engine, err := p.getEngine()
+	if err != nil {
+		return nil, err
+	}
+	indexer, ok := engine.(DocumentIndexer)
+	if !ok {
+		return nil, errors.New("RAG engine does not support document indexing")
+	}
+	return indexer, nil
+}
+
+// startIndexing 在后台索引文档，取消该文档正在执行或排队的任务
+// hash为任务对应的内容摘要，任务完成时内容已被更新则丢弃结果
+func (p *RAGPlugin) startIndexing(tenantID, documentID uint, hash string) {
+	ctx, cancel := context.WithTimeout(pkg.WithTenantID(context.Background(), tenantID), indexTimeout)
+	job := &indexJob{cancel: cancel}
+
+	p.jobs.mu.Lock()
+	if previous, ok := p.jobs.jobs[documentID]; ok {
+		previous.cancel()
+	}
+	p.jobs.jobs[documentID] = job
+	p.jobs.wg.Add(1)
+	p.jobs.mu.Unlock()
+
+	go func() {
+		defer p.jobs.wg.Done()
+		defer p.finishIndexing(documentID, job)
+		p.runIndexing(ctx, job, tenantID, documentID, hash)
+	}()
+}
+
+// cancelIndexing 取消文档的索引任务
+func (p *RAGPlugin) cancelIndexing(documentID uint) {
+	p.jobs.mu.Lock()
+	defer p.jobs.mu.Unlock()
+	if job, ok := p.jobs.jobs[documentID]; ok {
+		job.cancel()
+		delete(p.jobs.jobs, documentID)
+	}
+}
+
+// finishIndexing 任务结束后释放资源，任务已被新任务替换时保留新任务
+func (p *RAGPlugin) finishIndexing(documentID uint, job *indexJob) {
+	job.cancel()
+	p.jobs.mu.Lock()
+	defer p.jobs.mu.Unlock()
+	if p.jobs.jobs[documentID] == job {
+		delete(p.jobs.jobs, documentID)
+	}
+}
+
+// currentJob 返回任务是否仍是文档最新的任务
+func (p *RAGPlugin) currentJob(documentID uint, job *indexJob) bool {
+	p.jobs.mu.Lock()
+	defer p.jobs.mu.Unlock()
+	return p.jobs.jobs[documentID] == job
+}
+
+// WaitIndexing 等待所有索引任务结束
+func (p *RAGPlugin) WaitIndexing() {
+	p.jobs.wg.Wait()
+}
+
+// runIndexing 执行索引任务，按进度更新文档状态；成功后删除上一版本的切片
+func (p *RAGPlugin) runIndexing(ctx context.Context, job *indexJob, tenantID, documentID uint, hash string) {
+	select {
+	case p.jobs.slots <- struct{}{}:
+		defer func() { <-p.jobs.slots }()
+	case <-ctx.Done():
+		return
+	}
+
+	// 状态更新不使用任务的上下文，任务取消或超时后仍然可以记录结果
+	db := pkg.DB.WithContext(pkg.WithTenantID(context.Background(), tenantID))
+	var doc models.KnowledgeDocument
+	if err := db.First(&doc, documentID).Error; err != nil || doc.ContentHash != hash || !p.currentJob(documentID, job) {
+		return
+	}
+	// update 只更新内容未变化的文档，返回是否更新成功
+	update := func(values map[string]interface{}) bool {
+		if !p.currentJob(documentID, job) {
+			return false
+		}
+		result := db.Model(&models.KnowledgeDocument{}).Where("id = ? AND content_hash = ?", documentID, hash).Updates(values)
+		if result.Error != nil {
+			pkg.Warn("Failed to update document status", zap.Uint("document_id", documentID), zap.Error(result.Error))
+		}
+		return result.Error == nil && result.RowsAffected > 0
+	}
+	update(map[string]interface{}{"status": models.DocumentStatusIndexing, "progress": 0, "error": ""})
+
+	indexer, err := p.documentIndexer()
+	if err != nil {
+		update(map[string]interface{}{"status": models.DocumentStatusFailed, "error": err.Error()})
+		return
+	}
+	var progressMu sync.Mutex
+	lastProgress := 0
+	progress := func(percent int) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		// 进度到100时由最终状态记录，其余进度至少增加5再写入数据库
+		if percent < 100 && percent-lastProgress >= 5 {
+			lastProgress = percent
+			update(map[string]interface{}{"progress": percent})
+		}
+	}
+	chunkIDs, err := indexer.Index(ctx, IndexDocument{
+		ID:         doc.ID,
+		TenantID:   doc.TenantID,
+		Collection: doc.Collection,
+		Title:      doc.Title,
+		Content:    doc.Content,
+	}, progress)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("indexing timed out after %s", indexTimeout)
+		}
+		update(map[string]interface{}{"status": models.DocumentStatusFailed, "error": err.Error()})
+		return
+	}
+
+	encoded, _ := json.Marshal(chunkIDs)
+	now := time.Now()
+	if !update(map[string]interface{}{
+		"status":      models.DocumentStatusIndexed,
+		"progress":    100,
+		"error":       "",
+		"chunk_ids":   string(encoded),
+		"chunk_count": len(chunkIDs),
+		"indexed_at":  &now,
+	}) {
+		// 文档在索引期间被更新或删除，丢弃本次写入的切片
+		deleteChunks(indexer, documentID, chunkIDs)
+		return
+	}
+
+	// 删除上一版本的切片
+	previous := chunkIDsOf(&doc)
+	stale := make([]string, 0, len(previous))
+	current := make(map[string]bool, len(chunkIDs))
+	for _, id := range chunkIDs {
+		current[id] = true
+	}
+	for _, id := range previous {
+		if !current[id] {
+			stale = append(stale, id)
+		}
+	}
+	deleteChunks(indexer, documentID, stale)
+	p.purgeAnswers(tenantID)
+}
+
+// purgeAnswers 清除租户的缓存回答，知识库内容变化后旧回答可能已经过时；失败时只记录日志
+func (p *RAGPlugin) purgeAnswers(tenantID uint) {
+	engine, err := p.getEngine()
+	if err != nil {
+		return
+	}
+	purger, ok := engine.(AnswerPurger)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(pkg.WithTenantID(context.Background(), tenantID), healthTimeout)
+	defer cancel()
+	if err := purger.PurgeAnswers(ctx, tenantID); err != nil {
+		pkg.Warn("Failed to purge cached answers", zap.Uint("tenant_id", tenantID), zap.Error(err))
+	}
+}
+
+// deleteChunks 删除切片，失败时只记录日志
+func deleteChunks(indexer DocumentIndexer, documentID uint, chunkIDs []string) {
+	if len(chunkIDs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	if err := indexer.DeleteChunks(ctx, chunkIDs); err != nil {
+		pkg.Warn("Failed to delete document chunks", zap.Uint("document_id", documentID), zap.Int("chunks", len(chunkIDs)), zap.Error(err))
+	}
+}
+
+// resumeIndexing 重新排队上次退出时未完成的索引任务
+func (p *RAGPlugin) resumeIndexing() {
+	if pkg.DB == nil {
+		return
+	}
+	var docs []models.KnowledgeDocument
+	err := pkg.DB.WithContext(pkg.WithoutTenantScope(context.Background())).
+		Select("id", "tenant_id", "content_hash").
+		Where("status IN ?", []string{models.DocumentStatusPending, models.DocumentStatusIndexing}).
+		Find(&docs).Error
+	if err != nil {
+		pkg.Warn("Failed to load unfinished knowledge documents", zap.Error(err))
+		return
+	}
+	for _, doc := range docs {
+		p.startIndexing(doc.TenantID, doc.ID, doc.ContentHash)
+	}
+	if len(docs) > 0 {
+		pkg.Info("Resumed knowledge document indexing", zap.Int("documents", len(docs)))
+	}
+}
+
+// chunkIDsOf 返回文档在向量库中的切片ID
+func chunkIDsOf(doc *models.KnowledgeDocument) []string {
+	var ids []string
+	if strings.TrimSpace(doc.ChunkIDs) != "" {
+		_ = json.Unmarshal([]byte(doc.ChunkIDs), &ids)
+	}
+	return ids
+}
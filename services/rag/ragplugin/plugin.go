@@ -0,0 +1,452 @@
+// Package ragplugin 把知识库问答（RAG）作为插件注册到PluginManager
+//
+// 插件提供/ask路由和Execute入口，路由沿用平台的认证、租户隔离和限流，回答附带引用的文档和相似度。
+// 问答引擎由Factory创建，与检索、嵌入和生成的具体实现解耦；引擎创建失败时插件仍然注册，
+// 请求返回503，并按退避间隔重试创建。
+//
+// 引擎实现DocumentIndexer时，插件还提供/documents路由：上传的文档转为Markdown后保存到数据库，
+// 在后台按集合写入向量库并记录进度，同一集合中内容相同的文档只索引一次。
+package ragplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"weave/middleware"
+	"weave/pkg"
+	"weave/plugins/core"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PluginName 插件名称，路由挂载在/plugins/RAG下
+const PluginName = "RAG"
+
+const (
+	defaultTopK      = 3
+	maxTopK          = 20
+	maxQuestionRunes = 2000
+	// retryInterval 引擎创建失败后再次尝试的间隔
+	retryInterval = 30 * time.Second
+	// healthTTL 依赖健康状态的缓存时间，避免频繁的健康检查反复调用嵌入模型
+	healthTTL = 30 * time.Second
+	// healthTimeout 单次依赖检查的超时
+	healthTimeout = 5 * time.Second
+)
+
+// Source 回答引用的文档片段
+type Source struct {
+	ID       string                 `json:"id"`
+	Title    string                 `json:"title,omitempty"`
+	Score    float64                `json:"score"`   // 与问题的相似度，0到1
+	Snippet  string                 `json:"snippet"` // 文档内容的开头部分
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Answer 问答结果
+type Answer struct {
+	Answer  string   `json:"answer"`
+	Sources []Source `json:"sources"`
+	Cached  bool     `json:"cached"` // 回答来自回答缓存
+}
+
+// Dependency 一个依赖的健康状态
+type Dependency struct {
+	Name      string `json:"name"`
+	Healthy   bool   `json:"healthy"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Query 一次提问
+type Query struct {
+	Question   string
+	TopK       int    // 检索的文档数量
+	Collection string // 只检索指定集合的文档，为空表示检索全部集合
+}
+
+// Engine 知识库问答引擎，上下文带租户信息时只检索该租户和共享的文档，并按租户计量用量和缓存回答
+type Engine interface {
+	Ask(ctx context.Context, query Query) (*Answer, error)
+	// Check 检查检索和嵌入等依赖
+	Check(ctx context.Context) []Dependency
+}
+
+// Factory 创建问答引擎
+type Factory func(ctx context.Context) (Engine, error)
+
+// RAGPlugin 知识库问答插件
+type RAGPlugin struct {
+	factory     Factory
+	manager     *core.PluginManager
+	rateLimiter gin.HandlerFunc
+
+	mu        sync.Mutex
+	engine    Engine
+	engineErr error     // 最近一次创建引擎的错误
+	nextTry   time.Time // 创建失败后允许再次尝试的时间
+
+	healthMu  sync.Mutex
+	health    []Dependency
+	checkedAt time.Time
+
+	jobs *indexJobs // 文档索引任务
+}
+
+// NewRAGPlugin 创建知识库问答插件，factory在Init和之后的重试中调用
+func NewRAGPlugin(factory Factory) *RAGPlugin {
+	return &RAGPlugin{
+		factory: factory,
+		// 问答需要调用模型，限流比普通API接口更严格：每秒5个请求，突发容量10
+		rateLimiter: middleware.RateLimiter(5, 10),
+		jobs:        newIndexJobs(),
+	}
+}
+
+// 基础信息接口实现
+func (p *RAGPlugin) Name() string {
+	return PluginName
+}
+
+func (p *RAGPlugin) Description() string {
+	return "基于知识库的检索增强问答，回答附带引用的文档和相似度"
+}
+
+func (p *RAGPlugin) Version() string {
+	return "1.0.0"
+}
+
+func (p *RAGPlugin) GetDependencies() []string {
+	return []string{}
+}
+
+func (p *RAGPlugin) GetConflicts() []string {
+	return []string{}
+}
+
+// Init 创建问答引擎并继续上次未完成的文档索引，引擎创建失败时只记录日志，请求到来时再重试
+func (p *RAGPlugin) Init() error {
+	pkg.Info("Initializing RAG Plugin...")
+	p.resumeIndexing()
+	if _, err := p.getEngine(); err != nil {
+		pkg.Warn("RAG engine unavailable, will retry on demand", zap.Error(err))
+		return nil
+	}
+	pkg.Info("RAG Plugin initialized successfully")
+	return nil
+}
+
+// Shutdown 取消正在执行的索引任务，未完成的文档在下次启动时重新索引
+func (p *RAGPlugin) Shutdown() error {
+	pkg.Info("Shutting down RAG Plugin...")
+	p.jobs.mu.Lock()
+	for _, job := range p.jobs.jobs {
+		job.cancel()
+	}
+	p.jobs.mu.Unlock()
+	return nil
+}
+
+func (p *RAGPlugin) OnEnable() error {
+	pkg.Info("RAG Plugin enabled")
+	return nil
+}
+
+func (p *RAGPlugin) OnDisable() error {
+	pkg.Info("RAG Plugin disabled")
+	return nil
+}
+
+// 路由注册接口实现
+func (p *RAGPlugin) GetRoutes() []core.Route {
+	return []core.Route{
+		{
+			Path:         "ask",
+			Method:       "POST",
+			Handler:      p.handleAsk,
+			Middlewares:  []gin.HandlerFunc{middleware.ContextTimeoutMiddleware(middleware.DefaultTimeoutConfig())},
+			Description:  "基于知识库回答问题，返回回答和引用的文档",
+			AuthRequired: true,
+			Tags:         []string{"RAG"},
+			Params:       map[string]string{"question": "问题，必填", "top_k": "检索的文档数量，默认3，最大20", "collection": "只检索指定集合的文档"},
+		},
+		{
+			Path:         "health",
+			Method:       "GET",
+			Handler:      p.handleHealth,
+			Description:  "检查Redis向量库和嵌入模型的健康状态",
+			AuthRequired: true,
+			Tags:         []string{"RAG", "Health"},
+		},
+		{
+			Path:         "documents",
+			Method:       "POST",
+			Handler:      p.handleUploadDocument,
+			Description:  "上传文档到知识库并在后台索引",
+			AuthRequired: true,
+			Tags:         []string{"RAG", "Documents"},
+			Params:       map[string]string{"file": "文档文件（multipart），或以JSON的content字段提交文本", "title": "标题", "collection": "集合，默认default", "content_type": "markdown、text、html或pdf，默认按扩展名识别"},
+		},
+		{
+			Path:         "documents",
+			Method:       "GET",
+			Handler:      p.handleListDocuments,
+			Description:  "分页获取知识库文档及其索引状态",
+			AuthRequired: true,
+			Tags:         []string{"RAG", "Documents"},
+			Params:       map[string]string{"collection": "按集合过滤", "status": "按索引状态过滤", "page": "页码", "page_size": "每页数量"},
+		},
+		{
+			Path:         "documents/:id",
+			Method:       "GET",
+			Handler:      p.handleGetDocument,
+			Description:  "获取文档的索引状态和进度",
+			AuthRequired: true,
+			Tags:         []string{"RAG", "Documents"},
+		},
+		{
+			Path:         "documents/:id",
+			Method:       "PUT",
+			Handler:      p.handleUpdateDocument,
+			Description:  "替换文档内容，内容变化时重新索引",
+			AuthRequired: true,
+			Tags:         []string{"RAG", "Documents"},
+		},
+		{
+			Path:         "documents/:id",
+			Method:       "DELETE",
+			Handler:      p.handleDeleteDocument,
+			Description:  "从知识库删除文档及其切片",
+			AuthRequired: true,
+			Tags:         []string{"RAG", "Documents"},
+		},
+		{
+			Path:         "documents/:id/reindex",
+			Method:       "POST",
+			Handler:      p.handleReindexDocument,
+			Description:  "按保存的内容重新索引文档",
+			AuthRequired: true,
+			Tags:         []string{"RAG", "Documents"},
+		},
+	}
+}
+
+func (p *RAGPlugin) RegisterRoutes(router *gin.Engine) {
+	// 为了兼容性保留旧接口实现，路由由PluginManager通过GetRoutes注册
+	for _, route := range p.GetRoutes() {
+		router.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+// GetDefaultMiddlewares 按客户端IP限流
+func (p *RAGPlugin) GetDefaultMiddlewares() []gin.HandlerFunc {
+	return []gin.HandlerFunc{p.rateLimiter}
+}
+
+func (p *RAGPlugin) SetPluginManager(manager *core.PluginManager) {
+	p.manager = manager
+}
+
+// ToolSchema 以函数调用工具暴露知识库问答
+func (p *RAGPlugin) ToolSchema() core.ToolSchema {
+	return core.ToolSchema{
+		Description: "在知识库中检索相关文档并回答问题，返回回答和引用的文档",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"question":   map[string]interface{}{"type": "string", "description": "要回答的问题"},
+				"top_k":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": maxTopK},
+				"collection": map[string]interface{}{"type": "string", "description": "只检索指定集合的文档，省略时检索全部集合"},
+			},
+			"required": []string{"question"},
+		},
+	}
+}
+
+// Execute 回答问题，参数：question（必填）、top_k、collection、tenant_id
+// 带tenant_id时只检索该租户和共享的文档，并按租户计量用量和缓存回答，由PluginManager.ExecutePlugin校验租户的执行配额
+func (p *RAGPlugin) Execute(params map[string]interface{}) (interface{}, error) {
+	query := Query{}
+	query.Question, _ = params["question"].(string)
+	query.TopK, _ = intParam(params, "top_k")
+	query.Collection, _ = params["collection"].(string)
+	if err := normalizeQuery(&query); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if tenantID, ok := intParam(params, "tenant_id"); ok && tenantID >= 0 {
+		ctx = pkg.WithTenantID(ctx, uint(tenantID))
+	}
+	engine, err := p.getEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine.Ask(ctx, query)
+}
+
+// handleAsk 回答问题，租户来自认证信息
+func (p *RAGPlugin) handleAsk(c *gin.Context) {
+	if !p.checkEnabled(c) {
+		return
+	}
+	var req struct {
+		Question   string `json:"question" binding:"required"`
+		TopK       int    `json:"top_k"`
+		Collection string `json:"collection"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid question", err))
+		return
+	}
+	query := Query{Question: req.Question, TopK: req.TopK, Collection: req.Collection}
+	if err := normalizeQuery(&query); err != nil {
+		pkg.RespondError(c, pkg.NewValidationError("Invalid question", err))
+		return
+	}
+
+	engine, err := p.getEngine()
+	if err != nil {
+		pkg.RespondError(c, pkg.NewServiceUnavailable("Knowledge base is unavailable", err))
+		return
+	}
+	ctx := c.Request.Context()
+	answer, err := engine.Ask(ctx, query)
+	if err != nil {
+		var appErr *pkg.AppError
+		switch {
+		case pkg.IsQuotaExceeded(err) && errors.As(err, &appErr):
+			pkg.RespondError(c, appErr)
+		case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+			pkg.RespondError(c, pkg.NewRequestTimeout("Request timeout", err))
+		default:
+			pkg.RespondError(c, pkg.NewServiceUnavailable("Knowledge base request failed", err))
+		}
+		return
+	}
+	if answer.Sources == nil {
+		answer.Sources = []Source{}
+	}
+	c.JSON(200, answer)
+}
+
+// handleHealth 返回依赖的健康状态，任一依赖不健康时返回503
+func (p *RAGPlugin) handleHealth(c *gin.Context) {
+	healthy, dependencies := p.HealthCheck(c.Request.Context())
+	status := 200
+	if !healthy {
+		status = 503
+	}
+	c.JSON(status, gin.H{"name": p.Name(), "healthy": healthy, "dependencies": dependencies})
+}
+
+// HealthCheck 检查引擎及其依赖，结果缓存healthTTL
+func (p *RAGPlugin) HealthCheck(ctx context.Context) (bool, interface{}) {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+
+	if p.health == nil || time.Since(p.checkedAt) > healthTTL {
+		p.health = p.checkDependencies(ctx)
+		p.checkedAt = time.Now()
+	}
+	healthy := true
+	for _, dependency := range p.health {
+		healthy = healthy && dependency.Healthy
+	}
+	return healthy, p.health
+}
+
+// checkDependencies 检查引擎能否创建以及引擎报告的依赖
+func (p *RAGPlugin) checkDependencies(ctx context.Context) []Dependency {
+	start := time.Now()
+	engine, err := p.getEngine()
+	if err != nil {
+		return []Dependency{{Name: "engine", Healthy: false, LatencyMs: time.Since(start).Milliseconds(), Error: err.Error()}}
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	return engine.Check(ctx)
+}
+
+// getEngine 返回问答引擎，尚未创建时调用factory，失败后在retryInterval内直接返回上次的错误
+func (p *RAGPlugin) getEngine() (Engine, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.engine != nil {
+		return p.engine, nil
+	}
+	if p.engineErr != nil && time.Now().Before(p.nextTry) {
+		return nil, p.engineErr
+	}
+	if p.factory == nil {
+		return nil, errors.New("RAG engine factory is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), retryInterval)
+	defer cancel()
+	engine, err := p.factory(ctx)
+	if err != nil {
+		p.engineErr = fmt.Errorf("failed to build RAG engine: %w", err)
+		p.nextTry = time.Now().Add(retryInterval)
+		return nil, p.engineErr
+	}
+	p.engine, p.engineErr = engine, nil
+	return engine, nil
+}
+
+// checkEnabled 插件被禁用时写入403响应并返回false
+func (p *RAGPlugin) checkEnabled(c *gin.Context) bool {
+	if p.manager == nil {
+		return true
+	}
+	if status, exists := p.manager.GetPluginStatus(p.Name()); exists && status != "enabled" {
+		pkg.RespondError(c, pkg.NewPluginDisabledError("Plugin is disabled", nil).WithDetails(gin.H{"plugin": p.Name()}))
+		return false
+	}
+	return true
+}
+
+// normalizeQuery 去掉问题首尾的空白，补充默认的检索数量并校验提问
+func normalizeQuery(query *Query) error {
+	query.Question = strings.TrimSpace(query.Question)
+	if query.Question == "" {
+		return errors.New("question is required")
+	}
+	if len([]rune(query.Question)) > maxQuestionRunes {
+		return fmt.Errorf("question must be at most %d characters", maxQuestionRunes)
+	}
+	if query.TopK == 0 {
+		query.TopK = defaultTopK
+	}
+	if query.TopK < 1 || query.TopK > maxTopK {
+		return fmt.Errorf("top_k must be between 1 and %d", maxTopK)
+	}
+	if query.Collection != "" && !validCollection(query.Collection) {
+		return errInvalidCollection
+	}
+	return nil
+}
+
+// intParam 从执行参数中解析整数，兼容字符串和JSON数字
+func intParam(params map[string]interface{}, key string) (int, bool) {
+	switch v := params[key].(type) {
+	case int:
+		return v, true
+	case uint:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
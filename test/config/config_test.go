@@ -1,7 +1,10 @@
 package config_test
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"weave/config"
 )
@@ -225,3 +228,178 @@ func TestCSRFConfigLoading(t *testing.T) {
 		})
 	}
 }
+
+// TestAuditSinksConfig 测试审计日志转发目标的加载和校验
+func TestAuditSinksConfig(t *testing.T) {
+	resetEnvVars()
+	defer resetEnvVars()
+	defer os.Unsetenv("CONFIG_PATH")
+	defer os.Unsetenv("AUDIT_SINKS")
+	os.Setenv("DB_USERNAME", "test-user")
+	os.Setenv("DB_PASSWORD", "test-pass")
+	os.Setenv("JWT_SECRET", "test-jwt-secret")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"audit": {"sinkBatchSize": 50, "sinks": [
+		{"name": "siem", "type": "cef", "network": "tcp", "address": "siem.example.com:514"},
+		{"name": "soc", "type": "webhook", "url": "https://soc.example.com/hook", "secret": "s", "headers": {"X-Source": "weave"}}
+	]}}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Setenv("CONFIG_PATH", path)
+	config.LoadConfig()
+
+	sinks := config.Config.Audit.Sinks
+	if len(sinks) != 2 || config.Config.Audit.SinkBatchSize != 50 {
+		t.Fatalf("Expected 2 sinks and batch size 50, got %#v, %d", sinks, config.Config.Audit.SinkBatchSize)
+	}
+	if sinks[0].Type != "cef" || sinks[0].Network != "tcp" || sinks[1].Headers["X-Source"] != "weave" {
+		t.Errorf("Unexpected sinks: %#v", sinks)
+	}
+	if err := config.ValidateConfig(); err != nil {
+		t.Errorf("Expected valid sinks, got %v", err)
+	}
+
+	// 环境变量覆盖配置文件，缺少地址的syslog目标校验失败
+	os.Setenv("AUDIT_SINKS", `[{"name":"broken","type":"syslog"}]`)
+	config.LoadConfig()
+	if len(config.Config.Audit.Sinks) != 1 || config.Config.Audit.Sinks[0].Name != "broken" {
+		t.Fatalf("Expected sinks from env, got %#v", config.Config.Audit.Sinks)
+	}
+	if err := config.ValidateConfig(); err == nil {
+		t.Errorf("Expected validation error for syslog sink without address")
+	}
+	config.Config.Audit.Sinks = []config.AuditSinkConfig{{Name: "a", Type: "kafka"}}
+	if err := config.ValidateConfig(); err == nil {
+		t.Errorf("Expected validation error for unknown sink type")
+	}
+	config.Config.Audit.Sinks = nil
+}
+
+func TestRetentionConfig(t *testing.T) {
+	resetEnvVars()
+	defer resetEnvVars()
+	defer os.Unsetenv("CONFIG_PATH")
+	defer os.Unsetenv("RETENTION_S3_SECRET_KEY")
+	os.Setenv("DB_USERNAME", "test-user")
+	os.Setenv("DB_PASSWORD", "test-pass")
+	os.Setenv("JWT_SECRET", "test-jwt-secret")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"retention": {"auditLogDays": 365, "storage": "s3",
+		"s3": {"endpoint": "http://minio:9000", "bucket": "archive", "pathStyle": true}}}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Setenv("CONFIG_PATH", path)
+	os.Setenv("RETENTION_S3_SECRET_KEY", "s3-secret")
+	config.LoadConfig()
+
+	retention := config.Config.Retention
+	if retention.AuditLogDays != 365 || retention.Storage != "s3" || !retention.S3.PathStyle || retention.S3.SecretKey != "s3-secret" {
+		t.Fatalf("Unexpected retention config: %#v", retention)
+	}
+	if err := config.ValidateConfig(); err != nil {
+		t.Errorf("Expected valid retention config, got %v", err)
+	}
+
+	config.Config.Retention.S3.Bucket = ""
+	if err := config.ValidateConfig(); err == nil {
+		t.Errorf("Expected validation error for S3 storage without bucket")
+	}
+	config.Config.Retention.Storage = "ftp"
+	if err := config.ValidateConfig(); err == nil {
+		t.Errorf("Expected validation error for unknown storage")
+	}
+	config.Config.Retention.Storage = "local"
+}
+
+func TestAnomalyConfig(t *testing.T) {
+	resetEnvVars()
+	defer resetEnvVars()
+	defer os.Unsetenv("CONFIG_PATH")
+	defer os.Unsetenv("ANOMALY_WEBHOOK_SECRET")
+	os.Setenv("DB_USERNAME", "test-user")
+	os.Setenv("DB_PASSWORD", "test-pass")
+	os.Setenv("JWT_SECRET", "test-jwt-secret")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"anomaly": {"interval": 30, "notifyMinSeverity": "high", "webhookUrl": "https://soc.example.com/hook",
+		"rules": {"newUserAgent": {"enabled": false}, "massDeletion": {"severity": "critical", "window": 60, "threshold": 5}}}}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Setenv("CONFIG_PATH", path)
+	os.Setenv("ANOMALY_WEBHOOK_SECRET", "hook-secret")
+	config.LoadConfig()
+
+	anomaly := config.Config.Anomaly
+	if anomaly.Interval != 30 || anomaly.NotifyMinSeverity != "high" || anomaly.WebhookSecret != "hook-secret" {
+		t.Fatalf("Unexpected anomaly config: %#v", anomaly)
+	}
+	if anomaly.Rules.NewUserAgent.Enabled || !anomaly.Rules.NewIP.Enabled {
+		t.Errorf("Unexpected login rules: %#v", anomaly.Rules)
+	}
+	if rule := anomaly.Rules.MassDeletion; !rule.Enabled || rule.Severity != "critical" || rule.Window != 60 || rule.Threshold != 5 {
+		t.Errorf("Unexpected mass deletion rule: %#v", rule)
+	}
+	if err := config.ValidateConfig(); err != nil {
+		t.Errorf("Expected valid anomaly config, got %v", err)
+	}
+	if sanitized := config.SanitizeConfig(); strings.Contains(fmt.Sprint(sanitized), "hook-secret") {
+		t.Errorf("Webhook secret leaked in sanitized config")
+	}
+
+	config.Config.Anomaly.Rules.LoginBurst.Threshold = 1
+	if err := config.ValidateConfig(); err == nil {
+		t.Errorf("Expected validation error for login burst threshold below 2")
+	}
+	config.Config.Anomaly.Rules.LoginBurst.Threshold = 3
+	config.Config.Anomaly.Rules.NewIP.Severity = "urgent"
+	if err := config.ValidateConfig(); err == nil {
+		t.Errorf("Expected validation error for unknown severity")
+	}
+	config.Config.Anomaly.Rules.NewIP.Severity = "medium"
+}
+
+func TestLLMConfig(t *testing.T) {
+	resetEnvVars()
+	defer resetEnvVars()
+	defer os.Unsetenv("CONFIG_PATH")
+	defer os.Unsetenv("LLM_FALLBACK")
+	os.Setenv("DB_USERNAME", "test-user")
+	os.Setenv("DB_PASSWORD", "test-pass")
+	os.Setenv("JWT_SECRET", "test-jwt-secret")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"llm": {"default": "fast", "timeout": 30, "routes": {"rag": "cloud"}, "aliases": {"fast": "local/phi"},
+		"providers": [{"name": "local", "type": "ollama", "model": "llama3"},
+			{"name": "cloud", "type": "openai", "baseUrl": "https://api.example.com/v1", "apiKey": "sk-secret", "model": "gpt-4o", "timeout": 90}]}}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	os.Setenv("CONFIG_PATH", path)
+	os.Setenv("LLM_FALLBACK", "local")
+	config.LoadConfig()
+
+	llm := config.Config.LLM
+	if len(llm.Providers) != 2 || llm.Providers[1].APIKey != "sk-secret" || llm.Providers[1].Timeout != 90 {
+		t.Fatalf("Unexpected LLM providers: %#v", llm.Providers)
+	}
+	if llm.Default != "fast" || llm.Fallback != "local" || llm.Timeout != 30 || llm.Routes["rag"] != "cloud" || llm.Aliases["fast"] != "local/phi" {
+		t.Fatalf("Unexpected LLM config: %#v", llm)
+	}
+	if err := config.ValidateConfig(); err != nil {
+		t.Errorf("Expected valid LLM config, got %v", err)
+	}
+	if sanitized := config.SanitizeConfig(); strings.Contains(fmt.Sprint(sanitized), "sk-secret") {
+		t.Errorf("Provider API key leaked in sanitized config")
+	}
+
+	config.Config.LLM.Providers[0].Type = "carrier-pigeon"
+	if err := config.ValidateConfig(); err == nil {
+		t.Errorf("Expected validation error for unknown provider type")
+	}
+	config.Config.LLM.Providers[0].Type = "ollama"
+}
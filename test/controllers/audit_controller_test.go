@@ -2,8 +2,10 @@ package controllers_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -92,3 +94,289 @@ func TestAuditControllerGetAuditLogsTenantIsolation(t *testing.T) {
 		t.Fatalf("expected 1 log for tenant 1, got %d", len(body.Logs))
 	}
 }
+
+func TestAuditControllerVerifyAuditChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.AuditCheckpoint{}, &models.RetentionArchive{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+	if err := db.Create(&models.User{ID: 1, Username: "alice", Email: "alice@example.com", Password: "x", TenantID: 1}).Error; err != nil {
+		t.Fatalf("seed user error: %v", err)
+	}
+	for _, tenantID := range []uint{1, 1, 2} {
+		if err := pkg.AppendAuditLog(db, &models.AuditLog{Action: "create", ResourceType: "note", TenantID: tenantID}); err != nil {
+			t.Fatalf("append log error: %v", err)
+		}
+	}
+
+	ac := controllers.AuditController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("tenant_id", uint(1))
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	r.GET("/audit/verify", ac.VerifyAuditChain)
+
+	req, _ := http.NewRequest("GET", "/audit/verify", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result pkg.AuditVerifyResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("json unmarshal error: %v", err)
+	}
+	if !result.Valid || result.TenantID != 1 || result.Entries != 2 {
+		t.Fatalf("unexpected verify result: %#v", result)
+	}
+
+	// 非平台管理员不能校验其他租户
+	req, _ = http.NewRequest("GET", "/audit/verify?tenant_id=2", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for other tenant, got %d", w.Code)
+	}
+}
+
+func TestAuditControllerGetAuditLogDiff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+
+	err = pkg.NewAuditLogger().Log(pkg.AuditLogOptions{
+		Action:       "update",
+		ResourceType: "tool",
+		ResourceID:   "1",
+		OldValue:     models.Tool{ID: 1, Name: "calc", PluginName: "Calc", IsEnabled: true},
+		NewValue:     models.Tool{ID: 1, Name: "calculator", PluginName: "Calc", IsEnabled: false},
+		TenantID:     1,
+	})
+	if err != nil {
+		t.Fatalf("log error: %v", err)
+	}
+	// 引入差异之前的历史记录：没有保存差异，且值未经脱敏
+	legacy := models.AuditLog{
+		Action:       "update",
+		ResourceType: "user",
+		ResourceID:   "2",
+		OldValue:     `{"username":"bob","password":"plain"}`,
+		NewValue:     `{"username":"bobby","password":"plain"}`,
+		TenantID:     1,
+		CreatedAt:    time.Now(),
+	}
+	if err := pkg.AppendAuditLog(db, &legacy); err != nil {
+		t.Fatalf("append legacy log error: %v", err)
+	}
+
+	ac := controllers.AuditController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("tenant_id", uint(1))
+		c.Next()
+	})
+	r.GET("/audit/logs/:id/diff", ac.GetAuditLogDiff)
+
+	var resp struct {
+		OldValue map[string]interface{} `json:"old_value"`
+		Changes  []pkg.AuditFieldChange `json:"changes"`
+		Lines    []string               `json:"lines"`
+	}
+	req, _ := http.NewRequest("GET", "/audit/logs/1/diff", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json unmarshal error: %v", err)
+	}
+	if resp.OldValue["name"] != "calc" || len(resp.Changes) != 2 {
+		t.Fatalf("unexpected diff response: %s", w.Body.String())
+	}
+	if resp.Lines[0] != "~ is_enabled: true -> false" || resp.Lines[1] != `~ name: "calc" -> "calculator"` {
+		t.Fatalf("unexpected rendered lines: %v", resp.Lines)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/audit/logs/%d/diff", legacy.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "plain") {
+		t.Fatalf("legacy password leaked: %s", w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json unmarshal error: %v", err)
+	}
+	if len(resp.Changes) != 1 || resp.Changes[0].Field != "username" {
+		t.Fatalf("unexpected legacy diff: %s", w.Body.String())
+	}
+
+	// 其他租户的审计日志不可见
+	other := models.AuditLog{Action: "create", ResourceType: "note", TenantID: 2}
+	if err := pkg.AppendAuditLog(db, &other); err != nil {
+		t.Fatalf("append other log error: %v", err)
+	}
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/audit/logs/%d/diff", other.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for other tenant, got %d", w.Code)
+	}
+}
+
+func TestAuditControllerExportAuditLogs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+	for _, seed := range []struct {
+		tenantID uint
+		action   string
+	}{{1, "create"}, {1, "update"}, {1, "create"}, {2, "create"}} {
+		log := models.AuditLog{Username: "alice", Action: seed.action, ResourceType: "tool", TenantID: seed.tenantID, NewValue: `{"token":"t"}`}
+		if err := pkg.AppendAuditLog(db, &log); err != nil {
+			t.Fatalf("append log error: %v", err)
+		}
+	}
+
+	ac := controllers.AuditController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("tenant_id", uint(1))
+		c.Next()
+	})
+	r.GET("/audit/export", ac.ExportAuditLogs)
+
+	// CSV按过滤条件导出当前租户的记录
+	req, _ := http.NewRequest("GET", "/audit/export?action=create", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("unexpected csv response: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id,created_at,tenant_id") {
+		t.Fatalf("unexpected csv body: %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), `""t""`) {
+		t.Fatalf("token leaked in export: %s", w.Body.String())
+	}
+
+	// NDJSON每行一条记录，上一次导出本身也记录了审计日志
+	req, _ = http.NewRequest("GET", "/audit/export?format=ndjson", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[3], `"action":"export"`) {
+		t.Fatalf("expected 4 ndjson lines, got %d: %s", len(lines), w.Body.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("ndjson line error: %v", err)
+	}
+	if record["action"] != "update" || record["tenant_id"] != float64(1) {
+		t.Fatalf("unexpected ndjson record: %s", lines[1])
+	}
+
+	req, _ = http.NewRequest("GET", "/audit/export?format=xml", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", w.Code)
+	}
+}
+
+func TestAuditControllerQueryAuditStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+
+	now := time.Now()
+	for _, log := range []models.AuditLog{
+		{TenantID: 1, Username: "alice", Action: "create", ResourceType: "tool", CreatedAt: now.Add(-time.Hour)},
+		{TenantID: 1, Username: "alice", Action: "create", ResourceType: "tool", CreatedAt: now.Add(-2 * time.Hour)},
+		{TenantID: 1, Username: "bob", Action: "delete", ResourceType: "tool", CreatedAt: now.Add(-3 * time.Hour)},
+		{TenantID: 1, Username: "bob", Action: "delete", ResourceType: "tool", CreatedAt: now.AddDate(0, 0, -10)},
+		{TenantID: 2, Username: "mallory", Action: "delete", ResourceType: "tool", CreatedAt: now.Add(-time.Hour)},
+	} {
+		if err := db.Create(&log).Error; err != nil {
+			t.Fatalf("seed error: %v", err)
+		}
+	}
+
+	ac := &controllers.AuditController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("tenant_id", uint(1))
+		c.Next()
+	})
+	r.GET("/audit/stats/query", ac.QueryAuditStats)
+
+	req, _ := http.NewRequest(http.MethodGet, "/audit/stats/query?group_by=action&compare=true", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result pkg.AuditStatsResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if result.Total != 3 || len(result.Rows) != 2 || result.Rows[0].Key["action"] != "create" || result.Rows[0].Count != 2 {
+		t.Fatalf("unexpected stats: %s", w.Body.String())
+	}
+	if result.Previous == nil || result.Previous.Total != 1 || *result.Rows[1].Previous != 1 {
+		t.Fatalf("unexpected comparison: %s", w.Body.String())
+	}
+
+	for _, query := range []string{"group_by=country", "group_by=user&start_time=yesterday", "group_by=user&limit=x"} {
+		req, _ = http.NewRequest(http.MethodGet, "/audit/stats/query?"+query, nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"weave/config"
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/prompt"
+	"weave/test/testutil"
+)
+
+// setupPromptRouter root为平台管理员，alice属于租户5
+func setupPromptRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t, &models.User{}, &models.Tenant{}, &models.AuditLog{}, &models.PromptTemplate{})
+	pkg.DB = db
+	prompt.Invalidate()
+
+	db.Create(&models.User{ID: 1, Username: "root", Password: "x", Email: "root@example.com"})
+	db.Create(&models.User{ID: 2, Username: "alice", Password: "x", Email: "alice@example.com", TenantID: 5})
+	db.Create(&models.Tenant{ID: 5, Name: "Acme", Slug: "acme", Status: models.TenantStatusActive})
+	config.Config.Tenant.PlatformAdmins = []string{"root"}
+	t.Cleanup(func() { config.Config.Tenant.PlatformAdmins = nil })
+
+	pc := controllers.PromptController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		var user models.User
+		db.WithContext(pkg.WithoutTenantScope(c.Request.Context())).First(&user, c.GetHeader("X-User"))
+		c.Set("user_id", user.ID)
+		c.Set("tenant_id", user.TenantID)
+		c.Next()
+	})
+	r.GET("/prompts", pc.GetPrompts)
+	r.GET("/prompts/:name", pc.GetPrompt)
+	r.POST("/prompts/:name/versions", pc.CreatePromptVersion)
+	r.PUT("/prompts/:name/active", pc.ActivatePromptVersion)
+	r.DELETE("/prompts/:name/active", pc.DeactivatePrompt)
+	r.POST("/prompts/:name/render", pc.RenderPrompt)
+	return r
+}
+
+func doPrompt(r *gin.Engine, user, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// renderChatSystem 以alice的身份渲染对话系统提示词
+func renderChatSystem(t *testing.T, r *gin.Engine) string {
+	t.Helper()
+	w := doPrompt(r, "2", http.MethodPost, "/prompts/chat.system/render", `{}`)
+	var resp struct {
+		Rendered string `json:"rendered"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK {
+		t.Fatalf("render failed: %d %s", w.Code, w.Body.String())
+	}
+	return resp.Rendered
+}
+
+func TestPromptVersionsRequirePlatformAdmin(t *testing.T) {
+	r := setupPromptRouter(t)
+
+	if w := doPrompt(r, "2", http.MethodPost, "/prompts/chat.system/versions", `{"content":"hacked"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", w.Code)
+	}
+	if w := doPrompt(r, "2", http.MethodGet, "/prompts?tenant_id=1", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when viewing another tenant, got %d", w.Code)
+	}
+	// 内置模板不能引用未声明的变量
+	if w := doPrompt(r, "1", http.MethodPost, "/prompts/rag.user/versions", `{"content":"{{.question}}"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for undeclared variable, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPromptResolutionOrder(t *testing.T) {
+	r := setupPromptRouter(t)
+	builtin, _ := prompt.Builtin(prompt.ChatSystem)
+	if got := renderChatSystem(t, r); got != builtin.Content {
+		t.Fatalf("expected the builtin prompt, got %q", got)
+	}
+
+	// 平台级版本覆盖内置模板
+	if w := doPrompt(r, "1", http.MethodPost, "/prompts/chat.system/versions", `{"content":"global v1","activate":true}`); w.Code != http.StatusCreated {
+		t.Fatalf("create global version failed: %d %s", w.Code, w.Body.String())
+	}
+	if got := renderChatSystem(t, r); got != "global v1" {
+		t.Fatalf("expected the global version, got %q", got)
+	}
+
+	// 租户版本覆盖平台级版本，未启用的版本不生效
+	doPrompt(r, "1", http.MethodPost, "/prompts/chat.system/versions", `{"content":"acme v1","tenant_id":5}`)
+	if got := renderChatSystem(t, r); got != "global v1" {
+		t.Fatalf("expected inactive tenant version to be ignored, got %q", got)
+	}
+	if w := doPrompt(r, "1", http.MethodPut, "/prompts/chat.system/active", `{"version":1,"tenant_id":5}`); w.Code != http.StatusOK {
+		t.Fatalf("activate failed: %d %s", w.Code, w.Body.String())
+	}
+	if got := renderChatSystem(t, r); got != "acme v1" {
+		t.Fatalf("expected the tenant version, got %q", got)
+	}
+
+	// 租户版本和平台级版本的版本号独立递增
+	w := doPrompt(r, "1", http.MethodPost, "/prompts/chat.system/versions", `{"content":"acme v2","tenant_id":5,"activate":true}`)
+	var created models.PromptTemplate
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Version != 2 || created.Global {
+		t.Fatalf("expected tenant version 2, got %+v", created)
+	}
+
+	w = doPrompt(r, "2", http.MethodGet, "/prompts/chat.system", "")
+	var detail struct {
+		Effective prompt.Template         `json:"effective"`
+		Versions  []models.PromptTemplate `json:"versions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &detail)
+	if detail.Effective.Source != prompt.SourceTenant || detail.Effective.Version != 2 || len(detail.Versions) != 3 {
+		t.Fatalf("unexpected prompt detail: %s", w.Body.String())
+	}
+
+	// 停用租户版本后回到平台级版本
+	if w := doPrompt(r, "1", http.MethodDelete, "/prompts/chat.system/active?tenant_id=5", ""); w.Code != http.StatusOK {
+		t.Fatalf("deactivate failed: %d", w.Code)
+	}
+	if got := renderChatSystem(t, r); got != "global v1" {
+		t.Fatalf("expected the global version after deactivation, got %q", got)
+	}
+	if w := doPrompt(r, "1", http.MethodPut, "/prompts/chat.system/active", `{"version":9}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown version, got %d", w.Code)
+	}
+}
+
+func TestRenderPromptPreview(t *testing.T) {
+	r := setupPromptRouter(t)
+
+	w := doPrompt(r, "2", http.MethodPost, "/prompts/rag.user/render", `{"variables":{"query":"Q","context":"C"}}`)
+	var resp struct {
+		Rendered string `json:"rendered"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || !strings.Contains(resp.Rendered, "C\n\n问题：Q") {
+		t.Fatalf("unexpected render: %d %s", w.Code, w.Body.String())
+	}
+
+	// 预览未保存的内容
+	w = doPrompt(r, "2", http.MethodPost, "/prompts/greeting/render", `{"content":"Hello {{.name}}","variables":{"name":"Bob"}}`)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Rendered != "Hello Bob" {
+		t.Fatalf("unexpected preview: %d %s", w.Code, w.Body.String())
+	}
+
+	// 提供未声明的变量
+	if w := doPrompt(r, "2", http.MethodPost, "/prompts/rag.user/render", `{"variables":{"foo":"bar"}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for undeclared variable, got %d", w.Code)
+	}
+	if w := doPrompt(r, "2", http.MethodPost, "/prompts/unknown/render", `{}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown template, got %d", w.Code)
+	}
+}
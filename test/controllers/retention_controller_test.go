@@ -0,0 +1,149 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"weave/config"
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+	"weave/test/testutil"
+)
+
+func setupRetentionRouter(t *testing.T, userID uint) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t, &models.User{}, &models.AuditLog{}, &models.RetentionPolicy{}, &models.RetentionArchive{})
+	pkg.DB = db
+
+	db.Create(&models.User{ID: 1, Username: "root", Password: "x", Email: "root@example.com"})
+	db.Create(&models.User{ID: 2, Username: "alice", Password: "x", Email: "alice@example.com"})
+	config.Config.Tenant.PlatformAdmins = []string{"root"}
+	config.Config.Retention.LoginHistoryDays = 90
+	t.Cleanup(func() {
+		config.Config.Tenant.PlatformAdmins = nil
+		config.Config.Retention.LoginHistoryDays = 0
+	})
+
+	rc := controllers.RetentionController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("tenant_id", uint(1))
+		c.Next()
+	})
+	r.GET("/retention/policies", rc.GetPolicies)
+	r.PUT("/retention/policies/:resource", rc.UpdatePolicy)
+	r.GET("/retention/archives", rc.GetArchives)
+	r.POST("/retention/restore", rc.RestoreArchives)
+	return r, db
+}
+
+func TestRetentionController_RequiresPlatformAdmin(t *testing.T) {
+	r, _ := setupRetentionRouter(t, 2)
+
+	req, _ := http.NewRequest(http.MethodPut, "/retention/policies/audit_log", strings.NewReader(`{"legal_hold":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestRetentionController_Policies(t *testing.T) {
+	r, db := setupRetentionRouter(t, 1)
+
+	req, _ := http.NewRequest(http.MethodGet, "/retention/policies", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		TenantID uint                     `json:"tenant_id"`
+		Policies []models.RetentionPolicy `json:"policies"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if list.TenantID != 1 || len(list.Policies) != 3 || list.Policies[1].RetentionDays != 90 {
+		t.Fatalf("unexpected default policies: %s", w.Body.String())
+	}
+
+	body := `{"tenant_id":7,"retention_days":30,"legal_hold":true,"legal_hold_reason":"case 42"}`
+	req, _ = http.NewRequest(http.MethodPut, "/retention/policies/audit_log", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var policy models.RetentionPolicy
+	db.Where("tenant_id = ? AND resource = ?", 7, models.RetentionResourceAuditLog).First(&policy)
+	if policy.RetentionDays != 30 || !policy.LegalHold || policy.LegalHoldReason != "case 42" || policy.UpdatedBy != 1 {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+
+	// 解除法律保全时清除原因
+	req, _ = http.NewRequest(http.MethodPut, "/retention/policies/audit_log", strings.NewReader(`{"tenant_id":7,"legal_hold":false}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	db.First(&policy, policy.ID)
+	if w.Code != http.StatusOK || policy.LegalHold || policy.LegalHoldReason != "" || policy.RetentionDays != 30 {
+		t.Fatalf("unexpected policy after release: %d %+v", w.Code, policy)
+	}
+
+	var audit models.AuditLog
+	if err := db.Where("resource_type = ? AND resource_id = ?", "retention_policy", "7/audit_log").First(&audit).Error; err != nil {
+		t.Fatalf("expected policy change to be audited: %v", err)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, "/retention/policies/notes", strings.NewReader(`{"retention_days":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown resource, got %d", w.Code)
+	}
+}
+
+func TestRetentionController_ArchivesAndRestoreValidation(t *testing.T) {
+	r, db := setupRetentionRouter(t, 1)
+	now := time.Now()
+	for i, resource := range []string{models.RetentionResourceAuditLog, models.RetentionResourceLoginHistory} {
+		db.Create(&models.RetentionArchive{TenantID: 1, Resource: resource, FromID: uint(i*10 + 1), ToID: uint(i*10 + 10),
+			FromTime: now, ToTime: now, Count: 10, Storage: "local", Location: "x", SHA256: "y"})
+	}
+	db.Create(&models.RetentionArchive{TenantID: 2, Resource: models.RetentionResourceAuditLog, FromID: 1, ToID: 5,
+		FromTime: now, ToTime: now, Count: 5, Storage: "local", Location: "z", SHA256: "y"})
+
+	req, _ := http.NewRequest(http.MethodGet, "/retention/archives?resource=audit_log", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var page struct {
+		Total    int64                     `json:"total"`
+		Archives []models.RetentionArchive `json:"archives"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if w.Code != http.StatusOK || page.Total != 1 || page.Archives[0].TenantID != 1 {
+		t.Fatalf("unexpected archives: %d %s", w.Code, w.Body.String())
+	}
+
+	body := `{"resource":"audit_log","from":"2025-02-01T00:00:00Z","to":"2025-01-01T00:00:00Z"}`
+	req, _ = http.NewRequest(http.MethodPost, "/retention/restore", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for reversed range, got %d", w.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"weave/config"
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+	"weave/test/testutil"
+)
+
+func setupSecurityRouter(t *testing.T, userID uint) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t, &models.User{}, &models.AuditLog{}, &models.SecurityAlert{})
+	pkg.DB = db
+
+	db.Create(&models.User{ID: 1, Username: "root", Password: "x", Email: "root@example.com"})
+	db.Create(&models.User{ID: 2, Username: "alice", Password: "x", Email: "alice@example.com"})
+	db.Create(&models.User{ID: 3, Username: "bob", Password: "x", Email: "bob@example.com"})
+	config.Config.Tenant.PlatformAdmins = []string{"root"}
+	t.Cleanup(func() { config.Config.Tenant.PlatformAdmins = nil })
+
+	now := time.Now()
+	alerts := []models.SecurityAlert{
+		{TenantID: 1, Rule: "new_ip", Severity: models.AlertSeverityMedium, Status: models.AlertStatusOpen, Username: "alice",
+			Source: "login_history", SourceID: 1, Summary: "alice logged in from a new IP address", Fingerprint: "new_ip:login_history:1", OccurredAt: now},
+		{TenantID: 1, Rule: "mass_deletion", Severity: models.AlertSeverityHigh, Status: models.AlertStatusOpen, UserID: 3, Username: "bob",
+			Source: "audit_log", SourceID: 5, Summary: "bob deleted 20 resources", Fingerprint: "mass_deletion:audit_log:5", OccurredAt: now},
+		{TenantID: 2, Rule: "new_ip", Severity: models.AlertSeverityMedium, Status: models.AlertStatusOpen, Username: "carol",
+			Source: "login_history", SourceID: 2, Summary: "carol logged in from a new IP address", Fingerprint: "new_ip:login_history:2", OccurredAt: now},
+	}
+	for i := range alerts {
+		db.Create(&alerts[i])
+	}
+
+	sc := controllers.SecurityController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("tenant_id", uint(1))
+		c.Next()
+	})
+	r.GET("/security/alerts", sc.GetAlerts)
+	r.GET("/security/alerts/:id", sc.GetAlert)
+	r.PUT("/security/alerts/:id/status", sc.UpdateAlertStatus)
+	r.GET("/security/rules", sc.GetRules)
+	return r, db
+}
+
+func TestSecurityController_GetAlerts(t *testing.T) {
+	r, _ := setupSecurityRouter(t, 2)
+
+	req, _ := http.NewRequest(http.MethodGet, "/security/alerts?severity=high", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var page struct {
+		Total  int64                  `json:"total"`
+		Alerts []models.SecurityAlert `json:"alerts"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if w.Code != http.StatusOK || page.Total != 1 || page.Alerts[0].Rule != "mass_deletion" {
+		t.Fatalf("unexpected alerts: %d %s", w.Code, w.Body.String())
+	}
+
+	// 其他租户的告警需要平台管理员权限
+	req, _ = http.NewRequest(http.MethodGet, "/security/alerts?tenant_id=2", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/security/alerts/3", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for alert of another tenant, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/security/rules", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"login_burst":{"enabled":true,"severity":"high","window":3600,"threshold":3}`) {
+		t.Fatalf("unexpected rules: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSecurityController_UpdateAlertStatus(t *testing.T) {
+	r, db := setupSecurityRouter(t, 2)
+
+	// 不能处理与自己有关的告警
+	req, _ := http.NewRequest(http.MethodPut, "/security/alerts/1/status", strings.NewReader(`{"status":"resolved"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for own alert, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, "/security/alerts/2/status", strings.NewReader(`{"status":"closed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid status, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, "/security/alerts/2/status", strings.NewReader(`{"status":"acknowledged","note":"checking with bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var alert models.SecurityAlert
+	db.First(&alert, 2)
+	if alert.Status != models.AlertStatusAcknowledged || alert.HandledBy != 2 || alert.HandledAt == nil || alert.Note != "checking with bob" {
+		t.Fatalf("unexpected alert: %+v", alert)
+	}
+	var audit models.AuditLog
+	if err := db.Where("resource_type = ? AND resource_id = ?", "security_alert", fmt.Sprint(alert.ID)).First(&audit).Error; err != nil {
+		t.Fatalf("expected status change to be audited: %v", err)
+	}
+
+	// 平台管理员可以处理自己相关的告警
+	r, db = setupSecurityRouter(t, 1)
+	db.Model(&models.SecurityAlert{}).Where("id = ?", 1).Update("username", "root")
+	req, _ = http.NewRequest(http.MethodPut, "/security/alerts/1/status", strings.NewReader(`{"status":"resolved"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected platform admin to resolve alert, got %d", w.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+)
+
+// setupShareDB 初始化共享测试数据：alice(1)拥有笔记n1和限定在团队ops(2)的工具1，bob(2)是团队qa(1)所有者，carol(3)无关
+func setupShareDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Team{}, &models.TeamMember{}, &models.Tool{}, &models.Note{},
+		&models.PluginTeamScope{}, &models.ResourceShare{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+
+	users := []models.User{
+		{ID: 1, Username: "alice", Email: "alice@example.com", Password: "x", TenantID: 1},
+		{ID: 2, Username: "bob", Email: "bob@example.com", Password: "x", TenantID: 1},
+		{ID: 3, Username: "carol", Email: "carol@example.com", Password: "x", TenantID: 1},
+		{ID: 4, Username: "mallory", Email: "mallory@example.com", Password: "x", TenantID: 2},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("seed users error: %v", err)
+	}
+	teams := []models.Team{
+		{ID: 1, Name: "qa", OwnerID: 2, TenantID: 1},
+		{ID: 2, Name: "ops", OwnerID: 1, TenantID: 1},
+	}
+	if err := db.Create(&teams).Error; err != nil {
+		t.Fatalf("seed teams error: %v", err)
+	}
+	members := []models.TeamMember{
+		{TeamID: 1, UserID: 2, Role: "owner", TenantID: 1},
+		{TeamID: 2, UserID: 1, Role: "owner", TenantID: 1},
+	}
+	if err := db.Create(&members).Error; err != nil {
+		t.Fatalf("seed members error: %v", err)
+	}
+	if err := db.Create(&models.Note{ID: "n1", UserID: 1, TenantID: 1, Title: "plan", Content: "..."}).Error; err != nil {
+		t.Fatalf("seed note error: %v", err)
+	}
+	opsTeam := uint(2)
+	if err := db.Create(&models.Tool{ID: 1, Name: "deploy", PluginName: "p", IsEnabled: true, TenantID: 1, OwnerID: 1, TeamID: &opsTeam}).Error; err != nil {
+		t.Fatalf("seed tool error: %v", err)
+	}
+	return db
+}
+
+func shareRouter(userID uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	sc := controllers.ShareController{}
+	tc := controllers.ToolController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("tenant_id", uint(1)); c.Set("user_id", userID); c.Next() })
+	r.GET("/shares/with-me", sc.GetSharedWithMe)
+	r.GET("/shares/:type/:id", sc.GetResourceShares)
+	r.POST("/shares/:type/:id", sc.ShareResource)
+	r.DELETE("/shares/:type/:id/:shareId", sc.RevokeShare)
+	r.GET("/tools/:id", tc.GetTool)
+	r.PUT("/tools/:id", tc.UpdateTool)
+	r.DELETE("/tools/:id", tc.DeleteTool)
+	return r
+}
+
+func TestShare_ToolWriteShare(t *testing.T) {
+	db := setupShareDB(t)
+	alice, bob := shareRouter(1), shareRouter(2)
+
+	// 共享前bob看不到工具
+	if w := doInvitationRequest(bob, http.MethodGet, "/tools/1", ""); w.Code != http.StatusNotFound && w.Code != http.StatusForbidden {
+		t.Fatalf("expected no access before share, got %d", w.Code)
+	}
+
+	w := doInvitationRequest(alice, http.MethodPost, "/shares/tool/1", `{"subject_type":"team","subject_id":1,"level":"write"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 非admin不能管理共享
+	if w := doInvitationRequest(bob, http.MethodPost, "/shares/tool/1", `{"subject_type":"user","subject_id":3,"level":"read"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for write sharer, got %d", w.Code)
+	}
+
+	if w := doInvitationRequest(bob, http.MethodGet, "/tools/1", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 after share, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doInvitationRequest(bob, http.MethodPut, "/tools/1", `{"name":"deploy-v2","description":"d","plugin_name":"p","is_enabled":true,"team_id":2}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for write share update, got %d: %s", w.Code, w.Body.String())
+	}
+	var tool models.Tool
+	db.First(&tool, 1)
+	if tool.Name != "deploy-v2" || tool.OwnerID != 1 {
+		t.Fatalf("unexpected tool after update: %#v", tool)
+	}
+	if w := doInvitationRequest(bob, http.MethodDelete, "/tools/1", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for write share delete, got %d", w.Code)
+	}
+
+	// 所有者删除工具时同时清理共享
+	if w := doInvitationRequest(alice, http.MethodDelete, "/tools/1", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for owner delete, got %d: %s", w.Code, w.Body.String())
+	}
+	var count int64
+	db.Model(&models.ResourceShare{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected shares removed with tool, got %d", count)
+	}
+}
+
+func TestShare_NoteSharedWithMeAndRevoke(t *testing.T) {
+	db := setupShareDB(t)
+	alice, carol := shareRouter(1), shareRouter(3)
+
+	// 不能共享给其他租户的用户
+	if w := doInvitationRequest(alice, http.MethodPost, "/shares/note/n1", `{"subject_type":"user","subject_id":4,"level":"read"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for cross-tenant subject, got %d", w.Code)
+	}
+	// 无权限的用户看不到资源
+	if w := doInvitationRequest(carol, http.MethodGet, "/shares/note/n1", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unrelated user, got %d", w.Code)
+	}
+
+	w := doInvitationRequest(alice, http.MethodPost, "/shares/note/n1", `{"subject_type":"user","subject_id":3,"level":"read"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var share models.ResourceShare
+	_ = json.Unmarshal(w.Body.Bytes(), &share)
+
+	// 重复共享更新权限级别
+	if w := doInvitationRequest(alice, http.MethodPost, "/shares/note/n1", `{"subject_type":"user","subject_id":3,"level":"write"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for share update, got %d", w.Code)
+	}
+
+	w = doInvitationRequest(carol, http.MethodGet, "/shares/with-me", "")
+	var items []map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &items)
+	if w.Code != http.StatusOK || len(items) != 1 || items[0]["resource_id"] != "n1" || items[0]["level"] != "write" {
+		t.Fatalf("unexpected shared-with-me: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doInvitationRequest(alice, http.MethodDelete, "/shares/note/n1/"+jsonID(share.ID), ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for revoke, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doInvitationRequest(carol, http.MethodGet, "/shares/with-me", "")
+	if w.Body.String() != "[]" {
+		t.Fatalf("expected empty shared-with-me after revoke, got %s", w.Body.String())
+	}
+
+	// 未启动审计管道时审计日志同步写入
+	var audits []models.AuditLog
+	db.Where("resource_type = ?", models.ShareResourceNote).Find(&audits)
+	actions := map[string]bool{}
+	for _, a := range audits {
+		actions[a.Action] = true
+	}
+	if len(audits) != 3 || !actions["share"] || !actions["update_share"] || !actions["revoke_share"] {
+		t.Fatalf("unexpected audit actions: %v", actions)
+	}
+}
+
+func jsonID(id uint) string {
+	b, _ := json.Marshal(id)
+	return string(b)
+}
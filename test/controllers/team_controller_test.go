@@ -88,3 +88,38 @@ func TestCreateTeam_DuplicateName(t *testing.T) {
 		t.Fatalf("expected code 'CONFLICT', got %#v", body["code"])
 	}
 }
+
+func TestAddTeamMember_DuplicateReturnsConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupMemoryDBForTeam(t)
+	if err := db.Create(&models.Team{ID: 1, Name: "alpha", TenantID: 5, OwnerID: 7}).Error; err != nil {
+		t.Fatalf("seed team error: %v", err)
+	}
+	if err := db.Create(&models.TeamMember{TeamID: 1, UserID: 7, Role: "owner", TenantID: 5}).Error; err != nil {
+		t.Fatalf("seed member error: %v", err)
+	}
+
+	tc := controllers.TeamController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("tenant_id", uint(5)); c.Set("user_id", uint(7)); c.Next() })
+	r.POST("/teams/:id/members", tc.AddTeamMember)
+
+	add := func() int {
+		req, _ := http.NewRequest(http.MethodPost, "/teams/1/members", strings.NewReader(`{"user_id":8,"role":"member"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := add(); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := add(); code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate member, got %d", code)
+	}
+
+	// 唯一索引直接拒绝绕过接口的重复写入
+	if err := db.Create(&models.TeamMember{TeamID: 1, UserID: 8, Role: "admin", TenantID: 5}).Error; !pkg.IsDuplicateKeyError(err) {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/config"
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+)
+
+// setupHierarchyDB 初始化层级测试数据：部门eng(1)由alice(1)管理，子团队backend(2)由bob(2)所有，carol(3)是独立团队sales(3)的所有者
+func setupHierarchyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Team{}, &models.TeamMember{}, &models.Tool{}, &models.PluginTeamScope{}, &models.ResourceShare{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+	config.Config.Team.MaxDepth = 8
+
+	eng := uint(1)
+	teams := []models.Team{
+		{ID: 1, Name: "eng", OwnerID: 1, TenantID: 1},
+		{ID: 2, Name: "backend", OwnerID: 2, TenantID: 1, ParentID: &eng},
+		{ID: 3, Name: "sales", OwnerID: 3, TenantID: 1},
+	}
+	if err := db.Create(&teams).Error; err != nil {
+		t.Fatalf("seed teams error: %v", err)
+	}
+	members := []models.TeamMember{
+		{TeamID: 1, UserID: 1, Role: "owner", TenantID: 1},
+		{TeamID: 2, UserID: 2, Role: "owner", TenantID: 1},
+		{TeamID: 3, UserID: 3, Role: "owner", TenantID: 1},
+	}
+	if err := db.Create(&members).Error; err != nil {
+		t.Fatalf("seed members error: %v", err)
+	}
+	return db
+}
+
+func hierarchyRouter(userID uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	tc := controllers.TeamController{}
+	toolCtrl := controllers.ToolController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("tenant_id", uint(1)); c.Set("user_id", userID); c.Next() })
+	r.POST("/teams", tc.CreateTeam)
+	r.GET("/teams/tree", tc.GetTeamTree)
+	r.GET("/teams/:id/tree", tc.GetTeamSubtree)
+	r.PUT("/teams/:id/parent", tc.MoveTeam)
+	r.GET("/teams/:id/role", tc.GetMyTeamRole)
+	r.POST("/teams/:id/members", tc.AddTeamMember)
+	r.GET("/tools", toolCtrl.GetTools)
+	r.POST("/tools", toolCtrl.CreateTool)
+	r.POST("/tools/:id/execute", toolCtrl.ExecuteTool)
+	return r
+}
+
+func TestTeamHierarchy_InheritedAdmin(t *testing.T) {
+	setupHierarchyDB(t)
+	alice := hierarchyRouter(1)
+
+	w := doInvitationRequest(alice, http.MethodGet, "/teams/2/role", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var role pkg.TeamRole
+	_ = json.Unmarshal(w.Body.Bytes(), &role)
+	if role.Role != "admin" || !role.Inherited || role.SourceTeamID != 1 {
+		t.Fatalf("unexpected inherited role: %#v", role)
+	}
+
+	// 部门管理员可以管理子团队成员
+	w = doInvitationRequest(alice, http.MethodPost, "/teams/2/members", `{"user_id":3,"role":"member"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for inherited admin, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 子团队所有者不能管理上级部门
+	w = doInvitationRequest(hierarchyRouter(2), http.MethodPost, "/teams/1/members", `{"user_id":3,"role":"member"}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for child owner, got %d", w.Code)
+	}
+}
+
+func TestTeamHierarchy_CreateAndMove(t *testing.T) {
+	db := setupHierarchyDB(t)
+	alice := hierarchyRouter(1)
+
+	w := doInvitationRequest(alice, http.MethodPost, "/teams", `{"name":"api","parent_id":2}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var api models.Team
+	_ = json.Unmarshal(w.Body.Bytes(), &api)
+	if api.ParentID == nil || *api.ParentID != 2 {
+		t.Fatalf("unexpected parent: %#v", api)
+	}
+
+	// 超过层级深度限制
+	config.Config.Team.MaxDepth = 3
+	w = doInvitationRequest(alice, http.MethodPost, "/teams", `{"name":"api-v2","parent_id":`+fmt.Sprint(api.ID)+`}`)
+	config.Config.Team.MaxDepth = 8
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for depth limit, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 非上级团队管理员不能创建子团队
+	w = doInvitationRequest(hierarchyRouter(3), http.MethodPost, "/teams", `{"name":"rogue","parent_id":1}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+
+	// 移动到自己的下级团队形成环
+	w = doInvitationRequest(alice, http.MethodPut, "/teams/1/parent", `{"parent_id":2}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for cycle, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 子团队所有者不是部门管理员，不能将团队移出部门
+	w = doInvitationRequest(hierarchyRouter(2), http.MethodPut, "/teams/2/parent", `{"parent_id":null}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when leaving department, got %d", w.Code)
+	}
+
+	w = doInvitationRequest(alice, http.MethodPut, "/teams/2/parent", `{"parent_id":null}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var backend models.Team
+	db.First(&backend, 2)
+	if backend.ParentID != nil {
+		t.Fatalf("expected backend to become a root team")
+	}
+
+}
+
+func TestTeamHierarchy_TreeListing(t *testing.T) {
+	setupHierarchyDB(t)
+
+	type node struct {
+		ID       uint   `json:"id"`
+		Children []node `json:"children"`
+		Role     *struct {
+			Role string `json:"role"`
+		} `json:"role"`
+	}
+
+	w := doInvitationRequest(hierarchyRouter(1), http.MethodGet, "/teams/tree", "")
+	var forest []node
+	if err := json.Unmarshal(w.Body.Bytes(), &forest); err != nil {
+		t.Fatalf("json unmarshal error: %v", err)
+	}
+	if len(forest) != 1 || forest[0].ID != 1 || len(forest[0].Children) != 1 || forest[0].Children[0].ID != 2 {
+		t.Fatalf("unexpected tree for alice: %s", w.Body.String())
+	}
+
+	// 子团队成员只看到自己的子树
+	w = doInvitationRequest(hierarchyRouter(2), http.MethodGet, "/teams/tree", "")
+	forest = nil
+	_ = json.Unmarshal(w.Body.Bytes(), &forest)
+	if len(forest) != 1 || forest[0].ID != 2 || forest[0].Role == nil || forest[0].Role.Role != "owner" {
+		t.Fatalf("unexpected tree for bob: %s", w.Body.String())
+	}
+
+	w = doInvitationRequest(hierarchyRouter(3), http.MethodGet, "/teams/1/tree", "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for outsider subtree, got %d", w.Code)
+	}
+}
+
+func TestTeamHierarchy_ScopedTools(t *testing.T) {
+	setupHierarchyDB(t)
+
+	// 只有团队管理员可以把工具限定到团队
+	w := doInvitationRequest(hierarchyRouter(3), http.MethodPost, "/tools", `{"name":"deploy","plugin_name":"ops","team_id":1}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+	w = doInvitationRequest(hierarchyRouter(1), http.MethodPost, "/tools", `{"name":"deploy","plugin_name":"ops","team_id":1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var tool models.Tool
+	_ = json.Unmarshal(w.Body.Bytes(), &tool)
+
+	// 子团队成员可用，其他部门成员不可见也不可执行
+	w = doInvitationRequest(hierarchyRouter(2), http.MethodPost, "/tools/1/execute", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for sub-team member, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doInvitationRequest(hierarchyRouter(3), http.MethodPost, "/tools/1/execute", "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for outsider, got %d", w.Code)
+	}
+	w = doInvitationRequest(hierarchyRouter(3), http.MethodGet, "/tools", "")
+	var tools []models.Tool
+	_ = json.Unmarshal(w.Body.Bytes(), &tools)
+	if len(tools) != 0 {
+		t.Fatalf("expected scoped tool to be hidden, got %v", tools)
+	}
+}
@@ -0,0 +1,226 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/config"
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/events"
+)
+
+// setupInvitationDB 初始化邀请测试数据：租户1下的团队，所有者alice(1)，待邀请的bob(2)和carol(3)
+func setupInvitationDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Team{}, &models.TeamMember{}, &models.TeamInvitation{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+	config.Config.Team.InvitationTTL = 24
+
+	users := []models.User{
+		{ID: 1, Username: "alice", Email: "alice@example.com", TenantID: 1},
+		{ID: 2, Username: "bob", Email: "bob@example.com", TenantID: 1},
+		{ID: 3, Username: "carol", Email: "carol@example.com", TenantID: 1},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("seed users error: %v", err)
+	}
+	if err := db.Create(&models.Team{ID: 1, Name: "alpha", OwnerID: 1, TenantID: 1}).Error; err != nil {
+		t.Fatalf("seed team error: %v", err)
+	}
+	if err := db.Create(&models.TeamMember{TeamID: 1, UserID: 1, Role: "owner", TenantID: 1}).Error; err != nil {
+		t.Fatalf("seed member error: %v", err)
+	}
+	return db
+}
+
+func invitationRouter(userID uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	tc := controllers.TeamController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("tenant_id", uint(1)); c.Set("user_id", userID); c.Next() })
+	r.POST("/teams/:id/invitations", tc.InviteTeamMember)
+	r.GET("/teams/:id/invitations", tc.GetTeamInvitations)
+	r.DELETE("/teams/:id/invitations/:invitationId", tc.RevokeTeamInvitation)
+	r.GET("/invitations", tc.GetMyInvitations)
+	r.POST("/invitations/:id/accept", tc.AcceptInvitation)
+	r.POST("/invitations/:id/decline", tc.DeclineInvitation)
+	return r
+}
+
+func doInvitationRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTeamInvitation_InviteAndAccept(t *testing.T) {
+	db := setupInvitationDB(t)
+
+	var received []string
+	events.Subscribe(events.Wildcard, func(e events.Event) {
+		if strings.HasPrefix(e.Type, "team.invitation.") {
+			received = append(received, e.Type)
+		}
+	})
+
+	w := doInvitationRequest(invitationRouter(1), http.MethodPost, "/teams/1/invitations", `{"username":"bob","role":"admin"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var invitation models.TeamInvitation
+	if err := json.Unmarshal(w.Body.Bytes(), &invitation); err != nil {
+		t.Fatalf("json unmarshal error: %v", err)
+	}
+	if invitation.Status != models.InvitationStatusPending || invitation.InviteeUserID == nil || *invitation.InviteeUserID != 2 {
+		t.Fatalf("unexpected invitation: %#v", invitation)
+	}
+
+	// 邀请未接受前不应成为成员
+	var count int64
+	db.Model(&models.TeamMember{}).Where("team_id = 1 AND user_id = 2").Count(&count)
+	if count != 0 {
+		t.Fatalf("invitee should not be a member before accepting")
+	}
+
+	// 重复邀请被拒绝
+	w = doInvitationRequest(invitationRouter(1), http.MethodPost, "/teams/1/invitations", `{"username":"bob","role":"member"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate invitation, got %d", w.Code)
+	}
+
+	bob := invitationRouter(2)
+	w = doInvitationRequest(bob, http.MethodGet, "/invitations", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"team_name":"alpha"`) {
+		t.Fatalf("expected bob to see the invitation, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 其他用户不能代为接受
+	w = doInvitationRequest(invitationRouter(3), http.MethodPost, fmt.Sprintf("/invitations/%d/accept", invitation.ID), "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for other user, got %d", w.Code)
+	}
+
+	w = doInvitationRequest(bob, http.MethodPost, fmt.Sprintf("/invitations/%d/accept", invitation.ID), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var member models.TeamMember
+	if err := db.Where("team_id = 1 AND user_id = 2").First(&member).Error; err != nil {
+		t.Fatalf("expected bob to be a member: %v", err)
+	}
+	if member.Role != "admin" {
+		t.Fatalf("expected role admin, got %s", member.Role)
+	}
+
+	// 已接受的邀请不能再次响应
+	w = doInvitationRequest(bob, http.MethodPost, fmt.Sprintf("/invitations/%d/decline", invitation.ID), "")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for responded invitation, got %d", w.Code)
+	}
+
+	if len(received) != 2 || received[0] != pkg.EventTeamInvitationCreated || received[1] != pkg.EventTeamInvitationAccepted {
+		t.Fatalf("unexpected events: %v", received)
+	}
+}
+
+func TestTeamInvitation_EmailDeclineAndRevoke(t *testing.T) {
+	db := setupInvitationDB(t)
+	owner := invitationRouter(1)
+
+	// 邮箱尚未注册的邀请
+	w := doInvitationRequest(owner, http.MethodPost, "/teams/1/invitations", `{"email":"Dave@Example.com","role":"member"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var byEmail models.TeamInvitation
+	_ = json.Unmarshal(w.Body.Bytes(), &byEmail)
+	if byEmail.InviteeUserID != nil || byEmail.InviteeEmail != "dave@example.com" {
+		t.Fatalf("unexpected email invitation: %#v", byEmail)
+	}
+
+	w = doInvitationRequest(owner, http.MethodDelete, fmt.Sprintf("/teams/1/invitations/%d", byEmail.ID), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on revoke, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 非管理员不能邀请
+	w = doInvitationRequest(invitationRouter(3), http.MethodPost, "/teams/1/invitations", `{"username":"bob","role":"member"}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", w.Code)
+	}
+
+	w = doInvitationRequest(owner, http.MethodPost, "/teams/1/invitations", `{"email":"carol@example.com","role":"member"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var forCarol models.TeamInvitation
+	_ = json.Unmarshal(w.Body.Bytes(), &forCarol)
+
+	w = doInvitationRequest(invitationRouter(3), http.MethodPost, fmt.Sprintf("/invitations/%d/decline", forCarol.ID), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on decline, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var statuses []string
+	db.Model(&models.TeamInvitation{}).Order("id").Pluck("status", &statuses)
+	if len(statuses) != 2 || statuses[0] != models.InvitationStatusRevoked || statuses[1] != models.InvitationStatusDeclined {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
+
+func TestTeamInvitation_ExpireCleanup(t *testing.T) {
+	db := setupInvitationDB(t)
+	bobID := uint(2)
+	now := time.Now()
+
+	seed := []models.TeamInvitation{
+		{TeamID: 1, TenantID: 1, InviterID: 1, InviteeUserID: &bobID, Role: "member", Status: models.InvitationStatusPending, ExpiresAt: now.Add(-time.Hour)},
+		{TeamID: 1, TenantID: 1, InviterID: 1, InviteeEmail: "x@example.com", Role: "member", Status: models.InvitationStatusPending, ExpiresAt: now.Add(time.Hour)},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("seed invitations error: %v", err)
+	}
+
+	// 过期邀请不可接受
+	w := doInvitationRequest(invitationRouter(2), http.MethodPost, fmt.Sprintf("/invitations/%d/accept", seed[0].ID), "")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for expired invitation, got %d", w.Code)
+	}
+
+	count, err := pkg.ExpireTeamInvitations(context.Background(), now)
+	if err != nil {
+		t.Fatalf("expire error: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 expired invitation, got %d", count)
+	}
+
+	var expired, pending models.TeamInvitation
+	db.First(&expired, seed[0].ID)
+	db.First(&pending, seed[1].ID)
+	if expired.Status != models.InvitationStatusExpired || pending.Status != models.InvitationStatusPending {
+		t.Fatalf("unexpected statuses after cleanup: %s, %s", expired.Status, pending.Status)
+	}
+}
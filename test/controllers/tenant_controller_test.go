@@ -0,0 +1,171 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/config"
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+)
+
+func setupTenantRouter(t *testing.T, userID uint) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Tenant{}, &models.AuditLog{}, &models.TenantLLMConfig{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+
+	db.Create(&models.User{ID: 1, Username: "root", Password: "x", Email: "root@example.com"})
+	db.Create(&models.User{ID: 2, Username: "alice", Password: "x", Email: "alice@example.com"})
+	config.Config.Tenant.PlatformAdmins = []string{"root"}
+	t.Cleanup(func() { config.Config.Tenant.PlatformAdmins = nil })
+
+	tc := controllers.TenantController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("tenant_id", uint(0))
+		c.Next()
+	})
+	r.GET("/tenants", tc.GetTenants)
+	r.POST("/tenants", tc.CreateTenant)
+	r.POST("/tenants/:id/suspend", tc.SuspendTenant)
+	r.DELETE("/tenants/:id", tc.DeleteTenant)
+	r.GET("/tenants/:id/llm", tc.GetTenantLLMConfig)
+	r.PUT("/tenants/:id/llm", tc.UpdateTenantLLMConfig)
+	return r, db
+}
+
+func TestCreateTenant_RequiresPlatformAdmin(t *testing.T) {
+	r, _ := setupTenantRouter(t, 2)
+
+	body := `{"name":"Acme","slug":"acme"}`
+	req, _ := http.NewRequest(http.MethodPost, "/tenants", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestTenantLifecycle(t *testing.T) {
+	r, db := setupTenantRouter(t, 1)
+
+	// 创建
+	req, _ := http.NewRequest(http.MethodPost, "/tenants", strings.NewReader(`{"name":"Acme","slug":"acme"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var tenant models.Tenant
+	if err := json.Unmarshal(w.Body.Bytes(), &tenant); err != nil {
+		t.Fatalf("json unmarshal error: %v", err)
+	}
+	if tenant.Status != models.TenantStatusActive {
+		t.Fatalf("expected active tenant, got %s", tenant.Status)
+	}
+
+	// 标识重复
+	req, _ = http.NewRequest(http.MethodPost, "/tenants", strings.NewReader(`{"name":"Acme 2","slug":"acme"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate slug, got %d", w.Code)
+	}
+
+	// 暂停
+	req, _ = http.NewRequest(http.MethodPost, "/tenants/1/suspend", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if err := pkg.CheckTenantActive(req.Context(), tenant.ID); err == nil {
+		t.Fatalf("expected suspended tenant to be rejected")
+	}
+
+	// 删除
+	req, _ = http.NewRequest(http.MethodDelete, "/tenants/1", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var deleted models.Tenant
+	db.Unscoped().First(&deleted, tenant.ID)
+	if deleted.Status != models.TenantStatusDeleted || !deleted.DeletedAt.Valid {
+		t.Fatalf("expected tenant soft deleted, got %#v", deleted)
+	}
+}
+
+func TestTenantLLMConfig(t *testing.T) {
+	r, db := setupTenantRouter(t, 1)
+	oldLLM := config.Config.LLM
+	config.Config.LLM = config.LLMConfig{
+		Providers: []config.LLMProviderConfig{{Name: "local", Type: "fake", Model: "llama"}, {Name: "cloud", Type: "fake", Model: "gpt"}},
+		Aliases:   map[string]string{"smart": "cloud"},
+		Default:   "local",
+	}
+	t.Cleanup(func() { config.Config.LLM = oldLLM })
+	db.Create(&models.Tenant{ID: 7, Name: "Acme", Slug: "acme", Status: models.TenantStatusActive})
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPut, "/tenants/7/llm", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := put(`{"default_model":"smart","routes":{"rag":"missing"}}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"field":"routes.rag"`) {
+		t.Fatalf("expected 400 for unknown model, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := put(`{"default_model":"smart","fallback_model":"local","routes":{"rag":"local/mistral"}}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/tenants/7/llm", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct {
+		Override  models.TenantLLMConfig `json:"override"`
+		Effective map[string][]struct {
+			Provider string `json:"provider"`
+			Model    string `json:"model"`
+		} `json:"effective"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Override.DefaultModel != "smart" {
+		t.Fatalf("unexpected llm config: %d %s", w.Code, w.Body.String())
+	}
+	if chat := resp.Effective["chat"]; len(chat) != 2 || chat[0].Provider != "cloud" || chat[1].Provider != "local" {
+		t.Fatalf("unexpected effective chat models: %s", w.Body.String())
+	}
+	if rag := resp.Effective["rag"]; len(rag) != 2 || rag[0].Model != "mistral" {
+		t.Fatalf("unexpected effective rag models: %s", w.Body.String())
+	}
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "update_llm_config").Count(&audits)
+	if audits != 1 {
+		t.Fatalf("expected one audit entry, got %d", audits)
+	}
+}
@@ -22,7 +22,7 @@ func setupMemoryDBForTool(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("gorm open error: %v", err)
 	}
-	if err := db.AutoMigrate(&models.Tool{}); err != nil {
+	if err := db.AutoMigrate(&models.Tool{}, &models.Team{}, &models.TeamMember{}, &models.PluginTeamScope{}, &models.ResourceShare{}); err != nil {
 		t.Fatalf("auto migrate tool error: %v", err)
 	}
 	pkg.DB = db
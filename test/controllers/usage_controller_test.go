@@ -0,0 +1,84 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"weave/config"
+	"weave/controllers"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/llmusage"
+	"weave/test/testutil"
+)
+
+// setupLLMUsageRouter root为平台管理员，alice属于租户5；两个租户各有一条用量记录
+func setupLLMUsageRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t, &models.User{}, &models.LLMUsage{})
+	pkg.DB = db
+
+	db.Create(&models.User{ID: 1, Username: "root", Password: "x", Email: "root@example.com"})
+	db.Create(&models.User{ID: 2, Username: "alice", Password: "x", Email: "alice@example.com", TenantID: 5})
+	config.Config.Tenant.PlatformAdmins = []string{"root"}
+	t.Cleanup(func() { config.Config.Tenant.PlatformAdmins = nil })
+
+	target := llmprovider.Target{Provider: "local", Model: "llama"}
+	llmusage.Record(context.Background(), llmusage.Entry{TenantID: 5, UserID: 2, Source: llmusage.SourceChat, Target: target, Tokens: llmusage.Tokens{Prompt: 40, Completion: 2}})
+	llmusage.Record(context.Background(), llmusage.Entry{TenantID: 0, UserID: 1, Source: llmusage.SourceRAG, Target: target, Tokens: llmusage.Tokens{Prompt: 900}})
+
+	uc := controllers.UsageController{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		var user models.User
+		db.WithContext(pkg.WithoutTenantScope(c.Request.Context())).First(&user, c.GetHeader("X-User"))
+		c.Set("user_id", user.ID)
+		c.Set("tenant_id", user.TenantID)
+		c.Next()
+	})
+	r.GET("/usage/llm", uc.GetLLMUsage)
+	return r
+}
+
+func getLLMUsage(r *gin.Engine, user, query string) (*httptest.ResponseRecorder, llmusage.Report) {
+	req, _ := http.NewRequest(http.MethodGet, "/usage/llm"+query, nil)
+	req.Header.Set("X-User", user)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct {
+		Report llmusage.Report `json:"report"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp.Report
+}
+
+func TestGetLLMUsage(t *testing.T) {
+	r := setupLLMUsageRouter(t)
+
+	// 默认查看当前租户，按模型分组
+	w, report := getLLMUsage(r, "2", "")
+	if w.Code != http.StatusOK || report.GroupBy != "model" || len(report.Rows) != 1 || report.Total.TotalTokens != 42 {
+		t.Fatalf("unexpected report: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := getLLMUsage(r, "2", "?tenant_id=0"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when viewing another tenant, got %d", w.Code)
+	}
+	if w, _ := getLLMUsage(r, "2", "?group_by=tenant"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown grouping, got %d", w.Code)
+	}
+
+	// 平台管理员可以查看其他租户
+	w, report = getLLMUsage(r, "1", "?tenant_id=5&group_by=user")
+	if w.Code != http.StatusOK || len(report.Rows) != 1 || report.Rows[0].Group != "2" {
+		t.Fatalf("unexpected admin report: %d %s", w.Code, w.Body.String())
+	}
+	if _, report := getLLMUsage(r, "1", "?group_by=source"); len(report.Rows) != 1 || report.Rows[0].Group != "rag" {
+		t.Fatalf("expected the admin's own tenant by default, got %+v", report.Rows)
+	}
+}
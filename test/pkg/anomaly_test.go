@@ -0,0 +1,210 @@
+package pkg_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"weave/models"
+	"weave/pkg/anomaly"
+	"weave/pkg/auditsink"
+	"weave/pkg/events"
+	"weave/test/testutil"
+)
+
+func setupAnomalyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return testutil.OpenDB(t, &models.LoginHistory{}, &models.AuditLog{}, &models.SecurityAlert{}, &models.AnomalyCursor{})
+}
+
+func alertsByRule(t *testing.T, db *gorm.DB, rule string) []models.SecurityAlert {
+	t.Helper()
+	var alerts []models.SecurityAlert
+	if err := db.Where("rule = ?", rule).Order("id").Find(&alerts).Error; err != nil {
+		t.Fatalf("query alerts error: %v", err)
+	}
+	return alerts
+}
+
+// 全局事件总线无法取消订阅，测试只订阅一次并按告警ID查找
+var (
+	alertEventsOnce sync.Once
+	alertEventsMu   sync.Mutex
+	alertEvents     = make(map[uint]events.Event)
+)
+
+func recordAlertEvents() {
+	alertEventsOnce.Do(func() {
+		events.Subscribe(anomaly.EventAlertCreated, func(e events.Event) {
+			id, _ := e.Payload["alert_id"].(uint)
+			alertEventsMu.Lock()
+			alertEvents[id] = e
+			alertEventsMu.Unlock()
+		})
+	})
+}
+
+func TestAnomalyLoginRules(t *testing.T) {
+	recordAlertEvents()
+	db := setupAnomalyDB(t)
+	base := time.Now().Add(-2 * time.Hour)
+	logins := []models.LoginHistory{
+		// 第一次登录只作为基线
+		{Username: "alice", TenantID: 1, Success: true, IPAddress: "10.0.0.1", UserAgent: "firefox", LoginTime: base},
+		{Username: "alice", TenantID: 1, Success: true, IPAddress: "10.0.0.1", UserAgent: "firefox", LoginTime: base.Add(time.Minute)},
+		// 新客户端
+		{Username: "alice", TenantID: 1, Success: true, IPAddress: "10.0.0.1", UserAgent: "curl", LoginTime: base.Add(2 * time.Minute)},
+		// 失败的登录不参与检测
+		{Username: "alice", TenantID: 1, Success: false, IPAddress: "203.0.113.9", UserAgent: "curl", LoginTime: base.Add(3 * time.Minute)},
+		// 新IP，一小时内第二个网段
+		{Username: "alice", TenantID: 1, Success: true, IPAddress: "172.16.5.5", UserAgent: "firefox", LoginTime: base.Add(4 * time.Minute)},
+		// 第三个网段达到阈值
+		{Username: "alice", TenantID: 1, Success: true, IPAddress: "192.168.1.1", UserAgent: "firefox", LoginTime: base.Add(5 * time.Minute)},
+		// 第四个网段不再重复告警
+		{Username: "alice", TenantID: 1, Success: true, IPAddress: "198.51.100.1", UserAgent: "firefox", LoginTime: base.Add(6 * time.Minute)},
+		// 其他租户的同名用户独立计算基线
+		{Username: "alice", TenantID: 2, Success: true, IPAddress: "8.8.8.8", UserAgent: "chrome", LoginTime: base},
+	}
+	for i := range logins {
+		db.Create(&logins[i])
+	}
+
+	detector := anomaly.NewDetector(db, anomaly.Options{BatchSize: 3})
+	total := 0
+	for i := 0; i < 4; i++ {
+		count, err := detector.Run(context.Background())
+		if err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		total += count
+	}
+	if total != 5 {
+		t.Fatalf("expected 5 alerts, got %d", total)
+	}
+
+	if alerts := alertsByRule(t, db, anomaly.RuleNewUserAgent); len(alerts) != 1 || alerts[0].SourceID != logins[2].ID || alerts[0].Severity != models.AlertSeverityLow {
+		t.Fatalf("unexpected new user agent alerts: %+v", alerts)
+	}
+	newIP := alertsByRule(t, db, anomaly.RuleNewIP)
+	if len(newIP) != 3 || newIP[0].SourceID != logins[4].ID || newIP[0].TenantID != 1 {
+		t.Fatalf("unexpected new ip alerts: %+v", newIP)
+	}
+	burst := alertsByRule(t, db, anomaly.RuleLoginBurst)
+	if len(burst) != 1 || burst[0].SourceID != logins[5].ID || burst[0].Severity != models.AlertSeverityHigh {
+		t.Fatalf("unexpected login burst alerts: %+v", burst)
+	}
+	var details map[string]interface{}
+	json.Unmarshal([]byte(burst[0].Details), &details)
+	if networks, _ := details["networks"].([]interface{}); len(networks) != 3 {
+		t.Fatalf("unexpected burst details: %s", burst[0].Details)
+	}
+
+	alertEventsMu.Lock()
+	event, ok := alertEvents[burst[0].ID]
+	alertEventsMu.Unlock()
+	if !ok || event.TenantID != 1 || event.Payload["rule"] != anomaly.RuleLoginBurst {
+		t.Fatalf("expected alert event to be published, got %+v", event)
+	}
+
+	// 游标已推进到最后一条记录，重复执行不会重复告警
+	if cursor, _ := anomaly.LoadCursor(db, anomaly.SourceLoginHistory); cursor != logins[len(logins)-1].ID {
+		t.Fatalf("unexpected cursor %d", cursor)
+	}
+	db.Where("source = ?", anomaly.SourceLoginHistory).Delete(&models.AnomalyCursor{})
+	if count, err := detector.Run(context.Background()); err != nil || count != 0 {
+		t.Fatalf("expected rescanning to be deduplicated, got %d, %v", count, err)
+	}
+}
+
+func TestAnomalyAuditRules(t *testing.T) {
+	db := setupAnomalyDB(t)
+	now := time.Now().Add(-time.Hour)
+	for i := 0; i < 25; i++ {
+		db.Create(&models.AuditLog{TenantID: 1, UserID: 7, Username: "mallory", Action: "delete", ResourceType: "tool",
+			CreatedAt: now.Add(time.Duration(i) * time.Second)})
+	}
+	// 超过窗口的删除重新计数
+	for i := 0; i < 19; i++ {
+		db.Create(&models.AuditLog{TenantID: 1, UserID: 7, Username: "mallory", Action: "delete_member", ResourceType: "team",
+			CreatedAt: now.Add(30 * time.Minute)})
+	}
+	db.Create(&models.AuditLog{TenantID: 1, UserID: 8, Username: "bob", Action: "update_member_role", ResourceType: "team", ResourceID: "3",
+		OldValue: `{"user_id":9,"role":"member"}`, NewValue: `{"user_id":9,"role":"admin"}`, CreatedAt: now})
+	db.Create(&models.AuditLog{TenantID: 1, UserID: 8, Username: "bob", Action: "update_member_role", ResourceType: "team", ResourceID: "3",
+		OldValue: `{"user_id":9,"role":"admin"}`, NewValue: `{"user_id":9,"role":"member"}`, CreatedAt: now})
+	db.Create(&models.AuditLog{TenantID: 2, UserID: 8, Username: "bob", Action: "transfer_ownership", ResourceType: "team", ResourceID: "4",
+		NewValue: `{"owner_id":10}`, CreatedAt: now})
+	// 未超过等待时间的记录留到下次检测
+	db.Create(&models.AuditLog{TenantID: 1, UserID: 8, Username: "bob", Action: "transfer_ownership", ResourceType: "team", ResourceID: "5",
+		NewValue: `{"owner_id":11}`, CreatedAt: time.Now()})
+
+	detector := anomaly.NewDetector(db, anomaly.Options{Settle: time.Minute})
+	count, err := detector.Run(context.Background())
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 alerts, got %d, %v", count, err)
+	}
+
+	mass := alertsByRule(t, db, anomaly.RuleMassDeletion)
+	if len(mass) != 1 || mass[0].SourceID != 20 || mass[0].UserID != 7 {
+		t.Fatalf("unexpected mass deletion alerts: %+v", mass)
+	}
+	escalations := alertsByRule(t, db, anomaly.RulePrivilegeEscalation)
+	if len(escalations) != 2 || escalations[0].Username != "bob" || escalations[1].TenantID != 2 {
+		t.Fatalf("unexpected privilege escalation alerts: %+v", escalations)
+	}
+
+	var last models.AuditLog
+	db.Order("id DESC").First(&last)
+	if cursor, _ := anomaly.LoadCursor(db, anomaly.SourceAuditLog); cursor != last.ID-1 {
+		t.Fatalf("expected cursor to stop before unsettled log, got %d", cursor)
+	}
+}
+
+func TestAnomalyWebhookNotifier(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	notifier := anomaly.NewWebhookNotifier(server.URL, "secret", models.AlertSeverityHigh)
+	notifier.Handle(events.Event{Type: anomaly.EventAlertCreated, Payload: map[string]interface{}{"severity": models.AlertSeverityMedium}})
+	notifier.Handle(events.Event{Type: anomaly.EventAlertCreated, TenantID: 1, Payload: map[string]interface{}{"severity": models.AlertSeverityCritical, "rule": "new_ip"}})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if r.Header.Get(auditsink.SignatureHeader) != "sha256="+auditsink.SignPayload("secret", body) {
+			t.Fatalf("unexpected signature %q", r.Header.Get(auditsink.SignatureHeader))
+		}
+		var event events.Event
+		if err := json.Unmarshal(body, &event); err != nil || event.Payload["severity"] != models.AlertSeverityCritical {
+			t.Fatalf("unexpected notification body: %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("notification was not delivered")
+	}
+	select {
+	case <-received:
+		t.Fatalf("alert below the minimum severity was delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := anomaly.NewWebhookNotifier(failing.URL, "", models.AlertSeverityLow).Send(context.Background(), events.Event{}); err == nil {
+		t.Fatalf("expected error for non-2xx response")
+	}
+}
@@ -0,0 +1,163 @@
+package pkg_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+)
+
+// setupAuditChainDB 为租户1追加5条、租户2追加2条链上审计日志，另有一条引入哈希链之前的历史记录
+func setupAuditChainDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}, &models.AuditCheckpoint{}, &models.RetentionArchive{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+	config.Config.Audit.CheckpointSecret = "test-checkpoint-secret"
+
+	if err := db.Create(&models.AuditLog{Action: "legacy", TenantID: 1}).Error; err != nil {
+		t.Fatalf("seed legacy log error: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		log := models.AuditLog{UserID: 1, Username: "alice", Action: "update", ResourceType: "tool", ResourceID: fmt.Sprint(i), TenantID: 1}
+		if err := pkg.AppendAuditLog(db, &log); err != nil {
+			t.Fatalf("append log error: %v", err)
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		log := models.AuditLog{UserID: 2, Username: "bob", Action: "create", ResourceType: "note", TenantID: 2}
+		if err := pkg.AppendAuditLog(db, &log); err != nil {
+			t.Fatalf("append log error: %v", err)
+		}
+	}
+	return db
+}
+
+func verifyChain(t *testing.T, db *gorm.DB, tenantID uint) *pkg.AuditVerifyResult {
+	t.Helper()
+	result, err := pkg.VerifyAuditChain(db, tenantID)
+	if err != nil {
+		t.Fatalf("verify error: %v", err)
+	}
+	return result
+}
+
+func TestAuditChain_AppendAndVerify(t *testing.T) {
+	db := setupAuditChainDB(t)
+
+	result := verifyChain(t, db, 1)
+	if !result.Valid || result.Entries != 5 || result.HeadSequence != 5 || result.Unchained != 1 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+	if result := verifyChain(t, db, 2); !result.Valid || result.Entries != 2 {
+		t.Fatalf("unexpected tenant 2 result: %#v", result)
+	}
+
+	var first, second models.AuditLog
+	db.Where("tenant_id = 1 AND sequence = 1").First(&first)
+	db.Where("tenant_id = 1 AND sequence = 2").First(&second)
+	if first.PrevHash != "" || second.PrevHash != first.Hash || len(second.Hash) != 64 {
+		t.Fatalf("unexpected chain links: %#v %#v", first, second)
+	}
+}
+
+func TestAuditChain_AppendOnly(t *testing.T) {
+	db := setupAuditChainDB(t)
+
+	var log models.AuditLog
+	db.Where("tenant_id = 1 AND sequence = 1").First(&log)
+	if err := db.Model(&log).Update("action", "noop").Error; !errors.Is(err, models.ErrAuditLogImmutable) {
+		t.Fatalf("expected immutable error on update, got %v", err)
+	}
+	if err := db.Delete(&log).Error; !errors.Is(err, models.ErrAuditLogImmutable) {
+		t.Fatalf("expected immutable error on delete, got %v", err)
+	}
+}
+
+func TestAuditChain_DetectsTampering(t *testing.T) {
+	db := setupAuditChainDB(t)
+
+	// 绕过ORM直接修改记录内容
+	db.Exec("UPDATE audit_logs SET new_value = ? WHERE tenant_id = 1 AND sequence = 3", `{"forged":true}`)
+	result := verifyChain(t, db, 1)
+	if result.Valid || result.FirstBroken == nil || result.FirstBroken.Sequence != 3 || result.FirstBroken.Reason != pkg.AuditBreakHashMismatch {
+		t.Fatalf("expected hash mismatch at 3, got %#v", result.FirstBroken)
+	}
+	if result.Entries != 2 {
+		t.Fatalf("expected 2 verified entries before the break, got %d", result.Entries)
+	}
+
+	// 删除中间记录
+	db = setupAuditChainDB(t)
+	db.Exec("DELETE FROM audit_logs WHERE tenant_id = 1 AND sequence = 2")
+	result = verifyChain(t, db, 1)
+	if result.Valid || result.FirstBroken.Sequence != 2 || result.FirstBroken.Reason != pkg.AuditBreakSequenceGap {
+		t.Fatalf("expected sequence gap at 2, got %#v", result.FirstBroken)
+	}
+	// 其他租户不受影响
+	if result := verifyChain(t, db, 2); !result.Valid {
+		t.Fatalf("expected tenant 2 chain valid, got %#v", result.FirstBroken)
+	}
+}
+
+func TestAuditChain_Checkpoints(t *testing.T) {
+	db := setupAuditChainDB(t)
+
+	cp, err := pkg.CreateAuditCheckpoint(db, 1)
+	if err != nil || cp == nil || cp.Sequence != 5 {
+		t.Fatalf("unexpected checkpoint: %#v, %v", cp, err)
+	}
+	// 链头没有变化时不重复生成
+	if again, err := pkg.CreateAuditCheckpoint(db, 1); err != nil || again != nil {
+		t.Fatalf("expected no new checkpoint, got %#v, %v", again, err)
+	}
+	if result := verifyChain(t, db, 1); !result.Valid || result.Checkpoints != 1 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+
+	// 截断链尾：剩余记录本身是连续的，只能通过检查点发现
+	db.Exec("DELETE FROM audit_logs WHERE tenant_id = 1 AND sequence >= 4")
+	result := verifyChain(t, db, 1)
+	if result.Valid || result.FirstBroken.Reason != pkg.AuditBreakTruncated || result.FirstBroken.Sequence != 5 {
+		t.Fatalf("expected truncation at 5, got %#v", result.FirstBroken)
+	}
+
+	// 整链重算：每条记录的哈希都自洽，但与签名检查点不一致
+	db = setupAuditChainDB(t)
+	if _, err := pkg.CreateAuditCheckpoints(t.Context()); err != nil {
+		t.Fatalf("create checkpoints error: %v", err)
+	}
+	var logs []models.AuditLog
+	db.Where("tenant_id = 1 AND sequence > 0").Order("sequence ASC").Find(&logs)
+	prev := ""
+	for _, log := range logs {
+		log.ResourceID = "rewritten"
+		log.PrevHash = prev
+		log.Hash = pkg.ComputeAuditHash(&log)
+		db.Exec("UPDATE audit_logs SET resource_id = ?, prev_hash = ?, hash = ? WHERE id = ?", log.ResourceID, log.PrevHash, log.Hash, log.ID)
+		prev = log.Hash
+	}
+	result = verifyChain(t, db, 1)
+	if result.Valid || result.FirstBroken.Reason != pkg.AuditBreakCheckpointHash || result.FirstBroken.Sequence != 5 {
+		t.Fatalf("expected checkpoint mismatch at 5, got %#v", result.FirstBroken)
+	}
+
+	// 伪造检查点签名
+	db.Exec("UPDATE audit_checkpoint SET signature = ? WHERE tenant_id = 2", "deadbeef")
+	result = verifyChain(t, db, 2)
+	if result.Valid || result.FirstBroken.Reason != pkg.AuditBreakCheckpointInvalid {
+		t.Fatalf("expected invalid checkpoint signature, got %#v", result.FirstBroken)
+	}
+}
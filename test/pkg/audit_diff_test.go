@@ -0,0 +1,155 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/models"
+	"weave/pkg"
+)
+
+func TestRedactAuditValueMasksSensitiveFields(t *testing.T) {
+	value := map[string]interface{}{
+		"username":   "alice",
+		"password":   "hunter2",
+		"api_key":    "sk-123",
+		"max_tokens": 100,
+		"settings": map[string]interface{}{
+			"AccessToken": "abc",
+			"theme":       "dark",
+		},
+		"webhooks": []interface{}{map[string]interface{}{"url": "https://example.com", "secret": "s"}},
+		"token":    "",
+	}
+	out, err := pkg.RedactAuditValue(value)
+	if err != nil {
+		t.Fatalf("redact error: %v", err)
+	}
+	for _, leaked := range []string{"hunter2", "sk-123", "abc", `"s"`} {
+		if strings.Contains(out, leaked) {
+			t.Fatalf("sensitive value %s leaked: %s", leaked, out)
+		}
+	}
+	for _, kept := range []string{"alice", "dark", "https://example.com", `"max_tokens":100`, `"token":""`} {
+		if !strings.Contains(out, kept) {
+			t.Fatalf("expected %s to be kept: %s", kept, out)
+		}
+	}
+
+	// 已序列化的JSON字符串同样脱敏
+	out, err = pkg.RedactAuditValue(`{"password":"x","name":"n"}`)
+	if err != nil || out != `{"name":"n","password":"[REDACTED]"}` {
+		t.Fatalf("unexpected redacted string: %s, %v", out, err)
+	}
+	if out, err := pkg.RedactAuditValue(nil); err != nil || out != "" {
+		t.Fatalf("expected empty result for nil, got %q, %v", out, err)
+	}
+}
+
+func TestComputeAuditDiff(t *testing.T) {
+	oldValue := models.User{ID: 1, Username: "alice", Email: "a@example.com", Password: "hash1"}
+	newValue := models.User{ID: 1, Username: "alice", Email: "alice@example.com", Password: "hash2"}
+
+	changes, err := pkg.ComputeAuditDiff(oldValue, newValue)
+	if err != nil {
+		t.Fatalf("diff error: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %#v", changes)
+	}
+	if changes[0].Field != "email" || changes[0].Type != pkg.AuditChangeChanged ||
+		changes[0].Old != "a@example.com" || changes[0].New != "alice@example.com" || changes[0].Redacted {
+		t.Fatalf("unexpected email change: %#v", changes[0])
+	}
+	// 密码变化被记录，但不输出值
+	if changes[1].Field != "password" || !changes[1].Redacted ||
+		changes[1].Old != pkg.AuditRedacted || changes[1].New != pkg.AuditRedacted {
+		t.Fatalf("unexpected password change: %#v", changes[1])
+	}
+
+	// 嵌套字段按路径比较，新增和删除的字段分别标记
+	changes, err = pkg.ComputeAuditDiff(
+		map[string]interface{}{"settings": map[string]interface{}{"theme": "dark", "lang": "zh"}, "updated_at": "t1"},
+		map[string]interface{}{"settings": map[string]interface{}{"theme": "light", "tz": "UTC"}, "updated_at": "t2"},
+	)
+	if err != nil {
+		t.Fatalf("diff error: %v", err)
+	}
+	got := pkg.RenderAuditDiff(changes)
+	want := []string{`- settings.lang: "zh"`, `~ settings.theme: "dark" -> "light"`, `+ settings.tz: "UTC"`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected rendered diff:\n%s", strings.Join(got, "\n"))
+	}
+
+	// 创建操作的所有字段均为新增
+	changes, err = pkg.ComputeAuditDiff(nil, map[string]interface{}{"role": "admin"})
+	if err != nil || len(changes) != 1 || changes[0].Type != pkg.AuditChangeAdded {
+		t.Fatalf("unexpected create diff: %#v, %v", changes, err)
+	}
+}
+
+func TestAuditLoggerStoresRedactedValuesAndDiff(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	oldDB := pkg.DB
+	pkg.DB = db
+	defer func() { pkg.DB = oldDB }()
+
+	err = pkg.NewAuditLogger().Log(pkg.AuditLogOptions{
+		Action:       "update",
+		ResourceType: "user",
+		ResourceID:   "1",
+		OldValue:     models.User{ID: 1, Username: "alice", Password: "hash1"},
+		NewValue:     models.User{ID: 1, Username: "alice2", Password: "hash2"},
+		TenantID:     1,
+	})
+	if err != nil {
+		t.Fatalf("log error: %v", err)
+	}
+
+	var log models.AuditLog
+	if err := db.First(&log).Error; err != nil {
+		t.Fatalf("load log error: %v", err)
+	}
+	for _, stored := range []string{log.OldValue, log.NewValue, log.Diff} {
+		if strings.Contains(stored, "hash1") || strings.Contains(stored, "hash2") {
+			t.Fatalf("password leaked into audit log: %s", stored)
+		}
+	}
+
+	var changes []pkg.AuditFieldChange
+	if err := json.Unmarshal([]byte(log.Diff), &changes); err != nil {
+		t.Fatalf("parse diff error: %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, change := range changes {
+		fields[change.Field] = change.Redacted
+	}
+	if redacted, ok := fields["password"]; !ok || !redacted {
+		t.Fatalf("expected redacted password change, got %#v", changes)
+	}
+	if _, ok := fields["username"]; !ok || len(changes) != 2 {
+		t.Fatalf("expected username and password changes, got %#v", changes)
+	}
+
+	// 差异参与哈希计算，修改差异后校验失败
+	if log.Hash != pkg.ComputeAuditHash(&log) {
+		t.Fatalf("hash mismatch for stored log")
+	}
+	log.Diff = "[]"
+	if log.Hash == pkg.ComputeAuditHash(&log) {
+		t.Fatalf("expected diff to be covered by hash")
+	}
+}
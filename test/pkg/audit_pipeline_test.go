@@ -0,0 +1,167 @@
+package pkg_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/test/testutil"
+)
+
+func setupAuditPipelineDB(t *testing.T, migrate bool) *gorm.DB {
+	t.Helper()
+	db := testutil.OpenDB(t, &models.AuditCheckpoint{}, &models.RetentionArchive{})
+	if migrate {
+		if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+			t.Fatalf("auto migrate error: %v", err)
+		}
+	}
+	pkg.DB = db
+	return db
+}
+
+func countSpoolFiles(t *testing.T, dir string) int {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.ndjson"))
+	return len(files)
+}
+
+func TestAuditPipeline_BatchesAndFlushesOnStop(t *testing.T) {
+	db := setupAuditPipelineDB(t, true)
+	p := pkg.NewAuditPipeline(pkg.AuditPipelineOptions{QueueSize: 100, BatchSize: 10, FlushInterval: time.Hour, SpoolDir: t.TempDir()})
+	p.Start()
+
+	for i := 0; i < 25; i++ {
+		p.Enqueue(&models.AuditLog{Action: "create", TenantID: uint(i%2 + 1)})
+	}
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("stop error: %v", err)
+	}
+	// 停止后不再接收
+	if p.Enqueue(&models.AuditLog{Action: "late", TenantID: 1}) {
+		t.Fatalf("expected enqueue to fail after stop")
+	}
+
+	var count int64
+	db.Model(&models.AuditLog{}).Count(&count)
+	if count != 25 {
+		t.Fatalf("expected 25 audit logs after flush, got %d", count)
+	}
+	for _, tenantID := range []uint{1, 2} {
+		if result, err := pkg.VerifyAuditChain(db, tenantID); err != nil || !result.Valid {
+			t.Fatalf("expected valid chain for tenant %d: %#v, %v", tenantID, result, err)
+		}
+	}
+}
+
+func TestAuditPipeline_OverflowSpoolsToDisk(t *testing.T) {
+	db := setupAuditPipelineDB(t, true)
+	dir := t.TempDir()
+	// 未启动写入协程，队列容量为1，后续记录溢出落盘
+	p := pkg.NewAuditPipeline(pkg.AuditPipelineOptions{QueueSize: 1, BatchSize: 10, FlushInterval: time.Hour, SpoolDir: dir})
+	for i := 0; i < 3; i++ {
+		if !p.Enqueue(&models.AuditLog{Action: "create", TenantID: 1}) {
+			t.Fatalf("expected enqueue %d to be accepted", i)
+		}
+	}
+	if n := countSpoolFiles(t, dir); n != 2 {
+		t.Fatalf("expected 2 spool files, got %d", n)
+	}
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("stop error: %v", err)
+	}
+	if replayed := p.ReplaySpool(); replayed != 2 {
+		t.Fatalf("expected 2 replayed logs, got %d", replayed)
+	}
+	var count int64
+	db.Model(&models.AuditLog{}).Count(&count)
+	if count != 3 || countSpoolFiles(t, dir) != 0 {
+		t.Fatalf("expected 3 logs and empty spool, got %d logs, %d files", count, countSpoolFiles(t, dir))
+	}
+	if result, _ := pkg.VerifyAuditChain(db, 1); !result.Valid || result.Entries != 3 {
+		t.Fatalf("unexpected chain after replay: %#v", result)
+	}
+}
+
+func TestAuditPipeline_SpoolsWhenDatabaseUnavailable(t *testing.T) {
+	// 审计表不存在，模拟数据库写入失败
+	db := setupAuditPipelineDB(t, false)
+	dir := t.TempDir()
+	p := pkg.NewAuditPipeline(pkg.AuditPipelineOptions{QueueSize: 10, BatchSize: 10, FlushInterval: time.Hour, SpoolDir: dir})
+	p.Start()
+	p.Enqueue(&models.AuditLog{Action: "login", Username: "alice", TenantID: 1})
+	p.Enqueue(&models.AuditLog{Action: "logout", Username: "alice", TenantID: 1})
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("stop error: %v", err)
+	}
+	if n := countSpoolFiles(t, dir); n != 1 {
+		t.Fatalf("expected failed batch spooled to 1 file, got %d", n)
+	}
+	if replayed := p.ReplaySpool(); replayed != 0 || countSpoolFiles(t, dir) != 1 {
+		t.Fatalf("expected spool kept while database unavailable")
+	}
+
+	// 数据库恢复后重放
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	if replayed := p.ReplaySpool(); replayed != 2 {
+		t.Fatalf("expected 2 replayed logs, got %d", replayed)
+	}
+	var logs []models.AuditLog
+	db.Order("sequence ASC").Find(&logs)
+	if len(logs) != 2 || logs[0].Action != "login" || logs[1].Action != "logout" || logs[1].Sequence != 2 {
+		t.Fatalf("unexpected replayed logs: %#v", logs)
+	}
+}
+
+func TestAuditLogMiddleware_CapturesRequestSynchronously(t *testing.T) {
+	db := setupAuditPipelineDB(t, true)
+	spoolDir, flushInterval := config.Config.Audit.SpoolDir, config.Config.Audit.FlushInterval
+	defer func() { config.Config.Audit.SpoolDir, config.Config.Audit.FlushInterval = spoolDir, flushInterval }()
+	config.Config.Audit.SpoolDir = t.TempDir()
+	config.Config.Audit.FlushInterval = 3600000
+	pkg.StartAuditPipeline()
+	defer pkg.StopAuditPipeline(context.Background())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", uint(7))
+		c.Set("username", "alice")
+		c.Set("tenant_id", uint(3))
+		c.Next()
+	})
+	r.Use(pkg.AuditLogMiddleware())
+	r.POST("/api/v1/tools/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/tools/42", nil)
+	req.Header.Set("User-Agent", "pipeline-test")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := pkg.StopAuditPipeline(context.Background()); err != nil {
+		t.Fatalf("stop error: %v", err)
+	}
+	var log models.AuditLog
+	if err := db.First(&log).Error; err != nil {
+		t.Fatalf("expected audit log written on shutdown: %v", err)
+	}
+	if log.UserID != 7 || log.Username != "alice" || log.TenantID != 3 || log.ResourceType != "tools" ||
+		log.ResourceID != "42" || log.UserAgent != "pipeline-test" || log.Sequence != 1 {
+		t.Fatalf("unexpected audit log: %#v", log)
+	}
+	if _, err := os.Stat(config.Config.Audit.SpoolDir); err == nil && countSpoolFiles(t, config.Config.Audit.SpoolDir) != 0 {
+		t.Fatalf("expected nothing spooled")
+	}
+}
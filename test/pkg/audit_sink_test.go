@@ -0,0 +1,257 @@
+package pkg_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/auditsink"
+	"weave/test/testutil"
+)
+
+func sampleAuditLog() models.AuditLog {
+	return models.AuditLog{
+		ID:           42,
+		TenantID:     3,
+		Sequence:     7,
+		UserID:       5,
+		Username:     "ali]ce",
+		Action:       "delete",
+		ResourceType: "tool",
+		ResourceID:   "9",
+		OldValue:     `{"name":"calc","api_key":"sk-1"}`,
+		IPAddress:    "10.0.0.1",
+		UserAgent:    "curl/8|x=y",
+		CreatedAt:    time.Date(2025, 10, 1, 8, 30, 0, 123000000, time.UTC),
+	}
+}
+
+func TestFormatSyslogRFC5424(t *testing.T) {
+	log := sampleAuditLog()
+	msg := auditsink.FormatSyslog(&log, "host 1")
+
+	// facility 13 (log audit) * 8 + severity 5 (notice，删除操作)
+	header := regexp.MustCompile(`^<109>1 2025-10-01T08:30:00\.123000Z host1 weave \d+ delete \[audit@32473 `)
+	if !header.MatchString(msg) {
+		t.Fatalf("unexpected syslog header: %s", msg)
+	}
+	for _, want := range []string{`id="42"`, `tenant="3"`, `seq="7"`, `user="ali\]ce"`, `resourceType="tool"`, `src="10.0.0.1"`} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected %s in %s", want, msg)
+		}
+	}
+	if !strings.HasSuffix(msg, "] ali]ce delete tool 9") {
+		t.Fatalf("unexpected syslog message: %s", msg)
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	log := sampleAuditLog()
+	msg := auditsink.FormatCEF(&log)
+
+	if !strings.HasPrefix(msg, "CEF:0|Weave|Weave|1.0|delete|tool delete|5|") {
+		t.Fatalf("unexpected CEF header: %s", msg)
+	}
+	for _, want := range []string{"rt=1759307400123", "externalId=42", "suser=ali]ce", `requestClientApplication=curl/8|x\=y`, "cs1Label=resourceType cs1=tool", "cn1Label=tenantId cn1=3"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected %s in %s", want, msg)
+		}
+	}
+
+	framed := auditsink.FormatCEFSyslog(&log, "h")
+	if !strings.Contains(framed, " delete - CEF:0|") {
+		t.Fatalf("expected CEF inside syslog frame: %s", framed)
+	}
+}
+
+func TestAuditExportRecordRedactsAndEscapes(t *testing.T) {
+	log := sampleAuditLog()
+	record := auditsink.NewRecord(&log)
+	if strings.Contains(string(record.OldValue), "sk-1") {
+		t.Fatalf("api key leaked in export: %s", record.OldValue)
+	}
+	if record.NewValue != nil {
+		t.Fatalf("expected empty new value to be omitted, got %s", record.NewValue)
+	}
+
+	log.Username = "=HYPERLINK(\"x\")"
+	row := auditsink.CSVRow(&log)
+	if len(row) != len(auditsink.CSVHeader) {
+		t.Fatalf("row has %d columns, header has %d", len(row), len(auditsink.CSVHeader))
+	}
+	if row[5] != "'=HYPERLINK(\"x\")" {
+		t.Fatalf("expected formula to be escaped, got %s", row[5])
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer conn.Close()
+
+	sink := auditsink.NewSyslogSink("udp", "udp", conn.LocalAddr().String(), auditsink.FormatSyslog)
+	defer sink.Close()
+	log := sampleAuditLog()
+	if err := sink.Send(context.Background(), []models.AuditLog{log}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "<109>1 ") {
+		t.Fatalf("unexpected datagram: %s", buf[:n])
+	}
+}
+
+func TestWebhookSinkSignsPayload(t *testing.T) {
+	var body []byte
+	var signature, custom string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(auditsink.SignatureHeader)
+		custom = r.Header.Get("X-Source")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := auditsink.NewWebhookSink("soc", server.URL, "s3cret", map[string]string{"X-Source": "weave"})
+	log := sampleAuditLog()
+	if err := sink.Send(context.Background(), []models.AuditLog{log}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if signature != "sha256="+auditsink.SignPayload("s3cret", body) || custom != "weave" {
+		t.Fatalf("unexpected headers: signature=%s custom=%s", signature, custom)
+	}
+	var payload auditsink.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("payload error: %v", err)
+	}
+	if payload.Sink != "soc" || len(payload.Entries) != 1 || payload.Entries[0].ID != 42 {
+		t.Fatalf("unexpected payload: %s", body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := auditsink.NewWebhookSink("bad", failing.URL, "", nil).Send(context.Background(), []models.AuditLog{log}); err == nil {
+		t.Fatalf("expected error for non-2xx response")
+	}
+}
+
+// recordingSink 记录收到的审计日志ID，fail为true时返回错误
+type recordingSink struct {
+	mu   sync.Mutex
+	ids  []uint
+	fail bool
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Send(ctx context.Context, logs []models.AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	for _, log := range logs {
+		s.ids = append(s.ids, log.ID)
+	}
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func setupAuditSinkDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return testutil.OpenDB(t, &models.AuditLog{}, &models.AuditSinkCursor{})
+}
+
+func TestForwarderCursorAndRetry(t *testing.T) {
+	db := setupAuditSinkDB(t)
+	for i := 0; i < 5; i++ {
+		if err := pkg.AppendAuditLog(db, &models.AuditLog{Action: "create", ResourceType: "note", TenantID: uint(i%2 + 1)}); err != nil {
+			t.Fatalf("append error: %v", err)
+		}
+	}
+
+	sink := &recordingSink{fail: true}
+	f := auditsink.NewForwarder(db, []auditsink.Sink{sink}, auditsink.Options{BatchSize: 3})
+	ctx := context.Background()
+
+	// 发送失败时游标不推进
+	if _, err := f.Forward(ctx, sink); err == nil {
+		t.Fatalf("expected forward error")
+	}
+	if cursor, _ := auditsink.LoadCursor(db, sink.Name()); cursor != 0 {
+		t.Fatalf("cursor advanced after failure: %d", cursor)
+	}
+
+	sink.fail = false
+	if n, err := f.Forward(ctx, sink); err != nil || n != 3 {
+		t.Fatalf("expected 3 forwarded, got %d, %v", n, err)
+	}
+
+	// 新的转发器（模拟重启）从保存的游标继续
+	f = auditsink.NewForwarder(db, []auditsink.Sink{sink}, auditsink.Options{BatchSize: 3})
+	if n, err := f.Forward(ctx, sink); err != nil || n != 2 {
+		t.Fatalf("expected 2 forwarded after restart, got %d, %v", n, err)
+	}
+	if n, err := f.Forward(ctx, sink); err != nil || n != 0 {
+		t.Fatalf("expected nothing left, got %d, %v", n, err)
+	}
+	if got := sink.ids; len(got) != 5 || got[0] != 1 || got[4] != 5 {
+		t.Fatalf("unexpected forwarded ids: %v", got)
+	}
+	if cursor, _ := auditsink.LoadCursor(db, sink.Name()); cursor != 5 {
+		t.Fatalf("expected cursor 5, got %d", cursor)
+	}
+}
+
+func TestForwarderWaitsForIDGap(t *testing.T) {
+	db := setupAuditSinkDB(t)
+	// ID 2 缺失，模拟尚未提交或已回滚的事务
+	for _, id := range []uint{1, 3} {
+		log := &models.AuditLog{ID: id, Action: "create", ResourceType: "note", TenantID: 1, CreatedAt: time.Now()}
+		if err := db.Create(log).Error; err != nil {
+			t.Fatalf("seed error: %v", err)
+		}
+	}
+
+	sink := &recordingSink{}
+	f := auditsink.NewForwarder(db, []auditsink.Sink{sink}, auditsink.Options{BatchSize: 10, GapWait: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	if n, _ := f.Forward(ctx, sink); n != 1 {
+		t.Fatalf("expected only the record before the gap, got %d", n)
+	}
+	if n, _ := f.Forward(ctx, sink); n != 0 {
+		t.Fatalf("expected to wait for the gap, got %d", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if n, _ := f.Forward(ctx, sink); n != 1 {
+		t.Fatalf("expected the gap to be skipped after waiting, got %d", n)
+	}
+	if len(sink.ids) != 2 || sink.ids[1] != 3 {
+		t.Fatalf("unexpected forwarded ids: %v", sink.ids)
+	}
+}
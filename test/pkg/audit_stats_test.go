@@ -0,0 +1,156 @@
+package pkg_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/models"
+	"weave/pkg"
+)
+
+// setupAuditStatsDB 以本地时间2025-03-10（周一）00:00为起点，写入两周的审计日志
+func setupAuditStatsDB(t *testing.T) (*gorm.DB, time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+
+	base := time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local)
+	add := func(tenantID uint, username, action, resourceType string, at time.Time) {
+		if err := db.Create(&models.AuditLog{TenantID: tenantID, Username: username, Action: action, ResourceType: resourceType,
+			IPAddress: "10.0.0.1", CreatedAt: at}).Error; err != nil {
+			t.Fatalf("seed error: %v", err)
+		}
+	}
+	// 上一周：alice 2次create
+	add(1, "alice", "create", "tool", base.AddDate(0, 0, -5))
+	add(1, "alice", "create", "tool", base.AddDate(0, 0, -4))
+	// 本周：alice 3次create、bob 2次delete、carol 1次update
+	add(1, "alice", "create", "tool", base.Add(1*time.Hour))
+	add(1, "alice", "create", "note", base.Add(2*time.Hour))
+	add(1, "alice", "create", "tool", base.AddDate(0, 0, 2).Add(10*time.Hour))
+	add(1, "bob", "delete", "tool", base.Add(1*time.Hour+30*time.Minute))
+	add(1, "bob", "delete", "tool", base.AddDate(0, 0, 6).Add(23*time.Hour))
+	add(1, "carol", "update", "plugin", base.AddDate(0, 0, 3))
+	// 其他租户不计入
+	add(2, "mallory", "delete", "tool", base.Add(time.Hour))
+	return db, base
+}
+
+func TestAuditStatsTopN(t *testing.T) {
+	db, base := setupAuditStatsDB(t)
+
+	result, err := pkg.AuditStats(db, pkg.AuditStatsQuery{
+		TenantID: 1, GroupBy: []string{pkg.AuditStatsUser}, Start: base, End: base.AddDate(0, 0, 7), Limit: 2, Compare: true,
+	})
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	if result.Total != 6 || result.Others != 1 || len(result.Rows) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	alice, bob := result.Rows[0], result.Rows[1]
+	if alice.Key["user"] != "alice" || alice.Count != 3 || *alice.Previous != 2 || *alice.Change != 50 {
+		t.Fatalf("unexpected alice row: %+v", alice)
+	}
+	if bob.Key["user"] != "bob" || bob.Count != 2 || *bob.Previous != 0 || bob.Change != nil {
+		t.Fatalf("unexpected bob row: %+v", bob)
+	}
+	if result.Previous == nil || result.Previous.Total != 2 || *result.Previous.Change != 200 || !result.Previous.End.Equal(base) {
+		t.Fatalf("unexpected previous period: %+v", result.Previous)
+	}
+
+	// 多个维度和过滤条件
+	result, err = pkg.AuditStats(db, pkg.AuditStatsQuery{
+		TenantID: 1, GroupBy: []string{pkg.AuditStatsAction, pkg.AuditStatsResourceType}, Start: base, End: base.AddDate(0, 0, 7),
+		Username: "alice",
+	})
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	if len(result.Rows) != 2 || result.Rows[0].Key["resource_type"] != "tool" || result.Rows[0].Count != 2 || result.Rows[1].Key["action"] != "create" {
+		t.Fatalf("unexpected grouped rows: %+v", result.Rows)
+	}
+}
+
+func TestAuditStatsTimeSeries(t *testing.T) {
+	db, base := setupAuditStatsDB(t)
+
+	result, err := pkg.AuditStats(db, pkg.AuditStatsQuery{
+		TenantID: 1, GroupBy: []string{pkg.AuditStatsDay}, Start: base, End: base.AddDate(0, 0, 7),
+	})
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	// 空的日期补0
+	counts := []int64{3, 0, 1, 1, 0, 0, 1}
+	if len(result.Rows) != 7 {
+		t.Fatalf("expected 7 daily buckets, got %+v", result.Rows)
+	}
+	for i, row := range result.Rows {
+		if row.Key["day"] != base.AddDate(0, 0, i).Format("2006-01-02") || row.Count != counts[i] {
+			t.Fatalf("unexpected bucket %d: %+v", i, row)
+		}
+	}
+
+	// 按用户的每周序列，前N组之外的记录计入others
+	result, err = pkg.AuditStats(db, pkg.AuditStatsQuery{
+		TenantID: 1, GroupBy: []string{pkg.AuditStatsUser, pkg.AuditStatsWeek}, Start: base.AddDate(0, 0, -7), End: base.AddDate(0, 0, 7), Limit: 1,
+	})
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	if len(result.Rows) != 2 || result.Others != 3 {
+		t.Fatalf("unexpected weekly result: %+v", result)
+	}
+	if week := result.Rows[0]; week.Key["user"] != "alice" || week.Key["week"] != "2025-03-03" || week.Count != 2 {
+		t.Fatalf("unexpected first week: %+v", week)
+	}
+	if week := result.Rows[1]; week.Key["week"] != "2025-03-10" || week.Count != 3 {
+		t.Fatalf("unexpected second week: %+v", week)
+	}
+
+	// 按小时对比上一周期，时间段按序号对应
+	result, err = pkg.AuditStats(db, pkg.AuditStatsQuery{
+		TenantID: 1, GroupBy: []string{pkg.AuditStatsHour}, Start: base, End: base.Add(3 * time.Hour), Compare: true,
+	})
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	if len(result.Rows) != 3 || result.Rows[1].Key["hour"] != "2025-03-10 01:00" || result.Rows[1].Count != 2 || *result.Rows[1].Previous != 0 {
+		t.Fatalf("unexpected hourly result: %+v", result.Rows)
+	}
+}
+
+func TestAuditStatsValidation(t *testing.T) {
+	base := time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local)
+	cases := []pkg.AuditStatsQuery{
+		{Start: base, End: base.Add(time.Hour)},
+		{GroupBy: []string{"country"}, Start: base, End: base.Add(time.Hour)},
+		{GroupBy: []string{"user", "user"}, Start: base, End: base.Add(time.Hour)},
+		{GroupBy: []string{"day", "week"}, Start: base, End: base.Add(time.Hour)},
+		{GroupBy: []string{"user"}, Start: base, End: base},
+		{GroupBy: []string{"hour"}, Start: base, End: base.AddDate(0, 2, 0)},
+		{GroupBy: []string{"user"}, Start: base, End: base.Add(time.Hour), Limit: 1000},
+	}
+	for i, query := range cases {
+		if err := query.Validate(); err == nil {
+			t.Errorf("case %d: expected validation error for %+v", i, query)
+		}
+	}
+
+	query := pkg.AuditStatsQuery{GroupBy: []string{"ip", "day"}, Start: base, End: base.AddDate(0, 0, 30)}
+	if err := query.Validate(); err != nil || query.Limit != pkg.AuditStatsDefaultLimit {
+		t.Fatalf("unexpected validation result: %v, limit %d", err, query.Limit)
+	}
+}
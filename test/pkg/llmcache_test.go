@@ -0,0 +1,144 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"weave/pkg/llmcache"
+)
+
+func TestLLMCacheExactMatch(t *testing.T) {
+	cache := llmcache.New(llmcache.NewMemoryStore(100), llmcache.Options{TTL: time.Minute})
+	ctx := context.Background()
+	req := llmcache.Request{TenantID: 1, Kind: llmcache.KindRAG, Model: "ark/doubao", DocIDs: []string{"a", "b"}, Question: "What is the refund policy?"}
+
+	miss := cache.Lookup(ctx, req)
+	if miss.Hit() || miss.Result != llmcache.ResultMiss {
+		t.Fatalf("expected a miss on an empty cache, got %+v", miss)
+	}
+	cache.Save(ctx, miss, "30 days", "ark/doubao")
+
+	// 规范化后相同的问题，检索文档的顺序不影响命中
+	same := req
+	same.Question = "  what is the REFUND   policy "
+	same.DocIDs = []string{"b", "a"}
+	if hit := cache.Lookup(ctx, same); hit.Result != llmcache.ResultHit || hit.Response != "30 days" || hit.Similarity != 1 {
+		t.Fatalf("expected an exact hit, got %+v", hit)
+	}
+
+	// 租户、模型和检索文档不同时不命中
+	for name, other := range map[string]llmcache.Request{
+		"tenant": {TenantID: 2, Kind: req.Kind, Model: req.Model, DocIDs: req.DocIDs, Question: req.Question},
+		"model":  {TenantID: 1, Kind: req.Kind, Model: "openai/gpt-4o", DocIDs: req.DocIDs, Question: req.Question},
+		"docs":   {TenantID: 1, Kind: req.Kind, Model: req.Model, DocIDs: []string{"a", "c"}, Question: req.Question},
+		"kind":   {TenantID: 1, Kind: llmcache.KindChat, Model: req.Model, DocIDs: req.DocIDs, Question: req.Question},
+	} {
+		if result := cache.Lookup(ctx, other); result.Hit() {
+			t.Fatalf("expected a miss for a different %s, got %+v", name, result)
+		}
+	}
+
+	if err := cache.Purge(ctx, 1); err != nil {
+		t.Fatalf("purge error: %v", err)
+	}
+	if result := cache.Lookup(ctx, req); result.Hit() {
+		t.Fatal("expected purged entries to be gone")
+	}
+}
+
+// wordEmbedder 按问题中出现的关键词生成向量
+func wordEmbedder(words ...string) llmcache.Embedder {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		if strings.Contains(text, "fail") {
+			return nil, errors.New("embedding service unavailable")
+		}
+		vector := make([]float32, len(words))
+		for i, word := range words {
+			if strings.Contains(text, word) {
+				vector[i] = 1
+			}
+		}
+		return vector, nil
+	}
+}
+
+func TestLLMCacheSimilarMatch(t *testing.T) {
+	embedder := wordEmbedder("refund", "policy", "days", "shipping")
+	cache := llmcache.New(llmcache.NewMemoryStore(100), llmcache.Options{TTL: time.Minute, Threshold: 0.8, Embedder: embedder})
+	ctx := context.Background()
+	req := llmcache.Request{TenantID: 1, Kind: llmcache.KindChat, Model: "local/llama", Question: "refund policy days"}
+	cache.Save(ctx, cache.Lookup(ctx, req), "30 days", "local/llama")
+
+	// 与缓存问题的相似度为2/sqrt(6)≈0.816
+	req.Question = "refund policy"
+	hit := cache.Lookup(ctx, req)
+	if hit.Result != llmcache.ResultSimilar || hit.Response != "30 days" || math.Abs(hit.Similarity-2/math.Sqrt(6)) > 1e-6 {
+		t.Fatalf("expected a similar hit, got %+v", hit)
+	}
+
+	// 相似度低于阈值时不命中
+	req.Question = "shipping days"
+	if result := cache.Lookup(ctx, req); result.Hit() {
+		t.Fatalf("expected a miss below the threshold, got %+v", result)
+	}
+
+	// 嵌入模型出错时按未命中处理
+	req.Question = "fail"
+	if result := cache.Lookup(ctx, req); result.Result != llmcache.ResultError {
+		t.Fatalf("expected an error result, got %+v", result)
+	}
+}
+
+func TestLLMCacheExpiryAndCapacity(t *testing.T) {
+	store := llmcache.NewMemoryStore(2)
+	cache := llmcache.New(store, llmcache.Options{TTL: 50 * time.Millisecond})
+	ctx := context.Background()
+	lookup := func(question string) *llmcache.Result {
+		return cache.Lookup(ctx, llmcache.Request{TenantID: 1, Kind: llmcache.KindChat, Model: "local/llama", Question: question})
+	}
+
+	cache.Save(ctx, lookup("first"), "1", "local/llama")
+	time.Sleep(60 * time.Millisecond)
+	if result := lookup("first"); result.Hit() {
+		t.Fatal("expected the entry to expire")
+	}
+
+	// 超出容量时先清理过期条目，再淘汰最早的条目
+	cache.Save(ctx, lookup("second"), "2", "local/llama")
+	cache.Save(ctx, lookup("third"), "3", "local/llama")
+	if store.Len() != 2 {
+		t.Fatalf("expected the expired entry to be removed, got %d entries", store.Len())
+	}
+	cache.Save(ctx, lookup("fourth"), "4", "local/llama")
+	if store.Len() != 2 || lookup("second").Hit() || !lookup("fourth").Hit() {
+		t.Fatalf("expected the oldest entry to be evicted, got %d entries", store.Len())
+	}
+
+	// 空回答不缓存，未启用的缓存始终未命中
+	cache.Save(ctx, lookup("empty"), " ", "local/llama")
+	if lookup("empty").Hit() {
+		t.Fatal("expected empty responses not to be cached")
+	}
+	var disabled *llmcache.Cache
+	disabled.Save(ctx, disabled.Lookup(ctx, llmcache.Request{Question: "first"}), "1", "local/llama")
+	if disabled.Lookup(ctx, llmcache.Request{Question: "first"}).Hit() {
+		t.Fatal("expected a nil cache to never hit")
+	}
+}
+
+func TestLLMCacheNormalize(t *testing.T) {
+	for input, want := range map[string]string{
+		"  What is  RAG? ":  "what is rag",
+		"退货政策是什么？":          "退货政策是什么",
+		"version 1.2":       "version 1.2",
+		"Hello,\nworld!!!": "hello, world",
+	} {
+		if got := llmcache.Normalize(input); got != want {
+			t.Fatalf("Normalize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+)
+
+func testLLMConfig() config.LLMConfig {
+	return config.LLMConfig{
+		Providers: []config.LLMProviderConfig{
+			{Name: "local", Type: "fake", Model: "llama"},
+			{Name: "cloud", Type: "fake", Model: "gpt", Options: map[string]string{"error": "rate limited"}},
+		},
+		Aliases:  map[string]string{"fast": "local/phi", "smart": "cloud"},
+		Routes:   map[string]string{"rag": "smart"},
+		Default:  "local",
+		Fallback: "local/phi",
+	}
+}
+
+func TestLLMRegistry_Resolve(t *testing.T) {
+	registry, err := llmprovider.NewRegistry(testLLMConfig())
+	if err != nil {
+		t.Fatalf("new registry error: %v", err)
+	}
+
+	for ref, want := range map[string]string{
+		"fast":        "local/phi",
+		"smart":       "cloud/gpt",
+		"local":       "local/llama",
+		"cloud/gpt-4": "cloud/gpt-4",
+	} {
+		target, err := registry.Resolve(ref)
+		if err != nil || target.String() != want {
+			t.Fatalf("resolve %s: expected %s, got %s (%v)", ref, want, target, err)
+		}
+	}
+	if _, err := registry.Resolve("missing"); !errors.Is(err, llmprovider.ErrUnknownModel) {
+		t.Fatalf("expected ErrUnknownModel, got %v", err)
+	}
+}
+
+func TestLLMRegistry_RejectsInvalidConfig(t *testing.T) {
+	cases := map[string]func(cfg *config.LLMConfig){
+		"alias to alias": func(cfg *config.LLMConfig) { cfg.Aliases["faster"] = "fast" },
+		"unknown route":  func(cfg *config.LLMConfig) { cfg.Routes["chat"] = "missing" },
+		"unknown type":   func(cfg *config.LLMConfig) { cfg.Providers[0].Type = "carrier-pigeon" },
+		"bad default":    func(cfg *config.LLMConfig) { cfg.Default = "" },
+		"alias conflict": func(cfg *config.LLMConfig) { cfg.Aliases["cloud"] = "local" },
+	}
+	for name, mutate := range cases {
+		cfg := testLLMConfig()
+		mutate(&cfg)
+		if _, err := llmprovider.NewRegistry(cfg); err == nil {
+			t.Fatalf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLLMRegistry_PlanUsesTenantOverride(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.TenantLLMConfig{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	oldDB := pkg.DB
+	pkg.DB = db
+	t.Cleanup(func() { pkg.DB = oldDB })
+
+	registry, err := llmprovider.NewRegistry(testLLMConfig())
+	if err != nil {
+		t.Fatalf("new registry error: %v", err)
+	}
+	ctx := context.Background()
+	plan := func(tenantID uint, task, requested string) string {
+		targets, err := registry.Plan(ctx, tenantID, task, requested)
+		if err != nil {
+			t.Fatalf("plan error: %v", err)
+		}
+		names := make([]string, len(targets))
+		for i, target := range targets {
+			names[i] = target.String()
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got := plan(1, llmprovider.TaskChat, ""); got != "local/llama,local/phi" {
+		t.Fatalf("unexpected global chat plan: %s", got)
+	}
+	if got := plan(1, llmprovider.TaskRAG, ""); got != "cloud/gpt,local/phi" {
+		t.Fatalf("unexpected global rag plan: %s", got)
+	}
+	// 备用模型与主模型相同时只尝试一次
+	if got := plan(1, llmprovider.TaskChat, "fast"); got != "local/phi" {
+		t.Fatalf("unexpected plan for requested model: %s", got)
+	}
+
+	db.Create(&models.TenantLLMConfig{TenantID: 1, DefaultModel: "smart", FallbackModel: "removed", Routes: map[string]string{"rag": "local/mistral"}})
+	if got := plan(1, llmprovider.TaskChat, ""); got != "cloud/gpt" {
+		t.Fatalf("expected tenant default without the unresolvable fallback, got %s", got)
+	}
+	if got := plan(1, llmprovider.TaskRAG, ""); got != "local/mistral" {
+		t.Fatalf("expected tenant route, got %s", got)
+	}
+	if got := plan(2, llmprovider.TaskChat, ""); got != "local/llama,local/phi" {
+		t.Fatalf("expected other tenants to use the global plan, got %s", got)
+	}
+	if _, err := registry.Plan(ctx, 1, llmprovider.TaskChat, "missing"); !errors.Is(err, llmprovider.ErrUnknownModel) {
+		t.Fatalf("expected ErrUnknownModel for requested model, got %v", err)
+	}
+}
+
+func TestLLMRegistry_CallFallsBack(t *testing.T) {
+	registry, err := llmprovider.NewRegistry(testLLMConfig())
+	if err != nil {
+		t.Fatalf("new registry error: %v", err)
+	}
+	ctx := context.Background()
+	targets, _ := registry.Plan(ctx, 0, llmprovider.TaskRAG, "")
+
+	var response string
+	used, err := registry.Call(ctx, targets, func(ctx context.Context, target llmprovider.Target) error {
+		model, err := registry.New(target)
+		if err != nil {
+			return err
+		}
+		response, err = model.Call(ctx, "question")
+		return err
+	})
+	if err != nil || used.String() != "local/phi" || response != "[local/phi] question" {
+		t.Fatalf("expected fallback to local/phi, got %s %q (%v)", used, response, err)
+	}
+
+	// Permanent错误不再尝试备用模型
+	attempts := 0
+	used, err = registry.Call(ctx, targets, func(ctx context.Context, target llmprovider.Target) error {
+		attempts++
+		return llmprovider.Permanent(errors.New("stream broken"))
+	})
+	if attempts != 1 || used.String() != "cloud/gpt" || err == nil || err.Error() != "stream broken" {
+		t.Fatalf("expected a single attempt, got %d attempts, %s (%v)", attempts, used, err)
+	}
+}
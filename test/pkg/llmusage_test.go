@@ -0,0 +1,127 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/tmc/langchaingo/llms"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/llmusage"
+)
+
+func TestLLMUsageFromResponse(t *testing.T) {
+	resp := &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        "hello world",
+		GenerationInfo: map[string]any{"PromptTokens": 120, "CompletionTokens": 30},
+	}}}
+	if tokens := llmusage.FromResponse(resp, 5, ""); tokens.Prompt != 120 || tokens.Completion != 30 || tokens.Estimated {
+		t.Fatalf("expected provider token counts, got %+v", tokens)
+	}
+
+	// 没有返回用量时按内容估算
+	resp.Choices[0].GenerationInfo = nil
+	if tokens := llmusage.FromResponse(resp, 5, ""); tokens.Prompt != 5 || tokens.Completion != 3 || !tokens.Estimated {
+		t.Fatalf("expected estimated token counts, got %+v", tokens)
+	}
+	if tokens := llmusage.FromResponse(nil, 5, "partial reply"); tokens.Total() != 8 || !tokens.Estimated {
+		t.Fatalf("expected the streamed completion to be estimated, got %+v", tokens)
+	}
+}
+
+func TestLLMUsageCost(t *testing.T) {
+	prices := config.Config.LLM.Prices
+	config.Config.LLM.Prices = map[string]config.LLMPrice{
+		"openai/gpt-4o-mini": {Input: 0.15, Output: 0.6},
+		"qwen2.5":            {Input: 1, Output: 2},
+	}
+	t.Cleanup(func() { config.Config.LLM.Prices = prices })
+
+	tokens := llmusage.Tokens{Prompt: 1000000, Completion: 500000}
+	if cost := llmusage.Cost(llmprovider.Target{Provider: "openai", Model: "gpt-4o-mini"}, tokens); math.Abs(cost-0.45) > 1e-9 {
+		t.Fatalf("expected cost 0.45, got %v", cost)
+	}
+	// 没有“提供方/模型”的单价时按模型名称查找
+	if cost := llmusage.Cost(llmprovider.Target{Provider: "ollama", Model: "qwen2.5"}, tokens); math.Abs(cost-2) > 1e-9 {
+		t.Fatalf("expected cost 2, got %v", cost)
+	}
+	if cost := llmusage.Cost(llmprovider.Target{Provider: "ollama", Model: "llama"}, tokens); cost != 0 {
+		t.Fatalf("expected unpriced models to cost nothing, got %v", cost)
+	}
+}
+
+func TestLLMUsageReport(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.LLMUsage{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+	prices := config.Config.LLM.Prices
+	config.Config.LLM.Prices = map[string]config.LLMPrice{"cloud/gpt": {Input: 10, Output: 30}}
+	t.Cleanup(func() { config.Config.LLM.Prices = prices })
+
+	ctx := context.Background()
+	cloud := llmprovider.Target{Provider: "cloud", Model: "gpt"}
+	local := llmprovider.Target{Provider: "local", Model: "llama"}
+	for _, entry := range []llmusage.Entry{
+		{TenantID: 1, UserID: 7, Source: llmusage.SourceChat, Target: cloud, Tokens: llmusage.Tokens{Prompt: 1000, Completion: 500}},
+		{TenantID: 1, UserID: 8, Source: llmusage.SourceRAG, Target: cloud, Tokens: llmusage.Tokens{Prompt: 2000, Completion: 100}},
+		{TenantID: 1, UserID: 7, Source: llmusage.SourceSummary, Target: local, Tokens: llmusage.Tokens{Prompt: 300, Completion: 50, Estimated: true}},
+		{TenantID: 2, UserID: 9, Source: llmusage.SourceChat, Target: cloud, Tokens: llmusage.Tokens{Prompt: 99999}},
+		{TenantID: 1, UserID: 7, Source: llmusage.SourceChat, Target: cloud}, // 没有消耗令牌，不记录
+	} {
+		if err := llmusage.Record(ctx, entry); err != nil {
+			t.Fatalf("record error: %v", err)
+		}
+	}
+	var count int64
+	db.Model(&models.LLMUsage{}).Count(&count)
+	if count != 4 {
+		t.Fatalf("expected 4 usage records, got %d", count)
+	}
+
+	now := time.Now()
+	report, err := llmusage.GetReport(ctx, llmusage.ReportQuery{TenantID: 1, From: now, To: now, GroupBy: llmusage.GroupByModel})
+	if err != nil {
+		t.Fatalf("report error: %v", err)
+	}
+	if len(report.Rows) != 2 || report.Rows[0].Group != "cloud/gpt" || report.Rows[0].Requests != 2 || report.Rows[0].TotalTokens != 3600 {
+		t.Fatalf("unexpected model report: %+v", report.Rows)
+	}
+	// 费用按记录时的单价计算：(3000*10 + 600*30) / 1e6
+	if math.Abs(report.Rows[0].Cost-0.048) > 1e-9 || report.Rows[1].Cost != 0 || report.Total.TotalTokens != 3950 {
+		t.Fatalf("unexpected costs: %+v total %+v", report.Rows, report.Total)
+	}
+
+	report, _ = llmusage.GetReport(ctx, llmusage.ReportQuery{TenantID: 1, UserID: 7, From: now, To: now, GroupBy: llmusage.GroupBySource})
+	if len(report.Rows) != 2 || report.Total.Requests != 2 || report.Total.PromptTokens != 1300 {
+		t.Fatalf("unexpected per-user source report: %+v", report)
+	}
+
+	report, _ = llmusage.GetReport(ctx, llmusage.ReportQuery{TenantID: 1, From: now, To: now, GroupBy: llmusage.GroupByDay})
+	if len(report.Rows) != 1 || report.Rows[0].Group != now.UTC().Format("2006-01-02") || report.Rows[0].Requests != 3 {
+		t.Fatalf("unexpected daily report: %+v", report.Rows)
+	}
+
+	// 日期范围外没有用量
+	yesterday := now.AddDate(0, 0, -1)
+	report, _ = llmusage.GetReport(ctx, llmusage.ReportQuery{TenantID: 1, From: yesterday, To: yesterday, GroupBy: llmusage.GroupByUser})
+	if len(report.Rows) != 0 {
+		t.Fatalf("expected no usage yesterday, got %+v", report.Rows)
+	}
+	if _, err := llmusage.GetReport(ctx, llmusage.ReportQuery{TenantID: 1, GroupBy: "tenant"}); !errors.Is(err, llmusage.ErrInvalidGroup) {
+		t.Fatalf("expected ErrInvalidGroup, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"weave/pkg"
+)
+
+func setupProblemRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/tools/:id", func(c *gin.Context) {
+		pkg.RespondError(c, pkg.NewNotFoundError("Tool not found", nil).WithDetails(gin.H{"id": c.Param("id")}))
+	})
+	r.GET("/plugins/:name", func(c *gin.Context) {
+		pkg.RespondError(c, pkg.NewPluginNotFoundError("插件不存在", nil))
+	})
+	r.GET("/boom", func(c *gin.Context) {
+		pkg.RespondError(c, pkg.NewDatabaseError("Failed to load tools", errors.New("dial tcp: refused")).WithDetails("secret dsn"))
+	})
+	r.GET("/raw", func(c *gin.Context) {
+		pkg.RespondError(c, errors.New("raw failure"))
+	})
+	r.POST("/users", func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username" binding:"required,min=3"`
+			Email    string `json:"email" binding:"required,email"`
+			Age      int    `json:"age"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			pkg.RespondError(c, pkg.NewValidationError("Invalid user data", err))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func doProblem(t *testing.T, r *gin.Engine, method, path, body string, headers map[string]string) (*httptest.ResponseRecorder, pkg.Problem) {
+	t.Helper()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var problem pkg.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("json unmarshal error: %v: %s", err, w.Body.String())
+	}
+	return w, problem
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":                           "",
+		"fr-FR, de;q=0.8":            "",
+		"en-US,en;q=0.9":             pkg.LangEn,
+		"zh-TW":                      pkg.LangZhCN,
+		"en;q=0.5, zh-CN;q=0.9":      pkg.LangZhCN,
+		"fr, zh;q=0, en-GB;q=0.3":    pkg.LangEn,
+		" ZH-cn ; q=1.0 , en ; q=1 ": pkg.LangZhCN,
+	}
+	for header, want := range cases {
+		if got := pkg.NegotiateLanguage(header); got != want {
+			t.Errorf("NegotiateLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestRespondErrorProblemDocument(t *testing.T) {
+	r := setupProblemRouter()
+
+	w, problem := doProblem(t, r, http.MethodGet, "/tools/7", "", map[string]string{pkg.RequestIDHeader: "req-123"})
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), pkg.ProblemContentType) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if problem.Type != pkg.ProblemTypeBase+"not-found" || problem.Status != 404 || problem.Instance != "/tools/7" ||
+		problem.Code != pkg.ErrNotFound || problem.Detail != "Tool not found" || problem.Message != problem.Detail {
+		t.Fatalf("unexpected problem: %+v", problem)
+	}
+	if problem.RequestID != "req-123" || w.Header().Get(pkg.RequestIDHeader) != "req-123" {
+		t.Fatalf("expected request id to be echoed, got %q", problem.RequestID)
+	}
+	if details, ok := problem.Details.(map[string]interface{}); !ok || details["id"] != "7" {
+		t.Fatalf("expected details for 4xx, got %#v", problem.Details)
+	}
+
+	// 没有请求ID时生成新的ID
+	w, problem = doProblem(t, r, http.MethodGet, "/tools/7", "", nil)
+	if problem.RequestID == "" || w.Header().Get(pkg.RequestIDHeader) != problem.RequestID {
+		t.Fatalf("expected generated request id, got %q", problem.RequestID)
+	}
+
+	// 5xx不返回details，非AppError不暴露原始信息
+	_, problem = doProblem(t, r, http.MethodGet, "/boom", "", nil)
+	if problem.Status != 500 || problem.Type != pkg.ProblemTypeBase+"database-error" || problem.Details != nil {
+		t.Fatalf("unexpected 5xx problem: %+v", problem)
+	}
+	_, problem = doProblem(t, r, http.MethodGet, "/raw", "", nil)
+	if problem.Code != pkg.ErrInternalError || strings.Contains(problem.Detail, "raw failure") {
+		t.Fatalf("unexpected problem for plain error: %+v", problem)
+	}
+}
+
+func TestRespondErrorLocalization(t *testing.T) {
+	r := setupProblemRouter()
+
+	// 不带Accept-Language时保持原文
+	w, problem := doProblem(t, r, http.MethodGet, "/plugins/ghost", "", nil)
+	if problem.Detail != "插件不存在" || problem.Title != "插件不存在" || w.Header().Get("Content-Language") != "" {
+		t.Fatalf("unexpected default problem: %+v", problem)
+	}
+
+	w, problem = doProblem(t, r, http.MethodGet, "/plugins/ghost", "", map[string]string{"Accept-Language": "en-US,en;q=0.9"})
+	if problem.Detail != "Plugin not found" || problem.Title != "Plugin not found" || w.Header().Get("Content-Language") != pkg.LangEn {
+		t.Fatalf("unexpected en problem: %+v", problem)
+	}
+
+	w, problem = doProblem(t, r, http.MethodGet, "/tools/1", "", map[string]string{"Accept-Language": "zh-CN"})
+	if problem.Detail != "工具不存在" || problem.Title != "请求的资源不存在" || w.Header().Get("Content-Language") != pkg.LangZhCN {
+		t.Fatalf("unexpected zh problem: %+v", problem)
+	}
+	if !strings.Contains(w.Header().Get("Vary"), "Accept-Language") {
+		t.Fatalf("expected Vary: Accept-Language, got %q", w.Header().Get("Vary"))
+	}
+}
+
+func TestRespondErrorFieldErrors(t *testing.T) {
+	r := setupProblemRouter()
+
+	_, problem := doProblem(t, r, http.MethodPost, "/users", `{"username":"al","email":"nope"}`, nil)
+	if problem.Status != 400 || len(problem.Errors) != 2 {
+		t.Fatalf("expected 2 field errors, got %+v", problem)
+	}
+	if fe := problem.Errors[0]; fe.Field != "username" || fe.Rule != "min" || fe.Param != "3" || fe.Message != "username must be at least 3" {
+		t.Fatalf("unexpected username error: %+v", fe)
+	}
+	if fe := problem.Errors[1]; fe.Field != "email" || fe.Rule != "email" {
+		t.Fatalf("unexpected email error: %+v", fe)
+	}
+
+	_, problem = doProblem(t, r, http.MethodPost, "/users", `{"username":"alice","email":"a@b.c","age":"old"}`, map[string]string{"Accept-Language": "zh-CN"})
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "age" || problem.Errors[0].Rule != "type" || problem.Errors[0].Message != "age的类型不正确" {
+		t.Fatalf("unexpected type error: %+v", problem.Errors)
+	}
+}
+
+func TestErrorTitlesCoverAllCodes(t *testing.T) {
+	for code := range pkg.HTTPStatusMap {
+		for _, lang := range []string{pkg.LangZhCN, pkg.LangEn} {
+			if _, ok := pkg.ErrorTitles[lang][code]; !ok {
+				t.Errorf("missing %s title for %s", lang, code)
+			}
+		}
+	}
+}
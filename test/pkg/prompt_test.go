@@ -0,0 +1,102 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/prompt"
+)
+
+func TestPromptBuiltinsRender(t *testing.T) {
+	for _, definition := range prompt.Builtins() {
+		if _, err := prompt.Parse(definition.Name, definition.Content, definition.Variables); err != nil {
+			t.Fatalf("builtin %s does not parse: %v", definition.Name, err)
+		}
+	}
+
+	text, err := prompt.RenderBuiltin(prompt.RAGUser, map[string]interface{}{"query": "Q"})
+	if err != nil || text != "Q" {
+		t.Fatalf("expected the bare query without context, got %q %v", text, err)
+	}
+	text, _ = prompt.RenderBuiltin(prompt.RAGUser, map[string]interface{}{"query": "Q", "context": "C"})
+	if !strings.HasPrefix(text, "基于以下信息回答我的问题") || !strings.HasSuffix(text, "问题：Q") {
+		t.Fatalf("unexpected rag prompt %q", text)
+	}
+	if _, err := prompt.RenderBuiltin("missing", nil); !errors.Is(err, prompt.ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestPromptParseRejectsUndeclaredVariables(t *testing.T) {
+	if _, err := prompt.Parse("greeting", "Hello {{.name}}", nil); err == nil {
+		t.Fatal("expected an error for an undeclared variable")
+	}
+	if _, err := prompt.Parse("greeting", "Hello {{.name", []string{"name"}); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+
+	tmpl, err := prompt.Parse("greeting", "Hello {{.name}}{{if .title}}, {{.title}}{{end}}", []string{"name", "title"})
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if text, _ := tmpl.Execute(map[string]interface{}{"name": "Bob"}); text != "Hello Bob" {
+		t.Fatalf("expected missing declared variables to render empty, got %q", text)
+	}
+	if _, err := tmpl.Execute(map[string]interface{}{"age": 3}); err == nil {
+		t.Fatal("expected an error for an undeclared variable")
+	}
+}
+
+func TestPromptVersionScopes(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.PromptTemplate{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+	prompt.Invalidate()
+	ctx := context.Background()
+
+	// 租户0的版本与平台级版本互不影响
+	tenantVersion := models.PromptTemplate{Name: prompt.RAGSystem, TenantID: 0, Content: "tenant zero"}
+	globalVersion := models.PromptTemplate{Name: prompt.RAGSystem, Global: true, Content: "everyone"}
+	for _, version := range []*models.PromptTemplate{&tenantVersion, &globalVersion} {
+		if err := prompt.CreateVersion(ctx, version, true); err != nil {
+			t.Fatalf("create version error: %v", err)
+		}
+	}
+	if tenantVersion.Version != 1 || globalVersion.Version != 1 {
+		t.Fatalf("expected independent version numbers, got %d and %d", tenantVersion.Version, globalVersion.Version)
+	}
+	if text, _ := prompt.Render(ctx, 0, prompt.RAGSystem, nil); text != "tenant zero" {
+		t.Fatalf("expected tenant 0 to use its own version, got %q", text)
+	}
+	if text, _ := prompt.Render(ctx, 7, prompt.RAGSystem, nil); text != "everyone" {
+		t.Fatalf("expected other tenants to use the global version, got %q", text)
+	}
+
+	// 内置模板的变量固定，不能改为其他变量
+	invalid := models.PromptTemplate{Name: prompt.RAGUser, Global: true, Content: "{{.question}}", Variables: []string{"question"}}
+	var invalidErr *prompt.InvalidTemplateError
+	if err := prompt.CreateVersion(ctx, &invalid, true); !errors.As(err, &invalidErr) {
+		t.Fatalf("expected InvalidTemplateError, got %v", err)
+	}
+
+	if err := prompt.Deactivate(ctx, prompt.RAGSystem, true, 0); err != nil {
+		t.Fatalf("deactivate error: %v", err)
+	}
+	builtin, _ := prompt.Builtin(prompt.RAGSystem)
+	if text, _ := prompt.Render(ctx, 7, prompt.RAGSystem, nil); text != builtin.Content {
+		t.Fatalf("expected the builtin after deactivation, got %q", text)
+	}
+}
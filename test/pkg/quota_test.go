@@ -0,0 +1,164 @@
+package pkg_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/quota"
+)
+
+func setupQuotaDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Team{}, &models.Tool{}, &models.Note{}, &models.TenantQuota{}, &models.UsageDaily{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	if err := pkg.RegisterTenantCallbacks(db); err != nil {
+		t.Fatalf("register tenant callbacks error: %v", err)
+	}
+
+	oldDB, oldQuota := pkg.DB, config.Config.Quota
+	pkg.DB = db
+	config.Config.Quota.Enabled = true
+	config.Config.Quota.MaxUsers, config.Config.Quota.MaxTeams, config.Config.Quota.MaxTools, config.Config.Quota.MaxNotes = 0, 0, 0, 0
+	config.Config.Quota.MaxPluginExecutionsPerDay, config.Config.Quota.MaxLLMTokensPerMonth = 0, 0
+	t.Cleanup(func() {
+		pkg.DB = oldDB
+		config.Config.Quota = oldQuota
+	})
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestQuota_CheckResourceUsesDefaultAndOverride(t *testing.T) {
+	setupQuotaDB(t)
+	config.Config.Quota.MaxTools = 2
+	ctx := context.Background()
+
+	seed := []models.Tool{
+		{Name: "a1", PluginName: "p", TenantID: 1},
+		{Name: "a2", PluginName: "p", TenantID: 1},
+		{Name: "b1", PluginName: "p", TenantID: 2},
+	}
+	if err := pkg.DB.Create(&seed).Error; err != nil {
+		t.Fatalf("seed error: %v", err)
+	}
+
+	err := quota.CheckResource(ctx, 1, quota.ResourceTools)
+	if !pkg.IsQuotaExceeded(err) {
+		t.Fatalf("expected quota exceeded for tenant 1, got %v", err)
+	}
+	if pkg.GetHTTPStatus(err) != 403 {
+		t.Fatalf("expected 403, got %d", pkg.GetHTTPStatus(err))
+	}
+	if err := quota.CheckResource(ctx, 2, quota.ResourceTools); err != nil {
+		t.Fatalf("tenant 2 should be under quota: %v", err)
+	}
+
+	// 租户单独配置优先于全局默认值，0表示不限制
+	if err := pkg.DB.Create(&models.TenantQuota{TenantID: 1, MaxTools: int64Ptr(0)}).Error; err != nil {
+		t.Fatalf("create override error: %v", err)
+	}
+	if err := quota.CheckResource(ctx, 1, quota.ResourceTools); err != nil {
+		t.Fatalf("override should lift the limit: %v", err)
+	}
+
+	config.Config.Quota.Enabled = false
+	if err := pkg.DB.Model(&models.TenantQuota{}).Where("tenant_id = ?", 1).Update("max_tools", 1).Error; err != nil {
+		t.Fatalf("update override error: %v", err)
+	}
+	if err := quota.CheckResource(ctx, 1, quota.ResourceTools); err != nil {
+		t.Fatalf("disabled quota should not reject: %v", err)
+	}
+}
+
+func TestQuota_RecordAccumulatesDailyRollup(t *testing.T) {
+	setupQuotaDB(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := quota.Record(ctx, 1, quota.MetricPluginExecutions, "Note", 1); err != nil {
+			t.Fatalf("record error: %v", err)
+		}
+	}
+	if err := quota.Record(ctx, 1, quota.MetricPluginExecutions, "Weather", 2); err != nil {
+		t.Fatalf("record error: %v", err)
+	}
+	if err := quota.Record(ctx, 2, quota.MetricPluginExecutions, "Note", 5); err != nil {
+		t.Fatalf("record error: %v", err)
+	}
+
+	var rows int64
+	pkg.DB.Model(&models.UsageDaily{}).Where("tenant_id = ?", 1).Count(&rows)
+	if rows != 2 {
+		t.Fatalf("expected 2 rollup rows for tenant 1, got %d", rows)
+	}
+
+	usage, err := quota.GetUsage(ctx, 1)
+	if err != nil {
+		t.Fatalf("get usage error: %v", err)
+	}
+	if usage.PluginExecutionsToday != 5 {
+		t.Fatalf("expected 5 executions today, got %d", usage.PluginExecutionsToday)
+	}
+
+	today := time.Now()
+	rollups, err := quota.GetDailyRollups(ctx, 1, "", today.AddDate(0, 0, -1), today)
+	if err != nil {
+		t.Fatalf("get rollups error: %v", err)
+	}
+	if len(rollups) != 1 || rollups[0].Quantity != 5 {
+		t.Fatalf("unexpected rollups: %+v", rollups)
+	}
+
+	breakdown, err := quota.GetResourceBreakdown(ctx, 1, quota.MetricPluginExecutions, today, today)
+	if err != nil {
+		t.Fatalf("get breakdown error: %v", err)
+	}
+	if len(breakdown) != 2 || breakdown[0].Resource != "Note" || breakdown[0].Quantity != 3 {
+		t.Fatalf("unexpected breakdown: %+v", breakdown)
+	}
+}
+
+func TestQuota_CheckUsageRejectsOverLimit(t *testing.T) {
+	setupQuotaDB(t)
+	config.Config.Quota.MaxLLMTokensPerMonth = 100
+	ctx := pkg.WithTenantID(context.Background(), 3)
+
+	if err := quota.RecordFromContext(ctx, quota.MetricLLMTokens, "LLMChat", 90); err != nil {
+		t.Fatalf("record error: %v", err)
+	}
+	if err := quota.CheckUsageFromContext(ctx, quota.MetricLLMTokens, 10); err != nil {
+		t.Fatalf("exactly reaching the limit should be allowed: %v", err)
+	}
+	if err := quota.CheckUsageFromContext(ctx, quota.MetricLLMTokens, 11); !pkg.IsQuotaExceeded(err) {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+	// 其他租户不受影响
+	if err := quota.CheckUsage(context.Background(), 4, quota.MetricLLMTokens, 50); err != nil {
+		t.Fatalf("tenant 4 should be under quota: %v", err)
+	}
+}
+
+func TestQuota_EstimateTokens(t *testing.T) {
+	if got := quota.EstimateTokens("你好世界"); got != 4 {
+		t.Fatalf("expected 4 tokens for CJK text, got %d", got)
+	}
+	if got := quota.EstimateTokens("hello world"); got != 3 {
+		t.Fatalf("expected 3 tokens for latin text, got %d", got)
+	}
+	if got := quota.EstimateTokens(""); got != 0 {
+		t.Fatalf("expected 0 tokens for empty text, got %d", got)
+	}
+}
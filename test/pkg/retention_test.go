@@ -0,0 +1,262 @@
+package pkg_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/retention"
+	"weave/test/testutil"
+)
+
+func setupRetentionDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return testutil.OpenDB(t, &models.AuditLog{}, &models.AuditCheckpoint{}, &models.LoginHistory{}, &models.ToolHistory{},
+		&models.RetentionPolicy{}, &models.RetentionArchive{})
+}
+
+// seedAuditLogs 为租户追加审计日志，前old条的时间为40天前
+func seedAuditLogs(t *testing.T, db *gorm.DB, tenantID uint, old, recent int) {
+	t.Helper()
+	for i := 0; i < old+recent; i++ {
+		log := &models.AuditLog{Action: "update", ResourceType: "tool", TenantID: tenantID, CreatedAt: time.Now()}
+		if i < old {
+			log.CreatedAt = time.Now().AddDate(0, 0, -40).Add(time.Duration(i) * time.Minute)
+		}
+		if err := pkg.AppendAuditLog(db, log); err != nil {
+			t.Fatalf("append error: %v", err)
+		}
+	}
+}
+
+func setPolicy(t *testing.T, db *gorm.DB, policy models.RetentionPolicy) {
+	t.Helper()
+	if err := db.Create(&policy).Error; err != nil {
+		t.Fatalf("create policy error: %v", err)
+	}
+}
+
+func countRows(t *testing.T, db *gorm.DB, model interface{}, tenantID uint) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Model(model).Where("tenant_id = ?", tenantID).Count(&count).Error; err != nil {
+		t.Fatalf("count error: %v", err)
+	}
+	return count
+}
+
+func TestRetentionArchivesExpiredAuditLogs(t *testing.T) {
+	db := setupRetentionDB(t)
+	seedAuditLogs(t, db, 1, 4, 2)
+	seedAuditLogs(t, db, 2, 3, 0)
+	setPolicy(t, db, models.RetentionPolicy{TenantID: 1, Resource: models.RetentionResourceAuditLog, RetentionDays: 30})
+	setPolicy(t, db, models.RetentionPolicy{TenantID: 2, Resource: models.RetentionResourceAuditLog, RetentionDays: 30})
+
+	dir := t.TempDir()
+	job := retention.NewJob(db, retention.NewLocalStore(dir), retention.Options{BatchSize: 3})
+	report, err := job.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	// 租户1：4条过期记录分两个归档；租户2：链头保留，只归档2条
+	if report.Archives != 3 || report.Archived != 6 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if n := countRows(t, db, &models.AuditLog{}, 1); n != 2 {
+		t.Fatalf("expected 2 audit logs left for tenant 1, got %d", n)
+	}
+	if n := countRows(t, db, &models.AuditLog{}, 2); n != 1 {
+		t.Fatalf("expected chain head to be kept for tenant 2, got %d", n)
+	}
+
+	var archives []models.RetentionArchive
+	db.Where("tenant_id = ?", 1).Order("from_id").Find(&archives)
+	if len(archives) != 2 || archives[1].LastSequence != 4 || archives[1].Count != 1 {
+		t.Fatalf("unexpected archives: %+v", archives)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, archives[0].Location))
+	if err != nil {
+		t.Fatalf("archive file missing: %v", err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != archives[0].SHA256 {
+		t.Fatalf("archive checksum mismatch")
+	}
+
+	// 哈希链校验从归档的最后序号接续
+	for _, tenantID := range []uint{1, 2} {
+		result, err := pkg.VerifyAuditChain(db, tenantID)
+		if err != nil || !result.Valid {
+			t.Fatalf("tenant %d chain invalid after archiving: %+v, %v", tenantID, result, err)
+		}
+	}
+	if result, _ := pkg.VerifyAuditChain(db, 1); result.ArchivedSequence != 4 || result.Entries != 2 || result.HeadSequence != 6 {
+		t.Fatalf("unexpected verify result: %+v", result)
+	}
+
+	// 重复执行不会再次归档
+	if report, err := job.Run(context.Background()); err != nil || report.Archived != 0 {
+		t.Fatalf("expected nothing to archive, got %+v, %v", report, err)
+	}
+
+	// 新的审计日志继续链接到保留的链头
+	seedAuditLogs(t, db, 2, 0, 1)
+	if result, _ := pkg.VerifyAuditChain(db, 2); !result.Valid || result.HeadSequence != 4 {
+		t.Fatalf("unexpected verify result after append: %+v", result)
+	}
+}
+
+func TestRetentionRestoreAndPurge(t *testing.T) {
+	db := setupRetentionDB(t)
+	seedAuditLogs(t, db, 1, 4, 1)
+	setPolicy(t, db, models.RetentionPolicy{TenantID: 1, Resource: models.RetentionResourceAuditLog, RetentionDays: 30})
+
+	dir := t.TempDir()
+	job := retention.NewJob(db, retention.NewLocalStore(dir), retention.Options{BatchSize: 2, RestoreTTL: time.Hour})
+	if _, err := job.Run(context.Background()); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	// 只恢复与时间范围重叠的第一个归档
+	from := time.Now().AddDate(0, 0, -41)
+	to := time.Now().AddDate(0, 0, -40).Add(30 * time.Second)
+	result, err := job.Restore(context.Background(), 1, models.RetentionResourceAuditLog, from, to)
+	if err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+	if len(result.Archives) != 1 || result.Restored != 2 || result.Archives[0].RestoredUntil == nil {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+	if n := countRows(t, db, &models.AuditLog{}, 1); n != 3 {
+		t.Fatalf("expected 3 audit logs after restore, got %d", n)
+	}
+	if verify, _ := pkg.VerifyAuditChain(db, 1); !verify.Valid {
+		t.Fatalf("chain invalid after restore: %+v", verify)
+	}
+
+	// 重复恢复不会重复写入
+	if result, err := job.Restore(context.Background(), 1, models.RetentionResourceAuditLog, from, to); err != nil || result.Restored != 0 {
+		t.Fatalf("expected idempotent restore, got %+v, %v", result, err)
+	}
+
+	// 恢复期满后再次删除
+	db.Model(&models.RetentionArchive{}).Where("id = ?", result.Archives[0].ID).Update("restored_until", time.Now().Add(-time.Minute))
+	report, err := job.Run(context.Background())
+	if err != nil || report.Purged != 2 {
+		t.Fatalf("expected 2 purged, got %+v, %v", report, err)
+	}
+	if n := countRows(t, db, &models.AuditLog{}, 1); n != 1 {
+		t.Fatalf("expected restored logs to be purged, got %d", n)
+	}
+
+	// 被篡改的归档拒绝恢复
+	var archive models.RetentionArchive
+	db.Where("tenant_id = ?", 1).Order("from_id").First(&archive)
+	path := filepath.Join(dir, archive.Location)
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0o600)
+	if _, err := job.Restore(context.Background(), 1, models.RetentionResourceAuditLog, from, to); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+}
+
+func TestRetentionLegalHoldSuspendsDeletion(t *testing.T) {
+	db := setupRetentionDB(t)
+	old := time.Now().AddDate(0, 0, -10)
+	for i := 0; i < 3; i++ {
+		db.Create(&models.LoginHistory{Username: "alice", Success: true, TenantID: 1, LoginTime: old})
+		db.Create(&models.ToolHistory{UserID: 1, ToolID: 1, TenantID: 1, UsedAt: old})
+	}
+	setPolicy(t, db, models.RetentionPolicy{TenantID: 1, Resource: models.RetentionResourceLoginHistory, RetentionDays: 7,
+		LegalHold: true, LegalHoldReason: "litigation"})
+	setPolicy(t, db, models.RetentionPolicy{TenantID: 1, Resource: models.RetentionResourceToolHistory, RetentionDays: 7})
+
+	job := retention.NewJob(db, retention.NewLocalStore(t.TempDir()), retention.Options{})
+	report, err := job.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if report.Held != 1 || report.Archived != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if n := countRows(t, db, &models.LoginHistory{}, 1); n != 3 {
+		t.Fatalf("login history under legal hold was deleted, %d left", n)
+	}
+	if n := countRows(t, db, &models.ToolHistory{}, 1); n != 0 {
+		t.Fatalf("expected tool history to be archived, %d left", n)
+	}
+
+	// 未单独设置策略的资源使用默认值
+	policy, err := retention.Policy(db, 2, models.RetentionResourceAuditLog)
+	if err != nil || policy.ID != 0 || policy.TenantID != 2 {
+		t.Fatalf("unexpected default policy: %+v, %v", policy, err)
+	}
+}
+
+func TestS3StoreSignsRequests(t *testing.T) {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(auth, "/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			sum := sha256.Sum256(body)
+			if r.Header.Get("x-amz-content-sha256") != hex.EncodeToString(sum[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	store, err := retention.NewS3Store(retention.S3Options{
+		Endpoint: server.URL, Region: "eu-west-1", Bucket: "audit", Prefix: "/weave/",
+		AccessKey: "AKID", SecretKey: "secret", PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("new store error: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "tenant-1/audit_log/1-2.ndjson.gz", []byte("data")); err != nil {
+		t.Fatalf("put error: %v", err)
+	}
+	if _, ok := objects["/audit/weave/tenant-1/audit_log/1-2.ndjson.gz"]; !ok {
+		t.Fatalf("unexpected object keys: %v", objects)
+	}
+	data, err := store.Get(ctx, "tenant-1/audit_log/1-2.ndjson.gz")
+	if err != nil || string(data) != "data" {
+		t.Fatalf("unexpected get result: %q, %v", data, err)
+	}
+	if _, err := store.Get(ctx, "missing"); err == nil {
+		t.Fatalf("expected error for missing object")
+	}
+}
@@ -0,0 +1,88 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"weave/models"
+	"weave/pkg"
+)
+
+func TestShare_NoteAccessLevel(t *testing.T) {
+	db := setupTeamHierarchyDB(t)
+	if err := db.AutoMigrate(&models.Note{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	note := models.Note{ID: "n1", UserID: 4, TenantID: 1, Title: "plan", Content: "..."}
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("seed note error: %v", err)
+	}
+	shares := []models.ResourceShare{
+		// 共享给backend团队：eng管理员通过继承的角色获得read
+		{TenantID: 1, ResourceType: models.ShareResourceNote, ResourceID: "n1", SubjectType: models.ShareSubjectTeam, SubjectID: 2, Level: models.ShareLevelRead},
+		// 直接共享给bob：取较高的write
+		{TenantID: 1, ResourceType: models.ShareResourceNote, ResourceID: "n1", SubjectType: models.ShareSubjectUser, SubjectID: 2, Level: models.ShareLevelWrite},
+	}
+	if err := db.Create(&shares).Error; err != nil {
+		t.Fatalf("seed shares error: %v", err)
+	}
+
+	cases := map[uint]string{
+		4: models.ShareLevelAdmin, // 所有者
+		1: models.ShareLevelRead,  // 上级团队管理员继承backend角色
+		2: models.ShareLevelWrite, // 团队read与直接write取最高
+		3: "",                     // 下级团队成员不继承上级团队的共享
+		5: "",                     // 无关用户
+	}
+	for userID, want := range cases {
+		got, err := pkg.NoteAccessLevel(db, &note, userID)
+		if err != nil {
+			t.Fatalf("access level error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("user %d: expected %q, got %q", userID, want, got)
+		}
+	}
+
+	levels, err := pkg.SharedWithUser(db, 1, models.ShareResourceNote, 1)
+	if err != nil || levels["n1"] != models.ShareLevelRead {
+		t.Fatalf("unexpected shared notes: %v, %v", levels, err)
+	}
+	// 其他租户看不到共享
+	if levels, _ := pkg.SharedWithUser(db, 2, models.ShareResourceNote, 2); len(levels) != 0 {
+		t.Fatalf("expected no cross-tenant shares, got %v", levels)
+	}
+}
+
+func TestShare_ToolAccessLevel(t *testing.T) {
+	db := setupTeamHierarchyDB(t)
+	tool := models.Tool{Name: "deploy", PluginName: "p", IsEnabled: true, TenantID: 1, OwnerID: 3, TeamID: uintPtr(3)}
+	if err := db.Create(&tool).Error; err != nil {
+		t.Fatalf("seed tool error: %v", err)
+	}
+
+	check := func(userID uint, want string) {
+		t.Helper()
+		got, err := pkg.ToolAccessLevel(db, &tool, userID)
+		if err != nil {
+			t.Fatalf("access level error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("user %d: expected %q, got %q", userID, want, got)
+		}
+	}
+	check(3, models.ShareLevelAdmin) // 所有者
+	check(1, models.ShareLevelAdmin) // 上级团队管理员
+	check(2, models.ShareLevelRead)  // 上级团队成员可以使用
+	check(4, "")                     // 范围外
+
+	share := models.ResourceShare{TenantID: 1, ResourceType: models.ShareResourceTool, ResourceID: "1", SubjectType: models.ShareSubjectTeam, SubjectID: 5, Level: models.ShareLevelWrite}
+	if err := db.Create(&share).Error; err != nil {
+		t.Fatalf("seed share error: %v", err)
+	}
+	check(4, models.ShareLevelWrite) // 通过团队共享获得范围外的权限
+
+	if err := pkg.DeleteResourceShares(db, 1, models.ShareResourceTool, "1"); err != nil {
+		t.Fatalf("delete shares error: %v", err)
+	}
+	check(4, "")
+}
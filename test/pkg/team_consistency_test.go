@@ -0,0 +1,139 @@
+package pkg_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/models"
+	"weave/pkg"
+)
+
+// setupInconsistentTeamDB 构造各类团队成员不一致数据，模拟唯一约束建立前的历史数据
+func setupInconsistentTeamDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Team{}, &models.TeamMember{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	if err := db.Migrator().DropIndex(&models.TeamMember{}, "idx_team_member_team_user"); err != nil {
+		t.Fatalf("drop index error: %v", err)
+	}
+	pkg.DB = db
+
+	users := []models.User{
+		{ID: 1, Username: "alice", Email: "alice@example.com", TenantID: 1},
+		{ID: 2, Username: "bob", Email: "bob@example.com", TenantID: 1},
+		{ID: 3, Username: "carol", Email: "carol@example.com", TenantID: 1},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("seed users error: %v", err)
+	}
+	teams := []models.Team{
+		{ID: 1, Name: "alpha", OwnerID: 1, TenantID: 1},
+		{ID: 2, Name: "beta", OwnerID: 2, TenantID: 1},
+	}
+	if err := db.Create(&teams).Error; err != nil {
+		t.Fatalf("seed teams error: %v", err)
+	}
+	members := []models.TeamMember{
+		{ID: 1, TeamID: 1, UserID: 1, Role: "owner", TenantID: 1},
+		{ID: 2, TeamID: 1, UserID: 2, Role: "member", TenantID: 1},
+		{ID: 3, TeamID: 1, UserID: 2, Role: "admin", TenantID: 1}, // 重复记录，保留admin
+		{ID: 4, TeamID: 1, UserID: 3, Role: "owner", TenantID: 2}, // 多余owner且租户不一致
+		{ID: 5, TeamID: 9, UserID: 1, Role: "member", TenantID: 1}, // 团队不存在
+		{ID: 6, TeamID: 2, UserID: 42, Role: "member", TenantID: 1}, // 用户不存在
+		// 团队2的所有者bob没有成员记录
+	}
+	if err := db.Create(&members).Error; err != nil {
+		t.Fatalf("seed members error: %v", err)
+	}
+	return db
+}
+
+func countIssues(report *pkg.TeamConsistencyReport) map[string]int {
+	counts := map[string]int{}
+	for _, issue := range report.Issues {
+		counts[issue.Kind]++
+	}
+	return counts
+}
+
+func TestCheckTeamMembership_ReportAndFix(t *testing.T) {
+	db := setupInconsistentTeamDB(t)
+
+	report, err := pkg.CheckTeamMembership(context.Background(), false)
+	if err != nil {
+		t.Fatalf("check error: %v", err)
+	}
+	counts := countIssues(report)
+	expected := map[string]int{
+		pkg.TeamIssueDuplicateMember: 1,
+		pkg.TeamIssueOrphanTeam:      1,
+		pkg.TeamIssueOrphanUser:      1,
+		pkg.TeamIssueTenantMismatch:  1,
+		pkg.TeamIssueExtraOwner:      1,
+		pkg.TeamIssueMissingOwner:    1,
+	}
+	for kind, n := range expected {
+		if counts[kind] != n {
+			t.Fatalf("expected %d %s issues, got %d (%v)", n, kind, counts[kind], report.Issues)
+		}
+	}
+	if report.Fixed != 0 {
+		t.Fatalf("dry run should not fix anything, fixed %d", report.Fixed)
+	}
+
+	if _, err := pkg.CheckTeamMembership(context.Background(), true); err != nil {
+		t.Fatalf("fix error: %v", err)
+	}
+
+	var bob []models.TeamMember
+	db.Where("team_id = 1 AND user_id = 2").Find(&bob)
+	if len(bob) != 1 || bob[0].Role != "admin" {
+		t.Fatalf("expected one admin row for bob, got %#v", bob)
+	}
+	var carol models.TeamMember
+	db.First(&carol, 4)
+	if carol.Role != "admin" || carol.TenantID != 1 {
+		t.Fatalf("unexpected carol membership: %#v", carol)
+	}
+	var orphans int64
+	db.Model(&models.TeamMember{}).Where("id IN (5, 6)").Count(&orphans)
+	if orphans != 0 {
+		t.Fatalf("expected orphan rows to be removed, got %d", orphans)
+	}
+	var owner models.TeamMember
+	if err := db.Where("team_id = 2 AND user_id = 2 AND role = 'owner'").First(&owner).Error; err != nil {
+		t.Fatalf("expected owner row for team 2: %v", err)
+	}
+
+	report, err = pkg.CheckTeamMembership(context.Background(), false)
+	if err != nil {
+		t.Fatalf("recheck error: %v", err)
+	}
+	if len(report.Issues) != 0 {
+		t.Fatalf("expected no issues after fix, got %v", report.Issues)
+	}
+}
+
+func TestDeduplicateTeamMembers_AllowsUniqueIndex(t *testing.T) {
+	db := setupInconsistentTeamDB(t)
+
+	removed, err := models.DeduplicateTeamMembers(db)
+	if err != nil {
+		t.Fatalf("dedupe error: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 removed row, got %d", removed)
+	}
+	if err := db.Migrator().CreateIndex(&models.TeamMember{}, "idx_team_member_team_user"); err != nil {
+		t.Fatalf("create unique index after dedupe error: %v", err)
+	}
+}
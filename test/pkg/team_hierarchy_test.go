@@ -0,0 +1,180 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/models"
+	"weave/pkg"
+)
+
+func uintPtr(v uint) *uint { return &v }
+
+// setupTeamHierarchyDB 构造团队层级：eng(1) -> backend(2) -> api(3)，eng -> frontend(4)，sales(5)
+// alice(1)是eng管理员，bob(2)是backend成员，carol(3)是api所有者，dave(4)是sales成员
+func setupTeamHierarchyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Team{}, &models.TeamMember{}, &models.Tool{}, &models.PluginTeamScope{}, &models.ResourceShare{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	pkg.DB = db
+
+	teams := []models.Team{
+		{ID: 1, Name: "eng", OwnerID: 9, TenantID: 1},
+		{ID: 2, Name: "backend", OwnerID: 9, TenantID: 1, ParentID: uintPtr(1)},
+		{ID: 3, Name: "api", OwnerID: 3, TenantID: 1, ParentID: uintPtr(2)},
+		{ID: 4, Name: "frontend", OwnerID: 9, TenantID: 1, ParentID: uintPtr(1)},
+		{ID: 5, Name: "sales", OwnerID: 9, TenantID: 1},
+	}
+	if err := db.Create(&teams).Error; err != nil {
+		t.Fatalf("seed teams error: %v", err)
+	}
+	members := []models.TeamMember{
+		{TeamID: 1, UserID: 1, Role: "admin", TenantID: 1},
+		{TeamID: 2, UserID: 2, Role: "member", TenantID: 1},
+		{TeamID: 3, UserID: 3, Role: "owner", TenantID: 1},
+		{TeamID: 5, UserID: 4, Role: "member", TenantID: 1},
+	}
+	if err := db.Create(&members).Error; err != nil {
+		t.Fatalf("seed members error: %v", err)
+	}
+	return db
+}
+
+func TestTeamHierarchy_Navigation(t *testing.T) {
+	db := setupTeamHierarchyDB(t)
+	h, err := pkg.LoadTeamHierarchy(db, 1)
+	if err != nil {
+		t.Fatalf("load hierarchy error: %v", err)
+	}
+
+	if got := h.Ancestors(3); len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Fatalf("unexpected ancestors of api: %v", got)
+	}
+	if got := h.Descendants(1); len(got) != 3 {
+		t.Fatalf("expected 3 descendants of eng, got %v", got)
+	}
+	if h.Depth(3) != 3 {
+		t.Fatalf("expected api depth 3, got %d", h.Depth(3))
+	}
+	if roots := h.Roots(); len(roots) != 2 {
+		t.Fatalf("expected 2 roots, got %v", roots)
+	}
+}
+
+func TestTeamHierarchy_ValidateParent(t *testing.T) {
+	db := setupTeamHierarchyDB(t)
+	h, err := pkg.LoadTeamHierarchy(db, 1)
+	if err != nil {
+		t.Fatalf("load hierarchy error: %v", err)
+	}
+
+	if err := h.ValidateParent(1, uintPtr(3), 8); !errors.Is(err, pkg.ErrTeamCycle) {
+		t.Fatalf("expected cycle error moving eng under api, got %v", err)
+	}
+	if err := h.ValidateParent(2, uintPtr(2), 8); !errors.Is(err, pkg.ErrTeamCycle) {
+		t.Fatalf("expected cycle error moving team under itself, got %v", err)
+	}
+	if err := h.ValidateParent(2, uintPtr(5), 8); err != nil {
+		t.Fatalf("expected backend to move under sales, got %v", err)
+	}
+	// backend子树高度为2，放到深度3的api下会超过深度3
+	if err := h.ValidateParent(4, uintPtr(3), 3); !errors.Is(err, pkg.ErrTeamDepthExceed) {
+		t.Fatalf("expected depth error, got %v", err)
+	}
+	if err := h.ValidateParent(0, uintPtr(42), 8); !errors.Is(err, pkg.ErrTeamNotFound) {
+		t.Fatalf("expected not found for missing parent, got %v", err)
+	}
+}
+
+func TestEffectiveTeamRole_Inheritance(t *testing.T) {
+	db := setupTeamHierarchyDB(t)
+
+	cases := []struct {
+		teamID, userID uint
+		role           string
+		inherited      bool
+	}{
+		{3, 1, "admin", true},  // eng管理员在api中继承为管理员
+		{3, 2, "member", true}, // backend成员在api中继承为成员
+		{3, 3, "owner", false}, // api所有者保持直接角色
+		{2, 3, "", false},      // 下级团队成员不继承上级团队角色
+		{4, 4, "", false},      // 其他部门成员无角色
+	}
+	for _, tc := range cases {
+		role, err := pkg.EffectiveTeamRole(db, 1, tc.teamID, tc.userID)
+		if err != nil {
+			t.Fatalf("effective role error: %v", err)
+		}
+		if tc.role == "" {
+			if role != nil {
+				t.Fatalf("team %d user %d: expected no role, got %#v", tc.teamID, tc.userID, role)
+			}
+			continue
+		}
+		if role == nil || role.Role != tc.role || role.Inherited != tc.inherited {
+			t.Fatalf("team %d user %d: expected %s (inherited=%v), got %#v", tc.teamID, tc.userID, tc.role, tc.inherited, role)
+		}
+	}
+}
+
+func TestCanUseTool_TeamSubtreeScope(t *testing.T) {
+	db := setupTeamHierarchyDB(t)
+
+	tool := models.Tool{Name: "deploy", PluginName: "ops", TenantID: 1, TeamID: uintPtr(2)}
+	for userID, expected := range map[uint]bool{1: true, 2: true, 3: true, 4: false} {
+		allowed, err := pkg.CanUseTool(db, &tool, userID)
+		if err != nil {
+			t.Fatalf("can use tool error: %v", err)
+		}
+		if allowed != expected {
+			t.Fatalf("user %d: expected %v, got %v", userID, expected, allowed)
+		}
+	}
+
+	// 插件限定到sales后，工具同时受两个范围限制
+	if err := db.Create(&models.PluginTeamScope{TenantID: 1, PluginName: "ops", TeamID: 5}).Error; err != nil {
+		t.Fatalf("seed plugin scope error: %v", err)
+	}
+	allowed, err := pkg.CanUseTool(db, &tool, 2)
+	if err != nil || allowed {
+		t.Fatalf("expected plugin scope to deny backend member, got %v, %v", allowed, err)
+	}
+	allowed, err = pkg.CanUsePlugin(context.Background(), 1, "ops", 4)
+	if err != nil || !allowed {
+		t.Fatalf("expected sales member to use plugin, got %v, %v", allowed, err)
+	}
+}
+
+func TestCheckTeamMembership_InvalidParent(t *testing.T) {
+	db := setupTeamHierarchyDB(t)
+	// 构造环：eng -> api，同时api位于eng之下
+	db.Model(&models.Team{}).Where("id = 1").Update("parent_id", 3)
+	// 上级团队不存在
+	db.Model(&models.Team{}).Where("id = 5").Update("parent_id", 42)
+
+	report, err := pkg.CheckTeamMembership(context.Background(), true)
+	if err != nil {
+		t.Fatalf("check error: %v", err)
+	}
+	if n := countIssues(report)[pkg.TeamIssueInvalidParent]; n != 2 {
+		t.Fatalf("expected 2 invalid parent issues, got %d (%v)", n, report.Issues)
+	}
+
+	report, err = pkg.CheckTeamMembership(context.Background(), false)
+	if err != nil {
+		t.Fatalf("recheck error: %v", err)
+	}
+	if n := countIssues(report)[pkg.TeamIssueInvalidParent]; n != 0 {
+		t.Fatalf("expected parents fixed, got %v", report.Issues)
+	}
+}
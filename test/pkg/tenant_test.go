@@ -0,0 +1,137 @@
+package pkg_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"weave/models"
+	"weave/pkg"
+)
+
+func setupTenantScopedDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Tool{}, &models.Tenant{}); err != nil {
+		t.Fatalf("auto migrate error: %v", err)
+	}
+	if err := pkg.RegisterTenantCallbacks(db); err != nil {
+		t.Fatalf("register tenant callbacks error: %v", err)
+	}
+
+	seed := []models.Tool{
+		{Name: "a1", PluginName: "p", TenantID: 1},
+		{Name: "a2", PluginName: "p", TenantID: 1},
+		{Name: "b1", PluginName: "p", TenantID: 2},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("seed error: %v", err)
+	}
+	return db
+}
+
+func TestTenantScope_QueryWithoutWhereIsIsolated(t *testing.T) {
+	db := setupTenantScopedDB(t)
+	ctx := pkg.WithTenantID(context.Background(), 1)
+
+	var tools []models.Tool
+	if err := db.WithContext(ctx).Find(&tools).Error; err != nil {
+		t.Fatalf("find error: %v", err)
+	}
+	if len(tools) != 2 {
+		t.Fatalf("expected 2 tools for tenant 1, got %d", len(tools))
+	}
+
+	var count int64
+	if err := db.WithContext(pkg.WithTenantID(context.Background(), 2)).Model(&models.Tool{}).Count(&count).Error; err != nil {
+		t.Fatalf("count error: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 tool for tenant 2, got %d", count)
+	}
+
+	// 跨租户访问需显式声明
+	if err := db.WithContext(pkg.WithoutTenantScope(ctx)).Model(&models.Tool{}).Count(&count).Error; err != nil {
+		t.Fatalf("count error: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 tools without tenant scope, got %d", count)
+	}
+}
+
+func TestTenantScope_UpdateAndDeleteCannotTouchOtherTenants(t *testing.T) {
+	db := setupTenantScopedDB(t)
+	ctx := pkg.WithTenantID(context.Background(), 2)
+
+	if err := db.WithContext(ctx).Model(&models.Tool{}).Where("name LIKE ?", "%").Update("description", "changed").Error; err != nil {
+		t.Fatalf("update error: %v", err)
+	}
+	if err := db.WithContext(ctx).Where("name = ?", "a1").Delete(&models.Tool{}).Error; err != nil {
+		t.Fatalf("delete error: %v", err)
+	}
+
+	var a1 models.Tool
+	if err := db.Where("name = ?", "a1").First(&a1).Error; err != nil {
+		t.Fatalf("tenant 1 tool should not be deleted by tenant 2: %v", err)
+	}
+	if a1.Description == "changed" {
+		t.Fatalf("tenant 1 tool should not be updated by tenant 2")
+	}
+
+	var b1 models.Tool
+	_ = db.Where("name = ?", "b1").First(&b1).Error
+	if b1.Description != "changed" {
+		t.Fatalf("expected tenant 2 tool to be updated, got %q", b1.Description)
+	}
+}
+
+func TestTenantScope_CreateFillsAndGuardsTenantID(t *testing.T) {
+	db := setupTenantScopedDB(t)
+	ctx := pkg.WithTenantID(context.Background(), 3)
+
+	tool := models.Tool{Name: "c1", PluginName: "p"}
+	if err := db.WithContext(ctx).Create(&tool).Error; err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+	if tool.TenantID != 3 {
+		t.Fatalf("expected tenant_id filled with 3, got %d", tool.TenantID)
+	}
+
+	foreign := models.Tool{Name: "c2", PluginName: "p", TenantID: 1}
+	if err := db.WithContext(ctx).Create(&foreign).Error; err == nil {
+		t.Fatalf("expected cross-tenant create to be rejected")
+	}
+}
+
+func TestCheckTenantActive(t *testing.T) {
+	db := setupTenantScopedDB(t)
+	oldDB := pkg.DB
+	pkg.DB = db
+	defer func() { pkg.DB = oldDB }()
+
+	tenant := models.Tenant{Name: "Acme", Slug: "acme", Status: models.TenantStatusActive}
+	if err := db.Create(&tenant).Error; err != nil {
+		t.Fatalf("create tenant error: %v", err)
+	}
+
+	if err := pkg.CheckTenantActive(context.Background(), tenant.ID); err != nil {
+		t.Fatalf("expected active tenant, got %v", err)
+	}
+
+	db.Model(&tenant).Update("status", models.TenantStatusSuspended)
+	pkg.InvalidateTenantStatus(tenant.ID)
+	if err := pkg.CheckTenantActive(context.Background(), tenant.ID); err == nil {
+		t.Fatalf("expected suspended tenant to be rejected")
+	}
+
+	// 没有租户记录的历史租户视为可用
+	if err := pkg.CheckTenantActive(context.Background(), 999); err != nil {
+		t.Fatalf("expected legacy tenant to be allowed, got %v", err)
+	}
+}
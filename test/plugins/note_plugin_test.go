@@ -0,0 +1,48 @@
+package plugins_test
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"weave/models"
+	"weave/pkg"
+	note "weave/plugins/features/Note"
+	"weave/test/testutil"
+)
+
+func TestNotePluginIsolatesTenants(t *testing.T) {
+	db := testutil.OpenDB(t, &models.Note{}, &models.ResourceShare{})
+	if err := pkg.RegisterTenantCallbacks(db); err != nil {
+		t.Fatalf("register tenant callbacks error: %v", err)
+	}
+	pkg.DB = db
+	t.Cleanup(func() { pkg.DB = nil })
+
+	p := &note.NotePlugin{}
+	created, err := p.Execute(map[string]interface{}{"action": "create", "user_id": "1", "tenant_id": "1", "title": "plan", "content": "tenant one"})
+	if err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+	if n := created.(models.Note); n.TenantID != 1 {
+		t.Fatalf("expected tenant 1 to be filled in, got %d", n.TenantID)
+	}
+	if _, err := p.Execute(map[string]interface{}{"action": "create", "user_id": "1", "tenant_id": "2", "title": "plan", "content": "tenant two"}); err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+
+	// 同一用户ID在另一个租户中看不到也取不到租户1的笔记
+	for _, action := range []string{"list", "search"} {
+		result, err := p.Execute(map[string]interface{}{"action": action, "user_id": "1", "tenant_id": "2", "keyword": "plan"})
+		if err != nil {
+			t.Fatalf("%s error: %v", action, err)
+		}
+		notes := result.(gin.H)["notes"].([]models.Note)
+		if len(notes) != 1 || notes[0].Content != "tenant two" {
+			t.Fatalf("%s: expected only tenant 2 note, got %+v", action, notes)
+		}
+	}
+	if _, err := p.Execute(map[string]interface{}{"action": "get", "user_id": "1", "tenant_id": "2", "id": created.(models.Note).ID}); err == nil {
+		t.Fatalf("expected tenant 2 to be denied tenant 1 note")
+	}
+}
@@ -0,0 +1,160 @@
+package plugins_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/quota"
+	"weave/plugins"
+	"weave/plugins/core"
+	"weave/test/testutil"
+	"weave/utils"
+)
+
+// setupScopedPlugin 注册带认证路由的插件，租户1中ops(1)团队有alice(1)，sales(2)团队有bob(2)
+func setupScopedPlugin(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	resetPluginManager(t)
+	config.Config.JWT.Secret = "testsecret"
+
+	db := testutil.OpenDB(t, &models.Tenant{}, &models.Team{}, &models.TeamMember{}, &models.PluginTeamScope{},
+		&models.TenantQuota{}, &models.UsageDaily{})
+	pkg.DB = db
+	t.Cleanup(func() { pkg.DB = nil })
+	db.Create(&models.Team{ID: 1, Name: "ops", OwnerID: 1, TenantID: 1})
+	db.Create(&models.Team{ID: 2, Name: "sales", OwnerID: 2, TenantID: 1})
+	db.Create(&models.TeamMember{TeamID: 1, UserID: 1, Role: "owner", TenantID: 1})
+	db.Create(&models.TeamMember{TeamID: 2, UserID: 2, Role: "owner", TenantID: 1})
+
+	r := gin.New()
+	plugins.PluginManager.SetRouter(r)
+	p := &mockPlugin{
+		name: "scoped",
+		routes: []core.Route{
+			{Path: "ping", Method: "GET", AuthRequired: true, Handler: func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"message": "ok"})
+			}},
+			{Path: "run", Method: "POST", AuthRequired: true, Handler: func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"message": "done"})
+			}},
+			{Path: "fail", Method: "POST", AuthRequired: true, Handler: func(c *gin.Context) {
+				pkg.RespondError(c, pkg.NewValidationError("Invalid request", nil))
+			}},
+		},
+	}
+	if err := plugins.PluginManager.Register(p); err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	return r
+}
+
+func requestPluginRoute(t *testing.T, r *gin.Engine, method, path string, userID, tenantID uint) *httptest.ResponseRecorder {
+	t.Helper()
+	token, err := utils.GenerateToken(userID, tenantID)
+	if err != nil {
+		t.Fatalf("generate token error: %v", err)
+	}
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPluginRouteRejectsUserOutsideTeamScope(t *testing.T) {
+	r := setupScopedPlugin(t)
+
+	// 未限定团队范围时租户内用户都可以访问
+	if w := requestPluginRoute(t, r, "GET", "/plugins/scoped/ping", 2, 1); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 without scope, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if err := pkg.DB.Create(&models.PluginTeamScope{TenantID: 1, PluginName: "scoped", TeamID: 1}).Error; err != nil {
+		t.Fatalf("seed plugin scope error: %v", err)
+	}
+	if w := requestPluginRoute(t, r, "GET", "/plugins/scoped/ping", 1, 1); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for ops member, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := requestPluginRoute(t, r, "GET", "/plugins/scoped/ping", 2, 1); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for sales member, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// pluginExecutions 返回租户当天计量的插件执行次数
+func pluginExecutions(t *testing.T, tenantID uint) int64 {
+	t.Helper()
+	today := time.Now()
+	rollups, err := quota.GetDailyRollups(context.Background(), tenantID, quota.MetricPluginExecutions, today, today)
+	if err != nil {
+		t.Fatalf("get rollups error: %v", err)
+	}
+	var total int64
+	for _, rollup := range rollups {
+		total += rollup.Quantity
+	}
+	return total
+}
+
+func TestPluginCallsOverQuotaAreRejected(t *testing.T) {
+	r := setupScopedPlugin(t)
+	oldQuota := config.Config.Quota
+	config.Config.Quota.Enabled = true
+	config.Config.Quota.MaxPluginExecutionsPerDay = 2
+	t.Cleanup(func() { config.Config.Quota = oldQuota })
+
+	// 只有成功的执行请求按认证的租户计量，读取和失败的请求不计量
+	if w := requestPluginRoute(t, r, "GET", "/plugins/scoped/ping", 1, 1); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a read, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := requestPluginRoute(t, r, "POST", "/plugins/scoped/fail", 1, 1); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a failed call, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := pluginExecutions(t, 1); got != 0 {
+		t.Fatalf("expected reads and failed calls not to be metered, got %d", got)
+	}
+	if w := requestPluginRoute(t, r, "POST", "/plugins/scoped/run", 1, 1); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 under quota, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := pluginExecutions(t, 1); got != 1 {
+		t.Fatalf("expected route call to be metered, got %d", got)
+	}
+
+	// 直接执行时租户来自上下文，参数中没有tenant_id
+	ctx := pkg.WithTenantID(context.Background(), 1)
+	if _, err := plugins.PluginManager.ExecutePluginContext(ctx, "scoped", map[string]interface{}{"user_id": "1"}); err != nil {
+		t.Fatalf("expected execution under quota, got %v", err)
+	}
+	if _, err := plugins.PluginManager.ExecutePluginContext(ctx, "scoped", map[string]interface{}{"user_id": "1"}); !pkg.IsQuotaExceeded(err) {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+
+	w := requestPluginRoute(t, r, "POST", "/plugins/scoped/run", 1, 1)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 over quota, got %d: %s", w.Code, w.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json unmarshal error: %v", err)
+	}
+	if body["code"] != "TENANT_QUOTA_EXCEEDED" {
+		t.Fatalf("expected TENANT_QUOTA_EXCEEDED, got %v", body)
+	}
+	// 超出配额后读取请求不受影响
+	if w := requestPluginRoute(t, r, "GET", "/plugins/scoped/ping", 1, 1); w.Code != http.StatusOK {
+		t.Fatalf("expected reads to be allowed over quota, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 其他租户不受影响
+	if w := requestPluginRoute(t, r, "POST", "/plugins/scoped/run", 1, 2); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for another tenant, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -13,8 +13,14 @@ import (
 	"gorm.io/gorm/schema"
 
 	"weave/config"
+	"weave/models"
 	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/prompt"
+	"weave/plugins"
 	"weave/routers"
+	"weave/services/llm"
+	"weave/test/testutil"
 	"weave/utils"
 )
 
@@ -116,8 +122,11 @@ func TestPluginsList_Unauthorized(t *testing.T) {
 	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
 		t.Fatalf("json unmarshal error: %v", err)
 	}
-	if body["error"] != "Authorization header is required" {
-		t.Fatalf("expected error 'Authorization header is required', got %#v", body["error"])
+	if body["code"] != "UNAUTHORIZED" || body["message"] != "Authorization header is required" {
+		t.Fatalf("expected UNAUTHORIZED 'Authorization header is required', got %#v", body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") {
+		t.Fatalf("expected problem+json content type, got %q", ct)
 	}
 }
 
@@ -161,3 +170,66 @@ func TestMetricsEndpoint_OK(t *testing.T) {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
 }
+
+// TestLLMStreamRoutesEnforcePluginScope LLMChat限定到团队后，插件路由和/api/v1/llm/stream别名都拒绝范围外的用户
+func TestLLMStreamRoutesEnforcePluginScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Config.JWT.Secret = "testsecret"
+	csrfEnabled := config.Config.CSRF.Enabled
+	config.Config.CSRF.Enabled = false
+	t.Cleanup(func() { config.Config.CSRF.Enabled = csrfEnabled })
+	db := testutil.OpenDB(t, &models.Tenant{}, &models.AuditLog{}, &models.Team{}, &models.TeamMember{}, &models.PluginTeamScope{},
+		&models.Conversation{}, &models.ConversationMessage{}, &models.TenantLLMConfig{}, &models.Tool{}, &models.ToolHistory{},
+		&models.ResourceShare{}, &models.PromptTemplate{}, &models.LLMUsage{}, &models.TenantQuota{}, &models.UsageDaily{})
+	pkg.DB = db
+	t.Cleanup(func() { pkg.DB = nil })
+	prompt.Invalidate()
+	db.Create(&models.Team{ID: 1, Name: "support", OwnerID: 1, TenantID: 1})
+	db.Create(&models.Team{ID: 2, Name: "sales", OwnerID: 2, TenantID: 1})
+	db.Create(&models.TeamMember{TeamID: 1, UserID: 1, Role: "owner", TenantID: 1})
+	db.Create(&models.TeamMember{TeamID: 2, UserID: 2, Role: "owner", TenantID: 1})
+	db.Create(&models.PluginTeamScope{TenantID: 1, PluginName: "LLMChat", TeamID: 1})
+
+	registry, err := llmprovider.NewRegistry(config.LLMConfig{
+		Providers: []config.LLMProviderConfig{{Name: "test", Type: "fake", Model: "echo"}},
+		Default:   "test",
+	})
+	if err != nil {
+		t.Fatalf("new registry error: %v", err)
+	}
+	router := routers.SetupRouter()
+	for _, name := range plugins.PluginManager.ListPlugins() {
+		_ = plugins.PluginManager.Unregister(name)
+	}
+	plugins.PluginManager.SetRouter(router)
+	t.Cleanup(func() {
+		_ = plugins.PluginManager.Unregister("LLMChat")
+		plugins.PluginManager.SetRouter(nil)
+	})
+	plugin := llm.NewLLMChatPlugin()
+	plugin.SetRegistry(registry)
+	if err := plugins.PluginManager.Register(plugin); err != nil {
+		t.Fatalf("register plugin error: %v", err)
+	}
+
+	stream := func(path string, userID uint) *httptest.ResponseRecorder {
+		token, err := utils.GenerateToken(userID, 1)
+		if err != nil {
+			t.Fatalf("generate token error: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(`{"message":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for _, path := range []string{"/plugins/LLMChat/api/stream", "/api/v1/llm/stream"} {
+		if w := stream(path, 1); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "event:done") {
+			t.Fatalf("%s: expected team member to stream, got %d: %s", path, w.Code, w.Body.String())
+		}
+		if w := stream(path, 2); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403 outside the plugin scope, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmc/langchaingo/llms"
+
+	"weave/models"
+	"weave/plugins/core"
+)
+
+// adderPlugin 计算两个数之和并记录收到的参数
+type adderPlugin struct {
+	params []map[string]interface{}
+}
+
+func (p *adderPlugin) Name() string                                 { return "TestAdder" }
+func (p *adderPlugin) Description() string                          { return "adds numbers" }
+func (p *adderPlugin) Version() string                              { return "1.0.0" }
+func (p *adderPlugin) GetDependencies() []string                    { return nil }
+func (p *adderPlugin) GetConflicts() []string                       { return nil }
+func (p *adderPlugin) Init() error                                  { return nil }
+func (p *adderPlugin) Shutdown() error                              { return nil }
+func (p *adderPlugin) OnEnable() error                              { return nil }
+func (p *adderPlugin) OnDisable() error                             { return nil }
+func (p *adderPlugin) GetRoutes() []core.Route                      { return nil }
+func (p *adderPlugin) RegisterRoutes(*gin.Engine)                   {}
+func (p *adderPlugin) GetDefaultMiddlewares() []gin.HandlerFunc     { return nil }
+func (p *adderPlugin) SetPluginManager(manager *core.PluginManager) {}
+
+func (p *adderPlugin) ToolSchema() core.ToolSchema {
+	return core.ToolSchema{Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"a":  map[string]interface{}{"type": "number"},
+			"b":  map[string]interface{}{"type": "number"},
+			"op": map[string]interface{}{"type": "string", "enum": []string{"add"}},
+		},
+		"required": []string{"a", "b"},
+	}}
+}
+
+func (p *adderPlugin) Execute(params map[string]interface{}) (interface{}, error) {
+	p.params = append(p.params, params)
+	a, _ := params["a"].(float64)
+	b, _ := params["b"].(float64)
+	return map[string]float64{"sum": a + b}, nil
+}
+
+// registerAdder 在全局插件管理器中注册加法插件，每个测试使用新的实例
+func registerAdder(t *testing.T) *adderPlugin {
+	plugin := &adderPlugin{}
+	core.GlobalPluginManager.Unregister(plugin.Name())
+	if err := core.GlobalPluginManager.Register(plugin); err != nil {
+		t.Fatalf("register plugin error: %v", err)
+	}
+	t.Cleanup(func() { core.GlobalPluginManager.Unregister(plugin.Name()) })
+	return plugin
+}
+
+// toolCallingLLM 提供工具时请求调用callName，没有提供工具时返回最终回复
+type toolCallingLLM struct {
+	callName  string
+	arguments string // 工具调用的参数，为空时使用a=2、b=3
+	calls     int
+	offered   []int // 每次调用提供的工具数
+	messages  []llms.MessageContent
+}
+
+func (m *toolCallingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	m.calls++
+	m.offered = append(m.offered, len(opts.Tools))
+	m.messages = messages
+
+	last := messages[len(messages)-1]
+	if len(opts.Tools) == 0 || last.Role == llms.ChatMessageTypeTool && m.callName == "" {
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "The answer is 5."}}}, nil
+	}
+	name := m.callName
+	if name == "" {
+		name = opts.Tools[0].Function.Name
+	}
+	arguments := m.arguments
+	if arguments == "" {
+		arguments = `{"a":2,"b":3,"user_id":"99"}`
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{ToolCalls: []llms.ToolCall{{
+		ID:           fmt.Sprintf("call_%d", m.calls),
+		Type:         "function",
+		FunctionCall: &llms.FunctionCall{Name: name, Arguments: arguments},
+	}}}}}, nil
+}
+
+func (m *toolCallingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestLLMChatCallsPluginTools(t *testing.T) {
+	adder := registerAdder(t)
+	model := &toolCallingLLM{}
+	r, db := setupLLMRouter(t, model)
+
+	w := doLLM(r, 7, http.MethodPost, "/api/chat", `{"message":"what is 2+3?","use_tools":true}`)
+	var resp struct {
+		Response  string `json:"response"`
+		ToolCalls []struct {
+			Name   string `json:"name"`
+			Plugin string `json:"plugin"`
+			Error  string `json:"error"`
+		} `json:"tool_calls"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Response != "The answer is 5." || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Plugin != "TestAdder" {
+		t.Fatalf("unexpected agent response: %d %s", w.Code, w.Body.String())
+	}
+
+	// 插件以调用者身份执行，模型提供的user_id被覆盖
+	if len(adder.params) != 1 || adder.params[0]["user_id"] != "7" || adder.params[0]["tenant_id"] != "1" {
+		t.Fatalf("expected the plugin to run as the caller, got %+v", adder.params)
+	}
+	toolResult, ok := model.messages[len(model.messages)-1].Parts[0].(llms.ToolCallResponse)
+	if !ok || toolResult.Content != `{"sum":5}` || toolResult.ToolCallID != "call_1" {
+		t.Fatalf("expected the tool result to be sent back to the model, got %+v", model.messages)
+	}
+
+	var history []models.ToolHistory
+	db.Find(&history)
+	if len(history) != 1 || history[0].PluginName != "TestAdder" || history[0].UserID != 7 || history[0].ToolID != 0 || history[0].Result != `{"sum":5}` {
+		t.Fatalf("expected the call to be recorded in tool history, got %+v", history)
+	}
+
+	var messages []models.ConversationMessage
+	db.Order("id").Find(&messages)
+	if len(messages) != 2 || messages[1].Content != "The answer is 5." {
+		t.Fatalf("expected only the final reply to be saved, got %+v", messages)
+	}
+
+	// 流式接口不支持工具调用
+	if w := doLLM(r, 7, http.MethodPost, "/api/stream", `{"message":"hi","use_tools":true}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for streaming with tools, got %d", w.Code)
+	}
+}
+
+func TestLLMChatRejectsToolArgumentsOutsideSchema(t *testing.T) {
+	adder := registerAdder(t)
+	model := &toolCallingLLM{}
+	r, db := setupLLMRouter(t, model)
+
+	// 枚举之外的操作、缺少必填参数和类型不符的参数都不会交给插件执行
+	for _, arguments := range []string{`{"a":2,"b":3,"op":"delete"}`, `{"a":2}`, `{"a":"2","b":3}`} {
+		model.arguments = arguments
+		w := doLLM(r, 7, http.MethodPost, "/api/chat", `{"message":"what is 2+3?","use_tools":true}`)
+		var resp struct {
+			ToolCalls []struct {
+				Error string `json:"error"`
+			} `json:"tool_calls"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || len(resp.ToolCalls) != 1 || !strings.Contains(resp.ToolCalls[0].Error, "参数不符合工具定义") {
+			t.Fatalf("expected %s to be rejected, got %d %s", arguments, w.Code, w.Body.String())
+		}
+	}
+	if len(adder.params) != 0 {
+		t.Fatalf("expected the plugin not to run, got %+v", adder.params)
+	}
+	var count int64
+	db.Model(&models.ToolHistory{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected rejected calls not to be recorded as executed, got %d", count)
+	}
+
+	model.arguments = `{"a":2,"b":3,"op":"add"}`
+	if w := doLLM(r, 7, http.MethodPost, "/api/chat", `{"message":"what is 2+3?","use_tools":true}`); w.Code != http.StatusOK || len(adder.params) != 1 {
+		t.Fatalf("expected valid arguments to run the plugin, got %d %+v", w.Code, adder.params)
+	}
+}
+
+// undescribedPlugin 没有实现ToolDescriber的插件
+type undescribedPlugin struct {
+	core.Plugin
+}
+
+func (p undescribedPlugin) Name() string { return "TestUndescribed" }
+
+func TestLLMChatOffersOnlyDescribedPlugins(t *testing.T) {
+	adder := registerAdder(t)
+	inner := &adderPlugin{}
+	plain := undescribedPlugin{inner}
+	if err := core.GlobalPluginManager.Register(plain); err != nil {
+		t.Fatalf("register plugin error: %v", err)
+	}
+	t.Cleanup(func() { core.GlobalPluginManager.Unregister(plain.Name()) })
+
+	model := &toolCallingLLM{callName: plain.Name(), arguments: `{"action":"delete","id":"1"}`}
+	r, _ := setupLLMRouter(t, model)
+	w := doLLM(r, 7, http.MethodPost, "/api/chat", `{"message":"delete note 1","use_tools":true}`)
+	var resp struct {
+		ToolCalls []struct {
+			Error string `json:"error"`
+		} `json:"tool_calls"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || len(resp.ToolCalls) == 0 || resp.ToolCalls[0].Error == "" {
+		t.Fatalf("expected the undescribed plugin call to fail, got %d %s", w.Code, w.Body.String())
+	}
+	if model.offered[0] != 1 {
+		t.Fatalf("expected only the described plugin to be offered, got %d tools", model.offered[0])
+	}
+	if len(inner.params) != 0 || len(adder.params) != 0 {
+		t.Fatalf("expected no plugin to run, got %+v %+v", inner.params, adder.params)
+	}
+}
+
+func TestLLMChatToolRecordsAndLimits(t *testing.T) {
+	t.Setenv("LLM_AGENT_MAX_ITERATIONS", "3")
+	t.Setenv("LLM_AGENT_MAX_TOOL_CALLS", "2")
+	registerAdder(t)
+	model := &toolCallingLLM{callName: "tool_1"}
+	r, db := setupLLMRouter(t, model)
+	team := models.Team{Name: "math", TenantID: 1}
+	db.Create(&team)
+	db.Create(&models.Tool{Name: "calculator", Description: "a calculator", PluginName: "TestAdder", IsEnabled: true, TenantID: 1, OwnerID: 7, TeamID: &team.ID})
+
+	w := doLLM(r, 7, http.MethodPost, "/api/chat", `{"message":"keep adding","use_tools":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+	}
+	// 达到工具调用上限后最后一次调用不再提供工具
+	if model.calls != 3 || model.offered[0] != 2 || model.offered[2] != 0 {
+		t.Fatalf("expected tools to be withdrawn after the call limit, got %d calls offering %v", model.calls, model.offered)
+	}
+	var history []models.ToolHistory
+	db.Find(&history)
+	if len(history) != 2 || history[0].ToolID != 1 || history[0].PluginName != "TestAdder" {
+		t.Fatalf("expected two recorded tool calls, got %+v", history)
+	}
+
+	// 团队范围外的用户看不到该工具，调用时返回未知工具
+	model.calls, model.offered = 0, nil
+	w = doLLM(r, 8, http.MethodPost, "/api/chat", `{"message":"keep adding","use_tools":true}`)
+	if w.Code != http.StatusOK || model.offered[0] != 1 {
+		t.Fatalf("expected only the plugin tool for another user, got %d %v", w.Code, model.offered)
+	}
+	db.Model(&models.ToolHistory{}).Where("user_id = ?", 8).Find(&history)
+	if len(history) != 0 {
+		t.Fatalf("expected unknown tools not to be executed, got %+v", history)
+	}
+}
@@ -0,0 +1,478 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmc/langchaingo/llms"
+	"gorm.io/gorm"
+
+	"weave/config"
+	"weave/models"
+	"weave/pkg"
+	"weave/pkg/llmprovider"
+	"weave/pkg/prompt"
+	"weave/plugins/core"
+	"weave/services/llm"
+	"weave/test/testutil"
+)
+
+// setupLLMRouter 注册LLMChat插件的路由，用X-User-ID请求头模拟认证用户
+// model为nil时使用回显消息的假模型
+func setupLLMRouter(t *testing.T, model llms.Model) (*gin.Engine, *gorm.DB) {
+	cfg := config.LLMConfig{
+		Providers: []config.LLMProviderConfig{{Name: "test", Type: "fake", Model: "echo"}},
+		Default:   "test",
+	}
+	if model != nil {
+		llmprovider.RegisterType("test-model", func(config.LLMProviderConfig, string) (llms.Model, error) { return model, nil })
+		cfg.Providers[0].Type = "test-model"
+	}
+	return setupLLMRouterWithConfig(t, cfg)
+}
+
+// setupLLMRouterWithConfig 按指定的LLM配置注册LLMChat插件的路由
+func setupLLMRouterWithConfig(t *testing.T, cfg config.LLMConfig) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t, &models.Conversation{}, &models.ConversationMessage{}, &models.TenantLLMConfig{},
+		&models.Tool{}, &models.ToolHistory{}, &models.Team{}, &models.TeamMember{}, &models.PluginTeamScope{}, &models.ResourceShare{}, &models.PromptTemplate{}, &models.LLMUsage{})
+	pkg.DB = db
+	prompt.Invalidate()
+
+	registry, err := llmprovider.NewRegistry(cfg)
+	if err != nil {
+		t.Fatalf("new registry error: %v", err)
+	}
+	plugin := llm.NewLLMChatPlugin()
+	plugin.SetRegistry(registry)
+	plugin.SetPluginManager(core.GlobalPluginManager)
+	if err := plugin.Init(); err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User-ID"), &userID)
+		c.Set("user_id", userID)
+		c.Set("tenant_id", uint(1))
+		c.Next()
+	})
+	for _, route := range plugin.GetRoutes() {
+		if !route.AuthRequired {
+			t.Fatalf("route %s %s should require authentication", route.Method, route.Path)
+		}
+		r.Handle(route.Method, "/"+route.Path, route.Handler)
+	}
+	return r, db
+}
+
+func doLLM(r *gin.Engine, userID uint, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", fmt.Sprint(userID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLLMConversationsArePerUser(t *testing.T) {
+	r, db := setupLLMRouter(t, nil)
+
+	var trip models.Conversation
+	w := doLLM(r, 1, http.MethodPost, "/api/conversations", `{"title":"Trip planning"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &trip)
+	doLLM(r, 1, http.MethodPost, "/api/conversations", `{"title":"Work"}`)
+	if w := doLLM(r, 1, http.MethodPost, "/api/conversations", `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for missing title, got %d", w.Code)
+	}
+
+	for i, role := range []string{models.MessageRoleUser, models.MessageRoleAssistant, models.MessageRoleUser} {
+		db.Create(&models.ConversationMessage{ConversationID: trip.ID, TenantID: 1, UserID: 1, Role: role, Content: fmt.Sprintf("message %d", i)})
+	}
+
+	var list struct {
+		Conversations []models.Conversation `json:"conversations"`
+		Total         int64                 `json:"total"`
+	}
+	w = doLLM(r, 1, http.MethodGet, "/api/conversations", "")
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || list.Total != 2 {
+		t.Fatalf("unexpected conversations: %d %s", w.Code, w.Body.String())
+	}
+	w = doLLM(r, 2, http.MethodGet, "/api/conversations", "")
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if list.Total != 0 || len(list.Conversations) != 0 {
+		t.Fatalf("expected other users to see no conversations, got %s", w.Body.String())
+	}
+
+	// 其他用户不能读取、修改或继续别人的对话
+	path := fmt.Sprintf("/api/conversations/%d", trip.ID)
+	for _, w := range []*httptest.ResponseRecorder{
+		doLLM(r, 2, http.MethodGet, path, ""),
+		doLLM(r, 2, http.MethodGet, path+"/messages", ""),
+		doLLM(r, 2, http.MethodPut, path, `{"title":"Mine now"}`),
+		doLLM(r, 2, http.MethodDelete, path+"/messages", ""),
+		doLLM(r, 2, http.MethodDelete, path, ""),
+		doLLM(r, 2, http.MethodPost, "/api/chat", fmt.Sprintf(`{"conversation_id":%d,"message":"hi"}`, trip.ID)),
+	} {
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for another user's conversation, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	var messages struct {
+		Messages []models.ConversationMessage `json:"messages"`
+		Total    int64                        `json:"total"`
+	}
+	w = doLLM(r, 1, http.MethodGet, path+"/messages?page=2&page_size=2", "")
+	json.Unmarshal(w.Body.Bytes(), &messages)
+	if messages.Total != 3 || len(messages.Messages) != 1 || messages.Messages[0].Content != "message 2" {
+		t.Fatalf("unexpected messages page: %s", w.Body.String())
+	}
+}
+
+func TestLLMConversationRenameClearDelete(t *testing.T) {
+	r, db := setupLLMRouter(t, nil)
+
+	var conversation models.Conversation
+	w := doLLM(r, 1, http.MethodPost, "/api/conversations", `{"title":"Draft"}`)
+	json.Unmarshal(w.Body.Bytes(), &conversation)
+	db.Create(&models.ConversationMessage{ConversationID: conversation.ID, TenantID: 1, UserID: 1, Role: models.MessageRoleUser, Content: "hello"})
+	path := fmt.Sprintf("/api/conversations/%d", conversation.ID)
+
+	w = doLLM(r, 1, http.MethodPut, path, `{"title":"Final"}`)
+	json.Unmarshal(w.Body.Bytes(), &conversation)
+	if w.Code != http.StatusOK || conversation.Title != "Final" {
+		t.Fatalf("unexpected rename result: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doLLM(r, 1, http.MethodDelete, path+"/messages", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for clear, got %d", w.Code)
+	}
+	var count int64
+	db.Model(&models.ConversationMessage{}).Where("conversation_id = ?", conversation.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected messages to be cleared, got %d", count)
+	}
+
+	db.Create(&models.ConversationMessage{ConversationID: conversation.ID, TenantID: 1, UserID: 1, Role: models.MessageRoleUser, Content: "again"})
+	if w := doLLM(r, 1, http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for delete, got %d", w.Code)
+	}
+	if w := doLLM(r, 1, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", w.Code)
+	}
+	db.Model(&models.ConversationMessage{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected messages to be deleted with the conversation, got %d", count)
+	}
+
+	if w := doLLM(r, 1, http.MethodGet, "/api/conversations/abc", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid id, got %d", w.Code)
+	}
+}
+
+func TestLLMChatRoutesAndFallsBack(t *testing.T) {
+	r, db := setupLLMRouterWithConfig(t, config.LLMConfig{
+		Providers: []config.LLMProviderConfig{
+			{Name: "primary", Type: "fake", Model: "big", Options: map[string]string{"error": "overloaded"}},
+			{Name: "backup", Type: "fake", Model: "small"},
+			{Name: "slow", Type: "fake", Model: "tortoise", Timeout: 1, Options: map[string]string{"delay": "3s"}},
+		},
+		Aliases:  map[string]string{"fast": "backup/tiny"},
+		Default:  "primary",
+		Fallback: "backup",
+	})
+
+	var result struct {
+		Response string `json:"response"`
+		Model    string `json:"model"`
+	}
+	// 主模型出错时改用备用模型
+	w := doLLM(r, 1, http.MethodPost, "/api/chat", `{"message":"hi"}`)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Model != "backup/small" || !strings.HasPrefix(result.Response, "[backup/small]") {
+		t.Fatalf("expected fallback response, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 请求可以按别名指定模型
+	w = doLLM(r, 1, http.MethodPost, "/api/chat", `{"message":"hi","model":"fast"}`)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Model != "backup/tiny" {
+		t.Fatalf("expected alias to be used, got %d %s", w.Code, w.Body.String())
+	}
+	if w := doLLM(r, 1, http.MethodPost, "/api/chat", `{"message":"hi","model":"nope"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown model, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 租户的路由规则优先于全局默认模型，超时的模型同样改用备用模型
+	db.Create(&models.TenantLLMConfig{TenantID: 1, Routes: map[string]string{"chat": "slow"}})
+	start := time.Now()
+	w = doLLM(r, 1, http.MethodPost, "/api/chat", `{"message":"hi"}`)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Model != "backup/small" || time.Since(start) > 2*time.Second {
+		t.Fatalf("expected timeout fallback, got %d %s after %s", w.Code, w.Body.String(), time.Since(start))
+	}
+
+	// 流式接口在完成事件中返回实际使用的模型
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(context.Background(), `{"message":"hi","model":"primary"}`))
+	if body := w.Body.String(); !strings.Contains(body, "event:done") || !strings.Contains(body, `"model":"backup/small"`) {
+		t.Fatalf("expected done event with the fallback model, got %q", body)
+	}
+}
+
+// recordingLLM 依次返回预设回复并记录收到的提示词
+type recordingLLM struct {
+	replies []string
+	prompts []string
+}
+
+func (m *recordingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				m.prompts = append(m.prompts, text.Text)
+			}
+		}
+	}
+	reply := m.replies[0]
+	if len(m.replies) > 1 {
+		m.replies = m.replies[1:]
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: reply}}}, nil
+}
+
+func (m *recordingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// seedLongConversation 创建带固定系统提示词的对话，写入10条各约50个令牌的消息
+func seedLongConversation(t *testing.T, r *gin.Engine, db *gorm.DB) (models.Conversation, []models.ConversationMessage) {
+	var conversation models.Conversation
+	w := doLLM(r, 1, http.MethodPost, "/api/conversations", `{"title":"Voyage","system_prompt":"You are a pirate."}`)
+	json.Unmarshal(w.Body.Bytes(), &conversation)
+	if w.Code != http.StatusCreated || conversation.SystemPrompt != "You are a pirate." {
+		t.Fatalf("unexpected conversation: %d %s", w.Code, w.Body.String())
+	}
+	messages := make([]models.ConversationMessage, 10)
+	for i := range messages {
+		role := models.MessageRoleUser
+		if i%2 == 1 {
+			role = models.MessageRoleAssistant
+		}
+		messages[i] = models.ConversationMessage{ConversationID: conversation.ID, TenantID: 1, UserID: 1, Role: role,
+			Content: fmt.Sprintf("m%d %s", i, strings.Repeat("word ", 50))}
+	}
+	db.Create(&messages)
+	return conversation, messages
+}
+
+func TestLLMChatTruncatesHistoryByTokenBudget(t *testing.T) {
+	t.Setenv("LLM_CONTEXT_MAX_TOKENS", "300")
+	t.Setenv("LLM_CONTEXT_RESERVE_TOKENS", "100")
+	model := &recordingLLM{replies: []string{"Arr"}}
+	r, db := setupLLMRouter(t, model)
+	conversation, _ := seedLongConversation(t, r, db)
+
+	w := doLLM(r, 1, http.MethodPost, "/api/chat", fmt.Sprintf(`{"conversation_id":%d,"message":"where to?"}`, conversation.ID))
+	if w.Code != http.StatusOK || len(model.prompts) != 1 {
+		t.Fatalf("expected a single model call, got %d %s (%d prompts)", w.Code, w.Body.String(), len(model.prompts))
+	}
+	prompt := model.prompts[0]
+	if !strings.HasPrefix(prompt, "You are a pirate.\n") || !strings.Contains(prompt, "m9 ") || !strings.Contains(prompt, "m8 ") {
+		t.Fatalf("expected the pinned prompt and latest messages, got %q", prompt)
+	}
+	if strings.Contains(prompt, "m0 ") || strings.Contains(prompt, "m7 ") {
+		t.Fatalf("expected older messages to be truncated, got %q", prompt)
+	}
+	// 保留的历史从用户消息开始
+	if strings.Index(prompt, "You: m") > strings.Index(prompt, "PaiChat: m") {
+		t.Fatalf("expected kept history to start with a user message, got %q", prompt)
+	}
+
+	// 恢复默认系统提示词
+	w = doLLM(r, 1, http.MethodPut, fmt.Sprintf("/api/conversations/%d", conversation.ID), `{"system_prompt":""}`)
+	json.Unmarshal(w.Body.Bytes(), &conversation)
+	if w.Code != http.StatusOK || conversation.SystemPrompt != "" || conversation.Title != "Voyage" {
+		t.Fatalf("unexpected update result: %d %s", w.Code, w.Body.String())
+	}
+	if w := doLLM(r, 1, http.MethodPut, fmt.Sprintf("/api/conversations/%d", conversation.ID), `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty update, got %d", w.Code)
+	}
+}
+
+func TestLLMChatSummarizesOlderHistory(t *testing.T) {
+	t.Setenv("LLM_CONTEXT_STRATEGY", "summarize")
+	t.Setenv("LLM_CONTEXT_MAX_TOKENS", "300")
+	t.Setenv("LLM_CONTEXT_RESERVE_TOKENS", "100")
+	t.Setenv("LLM_CONTEXT_KEEP_RECENT", "2")
+	model := &recordingLLM{replies: []string{"The crew seeks treasure.", "Arr"}}
+	r, db := setupLLMRouter(t, model)
+	conversation, messages := seedLongConversation(t, r, db)
+
+	w := doLLM(r, 1, http.MethodPost, "/api/chat", fmt.Sprintf(`{"conversation_id":%d,"message":"where to?"}`, conversation.ID))
+	if w.Code != http.StatusOK || len(model.prompts) != 2 {
+		t.Fatalf("expected summary and chat calls, got %d %s (%d prompts)", w.Code, w.Body.String(), len(model.prompts))
+	}
+	summaryPrompt, prompt := model.prompts[0], model.prompts[1]
+	if !strings.Contains(summaryPrompt, "m0 ") || !strings.Contains(summaryPrompt, "m7 ") || strings.Contains(summaryPrompt, "m8 ") {
+		t.Fatalf("expected messages before the recent ones to be summarized, got %q", summaryPrompt)
+	}
+	if !strings.HasPrefix(prompt, "You are a pirate.\n") || !strings.Contains(prompt, "The crew seeks treasure.") ||
+		!strings.Contains(prompt, "m8 ") || strings.Contains(prompt, "m7 ") {
+		t.Fatalf("expected the summary and recent messages in the prompt, got %q", prompt)
+	}
+
+	db.First(&conversation, conversation.ID)
+	if conversation.Summary != "The crew seeks treasure." || conversation.SummarizedThrough != messages[7].ID {
+		t.Fatalf("expected the summary to be saved, got %q through %d", conversation.Summary, conversation.SummarizedThrough)
+	}
+
+	// 清空消息时同时清除摘要
+	doLLM(r, 1, http.MethodDelete, fmt.Sprintf("/api/conversations/%d/messages", conversation.ID), "")
+	db.First(&conversation, conversation.ID)
+	if conversation.Summary != "" || conversation.SummarizedThrough != 0 || conversation.SystemPrompt != "You are a pirate." {
+		t.Fatalf("expected the summary to be cleared, got %+v", conversation)
+	}
+}
+
+func TestLLMChatUsesTenantPromptTemplates(t *testing.T) {
+	t.Setenv("LLM_CONTEXT_STRATEGY", "summarize")
+	t.Setenv("LLM_CONTEXT_MAX_TOKENS", "300")
+	t.Setenv("LLM_CONTEXT_RESERVE_TOKENS", "100")
+	t.Setenv("LLM_CONTEXT_KEEP_RECENT", "2")
+	model := &recordingLLM{replies: []string{"The crew seeks treasure.", "Arr"}}
+	r, db := setupLLMRouter(t, model)
+	conversation, _ := seedLongConversation(t, r, db)
+	doLLM(r, 1, http.MethodPut, fmt.Sprintf("/api/conversations/%d", conversation.ID), `{"system_prompt":""}`)
+
+	ctx := context.Background()
+	for _, version := range []models.PromptTemplate{
+		{Name: prompt.ChatSystem, TenantID: 1, Content: "You are the tenant's assistant."},
+		{Name: prompt.ChatSummary, Global: true, Content: "Summarize in {{.max_tokens}} tokens:\n{{.conversation}}"},
+	} {
+		if err := prompt.CreateVersion(ctx, &version, true); err != nil {
+			t.Fatalf("create prompt version error: %v", err)
+		}
+	}
+
+	w := doLLM(r, 1, http.MethodPost, "/api/chat", fmt.Sprintf(`{"conversation_id":%d,"message":"where to?"}`, conversation.ID))
+	if w.Code != http.StatusOK || len(model.prompts) != 2 {
+		t.Fatalf("expected summary and chat calls, got %d %s (%d prompts)", w.Code, w.Body.String(), len(model.prompts))
+	}
+	if summaryPrompt := model.prompts[0]; !strings.HasPrefix(summaryPrompt, "Summarize in 256 tokens:\n") || !strings.Contains(summaryPrompt, "m0 ") {
+		t.Fatalf("expected the global summary template, got %q", summaryPrompt)
+	}
+	if chatPrompt := model.prompts[1]; !strings.HasPrefix(chatPrompt, "You are the tenant's assistant.\n") {
+		t.Fatalf("expected the tenant system prompt, got %q", chatPrompt)
+	}
+}
+
+func TestLLMChatRecordsTokenUsage(t *testing.T) {
+	prices := config.Config.LLM.Prices
+	config.Config.LLM.Prices = map[string]config.LLMPrice{"local/llama": {Input: 2, Output: 4}}
+	t.Cleanup(func() { config.Config.LLM.Prices = prices })
+	r, db := setupLLMRouterWithConfig(t, config.LLMConfig{
+		Providers: []config.LLMProviderConfig{{Name: "local", Type: "fake", Model: "llama"}},
+		Default:   "local",
+	})
+
+	w := doLLM(r, 7, http.MethodPost, "/api/chat", `{"message":"how many tokens?"}`)
+	var resp struct {
+		Usage llm.StreamUsage `json:"usage"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Usage.PromptTokens == 0 || resp.Usage.CompletionTokens == 0 || resp.Usage.Estimated {
+		t.Fatalf("expected provider usage in the response, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(context.Background(), `{"message":"and now?"}`))
+
+	var records []models.LLMUsage
+	db.Order("id").Find(&records)
+	if len(records) != 2 || records[0].Source != "chat" || records[1].Source != "stream" {
+		t.Fatalf("expected chat and stream usage records, got %+v", records)
+	}
+	first := records[0]
+	if first.UserID != 7 || first.TenantID != 1 || first.Provider != "local" || first.Model != "llama" ||
+		first.PromptTokens != resp.Usage.PromptTokens || first.TotalTokens != resp.Usage.TotalTokens {
+		t.Fatalf("unexpected usage record %+v for %+v", first, resp.Usage)
+	}
+	if want := float64(first.PromptTokens*2+first.CompletionTokens*4) / 1e6; first.Cost != want {
+		t.Fatalf("expected cost %v, got %v", want, first.Cost)
+	}
+}
+
+func TestLLMChatUsesResponseCache(t *testing.T) {
+	cacheConfig := config.Config.LLM.Cache
+	config.Config.LLM.Cache = config.LLMCacheConfig{
+		Enabled: true, Store: "memory", TTL: 60, MaxEntries: 100, SimilarityThreshold: 0.75, EmbeddingModel: "local",
+	}
+	t.Cleanup(func() { config.Config.LLM.Cache = cacheConfig })
+	r, db := setupLLMRouterWithConfig(t, config.LLMConfig{
+		Providers: []config.LLMProviderConfig{{Name: "local", Type: "fake", Model: "llama"}},
+		Default:   "local",
+	})
+
+	type chatResponse struct {
+		ConversationID uint            `json:"conversation_id"`
+		Response       string          `json:"response"`
+		Cached         bool            `json:"cached"`
+		Usage          llm.StreamUsage `json:"usage"`
+	}
+	send := func(userID uint, body string) chatResponse {
+		w := doLLM(r, userID, http.MethodPost, "/api/chat", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("chat failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp chatResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	first := send(7, `{"message":"What is the refund policy?"}`)
+	if first.Cached || !strings.Contains(first.Response, "You: What is the refund policy?") {
+		t.Fatalf("expected a generated response, got %+v", first)
+	}
+
+	// 同一租户的其他用户提出规范化后相同或相似的问题时命中缓存，不调用模型
+	for _, message := range []string{"what is the  REFUND policy", "refund policy, what is it?"} {
+		resp := send(8, `{"message":"`+message+`"}`)
+		if !resp.Cached || resp.Response != first.Response || resp.Usage.TotalTokens != 0 || resp.ConversationID == first.ConversationID {
+			t.Fatalf("expected a cached response for %q, got %+v", message, resp)
+		}
+	}
+
+	// 跳过缓存或在已有对话中提问时重新生成
+	if resp := send(7, `{"message":"What is the refund policy?","no_cache":true}`); resp.Cached {
+		t.Fatalf("expected no_cache to bypass the cache, got %+v", resp)
+	}
+	if resp := send(7, fmt.Sprintf(`{"conversation_id":%d,"message":"What is the refund policy?"}`, first.ConversationID)); resp.Cached {
+		t.Fatalf("expected a different conversation context to miss, got %+v", resp)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(context.Background(), `{"message":"What is the refund policy"}`))
+	if body := w.Body.String(); !strings.Contains(body, `"cached":true`) || !strings.Contains(body, "You: What is the refund policy?") {
+		t.Fatalf("expected a cached stream, got %s", body)
+	}
+
+	var records int64
+	db.Model(&models.LLMUsage{}).Count(&records)
+	if records != 3 {
+		t.Fatalf("expected usage only for generated responses, got %d records", records)
+	}
+}
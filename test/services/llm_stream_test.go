@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"weave/models"
+)
+
+// fakeLLM 按片段流式返回固定内容的模型，onChunk在每个片段发送后调用
+type fakeLLM struct {
+	chunks  []string
+	err     error
+	onChunk func(i int)
+}
+
+func (f *fakeLLM) GenerateContent(ctx context.Context, _ []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	for i, chunk := range f.chunks {
+		if opts.StreamingFunc != nil {
+			if err := opts.StreamingFunc(ctx, []byte(chunk)); err != nil {
+				return nil, err
+			}
+		}
+		if f.onChunk != nil {
+			f.onChunk(i)
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        strings.Join(f.chunks, ""),
+		GenerationInfo: map[string]any{"PromptTokens": 12, "CompletionTokens": len(f.chunks)},
+	}}}, nil
+}
+
+func (f *fakeLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, f, prompt, options...)
+}
+
+func streamRequest(ctx context.Context, body string) *http.Request {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/api/stream", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", "1")
+	return req
+}
+
+func TestLLMStreamSendsTokensAndUsage(t *testing.T) {
+	model := &fakeLLM{chunks: []string{"Hel", "lo!"}}
+	r, db := setupLLMRouter(t, model)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(context.Background(), `{"message":"say hello"}`))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, "event:token\ndata:{\"content\":\"Hel\"}\n\n") || !strings.Contains(body, "data:{\"content\":\"lo!\"}") {
+		t.Fatalf("expected token events, got %q", body)
+	}
+	if !strings.Contains(body, "event:done\n") || !strings.Contains(body, `"conversation_id":1`) ||
+		!strings.Contains(body, `"usage":{"prompt_tokens":12,"completion_tokens":2,"total_tokens":14,"estimated":false}`) ||
+		!strings.Contains(body, `"latency_ms":`) {
+		t.Fatalf("expected done event with usage, got %q", body)
+	}
+
+	var messages []models.ConversationMessage
+	db.Order("id").Find(&messages)
+	if len(messages) != 2 || messages[0].Content != "say hello" || messages[1].Content != "Hello!" {
+		t.Fatalf("unexpected saved messages: %+v", messages)
+	}
+
+	// 继续同一对话
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(context.Background(), `{"conversation_id":1,"message":"again"}`))
+	var conversation models.Conversation
+	db.First(&conversation, 1)
+	if !strings.Contains(w.Body.String(), "event:done") || conversation.MessageCount != 4 {
+		t.Fatalf("expected the turn to be appended, got %d messages: %s", conversation.MessageCount, w.Body.String())
+	}
+}
+
+func TestLLMStreamCancelledByClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 客户端在收到第一个片段后断开
+	model := &fakeLLM{chunks: []string{"one", "two", "three"}, onChunk: func(i int) { cancel() }}
+	r, db := setupLLMRouter(t, model)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(ctx, `{"message":"long answer"}`))
+	body := w.Body.String()
+	if strings.Contains(body, "two") || strings.Contains(body, "event:done") || strings.Contains(body, "event:error") {
+		t.Fatalf("expected generation to stop after disconnect, got %q", body)
+	}
+	var count int64
+	db.Model(&models.Conversation{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no conversation to be saved for a cancelled stream, got %d", count)
+	}
+}
+
+func TestLLMStreamErrors(t *testing.T) {
+	model := &fakeLLM{err: errors.New("model crashed")}
+	r, _ := setupLLMRouter(t, model)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(context.Background(), `{"message":"hi"}`))
+	if body := w.Body.String(); !strings.Contains(body, "event:error\n") || !strings.Contains(body, `"code":"SERVICE_UNAVAILABLE"`) {
+		t.Fatalf("expected error event, got %q", body)
+	}
+
+	// 开始推送前的错误按普通JSON响应返回
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, streamRequest(context.Background(), `{}`))
+	if w.Code != http.StatusBadRequest || strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected 400 problem response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
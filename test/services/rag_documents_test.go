@@ -0,0 +1,403 @@
+package services_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"weave/models"
+	"weave/pkg"
+	"weave/plugins/core"
+	"weave/services/rag/ragplugin"
+	"weave/test/testutil"
+)
+
+// fakeDocumentEngine 在fakeRAGEngine的基础上记录索引的文档、删除的切片和清除缓存回答的租户
+type fakeDocumentEngine struct {
+	fakeRAGEngine
+	indexed  []ragplugin.IndexDocument
+	deleted  []string
+	purged   []uint
+	indexErr error
+	chunks   int
+	returned map[uint][]string // 按文档ID记录每次索引返回的切片
+}
+
+func (e *fakeDocumentEngine) Index(ctx context.Context, doc ragplugin.IndexDocument, progress func(percent int)) ([]string, error) {
+	e.mu.Lock()
+	e.indexed = append(e.indexed, doc)
+	e.chunks++
+	n, err := e.chunks, e.indexErr
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	progress(50)
+	id := fmt.Sprintf("%d:%d", doc.ID, n)
+	e.mu.Lock()
+	if e.returned == nil {
+		e.returned = make(map[uint][]string)
+	}
+	e.returned[doc.ID] = append(e.returned[doc.ID], id)
+	e.mu.Unlock()
+	return []string{id}, nil
+}
+
+func (e *fakeDocumentEngine) DeleteChunks(ctx context.Context, chunkIDs []string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.deleted = append(e.deleted, chunkIDs...)
+	return nil
+}
+
+func (e *fakeDocumentEngine) PurgeAnswers(ctx context.Context, tenantID uint) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.purged = append(e.purged, tenantID)
+	return nil
+}
+
+// setupDocumentRouter 使用内存数据库注册RAG插件的路由，用X-Tenant-ID请求头模拟认证租户
+func setupDocumentRouter(t *testing.T, engine ragplugin.Engine) (*gin.Engine, *ragplugin.RAGPlugin) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t, &models.KnowledgeDocument{})
+	if err := pkg.RegisterTenantCallbacks(db); err != nil {
+		t.Fatalf("register tenant callbacks error: %v", err)
+	}
+	pkg.DB = db
+
+	plugin := ragplugin.NewRAGPlugin(func(context.Context) (ragplugin.Engine, error) { return engine, nil })
+	if err := core.GlobalPluginManager.Register(plugin); err != nil {
+		t.Fatalf("register plugin error: %v", err)
+	}
+	t.Cleanup(func() {
+		plugin.WaitIndexing()
+		core.GlobalPluginManager.Unregister(plugin.Name())
+	})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		tenantID := uint(1)
+		fmt.Sscan(c.GetHeader("X-Tenant-ID"), &tenantID)
+		c.Set("user_id", uint(1))
+		c.Set("tenant_id", tenantID)
+		c.Request = c.Request.WithContext(pkg.WithTenantID(c.Request.Context(), tenantID))
+		c.Next()
+	})
+	for _, route := range plugin.GetRoutes() {
+		handlers := append(append([]gin.HandlerFunc{}, route.Middlewares...), route.Handler)
+		r.Handle(route.Method, "/plugins/RAG/"+route.Path, handlers...)
+	}
+	return r, plugin
+}
+
+// uploadFile 以multipart/form-data上传文件
+func uploadFile(r *gin.Engine, method, path, filename string, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write(data)
+	writer.Close()
+
+	req, _ := http.NewRequest(method, path, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// documentResponse 上传、更新和重新索引接口的响应
+type documentResponse struct {
+	Document  models.KnowledgeDocument `json:"document"`
+	Duplicate bool                     `json:"duplicate"`
+	Changed   bool                     `json:"changed"`
+}
+
+func decodeDocument(t *testing.T, w *httptest.ResponseRecorder, status int) documentResponse {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("expected %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+	var resp documentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	return resp
+}
+
+func getDocument(t *testing.T, r *gin.Engine, id uint) models.KnowledgeDocument {
+	t.Helper()
+	w := doRAG(r, "GET", fmt.Sprintf("/plugins/RAG/documents/%d", id), "")
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var doc models.KnowledgeDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	return doc
+}
+
+func TestRAGDocumentUploadIndexesAndDedupes(t *testing.T) {
+	engine := &fakeDocumentEngine{}
+	r, plugin := setupDocumentRouter(t, engine)
+
+	w := doRAG(r, "POST", "/plugins/RAG/documents", `{"content":"# Refunds\r\n\r\nRefunds are accepted within 30 days.","collection":"policies"}`)
+	resp := decodeDocument(t, w, 202)
+	if resp.Duplicate || resp.Document.Title != "Refunds" || resp.Document.Collection != "policies" || resp.Document.ContentType != ragplugin.ContentTypeMarkdown {
+		t.Fatalf("unexpected document: %+v", resp)
+	}
+	plugin.WaitIndexing()
+
+	doc := getDocument(t, r, resp.Document.ID)
+	if doc.Status != models.DocumentStatusIndexed || doc.Progress != 100 || doc.ChunkCount != 1 || doc.IndexedAt == nil {
+		t.Fatalf("expected an indexed document, got %+v", doc)
+	}
+	indexed := engine.indexed[0]
+	if indexed.TenantID != 1 || indexed.Collection != "policies" || strings.Contains(indexed.Content, "\r") {
+		t.Fatalf("unexpected indexed document: %+v", indexed)
+	}
+
+	// 同一集合中相同内容的文档不重复索引，其他集合可以上传
+	resp = decodeDocument(t, doRAG(r, "POST", "/plugins/RAG/documents", `{"content":"# Refunds\n\nRefunds are accepted within 30 days.","collection":"policies"}`), 200)
+	if !resp.Duplicate || resp.Document.ID != doc.ID {
+		t.Fatalf("expected the existing document, got %+v", resp)
+	}
+	resp = decodeDocument(t, doRAG(r, "POST", "/plugins/RAG/documents", `{"content":"# Refunds\n\nRefunds are accepted within 30 days."}`), 202)
+	if resp.Duplicate || resp.Document.Collection != ragplugin.DefaultCollection {
+		t.Fatalf("expected a new document in the default collection, got %+v", resp)
+	}
+	plugin.WaitIndexing()
+	if len(engine.indexed) != 2 {
+		t.Fatalf("expected 2 indexed documents, got %d", len(engine.indexed))
+	}
+
+	for _, body := range []string{`{}`, `{"content":"   "}`, `{"content":"text","collection":"bad name"}`} {
+		if w := doRAG(r, "POST", "/plugins/RAG/documents", body); w.Code != 400 {
+			t.Fatalf("expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if w := doRAG(r, "POST", "/plugins/RAG/documents", `{"content":"text","content_type":"docx"}`); w.Code != 415 {
+		t.Fatalf("expected 415, got %d", w.Code)
+	}
+}
+
+func TestRAGDocumentUploadFormats(t *testing.T) {
+	engine := &fakeDocumentEngine{}
+	r, plugin := setupDocumentRouter(t, engine)
+
+	html := `<html><head><title>Shipping</title><style>p{}</style></head><body><h2>Times</h2><p>Orders ship within <b>2 days</b>.</p><ul><li>Express</li><li>Standard</li></ul><script>alert(1)</script></body></html>`
+	resp := decodeDocument(t, uploadFile(r, "POST", "/plugins/RAG/documents", "shipping.html", []byte(html), nil), 202)
+	if resp.Document.Title != "Shipping" || resp.Document.ContentType != ragplugin.ContentTypeHTML || resp.Document.Filename != "shipping.html" {
+		t.Fatalf("unexpected HTML document: %+v", resp.Document)
+	}
+
+	text := "Warranty covers two years."
+	resp = decodeDocument(t, uploadFile(r, "POST", "/plugins/RAG/documents", "warranty.txt", []byte(text), map[string]string{"collection": "policies"}), 202)
+	if resp.Document.Title != "warranty" || resp.Document.ContentType != ragplugin.ContentTypeText {
+		t.Fatalf("unexpected text document: %+v", resp.Document)
+	}
+
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write([]byte("BT /F1 12 Tf 72 712 Td (Returns need a receipt.) Tj T* [(Keep the) -300 (box.)] TJ ET"))
+	zw.Close()
+	pdf := fmt.Sprintf("%%PDF-1.4\n4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n%sendstream\nendobj\n%%%%EOF\n", stream.Len(), stream.String())
+	resp = decodeDocument(t, uploadFile(r, "POST", "/plugins/RAG/documents", "returns.pdf", []byte(pdf), map[string]string{"title": "Returns"}), 202)
+	if resp.Document.Title != "Returns" || resp.Document.ContentType != ragplugin.ContentTypePDF {
+		t.Fatalf("unexpected PDF document: %+v", resp.Document)
+	}
+	plugin.WaitIndexing()
+
+	contents := map[string]string{}
+	for _, doc := range engine.indexed {
+		contents[doc.Title] = doc.Content
+	}
+	if c := contents["Shipping"]; !strings.Contains(c, "## Times") || !strings.Contains(c, "Orders ship within 2 days.") || !strings.Contains(c, "- Express") || strings.Contains(c, "alert") || strings.Contains(c, "p{}") {
+		t.Fatalf("unexpected HTML conversion: %q", c)
+	}
+	if c := contents["warranty"]; !strings.HasPrefix(c, "# warranty\n\n") || !strings.Contains(c, text) {
+		t.Fatalf("unexpected text conversion: %q", c)
+	}
+	if c := contents["Returns"]; !strings.Contains(c, "Returns need a receipt.\nKeep the box.") {
+		t.Fatalf("unexpected PDF conversion: %q", c)
+	}
+
+	// 不是PDF或没有文本的文件无法索引
+	if w := uploadFile(r, "POST", "/plugins/RAG/documents", "scan.pdf", []byte("not a pdf"), nil); w.Code != 400 {
+		t.Fatalf("expected 400 for an invalid PDF, got %d", w.Code)
+	}
+	if w := uploadFile(r, "POST", "/plugins/RAG/documents", "report.docx", []byte("data"), nil); w.Code != 415 {
+		t.Fatalf("expected 415 for an unsupported file, got %d", w.Code)
+	}
+}
+
+func TestRAGDocumentUploadRejectsInflatedPDF(t *testing.T) {
+	engine := &fakeDocumentEngine{}
+	r, plugin := setupDocumentRouter(t, engine)
+
+	// 两个各6MB的压缩流单独都未超限，解压后的总大小超过文档大小上限
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	for i := 4; i < 6; i++ {
+		var stream bytes.Buffer
+		zw := zlib.NewWriter(&stream)
+		zw.Write([]byte("BT (a) Tj ET\n"))
+		zw.Write(make([]byte, 6<<20))
+		zw.Close()
+		fmt.Fprintf(&pdf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n%sendstream\nendobj\n", i, stream.Len(), stream.String())
+	}
+	pdf.WriteString("%%EOF\n")
+	if pdf.Len() > 100<<10 {
+		t.Fatalf("expected a small compressed PDF, got %d bytes", pdf.Len())
+	}
+
+	if w := uploadFile(r, "POST", "/plugins/RAG/documents", "bomb.pdf", pdf.Bytes(), nil); w.Code != 413 {
+		t.Fatalf("expected 413 for an inflated PDF, got %d: %s", w.Code, w.Body.String())
+	}
+	plugin.WaitIndexing()
+	if len(engine.indexed) != 0 {
+		t.Fatalf("expected nothing to be indexed, got %d documents", len(engine.indexed))
+	}
+}
+
+func TestRAGDocumentUpdateReindexAndDelete(t *testing.T) {
+	engine := &fakeDocumentEngine{}
+	r, plugin := setupDocumentRouter(t, engine)
+
+	first := decodeDocument(t, doRAG(r, "POST", "/plugins/RAG/documents", `{"title":"FAQ","content":"Version one."}`), 202).Document
+	second := decodeDocument(t, doRAG(r, "POST", "/plugins/RAG/documents", `{"title":"Other","content":"Other content."}`), 202).Document
+	plugin.WaitIndexing()
+	path := fmt.Sprintf("/plugins/RAG/documents/%d", first.ID)
+
+	// 内容不变时不重新索引
+	resp := decodeDocument(t, doRAG(r, "PUT", path, `{"content":"Version one."}`), 200)
+	if resp.Changed {
+		t.Fatalf("expected an unchanged document, got %+v", resp)
+	}
+	// 与其他文档内容相同时冲突
+	if w := doRAG(r, "PUT", path, `{"content":"Other content.","title":"Other"}`); w.Code != 409 || !strings.Contains(w.Body.String(), fmt.Sprintf(`"document_id":%d`, second.ID)) {
+		t.Fatalf("expected 409 with the duplicate document, got %d: %s", w.Code, w.Body.String())
+	}
+
+	resp = decodeDocument(t, doRAG(r, "PUT", path, `{"content":"Version two."}`), 202)
+	if !resp.Changed || resp.Document.Title != "FAQ" {
+		t.Fatalf("expected the title to be kept, got %+v", resp)
+	}
+	plugin.WaitIndexing()
+	doc := getDocument(t, r, first.ID)
+	if doc.Status != models.DocumentStatusIndexed || len(engine.indexed) != 3 || !strings.Contains(engine.indexed[2].Content, "Version two.") {
+		t.Fatalf("expected the new content to be indexed, got %+v", doc)
+	}
+	// 新内容索引完成后删除旧切片
+	if len(engine.deleted) != 1 || engine.deleted[0] != engine.returned[first.ID][0] {
+		t.Fatalf("expected the previous chunk to be deleted, got %v", engine.deleted)
+	}
+	// 每次索引完成后清除租户的缓存回答
+	if len(engine.purged) != 3 || engine.purged[2] != 1 {
+		t.Fatalf("expected cached answers to be purged after each indexing, got %v", engine.purged)
+	}
+
+	// 索引失败时记录错误，重新索引后恢复
+	engine.indexErr = errors.New("embedding timeout")
+	decodeDocument(t, doRAG(r, "POST", path+"/reindex", ""), 202)
+	plugin.WaitIndexing()
+	if doc := getDocument(t, r, first.ID); doc.Status != models.DocumentStatusFailed || doc.Error != "embedding timeout" {
+		t.Fatalf("expected a failed document, got %+v", doc)
+	}
+	if len(engine.purged) != 3 {
+		t.Fatalf("expected no purge after a failed indexing, got %v", engine.purged)
+	}
+	engine.indexErr = nil
+	decodeDocument(t, doRAG(r, "POST", path+"/reindex", ""), 202)
+	plugin.WaitIndexing()
+	if doc := getDocument(t, r, first.ID); doc.Status != models.DocumentStatusIndexed || doc.Error != "" {
+		t.Fatalf("expected a re-indexed document, got %+v", doc)
+	}
+
+	// 删除文档时删除其切片
+	engine.deleted = nil
+	if w := doRAG(r, "DELETE", path, ""); w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(engine.deleted) != 1 || !strings.HasPrefix(engine.deleted[0], fmt.Sprintf("%d:", first.ID)) {
+		t.Fatalf("expected the chunks to be deleted, got %v", engine.deleted)
+	}
+	if len(engine.purged) != 5 {
+		t.Fatalf("expected cached answers to be purged after deletion, got %v", engine.purged)
+	}
+	if w := doRAG(r, "GET", path, ""); w.Code != 404 {
+		t.Fatalf("expected 404 after deletion, got %d", w.Code)
+	}
+	if w := doRAG(r, "GET", "/plugins/RAG/documents/abc", ""); w.Code != 400 {
+		t.Fatalf("expected 400 for an invalid ID, got %d", w.Code)
+	}
+}
+
+func TestRAGDocumentListIsTenantScoped(t *testing.T) {
+	engine := &fakeDocumentEngine{}
+	r, plugin := setupDocumentRouter(t, engine)
+
+	for i, collection := range []string{"policies", "policies", "faq"} {
+		doRAG(r, "POST", "/plugins/RAG/documents", fmt.Sprintf(`{"content":"Document %d","collection":"%s"}`, i, collection))
+	}
+	plugin.WaitIndexing()
+
+	var list struct {
+		Documents []map[string]interface{} `json:"documents"`
+		Total     int64                    `json:"total"`
+	}
+	w := doRAG(r, "GET", "/plugins/RAG/documents?collection=policies&status=indexed&page_size=1", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || w.Code != 200 {
+		t.Fatalf("unexpected list response %d: %s", w.Code, w.Body.String())
+	}
+	if list.Total != 2 || len(list.Documents) != 1 {
+		t.Fatalf("expected 2 documents on one page, got %d %d", list.Total, len(list.Documents))
+	}
+	if _, ok := list.Documents[0]["content"]; ok {
+		t.Fatalf("expected the content to be omitted, got %v", list.Documents[0])
+	}
+
+	// 其他租户看不到也不能删除这些文档
+	id := uint(list.Documents[0]["id"].(float64))
+	req, _ := http.NewRequest("GET", "/plugins/RAG/documents", nil)
+	req.Header.Set("X-Tenant-ID", "2")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || list.Total != 0 {
+		t.Fatalf("expected no documents for tenant 2, got %s", w.Body.String())
+	}
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/plugins/RAG/documents/%d", id), nil)
+	req.Header.Set("X-Tenant-ID", "2")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Fatalf("expected 404 for another tenant, got %d", w.Code)
+	}
+}
+
+func TestRAGDocumentsRequireIndexer(t *testing.T) {
+	// 引擎不支持文档索引时上传返回503，不保存文档
+	r, _ := setupDocumentRouter(t, &fakeRAGEngine{})
+	if w := doRAG(r, "POST", "/plugins/RAG/documents", `{"content":"text"}`); w.Code != 503 {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+	var count int64
+	pkg.DB.Model(&models.KnowledgeDocument{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no saved documents, got %d", count)
+	}
+}
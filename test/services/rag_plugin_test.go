@@ -0,0 +1,209 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"weave/pkg"
+	"weave/plugins/core"
+	"weave/services/rag/ragplugin"
+)
+
+// fakeRAGEngine 记录问题和租户，返回固定的回答和引用
+type fakeRAGEngine struct {
+	mu        sync.Mutex
+	questions []string
+	tenants   []uint
+	topKs     []int
+	colls     []string
+	err       error
+	deps      []ragplugin.Dependency
+	checks    int
+}
+
+func (e *fakeRAGEngine) Ask(ctx context.Context, query ragplugin.Query) (*ragplugin.Answer, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	tenantID, _ := pkg.TenantIDFromContext(ctx)
+	e.questions = append(e.questions, query.Question)
+	e.tenants = append(e.tenants, tenantID)
+	e.topKs = append(e.topKs, query.TopK)
+	e.colls = append(e.colls, query.Collection)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &ragplugin.Answer{
+		Answer: "Refunds are accepted within 30 days.",
+		Sources: []ragplugin.Source{
+			{ID: "doc:refund", Title: "Refund policy", Score: 0.92, Snippet: "Refunds are accepted within 30 days"},
+			{ID: "doc:shipping", Title: "Shipping", Score: 0.41, Snippet: "Orders ship within 2 days"},
+		},
+	}, nil
+}
+
+func (e *fakeRAGEngine) Check(ctx context.Context) []ragplugin.Dependency {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.checks++
+	return e.deps
+}
+
+// setupRAGRouter 注册RAG插件的路由，用中间件模拟认证并在请求上下文中设置租户1
+func setupRAGRouter(t *testing.T, factory ragplugin.Factory) (*gin.Engine, *ragplugin.RAGPlugin) {
+	gin.SetMode(gin.TestMode)
+	plugin := ragplugin.NewRAGPlugin(factory)
+	if err := core.GlobalPluginManager.Register(plugin); err != nil {
+		t.Fatalf("register plugin error: %v", err)
+	}
+	t.Cleanup(func() { core.GlobalPluginManager.Unregister(plugin.Name()) })
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", uint(1))
+		c.Set("tenant_id", uint(1))
+		c.Request = c.Request.WithContext(pkg.WithTenantID(c.Request.Context(), 1))
+		c.Next()
+	})
+	for _, route := range plugin.GetRoutes() {
+		if !route.AuthRequired {
+			t.Fatalf("route %s %s should require authentication", route.Method, route.Path)
+		}
+		handlers := append(append([]gin.HandlerFunc{}, route.Middlewares...), route.Handler)
+		r.Handle(route.Method, "/plugins/RAG/"+route.Path, handlers...)
+	}
+	return r, plugin
+}
+
+func doRAG(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRAGPluginAskCitesSources(t *testing.T) {
+	engine := &fakeRAGEngine{}
+	r, _ := setupRAGRouter(t, func(context.Context) (ragplugin.Engine, error) { return engine, nil })
+
+	w := doRAG(r, "POST", "/plugins/RAG/ask", `{"question":"  What is the refund policy? ","top_k":5}`)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var answer ragplugin.Answer
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if answer.Answer == "" || len(answer.Sources) != 2 || answer.Sources[0].ID != "doc:refund" || answer.Sources[0].Score != 0.92 {
+		t.Fatalf("unexpected answer: %+v", answer)
+	}
+	if engine.questions[0] != "What is the refund policy?" || engine.tenants[0] != 1 || engine.topKs[0] != 5 {
+		t.Fatalf("expected the trimmed question for tenant 1 with top_k 5, got %q tenant %d top_k %d", engine.questions[0], engine.tenants[0], engine.topKs[0])
+	}
+
+	// 未指定top_k时使用默认值
+	if w := doRAG(r, "POST", "/plugins/RAG/ask", `{"question":"shipping?"}`); w.Code != 200 || engine.topKs[1] != 3 {
+		t.Fatalf("expected the default top_k, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 指定集合时只在该集合中检索
+	if w := doRAG(r, "POST", "/plugins/RAG/ask", `{"question":"refund?","collection":"policies"}`); w.Code != 200 || engine.colls[2] != "policies" || engine.colls[0] != "" {
+		t.Fatalf("expected the collection to be passed through, got %d: %v", w.Code, engine.colls)
+	}
+
+	for _, body := range []string{`{}`, `{"question":"   "}`, `{"question":"q","top_k":21}`, `{"question":"q","top_k":-1}`, `{"question":"q","collection":"bad name"}`} {
+		if w := doRAG(r, "POST", "/plugins/RAG/ask", body); w.Code != 400 {
+			t.Fatalf("expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestRAGPluginDisabledAndEngineErrors(t *testing.T) {
+	engine := &fakeRAGEngine{}
+	r, plugin := setupRAGRouter(t, func(context.Context) (ragplugin.Engine, error) { return engine, nil })
+
+	if err := core.GlobalPluginManager.DisablePlugin(plugin.Name()); err != nil {
+		t.Fatalf("disable error: %v", err)
+	}
+	if w := doRAG(r, "POST", "/plugins/RAG/ask", `{"question":"q"}`); w.Code != 403 {
+		t.Fatalf("expected 403 for a disabled plugin, got %d", w.Code)
+	}
+	if err := core.GlobalPluginManager.EnablePlugin(plugin.Name()); err != nil {
+		t.Fatalf("enable error: %v", err)
+	}
+
+	// 引擎出错时返回503，配额错误原样返回
+	engine.err = errors.New("redis down")
+	if w := doRAG(r, "POST", "/plugins/RAG/ask", `{"question":"q"}`); w.Code != 503 {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	engine.err = pkg.NewQuotaExceededError("Quota exceeded", nil)
+	if w := doRAG(r, "POST", "/plugins/RAG/ask", `{"question":"q"}`); w.Code != 403 || !strings.Contains(w.Body.String(), "TENANT_QUOTA_EXCEEDED") {
+		t.Fatalf("expected the quota error, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRAGPluginEngineUnavailable(t *testing.T) {
+	calls := 0
+	r, plugin := setupRAGRouter(t, func(context.Context) (ragplugin.Engine, error) {
+		calls++
+		return nil, errors.New("ARK_API_KEY is not set")
+	})
+
+	// 引擎创建失败不影响插件注册，请求返回503，且在重试间隔内不会反复创建
+	if w := doRAG(r, "POST", "/plugins/RAG/ask", `{"question":"q"}`); w.Code != 503 {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("expected the factory to be called once, got %d", calls)
+	}
+	healthy, details := plugin.HealthCheck(context.Background())
+	deps, _ := details.([]ragplugin.Dependency)
+	if healthy || len(deps) != 1 || deps[0].Name != "engine" || !strings.Contains(deps[0].Error, "ARK_API_KEY") {
+		t.Fatalf("expected an unhealthy engine dependency, got %v %+v", healthy, details)
+	}
+	if _, err := plugin.Execute(map[string]interface{}{"question": "q"}); err == nil {
+		t.Fatal("expected Execute to fail without an engine")
+	}
+}
+
+func TestRAGPluginExecuteAndHealth(t *testing.T) {
+	engine := &fakeRAGEngine{deps: []ragplugin.Dependency{{Name: "redis", Healthy: true}, {Name: "embedding", Healthy: false, Error: "timeout"}}}
+	r, plugin := setupRAGRouter(t, func(context.Context) (ragplugin.Engine, error) { return engine, nil })
+
+	// 智能体调用时租户ID以字符串传入
+	result, err := plugin.Execute(map[string]interface{}{"question": "refund?", "top_k": float64(2), "tenant_id": "7"})
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	if answer, ok := result.(*ragplugin.Answer); !ok || len(answer.Sources) != 2 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+	if engine.tenants[0] != 7 || engine.topKs[0] != 2 {
+		t.Fatalf("expected tenant 7 with top_k 2, got %d %d", engine.tenants[0], engine.topKs[0])
+	}
+	if _, err := plugin.Execute(map[string]interface{}{}); err == nil {
+		t.Fatal("expected an error without a question")
+	}
+
+	// 任一依赖不健康时返回503，检查结果被缓存
+	w := doRAG(r, "GET", "/plugins/RAG/health", "")
+	if w.Code != 503 || !strings.Contains(w.Body.String(), `"embedding"`) {
+		t.Fatalf("expected 503 with dependencies, got %d: %s", w.Code, w.Body.String())
+	}
+	doRAG(r, "GET", "/plugins/RAG/health", "")
+	if engine.checks != 1 {
+		t.Fatalf("expected the health check to be cached, got %d checks", engine.checks)
+	}
+	if _, ok := interface{}(plugin).(core.HealthReporter); !ok {
+		t.Fatal("expected the plugin to report dependency health")
+	}
+}
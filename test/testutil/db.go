@@ -0,0 +1,29 @@
+// Package testutil 提供各测试包共用的辅助函数
+package testutil
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// OpenDB 打开内存SQLite数据库并迁移给定的模型
+// 内存数据库的每个连接都是独立的库，这里限制为单连接，避免审计流水线、文档索引等后台写入从连接池打开新的空库
+func OpenDB(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("gorm open error: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if len(models) > 0 {
+		if err := db.AutoMigrate(models...); err != nil {
+			t.Fatalf("auto migrate error: %v", err)
+		}
+	}
+	return db
+}
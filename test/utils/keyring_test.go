@@ -0,0 +1,145 @@
+package utils_test
+
+import (
+	"testing"
+
+	"weave/config"
+	"weave/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useAlgorithm 切换JWT签名算法，测试结束后恢复HS256配置
+func useAlgorithm(t *testing.T, algorithm string) {
+	t.Helper()
+	config.Config.JWT.Algorithm = algorithm
+	config.Config.JWT.KeyDir = t.TempDir()
+	config.Config.JWT.AccessTokenExpiry = 60
+	config.Config.JWT.RefreshTokenExpiry = 24
+	t.Cleanup(func() {
+		config.Config.JWT.Algorithm = "HS256"
+		config.Config.JWT.KeyDir = ""
+	})
+}
+
+func TestAsymmetricTokenSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			useAlgorithm(t, algorithm)
+
+			token, err := utils.GenerateToken(7, 9)
+			if err != nil {
+				t.Fatalf("GenerateToken error: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified error: %v", err)
+			}
+			if parsed.Header["alg"] != algorithm {
+				t.Errorf("expected alg %s, got %v", algorithm, parsed.Header["alg"])
+			}
+			if kid, _ := parsed.Header["kid"].(string); kid == "" {
+				t.Errorf("expected kid header to be set")
+			}
+
+			userID, tokenType, tenantID, err := utils.VerifyToken(token)
+			if err != nil {
+				t.Fatalf("VerifyToken error: %v", err)
+			}
+			if userID != 7 || tenantID != 9 || tokenType != "access" {
+				t.Errorf("unexpected claims: user=%d tenant=%d type=%s", userID, tenantID, tokenType)
+			}
+		})
+	}
+}
+
+func TestKeyRotationKeepsOldKeysForVerification(t *testing.T) {
+	useAlgorithm(t, "EdDSA")
+
+	oldToken, err := utils.GenerateToken(1, 1)
+	if err != nil {
+		t.Fatalf("GenerateToken error: %v", err)
+	}
+
+	kr, err := utils.GetKeyRing()
+	if err != nil {
+		t.Fatalf("GetKeyRing error: %v", err)
+	}
+	oldKey, _ := kr.ActiveKey()
+	newKey, err := kr.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate error: %v", err)
+	}
+	if newKey.ID == oldKey.ID {
+		t.Fatalf("expected a new kid after rotation")
+	}
+
+	// 轮换前签发的令牌仍然有效
+	if _, _, _, err := utils.VerifyToken(oldToken); err != nil {
+		t.Errorf("old token should still verify after rotation: %v", err)
+	}
+
+	// 新令牌使用新密钥签名
+	newToken, _ := utils.GenerateToken(1, 1)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if parsed.Header["kid"] != newKey.ID {
+		t.Errorf("expected kid %s, got %v", newKey.ID, parsed.Header["kid"])
+	}
+
+	// JWKS同时发布新旧公钥
+	jwks := kr.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys in JWKS, got %d", len(jwks.Keys))
+	}
+	for _, key := range jwks.Keys {
+		if key.Kty != "OKP" || key.Crv != "Ed25519" || key.X == "" || key.Use != "sig" {
+			t.Errorf("unexpected JWK: %+v", key)
+		}
+	}
+
+	// 保留期结束后旧密钥被清理，旧令牌失效
+	if err := kr.Prune(0); err != nil {
+		t.Fatalf("Prune error: %v", err)
+	}
+	if _, _, _, err := utils.VerifyToken(oldToken); err == nil {
+		t.Errorf("expected old token to fail after its key was pruned")
+	}
+}
+
+func TestKeyRingPersistsAcrossReload(t *testing.T) {
+	dir := t.TempDir()
+
+	kr := utils.NewKeyRing("RS256", dir)
+	if err := kr.Load(); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	active, _ := kr.ActiveKey()
+
+	reloaded := utils.NewKeyRing("RS256", dir)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	got, _ := reloaded.ActiveKey()
+	if got.ID != active.ID {
+		t.Errorf("expected active kid %s after reload, got %s", active.ID, got.ID)
+	}
+
+	jwks := reloaded.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].N == "" || jwks.Keys[0].E == "" {
+		t.Errorf("unexpected JWKS: %+v", jwks)
+	}
+}
+
+func TestAsymmetricTokenRejectsWrongAlgorithm(t *testing.T) {
+	useAlgorithm(t, "RS256")
+	config.Config.JWT.Secret = ""
+
+	// 未配置共享密钥时拒绝HS256令牌
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1, "type": "access"})
+	tokenString, _ := forged.SignedString([]byte("anything"))
+	if _, _, _, err := utils.VerifyToken(tokenString); err == nil {
+		t.Errorf("expected HS256 token to be rejected")
+	}
+	config.Config.JWT.Secret = "testsecret"
+}
@@ -33,15 +33,8 @@ func GenerateToken(userID uint, tenantID uint) (string, error) {
 		"iat":       time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
 	// 签名并获取完整的编码后的字符串token
-	tokenString, err := token.SignedString([]byte(config.Config.JWT.Secret))
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+	return signClaims(claims)
 }
 
 // GenerateRefreshToken 生成JWT刷新令牌（包含tenant_id）
@@ -55,27 +48,72 @@ func GenerateRefreshToken(userID uint, tenantID uint) (string, error) {
 		"iat":       time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
 	// 签名并获取完整的编码后的字符串token
-	tokenString, err := token.SignedString([]byte(config.Config.JWT.Secret))
+	return signClaims(claims)
+}
+
+// signClaims 按配置的算法签名claims
+// 非对称算法使用密钥环中的活跃密钥，并在头部写入kid
+func signClaims(claims jwt.MapClaims) (string, error) {
+	if !IsAsymmetricSigning() {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(config.Config.JWT.Secret))
+	}
+
+	kr, err := GetKeyRing()
+	if err != nil {
+		return "", err
+	}
+	key, err := kr.ActiveKey()
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-// VerifyToken 验证JWT令牌，返回userID、token类型与tenantID
-func VerifyToken(tokenString string) (uint, string, uint, error) {
-	// 解析token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// 验证签名算法
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// verificationKey 根据签名算法与kid选择验证密钥
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		// 切换到非对称算法后，仍配置了共享密钥时继续接受旧令牌直至过期
+		if IsAsymmetricSigning() && config.Config.JWT.Secret == "" {
 			return nil, errors.New("unexpected signing method")
 		}
 		return []byte(config.Config.JWT.Secret), nil
-	})
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+		if !IsAsymmetricSigning() {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("missing kid in token header")
+		}
+		kr, err := GetKeyRing()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := kr.Lookup(kid)
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		// 防止算法混淆：令牌算法必须与密钥算法一致
+		if key.Algorithm != token.Method.Alg() {
+			return nil, errors.New("signing method does not match key")
+		}
+		return key.PublicKey(), nil
+	default:
+		return nil, errors.New("unexpected signing method")
+	}
+}
+
+// VerifyToken 验证JWT令牌，返回userID、token类型与tenantID
+func VerifyToken(tokenString string) (uint, string, uint, error) {
+	// 解析token
+	token, err := jwt.Parse(tokenString, verificationKey,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
 
 	if err != nil {
 		return 0, "", 0, err
@@ -0,0 +1,507 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"weave/config"
+	"weave/pkg"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// keyRingFile 密钥环持久化文件名
+const keyRingFile = "keyring.json"
+
+// reloadThrottle 未知kid触发重新读取密钥目录的最小间隔
+const reloadThrottle = 30 * time.Second
+
+// SigningKey 非对称签名密钥
+type SigningKey struct {
+	ID         string        // 密钥ID，对应JWT头部的kid
+	Algorithm  string        // 签名算法：RS256/EdDSA
+	PrivateKey crypto.Signer // 私钥
+	CreatedAt  time.Time     // 创建时间
+	RetiredAt  time.Time     // 退役时间，零值表示当前活跃密钥
+}
+
+// PublicKey 返回用于验证签名的公钥
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+// signingMethod 返回密钥对应的JWT签名方法
+func (k *SigningKey) signingMethod() jwt.SigningMethod {
+	if k.Algorithm == "EdDSA" {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// JWK 单个JSON Web Key（RFC 7517）
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// storedKey 密钥的持久化格式
+type storedKey struct {
+	ID         string    `json:"kid"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey string    `json:"private_key"` // PKCS8 PEM
+	CreatedAt  time.Time `json:"created_at"`
+	RetiredAt  time.Time `json:"retired_at,omitempty"`
+}
+
+// KeyRing 签名密钥环
+// 保存一个活跃签名密钥和若干仍用于验证的已退役密钥
+type KeyRing struct {
+	mu        sync.RWMutex
+	algorithm string
+	dir       string
+	keys      map[string]*SigningKey
+	activeID  string
+	stopCh    chan struct{}
+	// lastReload 上次因未知kid重新读取磁盘的时间，用于限制重复读取
+	lastReload time.Time
+}
+
+// NewKeyRing 创建签名密钥环
+// dir为空时密钥仅保存在内存中，重启后会重新生成
+func NewKeyRing(algorithm, dir string) *KeyRing {
+	return &KeyRing{
+		algorithm: algorithm,
+		dir:       dir,
+		keys:      make(map[string]*SigningKey),
+	}
+}
+
+// Load 从密钥目录加载密钥，没有可用的活跃密钥时生成一个新密钥
+func (kr *KeyRing) Load() error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if err := kr.loadLocked(); err != nil {
+		return err
+	}
+
+	if kr.activeID == "" {
+		if _, err := kr.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadLocked 从磁盘读取密钥环，调用方需持有写锁
+func (kr *KeyRing) loadLocked() error {
+	if kr.dir == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(kr.dir, keyRingFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取密钥环失败: %w", err)
+	}
+
+	var stored []storedKey
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return fmt.Errorf("解析密钥环失败: %w", err)
+	}
+
+	keys := make(map[string]*SigningKey, len(stored))
+	activeID := ""
+	var activeCreated time.Time
+	for _, sk := range stored {
+		block, _ := pem.Decode([]byte(sk.PrivateKey))
+		if block == nil {
+			return fmt.Errorf("密钥 '%s' 格式无效", sk.ID)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("解析密钥 '%s' 失败: %w", sk.ID, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("密钥 '%s' 类型不受支持", sk.ID)
+		}
+
+		key := &SigningKey{
+			ID:         sk.ID,
+			Algorithm:  sk.Algorithm,
+			PrivateKey: signer,
+			CreatedAt:  sk.CreatedAt,
+			RetiredAt:  sk.RetiredAt,
+		}
+		keys[key.ID] = key
+
+		// 仅当前算法的未退役密钥可以作为活跃密钥
+		if key.RetiredAt.IsZero() && key.Algorithm == kr.algorithm && key.CreatedAt.After(activeCreated) {
+			activeID = key.ID
+			activeCreated = key.CreatedAt
+		}
+	}
+
+	kr.keys = keys
+	kr.activeID = activeID
+	return nil
+}
+
+// saveLocked 将密钥环写入磁盘，调用方需持有锁
+func (kr *KeyRing) saveLocked() error {
+	if kr.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(kr.dir, 0700); err != nil {
+		return fmt.Errorf("创建密钥目录失败: %w", err)
+	}
+
+	stored := make([]storedKey, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("序列化密钥 '%s' 失败: %w", key.ID, err)
+		}
+		stored = append(stored, storedKey{
+			ID:         key.ID,
+			Algorithm:  key.Algorithm,
+			PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			CreatedAt:  key.CreatedAt,
+			RetiredAt:  key.RetiredAt,
+		})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].CreatedAt.Before(stored[j].CreatedAt) })
+
+	content, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥环失败: %w", err)
+	}
+
+	// 先写临时文件再重命名，避免其他实例读取到不完整的文件
+	path := filepath.Join(kr.dir, keyRingFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return fmt.Errorf("写入密钥环失败: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Rotate 生成新的活跃密钥，原活跃密钥退役但仍保留用于验证
+func (kr *KeyRing) Rotate() (*SigningKey, error) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.rotateLocked()
+}
+
+// rotateLocked 执行密钥轮换，调用方需持有写锁
+func (kr *KeyRing) rotateLocked() (*SigningKey, error) {
+	key, err := generateSigningKey(kr.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if active, ok := kr.keys[kr.activeID]; ok {
+		active.RetiredAt = now
+	}
+
+	kr.keys[key.ID] = key
+	kr.activeID = key.ID
+
+	if err := kr.saveLocked(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// rotateIfDue 到达轮换间隔时轮换密钥
+// 轮换前重新读取磁盘，共享密钥目录的其他实例已完成轮换时直接沿用
+func (kr *KeyRing) rotateIfDue(interval time.Duration) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if err := kr.loadLocked(); err != nil {
+		return err
+	}
+
+	if active, ok := kr.keys[kr.activeID]; ok && time.Since(active.CreatedAt) < interval {
+		return nil
+	}
+
+	key, err := kr.rotateLocked()
+	if err != nil {
+		return err
+	}
+	pkg.Info("JWT签名密钥已轮换", zap.String("kid", key.ID), zap.String("algorithm", key.Algorithm))
+	return nil
+}
+
+// Prune 删除退役时间超过保留期的密钥
+func (kr *KeyRing) Prune(retention time.Duration) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	pruned := false
+	for id, key := range kr.keys {
+		if !key.RetiredAt.IsZero() && time.Since(key.RetiredAt) > retention {
+			delete(kr.keys, id)
+			pruned = true
+		}
+	}
+
+	if !pruned {
+		return nil
+	}
+	return kr.saveLocked()
+}
+
+// ActiveKey 获取当前活跃签名密钥
+func (kr *KeyRing) ActiveKey() (*SigningKey, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	key, ok := kr.keys[kr.activeID]
+	if !ok {
+		return nil, errors.New("no active signing key")
+	}
+	return key, nil
+}
+
+// Lookup 按kid查找密钥
+// 本地未找到时重新读取密钥目录，以识别其他实例轮换出的新密钥
+func (kr *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	kr.mu.RLock()
+	key, ok := kr.keys[kid]
+	kr.mu.RUnlock()
+	if ok || kr.dir == "" {
+		return key, ok
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	// 限制重新读取频率，避免伪造kid的请求反复触发磁盘读取
+	if time.Since(kr.lastReload) < reloadThrottle {
+		key, ok = kr.keys[kid]
+		return key, ok
+	}
+	kr.lastReload = time.Now()
+	if err := kr.loadLocked(); err != nil {
+		pkg.Warn("重新加载JWT密钥环失败", zap.Error(err))
+		return nil, false
+	}
+	key, ok = kr.keys[kid]
+	return key, ok
+}
+
+// JWKS 导出所有可用于验证的公钥
+func (kr *KeyRing) JWKS() JWKS {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		keys = append(keys, key)
+	}
+	// 最新密钥排在前面
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		jwk := JWK{Use: "sig", Kid: key.ID, Alg: key.Algorithm}
+		switch pub := key.PublicKey().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// StartRotation 启动定期密钥轮换和过期密钥清理
+func (kr *KeyRing) StartRotation(interval, retention time.Duration) {
+	kr.mu.Lock()
+	if kr.stopCh != nil {
+		kr.mu.Unlock()
+		return
+	}
+	stopCh := make(chan struct{})
+	kr.stopCh = stopCh
+	kr.mu.Unlock()
+
+	// 检查频率不超过每小时一次，保证轮换时间点足够精确
+	checkInterval := time.Hour
+	if interval < checkInterval {
+		checkInterval = interval
+	}
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := kr.rotateIfDue(interval); err != nil {
+					pkg.Error("JWT签名密钥轮换失败", zap.Error(err))
+				}
+				if err := kr.Prune(retention); err != nil {
+					pkg.Error("清理过期JWT签名密钥失败", zap.Error(err))
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// StopRotation 停止定期密钥轮换
+func (kr *KeyRing) StopRotation() {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if kr.stopCh != nil {
+		close(kr.stopCh)
+		kr.stopCh = nil
+	}
+}
+
+// generateSigningKey 按算法生成新的签名密钥
+func generateSigningKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	switch algorithm {
+	case "RS256":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("生成RSA密钥失败: %w", err)
+		}
+		signer = key
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("生成Ed25519密钥失败: %w", err)
+		}
+		signer = key
+	default:
+		return nil, fmt.Errorf("不支持的非对称签名算法: %s", algorithm)
+	}
+
+	kid, err := keyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:         kid,
+		Algorithm:  algorithm,
+		PrivateKey: signer,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// keyID 基于公钥DER编码的SHA-256摘要生成kid
+func keyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("序列化公钥失败: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// 全局密钥环
+var (
+	defaultKeyRing   *KeyRing
+	defaultKeyRingMu sync.Mutex
+)
+
+// GetKeyRing 获取全局签名密钥环，按当前配置懒加载
+func GetKeyRing() (*KeyRing, error) {
+	defaultKeyRingMu.Lock()
+	defer defaultKeyRingMu.Unlock()
+
+	algorithm := config.Config.JWT.Algorithm
+	dir := config.Config.JWT.KeyDir
+	if defaultKeyRing != nil && defaultKeyRing.algorithm == algorithm && defaultKeyRing.dir == dir {
+		return defaultKeyRing, nil
+	}
+
+	kr := NewKeyRing(algorithm, dir)
+	if err := kr.Load(); err != nil {
+		return nil, err
+	}
+	if defaultKeyRing != nil {
+		defaultKeyRing.StopRotation()
+	}
+	defaultKeyRing = kr
+	return kr, nil
+}
+
+// InitKeyRing 初始化全局密钥环并启动定期轮换
+// 使用HS256共享密钥时无需密钥环，直接返回
+func InitKeyRing() error {
+	if !IsAsymmetricSigning() {
+		return nil
+	}
+
+	kr, err := GetKeyRing()
+	if err != nil {
+		return fmt.Errorf("初始化JWT密钥环失败: %w", err)
+	}
+
+	kr.StartRotation(
+		time.Duration(config.Config.JWT.RotationInterval)*time.Hour,
+		time.Duration(config.Config.JWT.KeyRetention)*time.Hour,
+	)
+	return nil
+}
+
+// StopKeyRing 停止全局密钥环的定期轮换
+func StopKeyRing() {
+	defaultKeyRingMu.Lock()
+	defer defaultKeyRingMu.Unlock()
+	if defaultKeyRing != nil {
+		defaultKeyRing.StopRotation()
+	}
+}
+
+// IsAsymmetricSigning 当前配置是否使用非对称签名（RS256/EdDSA）
+func IsAsymmetricSigning() bool {
+	return config.Config.JWT.Algorithm == "RS256" || config.Config.JWT.Algorithm == "EdDSA"
+}
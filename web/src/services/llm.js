@@ -6,6 +6,33 @@ export const llmService = {
     timeout: 180000, // 增加到3分钟超时，适应LLM处理时间较长的情况
   },
 
+  // 构建请求头：携带登录令牌，修改状态的请求附加CSRF令牌
+  buildHeaders(method = 'GET', extra = {}) {
+    const headers = { 'Content-Type': 'application/json', ...extra };
+    const token = localStorage.getItem('token');
+    if (token) {
+      headers['Authorization'] = `Bearer ${token}`;
+    }
+    if (['POST', 'PUT', 'DELETE', 'PATCH'].includes(method)) {
+      const match = document.cookie.match(/(?:^|; )XSRF-TOKEN=([^;]+)/);
+      const csrf = match ? decodeURIComponent(match[1]) : sessionStorage.getItem('csrf_token');
+      if (csrf) {
+        headers['X-CSRF-Token'] = csrf;
+      }
+    }
+    return headers;
+  },
+
+  // 读取错误响应的详情（problem+json或纯文本）
+  async readError(response) {
+    try {
+      const errorData = await response.json();
+      return errorData.detail || errorData.message || JSON.stringify(errorData);
+    } catch (e) {
+      return response.statusText;
+    }
+  },
+
   // 创建带超时控制的fetch请求
   async fetchWithTimeout(url, options, timeout = this.config.timeout) {
     const controller = new AbortController();
@@ -32,8 +59,8 @@ export const llmService = {
     }
   },
 
-  // 发送聊天消息
-  async sendChatMessage(message) {
+  // 发送聊天消息，conversationId为空时创建新对话
+  async sendChatMessage(message, conversationId = null) {
     try {
       const startTime = Date.now();
       console.log(`[LLM] 发送消息: ${message}`);
@@ -44,27 +71,16 @@ export const llmService = {
       
       const response = await this.fetchWithTimeout(endpoint, {
         method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
+        headers: this.buildHeaders('POST'),
         credentials: 'include', // 包含cookie以确保会话一致
-        body: JSON.stringify({ message })
+        body: JSON.stringify({ message, conversation_id: conversationId || 0 })
       });
       
-      clearTimeout(timeoutId);
-      
       const endTime = Date.now();
       console.log(`[LLM] 响应状态: ${response.status}, 耗时: ${endTime - startTime}ms`);
       
       if (!response.ok) {
-        // 尝试获取错误详情
-        let errorDetails = '';
-        try {
-          const errorData = await response.json();
-          errorDetails = JSON.stringify(errorData);
-        } catch (e) {
-          errorDetails = await response.text();
-        }
+        const errorDetails = await this.readError(response);
         throw new Error(`API错误: ${response.status} ${response.statusText}, 详情: ${errorDetails}`);
       }
       
@@ -88,40 +104,92 @@ export const llmService = {
     }
   },
 
+  // 流式发送聊天消息（Server-Sent Events）
+  // onToken在收到每个片段时调用，返回done事件的数据（conversation_id、usage、latency_ms）
+  // 通过signal中止请求时服务端会取消生成
+  async streamChatMessage(message, conversationId = null, { onToken, signal } = {}) {
+    const endpoint = `${this.config.baseURL}/api/v1/llm/stream`;
+    const response = await fetch(endpoint, {
+      method: 'POST',
+      headers: this.buildHeaders('POST', { Accept: 'text/event-stream' }),
+      credentials: 'include',
+      body: JSON.stringify({ message, conversation_id: conversationId || 0 }),
+      signal
+    });
+
+    if (!response.ok) {
+      const errorDetails = await this.readError(response);
+      throw new Error(`API错误: ${response.status} ${response.statusText}, 详情: ${errorDetails}`);
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    let done = null;
+
+    // 解析一个SSE事件块，返回事件名和JSON数据
+    const parseEvent = (block) => {
+      let event = 'message';
+      const dataLines = [];
+      for (const line of block.split('\n')) {
+        if (line.startsWith('event:')) {
+          event = line.slice(6).trim();
+        } else if (line.startsWith('data:')) {
+          dataLines.push(line.slice(5));
+        }
+      }
+      return { event, data: dataLines.length ? JSON.parse(dataLines.join('\n')) : null };
+    };
+
+    while (true) {
+      const { value, done: finished } = await reader.read();
+      if (finished) break;
+      buffer += decoder.decode(value, { stream: true });
+
+      let boundary;
+      while ((boundary = buffer.indexOf('\n\n')) !== -1) {
+        const block = buffer.slice(0, boundary);
+        buffer = buffer.slice(boundary + 2);
+        const { event, data } = parseEvent(block);
+        if (event === 'token' && data) {
+          onToken && onToken(data.content);
+        } else if (event === 'done') {
+          done = data;
+        } else if (event === 'error') {
+          throw new Error((data && (data.detail || data.message)) || '生成回复失败');
+        }
+      }
+    }
+
+    if (!done) {
+      throw new Error('回复生成中断，请稍后再试');
+    }
+    console.log(`[LLM] 流式响应完成, 耗时: ${done.latency_ms}ms, 首个片段: ${done.first_token_ms}ms, 令牌: ${done.usage && done.usage.total_tokens}`);
+    return done;
+  },
+
   // 获取对话历史
-  async getChatHistory() {
+  async getChatHistory(conversationId) {
+    if (!conversationId) {
+      return { messages: [] };
+    }
     try {
-      const endpoint = `${this.config.baseURL}/plugins/LLMChat/api/history`;
+      const endpoint = `${this.config.baseURL}/plugins/LLMChat/api/conversations/${conversationId}/messages?page_size=100`;
       console.log(`[LLM] 获取历史记录请求到: ${endpoint}`);
       
       const response = await this.fetchWithTimeout(endpoint, {
         method: 'GET',
-        headers: {
-          'Content-Type': 'application/json',
-        },
+        headers: this.buildHeaders('GET'),
         credentials: 'include' // 包含cookie以确保会话一致
       }, 60000); // 历史记录请求使用1分钟超时
       
       if (!response.ok) {
-        let errorDetails = '';
-        try {
-          const errorData = await response.json();
-          errorDetails = JSON.stringify(errorData);
-        } catch (e) {
-          errorDetails = await response.text();
-        }
+        const errorDetails = await this.readError(response);
         throw new Error(`获取历史记录失败: ${response.status} ${response.statusText}, 详情: ${errorDetails}`);
       }
       
       const data = await response.json();
-      
-      // 标准化响应格式
-      if (!data.messages && data.length > 0) {
-        // 如果返回的是直接的消息数组，进行转换
-        return { messages: data };
-      }
-      
-      return data;
+      return { messages: (data.messages || []).map(({ role, content }) => ({ role, content })) };
     } catch (error) {
       console.error('[LLM] 获取对话历史失败:', error);
       // 返回空历史而不是抛出错误，以便UI可以正常初始化
@@ -130,27 +198,22 @@ export const llmService = {
   },
 
   // 清空对话历史
-  async clearChatHistory() {
+  async clearChatHistory(conversationId) {
+    if (!conversationId) {
+      return { success: true };
+    }
     try {
-      const endpoint = `${this.config.baseURL}/plugins/LLMChat/api/clear-history`;
+      const endpoint = `${this.config.baseURL}/plugins/LLMChat/api/conversations/${conversationId}/messages`;
       console.log(`[LLM] 清空历史记录请求到: ${endpoint}`);
       
       const response = await this.fetchWithTimeout(endpoint, {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
+        method: 'DELETE',
+        headers: this.buildHeaders('DELETE'),
         credentials: 'include'
       }, 60000); // 清空历史请求使用1分钟超时
       
       if (!response.ok) {
-        let errorDetails = '';
-        try {
-          const errorData = await response.json();
-          errorDetails = JSON.stringify(errorData);
-        } catch (e) {
-          errorDetails = await response.text();
-        }
+        const errorDetails = await this.readError(response);
         throw new Error(`清空历史记录失败: ${response.status} ${response.statusText}, 详情: ${errorDetails}`);
       }
       
@@ -165,47 +228,18 @@ export const llmService = {
   // 检查API连接状态
   async checkConnection() {
     try {
-      const endpoint = `${this.config.baseURL}/plugins/LLMChat/api/health`;
+      const endpoint = `${this.config.baseURL}/plugins/LLMChat/api/conversations?page_size=1`;
       console.log(`[LLM] 健康检查请求到: ${endpoint}`);
       
-      // 使用健康检查端点而不是history端点，这样更轻量
       const response = await this.fetchWithTimeout(endpoint, {
         method: 'GET',
-        headers: {
-          'Content-Type': 'application/json',
-        },
+        headers: this.buildHeaders('GET'),
         credentials: 'include'
       }, 15000); // 健康检查使用15秒超时
       
-      // 如果health端点不可用，尝试使用history端点作为备选
-      if (!response.ok) {
-        console.log('[LLM] 健康检查端点不可用，尝试使用history端点');
-        const historyEndpoint = `${this.config.baseURL}/plugins/LLMChat/api/history`;
-        return this.checkConnectionWithFallback(historyEndpoint);
-      }
-      
-      return response.ok;
-    } catch (error) {
-      console.error('[LLM] 健康检查失败，尝试使用history端点:', error);
-      const historyEndpoint = `${this.config.baseURL}/plugins/LLMChat/api/history`;
-      return this.checkConnectionWithFallback(historyEndpoint);
-    }
-  },
-  
-  // 备用连接检查方法
-  async checkConnectionWithFallback(endpoint) {
-    try {
-      console.log(`[LLM] 使用备用端点进行连接检查: ${endpoint}`);
-      const response = await this.fetchWithTimeout(endpoint, {
-        method: 'GET',
-        headers: {
-          'Content-Type': 'application/json',
-        },
-        credentials: 'include'
-      }, 15000); // 备用连接检查也使用15秒超时
       return response.ok;
     } catch (error) {
-      console.error('[LLM] 备用连接检查也失败:', error);
+      console.error('[LLM] 健康检查失败:', error);
       return false;
     }
   }